@@ -0,0 +1,382 @@
+// Package agents tracks push agents that registered themselves, so the collector knows
+// which agents should push what and how often, and can flag the ones that went quiet
+package agents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/audit"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// what an agent announces about itself on POST /register
+type Registration struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	// metrics the agent pushes every interval
+	ExpectedMetrics []string        `json:"expectedMetrics,omitempty"`
+	PushInterval    config.Duration `json:"pushInterval"`
+}
+
+func (reg *Registration) Validate() error {
+	if reg.Name == "" {
+		return errors.New("missing agent name")
+	}
+	if reg.PushInterval.Duration <= 0 {
+		return errors.New("push interval must be positive")
+	}
+	return nil
+}
+
+// a registered agent, saved in the state file
+type Agent struct {
+	Registration
+	// identity of the registering request, pushes from it are attributed to the agent
+	Source       string    `json:"source"`
+	RegisteredAt time.Time `json:"registeredAt"`
+	LastPush     time.Time `json:"lastPush,omitempty"`
+
+	// expected metric -> last push
+	lastMetric map[string]time.Time
+	// agents that never pushed count from here, the registration or the collector start
+	since time.Time
+}
+
+// returned by Register for an agent registered from another source
+var ErrOwned = errors.New("agent is registered from another source")
+
+// returned by Register for a new agent beyond config.AgentsConfig.MaxAgents
+var ErrTooManyAgents = errors.New("too many registered agents")
+
+// Registry keeps the registered agents; pushes are attributed to agents by their source
+// (token, client certificate or IP address, as for quotas). An agent may only be registered
+// again from its source or by an admin, a source registering another name replaces its agent
+type Registry struct {
+	lock sync.Mutex
+
+	cfg  config.AgentsConfig
+	sink metrics.MetricSink
+	// optional, records reloads of the agent configurations
+	Audit *audit.Log
+
+	agents map[string]*Agent
+	// source -> agent name
+	bySource map[string]string
+
+	// settings served to agents, see reloadRules
+	rules            []config.AgentConfigRule
+	rulesFingerprint string
+
+	// registrations changed since the state file was written
+	dirty bool
+}
+
+func NewRegistry(cfg config.AgentsConfig, sink metrics.MetricSink) *Registry {
+	if cfg.MaxAgents <= 0 {
+		cfg.MaxAgents = DEFAULT_MAX_AGENTS
+	}
+	return &Registry{
+		cfg:      cfg,
+		sink:     sink,
+		agents:   make(map[string]*Agent),
+		bySource: make(map[string]string),
+	}
+}
+
+// loads registrations of the previous run and agent configurations, then updates agent state,
+// expires agents, saves changed registrations and reloads changed configurations every CheckInterval
+func (registry *Registry) Start() error {
+	if err := registry.reloadRules(); err != nil {
+		return err
+	}
+	if err := registry.load(); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(registry.cfg.CheckInterval.Duration)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := registry.reloadRules(); err != nil {
+				// keep the previous rules until the files are fixed
+				logger.Error(fmt.Sprintf("Failed to reload agent configurations from %s: %v", registry.cfg.ConfigDir, err))
+			}
+			registry.expire()
+			registry.update()
+			registry.flush()
+		}
+	}()
+	return nil
+}
+
+// records a registration from source, returns false for an agent registered before; admin
+// may take over agents registered from other sources, others get ErrOwned
+func (registry *Registry) Register(source string, admin bool, reg Registration) (bool, error) {
+	if err := reg.Validate(); err != nil {
+		registry.sink.IncCounter(AGENT_REGISTRATIONS_METRIC, map[string]string{"result": "rejected"})
+		return false, err
+	}
+
+	registry.lock.Lock()
+	previous, known := registry.agents[reg.Name]
+	var err error
+	switch {
+	case known && previous.Source != source && !admin:
+		err = ErrOwned
+	case !known && len(registry.agents) >= registry.cfg.MaxAgents:
+		err = ErrTooManyAgents
+	}
+	if err != nil {
+		registry.lock.Unlock()
+		registry.sink.IncCounter(AGENT_REGISTRATIONS_METRIC, map[string]string{"result": "rejected"})
+		return false, err
+	}
+
+	now := time.Now()
+	agent := &Agent{Registration: reg, Source: source, RegisteredAt: now, lastMetric: make(map[string]time.Time), since: now}
+	if known {
+		agent.LastPush = previous.LastPush
+		for _, name := range reg.ExpectedMetrics {
+			if seen, ok := previous.lastMetric[name]; ok {
+				agent.lastMetric[name] = seen
+			}
+		}
+		if registry.bySource[previous.Source] == reg.Name {
+			delete(registry.bySource, previous.Source)
+		}
+	}
+	// the agent the source registered before is gone, e.g. renamed
+	var replaced *Agent
+	if name, ok := registry.bySource[source]; ok && name != reg.Name {
+		replaced = registry.agents[name]
+		delete(registry.agents, name)
+	}
+	registry.agents[reg.Name] = agent
+	registry.bySource[source] = reg.Name
+	registry.dirty = true
+	registry.lock.Unlock()
+
+	if replaced != nil {
+		logger.Info(fmt.Sprintf("Agent %s is replaced by %s registering from %s", replaced.Name, reg.Name, source))
+		registry.forget(replaced)
+	}
+	if known && (previous.Version != reg.Version || previous.Source != source) {
+		// the info series of the old version would stay exposed otherwise
+		registry.deleteSeries(AGENT_INFO_METRIC, infoLabels(previous))
+	}
+	registry.sink.SetGauge(AGENT_INFO_METRIC, infoLabels(agent), 1)
+	result := "registered"
+	if known {
+		result = "updated"
+	}
+	registry.sink.IncCounter(AGENT_REGISTRATIONS_METRIC, map[string]string{"result": result})
+	logger.Info(fmt.Sprintf("Agent %s %s %s from %s, pushing every %v", reg.Name, reg.Version, result, source, reg.PushInterval.Duration))
+
+	registry.update()
+	return !known, nil
+}
+
+// removes agents that neither pushed nor registered within Expiry
+func (registry *Registry) expire() {
+	if registry.cfg.Expiry.Duration <= 0 {
+		return
+	}
+	now := time.Now()
+	var expired []*Agent
+	registry.lock.Lock()
+	for name, agent := range registry.agents {
+		last := agent.LastPush
+		if last.Before(agent.since) {
+			last = agent.since
+		}
+		if now.Sub(last) <= registry.cfg.Expiry.Duration {
+			continue
+		}
+		delete(registry.agents, name)
+		if registry.bySource[agent.Source] == name {
+			delete(registry.bySource, agent.Source)
+		}
+		expired = append(expired, agent)
+	}
+	if len(expired) > 0 {
+		registry.dirty = true
+	}
+	registry.lock.Unlock()
+
+	for _, agent := range expired {
+		logger.Info(fmt.Sprintf("Agent %s expired, no push or registration for %v", agent.Name, registry.cfg.Expiry.Duration))
+		registry.forget(agent)
+	}
+}
+
+// drops the series of a removed agent
+func (registry *Registry) forget(agent *Agent) {
+	registry.deleteSeries(AGENT_INFO_METRIC, infoLabels(agent))
+	registry.deleteSeries(AGENT_UP_METRIC, map[string]string{"agent": agent.Name})
+	registry.deleteSeries(AGENT_MISSING_METRICS_METRIC, map[string]string{"agent": agent.Name})
+}
+
+func (registry *Registry) deleteSeries(name string, labels map[string]string) {
+	if deleter, ok := registry.sink.(metrics.SeriesDeleter); ok {
+		deleter.DeleteSeries(name, labels)
+	}
+}
+
+// records a push of metric from source, nil-safe
+func (registry *Registry) Seen(source, metric string) {
+	if registry == nil {
+		return
+	}
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	agent, ok := registry.agents[registry.bySource[source]]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	agent.LastPush = now
+	if _, expected := agent.lastMetric[metric]; expected || agent.expects(metric) {
+		agent.lastMetric[metric] = now
+	}
+}
+
+// registered agents sorted by name
+func (registry *Registry) Agents() []Agent {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	agents := make([]Agent, 0, len(registry.agents))
+	for _, agent := range registry.agents {
+		agents = append(agents, *agent)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
+
+func (agent *Agent) expects(metric string) bool {
+	for _, name := range agent.ExpectedMetrics {
+		if name == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// sets AGENT_UP_METRIC and AGENT_MISSING_METRICS_METRIC of all agents
+func (registry *Registry) update() {
+	type state struct {
+		up      bool
+		missing int
+	}
+	states := make(map[string]state)
+	now := time.Now()
+
+	registry.lock.Lock()
+	for name, agent := range registry.agents {
+		grace := time.Duration(registry.cfg.MissedPushes) * registry.interval(agent)
+		last := agent.LastPush
+		if last.Before(agent.since) {
+			last = agent.since
+		}
+		missing := 0
+		for _, metric := range agent.ExpectedMetrics {
+			seen, ok := agent.lastMetric[metric]
+			if !ok {
+				seen = agent.since
+			}
+			if now.Sub(seen) > grace {
+				missing++
+			}
+		}
+		states[name] = state{up: now.Sub(last) <= grace, missing: missing}
+	}
+	registry.lock.Unlock()
+
+	for name, s := range states {
+		up := 0.0
+		if s.up {
+			up = 1
+		}
+		registry.sink.SetGauge(AGENT_UP_METRIC, map[string]string{"agent": name}, up)
+		registry.sink.SetGauge(AGENT_MISSING_METRICS_METRIC, map[string]string{"agent": name}, float64(s.missing))
+	}
+}
+
+// saves the registrations if they changed since the last save
+func (registry *Registry) flush() {
+	registry.lock.Lock()
+	dirty := registry.dirty
+	registry.dirty = false
+	registry.lock.Unlock()
+	if dirty {
+		registry.save()
+	}
+}
+
+// writes the registrations to the state file, failures are logged
+func (registry *Registry) save() {
+	if registry.cfg.StateFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(registry.Agents(), "", "  ")
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode agent registrations: %v", err))
+		return
+	}
+	tmp := registry.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save agent registrations: %v", err))
+		return
+	}
+	if err := os.Rename(tmp, registry.cfg.StateFile); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save agent registrations: %v", err))
+	}
+}
+
+// reads registrations saved by a previous run, like new registrations
+// the agents have MissedPushes intervals to push
+func (registry *Registry) load() error {
+	if registry.cfg.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(registry.cfg.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []Agent
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("%s: %w", registry.cfg.StateFile, err)
+	}
+
+	now := time.Now()
+	registry.lock.Lock()
+	for i := range saved {
+		agent := &saved[i]
+		agent.lastMetric = make(map[string]time.Time)
+		agent.since = now
+		registry.agents[agent.Name] = agent
+		registry.bySource[agent.Source] = agent.Name
+	}
+	registry.lock.Unlock()
+
+	for i := range saved {
+		registry.sink.SetGauge(AGENT_INFO_METRIC, infoLabels(&saved[i]), 1)
+	}
+	registry.update()
+	logger.Info(fmt.Sprintf("Loaded %d agent registrations from %s", len(saved), registry.cfg.StateFile))
+	return nil
+}
+
+func infoLabels(agent *Agent) map[string]string {
+	return map[string]string{"agent": agent.Name, "version": agent.Version, "source": agent.Source}
+}
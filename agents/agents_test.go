@@ -0,0 +1,81 @@
+package agents
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+type nopSink struct{}
+
+func (nopSink) IncCounter(name string, labels map[string]string)                    {}
+func (nopSink) AddCounter(name string, labels map[string]string, delta float64)     {}
+func (nopSink) SetGauge(name string, labels map[string]string, value float64)       {}
+func (nopSink) Observe(name string, labels map[string]string, value float64)        {}
+func (nopSink) ObserveSummary(name string, labels map[string]string, value float64) {}
+
+func newTestRegistry(cfg config.AgentsConfig) *Registry {
+	cfg.MissedPushes = 1
+	return NewRegistry(cfg, nopSink{})
+}
+
+func registration(name string) Registration {
+	return Registration{Name: name, PushInterval: config.Duration{Duration: time.Minute}}
+}
+
+func TestRegisterKeepsAgentsToTheirSource(t *testing.T) {
+	registry := newTestRegistry(config.AgentsConfig{})
+	if _, err := registry.Register("ip:10.0.0.1", false, registration("esx-01")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Register("ip:10.0.0.2", false, registration("esx-01")); !errors.Is(err, ErrOwned) {
+		t.Fatalf("registration from another source returned %v, expected ErrOwned", err)
+	}
+	if _, err := registry.Register("ip:10.0.0.2", true, registration("esx-01")); err != nil {
+		t.Fatalf("admin registration returned %v", err)
+	}
+	if owner := registry.AgentOf("ip:10.0.0.2"); owner != "esx-01" {
+		t.Fatalf("agent of the admin's source is %q, expected esx-01", owner)
+	}
+	if owner := registry.AgentOf("ip:10.0.0.1"); owner != "" {
+		t.Fatalf("previous source still owns %q", owner)
+	}
+}
+
+func TestRegisterReplacesRenamedAgent(t *testing.T) {
+	registry := newTestRegistry(config.AgentsConfig{})
+	registry.Register("ip:10.0.0.1", false, registration("esx-01"))
+	registry.Register("ip:10.0.0.1", false, registration("esx-01-renamed"))
+	agents := registry.Agents()
+	if len(agents) != 1 || agents[0].Name != "esx-01-renamed" {
+		t.Fatalf("registered agents %v, expected only esx-01-renamed", agents)
+	}
+}
+
+func TestRegisterLimitsAgents(t *testing.T) {
+	registry := newTestRegistry(config.AgentsConfig{MaxAgents: 1})
+	registry.Register("ip:10.0.0.1", false, registration("esx-01"))
+	if _, err := registry.Register("ip:10.0.0.2", false, registration("esx-02")); !errors.Is(err, ErrTooManyAgents) {
+		t.Fatalf("registration beyond the limit returned %v, expected ErrTooManyAgents", err)
+	}
+	// known agents may still register again
+	if _, err := registry.Register("ip:10.0.0.1", false, registration("esx-01")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpireRemovesQuietAgents(t *testing.T) {
+	registry := newTestRegistry(config.AgentsConfig{Expiry: config.Duration{Duration: time.Hour}})
+	registry.Register("ip:10.0.0.1", false, registration("esx-01"))
+	registry.Register("ip:10.0.0.2", false, registration("esx-02"))
+	registry.agents["esx-01"].since = time.Now().Add(-2 * time.Hour)
+	registry.expire()
+	if agents := registry.Agents(); len(agents) != 1 || agents[0].Name != "esx-02" {
+		t.Fatalf("agents after expiry %v, expected only esx-02", agents)
+	}
+	if owner := registry.AgentOf("ip:10.0.0.1"); owner != "" {
+		t.Fatalf("expired agent %q still owns its source", owner)
+	}
+}
@@ -0,0 +1,16 @@
+package agents
+
+// 1 while a registered agent pushes within its interval, labelled by agent
+const AGENT_UP_METRIC = "collector_agent_up"
+
+// always 1, labelled by agent, version and source
+const AGENT_INFO_METRIC = "collector_agent_info"
+
+// expected metrics of an agent not pushed within MissedPushes intervals
+const AGENT_MISSING_METRICS_METRIC = "collector_agent_missing_metrics"
+
+// registrations of agents, labelled by result ("registered", "updated" or "rejected")
+const AGENT_REGISTRATIONS_METRIC = "collector_agent_registrations_total"
+
+// default of config.AgentsConfig.MaxAgents
+const DEFAULT_MAX_AGENTS = 10000
@@ -0,0 +1,116 @@
+package agents
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/audit"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/sources"
+)
+
+// configuration served to an agent on registration and GET /agent/config
+type Settings struct {
+	Agent          string            `json:"agent"`
+	PushInterval   config.Duration   `json:"pushInterval"`
+	EnabledMetrics []string          `json:"enabledMetrics,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	// changes whenever the settings change, agents poll with If-None-Match
+	Revision string `json:"revision"`
+}
+
+// settings of a registered agent, false if the agent is unknown
+func (registry *Registry) Settings(name string) (Settings, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	agent, ok := registry.agents[name]
+	if !ok {
+		return Settings{}, false
+	}
+	settings := Settings{Agent: name, PushInterval: agent.PushInterval}
+	if rule := registry.rule(name); rule != nil {
+		if rule.PushInterval.Duration > 0 {
+			settings.PushInterval = rule.PushInterval
+		}
+		settings.EnabledMetrics = rule.EnabledMetrics
+		settings.Labels = rule.Labels
+	}
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	settings.Revision = hex.EncodeToString(sum[:8])
+	return settings, true
+}
+
+// name of the agent registered from source, empty if none
+func (registry *Registry) AgentOf(source string) string {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	return registry.bySource[source]
+}
+
+// first rule matching the agent, nil if none; caller must hold the lock
+func (registry *Registry) rule(name string) *config.AgentConfigRule {
+	for i := range registry.rules {
+		if matched, _ := path.Match(registry.rules[i].Match, name); matched {
+			return &registry.rules[i]
+		}
+	}
+	return nil
+}
+
+// push interval the agent is expected to keep, caller must hold the lock
+func (registry *Registry) interval(agent *Agent) time.Duration {
+	if rule := registry.rule(agent.Name); rule != nil && rule.PushInterval.Duration > 0 {
+		return rule.PushInterval.Duration
+	}
+	return agent.PushInterval.Duration
+}
+
+// re-reads the configuration directory if any file was added, removed or modified;
+// invalid files keep the previous rules
+func (registry *Registry) reloadRules() error {
+	if registry.cfg.ConfigDir == "" {
+		return nil
+	}
+	files, fingerprint, err := sources.ListFiles(registry.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	registry.lock.Lock()
+	unchanged := fingerprint == registry.rulesFingerprint
+	registry.lock.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	var rules []config.AgentConfigRule
+	for _, file := range files {
+		list, err := sources.ReadList[config.AgentConfigRule](file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for i, rule := range list {
+			if _, err := path.Match(rule.Match, ""); err != nil || rule.Match == "" {
+				return fmt.Errorf("%s: rule %d: invalid match pattern %q", file, i, rule.Match)
+			}
+			if rule.PushInterval.Duration < 0 {
+				return fmt.Errorf("%s: rule %d: negative push interval", file, i)
+			}
+		}
+		rules = append(rules, list...)
+	}
+
+	registry.lock.Lock()
+	before := registry.rules
+	registry.rules = rules
+	registry.rulesFingerprint = fingerprint
+	registry.lock.Unlock()
+	registry.Audit.Record(audit.Entry{Actor: "collector", Action: "reload_agent_configs", Target: registry.cfg.ConfigDir, Before: before, After: rules, Result: "ok"})
+	logger.Info(fmt.Sprintf("Loaded %d agent configuration rules from %d files in %s", len(rules), len(files), registry.cfg.ConfigDir))
+	return nil
+}
@@ -0,0 +1,325 @@
+// Package annotations records discrete events (deployments, maintenance windows, breakers
+// opening) next to the numeric metrics, served in the shape of Grafana's annotations HTTP API
+package annotations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+var ErrNotFound = errors.New("annotation not found")
+
+// an event, a point in time or a region when TimeEnd is after Time; times are epoch milliseconds
+// POST JSON: {"time":1700000000000,"text":"Deployed vsphere-agent 1.4.2","tags":["deploy","prod"]}
+type Annotation struct {
+	ID      int64    `json:"id"`
+	Time    int64    `json:"time"`
+	TimeEnd int64    `json:"timeEnd"`
+	Text    string   `json:"text"`
+	Tags    []string `json:"tags"`
+	// who recorded it, one of the SOURCE_* constants
+	Source string `json:"source,omitempty"`
+	// set while a region started by Begin has not ended, it then extends to now
+	Key string `json:"key,omitempty"`
+}
+
+// changes of an annotation on PATCH, empty fields stay as they are
+// PATCH JSON: {"timeEnd":1700000600000}
+type Change struct {
+	TimeEnd int64    `json:"timeEnd,omitempty"`
+	Text    string   `json:"text,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// what Query returns: annotations overlapping From..To (epoch milliseconds, 0 leaves the end
+// open) carrying all Tags, or any of them with MatchAny, newest first
+type Filter struct {
+	From     int64
+	To       int64
+	Tags     []string
+	MatchAny bool
+	Limit    int
+}
+
+// Store keeps annotations in memory, up to MaxEvents and for Retention after they ended, and
+// in StateFile if configured; all methods are nil-safe except Load
+type Store struct {
+	lock sync.Mutex
+	// serializes writes of the state file
+	saveLock sync.Mutex
+
+	cfg  config.AnnotationsConfig
+	sink metrics.MetricSink
+
+	// in creation order
+	events []*Annotation
+	nextID int64
+}
+
+func NewStore(cfg config.AnnotationsConfig, sink metrics.MetricSink) *Store {
+	return &Store{cfg: cfg, sink: sink, nextID: 1}
+}
+
+// records an event, Time defaults to now and TimeEnd to Time
+func (store *Store) Add(event Annotation) (Annotation, error) {
+	if store == nil {
+		return Annotation{}, errors.New("annotations are disabled")
+	}
+	if event.Text == "" {
+		return Annotation{}, errors.New("missing text")
+	}
+	if event.Time == 0 {
+		event.Time = time.Now().UnixMilli()
+	}
+	if event.TimeEnd == 0 {
+		event.TimeEnd = event.Time
+	}
+	if event.TimeEnd < event.Time {
+		return Annotation{}, errors.New("timeEnd is before time")
+	}
+	if event.Tags == nil {
+		event.Tags = []string{}
+	}
+	if event.Source == "" {
+		event.Source = SOURCE_PUSH
+	}
+
+	store.lock.Lock()
+	event.ID = store.nextID
+	store.nextID++
+	added := event
+	store.events = append(store.events, &added)
+	store.prune(time.Now())
+	store.lock.Unlock()
+
+	store.sink.IncCounter(ANNOTATIONS_METRIC, map[string]string{"source": event.Source})
+	store.save()
+	return event, nil
+}
+
+// applies a change to the annotation with id; an open region ends with a new TimeEnd
+func (store *Store) Update(id int64, change Change) (Annotation, error) {
+	if store == nil {
+		return Annotation{}, ErrNotFound
+	}
+	store.lock.Lock()
+	event := store.find(id)
+	if event == nil {
+		store.lock.Unlock()
+		return Annotation{}, ErrNotFound
+	}
+	if change.TimeEnd != 0 && change.TimeEnd < event.Time {
+		store.lock.Unlock()
+		return Annotation{}, errors.New("timeEnd is before time")
+	}
+	if change.TimeEnd != 0 {
+		event.TimeEnd = change.TimeEnd
+		event.Key = ""
+	}
+	if change.Text != "" {
+		event.Text = change.Text
+	}
+	if change.Tags != nil {
+		event.Tags = change.Tags
+	}
+	updated := *event
+	store.lock.Unlock()
+
+	store.save()
+	return updated, nil
+}
+
+// starts a region identified by key, ended by Finish; a region of the key that is still open,
+// e.g. saved by the previous run, is kept instead of starting another one
+func (store *Store) Begin(source, key, text string, tags []string) {
+	if store == nil {
+		return
+	}
+	store.lock.Lock()
+	open := store.open(key) != nil
+	store.lock.Unlock()
+	if open {
+		return
+	}
+	if _, err := store.Add(Annotation{Text: text, Tags: tags, Source: source, Key: key}); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to record annotation %q: %v", text, err))
+	}
+}
+
+// ends the open region of key now, if any
+func (store *Store) Finish(key string) {
+	if store == nil {
+		return
+	}
+	store.lock.Lock()
+	event := store.open(key)
+	if event != nil {
+		event.TimeEnd = time.Now().UnixMilli()
+		event.Key = ""
+	}
+	store.lock.Unlock()
+	if event != nil {
+		store.save()
+	}
+}
+
+// annotations matching filter, open regions end now
+func (store *Store) Query(filter Filter) []Annotation {
+	if store == nil {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DEFAULT_QUERY_LIMIT
+	}
+
+	store.lock.Lock()
+	matched := make([]Annotation, 0)
+	for _, event := range store.events {
+		found := *event
+		if found.Key != "" {
+			found.TimeEnd = now
+		}
+		if found.TimeEnd < filter.From || (filter.To > 0 && found.Time > filter.To) {
+			continue
+		}
+		if !hasTags(found.Tags, filter.Tags, filter.MatchAny) {
+			continue
+		}
+		matched = append(matched, found)
+	}
+	store.lock.Unlock()
+
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Time > matched[j].Time })
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched
+}
+
+// whether tags has all of wanted, or any of them with matchAny; no wanted tags match all
+func hasTags(tags, wanted []string, matchAny bool) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, tag := range wanted {
+		found := false
+		for _, have := range tags {
+			if have == tag {
+				found = true
+				break
+			}
+		}
+		if found && matchAny {
+			return true
+		}
+		if !found && !matchAny {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+// callers hold the lock
+func (store *Store) find(id int64) *Annotation {
+	for _, event := range store.events {
+		if event.ID == id {
+			return event
+		}
+	}
+	return nil
+}
+
+// callers hold the lock
+func (store *Store) open(key string) *Annotation {
+	for _, event := range store.events {
+		if event.Key == key {
+			return event
+		}
+	}
+	return nil
+}
+
+// drops annotations beyond MaxEvents and those that ended before Retention, callers hold the lock
+func (store *Store) prune(now time.Time) {
+	if excess := len(store.events) - store.cfg.MaxEvents; excess > 0 {
+		store.events = append([]*Annotation(nil), store.events[excess:]...)
+	}
+	if store.cfg.Retention.Duration <= 0 {
+		return
+	}
+	cutoff := now.Add(-store.cfg.Retention.Duration).UnixMilli()
+	kept := store.events[:0]
+	for _, event := range store.events {
+		if event.Key != "" || event.TimeEnd >= cutoff {
+			kept = append(kept, event)
+		}
+	}
+	store.events = kept
+}
+
+func (store *Store) save() {
+	if store.cfg.StateFile == "" {
+		return
+	}
+	store.saveLock.Lock()
+	defer store.saveLock.Unlock()
+
+	store.lock.Lock()
+	data, err := json.MarshalIndent(store.events, "", "  ")
+	store.lock.Unlock()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode annotations: %v", err))
+		return
+	}
+	tmp := store.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save annotations: %v", err))
+		return
+	}
+	if err := os.Rename(tmp, store.cfg.StateFile); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save annotations: %v", err))
+	}
+}
+
+// reads the annotations saved by a previous run
+func (store *Store) Load() error {
+	if store.cfg.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(store.cfg.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []*Annotation
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("%s: %w", store.cfg.StateFile, err)
+	}
+
+	store.lock.Lock()
+	store.events = saved
+	for _, event := range saved {
+		if event.ID >= store.nextID {
+			store.nextID = event.ID + 1
+		}
+	}
+	store.prune(time.Now())
+	loaded := len(store.events)
+	store.lock.Unlock()
+	logger.Info(fmt.Sprintf("Loaded %d annotations from %s", loaded, store.cfg.StateFile))
+	return nil
+}
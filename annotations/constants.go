@@ -0,0 +1,12 @@
+package annotations
+
+// recorded annotations, labelled by source ("push", "maintenance" or "breaker")
+const ANNOTATIONS_METRIC = "collector_annotations_total"
+
+// sources of annotations
+const SOURCE_PUSH = "push"
+const SOURCE_MAINTENANCE = "maintenance"
+const SOURCE_BREAKER = "breaker"
+
+// annotations returned by Query without a limit, as in Grafana's HTTP API
+const DEFAULT_QUERY_LIMIT = 100
@@ -0,0 +1,32 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// JSON body of error responses, e.g.
+// {"error":"missing metric name","field":"name","code":"missing_field","requestId":"4f2a..."}
+type Error struct {
+	Message string `json:"error"`
+	// payload field the error refers to, e.g. "name" or "labels.project"
+	Field string `json:"field,omitempty"`
+	// one of the CODE_* constants
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// writes the error as JSON with the given status
+func Write(w http.ResponseWriter, r *http.Request, status int, code, field, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Error{
+		Message:   message,
+		Field:     field,
+		Code:      code,
+		RequestID: logger.RequestID(r.Context()),
+	})
+}
@@ -0,0 +1,20 @@
+package apierror
+
+// stable error codes of the push APIs, clients should match on these rather than on messages
+const CODE_INVALID_PAYLOAD = "invalid_payload"
+const CODE_PAYLOAD_TOO_LARGE = "payload_too_large"
+const CODE_TIMEOUT = "timeout"
+const CODE_MISSING_FIELD = "missing_field"
+const CODE_INVALID_FIELD = "invalid_field"
+const CODE_UNAUTHORIZED = "unauthorized"
+const CODE_INVALID_SIGNATURE = "invalid_signature"
+const CODE_FORBIDDEN = "forbidden"
+const CODE_METRIC_NOT_ALLOWED = "metric_not_allowed"
+const CODE_LABEL_NOT_ALLOWED = "label_not_allowed"
+const CODE_UNKNOWN_SOURCE = "unknown_source"
+const CODE_METRIC_CONFLICT = "metric_conflict"
+const CODE_QUOTA_EXCEEDED = "quota_exceeded"
+const CODE_OVERLOADED = "overloaded"
+const CODE_NOT_FOUND = "not_found"
+const CODE_METHOD_NOT_ALLOWED = "method_not_allowed"
+const CODE_INTERNAL = "internal"
@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// one audited operation, written as a JSON line
+type Entry struct {
+	Time time.Time `json:"time"`
+	// who did it, e.g. "ip:10.0.0.5" or a token / subject name once authenticated
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	Target string `json:"target,omitempty"`
+	// state before and after the operation, nil if not applicable
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+	// "ok", or why the operation did not change anything
+	Result string `json:"result"`
+}
+
+// Log appends entries to a file that is only ever opened for appending,
+// each entry is synced to disk before the operation is answered
+type Log struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: file}, nil
+}
+
+// writes the entry, nil-safe so callers don't need to check whether auditing is enabled
+func (log *Log) Record(entry Entry) {
+	if log == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode audit entry %s: %v", entry.Action, err))
+		return
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	if _, err := log.file.Write(append(line, '\n')); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write audit entry %s: %v", entry.Action, err))
+		return
+	}
+	if err := log.file.Sync(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to sync audit log: %v", err))
+	}
+}
+
+func (log *Log) Close() error {
+	if log == nil {
+		return nil
+	}
+	return log.file.Close()
+}
+
+type actorKey struct{}
+
+// attaches the authenticated identity of a request, used as audit actor
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// authenticated identity of the request, or its client address if it was not authenticated
+func Actor(r *http.Request) string {
+	if actor, ok := r.Context().Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+type entryKey struct{}
+
+// Middleware records one entry per admin API call, read-only ones included, after the
+// handler answered: action "<method> <path>" and the response status as result unless the
+// handler describes the call itself through EntryOf. Place it inside authentication, so
+// the entry names the authenticated actor; nil-safe
+func (log *Log) Middleware(handler http.HandlerFunc) http.HandlerFunc {
+	if log == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := &Entry{Action: r.Method + " " + r.URL.Path, Target: r.URL.RawQuery}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler(rec, r.WithContext(context.WithValue(r.Context(), entryKey{}, entry)))
+
+		entry.Actor = Actor(r)
+		if entry.Result == "" {
+			entry.Result = "ok"
+			if rec.status >= 400 {
+				entry.Result = fmt.Sprintf("status %d", rec.status)
+			}
+		}
+		log.Record(*entry)
+	}
+}
+
+// the entry Middleware records for the request, for handlers to name the action and add
+// target, before and after; a discarded entry if the request is not audited
+func EntryOf(r *http.Request) *Entry {
+	if entry, ok := r.Context().Value(entryKey{}).(*Entry); ok {
+		return entry
+	}
+	return &Entry{}
+}
+
+// remembers the response status for the entry
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
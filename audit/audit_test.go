@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMiddlewareRecordsEveryCall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	read := log.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	change := log.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		entry := EntryOf(r)
+		entry.Action, entry.After = "set_chaos", "on"
+	})
+	req := httptest.NewRequest(http.MethodGet, "/admin/agents?agent=esx01", nil)
+	read(httptest.NewRecorder(), req.WithContext(WithActor(req.Context(), "ops")))
+	change(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/admin/chaos", nil))
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var entries []Entry
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, expected 2", len(entries))
+	}
+	if e := entries[0]; e.Actor != "ops" || e.Action != "GET /admin/agents" || e.Target != "agent=esx01" || e.Result != "status 404" {
+		t.Fatalf("read recorded as %+v", e)
+	}
+	if e := entries[1]; e.Action != "set_chaos" || e.After != "on" || e.Result != "ok" {
+		t.Fatalf("change recorded as %+v", e)
+	}
+}
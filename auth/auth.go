@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/audit"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// returned by authenticators for credentials they don't recognise,
+// the next authenticator is tried
+var ErrUnknownCredentials = errors.New("unknown credentials")
+
+// an authenticated caller
+type Identity struct {
+	// used as audit actor and quota source
+	Name  string
+	Roles map[string]bool
+	// tenant mapped from a JWT claim, empty for static tokens
+	Tenant string
+	// metric name prefixes the identity may push, empty allows all
+	PushPrefixes []string
+	// label -> allowed value globs for the labels restricted by policy, pushes must carry
+	// these labels; nil leaves labels unrestricted
+	LabelValues map[string][]string
+	// labels added to pushes lacking them, nil for none
+	DefaultLabels map[string]string
+}
+
+func (id *Identity) Has(role string) bool {
+	return id.Roles[role]
+}
+
+// reports whether the metric may be pushed, nil-safe for unauthenticated setups
+func (id *Identity) CanPush(metric string) bool {
+	if id == nil || len(id.PushPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range id.PushPrefixes {
+		if strings.HasPrefix(metric, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns an error naming the first label whose value the identity may not push, or which
+// is missing although restricted, labels without a policy accept any value; nil-safe for
+// unauthenticated setups
+func (id *Identity) CheckLabels(labels map[string]string) error {
+	if id == nil {
+		return nil
+	}
+	for label, patterns := range id.LabelValues {
+		value, ok := labels[label]
+		if !ok {
+			// a push without the label would count towards every value of it
+			return &LabelError{Label: label, Missing: true}
+		}
+		allowed := false
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, value); matched {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &LabelError{Label: label, Value: value}
+		}
+	}
+	return nil
+}
+
+// returned by CheckLabels for label values outside the identity's policy
+type LabelError struct {
+	Label string
+	Value string
+	// the label is restricted by policy but was not pushed
+	Missing bool
+}
+
+func (err *LabelError) Error() string {
+	if err.Missing {
+		return fmt.Sprintf("label %s is required by policy", err.Label)
+	}
+	return fmt.Sprintf("not allowed to push %s=%q", err.Label, err.Value)
+}
+
+// verifies the credentials of a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Authorizer guards endpoints by role, trying authenticators in order
+type Authorizer struct {
+	authenticators []Authenticator
+}
+
+func NewAuthorizer(authenticators ...Authenticator) *Authorizer {
+	return &Authorizer{authenticators: authenticators}
+}
+
+// wraps handler so it only runs for callers having role; nil-safe, a nil
+// authorizer leaves endpoints open as before auth was configured
+func (authz *Authorizer) Require(role string, handler http.HandlerFunc) http.HandlerFunc {
+	if authz == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := authz.authenticate(r)
+		if err != nil {
+			logger.WarnCtx(r.Context(), fmt.Sprintf("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CODE_UNAUTHORIZED, "", "unauthorized")
+			return
+		}
+		if !id.Has(role) {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CODE_FORBIDDEN, "", fmt.Sprintf("%s role required", role))
+			return
+		}
+		ctx := audit.WithActor(context.WithValue(r.Context(), identityKey{}, id), id.Name)
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+func (authz *Authorizer) authenticate(r *http.Request) (*Identity, error) {
+	for _, authenticator := range authz.authenticators {
+		id, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrUnknownCredentials) {
+			continue
+		}
+		return id, err
+	}
+	return nil, ErrUnknownCredentials
+}
+
+type identityKey struct{}
+
+// identity attached by Require, nil if the endpoint is not protected
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// "Authorization: Bearer <token>", empty if missing
+func bearerToken(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
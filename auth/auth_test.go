@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckLabels(t *testing.T) {
+	id := &Identity{LabelValues: map[string][]string{"project": {"team-a", "shared-*"}}}
+	cases := []struct {
+		name    string
+		labels  map[string]string
+		allowed bool
+		missing bool
+	}{
+		{"allowed value", map[string]string{"project": "team-a"}, true, false},
+		{"allowed glob", map[string]string{"project": "shared-db", "host": "x"}, true, false},
+		{"other value", map[string]string{"project": "team-b"}, false, false},
+		{"missing label", map[string]string{"host": "x"}, false, true},
+		{"no labels", nil, false, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := id.CheckLabels(c.labels)
+			if (err == nil) != c.allowed {
+				t.Fatalf("CheckLabels returned %v, expected allowed=%v", err, c.allowed)
+			}
+			var labelErr *LabelError
+			if err != nil && (!errors.As(err, &labelErr) || labelErr.Label != "project" || labelErr.Missing != c.missing) {
+				t.Fatalf("CheckLabels returned %#v, expected a LabelError for project with missing=%v", err, c.missing)
+			}
+		})
+	}
+
+	var unauthenticated *Identity
+	if err := unauthenticated.CheckLabels(nil); err != nil {
+		t.Fatalf("nil identity rejected labels: %v", err)
+	}
+	if err := (&Identity{}).CheckLabels(nil); err != nil {
+		t.Fatalf("identity without policy rejected labels: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/audit"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// ClientCerts derives a source identity from verified mTLS client certificates
+type ClientCerts struct {
+	fingerprint bool
+}
+
+// nil unless client certificates are verified
+func NewClientCerts(cfg config.TLSConfig) *ClientCerts {
+	if cfg.ClientCAFile == "" {
+		return nil
+	}
+	return &ClientCerts{fingerprint: cfg.ClientIdentity == "fingerprint"}
+}
+
+// server TLS settings; client certificates are verified against ClientCAFile if set
+func ServerTLS(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// CN or fingerprint of the verified client certificate, empty without one
+func (certs *ClientCerts) identity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	if certs.fingerprint {
+		sum := sha256.Sum256(leaf.Raw)
+		return hex.EncodeToString(sum[:])
+	}
+	return leaf.Subject.CommonName
+}
+
+type clientCertKey struct{}
+
+// records the client certificate identity in the request context and uses it as audit actor;
+// tokens checked later take precedence. nil-safe, returns handler unchanged
+func (certs *ClientCerts) Wrap(handler http.HandlerFunc) http.HandlerFunc {
+	if certs == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id := certs.identity(r); id != "" {
+			ctx := audit.WithActor(context.WithValue(r.Context(), clientCertKey{}, id), "cert:"+id)
+			r = r.WithContext(ctx)
+		}
+		handler(w, r)
+	}
+}
+
+// client certificate identity recorded by ClientCerts.Wrap, empty if none
+func ClientCertFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(clientCertKey{}).(string)
+	return id
+}
@@ -0,0 +1,18 @@
+package auth
+
+import "time"
+
+// roles granted to tokens
+const ROLE_READER = "reader" // scrape /metrics
+const ROLE_PUSHER = "pusher" // /push and /event, optionally limited to metric prefixes
+const ROLE_ADMIN = "admin"   // admin API
+
+// tokens signed with unknown keys trigger a key set refresh at most this often,
+// so rotated keys are picked up without letting bogus tokens hammer the provider
+const JWKS_REFRESH_MIN_INTERVAL = time.Minute
+
+// configured tokens are expanded again this often, picking up secrets rotated at runtime
+const TOKEN_REFRESH_INTERVAL = time.Minute
+
+// default age limit of signed payloads with a timestamp
+const DEFAULT_SIGNATURE_MAX_AGE = 5 * time.Minute
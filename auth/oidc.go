@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// OIDC validates JWT bearer tokens issued by an OpenID Connect provider,
+// with signing keys found through the provider's discovery document
+type OIDC struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	lock      sync.Mutex
+	keys      map[string]crypto.PublicKey
+	jwksURL   string
+	fetchedAt time.Time
+	// closed when the running key set fetch completes, nil while none runs
+	fetching chan struct{}
+}
+
+type oidcDiscovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func NewOIDC(cfg config.OIDCConfig) *OIDC {
+	return &OIDC{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// validates signature, issuer, audience and lifetime, then maps claims to an identity
+func (oidc *OIDC) Authenticate(r *http.Request) (*Identity, error) {
+	token := bearerToken(r)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		// not a JWT, may be a static token
+		return nil, ErrUnknownCredentials
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	key, err := oidc.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding: %w", err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if err := oidc.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return oidc.identity(claims)
+}
+
+func (oidc *OIDC) checkClaims(claims map[string]any) error {
+	if issuer, _ := claims["iss"].(string); issuer != oidc.cfg.Issuer {
+		return fmt.Errorf("unexpected issuer %q", issuer)
+	}
+	if !hasAudience(claims["aud"], oidc.cfg.Audience) {
+		return fmt.Errorf("token not issued for audience %q", oidc.cfg.Audience)
+	}
+
+	now := time.Now()
+	leeway := oidc.cfg.ClockSkew.Duration
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token without expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not valid yet")
+	}
+	return nil
+}
+
+// maps name, role and tenant claims to an identity
+func (oidc *OIDC) identity(claims map[string]any) (*Identity, error) {
+	nameClaim := oidc.cfg.NameClaim
+	if nameClaim == "" {
+		nameClaim = "sub"
+	}
+	name, _ := claims[nameClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("token without %s claim", nameClaim)
+	}
+
+	id := &Identity{Name: name, Roles: make(map[string]bool)}
+	for _, value := range claimValues(claims[oidc.cfg.RolesClaim]) {
+		if len(oidc.cfg.RoleMapping) == 0 {
+			id.Roles[value] = true
+			continue
+		}
+		for _, role := range oidc.cfg.RoleMapping[value] {
+			id.Roles[role] = true
+		}
+	}
+
+	if oidc.cfg.TenantClaim != "" {
+		tenant, _ := claims[oidc.cfg.TenantClaim].(string)
+		prefixes, ok := oidc.cfg.Tenants[tenant]
+		if !ok {
+			return nil, fmt.Errorf("unknown tenant %q", tenant)
+		}
+		id.Tenant = tenant
+		id.PushPrefixes = prefixes
+	}
+
+	// a missing claim allows no value, so the label can't be pushed at all
+	if len(oidc.cfg.LabelClaims) > 0 {
+		id.LabelValues = make(map[string][]string, len(oidc.cfg.LabelClaims))
+		for label, claim := range oidc.cfg.LabelClaims {
+			id.LabelValues[label] = claimValues(claims[claim])
+		}
+	}
+	return id, nil
+}
+
+// returns the signing key, refreshing the key set for unknown key ids at most once per JWKS_REFRESH_MIN_INTERVAL;
+// the key set is fetched without holding the lock, so tokens with known keys are validated meanwhile,
+// and tokens with unknown keys wait for the running fetch instead of starting another
+func (oidc *OIDC) key(kid string) (crypto.PublicKey, error) {
+	oidc.lock.Lock()
+	if key, ok := oidc.keys[kid]; ok {
+		oidc.lock.Unlock()
+		return key, nil
+	}
+	if done := oidc.fetching; done != nil {
+		oidc.lock.Unlock()
+		<-done
+		return oidc.knownKey(kid)
+	}
+	if time.Since(oidc.fetchedAt) < JWKS_REFRESH_MIN_INTERVAL {
+		oidc.lock.Unlock()
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	oidc.fetchedAt = time.Now()
+	done := make(chan struct{})
+	oidc.fetching = done
+	jwksURL := oidc.jwksURL
+	oidc.lock.Unlock()
+
+	keys, jwksURL, err := oidc.fetchKeys(jwksURL)
+	oidc.lock.Lock()
+	if err == nil {
+		oidc.keys, oidc.jwksURL = keys, jwksURL
+	}
+	oidc.fetching = nil
+	oidc.lock.Unlock()
+	close(done)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	return oidc.knownKey(kid)
+}
+
+func (oidc *OIDC) knownKey(kid string) (crypto.PublicKey, error) {
+	oidc.lock.Lock()
+	defer oidc.lock.Unlock()
+	if key, ok := oidc.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// reads the key set, and the discovery document for its URL if jwksURL is empty
+func (oidc *OIDC) fetchKeys(jwksURL string) (map[string]crypto.PublicKey, string, error) {
+	if jwksURL == "" {
+		var discovery oidcDiscovery
+		if err := oidc.getJSON(strings.TrimSuffix(oidc.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, "", err
+		}
+		if discovery.Issuer != oidc.cfg.Issuer {
+			return nil, "", fmt.Errorf("discovery document is for issuer %q", discovery.Issuer)
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := oidc.getJSON(jwksURL, &jwks); err != nil {
+		return nil, "", err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// keys of unsupported types don't prevent using the others
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, jwksURL, nil
+}
+
+func (oidc *OIDC) getJSON(url string, v any) error {
+	resp, err := oidc.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
+
+// supports RS256 and ES256, the algorithms issued by common providers
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 token signed with non-RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errors.New("invalid ES256 token signature")
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported token algorithm %q", alg)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// "aud" may be a single string or a list
+func hasAudience(aud any, expected string) bool {
+	for _, value := range claimValues(aud) {
+		if value == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// values of a string or string list claim
+func claimValues(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
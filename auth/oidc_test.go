@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+func TestKeySetFetchBlocksOnlyUnknownKeys(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/openid-configuration" {
+			fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q}`, server.URL, server.URL+"/keys")
+			return
+		}
+		fetches.Add(1)
+		<-release
+		fmt.Fprintf(w, `{"keys":[{"kid":"new","kty":"EC","crv":"P-256","x":%q,"y":%q}]}`,
+			encode(private.PublicKey.X.Bytes()), encode(private.PublicKey.Y.Bytes()))
+	}))
+	defer server.Close()
+
+	oidc := NewOIDC(config.OIDCConfig{Issuer: server.URL})
+	oidc.keys["known"] = &private.PublicKey
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := oidc.key("new"); err != nil {
+				t.Errorf("rotated key returned %v", err)
+			}
+		}()
+	}
+	for fetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// the fetch in progress doesn't hold up tokens signed with known keys
+	if _, err := oidc.key("known"); err != nil {
+		t.Fatalf("known key returned %v during a fetch", err)
+	}
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("key set fetched %d times, expected once", n)
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+)
+
+var hashes = map[string]func() hash.Hash{
+	"":       sha256.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"sha1":   sha1.New,
+}
+
+// returned by Verify for missing, malformed or wrong signatures
+var ErrBadSignature = errors.New("bad signature")
+
+// Verifier checks the HMAC signature header of polled responses or pushed payloads
+type Verifier struct {
+	cfg     config.SignatureConfig
+	secret  []byte
+	newHash func() hash.Hash
+}
+
+// expands the secret placeholder, nil config returns a nil verifier accepting everything
+func NewVerifier(cfg *config.SignatureConfig, resolver *secrets.Resolver) (*Verifier, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	newHash, ok := hashes[cfg.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown signature algorithm %q", cfg.Algorithm)
+	}
+	secret, err := resolver.Expand(cfg.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("signature secret: %w", err)
+	}
+	verifier := &Verifier{cfg: *cfg, secret: []byte(secret), newHash: newHash}
+	if verifier.cfg.MaxAge.Duration <= 0 {
+		verifier.cfg.MaxAge.Duration = DEFAULT_SIGNATURE_MAX_AGE
+	}
+	return verifier, nil
+}
+
+// returns an error wrapping ErrBadSignature unless the headers carry a valid signature of body;
+// nil-safe, a nil verifier accepts all payloads
+func (verifier *Verifier) Verify(header http.Header, body []byte) error {
+	if verifier == nil {
+		return nil
+	}
+	value := strings.TrimSpace(header.Get(verifier.cfg.Header))
+	if value == "" {
+		return fmt.Errorf("%w: missing %s header", ErrBadSignature, verifier.cfg.Header)
+	}
+	value = strings.TrimPrefix(value, verifier.cfg.Prefix)
+	var signature []byte
+	var err error
+	if verifier.cfg.Encoding == "base64" {
+		signature, err = base64.StdEncoding.DecodeString(value)
+	} else {
+		signature, err = hex.DecodeString(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: malformed %s header", ErrBadSignature, verifier.cfg.Header)
+	}
+
+	mac := hmac.New(verifier.newHash, verifier.secret)
+	if verifier.cfg.TimestampHeader != "" {
+		timestamp := header.Get(verifier.cfg.TimestampHeader)
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: missing or malformed %s header", ErrBadSignature, verifier.cfg.TimestampHeader)
+		}
+		if age := time.Since(time.Unix(seconds, 0)); age > verifier.cfg.MaxAge.Duration || age < -verifier.cfg.MaxAge.Duration {
+			return fmt.Errorf("%w: signed %v ago, at most %v allowed", ErrBadSignature, age.Round(time.Second), verifier.cfg.MaxAge.Duration)
+		}
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return fmt.Errorf("%w: signature does not match", ErrBadSignature)
+	}
+	return nil
+}
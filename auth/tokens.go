@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+)
+
+type staticToken struct {
+	template string
+	token    []byte
+	identity *Identity
+}
+
+// StaticTokens authenticates bearer tokens listed in the config
+type StaticTokens struct {
+	resolver *secrets.Resolver
+
+	lock   sync.RWMutex
+	tokens []staticToken
+}
+
+// expands secret placeholders of the configured tokens
+func NewStaticTokens(configs []config.TokenConfig, resolver *secrets.Resolver) (*StaticTokens, error) {
+	static := &StaticTokens{resolver: resolver}
+	for _, tc := range configs {
+		token, err := resolver.Expand(tc.Token)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %w", tc.Name, err)
+		}
+		for label, patterns := range tc.LabelValues {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("token %s: invalid pattern %q for label %s: %w", tc.Name, pattern, label, err)
+				}
+			}
+		}
+		roles := make(map[string]bool, len(tc.Roles))
+		for _, role := range tc.Roles {
+			roles[role] = true
+		}
+		static.tokens = append(static.tokens, staticToken{
+			template: tc.Token,
+			token:    []byte(token),
+			identity: &Identity{Name: tc.Name, Roles: roles, PushPrefixes: tc.PushPrefixes, LabelValues: tc.LabelValues, DefaultLabels: tc.DefaultLabels},
+		})
+	}
+	return static, nil
+}
+
+// expands the tokens again every interval in the background, so tokens rotated in Vault
+// or in mounted secret files are accepted without a restart
+func (static *StaticTokens) StartRefresh(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			static.refresh()
+		}
+	}()
+}
+
+// a token failing to expand keeps its previous value; secrets are resolved without
+// holding the lock, only refresh replaces the tokens
+func (static *StaticTokens) refresh() {
+	static.lock.RLock()
+	tokens := slices.Clone(static.tokens)
+	static.lock.RUnlock()
+
+	changed := false
+	for i := range tokens {
+		token, err := static.resolver.Expand(tokens[i].template)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Keeping previous value of token %s: %v", tokens[i].identity.Name, err))
+			continue
+		}
+		if token != string(tokens[i].token) {
+			tokens[i].token = []byte(token)
+			changed = true
+		}
+	}
+	if changed {
+		static.lock.Lock()
+		static.tokens = tokens
+		static.lock.Unlock()
+	}
+}
+
+func (static *StaticTokens) Authenticate(r *http.Request) (*Identity, error) {
+	token := []byte(bearerToken(r))
+	if len(token) == 0 {
+		return nil, ErrUnknownCredentials
+	}
+	// all tokens are compared in constant time, so timing doesn't reveal which one matched
+	static.lock.RLock()
+	tokens := static.tokens
+	static.lock.RUnlock()
+	var match *Identity
+	for _, candidate := range tokens {
+		if subtle.ConstantTimeCompare(token, candidate.token) == 1 {
+			match = candidate.identity
+		}
+	}
+	if match == nil {
+		return nil, ErrUnknownCredentials
+	}
+	return match, nil
+}
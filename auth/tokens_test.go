@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+)
+
+type rotatingSecret struct {
+	value string
+	err   error
+}
+
+func (secret *rotatingSecret) Get(key string) (string, error) {
+	return secret.value, secret.err
+}
+
+func authenticate(tokens *StaticTokens, token string) (*Identity, error) {
+	r := httptest.NewRequest("POST", "/push", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return tokens.Authenticate(r)
+}
+
+func TestRefreshPicksUpRotatedTokens(t *testing.T) {
+	secret := &rotatingSecret{value: "old"}
+	resolver := secrets.NewResolver()
+	resolver.Register("test", secret)
+	tokens, err := NewStaticTokens([]config.TokenConfig{{Name: "team-a", Token: "${test:team-a}", Roles: []string{ROLE_PUSHER}}}, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := authenticate(tokens, "old"); err != nil || id.Name != "team-a" {
+		t.Fatalf("initial token returned %v, %v", id, err)
+	}
+
+	secret.value = "new"
+	tokens.refresh()
+	if _, err := authenticate(tokens, "old"); !errors.Is(err, ErrUnknownCredentials) {
+		t.Fatalf("rotated out token returned %v", err)
+	}
+	if _, err := authenticate(tokens, "new"); err != nil {
+		t.Fatalf("rotated in token returned %v", err)
+	}
+
+	// an unreachable secret store keeps the token working
+	secret.err = errors.New("unreachable")
+	tokens.refresh()
+	if _, err := authenticate(tokens, "new"); err != nil {
+		t.Fatalf("token failing to refresh returned %v", err)
+	}
+}
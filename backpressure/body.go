@@ -0,0 +1,29 @@
+package backpressure
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// bounds the request body size and the time to receive it, so a single oversized
+// or trickling push cannot hold a handler; reads beyond the limits fail with
+// *http.MaxBytesError or os.ErrDeadlineExceeded, which handlers answer with 413 and 408
+func LimitRequest(limits config.EndpointLimitConfig, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if limits.MaxBodyBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBodyBytes)
+		}
+		if limits.DecodeTimeout.Duration > 0 {
+			deadline := time.Now().Add(limits.DecodeTimeout.Duration)
+			// best effort, not all writers support deadlines; the server resets it for the next request
+			_ = http.NewResponseController(w).SetReadDeadline(deadline)
+			ctx, cancel := context.WithDeadline(r.Context(), deadline)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,15 @@
+package backpressure
+
+// pushes being processed, sampled every PUBLISH_INTERVAL
+const INFLIGHT_METRIC = "collector_push_inflight"
+
+// in-flight pushes relative to the limit, 1 means new pushes are rejected
+const SATURATION_METRIC = "collector_push_saturation_ratio"
+
+// 1 while pushes are rejected because of memory pressure
+const MEMORY_PRESSURE_METRIC = "collector_push_memory_pressure"
+
+// pushes answered with 503, labelled by reason ("inflight" or "memory")
+const THROTTLED_METRIC = "collector_push_throttled_total"
+
+const PUBLISH_INTERVAL_SEC = 1
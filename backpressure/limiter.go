@@ -0,0 +1,96 @@
+package backpressure
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// Limiter answers pushes with 503 and Retry-After while too many pushes are in flight
+// or the process is under memory pressure, so well-behaved clients back off
+// instead of timing out against a collector that is stuck behind its sink
+type Limiter struct {
+	maxInFlight int64
+	retryAfter  string
+
+	// optional, reports memory pressure, e.g. MemoryGuard.OverLimit
+	Pressure func() bool
+
+	inFlight atomic.Int64
+	// rejected pushes by reason, "inflight" or "memory"
+	throttled *metrics.SampledCounter
+
+	// receives the saturation metrics
+	sink metrics.MetricSink
+}
+
+func NewLimiter(cfg config.BackpressureConfig, sink metrics.MetricSink) *Limiter {
+	return &Limiter{
+		maxInFlight: int64(cfg.MaxInFlight),
+		retryAfter:  retryAfterSeconds(cfg.RetryAfter.Duration),
+		throttled:   metrics.NewSampledCounter(sink, THROTTLED_METRIC, "reason", "inflight", "memory"),
+		sink:        sink,
+	}
+}
+
+// wraps a push handler, nil-safe so routes can be wrapped unconditionally
+func (limiter *Limiter) Wrap(handler http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if limiter.Pressure != nil && limiter.Pressure() {
+			limiter.throttled.Inc("memory")
+			limiter.reject(w, r, "collector is under memory pressure")
+			return
+		}
+		inFlight := limiter.inFlight.Add(1)
+		defer limiter.inFlight.Add(-1)
+		if limiter.maxInFlight > 0 && inFlight > limiter.maxInFlight {
+			limiter.throttled.Inc("inflight")
+			limiter.reject(w, r, fmt.Sprintf("too many pushes in flight (limit %d)", limiter.maxInFlight))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Retry-After takes whole seconds: sub-second waits round up, so clients never retry at once
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
+
+func (limiter *Limiter) reject(w http.ResponseWriter, r *http.Request, reason string) {
+	w.Header().Set("Retry-After", limiter.retryAfter)
+	apierror.Write(w, r, http.StatusServiceUnavailable, apierror.CODE_OVERLOADED, "", reason)
+}
+
+// publishes saturation metrics every PUBLISH_INTERVAL_SEC, sampling instead of
+// updating them per push keeps the sink out of the hot path
+func (limiter *Limiter) Start() {
+	metrics.PublishEvery(PUBLISH_INTERVAL_SEC*time.Second, limiter.publish)
+}
+
+func (limiter *Limiter) publish() {
+	noLabels := map[string]string{}
+	inFlight := float64(limiter.inFlight.Load())
+	limiter.sink.SetGauge(INFLIGHT_METRIC, noLabels, inFlight)
+	if limiter.maxInFlight > 0 {
+		limiter.sink.SetGauge(SATURATION_METRIC, noLabels, inFlight/float64(limiter.maxInFlight))
+	}
+	if limiter.Pressure != nil {
+		pressure := 0.0
+		if limiter.Pressure() {
+			pressure = 1
+		}
+		limiter.sink.SetGauge(MEMORY_PRESSURE_METRIC, noLabels, pressure)
+	}
+	limiter.throttled.Publish()
+}
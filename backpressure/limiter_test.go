@@ -0,0 +1,21 @@
+package backpressure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryAfterRoundsUp(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                       "1",
+		200 * time.Millisecond:  "1",
+		time.Second:             "1",
+		1500 * time.Millisecond: "2",
+		30 * time.Second:        "30",
+	}
+	for wait, expected := range cases {
+		if header := retryAfterSeconds(wait); header != expected {
+			t.Errorf("wait %v sent as Retry-After %s, expected %s", wait, header, expected)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package blackbox probes the availability of HTTP endpoints, timing each phase of a
+// request the way the Prometheus blackbox exporter does
+package blackbox
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// Prober runs requests on fresh connections, so connect and TLS times are measured every time
+type Prober struct {
+	cfg     config.BlackboxConfig
+	client  *http.Client
+	secrets *secrets.Resolver
+}
+
+func NewProber(cfg config.BlackboxConfig, resolver *secrets.Resolver) *Prober {
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+	if cfg.Timeout.Duration <= 0 {
+		cfg.Timeout.Duration = DEFAULT_TIMEOUT_SEC * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	return &Prober{cfg: cfg, client: &http.Client{Transport: transport}, secrets: resolver}
+}
+
+// start and end of each phase of a request, end of the last redirect's
+type phases struct {
+	lock                      sync.Mutex
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wrote, firstByte          time.Time
+}
+
+func (p *phases) trace() *httptrace.ClientTrace {
+	set := func(field *time.Time) {
+		p.lock.Lock()
+		*field = time.Now()
+		p.lock.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&p.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&p.dnsDone) },
+		ConnectStart:         func(string, string) { set(&p.connectStart) },
+		ConnectDone:          func(string, string, error) { set(&p.connectDone) },
+		TLSHandshakeStart:    func() { set(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&p.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&p.wrote) },
+		GotFirstResponseByte: func() { set(&p.firstByte) },
+	}
+}
+
+// probes url and records probe_success, probe_duration_seconds, the status and phase
+// durations into sink with labels; the error tells why the probe failed
+func (prober *Prober) Probe(ctx context.Context, url string, sink metrics.MetricSink, labels map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, prober.cfg.Timeout.Duration)
+	defer cancel()
+	start := time.Now()
+	status, timing, state, err := prober.request(ctx, url)
+	end := time.Now()
+
+	success := 0.0
+	if err == nil {
+		if err = prober.checkStatus(status); err == nil {
+			success = 1
+		}
+	}
+	sink.SetGauge(PROBE_SUCCESS_METRIC, labels, success)
+	sink.SetGauge(PROBE_DURATION_METRIC, labels, end.Sub(start).Seconds())
+	sink.SetGauge(PROBE_HTTP_STATUS_METRIC, labels, float64(status))
+	sslValue := 0.0
+	if state != nil {
+		sslValue = 1
+	}
+	sink.SetGauge(PROBE_HTTP_SSL_METRIC, labels, sslValue)
+	if expiry, ok := util.EarliestCertExpiry(state); ok {
+		sink.SetGauge(PROBE_SSL_EXPIRY_METRIC, labels, float64(expiry.Unix()))
+	}
+
+	timing.lock.Lock()
+	defer timing.lock.Unlock()
+	for phase, span := range map[string][2]time.Time{
+		"resolve":    {timing.dnsStart, timing.dnsDone},
+		"connect":    {timing.connectStart, timing.connectDone},
+		"tls":        {timing.tlsStart, timing.tlsDone},
+		"processing": {timing.wrote, timing.firstByte},
+		"transfer":   {timing.firstByte, end},
+	} {
+		duration := 0.0
+		if !span[0].IsZero() && !span[1].IsZero() {
+			duration = span[1].Sub(span[0]).Seconds()
+		}
+		phaseLabels := maps.Clone(labels)
+		if phaseLabels == nil {
+			phaseLabels = make(map[string]string, 1)
+		}
+		phaseLabels["phase"] = phase
+		sink.SetGauge(PROBE_HTTP_PHASE_METRIC, phaseLabels, duration)
+	}
+	return err
+}
+
+// sends the request and reads the body, returns the status (0 without response) and
+// the TLS state, nil for plain HTTP
+func (prober *Prober) request(ctx context.Context, url string) (int, *phases, *tls.ConnectionState, error) {
+	timing := &phases{}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, timing.trace()), prober.cfg.Method, url, nil)
+	if err != nil {
+		return 0, timing, nil, err
+	}
+	for name, value := range prober.cfg.Headers {
+		expanded, err := prober.secrets.Expand(value)
+		if err != nil {
+			return 0, timing, nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		req.Header.Set(name, expanded)
+	}
+	resp, err := prober.client.Do(req)
+	if err != nil {
+		return 0, timing, nil, err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, timing, resp.TLS, err
+}
+
+func (prober *Prober) checkStatus(status int) error {
+	if len(prober.cfg.ValidStatus) == 0 {
+		if status >= 200 && status < 300 {
+			return nil
+		}
+	} else if slices.Contains(prober.cfg.ValidStatus, status) {
+		return nil
+	}
+	return fmt.Errorf("unexpected status %d", status)
+}
+
+// Monitor probes the configured targets every interval, logging when they go down and come back
+type Monitor struct {
+	targets []*target
+	hub     metrics.MetricSink
+}
+
+type target struct {
+	cfg    config.BlackboxTargetConfig
+	prober *Prober
+	labels map[string]string
+	down   bool
+}
+
+func NewMonitor(targets []config.BlackboxTargetConfig, hub metrics.MetricSink, resolver *secrets.Resolver) *Monitor {
+	monitor := &Monitor{hub: hub}
+	for _, tc := range targets {
+		if tc.Name == "" {
+			tc.Name = tc.URL
+		}
+		labels := maps.Clone(tc.Labels)
+		if labels == nil {
+			labels = make(map[string]string, 1)
+		}
+		labels["target"] = tc.Name
+		monitor.targets = append(monitor.targets, &target{cfg: tc, prober: NewProber(tc.BlackboxConfig, resolver), labels: labels})
+	}
+	return monitor
+}
+
+// probes each target right away and then every interval
+func (monitor *Monitor) Start() {
+	for _, t := range monitor.targets {
+		go func() {
+			ticker := time.NewTicker(t.cfg.Interval.Duration)
+			defer ticker.Stop()
+			for {
+				monitor.probe(t)
+				<-ticker.C
+			}
+		}()
+	}
+	logger.Info(fmt.Sprintf("Probing the availability of %d endpoints", len(monitor.targets)))
+}
+
+func (monitor *Monitor) probe(t *target) {
+	err := t.prober.Probe(context.Background(), t.cfg.URL, monitor.hub, t.labels)
+	switch {
+	case err != nil && !t.down:
+		logger.Warn(fmt.Sprintf("Endpoint %s is unavailable: %v", t.cfg.Name, err))
+		t.down = true
+	case err == nil && t.down:
+		logger.Info(fmt.Sprintf("Endpoint %s is available again", t.cfg.Name))
+		t.down = false
+	}
+}
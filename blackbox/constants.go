@@ -0,0 +1,12 @@
+package blackbox
+
+const DEFAULT_TIMEOUT_SEC = 10
+
+// metrics of a probe, named like the Prometheus blackbox exporter's so existing
+// dashboards and alerts apply
+const PROBE_SUCCESS_METRIC = "probe_success"
+const PROBE_DURATION_METRIC = "probe_duration_seconds"
+const PROBE_HTTP_STATUS_METRIC = "probe_http_status_code"
+const PROBE_HTTP_PHASE_METRIC = "probe_http_duration_seconds"
+const PROBE_HTTP_SSL_METRIC = "probe_http_ssl"
+const PROBE_SSL_EXPIRY_METRIC = "probe_ssl_earliest_cert_expiry"
@@ -0,0 +1,209 @@
+// Package chaos injects failures into a collector started with -chaos: failing polls, slow
+// sinks and failing checkpoint saves, to verify alerting and HA behavior of deployments;
+// injection is changed at runtime via /admin/chaos and off until then
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// returned, wrapped, by everything failing on purpose
+var ErrInjected = errors.New("injected failure")
+
+// what is injected, the zero value injects nothing
+// PUT JSON: {"pollFailureRate":0.5,"pollers":["vc01-*"],"sinkDelay":"200ms","checkpointFailureRate":1,"duration":"10m"}
+type Settings struct {
+	// share of polls failing, from 0 to 1
+	PollFailureRate float64 `json:"pollFailureRate"`
+	// globs of the pollers failing, all if empty
+	Pollers []string `json:"pollers,omitempty"`
+	// added to every metric update before it reaches the sinks
+	SinkDelay config.Duration `json:"sinkDelay"`
+	// share of checkpoint saves failing, from 0 to 1
+	CheckpointFailureRate float64 `json:"checkpointFailureRate"`
+	// injection stops after this time, 0 keeps it until changed
+	Duration config.Duration `json:"duration"`
+	// when injection stops, set from Duration
+	Until *time.Time `json:"until,omitempty"`
+}
+
+func (settings *Settings) Validate() error {
+	if settings.PollFailureRate < 0 || settings.PollFailureRate > 1 {
+		return errors.New("pollFailureRate must be between 0 and 1")
+	}
+	if settings.CheckpointFailureRate < 0 || settings.CheckpointFailureRate > 1 {
+		return errors.New("checkpointFailureRate must be between 0 and 1")
+	}
+	for _, pattern := range settings.Pollers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid poller pattern %q: %w", pattern, err)
+		}
+	}
+	if settings.SinkDelay.Duration < 0 || settings.SinkDelay.Duration > MAX_SINK_DELAY_SEC*time.Second {
+		return fmt.Errorf("sinkDelay must be between 0 and %ds", MAX_SINK_DELAY_SEC)
+	}
+	if settings.Duration.Duration < 0 {
+		return errors.New("duration must not be negative")
+	}
+	return nil
+}
+
+// Injector decides which operations fail; all methods are nil-safe, a nil Injector injects nothing
+type Injector struct {
+	lock     sync.Mutex
+	settings Settings
+	sink     metrics.MetricSink
+}
+
+func NewInjector(sink metrics.MetricSink) *Injector {
+	return &Injector{sink: sink}
+}
+
+// replaces the settings, returns the previous ones
+func (injector *Injector) Set(settings Settings) (Settings, error) {
+	if err := settings.Validate(); err != nil {
+		return Settings{}, err
+	}
+	settings.Until = nil
+	if settings.Duration.Duration > 0 {
+		until := time.Now().Add(settings.Duration.Duration)
+		settings.Until = &until
+	}
+	before := injector.Settings()
+	injector.lock.Lock()
+	injector.settings = settings
+	injector.lock.Unlock()
+	return before, nil
+}
+
+// the current settings, zero after Until
+func (injector *Injector) Settings() Settings {
+	if injector == nil {
+		return Settings{}
+	}
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	if injector.settings.Until != nil && time.Now().After(*injector.settings.Until) {
+		logger.Warn("Failure injection ended")
+		injector.settings = Settings{}
+	}
+	return injector.settings
+}
+
+// an error for a poll of poller that should fail, nil otherwise
+func (injector *Injector) PollError(poller string) error {
+	settings := injector.Settings()
+	if settings.PollFailureRate == 0 || !matchesAny(settings.Pollers, poller) {
+		return nil
+	}
+	if rand.Float64() >= settings.PollFailureRate {
+		return nil
+	}
+	injector.sink.IncCounter(CHAOS_INJECTED_METRIC, map[string]string{"kind": "poll"})
+	return fmt.Errorf("%w: poll of %s", ErrInjected, poller)
+}
+
+// an error for a checkpoint save that should fail, nil otherwise
+func (injector *Injector) CheckpointError() error {
+	settings := injector.Settings()
+	if settings.CheckpointFailureRate == 0 || rand.Float64() >= settings.CheckpointFailureRate {
+		return nil
+	}
+	injector.sink.IncCounter(CHAOS_INJECTED_METRIC, map[string]string{"kind": "checkpoint"})
+	return fmt.Errorf("%w: checkpoint save", ErrInjected)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// delays updates by SinkDelay before passing them on, as if all sinks were slow
+func (injector *Injector) Interceptor() metrics.Interceptor {
+	return func(next metrics.MetricSink) metrics.MetricSink {
+		return &slowSink{injector: injector, next: next}
+	}
+}
+
+type slowSink struct {
+	injector *Injector
+	next     metrics.MetricSink
+}
+
+func (sink *slowSink) wait() {
+	if delay := sink.injector.Settings().SinkDelay.Duration; delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+func (sink *slowSink) CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error {
+	if checker, ok := sink.next.(metrics.SeriesChecker); ok {
+		return checker.CheckSeries(ctx, name, kind, labels)
+	}
+	return nil
+}
+
+func (sink *slowSink) WithContext(ctx context.Context) metrics.MetricSink {
+	next := sink.next
+	if contextSink, ok := next.(metrics.ContextSink); ok {
+		next = contextSink.WithContext(ctx)
+	}
+	return &slowSink{injector: sink.injector, next: next}
+}
+
+// deletes are not delayed
+func (sink *slowSink) DeleteSeries(name string, labels map[string]string) bool {
+	if deleter, ok := sink.next.(metrics.SeriesDeleter); ok {
+		return deleter.DeleteSeries(name, labels)
+	}
+	return false
+}
+
+func (sink *slowSink) DeleteMetric(name string) bool {
+	if deleter, ok := sink.next.(metrics.SeriesDeleter); ok {
+		return deleter.DeleteMetric(name)
+	}
+	return false
+}
+
+func (sink *slowSink) IncCounter(name string, labels map[string]string) {
+	sink.wait()
+	sink.next.IncCounter(name, labels)
+}
+
+func (sink *slowSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.wait()
+	sink.next.AddCounter(name, labels, delta)
+}
+
+func (sink *slowSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.wait()
+	sink.next.SetGauge(name, labels, value)
+}
+
+func (sink *slowSink) Observe(name string, labels map[string]string, value float64) {
+	sink.wait()
+	sink.next.Observe(name, labels, value)
+}
+
+func (sink *slowSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.wait()
+	sink.next.ObserveSummary(name, labels, value)
+}
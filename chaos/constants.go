@@ -0,0 +1,7 @@
+package chaos
+
+// failures injected on purpose, labelled by kind ("poll" or "checkpoint")
+const CHAOS_INJECTED_METRIC = "collector_chaos_injected_total"
+
+// longest sinkDelay, longer delays would stall pushes beyond any client timeout
+const MAX_SINK_DELAY_SEC = 30
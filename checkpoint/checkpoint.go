@@ -7,4 +7,7 @@ type Checkpoint interface {
 	Save() error
 	Load() error
 	StartPeriodic(interval time.Duration)
+	// histograms are read from source with every Save
+	SetHistogramSource(source HistogramSource)
+	GetHistogramValues() map[string]map[string]HistogramState
 }
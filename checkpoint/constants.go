@@ -0,0 +1,13 @@
+package checkpoint
+
+// suffix of the write-ahead log of durable metrics next to the checkpoint file
+const WAL_SUFFIX = ".wal"
+
+// longest write-ahead log record, label keys of real series are far shorter
+const MAX_WAL_LINE_BYTES = 1024 * 1024
+
+// float64 holds every integer up to 2^53, counters beyond it round whole increments
+const MAX_EXACT_COUNTER = 1 << 53
+
+// suffix of the file a save writes before renaming it over the checkpoint
+const TMP_SUFFIX = ".tmp"
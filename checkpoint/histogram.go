@@ -0,0 +1,80 @@
+package checkpoint
+
+import (
+	"path"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// classic histogram bucket with the cumulative count of observations <= UpperBound,
+// the +Inf bucket is not stored, its count is the histogram count
+type HistogramBucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// cumulative state of one histogram series; classic and native buckets may both be set
+type HistogramState struct {
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+	Buckets []HistogramBucket `json:"buckets,omitempty"`
+
+	// native buckets, nil schema for classic-only histograms;
+	// bucket index -> (non-cumulative) count of observations in it
+	Schema        *int32         `json:"schema,omitempty"`
+	ZeroThreshold float64        `json:"zeroThreshold,omitempty"`
+	ZeroCount     uint64         `json:"zeroCount,omitempty"`
+	Positive      map[int]uint64 `json:"positive,omitempty"`
+	Negative      map[int]uint64 `json:"negative,omitempty"`
+}
+
+// returns the state of all histogram series, metric name -> labelsKey -> state;
+// histograms keep their own buckets, so they are captured at save time instead of per update
+type HistogramSource func() map[string]map[string]HistogramState
+
+// installs the source captured with every Save
+func (checkpoint *JSONCheckpoint) SetHistogramSource(source HistogramSource) {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+	checkpoint.histogramSource = source
+}
+
+// returns histogram states saved with the checkpoint
+func (checkpoint *JSONCheckpoint) GetHistogramValues() map[string]map[string]HistogramState {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+	return checkpoint.HistogramValues
+}
+
+// replaces the saved histograms with the current ones of the source, ephemeral metrics excluded;
+// called before taking the lock, sources lock the sink which takes the checkpoint lock on updates
+func (checkpoint *JSONCheckpoint) captureHistograms() {
+	checkpoint.lock.Lock()
+	source := checkpoint.histogramSource
+	checkpoint.lock.Unlock()
+	if source == nil {
+		return
+	}
+	histograms := source()
+
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+	for name := range histograms {
+		if checkpoint.policy(name) == config.PERSISTENCE_EPHEMERAL {
+			delete(histograms, name)
+		}
+	}
+	checkpoint.HistogramValues = histograms
+}
+
+// removes histograms matching the glob pattern, caller must hold the lock
+func (checkpoint *JSONCheckpoint) stripHistograms(pattern string) int {
+	removed := 0
+	for name, series := range checkpoint.HistogramValues {
+		if matched, _ := path.Match(pattern, name); matched {
+			removed += len(series)
+			delete(checkpoint.HistogramValues, name)
+		}
+	}
+	return removed
+}
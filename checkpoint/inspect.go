@@ -0,0 +1,254 @@
+package checkpoint
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// identifies one series stored in the checkpoint
+type SeriesRef struct {
+	Type      string // "counter" or "gauge"
+	Name      string
+	LabelsKey string
+}
+
+func (ref SeriesRef) String() string {
+	return fmt.Sprintf("%s %s{%s}", ref.Type, ref.Name, ref.LabelsKey)
+}
+
+// an entry that cannot be restored as it is
+type Problem struct {
+	Series  SeriesRef
+	Message string
+	// the problem concerns the whole metric rather than the series, see DeleteMetric
+	Metric bool
+}
+
+// per-metric series counts
+type MetricStats struct {
+	Type   string
+	Name   string
+	Series int
+}
+
+// number of series per metric, sorted by type and name
+func (checkpoint *JSONCheckpoint) Stats() []MetricStats {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	var stats []MetricStats
+	for typ, values := range checkpoint.byType() {
+		for name, series := range values {
+			stats = append(stats, MetricStats{Type: typ, Name: name, Series: len(series)})
+		}
+	}
+	for name, series := range checkpoint.HistogramValues {
+		stats = append(stats, MetricStats{Type: "histogram", Name: name, Series: len(series)})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Type != stats[j].Type {
+			return stats[i].Type < stats[j].Type
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// finds entries that would fail or be wrong on restore: invalid names, malformed label keys,
+// label sets differing from the rest of the metric, non-finite values, negative counters
+// and names used both as counter and gauge
+func (checkpoint *JSONCheckpoint) Problems() []Problem {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	var problems []Problem
+	add := func(ref SeriesRef, format string, args ...any) {
+		problems = append(problems, Problem{Series: ref, Message: fmt.Sprintf(format, args...)})
+	}
+	addMetric := func(ref SeriesRef, message string) {
+		problems = append(problems, Problem{Series: ref, Message: message, Metric: true})
+	}
+
+	for typ, values := range checkpoint.byType() {
+		for name, series := range values {
+			if !util.ValidMetricName(name) {
+				addMetric(SeriesRef{typ, name, ""}, "invalid metric name")
+			}
+			if _, isGauge := checkpoint.GaugeValues[name]; typ == "counter" && isGauge {
+				addMetric(SeriesRef{typ, name, ""}, "metric is stored both as counter and gauge")
+			}
+
+			// all series of a metric must have the same label names, the most common set wins
+			labelSets := make(map[string]int)
+			for labelsKey := range series {
+				if names, err := labelNames(labelsKey); err == nil {
+					labelSets[names]++
+				}
+			}
+			expected, most := "", -1
+			for names, count := range labelSets {
+				if count > most || (count == most && names < expected) {
+					expected, most = names, count
+				}
+			}
+
+			for labelsKey, value := range series {
+				ref := SeriesRef{typ, name, labelsKey}
+				names, err := labelNames(labelsKey)
+				if err != nil {
+					add(ref, "%v", err)
+				} else if names != expected {
+					add(ref, "label names [%s] differ from [%s] used by other series", names, expected)
+				}
+				if math.IsNaN(value) || math.IsInf(value, 0) {
+					add(ref, "non-finite value %v", value)
+				} else if typ == "counter" && value < 0 {
+					add(ref, "negative counter value %v", value)
+				}
+			}
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Series.String() < problems[j].Series.String() })
+	return problems
+}
+
+// removes the series, returns false if it does not exist
+func (checkpoint *JSONCheckpoint) Remove(ref SeriesRef) bool {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	values := checkpoint.byType()[ref.Type]
+	if _, exists := values[ref.Name][ref.LabelsKey]; !exists {
+		return false
+	}
+	delete(values[ref.Name], ref.LabelsKey)
+	if len(values[ref.Name]) == 0 {
+		delete(values, ref.Name)
+	}
+	return true
+}
+
+// removes all series of metrics matching the glob pattern, returns the number of removed series
+func (checkpoint *JSONCheckpoint) StripMetrics(pattern string) int {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	removed := 0
+	for _, values := range checkpoint.byType() {
+		for name, series := range values {
+			if matched, _ := path.Match(pattern, name); matched {
+				removed += len(series)
+				delete(values, name)
+			}
+		}
+	}
+	return removed + checkpoint.stripHistograms(pattern)
+}
+
+// removes all series having the label with a value matching the glob pattern,
+// returns the number of removed series
+func (checkpoint *JSONCheckpoint) StripLabel(label, valuePattern string) int {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	removed := 0
+	for _, values := range checkpoint.byType() {
+		for name, series := range values {
+			for labelsKey := range series {
+				labels, err := util.MapFromString(labelsKey)
+				if err != nil {
+					continue
+				}
+				value, ok := labels[label]
+				if !ok {
+					continue
+				}
+				if matched, _ := path.Match(valuePattern, value); matched {
+					delete(series, labelsKey)
+					removed++
+				}
+			}
+			if len(series) == 0 {
+				delete(values, name)
+			}
+		}
+	}
+	return removed
+}
+
+// a series that differs between two checkpoints, a missing side is nil
+type Change struct {
+	Series SeriesRef
+	Old    *float64
+	New    *float64
+}
+
+// compares two checkpoints, returns added, removed and changed series sorted by series
+func Diff(before, after *JSONCheckpoint) []Change {
+	before.lock.Lock()
+	defer before.lock.Unlock()
+	after.lock.Lock()
+	defer after.lock.Unlock()
+
+	var changes []Change
+	oldValues, newValues := before.byType(), after.byType()
+	for _, typ := range []string{"counter", "gauge"} {
+		for name, series := range oldValues[typ] {
+			for labelsKey, oldValue := range series {
+				oldValue := oldValue
+				ref := SeriesRef{typ, name, labelsKey}
+				newValue, exists := newValues[typ][name][labelsKey]
+				if !exists {
+					changes = append(changes, Change{Series: ref, Old: &oldValue})
+				} else if newValue != oldValue {
+					changes = append(changes, Change{Series: ref, Old: &oldValue, New: &newValue})
+				}
+			}
+		}
+		for name, series := range newValues[typ] {
+			for labelsKey, newValue := range series {
+				newValue := newValue
+				if _, exists := oldValues[typ][name][labelsKey]; !exists {
+					changes = append(changes, Change{Series: SeriesRef{typ, name, labelsKey}, New: &newValue})
+				}
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Series.String() < changes[j].Series.String() })
+	return changes
+}
+
+// caller must hold the lock
+func (checkpoint *JSONCheckpoint) byType() map[string]map[string]map[string]float64 {
+	return map[string]map[string]map[string]float64{
+		"counter": checkpoint.CounterValues,
+		"gauge":   checkpoint.GaugeValues,
+	}
+}
+
+// sorted label names of a label key, fails for keys util.MapFromString cannot parse
+func labelNames(labelsKey string) (string, error) {
+	if labelsKey == "" {
+		return "", nil
+	}
+	var names []string
+	for _, pair := range strings.Split(labelsKey, util.MAP_ENTRY_SEPARATOR) {
+		name, _, found := strings.Cut(pair, util.KEY_VAL_SEPARATOR)
+		if !found {
+			return "", fmt.Errorf("malformed label pair %q", pair)
+		}
+		if !util.ValidLabelName(name) {
+			return "", fmt.Errorf("invalid label name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ","), nil
+}
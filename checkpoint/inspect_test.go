@@ -0,0 +1,20 @@
+package checkpoint
+
+import "testing"
+
+func TestProblemsMarkMetricLevelProblems(t *testing.T) {
+	checkpoint := NewJSONCheckpoint("")
+	checkpoint.CounterValues["vm_count"] = map[string]float64{"cluster=a": 1}
+	checkpoint.GaugeValues["vm_count"] = map[string]float64{"cluster=a": 2}
+	checkpoint.CounterValues["deploy_total"] = map[string]float64{"env=prod": -1}
+
+	problems := checkpoint.Problems()
+	if len(problems) != 2 {
+		t.Fatalf("found %d problems, expected 2: %v", len(problems), problems)
+	}
+	for _, problem := range problems {
+		if metric := problem.Series.Name == "vm_count"; problem.Metric != metric {
+			t.Errorf("problem %s: %s has Metric %v, expected %v", problem.Series, problem.Message, problem.Metric, metric)
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package checkpoint
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
+	"math"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
-	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
 )
 
 type JSONCheckpoint struct {
@@ -23,68 +29,277 @@ type JSONCheckpoint struct {
 	// public API to extract all current label-value pairs and numeric values.
 	CounterValues map[string]map[string]float64
 	GaugeValues   map[string]map[string]float64
+	// histogram name -> (labelKey -> buckets, sum and count), captured from histogramSource on Save
+	HistogramValues map[string]map[string]HistogramState
+
+	// time of the last Save, or of the saved state after Load; zero for files written before it was recorded
+	SavedAt time.Time
+
+	// closed by Stop to end periodic saves
+	done chan struct{}
+	// request ID of the push or poll that last changed the values, logged with save errors
+	lastRequestID string
+
+	// current histogram states, see SetHistogramSource
+	histogramSource HistogramSource
+
+	// per-metric persistence, see SetPolicies; metric name -> resolved policy
+	policies    []config.PersistenceRule
+	policyCache map[string]string
+	// sequence number of the last write-ahead log record, saved with the checkpoint
+	// so records already contained in it are not replayed twice
+	walSeq uint64
+	// records appended since the last write-ahead log sync, see syncWAL
+	walPending []byte
+
+	// serializes write-ahead log syncs and saves, taken before lock
+	walLock sync.Mutex
+	// write-ahead log of durable metrics, opened on the first sync
+	wal *os.File
+	// sequence number of the last record synced to the log or contained in a save
+	walSynced uint64
+	// optional, fails saves on purpose, see SetFault
+	fault func() error
 }
 
 // creates a new JSON checkpoint with empty maps.
 func NewJSONCheckpoint(filePath string) *JSONCheckpoint {
 	return &JSONCheckpoint{
-		FilePath:      filePath,
-		CounterValues: make(map[string]map[string]float64),
-		GaugeValues:   make(map[string]map[string]float64),
+		FilePath:        filePath,
+		CounterValues:   make(map[string]map[string]float64),
+		GaugeValues:     make(map[string]map[string]float64),
+		HistogramValues: make(map[string]map[string]HistogramState),
 	}
 }
 
-func (checkpoint *JSONCheckpoint) IncCounter(name string, labels map[string]string) {
+// labelsKey is the metric labels merged into a single string key by util.JoinMapEntries,
+// "errType=unathenticated|status=failure"; the sink computes it once per update
+func (checkpoint *JSONCheckpoint) IncCounter(name string, labelsKey string) {
+	checkpoint.AddCounter(name, labelsKey, 1, "")
+}
+
+// reports false if the saved value lost part of delta to float64 rounding,
+// which happens once counters grow beyond MAX_EXACT_COUNTER; below it only fractional
+// deltas are rounded, by far less than one, which is not reported;
+// requestID is the push or poll of the update, see noteRequest
+func (checkpoint *JSONCheckpoint) AddCounter(name string, labelsKey string, delta float64, requestID string) (exact bool) {
 	checkpoint.lock.Lock()
-	defer checkpoint.lock.Unlock()
+	checkpoint.noteRequest(requestID)
+	var seq uint64
+	switch checkpoint.policy(name) {
+	case config.PERSISTENCE_EPHEMERAL:
+		checkpoint.lock.Unlock()
+		return true
+	case config.PERSISTENCE_DURABLE:
+		seq = checkpoint.appendWAL(walCounter, name, labelsKey, delta)
+	}
+	exact = checkpoint.addCounter(name, labelsKey, delta)
+	checkpoint.lock.Unlock()
+
+	checkpoint.syncWAL(seq)
+	return exact
+}
 
+// caller must hold the lock
+func (checkpoint *JSONCheckpoint) addCounter(name string, labelsKey string, delta float64) (exact bool) {
 	if _, exists := checkpoint.CounterValues[name]; !exists {
 		checkpoint.CounterValues[name] = map[string]float64{}
 	}
-
-	// merge metric labels into single string key
-	//"errType=unathenticated|status=failure"
-	key := util.JoinMapEntries(labels)
-
-	checkpoint.CounterValues[name][key]++
+	before := checkpoint.CounterValues[name][labelsKey]
+	after := before + delta
+	checkpoint.CounterValues[name][labelsKey] = after
+	return math.Abs(after) < MAX_EXACT_COUNTER || after-before == delta
 }
 
-func (checkpoint *JSONCheckpoint) SetGauge(name string, labels map[string]string, value float64) {
+// requestID is the push or poll of the update, see noteRequest
+func (checkpoint *JSONCheckpoint) SetGauge(name string, labelsKey string, value float64, requestID string) {
 	checkpoint.lock.Lock()
-	defer checkpoint.lock.Unlock()
+	checkpoint.noteRequest(requestID)
+	var seq uint64
+	switch checkpoint.policy(name) {
+	case config.PERSISTENCE_EPHEMERAL:
+		checkpoint.lock.Unlock()
+		return
+	case config.PERSISTENCE_DURABLE:
+		seq = checkpoint.appendWAL(walGauge, name, labelsKey, value)
+	}
+	checkpoint.setGauge(name, labelsKey, value)
+	checkpoint.lock.Unlock()
+
+	checkpoint.syncWAL(seq)
+}
 
+// caller must hold the lock
+func (checkpoint *JSONCheckpoint) setGauge(name string, labelsKey string, value float64) {
 	if _, exists := checkpoint.GaugeValues[name]; !exists {
 		checkpoint.GaugeValues[name] = map[string]float64{}
 	}
+	checkpoint.GaugeValues[name][labelsKey] = value
+}
+
+// remembers the push or poll of the last change, empty IDs are ignored; caller must hold the lock
+func (checkpoint *JSONCheckpoint) noteRequest(requestID string) {
+	if requestID != "" {
+		checkpoint.lastRequestID = requestID
+	}
+}
+
+// removes a single series from the checkpoint maps, labelsKey is the joined labels string
+func (checkpoint *JSONCheckpoint) DeleteSeries(name string, labelsKey string) {
+	checkpoint.lock.Lock()
+	var seq uint64
+	if checkpoint.policy(name) == config.PERSISTENCE_DURABLE {
+		seq = checkpoint.appendWAL(walDeleteSeries, name, labelsKey, 0)
+	}
+	checkpoint.deleteSeries(name, labelsKey)
+	checkpoint.lock.Unlock()
+
+	checkpoint.syncWAL(seq)
+}
+
+// caller must hold the lock
+func (checkpoint *JSONCheckpoint) deleteSeries(name string, labelsKey string) {
+	for _, values := range []map[string]map[string]float64{checkpoint.CounterValues, checkpoint.GaugeValues} {
+		if series, exists := values[name]; exists {
+			delete(series, labelsKey)
+			if len(series) == 0 {
+				delete(values, name)
+			}
+		}
+	}
+	if series, exists := checkpoint.HistogramValues[name]; exists {
+		delete(series, labelsKey)
+		if len(series) == 0 {
+			delete(checkpoint.HistogramValues, name)
+		}
+	}
+}
 
-	// merge metric labels into single string key
-	//"errType=unathenticated|status=failure"
-	key := util.JoinMapEntries(labels)
+// removes all series of a metric from the checkpoint maps
+func (checkpoint *JSONCheckpoint) DeleteMetric(name string) {
+	checkpoint.lock.Lock()
+	var seq uint64
+	if checkpoint.policy(name) == config.PERSISTENCE_DURABLE {
+		seq = checkpoint.appendWAL(walDeleteMetric, name, "", 0)
+	}
+	delete(checkpoint.CounterValues, name)
+	delete(checkpoint.GaugeValues, name)
+	delete(checkpoint.HistogramValues, name)
+	checkpoint.lock.Unlock()
 
-	checkpoint.GaugeValues[name][key] = value
+	checkpoint.syncWAL(seq)
 }
 
-// Save writes the current metric maps to the JSON file
+// Save writes the current metric maps to the JSON file, replacing it only once the new
+// contents are on disk, and then empties the write-ahead log
 func (checkpoint *JSONCheckpoint) Save() error {
+	checkpoint.captureHistograms()
+
 	checkpoint.lock.Lock()
-	defer checkpoint.lock.Unlock()
+	fault := checkpoint.fault
+	checkpoint.lock.Unlock()
+	// outside the lock, faults may update metrics and thereby the checkpoint
+	if fault != nil {
+		if err := fault(); err != nil {
+			return err
+		}
+	}
 
-	//open json file
-	file, err := os.Create(checkpoint.FilePath)
+	// the log lock keeps the log unchanged until it is truncated, updates only wait for the copy
+	checkpoint.walLock.Lock()
+	defer checkpoint.walLock.Unlock()
+	checkpoint.lock.Lock()
+	state := checkpoint.snapshot()
+	pending := len(checkpoint.walPending)
+	checkpoint.lock.Unlock()
+
+	if err := checkpoint.write(state); err != nil {
+		return err
+	}
+
+	checkpoint.lock.Lock()
+	checkpoint.SavedAt = state.SavedAt
+	// records buffered while writing are not part of the saved state, they go to the log as usual
+	checkpoint.walPending = checkpoint.walPending[pending:]
+	checkpoint.lock.Unlock()
+	// the records of the log are part of the checkpoint now
+	checkpoint.walSynced = state.WALSeq
+	checkpoint.truncateWAL()
+	return nil
+}
+
+// contents of the checkpoint file
+type savedState struct {
+	SavedAt    time.Time                            `json:"savedAt"`
+	WALSeq     uint64                               `json:"walSeq,omitempty"`
+	Counters   map[string]map[string]float64        `json:"counters"`
+	Gauges     map[string]map[string]float64        `json:"gauges"`
+	Histograms map[string]map[string]HistogramState `json:"histograms,omitempty"`
+}
+
+// copies the maps, with the sequence number of the last log record they contain;
+// caller must hold the lock
+func (checkpoint *JSONCheckpoint) snapshot() savedState {
+	state := savedState{
+		SavedAt:    time.Now(),
+		WALSeq:     checkpoint.walSeq,
+		Counters:   make(map[string]map[string]float64, len(checkpoint.CounterValues)),
+		Gauges:     make(map[string]map[string]float64, len(checkpoint.GaugeValues)),
+		Histograms: make(map[string]map[string]HistogramState, len(checkpoint.HistogramValues)),
+	}
+	for name, series := range checkpoint.CounterValues {
+		state.Counters[name] = maps.Clone(series)
+	}
+	for name, series := range checkpoint.GaugeValues {
+		state.Gauges[name] = maps.Clone(series)
+	}
+	// states are replaced rather than changed, the series maps are copied only
+	for name, series := range checkpoint.HistogramValues {
+		state.Histograms[name] = maps.Clone(series)
+	}
+	return state
+}
+
+// writes the state to a temporary file and renames it over the checkpoint, so a crash
+// while saving leaves the previous checkpoint intact
+func (checkpoint *JSONCheckpoint) write(state savedState) error {
+	tmp := checkpoint.FilePath + TMP_SUFFIX
+	file, err := os.Create(tmp)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to create checkpoint file: %v", err))
 		return err
 	}
+	defer os.Remove(tmp)
 	defer file.Close()
 
 	//write maps as json
-	return json.NewEncoder(file).Encode(struct {
-		Counters map[string]map[string]float64 `json:"counters"`
-		Gauges   map[string]map[string]float64 `json:"gauges"`
-	}{
-		Counters: checkpoint.CounterValues,
-		Gauges:   checkpoint.GaugeValues,
-	})
+	err = json.NewEncoder(file).Encode(state)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, checkpoint.FilePath)
+	}
+	if err != nil {
+		return err
+	}
+	// the rename itself is only durable once the directory is synced
+	if err := syncDir(filepath.Dir(checkpoint.FilePath)); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to sync checkpoint directory: %v", err))
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
 
 // loads metric maps from the JSON file
@@ -94,6 +309,10 @@ func (checkpoint *JSONCheckpoint) Load() error {
 
 	//open json file
 	file, err := os.Open(checkpoint.FilePath)
+	if errors.Is(err, fs.ErrNotExist) && checkpoint.hasWAL() {
+		// crashed before the first save, durable updates are in the log only
+		return checkpoint.replayWAL()
+	}
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to open checkpoint file: %v", err))
 		return err
@@ -101,10 +320,7 @@ func (checkpoint *JSONCheckpoint) Load() error {
 	defer file.Close()
 
 	//parse json into maps
-	data := struct {
-		Counters map[string]map[string]float64 `json:"counters"`
-		Gauges   map[string]map[string]float64 `json:"gauges"`
-	}{}
+	data := savedState{}
 
 	if err := json.NewDecoder(file).Decode(&data); err != nil {
 		logger.Error(fmt.Sprintf("Failed to parse checkpoint file into json: %v", err))
@@ -113,6 +329,24 @@ func (checkpoint *JSONCheckpoint) Load() error {
 
 	checkpoint.CounterValues = data.Counters
 	checkpoint.GaugeValues = data.Gauges
+	checkpoint.HistogramValues = data.Histograms
+	checkpoint.SavedAt = data.SavedAt
+	checkpoint.walSeq = data.WALSeq
+	if checkpoint.CounterValues == nil {
+		checkpoint.CounterValues = make(map[string]map[string]float64)
+	}
+	if checkpoint.GaugeValues == nil {
+		checkpoint.GaugeValues = make(map[string]map[string]float64)
+	}
+	if checkpoint.HistogramValues == nil {
+		// files written before histograms were checkpointed
+		checkpoint.HistogramValues = make(map[string]map[string]HistogramState)
+	}
+
+	// updates of durable metrics after the checkpoint was saved
+	if err := checkpoint.replayWAL(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to replay checkpoint write-ahead log: %v", err))
+	}
 	return nil
 }
 
@@ -132,13 +366,45 @@ func (checkpoint *JSONCheckpoint) GetGaugeValues() map[string]map[string]float64
 
 // periodically saves metrics to the file
 func (checkpoint *JSONCheckpoint) StartPeriodic(interval time.Duration) {
+	done := make(chan struct{})
+	checkpoint.lock.Lock()
+	checkpoint.done = done
+	checkpoint.lock.Unlock()
+
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
-		for range ticker.C {
-			if err := checkpoint.Save(); err != nil {
-				logger.Error(fmt.Sprintf("Failed to save checkpoint: %v", err))
+		for {
+			select {
+			case <-ticker.C:
+				if err := checkpoint.Save(); err != nil {
+					checkpoint.lock.Lock()
+					requestID := checkpoint.lastRequestID
+					checkpoint.lock.Unlock()
+					logger.ErrorCtx(logger.WithRequestID(context.Background(), requestID),
+						fmt.Sprintf("Failed to save checkpoint with changes up to this request: %v", err))
+				}
+			case <-done:
+				return
 			}
 		}
 	}()
 }
+
+// installs a check run before each Save, an error it returns fails the save without writing,
+// for failure injection
+func (checkpoint *JSONCheckpoint) SetFault(fault func() error) {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+	checkpoint.fault = fault
+}
+
+// ends periodic saves, the file keeps the state of the last Save
+func (checkpoint *JSONCheckpoint) Stop() {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+	if checkpoint.done != nil {
+		close(checkpoint.done)
+		checkpoint.done = nil
+	}
+}
@@ -0,0 +1,153 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+func TestAddCounterReportsPrecisionLoss(t *testing.T) {
+	cases := []struct {
+		name   string
+		before float64
+		delta  float64
+		exact  bool
+	}{
+		{"integer", 41, 1, true},
+		{"fraction", 0.1, 0.2, true},
+		{"fractions of a large counter", 1e12, 0.001, true},
+		{"just below 2^53", MAX_EXACT_COUNTER - 2, 1, true},
+		{"odd increment beyond 2^53", MAX_EXACT_COUNTER, 1, false},
+		{"even increment beyond 2^53", MAX_EXACT_COUNTER, 2, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkpoint := NewJSONCheckpoint("")
+			checkpoint.addCounter("bytes_total", "", c.before)
+			if exact := checkpoint.addCounter("bytes_total", "", c.delta); exact != c.exact {
+				t.Fatalf("adding %v to %v reported exact=%v, expected %v", c.delta, c.before, exact, c.exact)
+			}
+		})
+	}
+}
+
+func TestSaveReplacesFileAndEmptiesWAL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint := NewJSONCheckpoint(file)
+	checkpoint.SetPolicies([]config.PersistenceRule{{Match: "*", Policy: config.PERSISTENCE_DURABLE}})
+	checkpoint.AddCounter("deploy_total", "", 2, "")
+	if err := checkpoint.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file + TMP_SUFFIX); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind after save: %v", err)
+	}
+	if info, err := os.Stat(file + WAL_SUFFIX); err != nil || info.Size() != 0 {
+		t.Fatalf("write-ahead log not emptied by save: %v", err)
+	}
+
+	loaded := NewJSONCheckpoint(file)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if value := loaded.CounterValues["deploy_total"][""]; value != 2 {
+		t.Fatalf("loaded counter %v, expected 2", value)
+	}
+}
+
+func TestConcurrentDurableUpdatesReplay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint := NewJSONCheckpoint(file)
+	checkpoint.SetPolicies([]config.PersistenceRule{{Match: "*", Policy: config.PERSISTENCE_DURABLE}})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				checkpoint.AddCounter("deploy_total", "", 1, "")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// never saved, everything comes from the log
+	replayed := NewJSONCheckpoint(file)
+	if err := replayed.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if value := replayed.CounterValues["deploy_total"][""]; value != 400 {
+		t.Fatalf("replayed counter %v, expected 400", value)
+	}
+}
+
+func TestUpdatesDuringSavesAreKept(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint := NewJSONCheckpoint(file)
+	checkpoint.SetPolicies([]config.PersistenceRule{{Match: "durable_*", Policy: config.PERSISTENCE_DURABLE}})
+	// enough series that updates mostly happen while a save writes the file
+	for i := 0; i < 10000; i++ {
+		checkpoint.SetGauge("vm_count", fmt.Sprintf("vm=%d", i), 1, "")
+	}
+	saved := make(chan struct{})
+	var updates atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-saved:
+					return
+				default:
+				}
+				checkpoint.AddCounter("durable_total", "", 1, "")
+				updates.Add(1)
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := checkpoint.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(saved)
+	wg.Wait()
+
+	// updates during the last save are in the log only, it must not be truncated before they are saved
+	loaded := NewJSONCheckpoint(file)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if value := loaded.CounterValues["durable_total"][""]; value != float64(updates.Load()) {
+		t.Fatalf("loaded durable counter %v, expected %d", value, updates.Load())
+	}
+}
+
+func TestReplayedMetricDeleteDropsHistograms(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint := NewJSONCheckpoint(file)
+	checkpoint.SetPolicies([]config.PersistenceRule{{Match: "*", Policy: config.PERSISTENCE_DURABLE}})
+	checkpoint.SetHistogramSource(func() map[string]map[string]HistogramState {
+		return map[string]map[string]HistogramState{"latency_seconds": {"": {Count: 1, Sum: 0.5}}}
+	})
+	if err := checkpoint.Save(); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.DeleteMetric("latency_seconds")
+
+	// the delete after the save is in the log only
+	loaded := NewJSONCheckpoint(file)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.HistogramValues["latency_seconds"]; ok {
+		t.Fatal("histogram deleted after the save was restored")
+	}
+}
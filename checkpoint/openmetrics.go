@@ -0,0 +1,103 @@
+package checkpoint
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// one value of a series at the time a checkpoint was saved
+type sample struct {
+	labelsKey string
+	value     float64
+	at        time.Time
+}
+
+// writes checkpoints as OpenMetrics text with the SavedAt time of each checkpoint
+// as sample timestamp, suitable for backfilling with
+//
+//	promtool tsdb create-blocks-from openmetrics export.om data/
+//
+// several checkpoints (e.g. periodic copies of the file) become one history;
+// checkpoints without SavedAt are skipped, corrupt entries should be repaired first
+func WriteOpenMetrics(w io.Writer, checkpoints []*JSONCheckpoint) error {
+	counters := make(map[string][]sample)
+	gauges := make(map[string][]sample)
+	for _, cp := range checkpoints {
+		if cp.SavedAt.IsZero() {
+			continue
+		}
+		cp.lock.Lock()
+		collectSamples(counters, cp.CounterValues, cp.SavedAt)
+		collectSamples(gauges, cp.GaugeValues, cp.SavedAt)
+		cp.lock.Unlock()
+	}
+
+	out := bufio.NewWriter(w)
+	for _, name := range sortedNames(counters) {
+		// OpenMetrics counter families are named without the _total suffix of their samples,
+		// counters not following the convention are exported untyped
+		family, isTotal := strings.CutSuffix(name, "_total")
+		if isTotal {
+			fmt.Fprintf(out, "# TYPE %s counter\n", family)
+		} else {
+			fmt.Fprintf(out, "# TYPE %s unknown\n", name)
+		}
+		writeSamples(out, name, counters[name])
+	}
+	for _, name := range sortedNames(gauges) {
+		fmt.Fprintf(out, "# TYPE %s gauge\n", name)
+		writeSamples(out, name, gauges[name])
+	}
+	fmt.Fprintln(out, "# EOF")
+	return out.Flush()
+}
+
+func collectSamples(into map[string][]sample, values map[string]map[string]float64, at time.Time) {
+	for name, series := range values {
+		for labelsKey, value := range series {
+			into[name] = append(into[name], sample{labelsKey: labelsKey, value: value, at: at})
+		}
+	}
+}
+
+// writes samples of one metric grouped by series and ordered by time
+func writeSamples(out *bufio.Writer, name string, samples []sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].labelsKey != samples[j].labelsKey {
+			return samples[i].labelsKey < samples[j].labelsKey
+		}
+		return samples[i].at.Before(samples[j].at)
+	})
+	for _, s := range samples {
+		fmt.Fprintf(out, "%s%s %v %.3f\n", name, formatLabels(s.labelsKey), s.value, float64(s.at.UnixMilli())/1000)
+	}
+}
+
+// "a=b|c=d" -> {a="b",c="d"}
+func formatLabels(labelsKey string) string {
+	labels, err := util.MapFromString(labelsKey)
+	if err != nil || len(labels) == 0 {
+		return ""
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, 0, len(labels))
+	for _, name := range util.SortedKeysFromMap(labels) {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, escaper.Replace(labels[name])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func sortedNames(values map[string][]sample) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,190 @@
+package checkpoint
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// kinds of write-ahead log records
+const (
+	walCounter      = "counter"
+	walGauge        = "gauge"
+	walDeleteSeries = "deleteSeries"
+	walDeleteMetric = "deleteMetric"
+)
+
+// one update of a durable metric, a line of the write-ahead log
+type walRecord struct {
+	Seq       uint64  `json:"seq"`
+	Kind      string  `json:"kind"`
+	Name      string  `json:"name"`
+	LabelsKey string  `json:"labels,omitempty"`
+	Value     float64 `json:"value,omitempty"`
+}
+
+// installs per-metric persistence policies, the first matching rule applies and metrics
+// matching none are persistent; series of ephemeral metrics already loaded are dropped
+func (checkpoint *JSONCheckpoint) SetPolicies(rules []config.PersistenceRule) {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	checkpoint.policies = rules
+	checkpoint.policyCache = make(map[string]string)
+	for _, values := range checkpoint.byType() {
+		for name := range values {
+			if checkpoint.policy(name) == config.PERSISTENCE_EPHEMERAL {
+				delete(values, name)
+			}
+		}
+	}
+}
+
+// persistence policy of a metric, see SetPolicies
+func (checkpoint *JSONCheckpoint) Policy(name string) string {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+	return checkpoint.policy(name)
+}
+
+// caller must hold the lock
+func (checkpoint *JSONCheckpoint) policy(name string) string {
+	if len(checkpoint.policies) == 0 {
+		return config.PERSISTENCE_PERSISTENT
+	}
+	if policy, cached := checkpoint.policyCache[name]; cached {
+		return policy
+	}
+	policy := config.PERSISTENCE_PERSISTENT
+	for _, rule := range checkpoint.policies {
+		if matched, _ := path.Match(rule.Match, name); matched {
+			policy = rule.Policy
+			break
+		}
+	}
+	checkpoint.policyCache[name] = policy
+	return policy
+}
+
+// buffers an update of a durable metric for the log and returns its sequence number, caller
+// must hold the lock and call syncWAL with it once released; 0 if it could not be encoded
+func (checkpoint *JSONCheckpoint) appendWAL(kind, name, labelsKey string, value float64) uint64 {
+	line, err := json.Marshal(walRecord{Seq: checkpoint.walSeq + 1, Kind: kind, Name: name, LabelsKey: labelsKey, Value: value})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode write-ahead log record: %v", err))
+		return 0
+	}
+	checkpoint.walSeq++
+	checkpoint.walPending = append(append(checkpoint.walPending, line...), '\n')
+	return checkpoint.walSeq
+}
+
+// returns once the record seq is on disk. Group commit: whoever gets the log lock writes and
+// syncs the records buffered by everyone up to then, so concurrent updates share one fsync and
+// updates never wait for the disk while holding the lock; failures are logged, the update is
+// still saved with the next checkpoint
+func (checkpoint *JSONCheckpoint) syncWAL(seq uint64) {
+	if seq == 0 {
+		return
+	}
+	checkpoint.walLock.Lock()
+	defer checkpoint.walLock.Unlock()
+	if checkpoint.walSynced >= seq {
+		return
+	}
+
+	checkpoint.lock.Lock()
+	pending, last := checkpoint.walPending, checkpoint.walSeq
+	checkpoint.walPending = nil
+	checkpoint.lock.Unlock()
+	checkpoint.walSynced = last
+
+	if checkpoint.wal == nil {
+		file, err := os.OpenFile(checkpoint.walPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to open checkpoint write-ahead log: %v", err))
+			return
+		}
+		checkpoint.wal = file
+	}
+	if _, err := checkpoint.wal.Write(pending); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write checkpoint write-ahead log: %v", err))
+		return
+	}
+	if err := checkpoint.wal.Sync(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to sync checkpoint write-ahead log: %v", err))
+	}
+}
+
+// empties the log after a successful save, its records are part of the checkpoint now;
+// caller must hold the log lock
+func (checkpoint *JSONCheckpoint) truncateWAL() {
+	if checkpoint.wal == nil {
+		return
+	}
+	if err := checkpoint.wal.Truncate(0); err != nil {
+		// records up to the saved sequence number are skipped on replay anyway
+		logger.Warn(fmt.Sprintf("Failed to truncate checkpoint write-ahead log: %v", err))
+	}
+}
+
+// applies the records written after the loaded checkpoint was saved, caller must hold the lock;
+// a partially written last line of a crash is ignored
+func (checkpoint *JSONCheckpoint) replayWAL() error {
+	file, err := os.Open(checkpoint.walPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	replayed := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, MAX_WAL_LINE_BYTES)
+	for scanner.Scan() {
+		var record walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logger.Warn(fmt.Sprintf("Skipping unreadable write-ahead log record: %v", err))
+			continue
+		}
+		if record.Seq <= checkpoint.walSeq {
+			continue
+		}
+		checkpoint.walSeq = record.Seq
+		switch record.Kind {
+		case walCounter:
+			checkpoint.addCounter(record.Name, record.LabelsKey, record.Value)
+		case walGauge:
+			checkpoint.setGauge(record.Name, record.LabelsKey, record.Value)
+		case walDeleteSeries:
+			checkpoint.deleteSeries(record.Name, record.LabelsKey)
+		case walDeleteMetric:
+			delete(checkpoint.CounterValues, record.Name)
+			delete(checkpoint.GaugeValues, record.Name)
+			delete(checkpoint.HistogramValues, record.Name)
+		}
+		replayed++
+	}
+	if replayed > 0 {
+		logger.Info(fmt.Sprintf("Replayed %d write-ahead log records saved after the checkpoint", replayed))
+	}
+	return scanner.Err()
+}
+
+func (checkpoint *JSONCheckpoint) hasWAL() bool {
+	_, err := os.Stat(checkpoint.walPath())
+	return err == nil
+}
+
+func (checkpoint *JSONCheckpoint) walPath() string {
+	return checkpoint.FilePath + WAL_SUFFIX
+}
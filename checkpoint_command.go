@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/checkpoint"
+)
+
+const checkpointUsage = `usage:
+  collector checkpoint inspect <file>
+  collector checkpoint repair [-strip-metric <glob>]... [-strip-label <name>=<glob>]... [-o <file>] <file>
+  collector checkpoint diff <old file> <new file>
+  collector checkpoint export [-o <file>] <file>...`
+
+// checkpoint subcommands, operators fix state with these instead of hand-editing JSON
+var checkpointCommands = map[string]func(args []string) int{
+	"inspect": checkpointInspectCommand,
+	"repair":  checkpointRepairCommand,
+	"diff":    checkpointDiffCommand,
+	"export":  checkpointExportCommand,
+}
+
+func checkpointCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, checkpointUsage)
+		return 2
+	}
+	command, ok := checkpointCommands[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, checkpointUsage)
+		return 2
+	}
+	return command(args[1:])
+}
+
+// prints series counts per metric and entries that cannot be restored
+func checkpointInspectCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, checkpointUsage)
+		return 2
+	}
+	cp, err := loadCheckpoint(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+
+	total := 0
+	for _, stats := range cp.Stats() {
+		fmt.Printf("%-8s %-60s %d\n", stats.Type, stats.Name, stats.Series)
+		total += stats.Series
+	}
+	fmt.Printf("%d series\n", total)
+
+	problems := cp.Problems()
+	for _, problem := range problems {
+		fmt.Printf("corrupt: %s: %s\n", problem.Series, problem.Message)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d corrupt entries, run checkpoint repair to remove them\n", len(problems))
+		return 1
+	}
+	return 0
+}
+
+// removes corrupt entries and selected metrics or label values;
+// the file is rewritten in place with a .bak copy unless -o is given
+func checkpointRepairCommand(args []string) int {
+	flags := flag.NewFlagSet("checkpoint repair", flag.ExitOnError)
+	var stripMetrics, stripLabels stringList
+	flags.Var(&stripMetrics, "strip-metric", "remove metrics matching the glob pattern, repeatable")
+	flags.Var(&stripLabels, "strip-label", "remove series with label <name>=<glob>, repeatable")
+	output := flags.String("o", "", "write the repaired checkpoint to this file instead of in place")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, checkpointUsage)
+		return 2
+	}
+	path := flags.Arg(0)
+
+	cp, err := loadCheckpoint(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	removedMetrics := make(map[string]bool)
+	for _, problem := range cp.Problems() {
+		switch {
+		case problem.Metric:
+			// all its series, whatever their labels
+			if !removedMetrics[problem.Series.Name] {
+				cp.DeleteMetric(problem.Series.Name)
+				removedMetrics[problem.Series.Name] = true
+				fmt.Printf("removed metric %s: %s\n", problem.Series.Name, problem.Message)
+			}
+		case removedMetrics[problem.Series.Name]:
+		case cp.Remove(problem.Series):
+			fmt.Printf("removed %s: %s\n", problem.Series, problem.Message)
+		}
+	}
+	for _, pattern := range stripMetrics {
+		fmt.Printf("removed %d series of metrics matching %s\n", cp.StripMetrics(pattern), pattern)
+	}
+	for _, selector := range stripLabels {
+		label, valuePattern, found := strings.Cut(selector, "=")
+		if !found {
+			fmt.Fprintf(os.Stderr, "invalid -strip-label %q, use <name>=<glob>\n", selector)
+			return 2
+		}
+		fmt.Printf("removed %d series with %s\n", cp.StripLabel(label, valuePattern), selector)
+	}
+
+	if *output == "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = os.WriteFile(path+".bak", data, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to back up %s: %v\n", path, err)
+			return 1
+		}
+		*output = path
+	}
+	cp.FilePath = *output
+	if err := cp.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *output, err)
+		return 1
+	}
+	fmt.Printf("wrote %s\n", *output)
+	return 0
+}
+
+// prints series added, removed or changed between two checkpoints
+func checkpointDiffCommand(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, checkpointUsage)
+		return 2
+	}
+	before, err := loadCheckpoint(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	after, err := loadCheckpoint(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[1], err)
+		return 1
+	}
+
+	changes := checkpoint.Diff(before, after)
+	for _, change := range changes {
+		switch {
+		case change.Old == nil:
+			fmt.Printf("+ %s %v\n", change.Series, *change.New)
+		case change.New == nil:
+			fmt.Printf("- %s %v\n", change.Series, *change.Old)
+		default:
+			fmt.Printf("~ %s %v -> %v\n", change.Series, *change.Old, *change.New)
+		}
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// writes one or more checkpoint files as OpenMetrics for promtool backfilling;
+// files saved before timestamps were recorded use their modification time
+func checkpointExportCommand(args []string) int {
+	flags := flag.NewFlagSet("checkpoint export", flag.ExitOnError)
+	output := flags.String("o", "", "output file, stdout if empty")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, checkpointUsage)
+		return 2
+	}
+
+	var checkpoints []*checkpoint.JSONCheckpoint
+	for _, path := range flags.Args() {
+		cp, err := loadCheckpoint(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		if cp.SavedAt.IsZero() {
+			stat, err := os.Stat(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				return 1
+			}
+			cp.SavedAt = stat.ModTime()
+		}
+		if problems := cp.Problems(); len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %d corrupt entries, run checkpoint repair first\n", path, len(problems))
+			return 1
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *output, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := checkpoint.WriteOpenMetrics(out, checkpoints); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write OpenMetrics: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func loadCheckpoint(path string) (*checkpoint.JSONCheckpoint, error) {
+	cp := checkpoint.NewJSONCheckpoint(path)
+	if err := cp.Load(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// repeatable string flag
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
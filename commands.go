@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/grafana"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/plugins"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// subcommands run instead of the collector, e.g. "collector validate-config -config cfg.json"
+// each returns the process exit code
+var commands = map[string]func(args []string) int{
+	"validate-config": validateConfigCommand,
+	"checkpoint":      checkpointCommand,
+	"dashboard":       dashboardCommand,
+	"loadtest":        loadtestCommand,
+	"doctor":          doctorCommand,
+}
+
+// runs the subcommand named by the first argument, returns false if there is none
+func runCommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return 0, false
+	}
+	return command(args[1:]), true
+}
+
+// reports unknown keys, bad values and semantic problems of a config file, or of the
+// defaults with the COLLECTOR_* environment overrides if no file is given
+func validateConfigCommand(args []string) int {
+	flags := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to JSON config file")
+	flags.Parse(args)
+	if *configPath == "" && flags.NArg() > 0 {
+		*configPath = flags.Arg(0)
+	}
+	source := *configPath
+	if source == "" {
+		source = "environment"
+	}
+
+	issues, err := validateConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", source, err)
+		return 1
+	}
+	for _, issue := range issues {
+		fmt.Printf("%s:%s\n", source, issue)
+	}
+	if len(issues) > 0 {
+		fmt.Printf("%d problem(s) found\n", len(issues))
+		return 1
+	}
+	fmt.Println("config is valid")
+	return 0
+}
+
+// config file checks plus checks needing other packages (processors, metric schemas)
+func validateConfig(path string) ([]config.Issue, error) {
+	cfg, issues, err := config.Validate(path)
+	if err != nil {
+		return nil, err
+	}
+	// plugins register processors and sinks checked below
+	if err := plugins.LoadAll(cfg.Plugins); err != nil {
+		issues = append(issues, config.Issue{Path: "plugins", Message: err.Error()})
+	}
+	for i, sc := range cfg.Sinks {
+		if _, err := plugins.NewSink(sc.Type, sc.Options); err != nil {
+			issues = append(issues, config.Issue{Path: fmt.Sprintf("sinks[%d]", i), Message: err.Error()})
+		}
+	}
+	for i, ic := range cfg.Interceptors {
+		if _, err := metrics.NewInterceptor(ic.Type, ic.Options); err != nil {
+			issues = append(issues, config.Issue{Path: fmt.Sprintf("interceptors[%d]", i), Message: err.Error()})
+		}
+	}
+	for i, pc := range cfg.Pollers {
+		if _, err := poller.NewProcessor(pc); err != nil {
+			issues = append(issues, config.Issue{Path: fmt.Sprintf("pollers[%d].processor", i), Message: err.Error()})
+		}
+		if pc.Schedule != "" {
+			if _, err := poller.ParseCron(pc.Schedule); err != nil {
+				issues = append(issues, config.Issue{Path: fmt.Sprintf("pollers[%d].schedule", i), Message: err.Error()})
+			}
+		}
+	}
+	for i, ec := range cfg.Execs {
+		if ec.Schedule != "" {
+			if _, err := poller.ParseCron(ec.Schedule); err != nil {
+				issues = append(issues, config.Issue{Path: fmt.Sprintf("exec[%d].schedule", i), Message: err.Error()})
+			}
+		}
+	}
+	if err := logger.ValidateLevels(cfg.Log.Level, cfg.Log.Modules); err != nil {
+		issues = append(issues, config.Issue{Path: "log", Message: err.Error()})
+	}
+	if err := prometheus.ValidateHistogramSchemas(cfg.Histograms); err != nil {
+		issues = append(issues, config.Issue{Path: "histograms", Message: err.Error()})
+	}
+	if err := prometheus.ValidateSummarySchemas(cfg.Summaries); err != nil {
+		issues = append(issues, config.Issue{Path: "summaries", Message: err.Error()})
+	}
+	return issues, nil
+}
+
+// generates a Grafana dashboard from the metrics a running collector exposes
+func dashboardCommand(args []string) int {
+	flags := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	url := flags.String("url", "http://localhost:8080/metrics", "metrics endpoint of a running collector")
+	title := flags.String("title", "", "dashboard title")
+	runtime := flags.Bool("runtime", false, "include Go runtime and process metrics")
+	output := flags.String("o", "", "output file, stdout if empty")
+	flags.Parse(args)
+
+	resp, err := http.Get(*url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to fetch %s: %v\n", *url, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "failed to fetch %s: %s\n", *url, resp.Status)
+		return 1
+	}
+	var parser expfmt.TextParser
+	parsed, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse %s: %v\n", *url, err)
+		return 1
+	}
+	families := make([]*dto.MetricFamily, 0, len(parsed))
+	for _, family := range parsed {
+		families = append(families, family)
+	}
+
+	data, err := json.MarshalIndent(grafana.Generate(families, grafana.Options{Title: *title, IncludeRuntime: *runtime}), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *output == "" {
+		fmt.Println(string(data))
+		return 0
+	}
+	if err := os.WriteFile(*output, append(data, '\n'), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package config
+
+// self-registration of push agents via POST /register: agents announce their name, version,
+// expected metrics and push interval, the collector flags agents that stop pushing
+type AgentsConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// how often agent state is updated
+	CheckInterval Duration `json:"checkInterval"`
+	// an agent is down after this many push intervals without a push
+	MissedPushes int `json:"missedPushes,omitempty"`
+	// registrations are kept in this file across restarts, in memory only if empty;
+	// written every CheckInterval while registrations changed
+	StateFile string `json:"stateFile,omitempty"`
+	// further registrations of new agents are rejected beyond this many, 0 means default
+	MaxAgents int `json:"maxAgents,omitempty"`
+	// agents neither pushing nor registering for this long are removed, never if 0
+	Expiry Duration `json:"expiry"`
+	// directory of JSON or YAML files with AgentConfigRule lists served to agents,
+	// re-read every CheckInterval when files change
+	ConfigDir string `json:"configDir,omitempty"`
+}
+
+// settings served to agents whose name matches, the first matching rule of all files
+// (sorted by file name) applies; empty fields leave the agent's own setting
+type AgentConfigRule struct {
+	// glob matched against agent names, e.g. "esx-agent-*"
+	Match string `json:"match" yaml:"match"`
+	// overrides the interval the agent registered with, also when checking it is up
+	PushInterval Duration `json:"pushInterval" yaml:"pushInterval"`
+	// glob patterns of metrics the agent should push, all if empty
+	EnabledMetrics []string `json:"enabledMetrics,omitempty" yaml:"enabledMetrics,omitempty"`
+	// labels the agent should add to all its metrics
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+func (cfg *Config) checkAgents(c *checker) {
+	if cfg.Agents.Enabled {
+		if cfg.Agents.CheckInterval.Duration <= 0 {
+			c.add("agents.checkInterval", "must be positive")
+		}
+		if cfg.Agents.MissedPushes < 1 {
+			c.add("agents.missedPushes", "must be at least 1")
+		}
+		if cfg.Agents.MaxAgents < 0 {
+			c.add("agents.maxAgents", "must not be negative")
+		}
+		if cfg.Agents.Expiry.Duration < 0 {
+			c.add("agents.expiry", "must not be negative")
+		}
+	}
+	if !cfg.Agents.Enabled && cfg.Agents.ConfigDir != "" {
+		c.add("agents.configDir", "requires agents.enabled")
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+// discrete events recorded as annotations next to the metrics: pushed via POST /annotations
+// (deployments and the like), maintenance windows and poller breakers; served to Grafana on
+// GET /api/annotations
+type AnnotationsConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// the oldest annotations are dropped beyond this many
+	MaxEvents int `json:"maxEvents,omitempty"`
+	// annotations that ended longer ago are dropped, 0 keeps them up to MaxEvents
+	Retention Duration `json:"retention"`
+	// annotations are kept in this file across restarts, in memory only if empty
+	StateFile string `json:"stateFile,omitempty"`
+}
+
+func (cfg *Config) checkAnnotations(c *checker) {
+	if cfg.Annotations.Enabled {
+		if cfg.Annotations.MaxEvents < 1 {
+			c.add("annotations.maxEvents", "must be at least 1")
+		}
+		if cfg.Annotations.Retention.Duration < 0 {
+			c.add("annotations.retention", "must not be negative")
+		}
+	}
+	if !cfg.Annotations.Enabled && cfg.Annotations.StateFile != "" {
+		c.add("annotations.stateFile", "requires annotations.enabled")
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import "fmt"
+
+// HTTP availability check of a URL: DNS, TCP connect, TLS handshake, response time and status
+type BlackboxConfig struct {
+	// "GET" (default) or "HEAD"
+	Method string `json:"method,omitempty"`
+	// response statuses counted as success, any 2xx if empty
+	ValidStatus []int `json:"validStatus,omitempty"`
+	// 0 means default
+	Timeout Duration `json:"timeout,omitempty"`
+	// probe endpoints with self-signed certificates, common for freshly deployed appliances
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// request headers, values may reference secrets
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// a URL (vCenter, Aria, NSX) probed every interval, its metrics labelled target=<Name>
+type BlackboxTargetConfig struct {
+	// defaults to the URL
+	Name     string   `json:"name,omitempty"`
+	URL      string   `json:"url"`
+	Interval Duration `json:"interval"`
+	// targets should share label names, probe metrics with other label names conflict
+	Labels map[string]string `json:"labels,omitempty"`
+	BlackboxConfig
+}
+
+// checks the probe settings shared by blackbox targets and probe modules
+func (bc BlackboxConfig) check(c *checker, path string) {
+	if bc.Method != "" && bc.Method != "GET" && bc.Method != "HEAD" {
+		c.add(path+".method", "unknown method %q (use \"GET\" or \"HEAD\")", bc.Method)
+	}
+	for i, status := range bc.ValidStatus {
+		if status < 100 || status > 599 {
+			c.add(fmt.Sprintf("%s.validStatus[%d]", path, i), "invalid HTTP status %d", status)
+		}
+	}
+	if bc.Timeout.Duration < 0 {
+		c.add(path+".timeout", "must not be negative")
+	}
+}
+
+func (cfg *Config) checkBlackbox(c *checker) {
+	blackboxNames := map[string]bool{}
+	for i, bc := range cfg.Blackbox {
+		path := fmt.Sprintf("blackbox[%d]", i)
+		if bc.URL == "" {
+			c.add(path+".url", "missing url")
+		}
+		name := bc.Name
+		if name == "" {
+			name = bc.URL
+		}
+		if blackboxNames[name] {
+			c.add(path+".name", "duplicate target %q", name)
+		}
+		blackboxNames[name] = true
+		if bc.Interval.Duration <= 0 {
+			c.add(path+".interval", "interval must be positive")
+		}
+		bc.BlackboxConfig.check(c, path)
+	}
+}
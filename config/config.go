@@ -0,0 +1,687 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration wraps time.Duration so durations can be written as "15s" in the config file
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// for YAML files read at runtime, e.g. agent configurations
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// a single remote GET endpoint polled periodically into a gauge
+type PollerConfig struct {
+	// identifies the poller in logs and self-metrics, defaults to the metric name
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+	// processor turning the response into metrics: "value" (default), "nsx-edge",
+	// "nsx-edge-interface", "nsx-firewall", "nsx-segment-ports", "metrics-json",
+	// "prometheus-text" or "graphql"
+	Processor string `json:"processor,omitempty"`
+	// settings of processors beyond the common keys, e.g. of processors loaded from plugins
+	Options json.RawMessage `json:"options,omitempty"`
+	// gauge set by the "value" processor
+	Metric   string            `json:"metric"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Interval Duration          `json:"interval"`
+	// cron expression in local time ("*/15 * * * *", optional leading seconds field, @hourly, @daily, ...),
+	// polls at the matching times instead of every interval
+	Schedule string `json:"schedule,omitempty"`
+
+	// request headers, URL and header values may reference secrets
+	// as ${env:NAME} or ${file:/path/to/secret}
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// authenticate with a vCenter REST API session shared by all pollers of the same vCenter and user
+	VCenter *VCenterConfig `json:"vcenter,omitempty"`
+	// HTTP/2 and connection reuse of poll requests, nil uses the default transport
+	HTTP *HTTPConfig `json:"http,omitempty"`
+	// poll in several dependent requests, e.g. login and per-item details, instead of a single GET of URL
+	Pipeline *PipelineConfig `json:"pipeline,omitempty"`
+	// post a GraphQL query instead of a GET, the processor defaults to "graphql"
+	GraphQL *GraphQLConfig `json:"graphql,omitempty"`
+	// label -> name of the NameResolverConfig replacing the IDs in its values by names
+	ResolveLabels map[string]string `json:"resolveLabels,omitempty"`
+	// reject responses without a valid HMAC signature header
+	Signature *SignatureConfig `json:"signature,omitempty"`
+
+	// responses larger than this are rejected, 0 means default limit
+	MaxBodyBytes int64 `json:"maxBodyBytes,omitempty"`
+	// reject responses containing fields unknown to the processor
+	Strict bool `json:"strict,omitempty"`
+	// status codes and response contents required for a successful poll, nil accepts any 2xx
+	Success *SuccessConfig `json:"success,omitempty"`
+	// re-emit last good values for this many failed polls, flagging the poller as stale
+	StaleIntervals int `json:"staleIntervals,omitempty"`
+	// poll once at startup instead of waiting for the first interval
+	ImmediateFirstPoll bool `json:"immediateFirstPoll,omitempty"`
+	// skip writing gauges whose value did not change since the previous poll,
+	// all values are still rewritten every few polls
+	SkipUnchanged bool `json:"skipUnchanged,omitempty"`
+	// stop polling a failing endpoint for a cooldown, nil polls every interval regardless
+	Breaker *BreakerConfig `json:"breaker,omitempty"`
+	// warn when fields of the JSON responses disappear or change type compared to earlier responses
+	DetectSchemaDrift bool `json:"detectSchemaDrift,omitempty"`
+	// vary the interval with how often the polled values change, nil always polls every interval
+	Adaptive *AdaptiveConfig `json:"adaptive,omitempty"`
+	// poll when metrics are scraped instead of every interval, so nothing is polled while
+	// nobody scrapes; values younger than MaxStaleness (default: the interval) are served as they are
+	ScrapeTriggered bool     `json:"scrapeTriggered,omitempty"`
+	MaxStaleness    Duration `json:"maxStaleness,omitempty"`
+}
+
+// adaptive polling starts at the poller interval, multiplies it by Factor after StableCycles
+// polls without any changed value and divides it by Factor when a poll sees a change,
+// staying within MinInterval and MaxInterval
+type AdaptiveConfig struct {
+	MinInterval Duration `json:"minInterval"`
+	MaxInterval Duration `json:"maxInterval"`
+	// unchanged polls before the interval grows, 0 means default
+	StableCycles int `json:"stableCycles,omitempty"`
+	// 0 means default
+	Factor float64 `json:"factor,omitempty"`
+}
+
+// circuit breaker of a poller: after Failures consecutive failed polls, polls are skipped
+// for Cooldown, then a single trial poll decides whether polling resumes
+type BreakerConfig struct {
+	Failures int      `json:"failures"`
+	Cooldown Duration `json:"cooldown"`
+	// receives a JSON POST whenever the circuit opens or closes, may reference a secret
+	AlertURL string `json:"alertUrl,omitempty"`
+}
+
+type VCenterConfig struct {
+	// base URL of the vCenter, e.g. https://vc01.example.com
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	// may reference a secret, e.g. ${vault:secret/data/vcenter#password}
+	Password string `json:"password"`
+}
+
+// evicts least-recently-updated series when the process grows beyond the limits
+// a zero limit disables the corresponding check
+type MemoryGuardConfig struct {
+	Enabled       bool     `json:"enabled"`
+	MaxHeapBytes  uint64   `json:"maxHeapBytes,omitempty"`
+	MaxRSSBytes   uint64   `json:"maxRSSBytes,omitempty"`
+	CheckInterval Duration `json:"checkInterval"`
+	// number of series evicted per check while over the limit
+	EvictBatch int `json:"evictBatch"`
+}
+
+// optional per-group listen addresses, empty values fall back to Config.ListenAddr
+// groups sharing the same address are served by the same listener
+type ListenConfig struct {
+	Ingest string `json:"ingest,omitempty"` // /push, /event
+	Scrape string `json:"scrape,omitempty"` // /metrics
+	Admin  string `json:"admin,omitempty"`  // /health and admin endpoints
+}
+
+// TLS for all listeners, disabled if CertFile is empty
+type TLSConfig struct {
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// CA bundle verifying client certificates, enables mTLS
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+	// reject connections without a valid client certificate instead of falling back to tokens/IP
+	RequireClientCert bool `json:"requireClientCert,omitempty"`
+	// "cn" (default) or "fingerprint" (SHA-256 of the certificate), used as source "cert:<id>"
+	ClientIdentity string `json:"clientIdentity,omitempty"`
+	// label set to the client identity on pushed series, empty disables
+	SourceLabel string `json:"sourceLabel,omitempty"`
+}
+
+// limits new series per minute and source ("ip:<addr>", "poller:<name>"), 0 disables
+type SeriesQuotaConfig struct {
+	PerMinute int `json:"perMinute,omitempty"`
+	// per-source limits overriding PerMinute
+	Sources map[string]int `json:"sources,omitempty"`
+}
+
+// options for metrics received on /push
+type PushConfig struct {
+	// glob patterns of gauges carrying cumulative totals, exposed as counter plus "<name>_rate" gauge
+	Cumulative []string `json:"cumulative,omitempty"`
+	// how gauges pushed by several sources for the same series are combined, e.g. by HA agents
+	// reporting the same datastore; gauges matching no rule keep the last pushed value
+	GaugeMerge []GaugeMergeRule `json:"gaugeMerge,omitempty"`
+	// endpoint ("/event", "/push", "/push/batch" or "udp") -> labels added to its pushes lacking them,
+	// e.g. {"/event": {"source": "legacy"}} for old agents that can't send labels
+	EndpointLabels map[string]map[string]string `json:"endpointLabels,omitempty"`
+	// reject pushes to /push, /push/batch and /event without a valid HMAC signature header
+	Signature *SignatureConfig `json:"signature,omitempty"`
+}
+
+// PushEvents received as single JSON datagrams, disabled if ListenAddr is empty
+// datagrams are unauthenticated, only the push source inventory and quotas apply,
+// so the listener should be bound to a trusted network
+type UDPConfig struct {
+	ListenAddr string `json:"listenAddr,omitempty"`
+	// longer datagrams are dropped, 0 means default limit
+	MaxDatagramBytes int `json:"maxDatagramBytes,omitempty"`
+	// datagrams bypass auth and push signatures, so the listener refuses to start
+	// while either is configured unless this is set
+	AllowUnauthenticated bool `json:"allowUnauthenticated,omitempty"`
+}
+
+// whether UDP pushes would bypass the auth or push signatures configured for HTTP pushes
+func (cfg *Config) UDPBypassesAuth() bool {
+	authenticated := len(cfg.Auth.Tokens) > 0 || cfg.Auth.OIDC != nil || cfg.Push.Signature != nil
+	return cfg.UDP.ListenAddr != "" && authenticated && !cfg.UDP.AllowUnauthenticated
+}
+
+// rejects pushes with 503 and Retry-After while the collector is saturated
+type BackpressureConfig struct {
+	// concurrent pushes allowed, 0 means unlimited
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+	// also reject pushes while the memory guard is over its limits
+	OnMemoryPressure bool `json:"onMemoryPressure,omitempty"`
+	// suggested client wait, sent as Retry-After
+	RetryAfter Duration `json:"retryAfter"`
+}
+
+// role-based access to the HTTP endpoints, disabled if neither tokens nor OIDC are configured
+type AuthConfig struct {
+	Tokens []TokenConfig `json:"tokens,omitempty"`
+	OIDC   *OIDCConfig   `json:"oidc,omitempty"`
+}
+
+// validates JWT bearer tokens of an OpenID Connect provider, keys are found via
+// <issuer>/.well-known/openid-configuration
+type OIDCConfig struct {
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// allowed clock difference for exp and nbf
+	ClockSkew Duration `json:"clockSkew"`
+
+	// claim used as identity name, defaults to "sub"
+	NameClaim string `json:"nameClaim,omitempty"`
+	// claim holding groups or roles; its values are the collector roles unless RoleMapping is set
+	RolesClaim  string              `json:"rolesClaim,omitempty"`
+	RoleMapping map[string][]string `json:"roleMapping,omitempty"`
+	// claim naming the tenant, tokens of tenants missing in Tenants are rejected
+	TenantClaim string `json:"tenantClaim,omitempty"`
+	// tenant -> metric name prefixes it may push, and the metrics it scrapes on /metrics/tenants/<tenant>;
+	// each tenant needs at least one
+	Tenants map[string][]string `json:"tenants,omitempty"`
+	// label -> claim holding the value globs a token may push for it, e.g. {"project": "projects"},
+	// like TokenConfig.LabelValues; labels are unrestricted for OIDC tokens without it
+	LabelClaims map[string]string `json:"labelClaims,omitempty"`
+}
+
+// a static bearer token and what it may do
+type TokenConfig struct {
+	// identity of the token holder, used as audit actor and quota source "token:<name>"
+	Name string `json:"name"`
+	// may reference a secret, e.g. ${env:PUSH_TOKEN_TEAM_A}
+	Token string `json:"token"`
+	// "reader", "pusher" and/or "admin"
+	Roles []string `json:"roles"`
+	// metric name prefixes a pusher may write, empty allows all
+	PushPrefixes []string `json:"pushPrefixes,omitempty"`
+	// label -> value globs a pusher may write for it, e.g. {"project": ["team-a"]};
+	// pushes without these labels or carrying other values of them are rejected
+	LabelValues map[string][]string `json:"labelValues,omitempty"`
+	// labels added to the token's pushes lacking them, win over push.endpointLabels
+	DefaultLabels map[string]string `json:"defaultLabels,omitempty"`
+}
+
+// append-only log of admin operations, disabled if File is empty
+type AuditConfig struct {
+	File string `json:"file,omitempty"`
+}
+
+// OpenTelemetry trace export, disabled if Endpoint is empty
+type TracingConfig struct {
+	// OTLP/HTTP traces URL, e.g. http://otel-collector:4318/v1/traces
+	Endpoint string `json:"endpoint,omitempty"`
+	// fraction of new traces sampled, 0 means all; traces started by clients follow their sampling decision
+	SampleRatio float64 `json:"sampleRatio,omitempty"`
+}
+
+// HashiCorp Vault used as ${vault:path#field} secret provider, disabled if Address is empty
+type VaultConfig struct {
+	Address string `json:"address,omitempty"`
+	// token may itself be a placeholder, e.g. ${env:VAULT_TOKEN} or ${file:/var/run/secrets/vault-token}
+	Token string `json:"token,omitempty"`
+	// cache time for secrets returned without lease duration
+	DefaultTTL Duration `json:"defaultTTL"`
+}
+
+type Config struct {
+	ListenAddr string       `json:"listenAddr"`
+	Listen     ListenConfig `json:"listen"`
+	TLS        TLSConfig    `json:"tls"`
+	Push       PushConfig   `json:"push"`
+	UDP        UDPConfig    `json:"udp"`
+	// expected push sources, see PushSourcesConfig
+	PushSources  PushSourcesConfig  `json:"pushSources"`
+	Agents       AgentsConfig       `json:"agents"`
+	Backpressure BackpressureConfig `json:"backpressure"`
+	// per-endpoint request limits keyed by path, e.g. "/push/batch"
+	Limits map[string]EndpointLimitConfig `json:"limits,omitempty"`
+	// filtered scrape paths served next to /metrics on the scrape listener
+	ScrapeEndpoints []ScrapeEndpointConfig `json:"scrapeEndpoints,omitempty"`
+
+	CheckpointFile     string   `json:"checkpointFile"`
+	CheckpointInterval Duration `json:"checkpointInterval"`
+	// per-metric checkpoint policies, metrics matching no rule are persistent
+	Persistence []PersistenceRule `json:"persistence,omitempty"`
+	// counters tracked exactly or scaled down beyond float64 precision
+	CounterPrecision []CounterPrecisionRule `json:"counterPrecision,omitempty"`
+	// series not updated within this time are removed from /metrics and checkpoint, 0 disables
+	SeriesTTL Duration `json:"seriesTTL"`
+	// expose "<counter>_restored" with the baseline of counters restored from checkpoint
+	RestoreMarkers bool `json:"restoreMarkers,omitempty"`
+	// blocking or lazy restore of the checkpoint at startup
+	Restore RestoreConfig `json:"restore"`
+	// handling of updates whose type or label names differ from the existing metric:
+	// "reject" (default) drops them and rejects pushes with 409, "remap" records them as "<name>_v2", ...
+	MetricConflicts string `json:"metricConflicts,omitempty"`
+	// glob patterns of metrics exposing "<name>_age_seconds" per series, "*" for all
+	Freshness []string `json:"freshness,omitempty"`
+
+	Pollers     []PollerConfig     `json:"pollers"`
+	SnmpPollers []SnmpPollerConfig `json:"snmpPollers,omitempty"`
+	SnmpTraps   SnmpTrapConfig     `json:"snmpTraps"`
+	Syslog      SyslogConfig       `json:"syslog"`
+	Discovery   []DiscoveryConfig  `json:"discovery,omitempty"`
+	// lookups of names of IDs in label values, see PollerConfig.ResolveLabels
+	NameResolvers []NameResolverConfig `json:"nameResolvers,omitempty"`
+	// local log files turned into counters
+	Tails []TailConfig `json:"tail,omitempty"`
+	// external commands printing metrics, the escape hatch for sources without a processor
+	Execs []ExecConfig `json:"exec,omitempty"`
+	// synthetic metrics instead of or in addition to real sources, also enabled by -simulate
+	Simulator *SimulatorConfig `json:"simulator,omitempty"`
+	// emailed summary of key metrics, disabled if nil
+	Report *ReportConfig `json:"report,omitempty"`
+	// Go plugins (.so, built with -buildmode=plugin against the same collector version)
+	// registering processors and sinks, loaded before pollers are created
+	Plugins []string `json:"plugins,omitempty"`
+	// additional sinks receiving every metric update, by the names plugins registered them under
+	Sinks []SinkConfig `json:"sinks,omitempty"`
+	// middleware all metric updates pass before reaching the sinks, the first one sees them first
+	Interceptors []InterceptorConfig `json:"interceptors,omitempty"`
+	// units of metrics from all sources, the first matching rule applies
+	Units []UnitRule `json:"units,omitempty"`
+	// identity labels of *_info metrics not declared by their source, the first matching rule applies
+	InfoMetrics []InfoMetricRule `json:"infoMetrics,omitempty"`
+	// naming convention checks of incoming metrics
+	Lint LintConfig `json:"lint"`
+	// rolling hourly/daily totals of counters, computed in the collector
+	CounterWindows []CounterWindowConfig `json:"counterWindows,omitempty"`
+	// planned downtimes of polled endpoints
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+	// events served to Grafana as annotations
+	Annotations AnnotationsConfig `json:"annotations"`
+	// modules of the /probe endpoint by name
+	ProbeModules map[string]ProbeModuleConfig `json:"probeModules,omitempty"`
+	// endpoints whose availability is probed periodically
+	Blackbox []BlackboxTargetConfig `json:"blackbox,omitempty"`
+	// poll only a share of the pollers, see ShardConfig
+	Shard ShardConfig `json:"shard"`
+	// delay the first poll of each poller by a fixed, name-derived part of its interval
+	// so restarts do not send all requests at once
+	StaggerPollers bool `json:"staggerPollers,omitempty"`
+	// polls at startup and gating of scrapes until they completed
+	Warmup WarmupConfig `json:"warmup"`
+	// interval of keepalive requests for shared vCenter sessions
+	SessionKeepalive Duration `json:"sessionKeepalive"`
+	// keeps pollers of the same host, e.g. a vCenter, within a shared request budget
+	HostRateLimit HostRateLimitConfig `json:"hostRateLimit"`
+
+	MemoryGuard MemoryGuardConfig `json:"memoryGuard"`
+	// label strings shared by series instead of held by each of them
+	LabelInterning LabelInterningConfig `json:"labelInterning"`
+	Log            LogConfig            `json:"log"`
+	Debug          DebugConfig          `json:"debug"`
+	Audit          AuditConfig          `json:"audit"`
+	Auth           AuthConfig           `json:"auth"`
+	Vault          VaultConfig          `json:"vault"`
+	Tracing        TracingConfig        `json:"tracing"`
+	SeriesQuota    SeriesQuotaConfig    `json:"seriesQuota"`
+	Histograms     []HistogramSchema    `json:"histograms,omitempty"`
+	Summaries      []SummarySchema      `json:"summaries,omitempty"`
+}
+
+// defaults of the values missing from the config file; lists stay empty, since a file's
+// list would be decoded into the default elements and inherit their fields
+func Default() *Config {
+	return &Config{
+		ListenAddr:         DEFAULT_LISTEN_ADDR,
+		CheckpointFile:     DEFAULT_CHECKPOINT_FILE,
+		CheckpointInterval: Duration{DEFAULT_CHECKPOINT_INTERVAL_SEC * time.Second},
+		MemoryGuard: MemoryGuardConfig{
+			CheckInterval: Duration{DEFAULT_MEMORY_CHECK_INTERVAL_SEC * time.Second},
+			EvictBatch:    DEFAULT_MEMORY_EVICT_BATCH,
+		},
+		Vault: VaultConfig{
+			DefaultTTL: Duration{DEFAULT_VAULT_TTL_SEC * time.Second},
+		},
+		SessionKeepalive: Duration{DEFAULT_SESSION_KEEPALIVE_SEC * time.Second},
+		PushSources: PushSourcesConfig{
+			RefreshInterval: Duration{DEFAULT_PUSH_SOURCES_REFRESH_SEC * time.Second},
+		},
+		Agents: AgentsConfig{
+			CheckInterval: Duration{DEFAULT_AGENT_CHECK_INTERVAL_SEC * time.Second},
+			MissedPushes:  DEFAULT_AGENT_MISSED_PUSHES,
+		},
+		LabelInterning: LabelInterningConfig{
+			MaxStrings: DEFAULT_INTERN_MAX_STRINGS,
+		},
+		Restore: RestoreConfig{
+			Mode:       RESTORE_BLOCKING,
+			BatchSize:  DEFAULT_RESTORE_BATCH_SIZE,
+			BatchPause: Duration{DEFAULT_RESTORE_BATCH_PAUSE_MS * time.Millisecond},
+		},
+		Annotations: AnnotationsConfig{
+			MaxEvents: DEFAULT_ANNOTATIONS_MAX_EVENTS,
+			Retention: Duration{DEFAULT_ANNOTATIONS_RETENTION_HOURS * time.Hour},
+		},
+		Backpressure: BackpressureConfig{
+			RetryAfter: Duration{DEFAULT_RETRY_AFTER_SEC * time.Second},
+		},
+		Log: LogConfig{
+			DedupWindow: Duration{DEFAULT_LOG_DEDUP_WINDOW_SEC * time.Second},
+		},
+	}
+}
+
+// pollers of the fake API used when no config file is given
+func samplePollers() []PollerConfig {
+	return []PollerConfig{
+		{URL: "http://localhost:5000/gauge1", Metric: "external_gauge_1", Labels: map[string]string{"source": "fake-api"}, Interval: Duration{15 * time.Second}},
+		{URL: "http://localhost:5000/gauge2", Metric: "external_gauge_2", Labels: map[string]string{"source": "fake-api"}, Interval: Duration{20 * time.Second}},
+	}
+}
+
+func (cfg *Config) IngestAddr() string {
+	return orDefault(cfg.Listen.Ingest, cfg.ListenAddr)
+}
+
+func (cfg *Config) ScrapeAddr() string {
+	return orDefault(cfg.Listen.Scrape, cfg.ListenAddr)
+}
+
+func (cfg *Config) AdminAddr() string {
+	return orDefault(cfg.Listen.Admin, cfg.ListenAddr)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// reads JSON config file on top of the defaults, keys missing from the file keep default values
+// COLLECTOR_* environment variables override values from the file, see ApplyEnv
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		cfg.Pollers = samplePollers()
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		if err := json.NewDecoder(file).Decode(cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := ApplyEnv(cfg); err != nil {
+		return nil, fmt.Errorf("invalid environment override: %w", err)
+	}
+	return cfg, nil
+}
+
+// checks the parts shared by pollers, discovered pollers and probe modules
+func (pc PollerConfig) checkRequests(c *checker, path string) {
+	pc.Signature.check(c, path+".signature")
+	pc.HTTP.check(c, path+".http")
+	pc.Success.check(c, path+".success")
+	pc.Pipeline.check(c, path+".pipeline")
+	pc.checkGraphQL(c, path+".graphql")
+	c.resolveLabels(path+".resolveLabels", pc.ResolveLabels)
+}
+
+func (cfg *Config) checkPollers(c *checker) {
+	for i, pc := range cfg.Pollers {
+		path := fmt.Sprintf("pollers[%d]", i)
+		if pc.URL == "" {
+			c.add(path+".url", "missing url")
+		}
+		if (pc.Processor == "" || pc.Processor == "value") && pc.GraphQL == nil && pc.Metric == "" {
+			c.add(path+".metric", "missing metric name")
+		}
+		if pc.Interval.Duration <= 0 && pc.Schedule == "" && (!pc.ScrapeTriggered || pc.MaxStaleness.Duration <= 0) {
+			c.add(path+".interval", "interval must be positive")
+		}
+		if pc.ScrapeTriggered && (pc.Schedule != "" || pc.Adaptive != nil) {
+			c.add(path+".scrapeTriggered", "cannot be combined with a schedule or adaptive polling")
+		}
+		if pc.MaxStaleness.Duration < 0 {
+			c.add(path+".maxStaleness", "must not be negative")
+		}
+		// unchanged gauges are only rewritten every few polls, expiry must not drop them in between;
+		// one more interval leaves room for the poll itself
+		interval := pc.Interval.Duration
+		if pc.Adaptive != nil {
+			interval = max(interval, pc.Adaptive.MaxInterval.Duration)
+		}
+		if refresh := (SKIP_UNCHANGED_REFRESH_POLLS + 1) * interval; pc.SkipUnchanged && cfg.SeriesTTL.Duration > 0 && cfg.SeriesTTL.Duration < refresh {
+			c.add(path+".skipUnchanged", "unchanged gauges would expire between rewrites, seriesTTL must be at least %v", refresh)
+		}
+		name := pc.Name
+		if name == "" {
+			name = pc.Metric
+		}
+		c.pollerName(name, path+".name")
+		if pc.VCenter != nil {
+			if pc.VCenter.URL == "" {
+				c.add(path+".vcenter.url", "missing vcenter url")
+			}
+			if pc.VCenter.Username == "" || pc.VCenter.Password == "" {
+				c.add(path+".vcenter", "missing vcenter username or password")
+			}
+		}
+		pc.checkRequests(c, path)
+		if pc.Breaker != nil {
+			if pc.Breaker.Failures <= 0 {
+				c.add(path+".breaker.failures", "must be positive")
+			}
+			if pc.Breaker.Cooldown.Duration <= 0 {
+				c.add(path+".breaker.cooldown", "must be positive")
+			}
+		}
+		if pc.Adaptive != nil {
+			if pc.Schedule != "" {
+				c.add(path+".adaptive", "cannot be combined with a schedule")
+			}
+			if pc.Adaptive.MinInterval.Duration <= 0 {
+				c.add(path+".adaptive.minInterval", "must be positive")
+			}
+			if pc.Adaptive.MaxInterval.Duration < pc.Adaptive.MinInterval.Duration {
+				c.add(path+".adaptive.maxInterval", "must not be below minInterval")
+			}
+			if pc.Adaptive.StableCycles < 0 {
+				c.add(path+".adaptive.stableCycles", "must not be negative")
+			}
+			if pc.Adaptive.Factor != 0 && pc.Adaptive.Factor <= 1 {
+				c.add(path+".adaptive.factor", "must be greater than 1")
+			}
+		}
+	}
+}
+
+func (cfg *Config) checkPush(c *checker) {
+	cfg.Push.Signature.check(c, "push.signature")
+
+	for endpoint, labels := range cfg.Push.EndpointLabels {
+		path := "push.endpointLabels." + endpoint
+		switch endpoint {
+		case "/event", "/push", "/push/batch", "udp":
+		default:
+			c.add(path, "unknown endpoint (use \"/event\", \"/push\", \"/push/batch\" or \"udp\")")
+		}
+		for name := range labels {
+			if !util.ValidLabelName(name) {
+				c.add(path, "invalid label name %q", name)
+			}
+		}
+	}
+}
+
+func (cfg *Config) checkTLS(c *checker) {
+	if cfg.TLS.CertFile == "" && (cfg.TLS.KeyFile != "" || cfg.TLS.ClientCAFile != "") {
+		c.add("tls.certFile", "missing certFile")
+	}
+	if cfg.TLS.CertFile != "" && cfg.TLS.KeyFile == "" {
+		c.add("tls.keyFile", "missing keyFile")
+	}
+	if cfg.TLS.ClientCAFile == "" && (cfg.TLS.RequireClientCert || cfg.TLS.SourceLabel != "") {
+		c.add("tls.clientCAFile", "client certificates require clientCAFile")
+	}
+	if id := cfg.TLS.ClientIdentity; id != "" && id != "cn" && id != "fingerprint" {
+		c.add("tls.clientIdentity", "unknown client identity %q (use \"cn\" or \"fingerprint\")", id)
+	}
+}
+
+func (cfg *Config) checkAuth(c *checker) {
+	tokenNames := map[string]bool{}
+	for i, tc := range cfg.Auth.Tokens {
+		path := fmt.Sprintf("auth.tokens[%d]", i)
+		if tc.Name == "" {
+			c.add(path+".name", "missing name")
+		} else if tokenNames[tc.Name] {
+			c.add(path+".name", "duplicate token name %q", tc.Name)
+		}
+		tokenNames[tc.Name] = true
+		if tc.Token == "" {
+			c.add(path+".token", "missing token")
+		}
+		if len(tc.Roles) == 0 {
+			c.add(path+".roles", "missing roles")
+		}
+		for j, role := range tc.Roles {
+			if role != "reader" && role != "pusher" && role != "admin" {
+				c.add(fmt.Sprintf("%s.roles[%d]", path, j), "unknown role %q (use \"reader\", \"pusher\" or \"admin\")", role)
+			}
+		}
+		for name := range tc.DefaultLabels {
+			if !util.ValidLabelName(name) {
+				c.add(path+".defaultLabels", "invalid label name %q", name)
+			}
+		}
+	}
+
+	if oidc := cfg.Auth.OIDC; oidc != nil {
+		if oidc.Issuer == "" {
+			c.add("auth.oidc.issuer", "missing issuer")
+		}
+		if oidc.Audience == "" {
+			c.add("auth.oidc.audience", "missing audience")
+		}
+		if oidc.RolesClaim == "" {
+			c.add("auth.oidc.rolesClaim", "missing rolesClaim, tokens would have no roles")
+		}
+		if oidc.TenantClaim != "" && len(oidc.Tenants) == 0 {
+			c.add("auth.oidc.tenants", "tenantClaim is set but no tenants are configured")
+		}
+		for tenant, prefixes := range oidc.Tenants {
+			// a tenant without prefixes would push and scrape the metrics of all tenants
+			if len(prefixes) == 0 {
+				c.add("auth.oidc.tenants."+tenant, "needs at least one metric name prefix")
+			}
+			if slices.Contains(prefixes, "") {
+				c.add("auth.oidc.tenants."+tenant, "empty prefix would match all metrics")
+			}
+		}
+		for label, claim := range oidc.LabelClaims {
+			if !util.ValidLabelName(label) {
+				c.add("auth.oidc.labelClaims", "invalid label name %q", label)
+			}
+			if claim == "" {
+				c.add("auth.oidc.labelClaims."+label, "missing claim")
+			}
+		}
+	}
+}
+
+func (cfg *Config) checkBackpressure(c *checker) {
+	if cfg.Backpressure.MaxInFlight < 0 {
+		c.add("backpressure.maxInFlight", "must not be negative")
+	}
+	if cfg.Backpressure.OnMemoryPressure && !cfg.MemoryGuard.Enabled {
+		c.add("backpressure.onMemoryPressure", "requires memoryGuard.enabled")
+	}
+}
+
+func (cfg *Config) checkUDP(c *checker) {
+	if cfg.UDP.MaxDatagramBytes < 0 || cfg.UDP.MaxDatagramBytes > MAX_UDP_DATAGRAM_BYTES {
+		c.add("udp.maxDatagramBytes", "must be between 0 and %d", MAX_UDP_DATAGRAM_BYTES)
+	}
+	if cfg.UDPBypassesAuth() {
+		c.add("udp.allowUnauthenticated", "UDP pushes bypass auth and push signatures, set to true to accept them anyway")
+	}
+}
+
+func (cfg *Config) checkMemoryGuard(c *checker) {
+	if cfg.MemoryGuard.Enabled {
+		if cfg.MemoryGuard.MaxHeapBytes == 0 && cfg.MemoryGuard.MaxRSSBytes == 0 {
+			c.add("memoryGuard", "enabled without maxHeapBytes or maxRSSBytes")
+		}
+		if cfg.MemoryGuard.CheckInterval.Duration <= 0 {
+			c.add("memoryGuard.checkInterval", "must be positive")
+		}
+	}
+}
+
+func (cfg *Config) checkVault(c *checker) {
+	if cfg.Vault.Address != "" && cfg.Vault.Token == "" {
+		c.add("vault.token", "missing vault token")
+	}
+}
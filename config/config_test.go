@@ -0,0 +1,24 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadedPollersInheritNoSampleFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"pollers": [{"url": "http://vcenter", "metric": "vm_count", "interval": "1m"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Pollers) != 1 || len(cfg.Pollers[0].Labels) != 0 {
+		t.Fatalf("pollers %+v, expected only the one from the file without labels", cfg.Pollers)
+	}
+	if cfg, err = Load(""); err != nil || len(cfg.Pollers) != 2 {
+		t.Fatalf("config without file has pollers %+v, %v, expected the samples", cfg.Pollers, err)
+	}
+}
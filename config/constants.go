@@ -0,0 +1,64 @@
+package config
+
+const DEFAULT_LISTEN_ADDR = ":8080"
+const DEFAULT_CHECKPOINT_FILE = "metrics_checkpoint.json"
+const DEFAULT_CHECKPOINT_INTERVAL_SEC = 60
+
+const DEFAULT_MEMORY_CHECK_INTERVAL_SEC = 30
+const DEFAULT_MEMORY_EVICT_BATCH = 100
+
+const DEFAULT_VAULT_TTL_SEC = 300
+const DEFAULT_SESSION_KEEPALIVE_SEC = 300
+
+const DEFAULT_PUSH_SOURCES_REFRESH_SEC = 30
+
+const DEFAULT_AGENT_CHECK_INTERVAL_SEC = 15
+const DEFAULT_AGENT_MISSED_PUSHES = 3
+
+const DEFAULT_ANNOTATIONS_MAX_EVENTS = 10000
+const DEFAULT_ANNOTATIONS_RETENTION_HOURS = 24 * 30
+
+const DEFAULT_RETRY_AFTER_SEC = 5
+
+const DEFAULT_LOG_DEDUP_WINDOW_SEC = 300
+
+// pollers with skipUnchanged rewrite unchanged gauges once per this many polls
+const SKIP_UNCHANGED_REFRESH_POLLS = 10
+
+const DEFAULT_MAX_BODY_BYTES = 1 << 20
+const DEFAULT_BATCH_MAX_BODY_BYTES = 8 << 20
+const DEFAULT_DECODE_TIMEOUT_SEC = 10
+
+// largest UDP payload over IPv4
+const MAX_UDP_DATAGRAM_BYTES = 65507
+
+// shortest counter window, windows are tracked in 1/60 steps
+const MIN_COUNTER_WINDOW_SEC = 60
+
+// persistence policies of metrics, see PersistenceRule
+const PERSISTENCE_EPHEMERAL = "ephemeral"
+const PERSISTENCE_PERSISTENT = "persistent"
+const PERSISTENCE_DURABLE = "durable"
+
+// representations of large counters, see CounterPrecisionRule
+const PRECISION_SPLIT = "split"
+const PRECISION_SCALE = "scale"
+
+// gauge merge policies, see GaugeMergeRule
+const MERGE_LAST = "last"
+const MERGE_MAX = "max"
+const MERGE_MIN = "min"
+const MERGE_SUM = "sum"
+
+// actions of maintenance windows, see MaintenanceWindow
+const MAINTENANCE_FLAG = "flag"
+const MAINTENANCE_SUPPRESS = "suppress"
+
+// checkpoint restore modes, see RestoreConfig
+const RESTORE_BLOCKING = "blocking"
+const RESTORE_LAZY = "lazy"
+
+const DEFAULT_RESTORE_BATCH_SIZE = 1000
+const DEFAULT_RESTORE_BATCH_PAUSE_MS = 10
+
+const DEFAULT_INTERN_MAX_STRINGS = 1 << 20
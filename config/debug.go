@@ -0,0 +1,14 @@
+package config
+
+// keeps the last response of every poller for GET /debug/pollers/{name}/last-response
+type DebugConfig struct {
+	LastResponses bool `json:"lastResponses,omitempty"`
+	// bytes of each response body kept, 0 means default
+	MaxBodyBytes int `json:"maxBodyBytes,omitempty"`
+}
+
+func (cfg *Config) checkDebug(c *checker) {
+	if cfg.Debug.MaxBodyBytes < 0 {
+		c.add("debug.maxBodyBytes", "must not be negative")
+	}
+}
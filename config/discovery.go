@@ -0,0 +1,70 @@
+package config
+
+import "fmt"
+
+// periodically lists inventory entities (datastores, clusters, Aria projects)
+// or service instances and runs one poller per entity, created from Poller with
+// {{id}}, {{name}}, {{host}}, {{port}} and {{address}} placeholders replaced
+// in its name, url, headers and label values
+type DiscoveryConfig struct {
+	Name string `json:"name"`
+	// "inventory" (default), "consul", "etcd" or "dns-srv"
+	Type string `json:"type,omitempty"`
+	// inventory list endpoint, e.g. https://vc01/api/vcenter/datastore,
+	// or Consul / etcd base URL, e.g. http://consul:8500
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	VCenter  *VCenterConfig    `json:"vcenter,omitempty"`
+	Interval Duration          `json:"interval"`
+
+	// field holding the entity list if the response is an object, e.g. "content" for Aria
+	ItemsField string `json:"itemsField,omitempty"`
+	// fields of an entity used as {{id}} and {{name}}, e.g. "datastore" and "name"
+	IDField   string `json:"idField"`
+	NameField string `json:"nameField,omitempty"`
+
+	// Consul service name, etcd key prefix or SRV record name, e.g. _metrics._tcp.example.com
+	Service string `json:"service,omitempty"`
+	// only Consul instances with this tag
+	Tag string `json:"tag,omitempty"`
+
+	Poller PollerConfig `json:"poller"`
+}
+
+func (cfg *Config) checkDiscovery(c *checker) {
+	for i, dc := range cfg.Discovery {
+		path := fmt.Sprintf("discovery[%d]", i)
+		switch dc.Type {
+		case "", "inventory":
+			if dc.URL == "" {
+				c.add(path+".url", "missing url")
+			}
+			if dc.IDField == "" {
+				c.add(path+".idField", "missing idField")
+			}
+		case "consul", "etcd":
+			if dc.URL == "" {
+				c.add(path+".url", "missing url")
+			}
+			if dc.Service == "" {
+				c.add(path+".service", "missing service")
+			}
+		case "dns-srv":
+			if dc.Service == "" {
+				c.add(path+".service", "missing service")
+			}
+		default:
+			c.add(path+".type", "unknown discovery type %q (use \"inventory\", \"consul\", \"etcd\" or \"dns-srv\")", dc.Type)
+		}
+		if dc.Interval.Duration <= 0 {
+			c.add(path+".interval", "interval must be positive")
+		}
+		if dc.Poller.Interval.Duration <= 0 && dc.Poller.Schedule == "" {
+			c.add(path+".poller.interval", "interval must be positive")
+		}
+		dc.Poller.checkRequests(c, path+".poller")
+		if !containsAny(dc.Poller.Name+dc.Poller.URL, "{{id}}", "{{name}}", "{{address}}", "{{host}}") {
+			c.add(path+".poller", "poller name or url must contain {{id}}, {{name}}, {{address}} or {{host}} to tell entities apart")
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// prefix of environment variables overriding config keys
+const ENV_PREFIX = "COLLECTOR"
+
+// ApplyEnv overrides config values from environment variables named after the JSON key path:
+//
+//	COLLECTOR_LISTEN_ADDR=:9090
+//	COLLECTOR_POLLERS_0_URL=http://vc01/api/...     (index past the end appends a poller)
+//	COLLECTOR_MEMORY_GUARD_MAX_HEAP_BYTES=500000000
+//	COLLECTOR_POLLERS_0_LABELS_source=vc01          (sets one map entry, the rest of the name is its key)
+//
+// objects, arrays and maps can also be replaced as a whole with a JSON value,
+// e.g. COLLECTOR_POLLERS_0_LABELS='{"source":"vc01"}'; indexes past the end must follow
+// each other, so a typo can't grow a list by millions of empty entries
+func ApplyEnv(cfg *Config) error {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok && strings.HasPrefix(key, ENV_PREFIX+"_") {
+			env[key] = value
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return applyEnv(reflect.ValueOf(cfg).Elem(), ENV_PREFIX, env)
+}
+
+func applyEnv(v reflect.Value, name string, env map[string]string) error {
+	// whole value given as a single variable
+	if raw, ok := env[name]; ok && name != ENV_PREFIX {
+		if err := setFromString(v, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+	if !hasPrefix(env, name+"_") {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return applyEnv(v.Elem(), name, env)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			key := jsonName(v.Type().Field(i))
+			if key == "" {
+				continue
+			}
+			if err := applyEnv(v.Field(i), name+"_"+envName(key), env); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for key, raw := range env {
+			entry, ok := strings.CutPrefix(key, name+"_")
+			if !ok {
+				continue
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := setFromString(value, raw); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(reflect.ValueOf(entry).Convert(v.Type().Key()), value)
+		}
+	case reflect.Slice:
+		// grow the slice up to the highest index referenced in the environment
+		maxIndex := v.Len() - 1
+		appended := make(map[int]bool)
+		for key := range env {
+			rest, ok := strings.CutPrefix(key, name+"_")
+			if !ok {
+				continue
+			}
+			indexStr, _, _ := strings.Cut(rest, "_")
+			index, err := strconv.Atoi(indexStr)
+			if err != nil || index < v.Len() {
+				continue
+			}
+			appended[index] = true
+			maxIndex = max(maxIndex, index)
+		}
+		for index := v.Len(); index <= maxIndex; index++ {
+			if !appended[index] {
+				return fmt.Errorf("%s_%d: index past the end skips index %d, list has %d entries", name, maxIndex, index, v.Len())
+			}
+		}
+		if maxIndex >= v.Len() {
+			grown := reflect.MakeSlice(v.Type(), maxIndex+1, maxIndex+1)
+			reflect.Copy(grown, v)
+			v.Set(grown)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := applyEnv(v.Index(i), fmt.Sprintf("%s_%d", name, i), env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parses an environment value into v according to its type
+func setFromString(v reflect.Value, raw string) error {
+	if reflect.PointerTo(v.Type()).Implements(unmarshalerType) {
+		quoted, _ := json.Marshal(raw)
+		return v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(quoted)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(parsed)
+	default:
+		// objects, arrays, maps as JSON, replacing the current value
+		v.Set(reflect.Zero(v.Type()))
+		return json.Unmarshal([]byte(raw), v.Addr().Interface())
+	}
+	return nil
+}
+
+func hasPrefix(env map[string]string, prefix string) bool {
+	for key := range env {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// converts a camelCase JSON key into UPPER_SNAKE_CASE: maxRSSBytes -> MAX_RSS_BYTES
+func envName(jsonName string) string {
+	runes := []rune(jsonName)
+	var sb strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				sb.WriteRune('_')
+			}
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
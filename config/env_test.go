@@ -0,0 +1,36 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvSetsMapEntries(t *testing.T) {
+	t.Setenv("COLLECTOR_POLLERS_0_LABELS_source", "vc01")
+	t.Setenv("COLLECTOR_SERIES_QUOTA_SOURCES_poller:vc01", "50")
+	cfg := &Config{Pollers: []PollerConfig{{Labels: map[string]string{"site": "a"}}}}
+	if err := ApplyEnv(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if labels := cfg.Pollers[0].Labels; labels["source"] != "vc01" || labels["site"] != "a" {
+		t.Fatalf("labels %v, expected source=vc01 added to site=a", labels)
+	}
+	if limit := cfg.SeriesQuota.Sources["poller:vc01"]; limit != 50 {
+		t.Fatalf("quota of poller:vc01 %d, expected 50", limit)
+	}
+}
+
+func TestApplyEnvRejectsIndexGaps(t *testing.T) {
+	t.Setenv("COLLECTOR_POLLERS_0_URL", "http://vc01")
+	t.Setenv("COLLECTOR_POLLERS_1_URL", "http://vc02")
+	cfg := &Config{}
+	if err := ApplyEnv(cfg); err != nil || len(cfg.Pollers) != 2 {
+		t.Fatalf("appending two pollers returned %v with %d pollers", err, len(cfg.Pollers))
+	}
+
+	t.Setenv("COLLECTOR_POLLERS_999999999_URL", "http://typo")
+	err := ApplyEnv(&Config{})
+	if err == nil || !strings.Contains(err.Error(), "skips index 2") {
+		t.Fatalf("index far past the end returned %v, expected a gap error", err)
+	}
+}
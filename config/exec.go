@@ -0,0 +1,52 @@
+package config
+
+import "fmt"
+
+// runs a command on a schedule and records the metrics it prints to stdout
+type ExecConfig struct {
+	Name string `json:"name"`
+	// program and arguments, run without a shell; arguments may reference secrets
+	Command []string `json:"command"`
+	// extra environment variables, values may reference secrets
+	Env      map[string]string `json:"env,omitempty"`
+	Interval Duration          `json:"interval"`
+	// cron expression used instead of interval, see PollerConfig.Schedule
+	Schedule string `json:"schedule,omitempty"`
+	// stdout format: "json" (default, {"metrics": [{"name", "type", "value", "labels"}]})
+	// or "prometheus" (text exposition format); counters are printed as totals
+	Format string `json:"format,omitempty"`
+	// added to every metric of the command
+	Labels map[string]string `json:"labels,omitempty"`
+	// the command is killed after this long, 0 means default
+	Timeout Duration `json:"timeout"`
+	// runs printing more are killed and count as failed, 0 means default
+	MaxOutputBytes int64 `json:"maxOutputBytes,omitempty"`
+	// run once at startup instead of waiting for the first interval
+	ImmediateFirstPoll bool `json:"immediateFirstPoll,omitempty"`
+}
+
+func (cfg *Config) checkExecs(c *checker) {
+	for i, ec := range cfg.Execs {
+		path := fmt.Sprintf("exec[%d]", i)
+		if ec.Name == "" {
+			c.add(path+".name", "missing name")
+		} else {
+			c.pollerName(ec.Name, path+".name")
+		}
+		if len(ec.Command) == 0 || ec.Command[0] == "" {
+			c.add(path+".command", "missing command")
+		}
+		if ec.Interval.Duration <= 0 && ec.Schedule == "" {
+			c.add(path+".interval", "interval must be positive")
+		}
+		if ec.Format != "" && ec.Format != "json" && ec.Format != "prometheus" {
+			c.add(path+".format", "unknown format %q (use \"json\" or \"prometheus\")", ec.Format)
+		}
+		if ec.Timeout.Duration < 0 {
+			c.add(path+".timeout", "must not be negative")
+		}
+		if ec.MaxOutputBytes < 0 {
+			c.add(path+".maxOutputBytes", "must not be negative")
+		}
+	}
+}
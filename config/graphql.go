@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// GraphQL query of a poller, posted to its URL as {"query": ..., "variables": ...};
+// fields of the response data are mapped to metrics
+type GraphQLConfig struct {
+	Query string `json:"query"`
+	// string values may reference secrets like the poller headers
+	Variables map[string]any `json:"variables,omitempty"`
+	// operation to run of a query document defining several
+	OperationName string          `json:"operationName,omitempty"`
+	Metrics       []GraphQLMetric `json:"metrics"`
+}
+
+// gauge or counter read from the response data:
+//
+//	{"name": "platform_cluster_cpu_usage_ratio", "forEach": "clusters", "value": "cpu.usage", "labels": {"cluster": "name"}}
+type GraphQLMetric struct {
+	Name string `json:"name"`
+	// "gauge" (default) or "counter", counter fields hold totals
+	Type string `json:"type,omitempty"`
+	// dotted path of an array below data, the metric gets a series per element
+	ForEach string `json:"forEach,omitempty"`
+	// dotted path of a number or boolean, relative to the element with ForEach
+	Value string `json:"value"`
+	// label -> dotted path of its value, relative to the element with ForEach
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// checks the graphql section of a poller, it depends on the processor and pipeline of the poller
+func (pc PollerConfig) checkGraphQL(c *checker, path string) {
+	gc := pc.GraphQL
+	if gc == nil {
+		return
+	}
+	if pc.Pipeline != nil {
+		c.add(path, "cannot be combined with a pipeline")
+	}
+	if gc.Query == "" {
+		c.add(path+".query", "missing query")
+	}
+	if len(gc.Metrics) == 0 && (pc.Processor == "" || pc.Processor == "graphql") {
+		c.add(path+".metrics", "missing metrics")
+	}
+	for j, m := range gc.Metrics {
+		metricPath := fmt.Sprintf("%s.metrics[%d]", path, j)
+		if !util.ValidLabelName(m.Name) {
+			c.add(metricPath+".name", "invalid metric name %q", m.Name)
+		}
+		if m.Value == "" {
+			c.add(metricPath+".value", "missing value path")
+		}
+		switch m.Type {
+		case "", "gauge", "counter":
+		default:
+			c.add(metricPath+".type", "unknown type %q (use \"gauge\" or \"counter\")", m.Type)
+		}
+		for label := range m.Labels {
+			if !util.ValidLabelName(label) {
+				c.add(metricPath+".labels", "invalid label name %q", label)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+// bucket layout for histograms whose name matches Match,
+// the first matching schema wins, unmatched histograms use Prometheus default buckets
+type HistogramSchema struct {
+	// glob pattern matched against metric name, e.g. "*_seconds" or "vsphere_datastore_*"
+	Match string `json:"match"`
+	// classic buckets, omitted means default buckets unless Native is set
+	Buckets *BucketsConfig `json:"buckets,omitempty"`
+	// native (sparse) histogram, can be combined with classic buckets
+	Native *NativeHistogramConfig `json:"native,omitempty"`
+}
+
+type BucketsConfig struct {
+	Type string `json:"type"` // "linear", "exponential" or "explicit"
+
+	// linear: Start, Width, Count; exponential: Start, Factor, Count
+	Start  float64 `json:"start,omitempty"`
+	Width  float64 `json:"width,omitempty"`
+	Factor float64 `json:"factor,omitempty"`
+	Count  int     `json:"count,omitempty"`
+
+	// explicit: upper bounds in increasing order
+	Values []float64 `json:"values,omitempty"`
+}
+
+type NativeHistogramConfig struct {
+	// growth factor between consecutive buckets, must be > 1 (e.g. 1.1)
+	BucketFactor float64 `json:"bucketFactor"`
+	// bucket count limit, buckets are merged when exceeded, 0 means unlimited
+	MaxBuckets uint32 `json:"maxBuckets,omitempty"`
+	// minimum time between resets when MaxBuckets is exceeded
+	MinResetDuration Duration `json:"minResetDuration"`
+}
@@ -0,0 +1,26 @@
+package config
+
+// connection settings of poll requests, pollers with the same settings share their connections
+type HTTPConfig struct {
+	// HTTP/2 is negotiated with HTTPS targets offering it unless disabled,
+	// e.g. for load balancers in front of vCenter mishandling it
+	DisableHTTP2 bool `json:"disableHTTP2,omitempty"`
+	// close connections after each request instead of reusing them
+	DisableKeepAlives bool `json:"disableKeepAlives,omitempty"`
+	// idle connections kept per host, 0 means default (2)
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+	// idle connections are closed after this, 0 means default (90s)
+	IdleConnTimeout Duration `json:"idleConnTimeout,omitempty"`
+}
+
+func (hc *HTTPConfig) check(c *checker, path string) {
+	if hc == nil {
+		return
+	}
+	if hc.MaxIdleConnsPerHost < 0 {
+		c.add(path+".maxIdleConnsPerHost", "must not be negative")
+	}
+	if hc.IdleConnTimeout.Duration < 0 {
+		c.add(path+".idleConnTimeout", "must not be negative")
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// declares which labels identify a series of matching info metrics, so a series whose other
+// labels change (e.g. a vCenter upgraded to a new version) replaces the previous one instead
+// of both being exposed with value 1
+type InfoMetricRule struct {
+	// glob matched against metric names, e.g. "vcenter_info"
+	Match string `json:"match"`
+	// labels identifying the entity, e.g. ["vcenter"]
+	Identity []string `json:"identity"`
+}
+
+func (cfg *Config) checkInfoMetrics(c *checker) {
+	for i, rule := range cfg.InfoMetrics {
+		path := fmt.Sprintf("infoMetrics[%d]", i)
+		if _, err := filepath.Match(rule.Match, ""); err != nil || rule.Match == "" {
+			c.add(path+".match", "invalid glob pattern %q", rule.Match)
+		}
+		if len(rule.Identity) == 0 {
+			c.add(path+".identity", "at least one label is required")
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package config
+
+// label names, values and joined label keys shared by all series using them instead of held
+// by each series, see util.Interner; at hundreds of thousands of series sharing a few vCenters,
+// clusters and hosts, the duplicated label strings otherwise dominate the heap
+type LabelInterningConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// strings kept for sharing; beyond that, strings not used recently are dropped and
+	// series created afterwards get their own copies
+	MaxStrings int `json:"maxStrings,omitempty"`
+}
+
+func (cfg *Config) checkLabelInterning(c *checker) {
+	if cfg.LabelInterning.Enabled && cfg.LabelInterning.MaxStrings < 2 {
+		c.add("labelInterning.maxStrings", "must be at least 2")
+	}
+}
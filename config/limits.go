@@ -0,0 +1,49 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// request limits of an ingest or admin endpoint, zero values use the defaults
+type EndpointLimitConfig struct {
+	// larger request bodies are rejected with 413
+	MaxBodyBytes int64 `json:"maxBodyBytes,omitempty"`
+	// time allowed for receiving and decoding the request body, slower clients get 408
+	DecodeTimeout Duration `json:"decodeTimeout"`
+}
+
+// endpoints with request limits, the valid keys of Config.Limits; all but /health, /ready
+// and scrapes, so no handler can be held up by a slow or unbounded body
+var LimitedEndpoints = []string{"/push", "/push/batch", "/event", "/register", "/agent/config", "/annotations",
+	"/admin/series", "/admin/chaos", "/admin/loglevel", "/admin/lint", "/admin/agents", "/admin/checkpoint/diff"}
+
+// limits of the endpoint with the defaults filled in
+func (cfg *Config) LimitsFor(path string) EndpointLimitConfig {
+	limits := cfg.Limits[path]
+	if limits.MaxBodyBytes == 0 {
+		limits.MaxBodyBytes = DEFAULT_MAX_BODY_BYTES
+		if path == "/push/batch" {
+			limits.MaxBodyBytes = DEFAULT_BATCH_MAX_BODY_BYTES
+		}
+	}
+	if limits.DecodeTimeout.Duration == 0 {
+		limits.DecodeTimeout = Duration{DEFAULT_DECODE_TIMEOUT_SEC * time.Second}
+	}
+	return limits
+}
+
+func (cfg *Config) checkLimits(c *checker) {
+	for path, limits := range cfg.Limits {
+		if !slices.Contains(LimitedEndpoints, path) {
+			c.add("limits."+path, "unknown endpoint (use one of %s)", strings.Join(LimitedEndpoints, ", "))
+		}
+		if limits.MaxBodyBytes < 0 {
+			c.add("limits."+path+".maxBodyBytes", "must not be negative")
+		}
+		if limits.DecodeTimeout.Duration < 0 {
+			c.add("limits."+path+".decodeTimeout", "must not be negative")
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// checks names of incoming metrics against Prometheus naming conventions, violations are
+// logged once per metric and listed by /admin/lint
+type LintConfig struct {
+	Enabled bool `json:"enabled"`
+	// globs of metrics not checked, e.g. legacy names dashboards depend on
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+func (cfg *Config) checkLint(c *checker) {
+	for i, pattern := range cfg.Lint.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+			c.add(fmt.Sprintf("lint.ignore[%d]", i), "invalid glob pattern %q", pattern)
+		}
+	}
+}
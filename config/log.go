@@ -0,0 +1,24 @@
+package config
+
+// log verbosity at startup, changed at runtime through /admin/loglevel or SIGUSR1
+type LogConfig struct {
+	// "debug", "info" (default), "warn" or "error"
+	Level string `json:"level,omitempty"`
+	// levels of single packages overriding Level, e.g. {"poller": "debug", "handlers": "info"}
+	Modules map[string]string `json:"modules,omitempty"`
+
+	// identical warn and error lines beyond DedupBurst within DedupWindow are counted instead of
+	// written and summarized as "repeated N more times" when the window ends; 0 disables
+	DedupWindow Duration `json:"dedupWindow"`
+	// lines written per window before the rest is counted, 0 means 1
+	DedupBurst int `json:"dedupBurst,omitempty"`
+}
+
+func (cfg *Config) checkLog(c *checker) {
+	if cfg.Log.DedupWindow.Duration < 0 {
+		c.add("log.dedupWindow", "must not be negative")
+	}
+	if cfg.Log.DedupBurst < 0 {
+		c.add("log.dedupBurst", "must not be negative")
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// planned downtime of polled endpoints, e.g. vCenter upgrades: pollers keep polling but are
+// flagged as in maintenance and, with action "suppress", send no breaker alerts;
+// a window recurs at Schedule for Duration or covers the time from From to Until
+type MaintenanceWindow struct {
+	// identifies the window in logs and self-metrics
+	Name string `json:"name"`
+	// globs matched against poller names, e.g. "vc01-*"
+	Pollers []string `json:"pollers,omitempty"`
+	// pollers whose labels include all of these; with neither Pollers nor Labels all pollers are covered
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// cron expression of the window start in local time, e.g. "0 2 * * sat"
+	Schedule string   `json:"schedule,omitempty"`
+	Duration Duration `json:"duration,omitempty"`
+	// one-off window, RFC 3339 times
+	From  time.Time `json:"from,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+
+	// "flag" (default) or "suppress"
+	Action string `json:"action,omitempty"`
+}
+
+func (cfg *Config) checkMaintenance(c *checker) {
+	windowNames := map[string]bool{}
+	for i, mw := range cfg.Maintenance {
+		path := fmt.Sprintf("maintenance[%d]", i)
+		if mw.Name == "" {
+			c.add(path+".name", "missing name")
+		} else if windowNames[mw.Name] {
+			c.add(path+".name", "duplicate window %q", mw.Name)
+		}
+		windowNames[mw.Name] = true
+		for j, pattern := range mw.Pollers {
+			if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+				c.add(fmt.Sprintf("%s.pollers[%d]", path, j), "invalid glob pattern %q", pattern)
+			}
+		}
+		switch {
+		case mw.Schedule != "" && (!mw.From.IsZero() || !mw.Until.IsZero()):
+			c.add(path, "use either schedule and duration or from and until")
+		case mw.Schedule != "":
+			if mw.Duration.Duration <= 0 {
+				c.add(path+".duration", "must be positive")
+			}
+		case mw.From.IsZero() || mw.Until.IsZero():
+			c.add(path, "missing schedule or from and until")
+		case !mw.Until.After(mw.From):
+			c.add(path+".until", "must be after from")
+		}
+		if mw.Action != "" && mw.Action != MAINTENANCE_FLAG && mw.Action != MAINTENANCE_SUPPRESS {
+			c.add(path+".action", "unknown action %q (use %q or %q)", mw.Action, MAINTENANCE_FLAG, MAINTENANCE_SUPPRESS)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// merge policy of gauges matching Match when several push sources report the same series:
+// "last" (default) keeps the value pushed last, "max", "min" and "sum" combine the latest
+// value of each source that pushed within Interval (default 60s); the first matching rule applies
+type GaugeMergeRule struct {
+	// glob pattern like "vsphere_datastore_*"
+	Match    string   `json:"match"`
+	Policy   string   `json:"policy"`
+	Interval Duration `json:"interval,omitempty"`
+}
+
+func (cfg *Config) checkGaugeMerge(c *checker) {
+	for i, rule := range cfg.Push.GaugeMerge {
+		path := fmt.Sprintf("push.gaugeMerge[%d]", i)
+		if _, err := filepath.Match(rule.Match, ""); err != nil || rule.Match == "" {
+			c.add(path+".match", "invalid glob pattern %q", rule.Match)
+		}
+		switch rule.Policy {
+		case "", MERGE_LAST, MERGE_MAX, MERGE_MIN, MERGE_SUM:
+		default:
+			c.add(path+".policy", "unknown policy %q (use %q, %q, %q or %q)", rule.Policy, MERGE_LAST, MERGE_MAX, MERGE_MIN, MERGE_SUM)
+		}
+		if rule.Interval.Duration < 0 {
+			c.add(path+".interval", "must not be negative")
+		}
+	}
+}
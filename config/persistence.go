@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// how the counters and gauges of metrics matching a name pattern survive restarts:
+// "ephemeral" metrics are never checkpointed, "persistent" ones (the default) are saved
+// with every checkpoint, "durable" ones are also written to a write-ahead log on every
+// update, so crashes between checkpoints lose nothing (histograms are saved with checkpoints
+// only); the first matching rule applies
+type PersistenceRule struct {
+	// glob pattern like "vsphere_vm_*"
+	Match  string `json:"match"`
+	Policy string `json:"policy"`
+}
+
+func (cfg *Config) checkPersistence(c *checker) {
+	for i, rule := range cfg.Persistence {
+		path := fmt.Sprintf("persistence[%d]", i)
+		if _, err := filepath.Match(rule.Match, ""); err != nil || rule.Match == "" {
+			c.add(path+".match", "invalid glob pattern %q", rule.Match)
+		}
+		switch rule.Policy {
+		case PERSISTENCE_EPHEMERAL, PERSISTENCE_PERSISTENT, PERSISTENCE_DURABLE:
+		default:
+			c.add(path+".policy", "unknown policy %q (use %q, %q or %q)", rule.Policy, PERSISTENCE_EPHEMERAL, PERSISTENCE_PERSISTENT, PERSISTENCE_DURABLE)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// requests of a multi-step poll, e.g. login, list of deployments, details of each deployment;
+// values extracted from a response are available to later steps as {{name}} in URL, headers
+// and body, the responses of the last step are handed to the processor
+type PipelineConfig struct {
+	Steps []PipelineStep `json:"steps"`
+	// labels added to the series of each response of the last step, values may use {{name}}
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// one request of a pipeline, sent with the credentials and headers of the poller
+type PipelineStep struct {
+	// identifies the step in errors, defaults to its position
+	Name string `json:"name,omitempty"`
+	// GET if empty
+	Method string `json:"method,omitempty"`
+	// resolved against the poller URL, empty requests the poller URL itself;
+	// may reference secrets like the poller URL
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// sent as JSON, may reference secrets, e.g. {"refreshToken": "${vault:aria#token}"}
+	Body string `json:"body,omitempty"`
+	// variable -> dotted path of a value in the JSON response, e.g. {"token": "token"}
+	Extract map[string]string `json:"extract,omitempty"`
+	// dotted path of an array in the response, the following steps run once per element
+	// with the Extract paths taken relative to the element
+	ForEach string `json:"forEach,omitempty"`
+	// values extracted by a step running once per poll are reused by following polls
+	// for this long, e.g. login tokens; dropped when credentials are rejected
+	ReuseFor Duration `json:"reuseFor,omitempty"`
+}
+
+func (pc *PipelineConfig) check(c *checker, path string) {
+	if pc == nil {
+		return
+	}
+	if len(pc.Steps) == 0 {
+		c.add(path+".steps", "missing steps")
+	}
+	forEach := false
+	for j, step := range pc.Steps {
+		stepPath := fmt.Sprintf("%s.steps[%d]", path, j)
+		lastStep := j == len(pc.Steps)-1
+		switch step.Method {
+		case "", http.MethodGet, http.MethodPost, http.MethodPut:
+		default:
+			c.add(stepPath+".method", "unsupported method %q (use GET, POST or PUT)", step.Method)
+		}
+		for name, field := range step.Extract {
+			if field == "" {
+				c.add(stepPath+".extract."+name, "missing field path")
+			}
+		}
+		if step.ForEach != "" && lastStep {
+			c.add(stepPath+".forEach", "not allowed in the last step, its responses are processed")
+		}
+		if step.ReuseFor.Duration < 0 {
+			c.add(stepPath+".reuseFor", "must not be negative")
+		}
+		if step.ReuseFor.Duration > 0 && (forEach || step.ForEach != "" || lastStep) {
+			c.add(stepPath+".reuseFor", "only steps running once per poll before the last step can be reused")
+		}
+		forEach = forEach || step.ForEach != ""
+	}
+}
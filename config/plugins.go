@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// sink provided by a plugin, created after all plugins are loaded
+type SinkConfig struct {
+	// name the plugin registered the sink under
+	Type string `json:"type"`
+	// passed to the sink factory as is
+	Options json.RawMessage `json:"options,omitempty"`
+	// optional, queues updates on disk while the sink's remote is unreachable
+	Queue *QueueConfig `json:"queue,omitempty"`
+}
+
+// built-in ("relabel", "validate", "transform", "map") or plugin-provided interceptor of metric updates
+type InterceptorConfig struct {
+	Type string `json:"type"`
+	// passed to the interceptor factory as is
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+func (cfg *Config) checkPlugins(c *checker) {
+	for i, path := range cfg.Plugins {
+		if path == "" {
+			c.add(fmt.Sprintf("plugins[%d]", i), "missing plugin path")
+		}
+	}
+	for i, ic := range cfg.Interceptors {
+		if ic.Type == "" {
+			c.add(fmt.Sprintf("interceptors[%d].type", i), "missing interceptor type")
+		}
+	}
+	queueDirs := map[string]bool{}
+	for i, sink := range cfg.Sinks {
+		if sink.Type == "" {
+			c.add(fmt.Sprintf("sinks[%d].type", i), "missing sink type")
+		}
+		if q := sink.Queue; q != nil {
+			path := fmt.Sprintf("sinks[%d].queue", i)
+			if q.Dir == "" {
+				c.add(path+".dir", "missing queue directory")
+			} else if queueDirs[q.Dir] {
+				c.add(path+".dir", "directory %q is used by another queue", q.Dir)
+			}
+			queueDirs[q.Dir] = true
+			if q.MaxBytes < 0 || q.SegmentBytes < 0 || q.BatchSize < 0 || q.RetryInterval.Duration < 0 || q.MaxRetryInterval.Duration < 0 {
+				c.add(path, "sizes and intervals must not be negative")
+			}
+			if q.MaxBytes > 0 && q.SegmentBytes > 0 && q.MaxBytes < 2*q.SegmentBytes {
+				c.add(path+".maxBytes", "must be at least twice segmentBytes")
+			}
+		}
+	}
+}
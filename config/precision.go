@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// keeps counters matching a name pattern accurate beyond 2^53, where float64 stops
+// representing every integer and increments get lost: "split" additionally exposes
+// the exact value as "<name>_high" and "<name>_low" gauges (value = high * 2^32 + low),
+// "scale" records increases divided by Scale, e.g. bytes as GiB with 1073741824;
+// the first matching rule applies
+type CounterPrecisionRule struct {
+	// glob pattern like "billing_*_total"
+	Match string  `json:"match"`
+	Mode  string  `json:"mode"`
+	Scale float64 `json:"scale,omitempty"`
+}
+
+func (cfg *Config) checkCounterPrecision(c *checker) {
+	for i, rule := range cfg.CounterPrecision {
+		path := fmt.Sprintf("counterPrecision[%d]", i)
+		if _, err := filepath.Match(rule.Match, ""); err != nil || rule.Match == "" {
+			c.add(path+".match", "invalid glob pattern %q", rule.Match)
+		}
+		switch rule.Mode {
+		case PRECISION_SPLIT:
+		case PRECISION_SCALE:
+			if rule.Scale <= 0 {
+				c.add(path+".scale", "must be > 0 in %q mode", PRECISION_SCALE)
+			}
+		default:
+			c.add(path+".mode", "unknown mode %q (use %q or %q)", rule.Mode, PRECISION_SPLIT, PRECISION_SCALE)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// a module of the /probe endpoint: Prometheus passes ?target=vc01&module=storage and the
+// poller is run once with {{target}} replaced in its name, url, headers and label values,
+// returning its metrics for that scrape only (the multi-target exporter pattern)
+type ProbeModuleConfig struct {
+	Poller PollerConfig `json:"poller"`
+	// probe the availability of the target instead of polling it, the target is the URL
+	// (https:// is assumed without scheme); replaces Poller
+	HTTP *BlackboxConfig `json:"http,omitempty"`
+	// globs of targets that may be probed, all if empty; probes otherwise reach any host
+	// a scraper names, so modules sending credentials or headers require them
+	Targets []string `json:"targets,omitempty"`
+}
+
+func (cfg *Config) checkProbeModules(c *checker) {
+	for name, module := range cfg.ProbeModules {
+		path := "probeModules." + name
+		if module.HTTP != nil {
+			if module.Poller.URL != "" {
+				c.add(path+".http", "cannot be combined with a poller")
+			}
+			module.HTTP.check(c, path+".http")
+		} else {
+			if !strings.Contains(module.Poller.URL, "{{target}}") {
+				c.add(path+".poller.url", "must contain {{target}}")
+			}
+			if (module.Poller.Processor == "" || module.Poller.Processor == "value") && module.Poller.Metric == "" {
+				c.add(path+".poller.metric", "missing metric name")
+			}
+		}
+		module.Poller.checkRequests(c, path+".poller")
+		for i, pattern := range module.Targets {
+			if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+				c.add(fmt.Sprintf("%s.targets[%d]", path, i), "invalid glob pattern %q", pattern)
+			}
+		}
+		if len(module.Targets) == 0 && probeSendsCredentials(module) {
+			c.add(path+".targets", "required for modules sending credentials or headers, they would be sent to any target")
+		}
+	}
+}
+
+// whether probes of the module send credentials or headers to the target
+func probeSendsCredentials(module ProbeModuleConfig) bool {
+	if module.HTTP != nil {
+		return len(module.HTTP.Headers) > 0
+	}
+	pc := module.Poller
+	return len(pc.Headers) > 0 || pc.VCenter != nil || pc.Pipeline != nil || pc.GraphQL != nil ||
+		strings.Contains(pc.URL, "@") || strings.Contains(pc.URL, "${")
+}
@@ -0,0 +1,18 @@
+package config
+
+// on-disk queue in front of a sink delivering to a remote system, so updates made while the
+// remote is unreachable are delivered later instead of dropped; the sink must implement
+// metrics.SampleWriter
+type QueueConfig struct {
+	// directory of the queue's segment files, one per sink
+	Dir string `json:"dir"`
+	// the oldest samples are dropped beyond this size, 0 means default
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+	// size of segment files, 0 means default
+	SegmentBytes int64 `json:"segmentBytes,omitempty"`
+	// samples per WriteSamples call, 0 means default
+	BatchSize int `json:"batchSize,omitempty"`
+	// wait after a failed delivery, doubled up to MaxRetryInterval while failures go on
+	RetryInterval    Duration `json:"retryInterval,omitempty"`
+	MaxRetryInterval Duration `json:"maxRetryInterval,omitempty"`
+}
@@ -0,0 +1,34 @@
+package config
+
+// request budget of pollers per target host, shared by all pollers of the host,
+// disabled if RequestsPerSecond is 0 and no host is listed
+type HostRateLimitConfig struct {
+	// budget of every host not listed in Hosts, 0 leaves them unlimited
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+	// requests allowed at once after an idle period, 0 means 1
+	Burst int `json:"burst,omitempty"`
+	// budgets of single hosts by host name, e.g. a vCenter with a lower API limit
+	Hosts map[string]RateLimit `json:"hosts,omitempty"`
+}
+
+type RateLimit struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst,omitempty"`
+}
+
+func (cfg *Config) checkHostRateLimit(c *checker) {
+	if cfg.HostRateLimit.RequestsPerSecond < 0 {
+		c.add("hostRateLimit.requestsPerSecond", "must not be negative")
+	}
+	if cfg.HostRateLimit.Burst < 0 {
+		c.add("hostRateLimit.burst", "must not be negative")
+	}
+	for host, limit := range cfg.HostRateLimit.Hosts {
+		if limit.RequestsPerSecond <= 0 {
+			c.add("hostRateLimit.hosts."+host+".requestsPerSecond", "must be positive")
+		}
+		if limit.Burst < 0 {
+			c.add("hostRateLimit.hosts."+host+".burst", "must not be negative")
+		}
+	}
+}
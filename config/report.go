@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// periodic summary of key metrics emailed to people who don't open Grafana
+type ReportConfig struct {
+	// "daily" or "weekly" (sent on Mondays)
+	Schedule string `json:"schedule"`
+	// local time of day the report is sent, "HH:MM", defaults to 07:00
+	At      string `json:"at,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	// how often values are sampled into the in-memory history the report is computed from
+	SampleInterval Duration        `json:"sampleInterval"`
+	SMTP           SMTPConfig      `json:"smtp"`
+	Sections       []ReportSection `json:"sections"`
+}
+
+type SMTPConfig struct {
+	// host:port of the mail relay, STARTTLS is used if the server offers it
+	Addr string `json:"addr"`
+	// optional PLAIN auth, the password may reference a secret
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// a table of the report
+type ReportSection struct {
+	Title string `json:"title"`
+	// "growth": gauge series with the largest increase over the period, e.g. datastore usage,
+	// "ratio": increase of the counter series matching Match relative to all series, per GroupBy value,
+	// e.g. deployment failure rate; "top": series with the highest current value
+	Kind   string `json:"kind"`
+	Metric string `json:"metric"`
+	// label values selecting the numerator of "ratio" sections
+	Match map[string]string `json:"match,omitempty"`
+	// label naming the rows, all labels are shown if empty; required for "ratio"
+	GroupBy string `json:"groupBy,omitempty"`
+	// rows shown, defaults to 10
+	Limit int `json:"limit,omitempty"`
+}
+
+func (cfg *Config) checkReport(c *checker) {
+	if report := cfg.Report; report != nil {
+		if report.Schedule != "daily" && report.Schedule != "weekly" {
+			c.add("report.schedule", "unknown schedule %q (use \"daily\" or \"weekly\")", report.Schedule)
+		}
+		if report.At != "" {
+			if _, err := time.Parse("15:04", report.At); err != nil {
+				c.add("report.at", "must be a time of day like \"07:00\"")
+			}
+		}
+		if report.SampleInterval.Duration < 0 {
+			c.add("report.sampleInterval", "must not be negative")
+		}
+		if report.SMTP.Addr == "" {
+			c.add("report.smtp.addr", "missing SMTP server address")
+		}
+		if report.SMTP.From == "" || len(report.SMTP.To) == 0 {
+			c.add("report.smtp", "missing sender or recipients")
+		}
+		if len(report.Sections) == 0 {
+			c.add("report.sections", "no sections configured")
+		}
+		for i, section := range report.Sections {
+			path := fmt.Sprintf("report.sections[%d]", i)
+			if section.Kind != "growth" && section.Kind != "ratio" && section.Kind != "top" {
+				c.add(path+".kind", "unknown kind %q (use \"growth\", \"ratio\" or \"top\")", section.Kind)
+			}
+			if section.Metric == "" {
+				c.add(path+".metric", "missing metric")
+			}
+			if section.Kind == "ratio" && (section.GroupBy == "" || len(section.Match) == 0) {
+				c.add(path, "ratio sections require groupBy and match")
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// looks up human-readable names of opaque IDs used as label values (project IDs, datastore
+// MoRefs) via a secondary API, pollers refer to it by name in ResolveLabels
+type NameResolverConfig struct {
+	Name string `json:"name"`
+	// lookup of a single ID, "{id}" is replaced by the ID, e.g.
+	// https://aria.example.com/iaas/api/projects/{id}; without "{id}" the URL returns all
+	// objects at once, see ItemsPath
+	URL string `json:"url"`
+	// may reference secrets, e.g. {"Authorization": "Bearer ${vault:secret/data/aria#token}"}
+	Headers map[string]string `json:"headers,omitempty"`
+	// optional vCenter session the lookups authenticate with
+	VCenter *VCenterConfig `json:"vcenter,omitempty"`
+	// lists only: dotted path of the objects in the response, the response itself if empty,
+	// and of the ID within an object
+	ItemsPath string `json:"itemsPath,omitempty"`
+	IDPath    string `json:"idPath,omitempty"`
+	// dotted path of the name within an object
+	NamePath string `json:"namePath"`
+	// names are looked up again after this time, lists fetched again
+	TTL Duration `json:"ttl"`
+	// IDs that could not be resolved keep the ID as label value and are looked up again
+	// after this time, 0 means TTL
+	RetryAfter Duration `json:"retryAfter"`
+	// of each lookup request, 0 means default (5s)
+	Timeout Duration `json:"timeout"`
+}
+
+// name resolvers are checked before pollers, which refer to them
+func (cfg *Config) checkNameResolvers(c *checker) {
+	for i, rc := range cfg.NameResolvers {
+		path := fmt.Sprintf("nameResolvers[%d]", i)
+		if rc.Name == "" {
+			c.add(path+".name", "missing name")
+		} else if c.resolvers[rc.Name] {
+			c.add(path+".name", "duplicate name %q", rc.Name)
+		}
+		c.resolvers[rc.Name] = true
+		if rc.URL == "" {
+			c.add(path+".url", "missing url")
+		}
+		if rc.NamePath == "" {
+			c.add(path+".namePath", "missing name path")
+		}
+		if !strings.Contains(rc.URL, "{id}") && rc.IDPath == "" {
+			c.add(path+".idPath", "required for lists, without {id} in the url")
+		}
+		if strings.Contains(rc.URL, "{id}") && (rc.IDPath != "" || rc.ItemsPath != "") {
+			c.add(path+".url", "lookups of single IDs take no idPath or itemsPath")
+		}
+		if rc.TTL.Duration <= 0 {
+			c.add(path+".ttl", "must be positive")
+		}
+		if rc.RetryAfter.Duration < 0 {
+			c.add(path+".retryAfter", "must not be negative")
+		}
+		if rc.Timeout.Duration < 0 {
+			c.add(path+".timeout", "must not be negative")
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// how metrics are restored from the checkpoint at startup: "blocking" restores all series
+// before the collector starts, "lazy" only registers the metrics and restores their series
+// in background batches, Priority first, while the collector already serves requests;
+// series updated before their turn are restored on that first update
+type RestoreConfig struct {
+	Mode string `json:"mode,omitempty"`
+	// metric name globs restored before all others, in this order
+	Priority []string `json:"priority,omitempty"`
+	// series restored per batch in lazy mode
+	BatchSize int `json:"batchSize,omitempty"`
+	// pause between batches in lazy mode, leaving the sink to live updates and scrapes
+	BatchPause Duration `json:"batchPause"`
+}
+
+func (cfg *Config) checkRestore(c *checker) {
+	switch cfg.Restore.Mode {
+	case "", RESTORE_BLOCKING:
+	case RESTORE_LAZY:
+		if cfg.CheckpointFile == "" {
+			c.add("restore.mode", "lazy restore requires checkpointFile")
+		}
+		if cfg.Restore.BatchSize < 1 {
+			c.add("restore.batchSize", "must be at least 1")
+		}
+		if cfg.Restore.BatchPause.Duration < 0 {
+			c.add("restore.batchPause", "must not be negative")
+		}
+	default:
+		c.add("restore.mode", "unknown mode %q (use %q or %q)", cfg.Restore.Mode, RESTORE_BLOCKING, RESTORE_LAZY)
+	}
+	for i, pattern := range cfg.Restore.Priority {
+		if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+			c.add(fmt.Sprintf("restore.priority[%d]", i), "invalid glob pattern %q", pattern)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// additional scrape path exposing a subset of the metrics, so Prometheus servers with
+// different retention can scrape disjoint parts, e.g. "/metrics/infra" with "vsphere_*"
+type ScrapeEndpointConfig struct {
+	Path string `json:"path"`
+	// globs matched against metric names, all metrics if empty
+	Include []string `json:"include,omitempty"`
+	// globs of metrics left out even if included
+	Exclude []string `json:"exclude,omitempty"`
+	// only series with all these label values
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (cfg *Config) checkScrapeEndpoints(c *checker) {
+	scrapePaths := map[string]bool{}
+	for i, se := range cfg.ScrapeEndpoints {
+		path := fmt.Sprintf("scrapeEndpoints[%d]", i)
+		// below /metrics/, so they cannot clash with other endpoints sharing the listener
+		if !strings.HasPrefix(se.Path, "/metrics/") || len(se.Path) == len("/metrics/") {
+			c.add(path+".path", "must start with /metrics/, e.g. /metrics/infra")
+		} else if scrapePaths[se.Path] {
+			c.add(path+".path", "duplicate path %q", se.Path)
+		}
+		scrapePaths[se.Path] = true
+		for j, pattern := range se.Include {
+			if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+				c.add(fmt.Sprintf("%s.include[%d]", path, j), "invalid glob pattern %q", pattern)
+			}
+		}
+		for j, pattern := range se.Exclude {
+			if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+				c.add(fmt.Sprintf("%s.exclude[%d]", path, j), "invalid glob pattern %q", pattern)
+			}
+		}
+	}
+}
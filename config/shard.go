@@ -0,0 +1,21 @@
+package config
+
+// splits pollers across collector instances sharing the same config: each instance polls the
+// pollers whose name hashes to its Index, so hundreds of endpoints can be spread without two
+// instances polling the same one; disabled if Total is 0 or 1
+type ShardConfig struct {
+	// 0-based, e.g. COLLECTOR_SHARD_INDEX=2
+	Index int `json:"index"`
+	Total int `json:"total"`
+	// take the index from the number ending the host name, e.g. 2 for the StatefulSet pod collector-2
+	IndexFromHostname bool `json:"indexFromHostname,omitempty"`
+}
+
+func (cfg *Config) checkShard(c *checker) {
+	if cfg.Shard.Total < 0 {
+		c.add("shard.total", "must not be negative")
+	}
+	if cfg.Shard.Total > 1 && !cfg.Shard.IndexFromHostname && (cfg.Shard.Index < 0 || cfg.Shard.Index >= cfg.Shard.Total) {
+		c.add("shard.index", "must be between 0 and %d", cfg.Shard.Total-1)
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+// HMAC signature expected on payloads, verifying they were not altered by services in between;
+// the signed content is the body, or "<timestamp>.<body>" if TimestampHeader is set
+type SignatureConfig struct {
+	// header carrying the signature, e.g. X-Signature
+	Header string `json:"header"`
+	// shared key, may reference a secret, e.g. ${env:WEBHOOK_HMAC_KEY}
+	Secret string `json:"secret"`
+	// "sha256" (default), "sha512" or "sha1"
+	Algorithm string `json:"algorithm,omitempty"`
+	// "hex" (default) or "base64"
+	Encoding string `json:"encoding,omitempty"`
+	// stripped from the header value before decoding, e.g. "sha256="
+	Prefix string `json:"prefix,omitempty"`
+	// header carrying the Unix time of signing, protects against replayed payloads
+	TimestampHeader string `json:"timestampHeader,omitempty"`
+	// payloads signed longer ago are rejected, 0 means default
+	MaxAge Duration `json:"maxAge,omitempty"`
+}
+
+func (sc *SignatureConfig) check(c *checker, path string) {
+	if sc == nil {
+		return
+	}
+	if sc.Header == "" {
+		c.add(path+".header", "missing signature header")
+	}
+	if sc.Secret == "" {
+		c.add(path+".secret", "missing secret")
+	}
+	switch sc.Algorithm {
+	case "", "sha1", "sha256", "sha512":
+	default:
+		c.add(path+".algorithm", "unknown algorithm %q (use \"sha256\", \"sha512\" or \"sha1\")", sc.Algorithm)
+	}
+	switch sc.Encoding {
+	case "", "hex", "base64":
+	default:
+		c.add(path+".encoding", "unknown encoding %q (use \"hex\" or \"base64\")", sc.Encoding)
+	}
+	if sc.MaxAge.Duration < 0 {
+		c.add(path+".maxAge", "must not be negative")
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+// synthetic vSphere-like metric streams for developing dashboards and alerts
+// without a vCenter, zero values fall back to the simulator defaults
+type SimulatorConfig struct {
+	Clusters        int `json:"clusters,omitempty"`
+	HostsPerCluster int `json:"hostsPerCluster,omitempty"`
+	VMsPerHost      int `json:"vmsPerHost,omitempty"`
+	Datastores      int `json:"datastores,omitempty"`
+	// Aria Automation projects requesting deployments
+	Projects int `json:"projects,omitempty"`
+	// how often all series are updated
+	Interval Duration `json:"interval"`
+	// fraction of VMs replaced by new ones per interval, drives series churn;
+	// 0 keeps the inventory fixed, unset uses the default
+	Churn *float64 `json:"churn,omitempty"`
+	// seed of the random generator, runs with the same seed produce the same inventory
+	Seed int64 `json:"seed,omitempty"`
+}
+
+func (cfg *Config) checkSimulator(c *checker) {
+	if sim := cfg.Simulator; sim != nil && sim.Churn != nil && (*sim.Churn < 0 || *sim.Churn > 1) {
+		c.add("simulator.churn", "must be between 0 and 1")
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import "fmt"
+
+// polls OIDs of a device via SNMP v2c or v3 into gauges, or counters for Counter32/Counter64
+type SnmpPollerConfig struct {
+	Name string `json:"name"`
+	// host or host:port, port defaults to 161
+	Target   string            `json:"target"`
+	Version  string            `json:"version"` // "2c" or "3"
+	Interval Duration          `json:"interval"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// poll once at startup instead of waiting for the first interval
+	ImmediateFirstPoll bool `json:"immediateFirstPoll,omitempty"`
+
+	// v2c community, may reference a secret
+	Community string          `json:"community,omitempty"`
+	V3        *SnmpV3Config   `json:"v3,omitempty"`
+	OIDs      []SnmpOIDConfig `json:"oids"`
+}
+
+// SNMPv3 user security model settings, passphrases may reference secrets
+type SnmpV3Config struct {
+	Username       string `json:"username"`
+	AuthProtocol   string `json:"authProtocol,omitempty"` // MD5, SHA, SHA224, SHA256, SHA384, SHA512
+	AuthPassphrase string `json:"authPassphrase,omitempty"`
+	PrivProtocol   string `json:"privProtocol,omitempty"` // DES, AES, AES192, AES256
+	PrivPassphrase string `json:"privPassphrase,omitempty"`
+}
+
+// maps an OID to a metric
+type SnmpOIDConfig struct {
+	OID string `json:"oid"`
+	// counters get the suffix _total if it is missing, e.g. if_hc_in_octets_total
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// walk the subtree below OID (e.g. a table column like ifHCInOctets),
+	// the index suffix of each row is exported as label IndexLabel
+	Walk       bool   `json:"walk,omitempty"`
+	IndexLabel string `json:"indexLabel,omitempty"`
+}
+
+// receives SNMP v1/v2c traps and counts them per trap OID, disabled if ListenAddr is empty
+type SnmpTrapConfig struct {
+	// UDP address, e.g. ":162"
+	ListenAddr string `json:"listenAddr,omitempty"`
+	// accepted community, may reference a secret; empty accepts any
+	Community string `json:"community,omitempty"`
+	// label set to the address of the sending agent, empty omits it
+	SourceLabel string         `json:"sourceLabel,omitempty"`
+	Traps       []SnmpTrapRule `json:"traps"`
+	// counter for traps matching no rule, labelled with "trap_oid" (the first 1000 distinct OIDs,
+	// "other" beyond); empty only counts them in self-metrics
+	UnmatchedMetric string `json:"unmatchedMetric,omitempty"`
+}
+
+// increments Metric for traps whose OID is TrapOID or below it, the most specific rule applies
+type SnmpTrapRule struct {
+	// snmpTrapOID of v2c traps; v1 traps are matched as <enterprise>.0.<specific>
+	// or as the standard OIDs of generic traps, e.g. .1.3.6.1.6.3.1.1.5.3 for linkDown
+	TrapOID string            `json:"trapOid"`
+	Metric  string            `json:"metric"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	// varbind OID -> label, the varbind value becomes the label value;
+	// varbinds are matched by prefix, so table instance suffixes don't matter
+	Varbinds map[string]string `json:"varbinds,omitempty"`
+}
+
+func (cfg *Config) checkSnmpPollers(c *checker) {
+	for i, sc := range cfg.SnmpPollers {
+		path := fmt.Sprintf("snmpPollers[%d]", i)
+		if sc.Name == "" {
+			c.add(path+".name", "missing name")
+		} else {
+			c.pollerName(sc.Name, path+".name")
+		}
+		if sc.Target == "" {
+			c.add(path+".target", "missing target")
+		}
+		if sc.Interval.Duration <= 0 {
+			c.add(path+".interval", "interval must be positive")
+		}
+		switch sc.Version {
+		case "2c":
+			if sc.Community == "" {
+				c.add(path+".community", "missing community for SNMP v2c")
+			}
+		case "3":
+			if sc.V3 == nil || sc.V3.Username == "" {
+				c.add(path+".v3", "missing v3 username")
+			} else {
+				if sc.V3.AuthProtocol != "" && sc.V3.AuthPassphrase == "" {
+					c.add(path+".v3.authPassphrase", "missing auth passphrase")
+				}
+				if sc.V3.PrivProtocol != "" && sc.V3.PrivPassphrase == "" {
+					c.add(path+".v3.privPassphrase", "missing privacy passphrase")
+				}
+			}
+		default:
+			c.add(path+".version", "unsupported SNMP version %q (use \"2c\" or \"3\")", sc.Version)
+		}
+		for j, oc := range sc.OIDs {
+			if oc.OID == "" || oc.Metric == "" {
+				c.add(fmt.Sprintf("%s.oids[%d]", path, j), "missing oid or metric")
+			}
+		}
+	}
+}
+
+func (cfg *Config) checkSnmpTraps(c *checker) {
+	for i, rule := range cfg.SnmpTraps.Traps {
+		path := fmt.Sprintf("snmpTraps.traps[%d]", i)
+		if rule.TrapOID == "" {
+			c.add(path+".trapOid", "missing trap OID")
+		}
+		if rule.Metric == "" {
+			c.add(path+".metric", "missing metric")
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+// inventory of expected push sources read from a directory of file_sd-style
+// JSON or YAML files, disabled if Dir is empty
+type PushSourcesConfig struct {
+	Dir string `json:"dir,omitempty"`
+	// how often the directory is checked for changed files
+	RefreshInterval Duration `json:"refreshInterval"`
+	// reject pushes from sources missing in the inventory with 403
+	RejectUnknown bool `json:"rejectUnknown,omitempty"`
+	// expected sources not pushing for this long are flagged stale, 0 disables
+	StaleAfter Duration `json:"staleAfter"`
+}
+
+func (cfg *Config) checkPushSources(c *checker) {
+	if cfg.PushSources.Dir != "" && cfg.PushSources.RefreshInterval.Duration <= 0 {
+		c.add("pushSources.refreshInterval", "must be positive")
+	}
+	if cfg.PushSources.Dir == "" && cfg.PushSources.RejectUnknown {
+		c.add("pushSources.rejectUnknown", "requires pushSources.dir")
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// what counts as a successful poll beyond a 2xx status, e.g. for Aria endpoints answering
+// 200 with an error envelope; polls not meeting the criteria fail with category "criteria"
+type SuccessConfig struct {
+	// accepted status codes of the poll and its detail requests, empty accepts any 2xx
+	StatusCodes []int `json:"statusCodes,omitempty"`
+	// dotted paths of JSON fields that must be present and not null, e.g. "data.items";
+	// numeric segments index arrays, "items.0.id"
+	RequiredFields []string `json:"requiredFields,omitempty"`
+	// the array at ItemsPath, or the response itself if empty, must have at least MinItems elements
+	ItemsPath string `json:"itemsPath,omitempty"`
+	MinItems  int    `json:"minItems,omitempty"`
+}
+
+func (sc *SuccessConfig) check(c *checker, path string) {
+	if sc == nil {
+		return
+	}
+	for j, code := range sc.StatusCodes {
+		if code < 100 || code > 599 {
+			c.add(fmt.Sprintf("%s.statusCodes[%d]", path, j), "invalid status code %d", code)
+		}
+	}
+	for j, field := range sc.RequiredFields {
+		if field == "" || strings.Contains(field, "..") {
+			c.add(fmt.Sprintf("%s.requiredFields[%d]", path, j), "invalid field path %q", field)
+		}
+	}
+	if sc.MinItems < 0 {
+		c.add(path+".minItems", "must not be negative")
+	}
+}
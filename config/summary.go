@@ -0,0 +1,14 @@
+package config
+
+// quantile objectives for summaries whose name matches Match,
+// the first matching schema wins, unmatched summaries only expose count and sum
+type SummarySchema struct {
+	// glob pattern matched against metric name, e.g. "*_duration_seconds"
+	Match string `json:"match"`
+	// quantile -> allowed absolute error, e.g. {"0.5": 0.05, "0.99": 0.001}
+	Objectives map[string]float64 `json:"objectives"`
+	// observations older than this are dropped from quantile calculation, 0 means 10m
+	MaxAge Duration `json:"maxAge"`
+	// number of buckets the MaxAge window is rotated in, 0 means 5
+	AgeBuckets uint32 `json:"ageBuckets,omitempty"`
+}
@@ -0,0 +1,41 @@
+package config
+
+import "fmt"
+
+// syslog listener turning matching log lines into counter increments,
+// disabled if neither UDPAddr nor TCPAddr is set
+type SyslogConfig struct {
+	UDPAddr string `json:"udpAddr,omitempty"`
+	// TCP accepts newline-delimited and octet-counted (RFC 6587) framing
+	TCPAddr string       `json:"tcpAddr,omitempty"`
+	Rules   []SyslogRule `json:"rules"`
+}
+
+// increments Metric for every message matching Pattern, all matching rules apply
+type SyslogRule struct {
+	Metric string `json:"metric"`
+	// regular expression matched against the message text; may use grok-style
+	// %{PATTERN} or %{PATTERN:label} references, named groups become labels
+	Pattern string `json:"pattern"`
+	// only messages of this APP-NAME, e.g. "vpxd", empty matches all
+	AppName string `json:"appName,omitempty"`
+	// constant labels added to the counter
+	Labels map[string]string `json:"labels,omitempty"`
+	// label set to the HOSTNAME of the message, empty omits it
+	HostLabel string `json:"hostLabel,omitempty"`
+}
+
+func (cfg *Config) checkSyslog(c *checker) {
+	for i, rule := range cfg.Syslog.Rules {
+		path := fmt.Sprintf("syslog.rules[%d]", i)
+		if rule.Metric == "" {
+			c.add(path+".metric", "missing metric")
+		}
+		if rule.Pattern == "" {
+			c.add(path+".pattern", "missing pattern")
+		}
+	}
+	if len(cfg.Syslog.Rules) > 0 && cfg.Syslog.UDPAddr == "" && cfg.Syslog.TCPAddr == "" {
+		c.add("syslog", "rules are configured but neither udpAddr nor tcpAddr is set")
+	}
+}
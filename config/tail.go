@@ -0,0 +1,49 @@
+package config
+
+import "fmt"
+
+// follows a local log file, e.g. on a VCSA or Aria appliance, and increments the counters
+// of matching rules for every new line; rotated and truncated files are followed
+type TailConfig struct {
+	Path string `json:"path"`
+	// read the lines already in the file at startup instead of only new ones
+	FromStart bool `json:"fromStart,omitempty"`
+	// how often the file is checked for new lines, 0 means default
+	PollInterval Duration `json:"pollInterval"`
+	// added to the counters of all rules
+	Labels map[string]string `json:"labels,omitempty"`
+	Rules  []TailRule        `json:"rules"`
+}
+
+// increments Metric for every line matching Pattern, all matching rules apply
+type TailRule struct {
+	Metric string `json:"metric"`
+	// regular expression, may use grok-style %{PATTERN} or %{PATTERN:label} references,
+	// named groups become labels
+	Pattern string            `json:"pattern"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+func (cfg *Config) checkTails(c *checker) {
+	for i, tc := range cfg.Tails {
+		path := fmt.Sprintf("tail[%d]", i)
+		if tc.Path == "" {
+			c.add(path+".path", "missing path")
+		}
+		if tc.PollInterval.Duration < 0 {
+			c.add(path+".pollInterval", "must not be negative")
+		}
+		if len(tc.Rules) == 0 {
+			c.add(path+".rules", "no rules")
+		}
+		for j, rule := range tc.Rules {
+			rulePath := fmt.Sprintf("%s.rules[%d]", path, j)
+			if rule.Metric == "" {
+				c.add(rulePath+".metric", "missing metric")
+			}
+			if rule.Pattern == "" {
+				c.add(rulePath+".pattern", "missing pattern")
+			}
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package config
+
+// declares the unit of matching metrics, so names get the canonical suffix
+// ("_bytes", "_seconds", "_ratio") and values are converted from the unit sources send
+type UnitRule struct {
+	// glob matched against metric names, e.g. "nsx_*_latency*"
+	Match string `json:"match"`
+	// "bytes", "seconds" or "ratio"
+	Unit string `json:"unit"`
+	// unit of incoming values, e.g. "ms", "MB", "percent"; empty if already in Unit
+	From string `json:"from,omitempty"`
+}
@@ -0,0 +1,347 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// a problem found in the config file
+type Issue struct {
+	Path    string // e.g. pollers[1].interval
+	Line    int    // 0 if the key is not in the file (default value)
+	Column  int
+	Message string
+}
+
+func (issue Issue) String() string {
+	if issue.Line == 0 {
+		return fmt.Sprintf("%s: %s", issue.Path, issue.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", issue.Line, issue.Column, issue.Path, issue.Message)
+}
+
+// key path -> byte offset in the config file
+type positions map[string]int64
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Validate loads the config file strictly and reports unknown keys, values of wrong type,
+// bad durations and semantic problems (conflicting poller names, missing credentials)
+// with line/column context; error is returned only if the file can't be read or isn't JSON.
+// An empty path checks the defaults with the environment overrides, as Load does
+func Validate(path string) (*Config, []Issue, error) {
+	data := []byte("{}")
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if err := json.Unmarshal(data, new(any)); errors.As(err, &syntaxErr) {
+		line, col := lineColumn(data, syntaxErr.Offset)
+		return nil, nil, fmt.Errorf("%d:%d: %v", line, col, err)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// structural check: every key known, every value of the right type
+	var issues []Issue
+	pos := positions{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	walkValue(decoder, reflect.TypeOf(Config{}), "", pos, &issues)
+
+	// values of wrong type were reported above, load the rest on top of the defaults
+	cfg := Default()
+	if path == "" {
+		cfg.Pollers = samplePollers()
+	}
+	_ = json.Unmarshal(data, cfg)
+	if err := ApplyEnv(cfg); err != nil {
+		issues = append(issues, Issue{Path: "environment", Message: err.Error()})
+	}
+
+	issues = append(issues, cfg.Check()...)
+	for i := range issues {
+		if offset, ok := pos.lookup(issues[i].Path); ok && issues[i].Line == 0 {
+			issues[i].Line, issues[i].Column = lineColumn(data, offset)
+		}
+	}
+	return cfg, issues, nil
+}
+
+// offset of path, or of its closest parent present in the file
+func (pos positions) lookup(path string) (int64, bool) {
+	for path != "" {
+		if offset, ok := pos[path]; ok {
+			return offset, true
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return 0, false
+}
+
+// collects the issues of Check, sections add theirs with paths following JSON keys
+type checker struct {
+	issues []Issue
+	// poller name -> path of its config, names are unique across pollers, SNMP pollers and execs
+	pollerNames map[string]string
+	// names of nameResolvers, pollers refer to them in resolveLabels
+	resolvers map[string]bool
+}
+
+func (c *checker) add(path, format string, args ...any) {
+	c.issues = append(c.issues, Issue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) pollerName(name, path string) {
+	if other, exists := c.pollerNames[name]; exists {
+		c.add(path, "poller name %q conflicts with %s", name, other)
+		return
+	}
+	c.pollerNames[name] = path
+}
+
+func (c *checker) resolveLabels(path string, labels map[string]string) {
+	for label, resolver := range labels {
+		if !c.resolvers[resolver] {
+			c.add(path+"."+label, "unknown name resolver %q", resolver)
+		}
+	}
+}
+
+// semantic checks not expressible by types, paths of issues follow JSON keys
+func (cfg *Config) Check() []Issue {
+	c := &checker{pollerNames: map[string]string{}, resolvers: map[string]bool{}}
+	cfg.checkNameResolvers(c)
+	cfg.checkPollers(c)
+	cfg.checkSnmpPollers(c)
+	cfg.checkDiscovery(c)
+	cfg.checkProbeModules(c)
+	cfg.checkBlackbox(c)
+	cfg.checkPushSources(c)
+	cfg.checkAgents(c)
+	cfg.checkAnnotations(c)
+	cfg.checkTLS(c)
+	if mc := cfg.MetricConflicts; mc != "" && mc != "reject" && mc != "remap" {
+		c.add("metricConflicts", "unknown policy %q (use \"reject\" or \"remap\")", mc)
+	}
+	cfg.checkSnmpTraps(c)
+	cfg.checkSyslog(c)
+	cfg.checkDebug(c)
+	cfg.checkLog(c)
+	cfg.checkWarmup(c)
+	cfg.checkReport(c)
+	cfg.checkSimulator(c)
+	cfg.checkAuth(c)
+	cfg.checkPush(c)
+	cfg.checkBackpressure(c)
+	cfg.checkExecs(c)
+	cfg.checkTails(c)
+	cfg.checkPlugins(c)
+	cfg.checkHostRateLimit(c)
+	cfg.checkUDP(c)
+	cfg.checkLimits(c)
+	cfg.checkInfoMetrics(c)
+	cfg.checkShard(c)
+	cfg.checkLint(c)
+	cfg.checkScrapeEndpoints(c)
+	cfg.checkPersistence(c)
+	cfg.checkGaugeMerge(c)
+	cfg.checkCounterPrecision(c)
+	cfg.checkCounterWindows(c)
+	cfg.checkMaintenance(c)
+	if cfg.CheckpointFile != "" && cfg.CheckpointInterval.Duration <= 0 {
+		c.add("checkpointInterval", "checkpoint interval must be positive")
+	}
+	cfg.checkLabelInterning(c)
+	cfg.checkRestore(c)
+	if cfg.SeriesTTL.Duration < 0 {
+		c.add("seriesTTL", "must not be negative")
+	}
+	cfg.checkMemoryGuard(c)
+	cfg.checkVault(c)
+	return c.issues
+}
+
+// walks one JSON value, comparing it with the Go type it decodes into
+func walkValue(decoder *json.Decoder, t reflect.Type, path string, pos positions, issues *[]Issue) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	leaf := reflect.PointerTo(t).Implements(unmarshalerType) ||
+		(t.Kind() != reflect.Struct && t.Kind() != reflect.Map && t.Kind() != reflect.Slice)
+	if leaf {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return
+		}
+		if err := json.Unmarshal(raw, reflect.New(t).Interface()); err != nil {
+			*issues = append(*issues, Issue{Path: path, Message: leafError(err)})
+		}
+		return
+	}
+
+	token, err := decoder.Token()
+	if err != nil || token == nil {
+		return
+	}
+	delim, isDelim := token.(json.Delim)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if !isDelim || delim != '{' {
+			*issues = append(*issues, Issue{Path: path, Message: "expected an object"})
+			skipRest(decoder, token)
+			return
+		}
+		fields := jsonFields(t)
+		for decoder.More() {
+			keyToken, _ := decoder.Token()
+			key := keyToken.(string)
+			keyPath := joinPath(path, key)
+			pos[keyPath] = decoder.InputOffset() - int64(len(key)) - 2
+			field, ok := fields[key]
+			if !ok {
+				*issues = append(*issues, Issue{Path: keyPath, Message: "unknown key"})
+				skipValue(decoder)
+				continue
+			}
+			walkValue(decoder, field, keyPath, pos, issues)
+		}
+		decoder.Token() // '}'
+	case reflect.Map:
+		if !isDelim || delim != '{' {
+			*issues = append(*issues, Issue{Path: path, Message: "expected an object"})
+			skipRest(decoder, token)
+			return
+		}
+		for decoder.More() {
+			keyToken, _ := decoder.Token()
+			keyPath := joinPath(path, keyToken.(string))
+			pos[keyPath] = decoder.InputOffset()
+			walkValue(decoder, t.Elem(), keyPath, pos, issues)
+		}
+		decoder.Token()
+	case reflect.Slice:
+		if !isDelim || delim != '[' {
+			*issues = append(*issues, Issue{Path: path, Message: "expected an array"})
+			skipRest(decoder, token)
+			return
+		}
+		for i := 0; decoder.More(); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			pos[elemPath] = decoder.InputOffset()
+			walkValue(decoder, t.Elem(), elemPath, pos, issues)
+		}
+		decoder.Token()
+	}
+}
+
+// json field name -> type for all exported fields of a struct, including those of embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			for name, fieldType := range jsonFields(field.Type) {
+				fields[name] = fieldType
+			}
+			continue
+		}
+		if name := jsonName(t.Field(i)); name != "" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+// JSON key of a struct field, empty for fields not (un)marshaled
+func jsonName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func skipValue(decoder *json.Decoder) {
+	var raw json.RawMessage
+	_ = decoder.Decode(&raw)
+}
+
+// skips the remainder of a container whose opening token was already read
+func skipRest(decoder *json.Decoder, opening json.Token) {
+	if _, isDelim := opening.(json.Delim); !isDelim {
+		return
+	}
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+		if delim, ok := token.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+	}
+}
+
+// strips Go type details from unmarshal errors of leaf values
+func leafError(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)
+	}
+	return err.Error()
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// converts a byte offset into 1-based line and column,
+// separators and whitespace before the value at offset are skipped
+func lineColumn(data []byte, offset int64) (int, int) {
+	for offset < int64(len(data)) && bytes.IndexByte([]byte(" \t\r\n,:"), data[offset]) >= 0 {
+		offset++
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// fails unless Check reports an issue at path, or none there if message is empty
+func expectIssue(t *testing.T, cfg *Config, path, message string) {
+	t.Helper()
+	for _, issue := range cfg.Check() {
+		if issue.Path != path {
+			continue
+		}
+		if message == "" {
+			t.Fatalf("unexpected issue %s", issue)
+		}
+		if !strings.Contains(issue.Message, message) {
+			t.Fatalf("issue %s, expected %q", issue, message)
+		}
+		return
+	}
+	if message != "" {
+		t.Fatalf("no issue at %s, expected %q", path, message)
+	}
+}
+
+func TestCheckSeriesTTLCoversSkipUnchangedRewrites(t *testing.T) {
+	cases := []struct {
+		name    string
+		ttl     time.Duration
+		message string
+	}{
+		{"no expiry", 0, ""},
+		{"long enough", time.Hour, ""},
+		{"shorter than the rewrites", 5 * time.Minute, "seriesTTL must be at least 11m0s"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.SeriesTTL = Duration{c.ttl}
+			cfg.Pollers = []PollerConfig{{URL: "http://vcenter", Metric: "vm_count", Interval: Duration{time.Minute}, SkipUnchanged: true}}
+			expectIssue(t, cfg, "pollers[0].skipUnchanged", c.message)
+		})
+	}
+}
+
+func TestValidateWithoutFileChecksEnvironment(t *testing.T) {
+	if _, issues, err := Validate(""); err != nil || len(issues) > 0 {
+		t.Fatalf("defaults returned %v and issues %v, expected none", err, issues)
+	}
+	t.Setenv("COLLECTOR_MEMORY_GUARD_ENABLED", "true")
+	t.Setenv("COLLECTOR_MEMORY_GUARD_CHECK_INTERVAL", "0s")
+	_, issues, err := Validate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		if issue.Path == "memoryGuard.checkInterval" {
+			return
+		}
+	}
+	t.Fatalf("issues %v, expected one at memoryGuard.checkInterval", issues)
+}
@@ -0,0 +1,19 @@
+package config
+
+// first polls after (re)starts, so Prometheus does not scrape a collector that has
+// nothing but restored values yet
+type WarmupConfig struct {
+	// poll every poller right at startup, as if each had immediateFirstPoll set
+	ImmediateFirstPoll bool `json:"immediateFirstPoll,omitempty"`
+	// /metrics, the scrape endpoints and /ready answer 503 until each poller, SNMP and exec
+	// poller configured at startup completed its first poll, failed or not
+	GateMetrics bool `json:"gateMetrics,omitempty"`
+	// scrapes are served after this long even if polls are still pending, 0 means default
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+func (cfg *Config) checkWarmup(c *checker) {
+	if cfg.Warmup.Timeout.Duration < 0 {
+		c.add("warmup.timeout", "must not be negative")
+	}
+}
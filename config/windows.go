@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// rolling totals of matching counters exposed as gauges, for consumers that cannot run
+// PromQL increase(); "deploys_total" with window "24h" becomes "deploys_last_24h"
+type CounterWindowConfig struct {
+	// glob matched against counter names, e.g. "deploy*_total"
+	Match string `json:"match"`
+	// window lengths like "1h" or "24h"
+	Windows []Duration `json:"windows"`
+}
+
+func (cfg *Config) checkCounterWindows(c *checker) {
+	for i, cw := range cfg.CounterWindows {
+		path := fmt.Sprintf("counterWindows[%d]", i)
+		if _, err := filepath.Match(cw.Match, ""); err != nil || cw.Match == "" {
+			c.add(path+".match", "invalid glob pattern %q", cw.Match)
+		}
+		if len(cw.Windows) == 0 {
+			c.add(path+".windows", "at least one window is required")
+		}
+		for j, window := range cw.Windows {
+			if window.Duration < MIN_COUNTER_WINDOW_SEC*time.Second {
+				c.add(fmt.Sprintf("%s.windows[%d]", path, j), "must be at least %ds", MIN_COUNTER_WINDOW_SEC)
+			}
+		}
+	}
+}
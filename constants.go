@@ -1,5 +0,0 @@
-package main
-
-const DEFAULT_LISTEN_ADDR = ":8080"
-const METRICS_BACKUP_FILE = "metrics_checkpoint.json"
-const METRICS_BACKUP_INTERVAL_SEC = 60
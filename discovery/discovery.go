@@ -0,0 +1,206 @@
+package discovery
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+)
+
+// a running collection task for one discovered entity
+type Target interface {
+	Start()
+	// stops the task and removes the series it wrote, the entity is gone
+	Retire()
+}
+
+// creates the task for an entity from the expanded poller template
+type Factory func(pc config.PollerConfig) (Target, error)
+
+// an inventory entity or service instance
+type entity struct {
+	id   string
+	name string
+	// set for service instances
+	host string
+	port int
+}
+
+// lists the current entities of a discovery source
+type lister func(disc *Discoverer) ([]entity, error)
+
+// discovery types, see config.DiscoveryConfig.Type
+var listers = map[string]lister{
+	"":          (*Discoverer).listInventory,
+	"inventory": (*Discoverer).listInventory,
+	"consul":    (*Discoverer).listConsul,
+	"etcd":      (*Discoverer).listEtcd,
+	"dns-srv":   (*Discoverer).listSRV,
+}
+
+// Discoverer keeps one poller per inventory entity, starting pollers for new entities
+// and stopping them for entities that disappeared, so new clusters show up without config changes
+type Discoverer struct {
+	Config  config.DiscoveryConfig
+	Factory Factory
+	Secrets *secrets.Resolver
+	Auth    poller.Authenticator
+	Client  *http.Client
+	// optional, entities whose poller another collector instance runs are skipped
+	Shard *poller.Shard
+
+	list lister
+
+	lock    sync.Mutex
+	targets map[string]Target
+}
+
+func New(cfg config.DiscoveryConfig, factory Factory, resolver *secrets.Resolver, auth poller.Authenticator) (*Discoverer, error) {
+	list, ok := listers[cfg.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown discovery type %q", cfg.Type)
+	}
+	return &Discoverer{
+		Config:  cfg,
+		Factory: factory,
+		Secrets: resolver,
+		Auth:    auth,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		list:    list,
+		targets: make(map[string]Target),
+	}, nil
+}
+
+// discovers immediately and then every interval
+func (disc *Discoverer) Start() {
+	go func() {
+		disc.refresh()
+		ticker := time.NewTicker(disc.Config.Interval.Duration)
+		defer ticker.Stop()
+		for range ticker.C {
+			disc.refresh()
+		}
+	}()
+}
+
+// reconciles running pollers with the current inventory
+func (disc *Discoverer) refresh() {
+	entities, err := disc.list(disc)
+	if err != nil {
+		// keep current pollers, inventory is temporarily unavailable
+		logger.Error(fmt.Sprintf("Discovery %s failed: %v", disc.Config.Name, err))
+		return
+	}
+
+	disc.lock.Lock()
+	defer disc.lock.Unlock()
+
+	seen := make(map[string]bool, len(entities))
+	for _, e := range entities {
+		seen[e.id] = true
+		if _, running := disc.targets[e.id]; running {
+			continue
+		}
+		pc := expandTemplate(disc.Config.Poller, e)
+		if !disc.Shard.Owns(poller.ShardKey(pc)) {
+			continue
+		}
+		target, err := disc.Factory(pc)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Discovery %s: failed to create poller for %s: %v", disc.Config.Name, e.id, err))
+			continue
+		}
+		target.Start()
+		disc.targets[e.id] = target
+		logger.Info(fmt.Sprintf("Discovery %s: started poller for %s", disc.Config.Name, e.id))
+	}
+
+	for id, target := range disc.targets {
+		if !seen[id] {
+			target.Retire()
+			delete(disc.targets, id)
+			logger.Info(fmt.Sprintf("Discovery %s: retired poller for %s", disc.Config.Name, id))
+		}
+	}
+}
+
+// sends a request to the discovery source and returns the response body
+func (disc *Discoverer) fetch(method, url string, headers map[string]string, payload io.Reader) ([]byte, error) {
+	expand := func(template string) (string, error) {
+		if disc.Secrets == nil {
+			return template, nil
+		}
+		return disc.Secrets.Expand(template)
+	}
+
+	url, err := expand(url)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, payload)
+	if err != nil {
+		return nil, err
+	}
+	for name, template := range headers {
+		value, err := expand(template)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, value)
+	}
+	if disc.Auth != nil {
+		if err := disc.Auth.Authenticate(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := disc.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized && disc.Auth != nil {
+		disc.Auth.Invalidate()
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, poller.DEFAULT_MAX_BODY_BYTES))
+}
+
+// replaces entity placeholders in the poller template
+func expandTemplate(template config.PollerConfig, e entity) config.PollerConfig {
+	address := e.host
+	if e.port != 0 {
+		address = net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	}
+	replacer := strings.NewReplacer(
+		"{{id}}", e.id,
+		"{{name}}", e.name,
+		"{{host}}", e.host,
+		"{{port}}", strconv.Itoa(e.port),
+		"{{address}}", address,
+	)
+
+	pc := template
+	pc.Name = replacer.Replace(template.Name)
+	pc.URL = replacer.Replace(template.URL)
+	pc.Labels = make(map[string]string, len(template.Labels))
+	for k, v := range template.Labels {
+		pc.Labels[k] = replacer.Replace(v)
+	}
+	pc.Headers = make(map[string]string, len(template.Headers))
+	for k, v := range template.Headers {
+		pc.Headers[k] = replacer.Replace(v)
+	}
+	return pc
+}
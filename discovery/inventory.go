@@ -0,0 +1,43 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// fetches the vCenter / Aria inventory list and extracts entity ids and names
+func (disc *Discoverer) listInventory() ([]entity, error) {
+	body, err := disc.fetch(http.MethodGet, disc.Config.URL, disc.Config.Headers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]any
+	if disc.Config.ItemsField == "" {
+		err = json.Unmarshal(body, &items)
+	} else {
+		var wrapper map[string]json.RawMessage
+		if err = json.Unmarshal(body, &wrapper); err == nil {
+			err = json.Unmarshal(wrapper[disc.Config.ItemsField], &items)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inventory: %w", err)
+	}
+
+	entities := make([]entity, 0, len(items))
+	for _, item := range items {
+		id, ok := item[disc.Config.IDField]
+		if !ok {
+			continue
+		}
+		e := entity{id: fmt.Sprint(id)}
+		e.name = e.id
+		if name, ok := item[disc.Config.NameField]; ok && disc.Config.NameField != "" {
+			e.name = fmt.Sprint(name)
+		}
+		entities = append(entities, e)
+	}
+	return entities, nil
+}
@@ -0,0 +1,161 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// instance of a Consul health API response, GET /v1/health/service/<service>
+type consulEntry struct {
+	Node struct {
+		Node    string `json:"Node"`
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string `json:"ID"`
+		Service string `json:"Service"`
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// lists Consul service instances passing all health checks
+func (disc *Discoverer) listConsul() ([]entity, error) {
+	query := url.Values{"passing": {"true"}}
+	if disc.Config.Tag != "" {
+		query.Set("tag", disc.Config.Tag)
+	}
+	endpoint := strings.TrimSuffix(disc.Config.URL, "/") + "/v1/health/service/" + url.PathEscape(disc.Config.Service) + "?" + query.Encode()
+	body, err := disc.fetch(http.MethodGet, endpoint, disc.Config.Headers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []consulEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse consul response: %w", err)
+	}
+	entities := make([]entity, 0, len(entries))
+	for _, entry := range entries {
+		// service address is optional in Consul, the node address is used instead
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		entities = append(entities, entity{
+			id:   entry.Service.ID,
+			name: entry.Node.Node,
+			host: host,
+			port: entry.Service.Port,
+		})
+	}
+	return entities, nil
+}
+
+// etcd v3 JSON gateway range response, POST /v3/kv/range
+type etcdRangeResponse struct {
+	Kvs []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"kvs"`
+}
+
+// lists instances registered under the etcd key prefix with "host:port" values;
+// registrations are expected to be bound to leases so unhealthy instances expire
+func (disc *Discoverer) listEtcd() ([]entity, error) {
+	prefix := []byte(disc.Config.Service)
+	request, err := json.Marshal(map[string]string{
+		"key":       base64.StdEncoding.EncodeToString(prefix),
+		"range_end": base64.StdEncoding.EncodeToString(prefixEnd(prefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	for name, value := range disc.Config.Headers {
+		headers[name] = value
+	}
+	endpoint := strings.TrimSuffix(disc.Config.URL, "/") + "/v3/kv/range"
+	body, err := disc.fetch(http.MethodPost, endpoint, headers, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp etcdRangeResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse etcd response: %w", err)
+	}
+	entities := make([]entity, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		host, port, err := splitHostPort(string(value))
+		if err != nil {
+			return nil, fmt.Errorf("etcd key %s: %w", key, err)
+		}
+		entities = append(entities, entity{
+			id:   strings.TrimPrefix(string(key), disc.Config.Service),
+			name: host,
+			host: host,
+			port: port,
+		})
+	}
+	return entities, nil
+}
+
+// lists the targets of a DNS SRV record
+func (disc *Discoverer) listSRV() ([]entity, error) {
+	_, records, err := net.LookupSRV("", "", disc.Config.Service)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]entity, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		entities = append(entities, entity{
+			id:   net.JoinHostPort(host, strconv.Itoa(int(record.Port))),
+			name: host,
+			host: host,
+			port: int(record.Port),
+		})
+	}
+	return entities, nil
+}
+
+// smallest key greater than all keys with the prefix, used as etcd range end
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// all 0xff, range to the end of the keyspace
+	return []byte{0}
+}
+
+func splitHostPort(address string) (string, int, error) {
+	host, portString, err := net.SplitHostPort(strings.TrimSpace(address))
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in %q", address)
+	}
+	return host, port, nil
+}
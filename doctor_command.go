@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/vcenter"
+)
+
+// statuses of doctor checks, any failed check makes the deployment not ready
+const (
+	doctorOK   = "OK"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+)
+
+// one line of the readiness report
+type doctorCheck struct {
+	Status string
+	Check  string
+	Detail string
+}
+
+type doctorReport struct {
+	checks []doctorCheck
+	out    io.Writer
+}
+
+// records a check and prints it right away, slow DNS or auth checks show progress
+func (report *doctorReport) add(status, check, format string, args ...any) {
+	entry := doctorCheck{Status: status, Check: check, Detail: fmt.Sprintf(format, args...)}
+	report.checks = append(report.checks, entry)
+	fmt.Fprintf(report.out, "%-5s %-11s %s\n", entry.Status, entry.Check, entry.Detail)
+}
+
+func (report *doctorReport) count(status string) int {
+	n := 0
+	for _, check := range report.checks {
+		if check.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// checks a deployment before it goes live: config, DNS of all targets, authentication against
+// each poll target and checkpoint permissions; exits 1 if any check failed
+func doctorCommand(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to JSON config file")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of each DNS and poll check")
+	verbose := flags.Bool("v", false, "print the collector log lines of the checks")
+	flags.Parse(args)
+	if *configPath == "" && flags.NArg() > 0 {
+		*configPath = flags.Arg(0)
+	}
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: collector doctor [-timeout <duration>] [-v] -config <file>")
+		return 2
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	report := &doctorReport{out: os.Stdout}
+	cfg := doctorConfig(report, *configPath)
+	if cfg != nil {
+		resolver := doctorSecrets(report, cfg.Vault)
+		doctorDNS(report, cfg, resolver, *timeout)
+		doctorAuth(report, cfg, resolver, *timeout)
+		doctorPaths(report, cfg)
+	}
+
+	failed, warned := report.count(doctorFail), report.count(doctorWarn)
+	if failed > 0 {
+		fmt.Printf("not ready: %d check(s) failed, %d warning(s)\n", failed, warned)
+		return 1
+	}
+	fmt.Printf("ready: %d check(s) passed, %d warning(s)\n", len(report.checks)-warned, warned)
+	return 0
+}
+
+// the checks of validate-config, the config is returned unless it cannot be loaded at all
+func doctorConfig(report *doctorReport, path string) *config.Config {
+	issues, err := validateConfig(path)
+	if err != nil {
+		report.add(doctorFail, "config", "%s: %v", path, err)
+		return nil
+	}
+	for _, issue := range issues {
+		report.add(doctorFail, "config", "%s", issue)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		report.add(doctorFail, "config", "%s: %v", path, err)
+		return nil
+	}
+	if len(issues) == 0 {
+		report.add(doctorOK, "config", "%s is valid", path)
+	}
+	return cfg
+}
+
+// the resolver of secret placeholders, without Vault if it cannot be reached
+func doctorSecrets(report *doctorReport, vc config.VaultConfig) *secrets.Resolver {
+	resolver, err := newSecretsResolver(vc)
+	if err != nil {
+		report.add(doctorFail, "secrets", "%v", err)
+		return secrets.NewResolver()
+	}
+	if vc.Address != "" {
+		report.add(doctorOK, "secrets", "vault token of %s resolved", vc.Address)
+	}
+	return resolver
+}
+
+// resolves the hostnames of all targets, each host once
+func doctorDNS(report *doctorReport, cfg *config.Config, resolver *secrets.Resolver, timeout time.Duration) {
+	// host -> what refers to it
+	hosts := make(map[string][]string)
+	addURL := func(what, template string) {
+		expanded, err := resolver.Expand(template)
+		if err != nil {
+			report.add(doctorFail, "dns", "%s: %v", what, err)
+			return
+		}
+		parsed, err := url.Parse(expanded)
+		if err != nil || parsed.Hostname() == "" {
+			report.add(doctorFail, "dns", "%s: no host in url %q", what, template)
+			return
+		}
+		hosts[parsed.Hostname()] = append(hosts[parsed.Hostname()], what)
+	}
+
+	for i, pc := range cfg.Pollers {
+		addURL(fmt.Sprintf("pollers[%d]", i), pc.URL)
+		if pc.VCenter != nil {
+			addURL(fmt.Sprintf("pollers[%d].vcenter", i), pc.VCenter.URL)
+		}
+	}
+	for i, dc := range cfg.Discovery {
+		what := fmt.Sprintf("discovery[%d]", i)
+		if dc.Type == "dns-srv" {
+			doctorSRV(report, what, dc.Service, timeout)
+			continue
+		}
+		addURL(what, dc.URL)
+		if dc.VCenter != nil {
+			addURL(what+".vcenter", dc.VCenter.URL)
+		}
+	}
+	for i, bc := range cfg.Blackbox {
+		addURL(fmt.Sprintf("blackbox[%d]", i), bc.URL)
+	}
+	for i, sc := range cfg.SnmpPollers {
+		host := sc.Target
+		if h, _, err := net.SplitHostPort(sc.Target); err == nil {
+			host = h
+		}
+		hosts[host] = append(hosts[host], fmt.Sprintf("snmp[%d]", i))
+	}
+	if cfg.Vault.Address != "" {
+		addURL("vault", cfg.Vault.Address)
+	}
+
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+	for _, host := range names {
+		users := strings.Join(hosts[host], ", ")
+		if net.ParseIP(host) != nil {
+			report.add(doctorOK, "dns", "%s is an address (%s)", host, users)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		cancel()
+		if err != nil {
+			report.add(doctorFail, "dns", "%s (%s): %v", host, users, err)
+			continue
+		}
+		report.add(doctorOK, "dns", "%s -> %s (%s)", host, strings.Join(addrs, " "), users)
+	}
+}
+
+// looks up the SRV records a dns-srv discovery polls
+func doctorSRV(report *doctorReport, what, name string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		report.add(doctorFail, "dns", "%s (%s): %v", name, what, err)
+		return
+	}
+	report.add(doctorOK, "dns", "%s has %d SRV record(s) (%s)", name, len(records), what)
+}
+
+// polls each target once the way the collector would, with its credentials, headers and
+// signature checks; the results are discarded
+func doctorAuth(report *doctorReport, cfg *config.Config, resolver *secrets.Resolver, timeout time.Duration) {
+	sessions := vcenter.NewSessionPool(resolver)
+	// a hub without sinks, nothing polled is kept
+	discard := metrics.NewMetricHub()
+	for i, pc := range cfg.Pollers {
+		p, err := newPoller(pc, discard, resolver, sessions)
+		if err != nil {
+			report.add(doctorFail, "poll", "pollers[%d]: %v", i, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = p.Probe(ctx, discard)
+		cancel()
+		switch {
+		case err == nil:
+			report.add(doctorOK, "poll", "%s: authenticated and processed", p.Name)
+		case errors.Is(err, poller.ErrAuth):
+			report.add(doctorFail, "poll", "%s: authentication rejected: %v", p.Name, err)
+		case errors.Is(err, poller.ErrDecode):
+			// reachable and authenticated, the processor config may still be off
+			report.add(doctorWarn, "poll", "%s: authenticated but response not processed: %v", p.Name, err)
+		default:
+			report.add(doctorFail, "poll", "%s: %v", p.Name, err)
+		}
+	}
+	if len(cfg.Discovery) > 0 {
+		report.add(doctorWarn, "poll", "pollers of %d discovery source(s) are not checked, they exist only at runtime", len(cfg.Discovery))
+	}
+}
+
+// the checkpoint and queue directories must be writable, existing files readable and writable
+func doctorPaths(report *doctorReport, cfg *config.Config) {
+	if cfg.CheckpointFile == "" {
+		report.add(doctorWarn, "checkpoint", "disabled, counters restart from zero")
+	} else {
+		doctorFile(report, "checkpoint", cfg.CheckpointFile)
+	}
+	for i, sc := range cfg.Sinks {
+		if sc.Queue != nil {
+			if doctorDir(report, fmt.Sprintf("sinks[%d].queue", i), sc.Queue.Dir, true) {
+				report.add(doctorOK, fmt.Sprintf("sinks[%d].queue", i), "%s is writable", sc.Queue.Dir)
+			}
+		}
+	}
+}
+
+func doctorFile(report *doctorReport, check, path string) {
+	if !doctorDir(report, check, filepath.Dir(path), false) {
+		return
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		report.add(doctorOK, check, "%s does not exist yet, created at the first save", path)
+		return
+	}
+	if err != nil {
+		report.add(doctorFail, check, "%v", err)
+		return
+	}
+	if info.IsDir() {
+		report.add(doctorFail, check, "%s is a directory", path)
+		return
+	}
+	// O_RDWR without O_TRUNC leaves the file as it is
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		report.add(doctorFail, check, "%v", err)
+		return
+	}
+	file.Close()
+	report.add(doctorOK, check, "%s is readable and writable", path)
+}
+
+// whether files can be created in the directory; queues create theirs, the checkpoint does not
+func doctorDir(report *doctorReport, check, dir string, create bool) bool {
+	if create {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			report.add(doctorFail, check, "%v", err)
+			return false
+		}
+	} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		report.add(doctorFail, check, "directory %s does not exist", dir)
+		return false
+	}
+	probe, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		report.add(doctorFail, check, "directory %s is not writable: %v", dir, err)
+		return false
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return true
+}
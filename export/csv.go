@@ -0,0 +1,28 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// writes rows as CSV with one column per label name, empty where a series lacks the label
+func WriteCSV(w io.Writer, rows []Row, labelNames []string) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(header(labelNames)); err != nil {
+		return err
+	}
+	record := make([]string, len(labelNames)+3)
+	for _, row := range rows {
+		record[0], record[1] = row.Metric, row.Type
+		for i, name := range labelNames {
+			record[i+2] = safeCell(row.Labels[name])
+		}
+		record[len(record)-1] = strconv.FormatFloat(row.Value, 'g', -1, 64)
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,47 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSVNeutralizesFormulas(t *testing.T) {
+	rows := []Row{
+		{Metric: "deploy_total", Type: "counter", Labels: map[string]string{"env": "=HYPERLINK(\"http://x\")"}, Value: -1},
+		{Metric: "deploy_total", Type: "counter", Labels: map[string]string{"env": "prod"}, Value: 2},
+	}
+	var out bytes.Buffer
+	if err := WriteCSV(&out, rows, []string{"env"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{
+		"metric,type,env,value",
+		`deploy_total,counter,"'=HYPERLINK(""http://x"")",-1`,
+		"deploy_total,counter,prod,2",
+	}
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Errorf("line %d is %q, expected %q", i, lines[i], line)
+		}
+	}
+}
+
+func TestSafeCell(t *testing.T) {
+	for cell, expected := range map[string]string{
+		"":        "",
+		"prod":    "prod",
+		"=1+1":    "'=1+1",
+		"+1":      "'+1",
+		"-1":      "'-1",
+		"@SUM(1)": "'@SUM(1)",
+		"\tx":     "'\tx",
+		"\rx":     "'\rx",
+		"a=b":     "a=b",
+	} {
+		if safe := safeCell(cell); safe != expected {
+			t.Errorf("safeCell(%q) = %q, expected %q", cell, safe, expected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package export
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// one series with its decoded labels; histograms and summaries become "<name>_count" and "<name>_sum" rows
+type Row struct {
+	Metric string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// current values of all metrics whose name matches the glob pattern, "" matches all,
+// sorted by metric, plus the sorted union of their label names
+func Collect(gatherer prometheus.Gatherer, pattern string) ([]Row, []string, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows []Row
+	labelNames := map[string]bool{}
+	for _, family := range families {
+		name := family.GetName()
+		if pattern != "" {
+			if ok, _ := path.Match(pattern, name); !ok {
+				continue
+			}
+		}
+		kind := typeName(family.GetType())
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string, len(m.GetLabel()))
+			for _, pair := range m.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+				labelNames[pair.GetName()] = true
+			}
+			switch {
+			case m.Counter != nil:
+				rows = append(rows, Row{name, kind, labels, m.GetCounter().GetValue()})
+			case m.Gauge != nil:
+				rows = append(rows, Row{name, kind, labels, m.GetGauge().GetValue()})
+			case m.Untyped != nil:
+				rows = append(rows, Row{name, kind, labels, m.GetUntyped().GetValue()})
+			case m.Histogram != nil:
+				rows = append(rows,
+					Row{name + "_count", kind, labels, float64(m.GetHistogram().GetSampleCount())},
+					Row{name + "_sum", kind, labels, m.GetHistogram().GetSampleSum()})
+			case m.Summary != nil:
+				rows = append(rows,
+					Row{name + "_count", kind, labels, float64(m.GetSummary().GetSampleCount())},
+					Row{name + "_sum", kind, labels, m.GetSummary().GetSampleSum()})
+			}
+		}
+	}
+
+	names := make([]string, 0, len(labelNames))
+	for name := range labelNames {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return rows, names, nil
+}
+
+func typeName(kind dto.MetricType) string {
+	switch kind {
+	case dto.MetricType_COUNTER:
+		return "counter"
+	case dto.MetricType_GAUGE:
+		return "gauge"
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		return "histogram"
+	case dto.MetricType_SUMMARY:
+		return "summary"
+	}
+	return "untyped"
+}
+
+// neutralizes a text cell spreadsheets would run as a formula, e.g. a pushed label value
+// "=HYPERLINK(...)", by prefixing it with a quote
+func safeCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// column titles of the exported table
+func header(labelNames []string) []string {
+	return append(append([]string{"metric", "type"}, labelNames...), "value")
+}
@@ -0,0 +1,111 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// the fixed parts of a single-sheet workbook (Office Open XML SpreadsheetML)
+var xlsxParts = map[string]string{
+	"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`,
+	"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`,
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="metrics" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`,
+}
+
+// order of the fixed parts in the archive, [Content_Types].xml must come first for some readers
+var xlsxPartOrder = []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"}
+
+// writes rows as an Excel workbook with the same columns as WriteCSV; values are numeric cells,
+// so they can be summed and charted right away
+func WriteXLSX(w io.Writer, rows []Row, labelNames []string) error {
+	archive := zip.NewWriter(w)
+	for _, name := range xlsxPartOrder {
+		part, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(part, xlsxParts[name]); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var out strings.Builder
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	out.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	writeXLSXRow(&out, 1, header(labelNames), nil)
+	cells := make([]string, len(labelNames)+2)
+	for i, row := range rows {
+		cells[0], cells[1] = row.Metric, row.Type
+		for j, name := range labelNames {
+			cells[j+2] = row.Labels[name]
+		}
+		value := row.Value
+		writeXLSXRow(&out, i+2, cells, &value)
+		// flush large sheets in chunks instead of holding the whole document
+		if out.Len() > 64*1024 {
+			if _, err := io.WriteString(sheet, out.String()); err != nil {
+				return err
+			}
+			out.Reset()
+		}
+	}
+	out.WriteString(`</sheetData></worksheet>`)
+	if _, err := io.WriteString(sheet, out.String()); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// string cells followed by an optional numeric cell
+func writeXLSXRow(out *strings.Builder, number int, cells []string, value *float64) {
+	fmt.Fprintf(out, `<row r="%d">`, number)
+	for i, cell := range cells {
+		fmt.Fprintf(out, `<c r="%s%d" t="inlineStr"><is><t>`, column(i), number)
+		xml.EscapeText(out, []byte(safeCell(cell)))
+		out.WriteString(`</t></is></c>`)
+	}
+	if value != nil {
+		ref := fmt.Sprintf("%s%d", column(len(cells)), number)
+		if math.IsNaN(*value) || math.IsInf(*value, 0) {
+			// spreadsheets have no NaN or infinity, keep them readable as text
+			fmt.Fprintf(out, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, strconv.FormatFloat(*value, 'g', -1, 64))
+		} else {
+			fmt.Fprintf(out, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(*value, 'g', -1, 64))
+		}
+	}
+	out.WriteString(`</row>`)
+}
+
+// spreadsheet column name of a zero-based index: A, B, ..., Z, AA, ...
+func column(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,13 @@
+package grafana
+
+// panels per dashboard row
+const PANELS_PER_ROW = 2
+
+const PANEL_WIDTH = 24 / PANELS_PER_ROW
+const PANEL_HEIGHT = 8
+
+// range of rate() and increase() in generated queries
+const RATE_WINDOW = "5m"
+
+// schema version of the generated dashboard JSON
+const SCHEMA_VERSION = 39
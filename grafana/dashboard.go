@@ -0,0 +1,193 @@
+package grafana
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Grafana dashboard JSON model, only the fields the generator sets
+type Dashboard struct {
+	Title         string     `json:"title"`
+	UID           string     `json:"uid,omitempty"`
+	Tags          []string   `json:"tags"`
+	Timezone      string     `json:"timezone"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          TimeRange  `json:"time"`
+	Templating    Templating `json:"templating"`
+	Panels        []Panel    `json:"panels"`
+}
+
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+type Variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type Panel struct {
+	ID          int         `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	Type        string      `json:"type"`
+	Datasource  Datasource  `json:"datasource"`
+	GridPos     GridPos     `json:"gridPos"`
+	Targets     []Target    `json:"targets"`
+	FieldConfig FieldConfig `json:"fieldConfig"`
+}
+
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type GridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type Target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+type FieldConfig struct {
+	Defaults FieldDefaults `json:"defaults"`
+}
+
+type FieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+}
+
+// generator options, zero values give a dashboard of all collector metrics
+type Options struct {
+	Title string
+	// include Go runtime and process metrics of the collector itself
+	IncludeRuntime bool
+}
+
+var datasource = Datasource{Type: "prometheus", UID: "${datasource}"}
+
+// builds a starter dashboard with one time series panel per metric family
+func Generate(families []*dto.MetricFamily, opts Options) *Dashboard {
+	title := opts.Title
+	if title == "" {
+		title = "vSphere metrics collector"
+	}
+	dashboard := &Dashboard{
+		Title:         title,
+		Tags:          []string{"vsphere", "generated"},
+		Timezone:      "browser",
+		SchemaVersion: SCHEMA_VERSION,
+		Refresh:       "1m",
+		Time:          TimeRange{From: "now-6h", To: "now"},
+		Templating: Templating{List: []Variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+		}},
+		Panels: []Panel{},
+	}
+
+	sorted := slices.Clone(families)
+	slices.SortFunc(sorted, func(a, b *dto.MetricFamily) int { return strings.Compare(a.GetName(), b.GetName()) })
+	for _, family := range sorted {
+		if !opts.IncludeRuntime && isRuntime(family.GetName()) {
+			continue
+		}
+		target, ok := query(family)
+		if !ok {
+			continue
+		}
+		n := len(dashboard.Panels)
+		dashboard.Panels = append(dashboard.Panels, Panel{
+			ID:          n + 1,
+			Title:       family.GetName(),
+			Description: family.GetHelp(),
+			Type:        "timeseries",
+			Datasource:  datasource,
+			GridPos:     GridPos{X: (n % PANELS_PER_ROW) * PANEL_WIDTH, Y: (n / PANELS_PER_ROW) * PANEL_HEIGHT, W: PANEL_WIDTH, H: PANEL_HEIGHT},
+			Targets:     []Target{target},
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: unit(family)}},
+		})
+	}
+	return dashboard
+}
+
+// per-second rates for counters, 95th percentile for histograms and summaries, raw values for gauges
+func query(family *dto.MetricFamily) (Target, bool) {
+	name := family.GetName()
+	legend := legendFormat(family)
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		return Target{RefID: "A", Expr: fmt.Sprintf("rate(%s[%s])", name, RATE_WINDOW), LegendFormat: legend}, true
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		return Target{RefID: "A", Expr: name, LegendFormat: legend}, true
+	case dto.MetricType_HISTOGRAM:
+		by := append([]string{"le"}, labelNames(family)...)
+		return Target{RefID: "A", Expr: fmt.Sprintf("histogram_quantile(0.95, sum by (%s) (rate(%s_bucket[%s])))", strings.Join(by, ", "), name, RATE_WINDOW), LegendFormat: legend}, true
+	case dto.MetricType_SUMMARY:
+		return Target{RefID: "A", Expr: fmt.Sprintf(`%s{quantile="0.95"}`, name), LegendFormat: legend}, true
+	}
+	return Target{}, false
+}
+
+// "{{label}} ..." over the labels of the family, so series are told apart without the metric name
+func legendFormat(family *dto.MetricFamily) string {
+	var parts []string
+	for _, name := range labelNames(family) {
+		parts = append(parts, "{{"+name+"}}")
+	}
+	return strings.Join(parts, " ")
+}
+
+// label names used by any series of the family
+func labelNames(family *dto.MetricFamily) []string {
+	var names []string
+	for _, m := range family.GetMetric() {
+		for _, pair := range m.GetLabel() {
+			if !slices.Contains(names, pair.GetName()) {
+				names = append(names, pair.GetName())
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Grafana unit derived from the canonical name suffix
+func unit(family *dto.MetricFamily) string {
+	name := strings.TrimSuffix(family.GetName(), "_total")
+	counter := family.GetType() == dto.MetricType_COUNTER
+	switch {
+	case strings.HasSuffix(name, "_bytes"):
+		if counter {
+			return "Bps"
+		}
+		return "bytes"
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(name, "_ratio"):
+		return "percentunit"
+	case counter:
+		return "ops"
+	}
+	return ""
+}
+
+func isRuntime(name string) bool {
+	return strings.HasPrefix(name, "go_") || strings.HasPrefix(name, "process_") || strings.HasPrefix(name, "promhttp_")
+}
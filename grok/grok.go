@@ -0,0 +1,65 @@
+// Package grok expands grok-style pattern references in regular expressions,
+// shared by the rules of the syslog receiver and the file tailer
+package grok
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// patterns usable as %{NAME} or %{NAME:label}
+var patterns = map[string]string{
+	"WORD":         `\w+`,
+	"NOTSPACE":     `\S+`,
+	"DATA":         `.*?`,
+	"GREEDYDATA":   `.*`,
+	"INT":          `[+-]?\d+`,
+	"NUMBER":       `[+-]?\d+(?:\.\d+)?`,
+	"IP":           `(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+`,
+	"HOSTNAME":     `[0-9A-Za-z][0-9A-Za-z_.-]*`,
+	"USERNAME":     `[a-zA-Z0-9._@\\-]+`,
+	"QUOTEDSTRING": `"(?:[^"\\]|\\.)*"`,
+}
+
+var reference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// compiles a regular expression with %{PATTERN} references, %{PATTERN:label} becomes
+// the named group label
+func Compile(pattern string) (*regexp.Regexp, error) {
+	var unknown []string
+	expanded := reference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		parts := reference.FindStringSubmatch(ref)
+		expansion, ok := patterns[parts[1]]
+		if !ok {
+			unknown = append(unknown, parts[1])
+			return ref
+		}
+		if parts[2] == "" {
+			return "(?:" + expansion + ")"
+		}
+		return "(?P<" + parts[2] + ">" + expansion + ")"
+	})
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown patterns %s", strings.Join(unknown, ", "))
+	}
+	return regexp.Compile(expanded)
+}
+
+// named groups of a match as labels added to static, nil if text does not match
+func Match(pattern *regexp.Regexp, text string, static map[string]string) map[string]string {
+	groups := pattern.FindStringSubmatch(text)
+	if groups == nil {
+		return nil
+	}
+	labels := make(map[string]string, len(static)+len(groups))
+	for name, value := range static {
+		labels[name] = value
+	}
+	for i, name := range pattern.SubexpNames() {
+		if name != "" {
+			labels[name] = groups[i]
+		}
+	}
+	return labels
+}
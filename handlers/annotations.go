@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/annotations"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+)
+
+// Optional store of events served as annotations, nil disables the annotation endpoints
+var Annotations *annotations.Store
+
+// AnnotationPushHandler records an event, e.g. a deployment; the response matches Grafana's
+// POST /api/annotations, so scripts annotating Grafana can point here
+// POST JSON: {"time":1700000000000,"timeEnd":1700000600000,"text":"Deployed vsphere-agent 1.4.2","tags":["deploy"]}
+func AnnotationPushHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if Annotations == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "annotations are disabled")
+		return
+	}
+	var event annotations.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		writeBodyError(w, r, err, "invalid annotation")
+		return
+	}
+	event.ID = 0
+	event.Source = annotations.SOURCE_PUSH
+	added, err := Annotations.Add(event)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_PAYLOAD, "", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		ID      int64  `json:"id"`
+		Message string `json:"message"`
+	}{added.ID, "Annotation added"})
+}
+
+// AnnotationUpdateHandler ends or edits a recorded event, e.g. when a deployment finished
+// PATCH /annotations/{id} JSON: {"timeEnd":1700000600000}
+func AnnotationUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if Annotations == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "annotations are disabled")
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "id", "id must be a number")
+		return
+	}
+	var change annotations.Change
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		writeBodyError(w, r, err, "invalid annotation change")
+		return
+	}
+	updated, err := Annotations.Update(id, change)
+	if errors.Is(err, annotations.ErrNotFound) {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "id", err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_PAYLOAD, "", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// AnnotationsHandler lists events in the shape of Grafana's annotations HTTP API, newest first,
+// for Grafana data sources reading JSON APIs; from and to are epoch milliseconds, tags repeat
+// GET /api/annotations?from=1700000000000&to=1700003600000&tags=deploy&matchAny=false&limit=100
+func AnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if Annotations == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "annotations are disabled")
+		return
+	}
+	query := r.URL.Query()
+	var filter annotations.Filter
+	for _, param := range []struct {
+		name   string
+		target *int64
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := query.Get(param.name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_FIELD, param.name, "must be epoch milliseconds")
+				return
+			}
+			*param.target = parsed
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "limit", "must be a positive number")
+			return
+		}
+		filter.Limit = limit
+	}
+	filter.Tags = query["tags"]
+	filter.MatchAny = query.Get("matchAny") == "true"
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Annotations.Query(filter))
+}
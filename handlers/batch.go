@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// sample of a batch push, the optional ID lets agents retry a whole batch
+// without samples accepted the first time being recorded twice
+type BatchSample struct {
+	ID string `json:"id,omitempty"`
+	PushEvent
+}
+
+// POST JSON: {"samples":[{"id":"a1","name":"my_metric","type":"counter","value":1}, ...]}
+type BatchRequest struct {
+	Samples []BatchSample `json:"samples"`
+}
+
+// outcome of one sample, Code, Field and Error are set for rejected samples
+type BatchResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	// one of the BATCH_* constants, only quota_exceeded is worth retrying as is
+	Status string `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Field  string `json:"field,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// 207 response body of a batch push
+type BatchResponse struct {
+	Accepted      int           `json:"accepted"`
+	Rejected      int           `json:"rejected"`
+	QuotaExceeded int           `json:"quotaExceeded"`
+	Duplicates    int           `json:"duplicates"`
+	Results       []BatchResult `json:"results"`
+	RequestID     string        `json:"requestId,omitempty"`
+}
+
+// sample IDs recently accepted per source, the oldest are forgotten first
+type recentIDs struct {
+	mu sync.Mutex
+	// key -> generation of the claim holding it
+	seen map[string]uint64
+	ring []claimedID
+	next int
+	// generation of the last claim
+	claims uint64
+}
+
+// a ring slot; a released and claimed again key has a newer generation, so evicting the
+// slot of the old claim leaves it alone
+type claimedID struct {
+	key        string
+	generation uint64
+}
+
+var batchIDs = &recentIDs{seen: make(map[string]uint64)}
+
+// reserves the ID, false if it was already accepted or is in flight
+func (ids *recentIDs) claim(key string) bool {
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	if _, ok := ids.seen[key]; ok {
+		return false
+	}
+	ids.claims++
+	entry := claimedID{key: key, generation: ids.claims}
+	if len(ids.ring) < MAX_BATCH_DEDUP_IDS {
+		ids.ring = append(ids.ring, entry)
+	} else {
+		evicted := ids.ring[ids.next]
+		if ids.seen[evicted.key] == evicted.generation {
+			delete(ids.seen, evicted.key)
+		}
+		ids.ring[ids.next] = entry
+		ids.next = (ids.next + 1) % MAX_BATCH_DEDUP_IDS
+	}
+	ids.seen[key] = entry.generation
+	return true
+}
+
+// frees the ID of a sample that was not recorded, so a retry is accepted;
+// its ring slot is reclaimed when it comes up for eviction
+func (ids *recentIDs) release(key string) {
+	ids.mu.Lock()
+	delete(ids.seen, key)
+	ids.mu.Unlock()
+}
+
+// BatchHandler records many pushes at once and reports the outcome of each sample
+// with 207 Multi-Status, so agents know exactly which samples to retry
+func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, r, err, "read error")
+		return
+	}
+	if !verifySignature(w, r, body) {
+		return
+	}
+	var batch BatchRequest
+	if err := json.Unmarshal(body, &batch); err != nil {
+		writeBodyError(w, r, err, "invalid payload")
+		return
+	}
+	if len(batch.Samples) == 0 {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_MISSING_FIELD, "samples", "missing samples")
+		return
+	}
+	if len(batch.Samples) > MAX_BATCH_SAMPLES {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "samples", fmt.Sprintf("too many samples, at most %d per batch", MAX_BATCH_SAMPLES))
+		return
+	}
+	source := requestSource(r)
+	if !Sources.Accept(source) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_UNKNOWN_SOURCE, "", "unknown push source")
+		return
+	}
+
+	defaults := defaultLabels("/push/batch", source, auth.FromContext(r.Context()))
+	resp := BatchResponse{Results: make([]BatchResult, len(batch.Samples)), RequestID: logger.RequestID(r.Context())}
+	for i := range batch.Samples {
+		sample := &batch.Samples[i]
+		result := BatchResult{Index: i, ID: sample.ID, Status: BATCH_ACCEPTED}
+		key := source + "\x00" + sample.ID
+		if sample.ID != "" && !batchIDs.claim(key) {
+			result.Status = BATCH_DUPLICATE
+			resp.Duplicates++
+			resp.Results[i] = result
+			continue
+		}
+		rejection := applyPush(r.Context(), source, defaults, &sample.PushEvent)
+		if rejection == nil {
+			resp.Accepted++
+			resp.Results[i] = result
+			continue
+		}
+		if sample.ID != "" {
+			batchIDs.release(key)
+		}
+		result.Status = BATCH_REJECTED
+		if rejection.code == apierror.CODE_QUOTA_EXCEEDED {
+			result.Status = BATCH_QUOTA_EXCEEDED
+			resp.QuotaExceeded++
+		} else {
+			resp.Rejected++
+		}
+		result.Code, result.Field, result.Error = rejection.code, rejection.field, rejection.message
+		resp.Results[i] = result
+	}
+	if resp.Rejected+resp.QuotaExceeded > 0 {
+		logger.InfoCtx(r.Context(), fmt.Sprintf("Batch from %s: %d accepted, %d rejected, %d over quota, %d duplicates",
+			source, resp.Accepted, resp.Rejected, resp.QuotaExceeded, resp.Duplicates))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+	json.NewEncoder(w).Encode(resp)
+}
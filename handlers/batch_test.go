@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRecentIDsKeepReclaimedIDs(t *testing.T) {
+	ids := &recentIDs{seen: make(map[string]uint64)}
+	ids.claim("a")
+	ids.release("a")
+	// the retry of a claims a newer slot
+	for i := 0; i < MAX_BATCH_DEDUP_IDS/2; i++ {
+		ids.claim(fmt.Sprintf("filler-%d", i))
+	}
+	if !ids.claim("a") {
+		t.Fatal("released ID was not accepted again")
+	}
+	// evicts the slot of the first claim of a, but not the retry
+	for i := MAX_BATCH_DEDUP_IDS / 2; i < MAX_BATCH_DEDUP_IDS; i++ {
+		ids.claim(fmt.Sprintf("filler-%d", i))
+	}
+	if ids.claim("a") {
+		t.Fatal("retried ID was forgotten when the slot of its released claim was evicted")
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/audit"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/chaos"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// Optional failure injection, only set when the collector was started with -chaos
+var Chaos *chaos.Injector
+
+// ChaosHandler reports or replaces what is injected; PUT replaces all settings, DELETE stops injection
+// GET|PUT|DELETE /admin/chaos
+func ChaosHandler(w http.ResponseWriter, r *http.Request) {
+	if Chaos == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "failure injection is disabled, start the collector with -chaos")
+		return
+	}
+	var settings chaos.Settings
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeBodyError(w, r, err, "invalid payload")
+			return
+		}
+		fallthrough
+	case http.MethodDelete:
+		before, err := Chaos.Set(settings)
+		if err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_PAYLOAD, "", err.Error())
+			return
+		}
+		after := Chaos.Settings()
+		entry := audit.EntryOf(r)
+		entry.Action, entry.Before, entry.After = "set_chaos", before, after
+		encoded, _ := json.Marshal(after)
+		logger.WarnCtx(r.Context(), fmt.Sprintf("Failure injection set to %s via admin API", encoded))
+	default:
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Chaos.Settings())
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+)
+
+// Optional sink compared with its checkpoint by CheckpointDiffHandler, nil disables it
+var PromSink *prometheus.PrometheusSink
+
+// a series differing between the saved checkpoint and the live state,
+// Saved is nil for series not in the checkpoint, Live for series no longer exposed
+type SeriesDivergence struct {
+	Type   string   `json:"type"`
+	Name   string   `json:"name"`
+	Labels string   `json:"labels"`
+	Saved  *float64 `json:"saved,omitempty"`
+	Live   *float64 `json:"live,omitempty"`
+	Delta  *float64 `json:"delta,omitempty"`
+}
+
+type CheckpointDiffResponse struct {
+	SavedAt time.Time          `json:"savedAt"`
+	Added   int                `json:"added"`
+	Removed int                `json:"removed"`
+	Changed int                `json:"changed"`
+	Series  []SeriesDivergence `json:"series"`
+}
+
+// CheckpointDiffHandler reports series whose live values differ from the last saved checkpoint,
+// to debug restores; counters normally grow between saves, so only unexpected drops and
+// series present on one side are anomalies
+// GET /admin/checkpoint/diff
+func CheckpointDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if PromSink == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "checkpointing is disabled")
+		return
+	}
+	savedAt, changes, err := PromSink.DiffCheckpoint()
+	switch {
+	case errors.Is(err, prometheus.ErrNoCheckpoint), errors.Is(err, prometheus.ErrCheckpointNotSaved):
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", err.Error())
+		return
+	case err != nil:
+		logger.ErrorCtx(r.Context(), fmt.Sprintf("Failed to compare with checkpoint: %v", err))
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CODE_INTERNAL, "", "failed to read checkpoint")
+		return
+	}
+
+	response := CheckpointDiffResponse{SavedAt: savedAt, Series: make([]SeriesDivergence, 0, len(changes))}
+	for _, change := range changes {
+		divergence := SeriesDivergence{Type: change.Series.Type, Name: change.Series.Name, Labels: change.Series.LabelsKey,
+			Saved: change.Old, Live: change.New}
+		switch {
+		case change.Old == nil:
+			response.Added++
+		case change.New == nil:
+			response.Removed++
+		default:
+			response.Changed++
+			delta := *change.New - *change.Old
+			divergence.Delta = &delta
+		}
+		response.Series = append(response.Series, divergence)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
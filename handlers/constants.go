@@ -0,0 +1,39 @@
+package handlers
+
+// samples accepted in a single batch push
+const MAX_BATCH_SAMPLES = 5000
+
+// sample IDs remembered per collector to report retried samples as duplicates
+const MAX_BATCH_DEDUP_IDS = 100000
+
+// per-sample results of batch pushes
+const BATCH_ACCEPTED = "accepted"
+const BATCH_REJECTED = "rejected"
+const BATCH_QUOTA_EXCEEDED = "quota_exceeded"
+const BATCH_DUPLICATE = "duplicate"
+
+const DEFAULT_UDP_MAX_DATAGRAM_BYTES = 8192
+
+// datagrams received on the UDP listener
+const UDP_RECEIVED_METRIC = "collector_udp_datagrams_total"
+
+// datagrams not recorded, labelled by reason ("oversized", "malformed" or "rejected")
+const UDP_DROPPED_METRIC = "collector_udp_dropped_total"
+
+const UDP_PUBLISH_INTERVAL_SEC = 1
+
+// series added to every /probe response
+const PROBE_SUCCESS_METRIC = "probe_success"
+const PROBE_DURATION_METRIC = "probe_duration_seconds"
+
+// probe timeout without X-Prometheus-Scrape-Timeout-Seconds, and the part of an announced
+// timeout left for writing the response
+const DEFAULT_PROBE_TIMEOUT_SEC = 10
+const PROBE_TIMEOUT_MARGIN_SEC = 0.5
+
+// states a state-set series may have, pushes adding more are rejected
+const MAX_STATESET_STATES = 64
+
+// state sets not pushed for a day are forgotten, see stateSets
+const STATESET_IDLE_SEC = 24 * 60 * 60
+const STATESET_SWEEP_SEC = 60 * 60
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/grafana"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// DashboardHandler returns a starter Grafana dashboard for the registered metrics
+// GET /api/v1/dashboard?title=<title>&runtime=true
+func DashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	families, err := Gatherer.Gather()
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Sprintf("Failed to gather metrics for dashboard: %v", err))
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CODE_INTERNAL, "", "failed to gather metrics")
+		return
+	}
+	dashboard := grafana.Generate(families, grafana.Options{
+		Title:          r.URL.Query().Get("title"),
+		IncludeRuntime: r.URL.Query().Get("runtime") == "true",
+	})
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(dashboard)
+}
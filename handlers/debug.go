@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+)
+
+// Optional, last responses of pollers served by PollerResponseHandler, nil disables it
+var Recorder *poller.Recorder
+
+// PollerResponseHandler returns the last raw response of a poller with the gauges made of it,
+// to tell an endpoint returning wrong values from a processor misreading them
+// GET /debug/pollers/{name}/last-response
+func PollerResponseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if Recorder == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "recording of responses is disabled")
+		return
+	}
+	response, ok := Recorder.Last(r.PathValue("name"))
+	if !ok {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "name", "no response of this poller yet")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	// bodies are mostly JSON or HTML, kept readable
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(response)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"maps"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
+)
+
+// Optional endpoint ("/event", "/push", "/push/batch" or "udp") -> labels added to its pushes
+// lacking them, so agents unable to send labels are still attributed; nil disables it
+var EndpointLabels map[string]map[string]string
+
+// default labels of pushes from a source to an endpoint, those of the source's inventory group
+// win over the endpoint's and those of the pushing token over both; the result must not be modified
+func defaultLabels(endpoint, source string, id *auth.Identity) map[string]string {
+	var tokenLabels map[string]string
+	if id != nil {
+		tokenLabels = id.DefaultLabels
+	}
+	var defaults map[string]string
+	shared := true
+	for _, labels := range []map[string]string{EndpointLabels[endpoint], Sources.Labels(source), tokenLabels} {
+		switch {
+		case len(labels) == 0:
+		case defaults == nil:
+			defaults = labels
+		default:
+			if shared {
+				defaults, shared = maps.Clone(defaults), false
+			}
+			maps.Copy(defaults, labels)
+		}
+	}
+	return defaults
+}
+
+// adds the defaults missing from labels, pushed values always win
+func withDefaults(labels, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return labels
+	}
+	if labels == nil {
+		labels = make(map[string]string, len(defaults))
+	}
+	for name, value := range defaults {
+		if _, pushed := labels[name]; !pushed {
+			labels[name] = value
+		}
+	}
+	return labels
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/sources"
+)
+
+func TestDefaultLabelsPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	inventory := `[{"targets": ["10.0.0.5"], "labels": {"site": "inventory", "team": "inventory"}}]`
+	if err := os.WriteFile(filepath.Join(dir, "sources.json"), []byte(inventory), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	Sources = sources.NewInventory(config.PushSourcesConfig{Dir: dir, RefreshInterval: config.Duration{Duration: time.Hour}}, metrics.NewMetricHub())
+	if err := Sources.Start(); err != nil {
+		t.Fatal(err)
+	}
+	EndpointLabels = map[string]map[string]string{"/push": {"site": "endpoint", "team": "endpoint", "env": "prod"}}
+	defer func() { EndpointLabels, Sources = nil, nil }()
+	id := &auth.Identity{Name: "a", DefaultLabels: map[string]string{"team": "token"}}
+
+	defaults := defaultLabels("/push", "ip:10.0.0.5", id)
+	expected := map[string]string{"site": "inventory", "team": "token", "env": "prod"}
+	if !maps.Equal(defaults, expected) {
+		t.Fatalf("defaults %v, expected %v", defaults, expected)
+	}
+	if EndpointLabels["/push"]["team"] != "endpoint" || Sources.Labels("ip:10.0.0.5")["team"] != "inventory" {
+		t.Fatal("endpoint or inventory labels were modified")
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/export"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	client "github.com/prometheus/client_golang/prometheus"
+)
+
+// registry read by the export endpoint, the same one /metrics serves
+var Gatherer client.Gatherer = client.DefaultGatherer
+
+// ExportHandler returns the current metric values as a table for spreadsheets
+// GET /api/v1/export?format=csv|xlsx&metric=<glob>
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "format", "unknown format (use 'csv' or 'xlsx')")
+		return
+	}
+
+	rows, labelNames, err := export.Collect(Gatherer, r.URL.Query().Get("metric"))
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Sprintf("Failed to gather metrics for export: %v", err))
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CODE_INTERNAL, "", "failed to gather metrics")
+		return
+	}
+
+	filename := "metrics-" + time.Now().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "xlsx" {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		err = export.WriteXLSX(w, rows, labelNames)
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = export.WriteCSV(w, rows, labelNames)
+	}
+	if err != nil {
+		logger.WarnCtx(r.Context(), fmt.Sprintf("Failed to write %s export: %v", format, err))
+	}
+}
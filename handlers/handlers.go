@@ -1,18 +1,54 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/audit"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/quota"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/sources"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
 )
 
 // This handlers package expects a global MetricHub instance set by main
 var Hub *metrics.MetricHub
 
+// Optional series creation quota per pushing client, nil disables it
+var Quota *quota.SeriesQuota
+
+// Optional audit log of admin operations, nil disables auditing
+var Audit *audit.Log
+
+// Optional inventory of expected push sources, nil accepts all sources
+var Sources *sources.Inventory
+
+// Optional conversion of gauges declared cumulative into counter + rate, nil disables it
+var Cumulative *metrics.CumulativeConverter
+
+// Optional merging of gauges pushed by several sources, nil keeps the last pushed value
+var GaugeMerge *metrics.GaugeMerger
+
+// Optional label set to the client certificate identity on pushed series, empty disables it
+var CertSourceLabel string
+
+// Optional HMAC signature required on pushed payloads, nil disables it
+var PushSignature *auth.Verifier
+
 // Legacy event structure
 type LegacyEvent struct {
 	Status    string `json:"status"`
@@ -22,9 +58,82 @@ type LegacyEvent struct {
 // Generic push structure for extensibility
 type PushEvent struct {
 	Name   string            `json:"name"`             // metric name
-	Type   string            `json:"type"`             // "counter" or "gauge"
+	Type   string            `json:"type"`             // "counter", "gauge", "histogram", "summary", "bool", "stateset" or "info"
 	Value  float64           `json:"value"`            // numeric value
 	Labels map[string]string `json:"labels,omitempty"` // optional labels
+
+	// "bool": true/false, "enabled"/"disabled", "on"/"off", ... recorded as a 0/1 gauge
+	// "stateset": the current state, recorded as a gauge per state labelled <name>="<state>",
+	// 1 for the current one and 0 for States and states pushed before
+	State  State    `json:"state,omitempty"`
+	States []string `json:"states,omitempty"`
+	// "info": labels telling entities apart, e.g. ["vcenter"]; the series is set to 1 and
+	// replaces the entity's previous series when its other labels (versions, builds) change
+	Identity []string `json:"identity,omitempty"`
+}
+
+// request body, decoder and decoded event of a push, pooled since allocations per push
+// dominate CPU at thousands of pushes per second
+type pushBuffer struct {
+	body    bytes.Buffer
+	reader  bytes.Reader
+	decoder *json.Decoder // reads reader, replaced after a failed decode
+	labels  map[string]string
+	event   PushEvent
+}
+
+var pushBuffers = sync.Pool{New: func() any {
+	buf := &pushBuffer{}
+	buf.decoder = json.NewDecoder(&buf.reader)
+	return buf
+}}
+
+// larger buffers are dropped instead of being kept in the pool
+const MAX_POOLED_PUSH_BYTES = 64 * 1024
+
+// reads and decodes a push into a pooled buffer, which must be released with releasePush
+// the event, including its labels map, is only valid until then; applyPush hands copies
+// of the labels to sinks
+func decodePush(r *http.Request) (*pushBuffer, error) {
+	buf := pushBuffers.Get().(*pushBuffer)
+	buf.body.Reset()
+	// the event's labels are replaced by a copy once handed to sinks, see applyPush
+	clear(buf.labels)
+	buf.event = PushEvent{Labels: buf.labels}
+
+	if _, err := buf.body.ReadFrom(r.Body); err != nil {
+		releasePush(buf)
+		return nil, err
+	}
+	buf.reader.Reset(buf.body.Bytes())
+	if err := buf.decode(); err != nil {
+		// the decoder may hold an error or the rest of the body
+		buf.decoder = json.NewDecoder(&buf.reader)
+		releasePush(buf)
+		return nil, err
+	}
+	if buf.labels == nil {
+		buf.labels = buf.event.Labels
+	}
+	return buf, nil
+}
+
+// decodes the body as a single JSON value, like json.Unmarshal
+func (buf *pushBuffer) decode() error {
+	if err := buf.decoder.Decode(&buf.event); err != nil {
+		return err
+	}
+	if _, err := buf.decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+func releasePush(buf *pushBuffer) {
+	if buf.body.Cap() > MAX_POOLED_PUSH_BYTES {
+		return
+	}
+	pushBuffers.Put(buf)
 }
 
 // EventHandler handles legacy events like {"status":"success","errorType":""}
@@ -32,52 +141,290 @@ func EventHandler(w http.ResponseWriter, r *http.Request) {
 	var e LegacyEvent
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "read error", http.StatusBadRequest)
+		writeBodyError(w, r, err, "read error")
+		return
+	}
+	if !verifySignature(w, r, body) {
 		return
 	}
 	if err := json.Unmarshal(body, &e); err != nil {
-		http.Error(w, "invalid legacy event", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_PAYLOAD, "", "invalid legacy event")
 		return
 	}
 
 	if e.Status == "" {
-		http.Error(w, "missing status", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_MISSING_FIELD, "status", "missing status")
 		return
 	}
 
-	// increment events_total{status="<status>"} and optionally event_errors_total{type="<error>"}
-	Hub.IncCounter("events_total", map[string]string{"status": e.Status})
+	source := requestSource(r)
+	if !Sources.Accept(source) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_UNKNOWN_SOURCE, "", "unknown push source")
+		return
+	}
+
+	id := auth.FromContext(r.Context())
+	if !id.CanPush("events_total") || (e.ErrorType != "" && !id.CanPush("event_errors_total")) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_METRIC_NOT_ALLOWED, "", "not allowed to push event metrics")
+		return
+	}
+	defaults := defaultLabels("/event", source, id)
+	statusLabels := withDefaults(map[string]string{"status": e.Status}, defaults)
+	errorLabels := withDefaults(map[string]string{"type": e.ErrorType}, defaults)
+	eventLabels := withDefaults(map[string]string{"status": e.Status}, defaults)
 	if e.ErrorType != "" {
-		Hub.IncCounter("event_errors_total", map[string]string{"type": e.ErrorType})
+		eventLabels["type"] = e.ErrorType
+	}
+	if err := id.CheckLabels(eventLabels); err != nil {
+		labelRejection(err).write(w, r)
+		return
 	}
 
+	// increment events_total{status="<status>"} and optionally event_errors_total{type="<error>"},
+	// both or neither, so a rejected event can be retried without counting it twice
+	series := []quota.Series{{Name: "events_total", Labels: statusLabels}}
+	if e.ErrorType != "" {
+		series = append(series, quota.Series{Name: "event_errors_total", Labels: errorLabels})
+	}
+	if !Quota.AllowAll(source, series...) {
+		apierror.Write(w, r, http.StatusTooManyRequests, apierror.CODE_QUOTA_EXCEEDED, "", "series quota exceeded")
+		return
+	}
+	sink := Hub.WithContext(r.Context())
+	for _, s := range series {
+		sink.IncCounter(s.Name, s.Labels)
+	}
+	Agents.Seen(source, "events_total")
+
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "ok")
 }
 
-// PushHandler handles generic pushes for counters/gauges
+// PushHandler handles generic pushes for counters/gauges/histograms/summaries
 // POST JSON: {"name":"my_metric","type":"counter","value":1,"labels":{"a":"b"}}
 func PushHandler(w http.ResponseWriter, r *http.Request) {
-	var p PushEvent
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "invalid payload", http.StatusBadRequest)
+	buf, err := decodePush(r)
+	if err != nil {
+		writeBodyError(w, r, err, "invalid payload")
 		return
 	}
-	if p.Name == "" {
-		http.Error(w, "missing metric name", http.StatusBadRequest)
+	defer releasePush(buf)
+	if !verifySignature(w, r, buf.body.Bytes()) {
 		return
 	}
+
+	source := requestSource(r)
+	if !Sources.Accept(source) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_UNKNOWN_SOURCE, "", "unknown push source")
+		return
+	}
+	defaults := defaultLabels("/push", source, auth.FromContext(r.Context()))
+	if rejection := applyPush(r.Context(), source, defaults, &buf.event); rejection != nil {
+		rejection.write(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "ok\n")
+}
+
+// rejects payloads without a valid signature when PushSignature is set, returns false if rejected
+func verifySignature(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if err := PushSignature.Verify(r.Header, body); err != nil {
+		logger.WarnCtx(r.Context(), fmt.Sprintf("Rejected %s from %s: %v", r.URL.Path, r.RemoteAddr, err))
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CODE_INVALID_SIGNATURE, "", err.Error())
+		return false
+	}
+	return true
+}
+
+// why a push was not recorded, written as a JSON error or as a batch item result
+type pushRejection struct {
+	status  int
+	code    string
+	field   string
+	message string
+}
+
+func (rejection *pushRejection) write(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, r, rejection.status, rejection.code, rejection.field, rejection.message)
+}
+
+// validates a push from an accepted source and records it, returns nil on success
+// ctx carries the identity and client certificate of the request, if any;
+// defaults are added to the pushed labels, see defaultLabels
+func applyPush(ctx context.Context, source string, defaults map[string]string, p *PushEvent) *pushRejection {
+	if p.Name == "" {
+		return &pushRejection{http.StatusBadRequest, apierror.CODE_MISSING_FIELD, "name", "missing metric name"}
+	}
+	p.Labels = withDefaults(p.Labels, defaults)
+	if label, invalid := util.InvalidLabelValue(p.Labels); invalid {
+		return &pushRejection{http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "labels." + label, "label values must not contain '" + util.MAP_ENTRY_SEPARATOR + "'"}
+	}
+	switch p.Type {
+	case "counter", "gauge", "histogram", "summary":
+	case "info":
+		if !strings.HasSuffix(p.Name, "_info") {
+			return &pushRejection{http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "name", "info metric names must end in _info"}
+		}
+		for _, label := range p.Identity {
+			if _, ok := p.Labels[label]; !ok {
+				return &pushRejection{http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "identity", "identity label " + label + " is missing from labels"}
+			}
+		}
+	case "bool":
+		value, ok := boolValue(p.State)
+		if !ok {
+			return &pushRejection{http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "state", fmt.Sprintf("invalid bool state %q", p.State)}
+		}
+		p.Value = value
+	case "stateset":
+		if p.State == "" {
+			return &pushRejection{http.StatusBadRequest, apierror.CODE_MISSING_FIELD, "state", "missing state"}
+		}
+		// the state is a label named after the metric
+		if !util.ValidLabelName(p.Name) {
+			return &pushRejection{http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "name", "state-set names must be valid label names, without ':'"}
+		}
+		if _, clash := p.Labels[p.Name]; clash {
+			return &pushRejection{http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "labels", "label " + p.Name + " is reserved for the state"}
+		}
+	default:
+		return &pushRejection{http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "type", "unknown metric type (use 'counter', 'gauge', 'histogram', 'summary', 'bool', 'stateset' or 'info')"}
+	}
+	id := auth.FromContext(ctx)
+	if !id.CanPush(p.Name) {
+		return &pushRejection{http.StatusForbidden, apierror.CODE_METRIC_NOT_ALLOWED, "name", "not allowed to push " + p.Name}
+	}
+	if err := id.CheckLabels(p.Labels); err != nil {
+		logger.WarnCtx(ctx, fmt.Sprintf("Rejected push of %s by %s: %v", p.Name, id.Name, err))
+		return labelRejection(err)
+	}
+	// the certificate identity overrides a pushed label of the same name, so it can't be spoofed
+	if cert := auth.ClientCertFromContext(ctx); CertSourceLabel != "" && cert != "" {
+		if p.Labels == nil {
+			p.Labels = make(map[string]string, 1)
+		}
+		p.Labels[CertSourceLabel] = cert
+	}
+	// the labels may be those of a pooled push, which are cleared for the next one,
+	// while sinks, merges and quotas keep what they are given
+	p.Labels = maps.Clone(p.Labels)
+	if p.Type == "stateset" {
+		return applyStateSet(ctx, source, p)
+	}
+	kind := p.Type
+	if kind == "gauge" && Cumulative.Matches(p.Name) {
+		kind = "counter"
+	}
+	if kind == "bool" || kind == "info" {
+		kind = "gauge"
+	}
+	if err := Hub.CheckSeries(ctx, p.Name, kind, p.Labels); err != nil {
+		return conflictRejection(err)
+	}
+	if !Quota.Allow(source, p.Name, p.Labels) {
+		return &pushRejection{http.StatusTooManyRequests, apierror.CODE_QUOTA_EXCEEDED, "", "series quota exceeded"}
+	}
+	sink := Hub.WithContext(ctx)
 	switch p.Type {
 	case "counter":
-		Hub.IncCounter(p.Name, p.Labels)
+		sink.IncCounter(p.Name, p.Labels)
 	case "gauge":
-		Hub.SetGauge(p.Name, p.Labels, p.Value)
+		if Cumulative.Matches(p.Name) {
+			Cumulative.Apply(sink, p.Name, p.Labels, p.Value)
+		} else {
+			GaugeMerge.Apply(sink, source, p.Name, p.Labels, p.Value)
+		}
+	case "histogram":
+		sink.Observe(p.Name, p.Labels, p.Value)
+	case "summary":
+		sink.ObserveSummary(p.Name, p.Labels, p.Value)
+	case "bool":
+		sink.SetGauge(p.Name, p.Labels, p.Value)
+	case "info":
+		metrics.SetInfo(sink, p.Name, p.Identity, p.Labels)
+	}
+	Agents.Seen(source, p.Name)
+	return nil
+}
+
+// records a state-set push as one gauge per known state, see PushEvent
+func applyStateSet(ctx context.Context, source string, p *PushEvent) *pushRejection {
+	current := string(p.State)
+	if err := Hub.CheckSeries(ctx, p.Name, "gauge", stateLabels(p.Name, p.Labels, current)); err != nil {
+		return conflictRejection(err)
+	}
+	states := pushedStates.states(p.Name, p.Labels, p.States, current)
+	if states == nil {
+		return &pushRejection{http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "states", fmt.Sprintf("more than %d states", MAX_STATESET_STATES)}
+	}
+	series := make([]quota.Series, len(states))
+	for i, state := range states {
+		series[i] = quota.Series{Name: p.Name, Labels: stateLabels(p.Name, p.Labels, state)}
+	}
+	if !Quota.AllowAll(source, series...) {
+		return &pushRejection{http.StatusTooManyRequests, apierror.CODE_QUOTA_EXCEEDED, "", "series quota exceeded"}
+	}
+	sink := Hub.WithContext(ctx)
+	for i, state := range states {
+		value := 0.0
+		if state == current {
+			value = 1
+		}
+		sink.SetGauge(p.Name, series[i].Labels, value)
+	}
+	Agents.Seen(source, p.Name)
+	return nil
+}
+
+// 413 or 408 if the body exceeded the endpoint limits, see backpressure.LimitRequest, 400 otherwise
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CODE_PAYLOAD_TOO_LARGE, "", fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+	case errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		logger.WarnCtx(r.Context(), fmt.Sprintf("Timed out reading %s body from %s", r.URL.Path, r.RemoteAddr))
+		apierror.Write(w, r, http.StatusRequestTimeout, apierror.CODE_TIMEOUT, "", "timed out reading request body")
 	default:
-		http.Error(w, "unknown metric type (use 'counter' or 'gauge')", http.StatusBadRequest)
-		return
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_PAYLOAD, "", message)
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "ok")
+}
+
+// 403 naming the label whose value the caller may not push
+func labelRejection(err error) *pushRejection {
+	field := ""
+	var labelErr *auth.LabelError
+	if errors.As(err, &labelErr) {
+		field = "labels." + labelErr.Label
+	}
+	return &pushRejection{http.StatusForbidden, apierror.CODE_LABEL_NOT_ALLOWED, field, err.Error()}
+}
+
+// 409 for updates conflicting with the type or label names of an existing metric
+func conflictRejection(err error) *pushRejection {
+	field := "name"
+	var conflict *prometheus.ConflictError
+	if errors.As(err, &conflict) && (conflict.Reason == "type" || conflict.Reason == "labels") {
+		field = conflict.Reason
+	}
+	return &pushRejection{http.StatusConflict, apierror.CODE_METRIC_CONFLICT, field, err.Error()}
+}
+
+// identifies the pushing client for quotas and the push source inventory,
+// "token:<name>" for authenticated clients, "cert:<id>" for mTLS clients, "ip:<addr>" otherwise
+func requestSource(r *http.Request) string {
+	if id := auth.FromContext(r.Context()); id != nil {
+		return "token:" + id.Name
+	}
+	if cert := auth.ClientCertFromContext(r.Context()); cert != "" {
+		return "cert:" + cert
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
 }
 
 // Health check
@@ -85,3 +432,63 @@ func HealthHandler(respWriter http.ResponseWriter, request *http.Request) {
 	respWriter.WriteHeader(http.StatusOK)
 	logger.Info(fmt.Sprintf("Health check response %v %s", respWriter, "OK"))
 }
+
+// admin request deleting a series, or the whole metric if labels are omitted
+type DeleteRequest struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SeriesDeleteHandler removes series from /metrics and checkpoint
+// DELETE JSON: {"name":"my_metric","labels":{"a":"b"}}
+func SeriesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	var d DeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		writeBodyError(w, r, err, "invalid payload")
+		return
+	}
+	if d.Name == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_MISSING_FIELD, "name", "missing metric name")
+		return
+	}
+
+	// state of the affected series for the audit log
+	before := Hub.Series(d.Name)
+	if d.Labels != nil && before != nil {
+		labelsKey := util.JoinMapEntries(d.Labels)
+		value, exists := before[labelsKey]
+		before = nil
+		if exists {
+			before = map[string]float64{labelsKey: value}
+		}
+	}
+
+	var deleted bool
+	if d.Labels == nil {
+		deleted = Hub.DeleteMetric(d.Name)
+	} else {
+		deleted = Hub.DeleteSeries(d.Name, d.Labels)
+	}
+	entry := audit.EntryOf(r)
+	entry.Action, entry.Target = "delete_series", d.Name
+	if before != nil {
+		entry.Before = before
+	}
+	if d.Labels != nil {
+		entry.Target = d.Name + "{" + util.JoinMapEntries(d.Labels) + "}"
+	}
+	if !deleted {
+		entry.Result = "not_found"
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "series not found")
+		return
+	}
+	entry.After = map[string]float64{}
+
+	logger.InfoCtx(r.Context(), fmt.Sprintf("Deleted series %s %v via admin API", d.Name, d.Labels))
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
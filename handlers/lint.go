@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// Optional naming convention checks of incoming metrics, nil disables them
+var Lint *metrics.Linter
+
+// LintHandler lists metrics breaking naming conventions
+// GET /admin/lint
+func LintHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if Lint == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "lint is disabled")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(Lint.Findings())
+}
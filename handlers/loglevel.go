@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/audit"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// base log level and the levels of single packages, e.g. {"level":"info","modules":{"poller":"debug"}}
+type LogLevels struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+	// all packages log at debug since SIGUSR1, the levels above apply once it is sent again
+	Debug bool `json:"debug,omitempty"`
+}
+
+// LogLevelHandler reports or changes log levels without a restart;
+// PUT changes the level if given and merges modules, an empty module level removes its override
+// GET|PUT /admin/loglevel
+func LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var update LogLevels
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeBodyError(w, r, err, "invalid payload")
+			return
+		}
+		before := currentLogLevels()
+		after := LogLevels{Level: before.Level, Modules: maps.Clone(before.Modules)}
+		if update.Level != "" {
+			after.Level = update.Level
+		}
+		for module, level := range update.Modules {
+			if level == "" {
+				delete(after.Modules, module)
+				continue
+			}
+			after.Modules[module] = level
+		}
+		if err := logger.SetLevels(after.Level, after.Modules); err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "level", err.Error())
+			return
+		}
+		entry := audit.EntryOf(r)
+		entry.Action, entry.Before, entry.After = "set_log_level", before, currentLogLevels()
+		logger.WarnCtx(r.Context(), fmt.Sprintf("Log level set to %s, modules %v via admin API", after.Level, after.Modules))
+	default:
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentLogLevels())
+}
+
+func currentLogLevels() LogLevels {
+	level, modules := logger.Levels()
+	return LogLevels{Level: level, Modules: modules, Debug: logger.DebugToggled()}
+}
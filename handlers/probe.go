@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/blackbox"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Optional modules of ProbeHandler by name, set by main
+var ProbeModules map[string]config.ProbeModuleConfig
+
+// Creates the poller of a probe from the expanded module template, set by main
+var NewProbePoller func(pc config.PollerConfig) (*poller.Poller, error)
+
+// Probers of the modules checking availability instead of polling, set by main
+var ProbeProbers map[string]*blackbox.Prober
+
+// ProbeHandler runs a module's poller once against the target and returns the metrics of that
+// poll only, plus probe_success and probe_duration_seconds; the module may be omitted if only
+// one is configured
+// GET /probe?target=vcenter01&module=storage
+func ProbeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_MISSING_FIELD, "target", "missing target")
+		return
+	}
+	name := r.URL.Query().Get("module")
+	if name == "" && len(ProbeModules) == 1 {
+		for only := range ProbeModules {
+			name = only
+		}
+	}
+	module, ok := ProbeModules[name]
+	if !ok {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_FIELD, "module", fmt.Sprintf("unknown probe module %q", name))
+		return
+	}
+	if !probeAllowed(module, target) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_FORBIDDEN, "target", "target not allowed for module "+name)
+		return
+	}
+	if prober, ok := ProbeProbers[name]; ok {
+		probeHTTP(w, r, prober, name, target)
+		return
+	}
+
+	p, err := NewProbePoller(expandProbe(module.Poller, target))
+	if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CODE_INTERNAL, "", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout(r))
+	defer cancel()
+	registry := promclient.NewRegistry()
+	sink := prometheus.NewSinkWithRegistry(registry, "", 0)
+	start := time.Now()
+	success := 1.0
+	if err := p.Probe(ctx, sink); err != nil {
+		logger.WarnCtx(r.Context(), fmt.Sprintf("Probe of %s with module %s failed: %v", target, name, err))
+		success = 0
+	}
+	sink.SetGauge(PROBE_SUCCESS_METRIC, nil, success)
+	sink.SetGauge(PROBE_DURATION_METRIC, nil, time.Since(start).Seconds())
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// checks the availability of the target URL, https:// is assumed without scheme
+func probeHTTP(w http.ResponseWriter, r *http.Request, prober *blackbox.Prober, name, target string) {
+	targetURL := target
+	if !strings.Contains(targetURL, "://") {
+		targetURL = "https://" + targetURL
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout(r))
+	defer cancel()
+	registry := promclient.NewRegistry()
+	if err := prober.Probe(ctx, targetURL, prometheus.NewSinkWithRegistry(registry, "", 0), nil); err != nil {
+		logger.WarnCtx(r.Context(), fmt.Sprintf("Probe of %s with module %s failed: %v", target, name, err))
+	}
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// a target must be a host[:port] for modules polling a template, or an http(s) URL without
+// user info for availability modules, so it cannot redirect the request, or its credentials,
+// to another host than the one matched against the module's targets
+func probeTargetValid(module config.ProbeModuleConfig, target string) bool {
+	if module.HTTP != nil {
+		if !strings.Contains(target, "://") {
+			target = "https://" + target
+		}
+		u, err := url.Parse(target)
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.User == nil && u.Host != "" &&
+			!strings.ContainsAny(u.Host, "\\%")
+	}
+	if strings.ContainsAny(target, "@/#?\\% \t\r\n") {
+		return false
+	}
+	if !strings.Contains(target, ":") {
+		return true
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil || host == "" {
+		return false
+	}
+	_, err = strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
+
+func probeAllowed(module config.ProbeModuleConfig, target string) bool {
+	if !probeTargetValid(module, target) {
+		return false
+	}
+	if len(module.Targets) == 0 {
+		return true
+	}
+	for _, pattern := range module.Targets {
+		if matched, _ := path.Match(pattern, target); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// replaces {{target}} in the module's poller template, escaped in the URL;
+// target must have passed probeAllowed
+func expandProbe(template config.PollerConfig, target string) config.PollerConfig {
+	replacer := strings.NewReplacer("{{target}}", target)
+	pc := template
+	pc.Name = replacer.Replace(template.Name)
+	pc.URL = strings.ReplaceAll(template.URL, "{{target}}", url.PathEscape(target))
+	pc.Labels = make(map[string]string, len(template.Labels))
+	for k, v := range template.Labels {
+		pc.Labels[k] = replacer.Replace(v)
+	}
+	pc.Headers = make(map[string]string, len(template.Headers))
+	for k, v := range template.Headers {
+		pc.Headers[k] = replacer.Replace(v)
+	}
+	return pc
+}
+
+// the scrape timeout Prometheus announces, less a margin for the response, default otherwise
+func probeTimeout(r *http.Request) time.Duration {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= PROBE_TIMEOUT_MARGIN_SEC {
+		return DEFAULT_PROBE_TIMEOUT_SEC * time.Second
+	}
+	return time.Duration((seconds - PROBE_TIMEOUT_MARGIN_SEC) * float64(time.Second))
+}
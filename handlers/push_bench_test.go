@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+	client "github.com/prometheus/client_golang/prometheus"
+)
+
+func BenchmarkPushHandler(b *testing.B) {
+	Hub = metrics.NewMetricHub()
+	Hub.RegisterSink(prometheus.NewSinkWithRegistry(client.NewRegistry(), "", 0))
+	defer func() { Hub = nil }()
+	body := `{"name":"bench_gauge","type":"gauge","value":1,"labels":{"series":"s0"}}`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		recorder := httptest.NewRecorder()
+		PushHandler(recorder, httptest.NewRequest("POST", "/push", strings.NewReader(body)))
+		if recorder.Code != 200 {
+			b.Fatalf("push failed: %d %s", recorder.Code, recorder.Body)
+		}
+	}
+}
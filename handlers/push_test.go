@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// keeps the labels of every update, like sinks queueing or merging series
+type retainingSink struct {
+	labels []map[string]string
+}
+
+func (sink *retainingSink) IncCounter(name string, labels map[string]string) {
+	sink.labels = append(sink.labels, labels)
+}
+func (sink *retainingSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.labels = append(sink.labels, labels)
+}
+func (sink *retainingSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.labels = append(sink.labels, labels)
+}
+func (sink *retainingSink) Observe(name string, labels map[string]string, value float64) {
+	sink.labels = append(sink.labels, labels)
+}
+func (sink *retainingSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.labels = append(sink.labels, labels)
+}
+
+func push(t *testing.T, body string) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	PushHandler(recorder, httptest.NewRequest("POST", "/push", strings.NewReader(body)))
+	return recorder.Code
+}
+
+func TestPushHandsSinksLabelsOutsideThePool(t *testing.T) {
+	sink := &retainingSink{}
+	Hub = metrics.NewMetricHub()
+	Hub.RegisterSink(sink)
+	defer func() { Hub = nil }()
+
+	for _, host := range []string{"a", "b", "c"} {
+		if code := push(t, `{"name":"retained_total","type":"counter","labels":{"host":"`+host+`"}}`); code != 200 {
+			t.Fatalf("push of host %s returned %d", host, code)
+		}
+	}
+	for i, host := range []string{"a", "b", "c"} {
+		if sink.labels[i]["host"] != host {
+			t.Fatalf("update %d kept labels %v, expected host=%s", i, sink.labels[i], host)
+		}
+	}
+}
+
+func TestPushRejectsTrailingData(t *testing.T) {
+	Hub = metrics.NewMetricHub()
+	Hub.RegisterSink(&retainingSink{})
+	defer func() { Hub = nil }()
+
+	for _, body := range []string{`{"name":"a_total","type":"counter"} {"name":"b_total"}`, `{"name":"a_total"`, ``} {
+		if code := push(t, body); code != 400 {
+			t.Fatalf("body %q returned %d, expected 400", body, code)
+		}
+	}
+	// a failed decode leaves nothing behind for the next push from the pool
+	if code := push(t, `{"name":"a_total","type":"counter"}`); code != 200 {
+		t.Fatalf("valid push after invalid ones returned %d", code)
+	}
+}
+
+func TestPushRejectsSeparatorInLabelValues(t *testing.T) {
+	sink := &retainingSink{}
+	Hub = metrics.NewMetricHub()
+	Hub.RegisterSink(sink)
+	defer func() { Hub = nil }()
+
+	if code := push(t, `{"name":"a_total","type":"counter","labels":{"path":"a|b"}}`); code != 400 {
+		t.Fatalf("push returned %d, expected 400", code)
+	}
+	if code := push(t, `{"name":"a_total","type":"counter","labels":{"query":"a=b"}}`); code != 200 {
+		t.Fatalf("push with '=' in a value returned %d", code)
+	}
+	if len(sink.labels) != 1 {
+		t.Fatalf("sink got %d updates, expected 1", len(sink.labels))
+	}
+}
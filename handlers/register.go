@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/agents"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
+)
+
+// Optional registry of self-registered push agents, nil disables registration
+var Agents *agents.Registry
+
+// RegisterHandler records an agent announcing itself; 201 for a new agent, 200 for a known one,
+// the response carries the agent's settings, see AgentConfigHandler
+// POST JSON: {"name":"esx-agent-01","version":"1.4.2","expectedMetrics":["esx_cpu_ready"],"pushInterval":"30s"}
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if Agents == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "agent registration is disabled")
+		return
+	}
+	var reg agents.Registration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		writeBodyError(w, r, err, "invalid registration")
+		return
+	}
+	source := requestSource(r)
+	if !Sources.Accept(source) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_UNKNOWN_SOURCE, "", "unknown push source")
+		return
+	}
+	created, err := Agents.Register(source, isAdmin(r), reg)
+	switch {
+	case errors.Is(err, agents.ErrOwned):
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_FORBIDDEN, "name", err.Error())
+		return
+	case errors.Is(err, agents.ErrTooManyAgents):
+		apierror.Write(w, r, http.StatusTooManyRequests, apierror.CODE_QUOTA_EXCEEDED, "", err.Error())
+		return
+	case err != nil:
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CODE_INVALID_PAYLOAD, "", err.Error())
+		return
+	}
+	settings, _ := Agents.Settings(reg.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", strconv.Quote(settings.Revision))
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(struct {
+		Agent    string          `json:"agent"`
+		Source   string          `json:"source"`
+		Settings agents.Settings `json:"settings"`
+	}{reg.Name, source, settings})
+}
+
+// AgentConfigHandler serves the settings of the agent registered from the requesting source,
+// admins may name any agent; 304 while the revision in If-None-Match is current
+// GET /agent/config?agent=esx-agent-01
+func AgentConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if Agents == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "agent registration is disabled")
+		return
+	}
+	own := Agents.AgentOf(requestSource(r))
+	name := r.URL.Query().Get("agent")
+	if name == "" {
+		name = own
+	} else if name != own && !isAdmin(r) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_FORBIDDEN, "agent", "settings of other agents are not visible")
+		return
+	}
+	settings, ok := Agents.Settings(name)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "agent is not registered")
+		return
+	}
+	etag := strconv.Quote(settings.Revision)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// AgentsHandler lists registered agents with their last push
+// GET /admin/agents
+func AgentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CODE_METHOD_NOT_ALLOWED, "", "method not allowed")
+		return
+	}
+	if Agents == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "agent registration is disabled")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(Agents.Agents())
+}
+
+// whether the caller authenticated with the admin role
+func isAdmin(r *http.Request) bool {
+	id := auth.FromContext(r.Context())
+	return id != nil && id.Has(auth.ROLE_ADMIN)
+}
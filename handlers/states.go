@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// pushed state of "bool" and "stateset" pushes, a JSON string, bool or number
+type State string
+
+func (state *State) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*state = State(s)
+		return nil
+	}
+	if bytes.Equal(data, []byte("null")) {
+		*state = ""
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v.(type) {
+	case bool, float64:
+		*state = State(data)
+		return nil
+	}
+	return fmt.Errorf("state must be a string, bool or number")
+}
+
+// spellings of pushed bool states and their gauge values
+var boolStates = map[string]float64{
+	"true": 1, "yes": 1, "on": 1, "enabled": 1, "up": 1, "1": 1,
+	"false": 0, "no": 0, "off": 0, "disabled": 0, "down": 0, "0": 0,
+}
+
+// gauge value of a bool state, false if it is neither truthy nor falsy
+func boolValue(state State) (float64, bool) {
+	value, ok := boolStates[strings.ToLower(string(state))]
+	return value, ok
+}
+
+// states of each state-set series pushed so far, so a state missing from the next push
+// is still reset to 0 instead of staying 1 next to the new one; series not pushed for
+// STATESET_IDLE_SEC are forgotten
+type stateSets struct {
+	lock sync.Mutex
+	// name|labelsKey -> states
+	seen      map[string]*stateSet
+	lastSweep time.Time
+}
+
+type stateSet struct {
+	states []string
+	pushed time.Time
+}
+
+var pushedStates = &stateSets{seen: make(map[string]*stateSet), lastSweep: time.Now()}
+
+// all states of the series: those pushed now or before plus the current one, sorted
+func (sets *stateSets) states(name string, labels map[string]string, pushed []string, current string) []string {
+	key := name + "|" + util.JoinMapEntries(labels)
+	now := time.Now()
+	sets.lock.Lock()
+	defer sets.lock.Unlock()
+	sets.sweep(now)
+	var states []string
+	if set, ok := sets.seen[key]; ok {
+		states = slices.Clone(set.states)
+	}
+	for _, state := range append(pushed, current) {
+		if !slices.Contains(states, state) {
+			states = append(states, state)
+		}
+	}
+	slices.Sort(states)
+	if len(states) > MAX_STATESET_STATES {
+		return nil
+	}
+	sets.seen[key] = &stateSet{states: states, pushed: now}
+	return slices.Clone(states)
+}
+
+// forgets series not pushed for STATESET_IDLE_SEC, checked every STATESET_SWEEP_SEC;
+// caller must hold the lock
+func (sets *stateSets) sweep(now time.Time) {
+	if now.Sub(sets.lastSweep) < STATESET_SWEEP_SEC*time.Second {
+		return
+	}
+	sets.lastSweep = now
+	for key, set := range sets.seen {
+		if now.Sub(set.pushed) > STATESET_IDLE_SEC*time.Second {
+			delete(sets.seen, key)
+		}
+	}
+}
+
+// labels of one state's series, the state is a label named after the metric (OpenMetrics StateSet)
+func stateLabels(name string, labels map[string]string, state string) map[string]string {
+	stateLabels := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		stateLabels[k] = v
+	}
+	stateLabels[name] = state
+	return stateLabels
+}
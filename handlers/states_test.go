@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStateSetsForgetIdleSeries(t *testing.T) {
+	sets := &stateSets{seen: make(map[string]*stateSet), lastSweep: time.Now()}
+	sets.states("raid_state", map[string]string{"array": "old"}, nil, "ok")
+	sets.seen["raid_state|array=old"].pushed = time.Now().Add(-2 * STATESET_IDLE_SEC * time.Second)
+	sets.lastSweep = time.Now().Add(-2 * STATESET_SWEEP_SEC * time.Second)
+
+	states := sets.states("raid_state", map[string]string{"array": "new"}, []string{"degraded"}, "ok")
+	if len(states) != 2 {
+		t.Fatalf("states %v, expected degraded and ok", states)
+	}
+	if _, ok := sets.seen["raid_state|array=old"]; ok {
+		t.Fatal("idle state set was kept")
+	}
+}
+
+func TestStateSetNameMustBeLabelName(t *testing.T) {
+	rejection := applyPush(context.Background(), "test", nil, &PushEvent{Name: "raid:state", Type: "stateset", State: "ok"})
+	if rejection == nil || rejection.field != "name" {
+		t.Fatalf("state set named raid:state returned %+v, expected a rejected name", rejection)
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+)
+
+// Optional per-tenant registries, only set in multi-tenant mode (auth.oidc.tenantClaim)
+var Tenants *prometheus.TenantRegistries
+
+// TenantMetricsHandler serves the metrics of one tenant to callers of that tenant and admins
+// GET /metrics/tenants/{tenant}
+func TenantMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if Tenants == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "", "multi-tenant mode is disabled")
+		return
+	}
+	tenant := r.PathValue("tenant")
+	handler := Tenants.Handler(tenant)
+	if handler == nil {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CODE_NOT_FOUND, "tenant", "unknown tenant")
+		return
+	}
+	if id := auth.FromContext(r.Context()); id == nil || (id.Tenant != tenant && !id.Has(auth.ROLE_ADMIN)) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CODE_FORBIDDEN, "tenant", "metrics of other tenants are not visible")
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// TenantScope keeps callers of a tenant to their own metrics in multi-tenant mode: scoped
+// scrapes, i.e. /metrics, are served from their tenant's registry, other endpoints exposing
+// all metrics reject them; admins and callers without tenant reach handler
+func TenantScope(handler http.HandlerFunc, scoped bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := auth.FromContext(r.Context())
+		if Tenants == nil || id == nil || id.Tenant == "" || id.Has(auth.ROLE_ADMIN) {
+			handler(w, r)
+			return
+		}
+		tenantHandler := Tenants.Handler(id.Tenant)
+		if !scoped || tenantHandler == nil {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CODE_FORBIDDEN, "", "not available to tenants, scrape /metrics/tenants/"+id.Tenant)
+			return
+		}
+		tenantHandler.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// UDPListener records PushEvents sent as single JSON datagrams by fire-and-forget clients,
+// e.g. scripts in ESXi shells; nothing is acknowledged, drops only show up in UDP_DROPPED_METRIC
+type UDPListener struct {
+	addr     string
+	maxBytes int
+
+	received *metrics.SampledCounter
+	// oversized, malformed and rejected datagrams
+	dropped *metrics.SampledCounter
+}
+
+func NewUDPListener(cfg config.UDPConfig, sink metrics.MetricSink) *UDPListener {
+	maxBytes := cfg.MaxDatagramBytes
+	if maxBytes == 0 {
+		maxBytes = DEFAULT_UDP_MAX_DATAGRAM_BYTES
+	}
+	return &UDPListener{
+		addr:     cfg.ListenAddr,
+		maxBytes: maxBytes,
+		received: metrics.NewSampledCounter(sink, UDP_RECEIVED_METRIC, ""),
+		dropped:  metrics.NewSampledCounter(sink, UDP_DROPPED_METRIC, "reason", "oversized", "malformed", "rejected"),
+	}
+}
+
+// binds the listener and serves datagrams in the background
+func (listener *UDPListener) Start() error {
+	conn, err := net.ListenPacket("udp", listener.addr)
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Listening for unauthenticated UDP pushes on %s", listener.addr))
+	go listener.serve(conn)
+	// counters are sampled to keep the sink out of the receive loop
+	metrics.PublishEvery(UDP_PUBLISH_INTERVAL_SEC*time.Second, func() {
+		listener.received.Publish()
+		listener.dropped.Publish()
+	})
+	return nil
+}
+
+func (listener *UDPListener) serve(conn net.PacketConn) {
+	// one spare byte detects datagrams truncated to the buffer size
+	buf := make([]byte, listener.maxBytes+1)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			logger.Error(fmt.Sprintf("UDP listener on %s stopped: %v", listener.addr, err))
+			return
+		}
+		listener.received.Inc("")
+		if n > listener.maxBytes {
+			listener.dropped.Inc("oversized")
+			continue
+		}
+		listener.handle(buf[:n], addr)
+	}
+}
+
+func (listener *UDPListener) handle(datagram []byte, addr net.Addr) {
+	var p PushEvent
+	if err := json.Unmarshal(datagram, &p); err != nil {
+		listener.dropped.Inc("malformed")
+		return
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	source := "ip:" + host
+	if !Sources.Accept(source) {
+		listener.dropped.Inc("rejected")
+		return
+	}
+	if rejection := applyPush(context.Background(), source, defaultLabels("udp", source, nil), &p); rejection != nil {
+		// bad payloads count as malformed, valid ones refused by policy as rejected
+		if rejection.status == http.StatusBadRequest {
+			listener.dropped.Inc("malformed")
+		} else {
+			listener.dropped.Inc("rejected")
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/handlers"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+	client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Harness runs the collector in-process: hub, Prometheus sink with a checkpoint in a temp dir,
+// the push handlers and /metrics on an httptest server, plus fake poll targets.
+// It uses a private registry, but the handlers are package globals, so harnesses must not run concurrently.
+//
+//	h, err := integration.New()
+//	defer h.Close()
+//	url := h.StaticTarget(`{"value": 42}`)
+//	h.StartPoller(config.PollerConfig{URL: url, Metric: "my_value", Interval: config.Duration{Duration: time.Second}})
+//	value, err := h.WaitForValue("my_value", nil, 5*time.Second)
+type Harness struct {
+	Dir            string
+	CheckpointFile string
+	// applied to the sink on start and restart
+	CounterPrecision []config.CounterPrecisionRule
+
+	Registry *client.Registry
+	Hub      *metrics.MetricHub
+	Sink     *prometheus.PrometheusSink
+
+	server  *httptest.Server
+	targets []*httptest.Server
+	pollers []*poller.Poller
+}
+
+// starts a collector with an empty checkpoint in a new temp dir
+func New() (*Harness, error) {
+	dir, err := os.MkdirTemp("", "collector-integration-")
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{Dir: dir, CheckpointFile: filepath.Join(dir, "checkpoint.json")}
+	h.start()
+	return h, nil
+}
+
+func (h *Harness) start() {
+	h.Registry = client.NewRegistry()
+	// long interval, Restart and Close save explicitly
+	h.Sink = prometheus.NewSinkWithRegistry(h.Registry, h.CheckpointFile, time.Hour)
+	h.Sink.SetCounterPrecision(h.CounterPrecision)
+	h.Hub = metrics.NewMetricHub()
+	h.Hub.RegisterSink(h.Sink)
+	handlers.Hub = h.Hub
+	handlers.Gatherer = h.Registry
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/event", handlers.EventHandler)
+	mux.HandleFunc("/push", handlers.PushHandler)
+	mux.HandleFunc("/push/batch", handlers.BatchHandler)
+	mux.Handle("/metrics", promhttp.HandlerFor(h.Registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/api/v1/export", handlers.ExportHandler)
+	mux.HandleFunc("/health", handlers.HealthHandler)
+	h.server = httptest.NewServer(mux)
+}
+
+// base URL of the collector endpoints
+func (h *Harness) URL() string {
+	return h.server.URL
+}
+
+// starts a fake poll target served by handler, returns its URL
+func (h *Harness) Target(handler http.HandlerFunc) string {
+	target := httptest.NewServer(handler)
+	h.targets = append(h.targets, target)
+	return target.URL
+}
+
+// starts a fake poll target always answering with the JSON body
+func (h *Harness) StaticTarget(body string) string {
+	return h.Target(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	})
+}
+
+// starts a poller writing to the harness hub, polling right away
+func (h *Harness) StartPoller(pc config.PollerConfig) error {
+	p := poller.NewPoller(pc.URL, pc.Metric, pc.Labels, pc.Interval.Duration, h.Hub)
+	p.Headers = pc.Headers
+	processor, err := poller.NewProcessor(pc)
+	if err != nil {
+		return err
+	}
+	p.Processor = processor
+	if pc.Name != "" {
+		p.Name = pc.Name
+	}
+	p.SkipUnchanged = pc.SkipUnchanged
+	p.ImmediateFirstPoll = true
+	p.Start()
+	h.pollers = append(h.pollers, p)
+	return nil
+}
+
+// posts the event to /push, non-2xx responses are returned as errors
+func (h *Harness) Push(event handlers.PushEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return h.post("/push", body)
+}
+
+// posts the samples to /push/batch and returns the per-sample results
+func (h *Harness) PushBatch(samples []handlers.BatchSample) (*handlers.BatchResponse, error) {
+	body, err := json.Marshal(handlers.BatchRequest{Samples: samples})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Post(h.server.URL+"/push/batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		text, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(text))}
+	}
+	var result handlers.BatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// posts a legacy event to /event
+func (h *Harness) Event(event handlers.LegacyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return h.post("/event", body)
+}
+
+func (h *Harness) post(path string, body []byte) error {
+	resp, err := http.Post(h.server.URL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		text, _ := io.ReadAll(resp.Body)
+		statusErr := &StatusError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(text))}
+		var apiErr apierror.Error
+		if json.Unmarshal(text, &apiErr) == nil {
+			statusErr.Code = apiErr.Code
+		}
+		return statusErr
+	}
+	return nil
+}
+
+// returned for rejected pushes, so scenarios can assert on the status
+type StatusError struct {
+	Status int
+	// error code of JSON error responses, see apierror
+	Code string
+	Body string
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", err.Status, err.Body)
+}
+
+// scrapes /metrics like Prometheus does and parses the text exposition
+func (h *Harness) Scrape() (map[string]*dto.MetricFamily, error) {
+	resp, err := http.Get(h.server.URL + "/metrics")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scrape returned status %d", resp.StatusCode)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// value of the series with exactly these labels in a fresh scrape,
+// the sample count for histograms and summaries
+func (h *Harness) Value(name string, labels map[string]string) (float64, error) {
+	families, err := h.Scrape()
+	if err != nil {
+		return 0, err
+	}
+	family, ok := families[name]
+	if !ok {
+		return 0, &MissingError{Name: name, Labels: labels}
+	}
+	for _, metric := range family.GetMetric() {
+		if !sameLabels(metric.GetLabel(), labels) {
+			continue
+		}
+		switch {
+		case metric.Counter != nil:
+			return metric.Counter.GetValue(), nil
+		case metric.Gauge != nil:
+			return metric.Gauge.GetValue(), nil
+		case metric.Histogram != nil:
+			return float64(metric.Histogram.GetSampleCount()), nil
+		case metric.Summary != nil:
+			return float64(metric.Summary.GetSampleCount()), nil
+		case metric.Untyped != nil:
+			return metric.Untyped.GetValue(), nil
+		}
+	}
+	return 0, &MissingError{Name: name, Labels: labels}
+}
+
+// returned by Value for series not present in /metrics
+type MissingError struct {
+	Name   string
+	Labels map[string]string
+}
+
+func (err *MissingError) Error() string {
+	return fmt.Sprintf("series %s%v not found in /metrics", err.Name, err.Labels)
+}
+
+// polls /metrics until the series shows up, for asynchronous sources like pollers
+func (h *Harness) WaitForValue(name string, labels map[string]string, timeout time.Duration) (float64, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		value, err := h.Value(name, labels)
+		if err == nil || time.Now().After(deadline) {
+			return value, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// simulates a collector restart: stops pollers, saves the checkpoint and
+// starts a new hub and sink restoring from it; fake targets keep running
+func (h *Harness) Restart() error {
+	h.stop()
+	if err := h.Sink.Close(); err != nil {
+		return err
+	}
+	h.start()
+	return nil
+}
+
+func (h *Harness) stop() {
+	for _, p := range h.pollers {
+		p.Stop()
+	}
+	h.pollers = nil
+	h.server.Close()
+}
+
+// stops everything and removes the temp dir
+func (h *Harness) Close() {
+	h.stop()
+	h.Sink.Close()
+	for _, target := range h.targets {
+		target.Close()
+	}
+	handlers.Hub = nil
+	os.RemoveAll(h.Dir)
+}
+
+func sameLabels(pairs []*dto.LabelPair, labels map[string]string) bool {
+	if len(pairs) != len(labels) {
+		return false
+	}
+	for _, pair := range pairs {
+		if value, ok := labels[pair.GetName()]; !ok || value != pair.GetValue() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package integration
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/apierror"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/handlers"
+)
+
+// end-to-end checks, each run against a fresh harness; the handlers are package globals,
+// so they must not run in parallel
+func TestScenarios(t *testing.T) {
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T, h *Harness)
+	}{
+		{"push counter, gauge and histogram", pushScenario},
+		{"legacy event", eventScenario},
+		{"poll JSON value target", pollScenario},
+		{"restore counters and gauges from checkpoint", restoreScenario},
+		{"reject push with conflicting labels", conflictScenario},
+		{"counters beyond float64 precision", precisionScenario},
+		{"batch push with partial success", batchScenario},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			scenario.run(t, newHarness(t))
+		})
+	}
+}
+
+// a harness closed when the test ends
+func newHarness(t *testing.T) *Harness {
+	t.Helper()
+	h, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// fails unless the series has the expected value
+func expectValue(t *testing.T, h *Harness, name string, labels map[string]string, expected float64) {
+	t.Helper()
+	value, err := h.Value(name, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != expected {
+		t.Fatalf("%s%v = %v, expected %v", name, labels, value, expected)
+	}
+}
+
+func push(t *testing.T, h *Harness, event handlers.PushEvent) {
+	t.Helper()
+	if err := h.Push(event); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func restart(t *testing.T, h *Harness) {
+	t.Helper()
+	if err := h.Restart(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pushScenario(t *testing.T, h *Harness) {
+	labels := map[string]string{"result": "success"}
+	for i := 0; i < 3; i++ {
+		push(t, h, handlers.PushEvent{Name: "deploy_total", Type: "counter", Value: 1, Labels: labels})
+	}
+	push(t, h, handlers.PushEvent{Name: "queue_depth", Type: "gauge", Value: 7})
+	for _, latency := range []float64{0.1, 0.2} {
+		push(t, h, handlers.PushEvent{Name: "request_seconds", Type: "histogram", Value: latency})
+	}
+	expectValue(t, h, "deploy_total", labels, 3)
+	expectValue(t, h, "queue_depth", nil, 7)
+	expectValue(t, h, "request_seconds", nil, 2)
+}
+
+func eventScenario(t *testing.T, h *Harness) {
+	if err := h.Event(handlers.LegacyEvent{Status: "failure", ErrorType: "timeout"}); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, h, "events_total", map[string]string{"status": "failure"}, 1)
+	expectValue(t, h, "event_errors_total", map[string]string{"type": "timeout"}, 1)
+}
+
+func pollScenario(t *testing.T, h *Harness) {
+	url := h.StaticTarget(`{"value": "42.5"}`)
+	err := h.StartPoller(config.PollerConfig{
+		URL:      url,
+		Metric:   "vcenter_value",
+		Labels:   map[string]string{"vcenter": "fake"},
+		Interval: config.Duration{Duration: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := h.WaitForValue("vcenter_value", map[string]string{"vcenter": "fake"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 42.5 {
+		t.Fatalf("polled value %v, expected 42.5", value)
+	}
+}
+
+func restoreScenario(t *testing.T, h *Harness) {
+	labels := map[string]string{"result": "success"}
+	for i := 0; i < 2; i++ {
+		push(t, h, handlers.PushEvent{Name: "deploy_total", Type: "counter", Value: 1, Labels: labels})
+	}
+	push(t, h, handlers.PushEvent{Name: "queue_depth", Type: "gauge", Value: 3})
+	restart(t, h)
+	expectValue(t, h, "deploy_total", labels, 2)
+	expectValue(t, h, "queue_depth", nil, 3)
+	// restored counters keep counting
+	push(t, h, handlers.PushEvent{Name: "deploy_total", Type: "counter", Value: 1, Labels: labels})
+	expectValue(t, h, "deploy_total", labels, 3)
+}
+
+func conflictScenario(t *testing.T, h *Harness) {
+	push(t, h, handlers.PushEvent{Name: "vm_count", Type: "gauge", Value: 1, Labels: map[string]string{"cluster": "a"}})
+	err := h.Push(handlers.PushEvent{Name: "vm_count", Type: "gauge", Value: 1, Labels: map[string]string{"host": "x"}})
+	var status *StatusError
+	if !errors.As(err, &status) || status.Status != http.StatusConflict || status.Code != apierror.CODE_METRIC_CONFLICT {
+		t.Fatalf("push with different labels returned %v, expected status 409 with code %s", err, apierror.CODE_METRIC_CONFLICT)
+	}
+	expectValue(t, h, "collector_metric_conflicts_total", map[string]string{"metric": "vm_count", "reason": "labels"}, 1)
+}
+
+func precisionScenario(t *testing.T, h *Harness) {
+	h.CounterPrecision = []config.CounterPrecisionRule{
+		{Match: "billing_bytes_total", Mode: config.PRECISION_SPLIT},
+		{Match: "billing_kib_total", Mode: config.PRECISION_SCALE, Scale: 1024},
+	}
+	if err := h.Sink.SetCounterPrecision(h.CounterPrecision); err != nil {
+		t.Fatal(err)
+	}
+
+	// counter pushes count by one, large increases come from pollers through the hub;
+	// 2^53 is the last integer before float64 starts skipping odd ones
+	const limit = 1 << 53
+	for _, name := range []string{"billing_bytes_total", "plain_bytes_total"} {
+		h.Hub.AddCounter(name, nil, limit)
+		h.Hub.AddCounter(name, nil, 1)
+	}
+	expectValue(t, h, "collector_counter_precision_loss_total", map[string]string{"metric": "plain_bytes_total"}, 1)
+	// 2^53 + 1 = 2^21 * 2^32 + 1
+	expectValue(t, h, "billing_bytes_total_high", nil, 1<<21)
+	expectValue(t, h, "billing_bytes_total_low", nil, 1)
+
+	// the exact value continues from the split gauges after restart
+	restart(t, h)
+	h.Hub.AddCounter("billing_bytes_total", nil, 1)
+	expectValue(t, h, "billing_bytes_total_low", nil, 2)
+
+	h.Hub.AddCounter("billing_kib_total", nil, 2048)
+	expectValue(t, h, "billing_kib_total", nil, 2)
+}
+
+func batchScenario(t *testing.T, h *Harness) {
+	samples := []handlers.BatchSample{
+		{ID: "batch-1", PushEvent: handlers.PushEvent{Name: "batch_total", Type: "counter", Value: 1}},
+		{ID: "batch-2", PushEvent: handlers.PushEvent{Name: "batch_total", Type: "bogus", Value: 1}},
+		{ID: "batch-1", PushEvent: handlers.PushEvent{Name: "batch_total", Type: "counter", Value: 1}},
+	}
+	resp, err := h.PushBatch(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{handlers.BATCH_ACCEPTED, handlers.BATCH_REJECTED, handlers.BATCH_DUPLICATE}
+	for i, result := range resp.Results {
+		if result.Status != expected[i] {
+			t.Fatalf("sample %d has status %s, expected %s", i, result.Status, expected[i])
+		}
+	}
+	if resp.Results[1].Code != apierror.CODE_INVALID_FIELD || resp.Results[1].Field != "type" {
+		t.Fatalf("rejected sample has code %q and field %q, expected %s and type", resp.Results[1].Code, resp.Results[1].Field, apierror.CODE_INVALID_FIELD)
+	}
+	// retrying the whole batch only records the previously rejected sample
+	samples[1].Type = "counter"
+	if resp, err = h.PushBatch(samples); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Accepted != 1 || resp.Duplicates != 2 {
+		t.Fatalf("retry accepted %d and deduplicated %d samples, expected 1 and 2", resp.Accepted, resp.Duplicates)
+	}
+	expectValue(t, h, "batch_total", nil, 2)
+}
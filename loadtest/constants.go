@@ -0,0 +1,14 @@
+package loadtest
+
+// pushes are scheduled in ticks of this length, rate/ticks per second each
+const TICK_MS = 10
+
+// per-request timeout of pushes
+const REQUEST_TIMEOUT_SEC = 10
+
+// prefix of the synthetic metrics, so they are easy to delete afterwards
+const METRIC_PREFIX = "loadtest_metric_"
+
+// runtime metrics of the target sampled before and after the run
+const MEMORY_METRIC = "go_memstats_heap_inuse_bytes"
+const RSS_METRIC = "process_resident_memory_bytes"
@@ -0,0 +1,252 @@
+// Package loadtest pushes synthetic metrics at a running collector and benchmarks the hub and
+// sink hot paths in-process, so performance regressions are caught before they ship
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/handlers"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Options of a load test run
+type Options struct {
+	// base URL of the collector, e.g. http://localhost:8080
+	URL string
+	// bearer token sent with pushes, empty for none
+	Token string
+	// pushes (requests) per second
+	Rate int
+	// samples per request, 1 uses /push, more /push/batch
+	Batch    int
+	Duration time.Duration
+	// concurrent clients
+	Workers int
+	// distinct metric names and series per metric, their product is the cardinality pushed
+	Metrics int
+	Series  int
+	// "counter", "gauge", "histogram" or "summary"
+	Type string
+}
+
+// Report of a load test run
+type Report struct {
+	Requests int
+	Samples  int
+	// requests per response status, 0 for transport errors
+	Statuses map[int]int
+	// requests the workers could not send in time, the client is the bottleneck then
+	Missed  int
+	Elapsed time.Duration
+	// latencies of completed requests, sorted
+	latencies []time.Duration
+
+	// heap and resident memory of the target before and after, 0 if not exposed
+	HeapBefore, HeapAfter float64
+	RSSBefore, RSSAfter   float64
+}
+
+// pushes synthetic samples for the configured duration and reports what the target sustained
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	opts.URL = strings.TrimSuffix(opts.URL, "/")
+	report := &Report{Statuses: make(map[int]int)}
+	var err error
+	if report.HeapBefore, report.RSSBefore, err = memory(ctx, opts); err != nil {
+		return nil, fmt.Errorf("target not reachable: %w", err)
+	}
+
+	client := &http.Client{
+		Timeout:   REQUEST_TIMEOUT_SEC * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: opts.Workers},
+	}
+	jobs := make(chan int, opts.Workers)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seq := range jobs {
+				start := time.Now()
+				status := push(client, opts, seq)
+				latency := time.Since(start)
+				lock.Lock()
+				report.Requests++
+				report.Samples += opts.Batch
+				report.Statuses[status]++
+				if status != 0 {
+					report.latencies = append(report.latencies, latency)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	schedule(ctx, opts, jobs, &report.Missed)
+	close(jobs)
+	wg.Wait()
+	report.Elapsed = time.Since(start)
+	slices.Sort(report.latencies)
+
+	// a failed sample after the run leaves the "after" figures empty, the run itself counts
+	report.HeapAfter, report.RSSAfter, _ = memory(ctx, opts)
+	return report, nil
+}
+
+// hands out request sequence numbers at the configured rate until the duration is over
+func schedule(ctx context.Context, opts Options, jobs chan<- int, missed *int) {
+	ticker := time.NewTicker(TICK_MS * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(opts.Duration)
+	seq, due := 0, 0.0
+	perTick := float64(opts.Rate) * TICK_MS / 1000
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+		for due += perTick; due >= 1; due-- {
+			select {
+			case jobs <- seq:
+			default:
+				*missed++
+			}
+			seq++
+		}
+	}
+}
+
+// sends one request, returns its status or 0 if it failed
+func push(client *http.Client, opts Options, seq int) int {
+	path, body := payload(opts, seq)
+	req, err := http.NewRequest(http.MethodPost, opts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// request of a sequence number, cycling through all metrics and series
+func payload(opts Options, seq int) (string, []byte) {
+	events := make([]handlers.BatchSample, opts.Batch)
+	for i := range events {
+		n := seq*opts.Batch + i
+		events[i].PushEvent = handlers.PushEvent{
+			Name:   fmt.Sprintf("%s%d", METRIC_PREFIX, n%opts.Metrics),
+			Type:   opts.Type,
+			Value:  float64(n % 100),
+			Labels: map[string]string{"series": fmt.Sprintf("s%d", (n/opts.Metrics)%opts.Series)},
+		}
+	}
+	if opts.Batch == 1 {
+		body, _ := json.Marshal(events[0].PushEvent)
+		return "/push", body
+	}
+	body, _ := json.Marshal(handlers.BatchRequest{Samples: events})
+	return "/push/batch", body
+}
+
+// heap in use and resident memory of the target, from its /metrics
+func memory(ctx context.Context, opts Options) (float64, float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.URL+"/metrics", nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("GET /metrics: %s", resp.Status)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	value := func(name string) float64 {
+		if family, ok := families[name]; ok && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+		return 0
+	}
+	return value(MEMORY_METRIC), value(RSS_METRIC), nil
+}
+
+// latency below which a fraction q of the completed requests finished
+func (report *Report) Percentile(q float64) time.Duration {
+	if len(report.latencies) == 0 {
+		return 0
+	}
+	return report.latencies[min(int(q*float64(len(report.latencies))), len(report.latencies)-1)]
+}
+
+// requests answered with 2xx
+func (report *Report) Succeeded() int {
+	ok := 0
+	for status, count := range report.Statuses {
+		if status >= 200 && status < 300 {
+			ok += count
+		}
+	}
+	return ok
+}
+
+func (report *Report) Print(out io.Writer) {
+	seconds := report.Elapsed.Seconds()
+	fmt.Fprintf(out, "requests:   %d in %s, %.0f/s (%.0f samples/s)\n", report.Requests, report.Elapsed.Round(time.Millisecond),
+		float64(report.Requests)/seconds, float64(report.Samples)/seconds)
+	fmt.Fprintf(out, "succeeded:  %d, %.0f/s\n", report.Succeeded(), float64(report.Succeeded())/seconds)
+	statuses := make([]int, 0, len(report.Statuses))
+	for status := range report.Statuses {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+	for _, status := range statuses {
+		label := fmt.Sprint(status)
+		if status == 0 {
+			label = "error"
+		}
+		fmt.Fprintf(out, "  %-8s  %d\n", label, report.Statuses[status])
+	}
+	if report.Missed > 0 {
+		fmt.Fprintf(out, "missed:     %d requests not sent in time, add workers\n", report.Missed)
+	}
+	if len(report.latencies) > 0 {
+		fmt.Fprintf(out, "latency:    p50 %s  p90 %s  p99 %s  max %s\n", report.Percentile(0.5), report.Percentile(0.9),
+			report.Percentile(0.99), report.latencies[len(report.latencies)-1])
+	}
+	if report.HeapBefore > 0 {
+		fmt.Fprintf(out, "heap:       %.1f MiB -> %.1f MiB\n", report.HeapBefore/(1<<20), report.HeapAfter/(1<<20))
+	}
+	if report.RSSBefore > 0 {
+		fmt.Fprintf(out, "rss:        %.1f MiB -> %.1f MiB\n", report.RSSBefore/(1<<20), report.RSSAfter/(1<<20))
+	}
+}
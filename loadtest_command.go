@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/loadtest"
+)
+
+// pushes synthetic metrics at a running collector and reports throughput, latency and memory
+func loadtestCommand(args []string) int {
+	flags := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	var opts loadtest.Options
+	flags.StringVar(&opts.URL, "url", "http://localhost:8080", "base URL of the collector")
+	flags.StringVar(&opts.Token, "token", "", "bearer token of a pusher, empty for none")
+	flags.IntVar(&opts.Rate, "rate", 1000, "requests per second")
+	flags.IntVar(&opts.Batch, "batch", 1, "samples per request, more than 1 uses /push/batch")
+	flags.DurationVar(&opts.Duration, "duration", 30*time.Second, "length of the run")
+	flags.IntVar(&opts.Workers, "workers", 32, "concurrent clients")
+	flags.IntVar(&opts.Metrics, "metrics", 10, "distinct metric names")
+	flags.IntVar(&opts.Series, "series", 100, "series per metric")
+	flags.StringVar(&opts.Type, "type", "gauge", `"counter", "gauge", "histogram" or "summary"`)
+	flags.Parse(args)
+	if opts.Rate <= 0 || opts.Batch <= 0 || opts.Workers <= 0 || opts.Metrics <= 0 || opts.Series <= 0 || opts.Duration <= 0 {
+		fmt.Fprintln(os.Stderr, "rate, batch, workers, metrics, series and duration must be positive")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Printf("Pushing %d %ss of %d series at %d requests/s to %s for %s\n",
+		opts.Metrics, opts.Type, opts.Metrics*opts.Series, opts.Rate, opts.URL, opts.Duration)
+	report, err := loadtest.Run(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	report.Print(os.Stdout)
+	if report.Succeeded() < report.Requests {
+		return 1
+	}
+	return 0
+}
@@ -2,3 +2,17 @@ package logger
 
 const LOG_FOLDER_NAME = "aria-metrics-logs"
 const LOG_FILE = "aria-metrics-collector.log"
+
+// header carrying the request ID, taken from clients and echoed in responses
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// severities of log lines, lines below the level of the package logging them are dropped
+const (
+	LEVEL_DEBUG Level = iota
+	LEVEL_INFO
+	LEVEL_WARN
+	LEVEL_ERROR
+)
+
+// distinct repeated lines tracked per dedup window, further ones are written as they come
+const MAX_DEDUP_LINES = 1000
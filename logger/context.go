@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+type requestIDKey struct{}
+
+// random ID for a request or poll
+func NewID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// ID of the push or poll that ctx belongs to, empty if none
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// log lines carry [req=<id>] so they can be correlated with the push or poll that caused them
+func ErrorCtx(ctx context.Context, msg string) {
+	if enabled(LEVEL_ERROR) {
+		logCtx(ctx, "[ERROR]", msg)
+	}
+}
+
+func InfoCtx(ctx context.Context, msg string) {
+	if enabled(LEVEL_INFO) {
+		logCtx(ctx, "[INFO]", msg)
+	}
+}
+
+func WarnCtx(ctx context.Context, msg string) {
+	if enabled(LEVEL_WARN) {
+		logCtx(ctx, "[WARN]", msg)
+	}
+}
+
+func DebugCtx(ctx context.Context, msg string) {
+	if enabled(LEVEL_DEBUG) {
+		logCtx(ctx, "[DEBUG]", msg)
+	}
+}
+
+func logCtx(ctx context.Context, level, msg string) {
+	output(level, RequestID(ctx), msg)
+}
+
+// assigns each request the ID sent by the client in X-Request-ID or a new one,
+// and returns it in the response so clients can quote it when reporting problems
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if id == "" || len(id) > 64 {
+			id = NewID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		next(w, r.WithContext(WithRequestID(r.Context(), id)))
+	}
+}
@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dedup counts warn and error lines repeating within a window instead of writing each of them,
+// e.g. the failures of a poller whose endpoint is down; request IDs are not part of the line
+type dedup struct {
+	window time.Duration
+	burst  int
+	done   chan struct{}
+
+	lock sync.Mutex
+	// level + message -> repetitions in the current window
+	lines map[string]*repetition
+}
+
+type repetition struct {
+	level, msg string
+	written    int
+	suppressed int
+}
+
+var deduper atomic.Pointer[dedup]
+
+// counts identical warn and error lines beyond burst per window and writes a summary of them when
+// the window ends; a window of 0 writes every line
+func SetDedup(window time.Duration, burst int) {
+	var next *dedup
+	if window > 0 {
+		next = &dedup{window: window, burst: max(burst, 1), done: make(chan struct{}), lines: make(map[string]*repetition)}
+		go next.run()
+	}
+	if previous := deduper.Swap(next); previous != nil {
+		close(previous.done)
+		previous.flush()
+	}
+}
+
+// whether the line is written, false if it is counted as repetition
+func (dedup *dedup) allow(level, msg string) bool {
+	if dedup == nil || (level != "[WARN]" && level != "[ERROR]") {
+		return true
+	}
+	dedup.lock.Lock()
+	defer dedup.lock.Unlock()
+	key := level + msg
+	line, seen := dedup.lines[key]
+	if !seen {
+		if len(dedup.lines) >= MAX_DEDUP_LINES {
+			return true
+		}
+		line = &repetition{level: level, msg: msg}
+		dedup.lines[key] = line
+	}
+	if line.written < dedup.burst {
+		line.written++
+		return true
+	}
+	line.suppressed++
+	return false
+}
+
+func (dedup *dedup) run() {
+	ticker := time.NewTicker(dedup.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dedup.flush()
+		case <-dedup.done:
+			return
+		}
+	}
+}
+
+// writes the summaries of the window and starts the next one
+func (dedup *dedup) flush() {
+	dedup.lock.Lock()
+	lines := dedup.lines
+	dedup.lines = make(map[string]*repetition)
+	dedup.lock.Unlock()
+
+	for _, line := range lines {
+		if line.suppressed > 0 {
+			log.Println(line.level, fmt.Sprintf("%s (repeated %d more times in the last %v)", line.msg, line.suppressed, dedup.window))
+		}
+	}
+}
+
+// writes a line unless it repeats, see SetDedup
+func output(level, id, msg string) {
+	if !deduper.Load().allow(level, msg) {
+		return
+	}
+	if id != "" {
+		log.Println(level, "[req="+id+"]", msg)
+		return
+	}
+	log.Println(level, msg)
+}
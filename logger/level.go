@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Level int
+
+var levelNames = map[Level]string{LEVEL_DEBUG: "debug", LEVEL_INFO: "info", LEVEL_WARN: "warn", LEVEL_ERROR: "error"}
+
+func (level Level) String() string {
+	return levelNames[level]
+}
+
+// level of "debug", "info", "warn" or "error"
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LEVEL_INFO, fmt.Errorf("unknown log level %q (use \"debug\", \"info\", \"warn\" or \"error\")", name)
+}
+
+// the level of all packages and the ones of single packages overriding it,
+// replaced as a whole so log calls never lock
+type levels struct {
+	base Level
+	// package name, e.g. "poller" -> level
+	modules map[string]Level
+}
+
+var current atomic.Pointer[levels]
+
+// levels in place before ToggleDebug switched everything to debug, nil while not switched
+var (
+	toggleLock  sync.Mutex
+	beforeDebug *levels
+)
+
+func init() {
+	current.Store(&levels{base: LEVEL_INFO})
+}
+
+// checks a base level and per-package levels, an empty base level means info
+func ValidateLevels(base string, modules map[string]string) error {
+	_, err := parseLevels(base, modules)
+	return err
+}
+
+func parseLevels(base string, modules map[string]string) (*levels, error) {
+	parsed := &levels{base: LEVEL_INFO, modules: make(map[string]Level, len(modules))}
+	if base != "" {
+		level, err := ParseLevel(base)
+		if err != nil {
+			return nil, err
+		}
+		parsed.base = level
+	}
+	for module, name := range modules {
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", module, err)
+		}
+		parsed.modules[module] = level
+	}
+	return parsed, nil
+}
+
+// replaces the base level and the per-package levels, e.g. ("info", {"poller": "debug"});
+// nothing changes if any of them is invalid. While ToggleDebug has everything at debug they
+// replace the levels it restores, so they apply once debug is switched off
+func SetLevels(base string, modules map[string]string) error {
+	parsed, err := parseLevels(base, modules)
+	if err != nil {
+		return err
+	}
+	toggleLock.Lock()
+	defer toggleLock.Unlock()
+	if beforeDebug != nil {
+		beforeDebug = parsed
+		return nil
+	}
+	current.Store(parsed)
+	return nil
+}
+
+// the base level and the per-package levels in the form SetLevels takes, those restored
+// after ToggleDebug while it has everything at debug
+func Levels() (string, map[string]string) {
+	toggleLock.Lock()
+	levels := beforeDebug
+	toggleLock.Unlock()
+	if levels == nil {
+		levels = current.Load()
+	}
+	modules := make(map[string]string, len(levels.modules))
+	for module, level := range levels.modules {
+		modules[module] = level.String()
+	}
+	return levels.base.String(), modules
+}
+
+// whether ToggleDebug has all packages at debug
+func DebugToggled() bool {
+	toggleLock.Lock()
+	defer toggleLock.Unlock()
+	return beforeDebug != nil
+}
+
+// switches all packages to debug, or back to the levels before; returns whether debug is on now
+func ToggleDebug() bool {
+	toggleLock.Lock()
+	defer toggleLock.Unlock()
+	if beforeDebug != nil {
+		current.Store(beforeDebug)
+		beforeDebug = nil
+		return false
+	}
+	beforeDebug = current.Load()
+	current.Store(&levels{base: LEVEL_DEBUG})
+	return true
+}
+
+// whether a line of this level is logged for the package calling the logger
+func enabled(level Level) bool {
+	levels := current.Load()
+	if len(levels.modules) > 0 {
+		if moduleLevel, ok := levels.modules[callerModule()]; ok {
+			return level >= moduleLevel
+		}
+	}
+	return level >= levels.base
+}
+
+// name of the first package on the stack outside the logger, e.g. "poller" or "main"
+func callerModule() string {
+	var pcs [8]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		// e.g. github.com/.../poller.(*Poller).poll
+		function := frame.Function[strings.LastIndex(frame.Function, "/")+1:]
+		if module, _, _ := strings.Cut(function, "."); module != "logger" {
+			return module
+		}
+		if !more {
+			return ""
+		}
+	}
+}
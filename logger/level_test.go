@@ -0,0 +1,30 @@
+package logger
+
+import "testing"
+
+func TestSetLevelsWhileDebugToggled(t *testing.T) {
+	if err := SetLevels("info", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !ToggleDebug() {
+		t.Fatal("first toggle did not switch debug on")
+	}
+	if err := SetLevels("warn", map[string]string{"poller": "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	// still at debug until toggled back, reporting the levels to restore
+	if levels := current.Load(); levels.base != LEVEL_DEBUG {
+		t.Fatalf("base level %v while debug is toggled, expected debug", levels.base)
+	}
+	if base, modules := Levels(); base != "warn" || modules["poller"] != "debug" {
+		t.Fatalf("configured levels %s %v, expected warn with poller at debug", base, modules)
+	}
+
+	if ToggleDebug() {
+		t.Fatal("second toggle did not switch debug off")
+	}
+	if base, modules := Levels(); base != "warn" || modules["poller"] != "debug" {
+		t.Fatalf("levels after toggling back %s %v, expected the ones set while toggled", base, modules)
+	}
+	SetLevels("info", nil)
+}
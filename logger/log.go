@@ -45,19 +45,36 @@ func Initialize() (*Logger, error) {
 }
 
 func (appLog *Logger) Close() {
+	// repetitions counted so far are written before the file is closed
+	if dedup := deduper.Load(); dedup != nil {
+		dedup.flush()
+	}
 	if appLog.file != nil {
 		appLog.file.Close()
 	}
 }
 
 func Error(msg string) {
-	log.Println("[ERROR]", msg)
+	if enabled(LEVEL_ERROR) {
+		output("[ERROR]", "", msg)
+	}
 }
 
 func Info(msg string) {
-	log.Println("[INFO]", msg)
+	if enabled(LEVEL_INFO) {
+		output("[INFO]", "", msg)
+	}
 }
 
 func Warn(msg string) {
-	log.Println("[WARN]", msg)
+	if enabled(LEVEL_WARN) {
+		output("[WARN]", "", msg)
+	}
+}
+
+// dropped unless the level of the calling package is debug, see SetLevels
+func Debug(msg string) {
+	if enabled(LEVEL_DEBUG) {
+		output("[DEBUG]", "", msg)
+	}
 }
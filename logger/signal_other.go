@@ -0,0 +1,6 @@
+//go:build !unix
+
+package logger
+
+// SIGUSR1 does not exist here, levels are changed through the admin API only
+func HandleSignals() {}
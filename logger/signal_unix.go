@@ -0,0 +1,31 @@
+//go:build unix
+
+package logger
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// toggles debug logging of all packages on SIGUSR1, see ToggleDebug
+func HandleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			debug := ToggleDebug()
+			base, modules := Levels()
+			// logged at warn, so switching back is visible too
+			Warn(fmt.Sprintf("SIGUSR1: debug logging %s, configured level %s, modules %v", onOff(debug), base, modules))
+		}
+	}()
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -1,58 +1,653 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/agents"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/annotations"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/audit"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/backpressure"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/blackbox"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/chaos"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/discovery"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/handlers"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/plugins"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
-
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/queue"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/quota"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/report"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/simulator"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/sources"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/syslog"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/tail"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/tracing"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/vcenter"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/watchdog"
 )
 
 func main() {
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
+	configPath := flag.String("config", "", "path to JSON config file (defaults are used if empty)")
+	simulate := flag.Bool("simulate", false, "generate synthetic vSphere metrics, see the simulator config section")
+	chaosMode := flag.Bool("chaos", false, "allow failure injection via /admin/chaos, for test deployments only")
+	flag.Parse()
+
+	if err := run(*configPath, *simulate, *chaosMode); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runs the collector until its listeners fail or it is interrupted; returning lets the
+// deferred shutdown run, flushing buffered spans and closing the log files
+func run(configPath string, simulate, chaosMode bool) error {
 	// Initialize logger
 
-	logger, err := logger.Initialize()
+	appLog, err := logger.Initialize()
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	fmt.Printf("Writing logs to %v\n", appLog.Dir)
+	defer appLog.Close()
+
+	// refuse to start with a config that validate-config would reject, also one given only
+	// through COLLECTOR_* environment variables
+	issues, err := validateConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	source := configPath
+	if source == "" {
+		source = "environment"
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", source, issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("invalid config %s, run validate-config for details", source)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := applyLogConfig(cfg.Log); err != nil {
+		return fmt.Errorf("invalid log config: %w", err)
+	}
+
+	shutdownTracing, err := tracing.Initialize(cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to initialize logger: %v", err)
+		return fmt.Errorf("failed to initialize tracing: %w", err)
 	}
-	fmt.Printf("Writing logs to %v\n", logger.Dir)
-	defer logger.Close()
+	defer shutdownTracing(context.Background())
 
 	// Create metric hub and prometheus sink
 	hub := metrics.NewMetricHub()
-	//TODO: make checkpoint file and interval configurable
-	promSink := prometheus.NewSink(METRICS_BACKUP_FILE, METRICS_BACKUP_INTERVAL_SEC*time.Second)
+	units, err := metrics.NewUnitConverter(cfg.Units)
+	if err != nil {
+		return fmt.Errorf("invalid units config: %w", err)
+	}
+	hub.SetUnits(units)
+	hub.SetInfoTracker(metrics.NewInfoTracker(cfg.InfoMetrics))
+	promSink := prometheus.NewSink(cfg.CheckpointFile, cfg.CheckpointInterval.Duration, cfg.Restore)
+	if err := promSink.SetHistogramSchemas(cfg.Histograms); err != nil {
+		return fmt.Errorf("invalid histogram config: %w", err)
+	}
+	if err := promSink.SetSummarySchemas(cfg.Summaries); err != nil {
+		return fmt.Errorf("invalid summary config: %w", err)
+	}
+	promSink.SetPersistence(cfg.Persistence)
+	var interner *util.Interner
+	if cfg.LabelInterning.Enabled {
+		interner = util.NewInterner(cfg.LabelInterning.MaxStrings)
+		promSink.SetInterner(interner)
+	}
+	if err := promSink.SetCounterPrecision(cfg.CounterPrecision); err != nil {
+		return fmt.Errorf("invalid counter precision config: %w", err)
+	}
+	if len(cfg.Freshness) > 0 {
+		promSink.EnableFreshness(cfg.Freshness)
+	}
+	if cfg.RestoreMarkers {
+		promSink.EnableRestoreMarkers()
+	}
+	promSink.SetRemapConflicts(cfg.MetricConflicts == "remap")
 	hub.RegisterSink(promSink)
+	if err := plugins.LoadAll(cfg.Plugins); err != nil {
+		return err
+	}
+	for _, sc := range cfg.Sinks {
+		sink, err := plugins.NewSink(sc.Type, sc.Options)
+		if err != nil {
+			return fmt.Errorf("failed to create sink %s: %w", sc.Type, err)
+		}
+		if sc.Queue != nil {
+			writer, ok := sink.(metrics.SampleWriter)
+			if !ok {
+				return fmt.Errorf("sink %s does not support queueing", sc.Type)
+			}
+			sinkQueue, err := queue.New(sc.Type, *sc.Queue, writer, hub)
+			if err != nil {
+				return fmt.Errorf("failed to open queue of sink %s: %w", sc.Type, err)
+			}
+			sinkQueue.Start()
+			sink = sinkQueue
+		}
+		hub.RegisterSink(sink)
+	}
+	for _, ic := range cfg.Interceptors {
+		interceptor, err := metrics.NewInterceptor(ic.Type, ic.Options)
+		if err != nil {
+			return fmt.Errorf("failed to create interceptor %s: %w", ic.Type, err)
+		}
+		hub.Use(interceptor)
+	}
+	var injector *chaos.Injector
+	if chaosMode {
+		injector = newChaos(hub, promSink)
+	}
+	if len(cfg.CounterWindows) > 0 {
+		windows, err := metrics.NewCounterWindows(cfg.CounterWindows, hub)
+		if err != nil {
+			return fmt.Errorf("invalid counter windows config: %w", err)
+		}
+		windows.SetInterner(interner)
+		hub.RegisterSink(windows)
+		windows.Start()
+	}
+	if cfg.Lint.Enabled {
+		linter := metrics.NewLinter(cfg.Lint.Ignore)
+		hub.RegisterSink(linter)
+		handlers.Lint = linter
+	}
+	if cfg.SeriesTTL.Duration > 0 {
+		promSink.StartExpiry(cfg.SeriesTTL.Duration)
+	}
+
+	// evict old series when running out of memory
+	var memoryGuard *watchdog.MemoryGuard
+	if cfg.MemoryGuard.Enabled {
+		memoryGuard = watchdog.NewMemoryGuard(cfg.MemoryGuard, promSink)
+		memoryGuard.Start()
+	}
+
+	// tell pushing clients to back off while saturated
+	var limiter *backpressure.Limiter
+	if cfg.Backpressure.MaxInFlight > 0 || cfg.Backpressure.OnMemoryPressure {
+		limiter = backpressure.NewLimiter(cfg.Backpressure, hub)
+		if cfg.Backpressure.OnMemoryPressure && memoryGuard != nil {
+			limiter.Pressure = memoryGuard.OverLimit
+		}
+		limiter.Start()
+	}
 
 	// set global handler hub
 	handlers.Hub = hub
+	if cfg.CheckpointFile != "" {
+		handlers.PromSink = promSink
+	}
+	// multi-tenant mode, each tenant scrapes a registry of its own metrics
+	if oidc := cfg.Auth.OIDC; oidc != nil && oidc.TenantClaim != "" {
+		tenants := prometheus.NewTenantRegistries(oidc.Tenants)
+		promSink.SetTenants(tenants)
+		handlers.Tenants = tenants
+	}
+	if cfg.Audit.File != "" {
+		auditLog, err := audit.Open(cfg.Audit.File)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		defer auditLog.Close()
+		auditLog.Record(audit.Entry{Actor: "collector", Action: "start", Target: configPath, Result: "ok"})
+		handlers.Audit = auditLog
+	}
+	handlers.EndpointLabels = cfg.Push.EndpointLabels
+	if len(cfg.Push.Cumulative) > 0 {
+		handlers.Cumulative = metrics.NewCumulativeConverter(cfg.Push.Cumulative)
+	}
+	if len(cfg.Push.GaugeMerge) > 0 {
+		handlers.GaugeMerge = metrics.NewGaugeMerger(cfg.Push.GaugeMerge)
+	}
+	if cfg.PushSources.Dir != "" {
+		inventory := sources.NewInventory(cfg.PushSources, hub)
+		if err := inventory.Start(); err != nil {
+			return fmt.Errorf("failed to load push sources: %w", err)
+		}
+		handlers.Sources = inventory
+	}
+	if cfg.Agents.Enabled {
+		registry := agents.NewRegistry(cfg.Agents, hub)
+		registry.Audit = handlers.Audit
+		if err := registry.Start(); err != nil {
+			return fmt.Errorf("failed to load agent registrations: %w", err)
+		}
+		handlers.Agents = registry
+	}
+	var annotationStore *annotations.Store
+	if cfg.Annotations.Enabled {
+		annotationStore = annotations.NewStore(cfg.Annotations, hub)
+		if err := annotationStore.Load(); err != nil {
+			return fmt.Errorf("failed to load annotations: %w", err)
+		}
+		handlers.Annotations = annotationStore
+	}
+	var seriesQuota *quota.SeriesQuota
+	if cfg.SeriesQuota.PerMinute > 0 || len(cfg.SeriesQuota.Sources) > 0 {
+		seriesQuota = quota.NewSeriesQuota(cfg.SeriesQuota, hub)
+		handlers.Quota = seriesQuota
+		promSink.SetForgetter(seriesQuota)
+		if cfg.SeriesTTL.Duration > 0 {
+			seriesQuota.StartExpiry(cfg.SeriesTTL.Duration)
+		}
+	}
+	if cfg.UDPBypassesAuth() {
+		return errors.New("refusing to start the UDP listener: its pushes bypass auth and push signatures, set udp.allowUnauthenticated to accept them")
+	}
+	if cfg.UDP.ListenAddr != "" {
+		if err := handlers.NewUDPListener(cfg.UDP, hub).Start(); err != nil {
+			return fmt.Errorf("failed to start UDP listener: %w", err)
+		}
+	}
 
 	// poll remote GET endpoints periodically and set gauges
-	pollers := []*poller.Poller{
-		poller.NewPoller("http://localhost:5000/gauge1", "external_gauge_1", map[string]string{"source": "fake-api"}, 15*time.Second, hub),
-		poller.NewPoller("http://localhost:5000/gauge2", "external_gauge_2", map[string]string{"source": "fake-api"}, 20*time.Second, hub),
+	resolver, err := newSecretsResolver(cfg.Vault)
+	if err != nil {
+		return fmt.Errorf("failed to initialize secrets: %w", err)
+	}
+	if handlers.PushSignature, err = auth.NewVerifier(cfg.Push.Signature, resolver); err != nil {
+		return fmt.Errorf("invalid push signature config: %w", err)
+	}
+	sessions := vcenter.NewSessionPool(resolver)
+	sessions.StartKeepalive(cfg.SessionKeepalive.Duration)
+	hostLimits := poller.NewHostLimits(cfg.HostRateLimit, hub)
+	nameResolvers := newNameResolvers(cfg.NameResolvers, hub, resolver, sessions)
+	var onDemand *poller.OnDemand
+	if scrapeTriggered(cfg) {
+		onDemand = poller.NewOnDemand()
+	}
+	var maintenance *poller.Maintenance
+	if len(cfg.Maintenance) > 0 {
+		if maintenance, err = poller.NewMaintenance(cfg.Maintenance, hub); err != nil {
+			return fmt.Errorf("failed to create maintenance windows: %w", err)
+		}
+		maintenance.Annotations = annotationStore
+		maintenance.Start()
 	}
-	for _, p := range pollers {
+	shard, err := poller.NewShard(cfg.Shard)
+	if err != nil {
+		return fmt.Errorf("invalid shard config: %w", err)
+	}
+	var recorder *poller.Recorder
+	if cfg.Debug.LastResponses {
+		recorder = poller.NewRecorder(cfg.Debug)
+		handlers.Recorder = recorder
+	}
+	var warmup *poller.Warmup
+	if cfg.Warmup.GateMetrics {
+		warmup = poller.NewWarmup(cfg.Warmup)
+	}
+	owned := 0
+	for _, pc := range cfg.Pollers {
+		if !shard.Owns(poller.ShardKey(pc)) {
+			continue
+		}
+		owned++
+		pc.ImmediateFirstPoll = pc.ImmediateFirstPoll || cfg.Warmup.ImmediateFirstPoll
+		p, err := newPoller(pc, hub, resolver, sessions)
+		if err != nil {
+			return fmt.Errorf("failed to create poller %s: %w", pc.URL, err)
+		}
+		if cfg.StaggerPollers {
+			p.Offset = poller.StaggerOffset(p.Name, p.Interval)
+		}
+		p.Quota = seriesQuota
+		p.HostLimits = hostLimits
+		p.Recorder = recorder
+		p.Maintenance = maintenance.For(p.Name, pc.Labels)
+		p.Annotations = annotationStore
+		p.ResolveLabels = resolveLabels(pc, nameResolvers)
+		p.Chaos = injector
+		if pc.ScrapeTriggered {
+			p.OnDemand = onDemand
+		}
+		p.Warmup = warmup
 		p.Start()
 	}
+	for _, dc := range cfg.Discovery {
+		var auth poller.Authenticator
+		if dc.VCenter != nil {
+			auth = sessions.Get(dc.VCenter.URL, dc.VCenter.Username, dc.VCenter.Password)
+		}
+		factory := func(pc config.PollerConfig) (discovery.Target, error) {
+			pc.ImmediateFirstPoll = pc.ImmediateFirstPoll || cfg.Warmup.ImmediateFirstPoll
+			p, err := newPoller(pc, hub, resolver, sessions)
+			if err != nil {
+				return nil, err
+			}
+			if cfg.StaggerPollers {
+				p.Offset = poller.StaggerOffset(p.Name, p.Interval)
+			}
+			p.Quota = seriesQuota
+			p.HostLimits = hostLimits
+			p.Recorder = recorder
+			p.Maintenance = maintenance.For(p.Name, pc.Labels)
+			p.Annotations = annotationStore
+			p.ResolveLabels = resolveLabels(pc, nameResolvers)
+			p.Chaos = injector
+			if pc.ScrapeTriggered {
+				p.OnDemand = onDemand
+			}
+			return p, nil
+		}
+		disc, err := discovery.New(dc, factory, resolver, auth)
+		if err != nil {
+			return fmt.Errorf("failed to create discovery %s: %w", dc.Name, err)
+		}
+		disc.Shard = shard
+		disc.Start()
+	}
+	if len(cfg.ProbeModules) > 0 {
+		handlers.ProbeModules = cfg.ProbeModules
+		handlers.ProbeProbers = make(map[string]*blackbox.Prober)
+		for name, module := range cfg.ProbeModules {
+			if module.HTTP != nil {
+				handlers.ProbeProbers[name] = blackbox.NewProber(*module.HTTP, resolver)
+			}
+		}
+		handlers.NewProbePoller = func(pc config.PollerConfig) (*poller.Poller, error) {
+			p, err := newPoller(pc, hub, resolver, sessions)
+			if err != nil {
+				return nil, err
+			}
+			p.HostLimits = hostLimits
+			p.ResolveLabels = resolveLabels(pc, nameResolvers)
+			return p, nil
+		}
+	}
+	if simulate && cfg.Simulator == nil {
+		cfg.Simulator = &config.SimulatorConfig{}
+	}
+	if cfg.Simulator != nil {
+		simulator.New(*cfg.Simulator, hub).Start()
+	}
+	for _, sc := range cfg.SnmpPollers {
+		if !shard.Owns(sc.Name) {
+			continue
+		}
+		owned++
+		sc.ImmediateFirstPoll = sc.ImmediateFirstPoll || cfg.Warmup.ImmediateFirstPoll
+		p, err := poller.NewSnmpPoller(sc, hub, resolver)
+		if err != nil {
+			return fmt.Errorf("failed to create SNMP poller %s: %w", sc.Name, err)
+		}
+		if cfg.StaggerPollers {
+			p.Offset = poller.StaggerOffset(sc.Name, sc.Interval.Duration)
+		}
+		p.Warmup = warmup
+		p.Quota = seriesQuota
+		p.Chaos = injector
+		p.Start()
+	}
+
+	for _, tc := range cfg.Tails {
+		tailer, err := tail.New(tc, hub)
+		if err != nil {
+			return fmt.Errorf("invalid tail rules for %s: %w", tc.Path, err)
+		}
+		tailer.Start()
+	}
+	for _, ec := range cfg.Execs {
+		if !shard.Owns(ec.Name) {
+			continue
+		}
+		owned++
+		ec.ImmediateFirstPoll = ec.ImmediateFirstPoll || cfg.Warmup.ImmediateFirstPoll
+		p, err := poller.NewExecPoller(ec, hub, resolver)
+		if err != nil {
+			return fmt.Errorf("failed to create exec poller %s: %w", ec.Name, err)
+		}
+		if cfg.StaggerPollers {
+			p.Offset = poller.StaggerOffset(ec.Name, ec.Interval.Duration)
+		}
+		p.Warmup = warmup
+		p.Chaos = injector
+		p.Start()
+	}
+	// discovered pollers come later, they are not waited for
+	if warmup != nil {
+		warmup.Start()
+	}
+	var probed []config.BlackboxTargetConfig
+	for _, bc := range cfg.Blackbox {
+		if name := bc.Name; shard.Owns(name) || (name == "" && shard.Owns(bc.URL)) {
+			probed = append(probed, bc)
+		}
+	}
+	if len(probed) > 0 {
+		blackbox.NewMonitor(probed, hub, resolver).Start()
+	}
+	if shard != nil {
+		// discovered pollers are split the same way as they come and go
+		configured := len(cfg.Pollers) + len(cfg.SnmpPollers) + len(cfg.Execs)
+		fmt.Printf("Shard %d of %d runs %d of %d configured pollers\n", shard.Index, shard.Total, owned, configured)
+	}
+
+	if cfg.SnmpTraps.ListenAddr != "" {
+		receiver, err := poller.NewSnmpTrapReceiver(cfg.SnmpTraps, hub, resolver)
+		if err != nil {
+			return fmt.Errorf("failed to create SNMP trap receiver: %w", err)
+		}
+		receiver.Quota = seriesQuota
+		if err := receiver.Start(); err != nil {
+			return fmt.Errorf("failed to start SNMP trap listener: %w", err)
+		}
+	}
+	if cfg.Report != nil {
+		reporter, err := report.New(*cfg.Report, hub, resolver)
+		if err != nil {
+			return fmt.Errorf("invalid report config: %w", err)
+		}
+		reporter.Start()
+	}
+	if cfg.Syslog.UDPAddr != "" || cfg.Syslog.TCPAddr != "" {
+		receiver, err := syslog.New(cfg.Syslog, hub)
+		if err != nil {
+			return fmt.Errorf("invalid syslog rules: %w", err)
+		}
+		receiver.Quota = seriesQuota
+		if err := receiver.Start(); err != nil {
+			return fmt.Errorf("failed to start syslog listener: %w", err)
+		}
+	}
 
-	// HTTP routes for receiving pushed events
-	http.HandleFunc("/event", handlers.EventHandler) // legacy format
-	http.HandleFunc("/push", handlers.PushHandler)   // generic push
+	var authz *auth.Authorizer
+	if len(cfg.Auth.Tokens) > 0 || cfg.Auth.OIDC != nil {
+		tokens, err := auth.NewStaticTokens(cfg.Auth.Tokens, resolver)
+		if err != nil {
+			return fmt.Errorf("failed to load auth tokens: %w", err)
+		}
+		tokens.StartRefresh(auth.TOKEN_REFRESH_INTERVAL)
+		authenticators := []auth.Authenticator{tokens}
+		if cfg.Auth.OIDC != nil {
+			authenticators = append(authenticators, auth.NewOIDC(*cfg.Auth.OIDC))
+		}
+		authz = auth.NewAuthorizer(authenticators...)
+	}
+
+	tlsConfig, err := auth.ServerTLS(cfg.TLS)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS config: %w", err)
+	}
+	certs := auth.NewClientCerts(cfg.TLS)
+	handlers.CertSourceLabel = cfg.TLS.SourceLabel
 
-	// for Prometheus scraping
-	http.Handle("/metrics", promhttp.Handler())
+	srv := newServers(tlsConfig)
+	registerRoutes(cfg, srv, limiter, authz, certs, onDemand, warmup)
 
-	// health check endpoint
-	http.HandleFunc("/health", handlers.HealthHandler)
-	addr := ":8080"
-	fmt.Println("Starting exporter on", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	// stop on SIGINT/SIGTERM by returning, log.Fatal and os.Exit would skip the deferred shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() { errs <- srv.listenAndServe() }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		logger.Info("Shutting down")
+		return nil
+	}
+}
+
+// failure injection of polls, sink updates and checkpoint saves, off until set via /admin/chaos
+func newChaos(hub *metrics.MetricHub, promSink *prometheus.PrometheusSink) *chaos.Injector {
+	injector := chaos.NewInjector(hub)
+	hub.Use(injector.Interceptor())
+	promSink.SetCheckpointFault(injector.CheckpointError)
+	handlers.Chaos = injector
+	logger.Warn("Failure injection is enabled, polls, sinks and checkpoint saves may fail on purpose")
+	return injector
+}
+
+// name resolvers by name, pollers referring to the same resolver share its cache
+func newNameResolvers(cfgs []config.NameResolverConfig, hub *metrics.MetricHub, resolver *secrets.Resolver, sessions *vcenter.SessionPool) map[string]*poller.NameResolver {
+	resolvers := make(map[string]*poller.NameResolver, len(cfgs))
+	for _, rc := range cfgs {
+		r := poller.NewNameResolver(rc, hub)
+		r.Secrets = resolver
+		if rc.VCenter != nil {
+			r.Auth = sessions.Get(rc.VCenter.URL, rc.VCenter.Username, rc.VCenter.Password)
+		}
+		resolvers[rc.Name] = r
+	}
+	return resolvers
+}
+
+// the resolvers of the labels a poller resolves, nil if none
+func resolveLabels(pc config.PollerConfig, resolvers map[string]*poller.NameResolver) map[string]*poller.NameResolver {
+	if len(pc.ResolveLabels) == 0 {
+		return nil
+	}
+	labels := make(map[string]*poller.NameResolver, len(pc.ResolveLabels))
+	for label, name := range pc.ResolveLabels {
+		labels[label] = resolvers[name]
+	}
+	return labels
+}
+
+// creates a poller from its config entry
+func newPoller(pc config.PollerConfig, hub *metrics.MetricHub, resolver *secrets.Resolver, sessions *vcenter.SessionPool) (*poller.Poller, error) {
+	p := poller.NewPoller(pc.URL, pc.Metric, pc.Labels, pc.Interval.Duration, hub)
+	p.Headers = pc.Headers
+	p.Secrets = resolver
+	if pc.HTTP != nil {
+		p.Client.Transport = poller.SharedTransport(*pc.HTTP)
+	}
+	if pc.VCenter != nil {
+		p.Auth = sessions.Get(pc.VCenter.URL, pc.VCenter.Username, pc.VCenter.Password)
+	}
+	processor, err := poller.NewProcessor(pc)
+	if err != nil {
+		return nil, err
+	}
+	p.Processor = processor
+	if pc.Name != "" {
+		p.Name = pc.Name
+	}
+	p.StaleIntervals = pc.StaleIntervals
+	p.ImmediateFirstPoll = pc.ImmediateFirstPoll
+	p.SkipUnchanged = pc.SkipUnchanged
+	if pc.MaxBodyBytes > 0 {
+		p.MaxBodyBytes = pc.MaxBodyBytes
+	}
+	if pc.Breaker != nil {
+		p.Breaker = poller.NewBreaker(*pc.Breaker, resolver)
+	}
+	if pc.Success != nil {
+		p.Success = poller.NewSuccessCriteria(*pc.Success)
+	}
+	if pc.Pipeline != nil {
+		p.Pipeline = poller.NewPipeline(*pc.Pipeline)
+	}
+	if pc.GraphQL != nil {
+		if p.Body, err = poller.GraphQLBody(*pc.GraphQL); err != nil {
+			return nil, fmt.Errorf("invalid graphql variables: %w", err)
+		}
+	}
+	if p.Signature, err = auth.NewVerifier(pc.Signature, resolver); err != nil {
+		return nil, err
+	}
+	if pc.DetectSchemaDrift {
+		p.Schema = poller.NewSchemaTracker()
+	}
+	if pc.Adaptive != nil {
+		p.Adaptive = poller.NewAdaptive(*pc.Adaptive, pc.Interval.Duration)
+	}
+	p.MaxStaleness = pc.Interval.Duration
+	if pc.MaxStaleness.Duration > 0 {
+		p.MaxStaleness = pc.MaxStaleness.Duration
+	}
+	if pc.Schedule != "" {
+		if p.Cron, err = poller.ParseCron(pc.Schedule); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// whether any poller or discovered poller template polls when metrics are scraped
+func scrapeTriggered(cfg *config.Config) bool {
+	for _, pc := range cfg.Pollers {
+		if pc.ScrapeTriggered {
+			return true
+		}
+	}
+	for _, dc := range cfg.Discovery {
+		if dc.Poller.ScrapeTriggered {
+			return true
+		}
+	}
+	return false
+}
+
+// sets the configured log levels and repetition counting, and toggles debug logging on SIGUSR1;
+// outside main, which shadows the logger package
+func applyLogConfig(lc config.LogConfig) error {
+	if err := logger.SetLevels(lc.Level, lc.Modules); err != nil {
+		return err
+	}
+	logger.SetDedup(lc.DedupWindow.Duration, lc.DedupBurst)
+	logger.HandleSignals()
+	return nil
+}
+
+// creates secrets resolver with env/file providers and Vault if configured
+func newSecretsResolver(vc config.VaultConfig) (*secrets.Resolver, error) {
+	resolver := secrets.NewResolver()
+	if vc.Address == "" {
+		return resolver, nil
+	}
+
+	token, err := resolver.Expand(vc.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve vault token: %w", err)
+	}
+	vault := secrets.NewVaultProvider(vc.Address, token, vc.DefaultTTL.Duration)
+	vault.StartTokenRenewal()
+	resolver.Register("vault", vault)
+	return resolver, nil
 }
@@ -0,0 +1,32 @@
+package metrics
+
+// resolved unit mappings cached by UnitConverter before the cache starts over
+const MAX_UNIT_MAPPINGS = 10000
+
+// counter windows are tracked in this many steps, the oldest step expires as a whole
+const WINDOW_STEPS = 60
+
+// rules checked by Linter
+const LINT_SNAKE_CASE = "snake_case"
+const LINT_COLON = "colon"
+const LINT_UNDERSCORES = "underscores"
+const LINT_COUNTER_TOTAL = "counter_total"
+const LINT_RESERVED_SUFFIX = "reserved_suffix"
+const LINT_BASE_UNIT = "base_unit"
+
+// sources of merged gauges not pushing within this time drop out, see GaugeMerger
+const DEFAULT_MERGE_INTERVAL_SEC = 60
+
+// cumulative series not updated within this time are forgotten, checked every
+// CUMULATIVE_SWEEP_SEC; their next value is a new baseline, see CumulativeConverter
+const CUMULATIVE_IDLE_SEC = 24 * 60 * 60
+const CUMULATIVE_SWEEP_SEC = 60 * 60
+
+// built-in interceptors, see NewInterceptor
+const INTERCEPTOR_RELABEL = "relabel"
+const INTERCEPTOR_VALIDATE = "validate"
+const INTERCEPTOR_TRANSFORM = "transform"
+const INTERCEPTOR_MAP = "map"
+
+// updates dropped by the validate interceptor, labelled by reason
+const INTERCEPTOR_DROPPED_METRIC = "collector_interceptor_dropped_total"
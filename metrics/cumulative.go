@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// last pushed cumulative value of a series
+type cumulativeSample struct {
+	value float64
+	at    time.Time
+}
+
+// CumulativeConverter turns pushed cumulative totals (sent as gauges by some agents)
+// into a proper counter plus a "<name>_rate" gauge with the per-second rate since the previous push
+// a value lower than the previous one is treated as a counter reset of the agent;
+// the zero value converts without patterns, for pollers reading cumulative counters
+type CumulativeConverter struct {
+	lock      sync.Mutex
+	patterns  []string
+	last      map[string]cumulativeSample
+	lastSweep time.Time
+}
+
+// patterns are globs matched against metric names, e.g. "esx_*_bytes_total"
+func NewCumulativeConverter(patterns []string) *CumulativeConverter {
+	return &CumulativeConverter{
+		patterns: patterns,
+		last:     make(map[string]cumulativeSample),
+	}
+}
+
+// reports whether the metric was declared cumulative
+func (conv *CumulativeConverter) Matches(name string) bool {
+	if conv == nil {
+		return false
+	}
+	for _, pattern := range conv.patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// emits counter increase and rate for a pushed cumulative value
+// the first value of a series is only recorded as baseline, so collector restarts
+// don't add the agent's whole total to the restored counter again
+func (conv *CumulativeConverter) Apply(sink MetricSink, name string, labels map[string]string, value float64) {
+	delta, elapsed, seen := conv.increase(sink, name, labels, value, 0)
+	if seen && elapsed > 0 {
+		sink.SetGauge(strings.TrimSuffix(name, "_total")+"_rate", labels, delta/elapsed)
+	}
+}
+
+// emits the counter increase of a polled cumulative value, without rate; with wrap > 0 a
+// lower value is taken as the total having wrapped around at wrap, e.g. 2^32 for SNMP
+// Counter32, rather than as a reset; NaN and negative totals are ignored
+func (conv *CumulativeConverter) Increase(sink MetricSink, name string, labels map[string]string, value, wrap float64) {
+	if math.IsNaN(value) || value < 0 {
+		return
+	}
+	conv.increase(sink, name, labels, value, wrap)
+}
+
+// adds the increase since the previous value of the series, returns it with the seconds
+// since that value, seen is false for the first value of a series
+func (conv *CumulativeConverter) increase(sink MetricSink, name string, labels map[string]string, value, wrap float64) (delta, elapsed float64, seen bool) {
+	key := name + "{" + util.JoinMapEntries(labels) + "}"
+	now := time.Now()
+
+	conv.lock.Lock()
+	if conv.last == nil {
+		conv.last = make(map[string]cumulativeSample)
+	}
+	conv.sweep(now)
+	prev, seen := conv.last[key]
+	conv.last[key] = cumulativeSample{value: value, at: now}
+	conv.lock.Unlock()
+
+	if !seen {
+		// creates the series without changing its value
+		sink.AddCounter(name, labels, 0)
+		return 0, 0, false
+	}
+
+	delta = value - prev.value
+	if delta < 0 {
+		if wrap > 0 {
+			delta += wrap
+		} else {
+			// agent restarted and its total started from zero
+			delta = value
+		}
+	}
+	sink.AddCounter(name, labels, delta)
+	return delta, now.Sub(prev.at).Seconds(), true
+}
+
+// forgets series idle for CUMULATIVE_IDLE_SEC, caller must hold the lock
+func (conv *CumulativeConverter) sweep(now time.Time) {
+	if now.Sub(conv.lastSweep) < CUMULATIVE_SWEEP_SEC*time.Second {
+		return
+	}
+	conv.lastSweep = now
+	for key, sample := range conv.last {
+		if now.Sub(sample.at) > CUMULATIVE_IDLE_SEC*time.Second {
+			delete(conv.last, key)
+		}
+	}
+}
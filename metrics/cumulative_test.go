@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+type nullSink struct{}
+
+func (nullSink) IncCounter(name string, labels map[string]string)                    {}
+func (nullSink) AddCounter(name string, labels map[string]string, delta float64)     {}
+func (nullSink) SetGauge(name string, labels map[string]string, value float64)       {}
+func (nullSink) Observe(name string, labels map[string]string, value float64)        {}
+func (nullSink) ObserveSummary(name string, labels map[string]string, value float64) {}
+
+func TestCumulativeForgetsIdleSeries(t *testing.T) {
+	conv := NewCumulativeConverter([]string{"*_total"})
+	conv.Apply(nullSink{}, "bytes_total", map[string]string{"host": "gone"}, 10)
+	conv.last["bytes_total{host=gone}"] = cumulativeSample{value: 10, at: time.Now().Add(-2 * CUMULATIVE_IDLE_SEC * time.Second)}
+	conv.lastSweep = time.Now().Add(-2 * CUMULATIVE_SWEEP_SEC * time.Second)
+
+	conv.Apply(nullSink{}, "bytes_total", map[string]string{"host": "new"}, 5)
+	if _, ok := conv.last["bytes_total{host=gone}"]; ok {
+		t.Fatal("idle series is still tracked")
+	}
+	if len(conv.last) != 1 {
+		t.Fatalf("%d series tracked, expected the new one", len(conv.last))
+	}
+}
+
+func TestIncreaseIgnoresInvalidTotals(t *testing.T) {
+	var conv CumulativeConverter
+	conv.Increase(nullSink{}, "runs_total", nil, 10, 0)
+	conv.Increase(nullSink{}, "runs_total", nil, math.NaN(), 0)
+	conv.Increase(nullSink{}, "runs_total", nil, -1, 0)
+	if sample := conv.last["runs_total{}"]; sample.value != 10 {
+		t.Fatalf("last total %v, expected 10", sample.value)
+	}
+}
@@ -0,0 +1,48 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+	client "github.com/prometheus/client_golang/prometheus"
+)
+
+// a hub fanning out to a Prometheus sink on a private registry without checkpoint
+func newBenchHub() *metrics.MetricHub {
+	hub := metrics.NewMetricHub()
+	hub.RegisterSink(prometheus.NewSinkWithRegistry(client.NewRegistry(), "", 0))
+	return hub
+}
+
+func BenchmarkHubIncCounter(b *testing.B) {
+	hub := newBenchHub()
+	labels := map[string]string{"series": "s0"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hub.IncCounter("bench_total", labels)
+	}
+}
+
+func BenchmarkHubSetGauge(b *testing.B) {
+	hub := newBenchHub()
+	series := make([]map[string]string, 1000)
+	for i := range series {
+		series[i] = map[string]string{"series": fmt.Sprintf("s%d", i)}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hub.SetGauge("bench_gauge", series[i%len(series)], float64(i))
+	}
+}
+
+func BenchmarkHubWithContextSetGauge(b *testing.B) {
+	hub := newBenchHub()
+	labels := map[string]string{"series": "s0"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hub.WithContext(context.Background()).SetGauge("bench_gauge", labels, float64(i))
+	}
+}
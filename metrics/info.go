@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// identity labels declared by sources of info metrics, metric name -> labels
+var declaredInfo sync.Map
+
+// sets an info metric: a gauge fixed at 1 whose labels carry metadata like versions;
+// identity names the labels telling entities apart, a series of the same entity with other
+// labels is retired by hubs tracking info metrics, see InfoTracker
+func SetInfo(sink MetricSink, name string, identity []string, labels map[string]string) {
+	if len(identity) > 0 {
+		declaredInfo.Store(name, identity)
+	}
+	sink.SetGauge(name, labels, 1)
+}
+
+// InfoTracker remembers the current series of each entity of info metrics (names ending in
+// "_info"), so the previous series is deleted when the metadata of an entity changes
+type InfoTracker struct {
+	rules []config.InfoMetricRule
+
+	lock sync.Mutex
+	// name -> identity key -> labels of the current series
+	current map[string]map[string]map[string]string
+}
+
+func NewInfoTracker(rules []config.InfoMetricRule) *InfoTracker {
+	return &InfoTracker{rules: rules, current: make(map[string]map[string]map[string]string)}
+}
+
+// identity labels of an info metric, configured rules take precedence over declarations;
+// nil if unknown, each label set is then a series of its own
+func (tracker *InfoTracker) identity(name string) []string {
+	for _, rule := range tracker.rules {
+		if matched, _ := path.Match(rule.Match, name); matched {
+			return rule.Identity
+		}
+	}
+	if identity, ok := declaredInfo.Load(name); ok {
+		return identity.([]string)
+	}
+	return nil
+}
+
+// records an update of a gauge, returns the labels of the series it replaces, none if the
+// entity is unchanged; series of an entity seen for the first time, e.g. restored from checkpoint
+// after a restart, are looked up in existing (labelsKey -> value); a nil tracker tracks nothing
+func (tracker *InfoTracker) track(name string, labels map[string]string, existing func(name string) map[string]float64) []map[string]string {
+	if tracker == nil || !strings.HasSuffix(name, "_info") {
+		return nil
+	}
+	identity := tracker.identity(name)
+	if identity == nil {
+		return nil
+	}
+	id := make(map[string]string, len(identity))
+	for _, label := range identity {
+		id[label] = labels[label]
+	}
+	key := util.JoinMapEntries(id)
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	entities, ok := tracker.current[name]
+	if !ok {
+		entities = make(map[string]map[string]string)
+		tracker.current[name] = entities
+	}
+	labelsKey := util.JoinMapEntries(labels)
+	previous, known := entities[key]
+	if known && util.JoinMapEntries(previous) == labelsKey {
+		return nil
+	}
+	entities[key] = maps.Clone(labels)
+	if known {
+		return []map[string]string{previous}
+	}
+
+	var replaced []map[string]string
+	for seriesKey := range existing(name) {
+		if seriesKey == labelsKey {
+			continue
+		}
+		series, err := util.MapFromString(seriesKey)
+		if err != nil {
+			continue
+		}
+		same := true
+		for _, label := range identity {
+			if series[label] != labels[label] {
+				same = false
+				break
+			}
+		}
+		if same {
+			replaced = append(replaced, series)
+		}
+	}
+	return replaced
+}
+
+// deletes the series an info update replaces from all sinks
+func (h *MetricHub) retireInfo(name string, labels map[string]string) {
+	for _, previous := range h.info.track(name, labels, h.Series) {
+		h.DeleteSeries(name, previous)
+		logger.Info(fmt.Sprintf("Retired %s{%s}, replaced by {%s}", name, util.JoinMapEntries(previous), util.JoinMapEntries(labels)))
+	}
+}
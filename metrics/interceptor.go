@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Interceptor wraps the sink the hub passes updates on to, so relabeling, validation or rate
+// limiting compose as middleware instead of being built into each sink; the returned sink
+// forwards (possibly changed) updates to next, or drops them by not calling it.
+// Interceptors changing updates should implement SeriesChecker as well, so push APIs
+// check updates the way they reach the sinks, SeriesDeleter, so MetricHub.RetireSeries
+// deletes the series the sinks recorded, and ContextSink, see MetricHub.WithContext.
+// The chain is built once by Use, copies bound by WithContext share the state of the sink
+type Interceptor func(next MetricSink) MetricSink
+
+// creates an interceptor from the options of its config entry
+type InterceptorFactory func(options json.RawMessage) (Interceptor, error)
+
+var (
+	interceptorLock      sync.RWMutex
+	interceptorFactories = map[string]InterceptorFactory{
+		INTERCEPTOR_RELABEL:   newRelabelInterceptor,
+		INTERCEPTOR_VALIDATE:  newValidateInterceptor,
+		INTERCEPTOR_TRANSFORM: newTransformInterceptor,
+		INTERCEPTOR_MAP:       newMappingInterceptor,
+	}
+)
+
+// makes an interceptor available as "interceptors": [{"type": name}], used by plugins
+func RegisterInterceptor(name string, factory InterceptorFactory) {
+	interceptorLock.Lock()
+	defer interceptorLock.Unlock()
+	interceptorFactories[name] = factory
+}
+
+// creates a built-in or plugin-registered interceptor
+func NewInterceptor(name string, options json.RawMessage) (Interceptor, error) {
+	interceptorLock.RLock()
+	factory, ok := interceptorFactories[name]
+	interceptorLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown interceptor %q", name)
+	}
+	return factory(options)
+}
+
+// appends interceptors to the chain, the first one added sees updates first; updates,
+// CheckSeries and RetireSeries pass the chain after unit conversion, Series, DeleteSeries
+// and DeleteMetric bypass it.
+// Must be called before updates are dispatched
+func (h *MetricHub) Use(interceptors ...Interceptor) {
+	h.interceptors = append(h.interceptors, interceptors...)
+	h.chain = chain(h.interceptors, fanout{hub: h})
+}
+
+// the sink updates are dispatched to
+func (h *MetricHub) next() MetricSink {
+	if h.chain == nil {
+		return fanout{hub: h}
+	}
+	return h.chain
+}
+
+func chain(interceptors []Interceptor, sink MetricSink) MetricSink {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		sink = interceptors[i](sink)
+	}
+	return sink
+}
+
+// passes updates to all registered sinks, the end of the chain
+type fanout struct {
+	hub *MetricHub
+}
+
+// checks of the interceptor after the last one are passed on by checkNext
+func checkNext(ctx context.Context, next MetricSink, name, kind string, labels map[string]string) error {
+	if checker, ok := next.(SeriesChecker); ok {
+		return checker.CheckSeries(ctx, name, kind, labels)
+	}
+	return nil
+}
+
+// deletes of the interceptor after the last one are passed on by deleteNext,
+// false if it can't delete
+func deleteNext(next MetricSink, name string, labels map[string]string) bool {
+	if deleter, ok := next.(SeriesDeleter); ok {
+		return deleter.DeleteSeries(name, labels)
+	}
+	return false
+}
+
+func deleteMetricNext(next MetricSink, name string) bool {
+	if deleter, ok := next.(SeriesDeleter); ok {
+		return deleter.DeleteMetric(name)
+	}
+	return false
+}
+
+func (f fanout) DeleteSeries(name string, labels map[string]string) bool {
+	return f.hub.DeleteSeries(name, labels)
+}
+
+func (f fanout) DeleteMetric(name string) bool {
+	return f.hub.DeleteMetric(name)
+}
+
+// returns the first error of sinks able to check updates
+func (f fanout) CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error {
+	for _, sink := range f.hub.sinks {
+		if checker, ok := sink.(SeriesChecker); ok {
+			if err := checker.CheckSeries(ctx, name, kind, labels); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f fanout) IncCounter(name string, labels map[string]string) {
+	for _, sink := range f.hub.sinks {
+		sink.IncCounter(name, labels)
+	}
+}
+
+func (f fanout) AddCounter(name string, labels map[string]string, delta float64) {
+	for _, sink := range f.hub.sinks {
+		sink.AddCounter(name, labels, delta)
+	}
+}
+
+func (f fanout) SetGauge(name string, labels map[string]string, value float64) {
+	f.hub.retireInfo(name, labels)
+	for _, sink := range f.hub.sinks {
+		sink.SetGauge(name, labels, value)
+	}
+}
+
+func (f fanout) Observe(name string, labels map[string]string, value float64) {
+	for _, sink := range f.hub.sinks {
+		sink.Observe(name, labels, value)
+	}
+}
+
+func (f fanout) ObserveSummary(name string, labels map[string]string, value float64) {
+	for _, sink := range f.hub.sinks {
+		sink.ObserveSummary(name, labels, value)
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+)
+
+// counts the updates passing it, without ContextSink
+type countingSink struct {
+	next    MetricSink
+	updates int
+}
+
+func (sink *countingSink) IncCounter(name string, labels map[string]string) {
+	sink.updates++
+	sink.next.IncCounter(name, labels)
+}
+func (sink *countingSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.updates++
+	sink.next.AddCounter(name, labels, delta)
+}
+func (sink *countingSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.updates++
+	sink.next.SetGauge(name, labels, value)
+}
+func (sink *countingSink) Observe(name string, labels map[string]string, value float64) {
+	sink.updates++
+	sink.next.Observe(name, labels, value)
+}
+func (sink *countingSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.updates++
+	sink.next.ObserveSummary(name, labels, value)
+}
+
+func TestWithContextKeepsInterceptorState(t *testing.T) {
+	hub := NewMetricHub()
+	recorded := &lastGaugeSink{gauges: make(map[string]float64)}
+	hub.RegisterSink(recorded)
+	built := 0
+	var counting *countingSink
+	hub.Use(func(next MetricSink) MetricSink {
+		built++
+		counting = &countingSink{next: next}
+		return counting
+	})
+	relabel, err := NewInterceptor(INTERCEPTOR_RELABEL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.Use(relabel)
+	built = 0
+
+	for i := 0; i < 3; i++ {
+		hub.WithContext(context.Background()).SetGauge("vm_count", nil, float64(i))
+	}
+	if built != 0 {
+		t.Fatalf("chain built %d times per request", built)
+	}
+	if counting.updates != 3 {
+		t.Fatalf("interceptor counted %d updates, expected 3", counting.updates)
+	}
+	if recorded.gauges["vm_count"] != 2 {
+		t.Fatalf("sink got %v, expected 2", recorded.gauges["vm_count"])
+	}
+}
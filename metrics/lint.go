@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// a naming convention a metric breaks
+type LintViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// a metric breaking naming conventions, as first seen
+type LintFinding struct {
+	Name       string          `json:"name"`
+	Kind       string          `json:"kind"`
+	Violations []LintViolation `json:"violations"`
+	FirstSeen  time.Time       `json:"firstSeen"`
+}
+
+// Linter checks names of incoming metrics against Prometheus naming conventions: snake_case,
+// base units, "_total" only and always on counters, no reserved suffixes; registered as a sink
+// of the hub it sees names after unit conversion, each name and kind is checked once
+type Linter struct {
+	ignore []string
+
+	lock sync.Mutex
+	// kind|name -> finding, nil if the name is fine
+	checked map[string]*LintFinding
+}
+
+func NewLinter(ignore []string) *Linter {
+	return &Linter{ignore: ignore, checked: make(map[string]*LintFinding)}
+}
+
+// metrics breaking conventions, sorted by name
+func (linter *Linter) Findings() []LintFinding {
+	linter.lock.Lock()
+	defer linter.lock.Unlock()
+	findings := []LintFinding{}
+	for _, finding := range linter.checked {
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	slices.SortFunc(findings, func(a, b LintFinding) int {
+		return strings.Compare(a.Name+"|"+a.Kind, b.Name+"|"+b.Kind)
+	})
+	return findings
+}
+
+func (linter *Linter) check(kind, name string) {
+	key := kind + "|" + name
+	linter.lock.Lock()
+	defer linter.lock.Unlock()
+	if _, checked := linter.checked[key]; checked {
+		return
+	}
+	for _, pattern := range linter.ignore {
+		if matched, _ := path.Match(pattern, name); matched {
+			linter.checked[key] = nil
+			return
+		}
+	}
+	violations := lintName(kind, name)
+	if len(violations) == 0 {
+		linter.checked[key] = nil
+		return
+	}
+	linter.checked[key] = &LintFinding{Name: name, Kind: kind, Violations: violations, FirstSeen: time.Now()}
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		messages[i] = violation.Message
+	}
+	logger.Warn(fmt.Sprintf("Metric %s (%s) breaks naming conventions: %s", name, kind, strings.Join(messages, "; ")))
+}
+
+func lintName(kind, name string) []LintViolation {
+	var violations []LintViolation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, LintViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.ToLower(name) != name {
+		add(LINT_SNAKE_CASE, "use snake_case instead of camelCase")
+	}
+	if strings.Contains(name, ":") {
+		add(LINT_COLON, "colons are reserved for recording rules")
+	}
+	if strings.Contains(name, "__") || strings.HasPrefix(name, "_") || strings.HasSuffix(name, "_") {
+		add(LINT_UNDERSCORES, "avoid leading, trailing and repeated underscores")
+	}
+
+	total := strings.HasSuffix(name, "_total")
+	if kind == "counter" && !total {
+		add(LINT_COUNTER_TOTAL, "counters should end in _total")
+	}
+	if kind != "counter" && total {
+		add(LINT_COUNTER_TOTAL, "only counters should end in _total")
+	}
+	if kind == "histogram" || kind == "summary" {
+		for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+			if strings.HasSuffix(name, suffix) {
+				add(LINT_RESERVED_SUFFIX, "%s is reserved for the series of %ss", suffix, kind)
+			}
+		}
+	}
+
+	base := strings.ToLower(strings.TrimSuffix(name, "_total"))
+	for unit, suffixes := range sourceSuffixes {
+		for _, suffix := range suffixes {
+			// usually a minimum, like vSphere's cpu.usage.minimum
+			if suffix == "_min" {
+				continue
+			}
+			if strings.HasSuffix(base, suffix) {
+				add(LINT_BASE_UNIT, "%s is not a base unit, convert %s to %s (see units)", suffix, unit, canonicalUnit(unit))
+			}
+		}
+	}
+	return violations
+}
+
+// the base unit values in a source unit are converted to
+func canonicalUnit(source string) string {
+	for unit, factors := range unitFactors {
+		if _, ok := factors[source]; ok {
+			return unit
+		}
+	}
+	return ""
+}
+
+func (linter *Linter) IncCounter(name string, labels map[string]string) {
+	linter.check("counter", name)
+}
+
+func (linter *Linter) AddCounter(name string, labels map[string]string, delta float64) {
+	linter.check("counter", name)
+}
+
+func (linter *Linter) SetGauge(name string, labels map[string]string, value float64) {
+	linter.check("gauge", name)
+}
+
+func (linter *Linter) Observe(name string, labels map[string]string, value float64) {
+	linter.check("histogram", name)
+}
+
+func (linter *Linter) ObserveSummary(name string, labels map[string]string, value float64) {
+	linter.check("summary", name)
+}
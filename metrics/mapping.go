@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// a mapping table of label values; keys are exact values or globs, e.g. "5*", exact keys
+// win and globs are tried in sorted order
+type mappingTable struct {
+	exact map[string]string
+	globs []string
+	// glob -> value
+	globValues map[string]string
+}
+
+func newMappingTable(entries map[string]string) (*mappingTable, error) {
+	table := &mappingTable{exact: make(map[string]string), globValues: make(map[string]string)}
+	for key, value := range entries {
+		if !strings.ContainsAny(key, "*?[") {
+			table.exact[key] = value
+			continue
+		}
+		if _, err := path.Match(key, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", key, err)
+		}
+		table.globs = append(table.globs, key)
+		table.globValues[key] = value
+	}
+	sort.Strings(table.globs)
+	return table, nil
+}
+
+func (table *mappingTable) lookup(value string) (string, bool) {
+	if mapped, ok := table.exact[value]; ok {
+		return mapped, true
+	}
+	for _, glob := range table.globs {
+		if matched, _ := path.Match(glob, value); matched {
+			return table.globValues[glob], true
+		}
+	}
+	return "", false
+}
+
+// one rule of the map interceptor: the value of Label is looked up in Table and replaces it,
+// or is set as Target keeping Label; values missing from the table get Default, or stay as
+// they are (no Target label) without one. Rules with a Target need a Default, unless the
+// table covers all values: series of a metric without the Target label conflict with the others
+type mappingRule struct {
+	// metric name glob, empty matches all metrics
+	Match   string `json:"match,omitempty"`
+	Label   string `json:"label"`
+	Table   string `json:"table"`
+	Target  string `json:"target,omitempty"`
+	Default string `json:"default,omitempty"`
+
+	table *mappingTable
+}
+
+// options: {"tables": {"regions": {"fra1": "eu-central", "iad2": "us-east"}, "errors": {"401": "auth", "5*": "server"}},
+// "rules": [{"label": "datacenter", "table": "regions", "target": "region", "default": "unknown"},
+// {"match": "api_errors_total", "label": "code", "table": "errors", "target": "category", "default": "other"}]}; all matching rules apply in order
+func newMappingInterceptor(options json.RawMessage) (Interceptor, error) {
+	var parsed struct {
+		Tables map[string]map[string]string `json:"tables"`
+		Rules  []mappingRule                `json:"rules"`
+	}
+	if len(options) > 0 {
+		if err := json.Unmarshal(options, &parsed); err != nil {
+			return nil, err
+		}
+	}
+	tables := make(map[string]*mappingTable, len(parsed.Tables))
+	for name, entries := range parsed.Tables {
+		table, err := newMappingTable(entries)
+		if err != nil {
+			return nil, fmt.Errorf("tables.%s: %w", name, err)
+		}
+		tables[name] = table
+	}
+	for i := range parsed.Rules {
+		rule := &parsed.Rules[i]
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return nil, fmt.Errorf("rules[%d]: invalid pattern %q: %w", i, rule.Match, err)
+		}
+		if rule.Label == "" {
+			return nil, fmt.Errorf("rules[%d]: missing label", i)
+		}
+		if rule.table = tables[rule.Table]; rule.table == nil {
+			return nil, fmt.Errorf("rules[%d]: unknown table %q", i, rule.Table)
+		}
+	}
+	rules := &mappingRules{rules: parsed.Rules}
+	return func(next MetricSink) MetricSink {
+		return &mappingSink{rules: rules, next: next}
+	}, nil
+}
+
+type mappingRules struct {
+	rules []mappingRule
+	// metric name -> matching rules
+	matching sync.Map
+}
+
+func (rules *mappingRules) forName(name string) []mappingRule {
+	if cached, ok := rules.matching.Load(name); ok {
+		return cached.([]mappingRule)
+	}
+	var matching []mappingRule
+	for _, rule := range rules.rules {
+		if matched, _ := path.Match(rule.Match, name); rule.Match == "" || matched {
+			matching = append(matching, rule)
+		}
+	}
+	rules.matching.Store(name, matching)
+	return matching
+}
+
+// mapped copy of labels, the caller's map is left as is
+func (rules *mappingRules) apply(name string, labels map[string]string) map[string]string {
+	var mapped map[string]string
+	for _, rule := range rules.forName(name) {
+		current := labels
+		if mapped != nil {
+			current = mapped
+		}
+		value, ok := current[rule.Label]
+		if !ok {
+			continue
+		}
+		result, found := rule.table.lookup(value)
+		if !found {
+			if rule.Default == "" {
+				continue
+			}
+			result = rule.Default
+		}
+		if mapped == nil {
+			mapped = make(map[string]string, len(labels)+1)
+			for label, value := range labels {
+				mapped[label] = value
+			}
+		}
+		target := rule.Target
+		if target == "" {
+			target = rule.Label
+		}
+		mapped[target] = result
+	}
+	if mapped == nil {
+		return labels
+	}
+	return mapped
+}
+
+type mappingSink struct {
+	rules *mappingRules
+	next  MetricSink
+}
+
+func (sink *mappingSink) CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error {
+	return checkNext(ctx, sink.next, name, kind, sink.rules.apply(name, labels))
+}
+
+func (sink *mappingSink) WithContext(ctx context.Context) MetricSink {
+	return &mappingSink{rules: sink.rules, next: bindContext(ctx, sink.next)}
+}
+
+func (sink *mappingSink) DeleteSeries(name string, labels map[string]string) bool {
+	return deleteNext(sink.next, name, sink.rules.apply(name, labels))
+}
+
+func (sink *mappingSink) DeleteMetric(name string) bool {
+	return deleteMetricNext(sink.next, name)
+}
+
+func (sink *mappingSink) IncCounter(name string, labels map[string]string) {
+	sink.next.IncCounter(name, sink.rules.apply(name, labels))
+}
+
+func (sink *mappingSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.next.AddCounter(name, sink.rules.apply(name, labels), delta)
+}
+
+func (sink *mappingSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.next.SetGauge(name, sink.rules.apply(name, labels), value)
+}
+
+func (sink *mappingSink) Observe(name string, labels map[string]string, value float64) {
+	sink.next.Observe(name, sink.rules.apply(name, labels), value)
+}
+
+func (sink *mappingSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.next.ObserveSummary(name, sink.rules.apply(name, labels), value)
+}
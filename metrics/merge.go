@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"math"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// latest value of a merged gauge pushed by one source
+type sourceSample struct {
+	value float64
+	at    time.Time
+}
+
+// sources of one merged series
+type mergedSeries struct {
+	sources  map[string]sourceSample
+	interval time.Duration
+	// merges are numbered under the merger's lock and set in that order under the series' lock,
+	// a merge computed earlier but set later is dropped
+	next    uint64
+	lock    sync.Mutex
+	applied uint64
+}
+
+// GaugeMerger combines gauges several sources push for the same series, e.g. HA agents
+// reporting the same datastore, which otherwise flap between the values of each agent;
+// sources not pushing within the rule's interval drop out of the merged value, series
+// without any such source are dropped every DEFAULT_MERGE_INTERVAL_SEC
+type GaugeMerger struct {
+	lock  sync.Mutex
+	rules []config.GaugeMergeRule
+	// "name{labels}" -> sources
+	series    map[string]*mergedSeries
+	lastSweep time.Time
+}
+
+// rules are validated by config validation, unknown policies keep the last value
+func NewGaugeMerger(rules []config.GaugeMergeRule) *GaugeMerger {
+	return &GaugeMerger{
+		rules:     rules,
+		series:    make(map[string]*mergedSeries),
+		lastSweep: time.Now(),
+	}
+}
+
+// first rule matching the metric with a policy other than last-write-wins
+func (merger *GaugeMerger) rule(name string) *config.GaugeMergeRule {
+	if merger == nil {
+		return nil
+	}
+	for i, rule := range merger.rules {
+		if matched, _ := path.Match(rule.Match, name); matched {
+			if rule.Policy == config.MERGE_LAST || rule.Policy == "" {
+				return nil
+			}
+			return &merger.rules[i]
+		}
+	}
+	return nil
+}
+
+// records the value pushed by source and sets the gauge to the merged value of all sources,
+// gauges without merge rule are set as pushed; nil merges nothing
+func (merger *GaugeMerger) Apply(sink MetricSink, source, name string, labels map[string]string, value float64) {
+	rule := merger.rule(name)
+	if rule == nil {
+		sink.SetGauge(name, labels, value)
+		return
+	}
+	interval := rule.Interval.Duration
+	if interval <= 0 {
+		interval = DEFAULT_MERGE_INTERVAL_SEC * time.Second
+	}
+	key := name + "{" + util.JoinMapEntries(labels) + "}"
+	now := time.Now()
+
+	merger.lock.Lock()
+	merger.sweep(now)
+	series, ok := merger.series[key]
+	if !ok {
+		series = &mergedSeries{sources: make(map[string]sourceSample)}
+		merger.series[key] = series
+	}
+	series.interval = interval
+	series.sources[source] = sourceSample{value: value, at: now}
+
+	merged := value
+	for other, sample := range series.sources {
+		if now.Sub(sample.at) > interval {
+			delete(series.sources, other)
+			continue
+		}
+		if other == source {
+			continue
+		}
+		switch rule.Policy {
+		case config.MERGE_MAX:
+			merged = math.Max(merged, sample.value)
+		case config.MERGE_MIN:
+			merged = math.Min(merged, sample.value)
+		case config.MERGE_SUM:
+			merged += sample.value
+		}
+	}
+	series.next++
+	seq := series.next
+	merger.lock.Unlock()
+
+	// set outside the merger's lock, pushes of other series don't wait for the sink
+	series.lock.Lock()
+	defer series.lock.Unlock()
+	if seq > series.applied {
+		sink.SetGauge(name, labels, merged)
+		series.applied = seq
+	}
+}
+
+// drops series whose sources all stopped pushing, caller must hold the lock
+func (merger *GaugeMerger) sweep(now time.Time) {
+	if now.Sub(merger.lastSweep) < DEFAULT_MERGE_INTERVAL_SEC*time.Second {
+		return
+	}
+	merger.lastSweep = now
+	for key, series := range merger.series {
+		latest := time.Time{}
+		for _, sample := range series.sources {
+			if sample.at.After(latest) {
+				latest = sample.at
+			}
+		}
+		if now.Sub(latest) > series.interval {
+			delete(merger.series, key)
+		}
+	}
+}
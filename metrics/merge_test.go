@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// latest gauge values by name
+type lastGaugeSink struct {
+	counterSink
+	gauges map[string]float64
+}
+
+func (sink *lastGaugeSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.gauges[name] = value
+}
+
+func TestGaugeMergerDropsSeriesOfSilentSources(t *testing.T) {
+	merger := NewGaugeMerger([]config.GaugeMergeRule{{Match: "datastore_*", Policy: config.MERGE_MAX}})
+	sink := &lastGaugeSink{gauges: map[string]float64{}}
+	merger.Apply(sink, "agent-a", "datastore_used", map[string]string{"ds": "old"}, 5)
+	merger.Apply(sink, "agent-b", "datastore_used", map[string]string{"ds": "old"}, 3)
+	if sink.gauges["datastore_used"] != 5 {
+		t.Fatalf("merged %v, expected the max 5", sink.gauges["datastore_used"])
+	}
+
+	// both sources of "old" stopped pushing long ago
+	for _, sample := range []string{"agent-a", "agent-b"} {
+		merger.series["datastore_used{ds=old}"].sources[sample] = sourceSample{value: 5, at: time.Now().Add(-time.Hour)}
+	}
+	merger.lastSweep = time.Now().Add(-time.Hour)
+	merger.Apply(sink, "agent-a", "datastore_used", map[string]string{"ds": "new"}, 1)
+	if _, ok := merger.series["datastore_used{ds=old}"]; ok {
+		t.Fatal("series without recent sources was kept")
+	}
+	if len(merger.series) != 1 {
+		t.Fatalf("%d series kept, expected 1", len(merger.series))
+	}
+}
@@ -1,35 +1,195 @@
 package metrics
 
+import (
+	"context"
+	"time"
+)
+
 // MetricSink: pluggable sink interface
 type MetricSink interface {
 	IncCounter(name string, labels map[string]string)
+	AddCounter(name string, labels map[string]string, delta float64)
 	SetGauge(name string, labels map[string]string, value float64)
+	Observe(name string, labels map[string]string, value float64)
+	ObserveSummary(name string, labels map[string]string, value float64)
+}
+
+// invokes each sink to record a histogram observation
+func (h *MetricHub) Observe(name string, labels map[string]string, value float64) {
+	name, value = h.units.Apply("histogram", name, value)
+	h.next().Observe(name, labels, value)
+}
+
+// invokes each sink to record a summary observation
+func (h *MetricHub) ObserveSummary(name string, labels map[string]string, value float64) {
+	name, value = h.units.Apply("summary", name, value)
+	h.next().ObserveSummary(name, labels, value)
+}
+
+// SeriesDeleter: optionally implemented by sinks that can drop series,
+// used by the admin API and series expiry
+type SeriesDeleter interface {
+	// removes a single series, returns false if it doesn't exist
+	DeleteSeries(name string, labels map[string]string) bool
+	// removes all series of a metric, returns false if it doesn't exist
+	DeleteMetric(name string) bool
+}
+
+// SeriesReader: optionally implemented by sinks that can report current values,
+// used to record the state of series before admin changes
+type SeriesReader interface {
+	// labelKey -> value of all series of a metric, sample count for histograms and summaries
+	Series(name string) map[string]float64
+}
+
+// ContextSink: optionally implemented by sinks that log errors with the request ID
+// of the push or poll causing an update, see logger.RequestID
+type ContextSink interface {
+	WithContext(ctx context.Context) MetricSink
+}
+
+// SeriesChecker: optionally implemented by sinks that reject some updates,
+// so push APIs can report the reason instead of silently dropping them
+type SeriesChecker interface {
+	// error if an update of kind ("counter", "gauge", ...) with these labels would be rejected
+	CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error
+}
+
+// one metric update, as queued for SampleWriter sinks
+type Sample struct {
+	// "counter" (Value is the increase), "gauge", "histogram" or "summary" (Value is an observation)
+	Kind   string            `json:"kind"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+	Time   time.Time         `json:"time"`
+}
+
+// SampleWriter: optionally implemented by sinks delivering to remote systems (remote write,
+// Kafka, InfluxDB), so updates can be queued on disk while the remote is unreachable
+type SampleWriter interface {
+	// delivers samples in order, an error means the whole batch is sent again later
+	// unless it is a PermanentError
+	WriteSamples(ctx context.Context, samples []Sample) error
+}
+
+// PermanentError: returned by SampleWriter when the remote rejected a batch that would be
+// rejected again, e.g. a 400 for malformed samples; the batch is dropped instead of retried
+type PermanentError struct {
+	Err error
+}
+
+func (err *PermanentError) Error() string {
+	return "permanent: " + err.Err.Error()
+}
+
+func (err *PermanentError) Unwrap() error {
+	return err.Err
 }
 
 // MetricHub: dispatches metric updates to registered sinks
 type MetricHub struct {
 	sinks []MetricSink
+	// optional unit suffixes and conversion applied to all updates
+	units *UnitConverter
+	// optional, retires replaced series of info metrics
+	info *InfoTracker
+	// optional middleware in front of the sinks, see Use
+	interceptors []Interceptor
+	chain        MetricSink
 }
 
 func NewMetricHub() *MetricHub {
 	return &MetricHub{sinks: []MetricSink{}}
 }
 
+// applies units to all updates dispatched from now on
+func (h *MetricHub) SetUnits(units *UnitConverter) {
+	h.units = units
+}
+
+// tracks info metrics dispatched from now on
+func (h *MetricHub) SetInfoTracker(info *InfoTracker) {
+	h.info = info
+}
+
 // adds a new sink to the hub
 func (h *MetricHub) RegisterSink(sink MetricSink) {
 	h.sinks = append(h.sinks, sink)
 }
 
-// invokes each sink to increment counter metric
+// invokes each sink to increment counter metric, by the converted increment if units apply
 func (h *MetricHub) IncCounter(name string, labels map[string]string) {
-	for _, sink := range h.sinks {
-		sink.IncCounter(name, labels)
-	}
+	name, delta := h.units.Apply("counter", name, 1)
+	h.next().AddCounter(name, labels, delta)
+}
+
+// invokes each sink to increase counter metric by delta
+func (h *MetricHub) AddCounter(name string, labels map[string]string, delta float64) {
+	name, delta = h.units.Apply("counter", name, delta)
+	h.next().AddCounter(name, labels, delta)
 }
 
 // invokes each sink to set gauge metric
 func (h *MetricHub) SetGauge(name string, labels map[string]string, value float64) {
+	name, value = h.units.Apply("gauge", name, value)
+	h.next().SetGauge(name, labels, value)
+}
+
+// returns current values of a metric from the first sink able to report them, nil if none has it
+func (h *MetricHub) Series(name string) map[string]float64 {
+	for _, sink := range h.sinks {
+		if reader, ok := sink.(SeriesReader); ok {
+			if series := reader.Series(name); series != nil {
+				return series
+			}
+		}
+	}
+	return nil
+}
+
+// returns the first error of sinks able to check updates, nil if all would accept it
+func (h *MetricHub) CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error {
+	name, _ = h.units.Apply(kind, name, 0)
+	checker, ok := h.next().(SeriesChecker)
+	if !ok {
+		// an interceptor unable to check, the sinks see the update as pushed then
+		checker = fanout{hub: h}
+	}
+	return checker.CheckSeries(ctx, name, kind, labels)
+}
+
+// deletes the series updates of kind with name and labels were recorded in, e.g. by a retired
+// poller: the delete passes units and interceptors like the updates did, while DeleteSeries takes
+// the name and labels the sinks see; returns true if any sink had it
+func (h *MetricHub) RetireSeries(kind, name string, labels map[string]string) bool {
+	name, _ = h.units.Apply(kind, name, 0)
+	deleter, ok := h.next().(SeriesDeleter)
+	if !ok {
+		// an interceptor unable to delete, the sinks see the delete as given then
+		deleter = fanout{hub: h}
+	}
+	return deleter.DeleteSeries(name, labels)
+}
+
+// deletes a series from all sinks supporting deletion, returns true if any sink had it
+func (h *MetricHub) DeleteSeries(name string, labels map[string]string) bool {
+	deleted := false
+	for _, sink := range h.sinks {
+		if deleter, ok := sink.(SeriesDeleter); ok && deleter.DeleteSeries(name, labels) {
+			deleted = true
+		}
+	}
+	return deleted
+}
+
+// deletes all series of a metric from all sinks supporting deletion
+func (h *MetricHub) DeleteMetric(name string) bool {
+	deleted := false
 	for _, sink := range h.sinks {
-		sink.SetGauge(name, labels, value)
+		if deleter, ok := sink.(SeriesDeleter); ok && deleter.DeleteMetric(name) {
+			deleted = true
+		}
 	}
+	return deleted
 }
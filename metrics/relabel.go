@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+)
+
+// one rule of the relabel interceptor, applied as rename, drop, set
+type relabelRule struct {
+	// metric name glob, empty matches all metrics
+	Match string `json:"match,omitempty"`
+	// old -> new label name
+	Rename map[string]string `json:"rename,omitempty"`
+	Drop   []string          `json:"drop,omitempty"`
+	// labels set, overriding pushed values
+	Set map[string]string `json:"set,omitempty"`
+}
+
+// options: {"rules": [{"match": "vsphere_*", "rename": {"vm": "vm_name"}, "drop": ["pod"], "set": {"env": "prod"}}]}
+func newRelabelInterceptor(options json.RawMessage) (Interceptor, error) {
+	var parsed struct {
+		Rules []relabelRule `json:"rules"`
+	}
+	if len(options) > 0 {
+		if err := json.Unmarshal(options, &parsed); err != nil {
+			return nil, err
+		}
+	}
+	for i, rule := range parsed.Rules {
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return nil, fmt.Errorf("rules[%d]: invalid pattern %q: %w", i, rule.Match, err)
+		}
+	}
+	rules := &relabelRules{rules: parsed.Rules}
+	return func(next MetricSink) MetricSink {
+		return &relabelSink{rules: rules, next: next}
+	}, nil
+}
+
+type relabelRules struct {
+	rules []relabelRule
+	// metric name -> matching rules
+	matching sync.Map
+}
+
+func (rules *relabelRules) forName(name string) []relabelRule {
+	if cached, ok := rules.matching.Load(name); ok {
+		return cached.([]relabelRule)
+	}
+	var matching []relabelRule
+	for _, rule := range rules.rules {
+		if matched, _ := path.Match(rule.Match, name); rule.Match == "" || matched {
+			matching = append(matching, rule)
+		}
+	}
+	rules.matching.Store(name, matching)
+	return matching
+}
+
+// relabeled copy of labels, the caller's map is left as is
+func (rules *relabelRules) apply(name string, labels map[string]string) map[string]string {
+	matching := rules.forName(name)
+	if len(matching) == 0 {
+		return labels
+	}
+	relabeled := make(map[string]string, len(labels))
+	for label, value := range labels {
+		relabeled[label] = value
+	}
+	for _, rule := range matching {
+		for from, to := range rule.Rename {
+			if value, ok := relabeled[from]; ok {
+				delete(relabeled, from)
+				relabeled[to] = value
+			}
+		}
+		for _, label := range rule.Drop {
+			delete(relabeled, label)
+		}
+		for label, value := range rule.Set {
+			relabeled[label] = value
+		}
+	}
+	return relabeled
+}
+
+type relabelSink struct {
+	rules *relabelRules
+	next  MetricSink
+}
+
+func (sink *relabelSink) CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error {
+	return checkNext(ctx, sink.next, name, kind, sink.rules.apply(name, labels))
+}
+
+func (sink *relabelSink) WithContext(ctx context.Context) MetricSink {
+	return &relabelSink{rules: sink.rules, next: bindContext(ctx, sink.next)}
+}
+
+func (sink *relabelSink) DeleteSeries(name string, labels map[string]string) bool {
+	return deleteNext(sink.next, name, sink.rules.apply(name, labels))
+}
+
+func (sink *relabelSink) DeleteMetric(name string) bool {
+	return deleteMetricNext(sink.next, name)
+}
+
+func (sink *relabelSink) IncCounter(name string, labels map[string]string) {
+	sink.next.IncCounter(name, sink.rules.apply(name, labels))
+}
+
+func (sink *relabelSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.next.AddCounter(name, sink.rules.apply(name, labels), delta)
+}
+
+func (sink *relabelSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.next.SetGauge(name, sink.rules.apply(name, labels), value)
+}
+
+func (sink *relabelSink) Observe(name string, labels map[string]string, value float64) {
+	sink.next.Observe(name, sink.rules.apply(name, labels), value)
+}
+
+func (sink *relabelSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.next.ObserveSummary(name, sink.rules.apply(name, labels), value)
+}
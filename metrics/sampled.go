@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SampledCounter counts events of a receive loop in atomics, one per value of a label, and
+// adds them to a counter every publish, keeping the sink out of the hot path of listeners
+type SampledCounter struct {
+	metric string
+	sink   MetricSink
+	counts map[string]*atomic.Int64
+	labels map[string]map[string]string
+}
+
+// a counter of metric labelled label="<value>" for each of values; an empty label counts
+// a single unlabelled series, with "" as its value
+func NewSampledCounter(sink MetricSink, metric, label string, values ...string) *SampledCounter {
+	if label == "" {
+		values = []string{""}
+	}
+	counter := &SampledCounter{
+		metric: metric,
+		sink:   sink,
+		counts: make(map[string]*atomic.Int64, len(values)),
+		labels: make(map[string]map[string]string, len(values)),
+	}
+	for _, value := range values {
+		counter.counts[value] = new(atomic.Int64)
+		counter.labels[value] = map[string]string{}
+		if label != "" {
+			counter.labels[value][label] = value
+		}
+	}
+	return counter
+}
+
+// counts one event of value, values not given to NewSampledCounter are ignored
+func (counter *SampledCounter) Inc(value string) {
+	if count, ok := counter.counts[value]; ok {
+		count.Add(1)
+	}
+}
+
+// adds the events counted since the last publish
+func (counter *SampledCounter) Publish() {
+	for value, count := range counter.counts {
+		if n := count.Swap(0); n > 0 {
+			counter.sink.AddCounter(counter.metric, counter.labels[value], float64(n))
+		}
+	}
+}
+
+// calls publish every interval in the background, for the sampled metrics of a listener
+func PublishEvery(interval time.Duration, publish func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			publish()
+		}
+	}()
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import "testing"
+
+func TestSampledCounterAddsCountsOnce(t *testing.T) {
+	sink := &counterSink{counters: map[string]float64{}}
+	counter := NewSampledCounter(sink, "dropped_total", "reason", "oversized", "malformed")
+	counter.Inc("oversized")
+	counter.Inc("malformed")
+	counter.Inc("malformed")
+	counter.Inc("unknown")
+	counter.Publish()
+	counter.Publish()
+	if sink.counters["dropped_total"] != 3 {
+		t.Fatalf("dropped_total %v, expected 3", sink.counters["dropped_total"])
+	}
+
+	unlabelled := NewSampledCounter(sink, "received_total", "")
+	unlabelled.Inc("")
+	unlabelled.Publish()
+	if sink.counters["received_total"] != 1 {
+		t.Fatalf("received_total %v, expected 1", sink.counters["received_total"])
+	}
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedHub dispatches like MetricHub but records a span for the dispatch
+// and each sink write, as children of the span carried by ctx
+type tracedHub struct {
+	hub *MetricHub
+	// the hub's interceptors bound to the context in front of the traced dispatch, or end
+	next MetricSink
+	end  tracedFanout
+}
+
+// returns a MetricSink bound to ctx, used by handlers and pollers so metric updates
+// show up in the trace of the push or poll that caused them; the context is passed through
+// the hub's interceptors, see bindContext
+func (h *MetricHub) WithContext(ctx context.Context) MetricSink {
+	traced := &tracedHub{hub: h, end: tracedFanout{hub: h, ctx: ctx}}
+	// without interceptors nothing is allocated beyond the hub
+	traced.next = &traced.end
+	if h.chain != nil {
+		traced.next = bindContext(ctx, h.chain)
+	}
+	return traced
+}
+
+// binds the rest of a chain to ctx, interceptors forward it by implementing ContextSink
+// with a copy sharing their state; the chain after others is not traced
+func bindContext(ctx context.Context, next MetricSink) MetricSink {
+	if contextSink, ok := next.(ContextSink); ok {
+		return contextSink.WithContext(ctx)
+	}
+	return next
+}
+
+// the end of the chain bound to ctx
+func (f fanout) WithContext(ctx context.Context) MetricSink {
+	return &tracedFanout{hub: f.hub, ctx: ctx}
+}
+
+// dispatches with spans, the end of the chain of a traced hub
+type tracedFanout struct {
+	hub *MetricHub
+	ctx context.Context
+}
+
+func (f tracedFanout) dispatch(op string, name string, call func(sink MetricSink)) {
+	// untraced or unsampled requests skip span creation, it dominates the cost of a push
+	if !trace.SpanFromContext(f.ctx).IsRecording() {
+		for _, sink := range f.hub.sinks {
+			call(f.bind(f.ctx, sink))
+		}
+		return
+	}
+
+	ctx, span := tracing.Start(f.ctx, "hub."+op, attribute.String("metric", name))
+	defer span.End()
+
+	for _, sink := range f.hub.sinks {
+		sinkCtx, sinkSpan := tracing.Start(ctx, "sink."+op, attribute.String("sink", fmt.Sprintf("%T", sink)))
+		call(f.bind(sinkCtx, sink))
+		sinkSpan.End()
+	}
+}
+
+// binds sinks able to log with request IDs to ctx, if it carries one
+func (f tracedFanout) bind(ctx context.Context, sink MetricSink) MetricSink {
+	if logger.RequestID(ctx) == "" {
+		return sink
+	}
+	if contextSink, ok := sink.(ContextSink); ok {
+		return contextSink.WithContext(ctx)
+	}
+	return sink
+}
+
+// unit conversion happens before dispatch, so spans carry the canonical name
+func (traced *tracedHub) IncCounter(name string, labels map[string]string) {
+	name, delta := traced.hub.units.Apply("counter", name, 1)
+	traced.next.AddCounter(name, labels, delta)
+}
+
+func (traced *tracedHub) AddCounter(name string, labels map[string]string, delta float64) {
+	name, delta = traced.hub.units.Apply("counter", name, delta)
+	traced.next.AddCounter(name, labels, delta)
+}
+
+func (traced *tracedHub) SetGauge(name string, labels map[string]string, value float64) {
+	name, value = traced.hub.units.Apply("gauge", name, value)
+	traced.next.SetGauge(name, labels, value)
+}
+
+func (traced *tracedHub) Observe(name string, labels map[string]string, value float64) {
+	name, value = traced.hub.units.Apply("histogram", name, value)
+	traced.next.Observe(name, labels, value)
+}
+
+func (traced *tracedHub) ObserveSummary(name string, labels map[string]string, value float64) {
+	name, value = traced.hub.units.Apply("summary", name, value)
+	traced.next.ObserveSummary(name, labels, value)
+}
+
+func (f tracedFanout) IncCounter(name string, labels map[string]string) {
+	f.dispatch("IncCounter", name, func(sink MetricSink) { sink.IncCounter(name, labels) })
+}
+
+func (f tracedFanout) AddCounter(name string, labels map[string]string, delta float64) {
+	f.dispatch("AddCounter", name, func(sink MetricSink) { sink.AddCounter(name, labels, delta) })
+}
+
+func (f tracedFanout) SetGauge(name string, labels map[string]string, value float64) {
+	f.hub.retireInfo(name, labels)
+	f.dispatch("SetGauge", name, func(sink MetricSink) { sink.SetGauge(name, labels, value) })
+}
+
+func (f tracedFanout) Observe(name string, labels map[string]string, value float64) {
+	f.dispatch("Observe", name, func(sink MetricSink) { sink.Observe(name, labels, value) })
+}
+
+func (f tracedFanout) ObserveSummary(name string, labels map[string]string, value float64) {
+	f.dispatch("ObserveSummary", name, func(sink MetricSink) { sink.ObserveSummary(name, labels, value) })
+}
@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"sync"
+)
+
+// one rule of the transform interceptor; values are scaled and converted, then made absolute,
+// then clamped; counter increases are only scaled and converted
+type transformRule struct {
+	// glob of metric names after unit conversion, empty matches all metrics
+	Match string   `json:"match,omitempty"`
+	Scale *float64 `json:"scale,omitempty"`
+	// unit conversion of the value without renaming the metric, e.g. "KB" to "bytes";
+	// one side must be "bytes", "seconds" or "ratio", see the units config for renaming too
+	From string   `json:"from,omitempty"`
+	To   string   `json:"to,omitempty"`
+	Abs  bool     `json:"abs,omitempty"`
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+
+	// Scale times the unit conversion factor
+	factor float64
+}
+
+// options: {"rules": [{"match": "datastore_free_kb", "from": "KB", "to": "bytes"},
+// {"match": "host_cpu_usage", "scale": 0.01, "min": 0, "max": 1}]}; all matching rules apply in order
+func newTransformInterceptor(options json.RawMessage) (Interceptor, error) {
+	var parsed struct {
+		Rules []transformRule `json:"rules"`
+	}
+	if len(options) > 0 {
+		if err := json.Unmarshal(options, &parsed); err != nil {
+			return nil, err
+		}
+	}
+	for i := range parsed.Rules {
+		rule := &parsed.Rules[i]
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return nil, fmt.Errorf("rules[%d]: invalid pattern %q: %w", i, rule.Match, err)
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return nil, fmt.Errorf("rules[%d]: min %v is above max %v", i, *rule.Min, *rule.Max)
+		}
+		rule.factor = 1
+		if rule.Scale != nil {
+			rule.factor = *rule.Scale
+		}
+		if rule.From != "" || rule.To != "" {
+			factor, err := conversionFactor(rule.From, rule.To)
+			if err != nil {
+				return nil, fmt.Errorf("rules[%d]: %w", i, err)
+			}
+			rule.factor *= factor
+		}
+	}
+	rules := &transformRules{rules: parsed.Rules}
+	return func(next MetricSink) MetricSink {
+		return &transformSink{rules: rules, next: next}
+	}, nil
+}
+
+// factor converting values in unit from to unit to, either may be the canonical unit
+func conversionFactor(from, to string) (float64, error) {
+	if factors, ok := unitFactors[to]; ok {
+		if factor, ok := factors[from]; ok {
+			return factor, nil
+		}
+	}
+	if factors, ok := unitFactors[from]; ok {
+		if factor, ok := factors[to]; ok {
+			return 1 / factor, nil
+		}
+	}
+	return 0, fmt.Errorf("can't convert %q to %q", from, to)
+}
+
+type transformRules struct {
+	rules []transformRule
+	// metric name -> matching rules
+	matching sync.Map
+}
+
+func (rules *transformRules) forName(name string) []transformRule {
+	if cached, ok := rules.matching.Load(name); ok {
+		return cached.([]transformRule)
+	}
+	var matching []transformRule
+	for _, rule := range rules.rules {
+		if matched, _ := path.Match(rule.Match, name); rule.Match == "" || matched {
+			matching = append(matching, rule)
+		}
+	}
+	rules.matching.Store(name, matching)
+	return matching
+}
+
+// transformed value of a gauge or an observation
+func (rules *transformRules) apply(name string, value float64) float64 {
+	for _, rule := range rules.forName(name) {
+		value *= rule.factor
+		if rule.Abs {
+			value = math.Abs(value)
+		}
+		if rule.Min != nil && value < *rule.Min {
+			value = *rule.Min
+		}
+		if rule.Max != nil && value > *rule.Max {
+			value = *rule.Max
+		}
+	}
+	return value
+}
+
+// scaled increase of a counter, 1 for IncCounter
+func (rules *transformRules) scale(name string, delta float64) float64 {
+	for _, rule := range rules.forName(name) {
+		delta *= rule.factor
+	}
+	return delta
+}
+
+type transformSink struct {
+	rules *transformRules
+	next  MetricSink
+}
+
+func (sink *transformSink) CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error {
+	return checkNext(ctx, sink.next, name, kind, labels)
+}
+
+func (sink *transformSink) WithContext(ctx context.Context) MetricSink {
+	return &transformSink{rules: sink.rules, next: bindContext(ctx, sink.next)}
+}
+
+func (sink *transformSink) DeleteSeries(name string, labels map[string]string) bool {
+	return deleteNext(sink.next, name, labels)
+}
+
+func (sink *transformSink) DeleteMetric(name string) bool {
+	return deleteMetricNext(sink.next, name)
+}
+
+func (sink *transformSink) IncCounter(name string, labels map[string]string) {
+	if delta := sink.rules.scale(name, 1); delta != 1 {
+		sink.next.AddCounter(name, labels, delta)
+		return
+	}
+	sink.next.IncCounter(name, labels)
+}
+
+func (sink *transformSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.next.AddCounter(name, labels, sink.rules.scale(name, delta))
+}
+
+func (sink *transformSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.next.SetGauge(name, labels, sink.rules.apply(name, value))
+}
+
+func (sink *transformSink) Observe(name string, labels map[string]string, value float64) {
+	sink.next.Observe(name, labels, sink.rules.apply(name, value))
+}
+
+func (sink *transformSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.next.ObserveSummary(name, labels, sink.rules.apply(name, value))
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// canonical unit -> source unit -> factor converting values to the canonical unit
+var unitFactors = map[string]map[string]float64{
+	"bytes": {
+		"B": 1, "KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+		"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40,
+	},
+	"seconds": {
+		"ns": 1e-9, "us": 1e-6, "ms": 1e-3, "s": 1, "min": 60, "h": 3600,
+	},
+	"ratio": {
+		"percent": 0.01,
+	},
+}
+
+// suffixes sources commonly use for their units, stripped before the canonical suffix is added
+var sourceSuffixes = map[string][]string{
+	"B": {"_b"}, "KB": {"_kb"}, "MB": {"_mb"}, "GB": {"_gb"}, "TB": {"_tb"},
+	"KiB": {"_kib"}, "MiB": {"_mib"}, "GiB": {"_gib"}, "TiB": {"_tib"},
+	"ns": {"_ns", "_nanoseconds"}, "us": {"_us", "_microseconds"}, "ms": {"_ms", "_millis", "_milliseconds"},
+	"s": {"_s", "_sec", "_secs"}, "min": {"_min", "_minutes"}, "h": {"_h", "_hours"},
+	"percent": {"_percent", "_pct", "_percentage"},
+}
+
+type unitRule struct {
+	config.UnitRule
+	factor float64
+}
+
+// renaming and conversion of one metric name
+type unitMapping struct {
+	name   string
+	factor float64
+}
+
+// UnitConverter appends canonical unit suffixes to metric names and converts values
+// to base units, following Prometheus naming conventions for all sources
+type UnitConverter struct {
+	rules []unitRule
+	// kind + name -> mapping, nil if no rule matches; emptied beyond MAX_UNIT_MAPPINGS,
+	// so names pushed once don't pile up
+	mappings sync.Map
+	cached   atomic.Int64
+}
+
+func NewUnitConverter(rules []config.UnitRule) (*UnitConverter, error) {
+	conv := &UnitConverter{}
+	for i, rule := range rules {
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return nil, fmt.Errorf("units[%d]: invalid pattern %q: %w", i, rule.Match, err)
+		}
+		factors, ok := unitFactors[rule.Unit]
+		if !ok {
+			return nil, fmt.Errorf("units[%d]: unknown unit %q (use \"bytes\", \"seconds\" or \"ratio\")", i, rule.Unit)
+		}
+		factor := 1.0
+		if rule.From != "" {
+			if factor, ok = factors[rule.From]; !ok {
+				return nil, fmt.Errorf("units[%d]: can't convert %s to %s", i, rule.From, rule.Unit)
+			}
+		}
+		conv.rules = append(conv.rules, unitRule{UnitRule: rule, factor: factor})
+	}
+	return conv, nil
+}
+
+// returns the canonical name and converted value of an update; nil-safe, unmatched metrics are unchanged
+// kind is "counter", "gauge", "histogram" or "summary"
+func (conv *UnitConverter) Apply(kind, name string, value float64) (string, float64) {
+	if conv == nil {
+		return name, value
+	}
+	mapping := conv.mapping(kind, name)
+	if mapping == nil {
+		return name, value
+	}
+	return mapping.name, value * mapping.factor
+}
+
+func (conv *UnitConverter) mapping(kind, name string) *unitMapping {
+	key := kind + "|" + name
+	if cached, ok := conv.mappings.Load(key); ok {
+		return cached.(*unitMapping)
+	}
+	var mapping *unitMapping
+	for _, rule := range conv.rules {
+		if matched, _ := path.Match(rule.Match, name); matched {
+			mapping = &unitMapping{name: canonicalName(kind, name, rule.Unit, rule.From), factor: rule.factor}
+			break
+		}
+	}
+	if _, loaded := conv.mappings.LoadOrStore(key, mapping); !loaded && conv.cached.Add(1) > MAX_UNIT_MAPPINGS {
+		conv.mappings.Clear()
+		conv.cached.Store(0)
+	}
+	return mapping
+}
+
+// "vm_latency_ms" in ms -> "vm_latency_seconds", counters end with "<unit>_total"
+func canonicalName(kind, name, unit, from string) string {
+	base := strings.TrimSuffix(name, "_total")
+	for _, suffix := range sourceSuffixes[from] {
+		if strings.HasSuffix(base, suffix) {
+			base = strings.TrimSuffix(base, suffix)
+			break
+		}
+	}
+	if !strings.HasSuffix(base, "_"+unit) {
+		base += "_" + unit
+	}
+	if kind == "counter" {
+		base += "_total"
+	}
+	return base
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// sums counter increases by name
+type counterSink struct {
+	counters map[string]float64
+}
+
+func (sink *counterSink) IncCounter(name string, labels map[string]string) {
+	sink.counters[name]++
+}
+func (sink *counterSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.counters[name] += delta
+}
+func (sink *counterSink) SetGauge(name string, labels map[string]string, value float64)       {}
+func (sink *counterSink) Observe(name string, labels map[string]string, value float64)        {}
+func (sink *counterSink) ObserveSummary(name string, labels map[string]string, value float64) {}
+
+func TestIncCounterAppliesUnitConversion(t *testing.T) {
+	units, err := NewUnitConverter([]config.UnitRule{{Match: "*_kib_total", Unit: "bytes", From: "KiB"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &counterSink{counters: make(map[string]float64)}
+	hub := NewMetricHub()
+	hub.SetUnits(units)
+	hub.RegisterSink(sink)
+
+	hub.IncCounter("written_kib_total", nil)
+	hub.WithContext(context.Background()).IncCounter("written_kib_total", nil)
+	if value := sink.counters["written_bytes_total"]; value != 2048 {
+		t.Fatalf("written_bytes_total = %v, expected 2048", value)
+	}
+}
+
+func TestUnitMappingsAreBounded(t *testing.T) {
+	units, err := NewUnitConverter([]config.UnitRule{{Match: "*_ms", Unit: "seconds", From: "ms"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*MAX_UNIT_MAPPINGS; i++ {
+		units.Apply("gauge", fmt.Sprintf("pushed_once_%d", i), 1)
+	}
+	if cached := units.cached.Load(); cached > MAX_UNIT_MAPPINGS {
+		t.Fatalf("%d mappings cached, expected at most %d", cached, MAX_UNIT_MAPPINGS)
+	}
+	if name, value := units.Apply("gauge", "latency_ms", 250); name != "latency_seconds" || value != 0.25 {
+		t.Fatalf("converted to %s %v after the cache started over, expected latency_seconds 0.25", name, value)
+	}
+}
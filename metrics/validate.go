@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// drops updates sinks would reject or record wrongly: invalid metric or label names,
+// NaN or infinite counter deltas and observations, negative counter deltas; takes no options
+func newValidateInterceptor(options json.RawMessage) (Interceptor, error) {
+	state := &validation{}
+	return func(next MetricSink) MetricSink {
+		return &validateSink{validation: state, next: next}
+	}, nil
+}
+
+type validation struct {
+	// names found valid, checked once
+	validNames sync.Map
+	// metric + reason logged already
+	warned sync.Map
+}
+
+// reason an update is dropped, empty if it is valid
+func (v *validation) check(name string, labels map[string]string) string {
+	if _, ok := v.validNames.Load(name); !ok {
+		if !util.ValidMetricName(name) {
+			return "invalid_name"
+		}
+		v.validNames.Store(name, true)
+	}
+	for label := range labels {
+		if _, ok := v.validNames.Load("\x00" + label); ok {
+			continue
+		}
+		if !util.ValidLabelName(label) {
+			return "invalid_label"
+		}
+		v.validNames.Store("\x00"+label, true)
+	}
+	return ""
+}
+
+type validateSink struct {
+	*validation
+	next MetricSink
+}
+
+// counts and logs (once per metric and reason) a dropped update
+func (sink *validateSink) drop(name, reason string) {
+	sink.next.AddCounter(INTERCEPTOR_DROPPED_METRIC, map[string]string{"interceptor": INTERCEPTOR_VALIDATE, "reason": reason}, 1)
+	if _, warned := sink.warned.LoadOrStore(name+"\x00"+reason, true); !warned {
+		logger.Warn(fmt.Sprintf("Dropping updates of %q: %s", name, reason))
+	}
+}
+
+func (sink *validateSink) checkValue(name string, labels map[string]string, value float64, counter bool) bool {
+	reason := sink.check(name, labels)
+	switch {
+	case reason != "":
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		reason = "non_finite"
+	case counter && value < 0:
+		reason = "negative_delta"
+	}
+	if reason != "" {
+		sink.drop(name, reason)
+		return false
+	}
+	return true
+}
+
+// rejects invalid names, values are not known when checking
+func (sink *validateSink) CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error {
+	if reason := sink.check(name, labels); reason != "" {
+		return fmt.Errorf("%s dropped by validation: %s", name, reason)
+	}
+	return checkNext(ctx, sink.next, name, kind, labels)
+}
+
+func (sink *validateSink) WithContext(ctx context.Context) MetricSink {
+	return &validateSink{validation: sink.validation, next: bindContext(ctx, sink.next)}
+}
+
+func (sink *validateSink) DeleteSeries(name string, labels map[string]string) bool {
+	return deleteNext(sink.next, name, labels)
+}
+
+func (sink *validateSink) DeleteMetric(name string) bool {
+	return deleteMetricNext(sink.next, name)
+}
+
+func (sink *validateSink) IncCounter(name string, labels map[string]string) {
+	if sink.checkValue(name, labels, 1, true) {
+		sink.next.IncCounter(name, labels)
+	}
+}
+
+func (sink *validateSink) AddCounter(name string, labels map[string]string, delta float64) {
+	if sink.checkValue(name, labels, delta, true) {
+		sink.next.AddCounter(name, labels, delta)
+	}
+}
+
+// NaN gauges are valid, they mark a value as unknown
+func (sink *validateSink) SetGauge(name string, labels map[string]string, value float64) {
+	if reason := sink.check(name, labels); reason != "" {
+		sink.drop(name, reason)
+		return
+	}
+	sink.next.SetGauge(name, labels, value)
+}
+
+func (sink *validateSink) Observe(name string, labels map[string]string, value float64) {
+	if sink.checkValue(name, labels, value, false) {
+		sink.next.Observe(name, labels, value)
+	}
+}
+
+func (sink *validateSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	if sink.checkValue(name, labels, value, false) {
+		sink.next.ObserveSummary(name, labels, value)
+	}
+}
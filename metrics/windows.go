@@ -0,0 +1,215 @@
+package metrics
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// CounterWindows keeps rolling totals of counters over fixed windows and publishes them
+// as gauges, e.g. "deploys_last_24h" for "deploys_total"; registered as a sink of the hub,
+// it sees every counter update after unit conversion. Totals are kept in WINDOW_STEPS
+// steps per window, so a window covers between 59/60 and all of its length;
+// they start empty after restart
+type CounterWindows struct {
+	rules []config.CounterWindowConfig
+	// receives the window gauges, usually the hub
+	out MetricSink
+
+	lock sync.Mutex
+	// counter name -> windows of the first matching rule, nil if none matches
+	windows map[string][]time.Duration
+	// name{labels} -> totals per window
+	series map[string]*windowSeries
+	// optional, shares the label strings of the series with other components
+	interner *util.Interner
+}
+
+type windowSeries struct {
+	labels map[string]string
+	rings  []*windowRing
+}
+
+// totals of one window, buckets[current] collects the step starting at start
+type windowRing struct {
+	gauge   string
+	step    time.Duration
+	buckets [WINDOW_STEPS]float64
+	current int
+	start   time.Time
+}
+
+func NewCounterWindows(rules []config.CounterWindowConfig, out MetricSink) (*CounterWindows, error) {
+	for i, rule := range rules {
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return nil, fmt.Errorf("counterWindows[%d]: invalid pattern %q: %w", i, rule.Match, err)
+		}
+	}
+	return &CounterWindows{
+		rules:   rules,
+		out:     out,
+		windows: make(map[string][]time.Duration),
+		series:  make(map[string]*windowSeries),
+	}, nil
+}
+
+// shares the labels of series created from now on through interner
+func (cw *CounterWindows) SetInterner(interner *util.Interner) {
+	cw.lock.Lock()
+	cw.interner = interner
+	cw.lock.Unlock()
+}
+
+// expires old steps of all windows in the background, so totals drop without new updates
+func (cw *CounterWindows) Start() {
+	interval := time.Duration(0)
+	for _, rule := range cw.rules {
+		for _, window := range rule.Windows {
+			if step := window.Duration / WINDOW_STEPS; interval == 0 || step < interval {
+				interval = step
+			}
+		}
+	}
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			cw.publish("")
+		}
+	}()
+}
+
+func (cw *CounterWindows) IncCounter(name string, labels map[string]string) {
+	cw.AddCounter(name, labels, 1)
+}
+
+func (cw *CounterWindows) AddCounter(name string, labels map[string]string, delta float64) {
+	windows := cw.match(name)
+	if windows == nil || delta < 0 {
+		return
+	}
+	key := name + "{" + util.JoinMapEntries(labels) + "}"
+	now := time.Now()
+
+	cw.lock.Lock()
+	series, exists := cw.series[key]
+	if !exists {
+		if cw.interner != nil {
+			// a shared copy
+			series = &windowSeries{labels: cw.interner.Labels(labels)}
+		} else {
+			series = &windowSeries{labels: make(map[string]string, len(labels))}
+			for label, value := range labels {
+				series.labels[label] = value
+			}
+		}
+		for _, window := range windows {
+			step := window / WINDOW_STEPS
+			series.rings = append(series.rings, &windowRing{gauge: windowGaugeName(name, window), step: step, start: now.Truncate(step)})
+		}
+		cw.series[key] = series
+	}
+	for _, ring := range series.rings {
+		ring.advance(now)
+		ring.buckets[ring.current] += delta
+	}
+	cw.lock.Unlock()
+
+	cw.publish(key)
+}
+
+// window gauges are derived from counters only
+func (cw *CounterWindows) SetGauge(name string, labels map[string]string, value float64)       {}
+func (cw *CounterWindows) Observe(name string, labels map[string]string, value float64)        {}
+func (cw *CounterWindows) ObserveSummary(name string, labels map[string]string, value float64) {}
+
+// sets the gauges of one series, of all series for an empty key
+func (cw *CounterWindows) publish(key string) {
+	type update struct {
+		gauge  string
+		labels map[string]string
+		total  float64
+	}
+	var updates []update
+	now := time.Now()
+
+	cw.lock.Lock()
+	for seriesKey, series := range cw.series {
+		if key != "" && seriesKey != key {
+			continue
+		}
+		for _, ring := range series.rings {
+			ring.advance(now)
+			updates = append(updates, update{ring.gauge, series.labels, ring.total()})
+		}
+	}
+	cw.lock.Unlock()
+
+	// outside the lock, the hub dispatches the gauges back to this sink too
+	for _, u := range updates {
+		cw.out.SetGauge(u.gauge, u.labels, u.total)
+	}
+}
+
+// windows of the first rule matching the counter, cached per name
+func (cw *CounterWindows) match(name string) []time.Duration {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+	if windows, cached := cw.windows[name]; cached {
+		return windows
+	}
+	var windows []time.Duration
+	for _, rule := range cw.rules {
+		if matched, _ := path.Match(rule.Match, name); matched {
+			for _, window := range rule.Windows {
+				windows = append(windows, window.Duration)
+			}
+			break
+		}
+	}
+	cw.windows[name] = windows
+	return windows
+}
+
+// moves to the step containing now, clearing the steps that fell out of the window
+func (ring *windowRing) advance(now time.Time) {
+	steps := int(now.Sub(ring.start) / ring.step)
+	if steps <= 0 {
+		return
+	}
+	ring.start = ring.start.Add(time.Duration(steps) * ring.step)
+	for i := 0; i < min(steps, WINDOW_STEPS); i++ {
+		ring.current = (ring.current + 1) % WINDOW_STEPS
+		ring.buckets[ring.current] = 0
+	}
+}
+
+// summed on demand, a running total would accumulate rounding errors
+func (ring *windowRing) total() float64 {
+	total := 0.0
+	for _, value := range ring.buckets {
+		total += value
+	}
+	return total
+}
+
+// "deploys_total" and 24h -> "deploys_last_24h"
+func windowGaugeName(counter string, window time.Duration) string {
+	base := strings.TrimSuffix(counter, "_total")
+	switch {
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%s_last_%dh", base, window/time.Hour)
+	case window%time.Minute == 0:
+		return fmt.Sprintf("%s_last_%dm", base, window/time.Minute)
+	default:
+		return fmt.Sprintf("%s_last_%ds", base, window/time.Second)
+	}
+}
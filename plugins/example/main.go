@@ -0,0 +1,99 @@
+// Example plugin adding a processor and a sink, build with
+//
+//	go build -buildmode=plugin -o example.so ./plugins/example
+//
+// and load it with "plugins": ["example.so"]:
+//
+//	"pollers": [{"url": "...", "processor": "example-count", "options": {"metric": "items"}, "interval": "1m"}],
+//	"sinks": [{"type": "example-log", "options": {"prefix": "vsphere_"}}]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/plugins"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+)
+
+func Register(registry *plugins.Registry) {
+	registry.Processor("example-count", newCountProcessor)
+	registry.Sink("example-log", newLogSink)
+}
+
+// sets a gauge to the number of elements of a JSON array response
+type countProcessor struct {
+	emit poller.Emitter
+	// gauge name, from the poller options
+	metric string
+}
+
+func newCountProcessor(pc config.PollerConfig) poller.Processor {
+	var options struct {
+		Metric string `json:"metric"`
+	}
+	json.Unmarshal(pc.Options, &options)
+	if options.Metric == "" {
+		options.Metric = "example_items"
+	}
+	return &countProcessor{emit: poller.Emitter{Labels: poller.NewLabelSet(pc.Labels)}, metric: options.Metric}
+}
+
+func (proc *countProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	items, err := poller.Decode[[]json.RawMessage](body, false)
+	if err != nil {
+		return err
+	}
+	emit := proc.emit
+	emit.Sink = sink
+	emit.Gauge(proc.metric, nil, float64(len(items)))
+	return nil
+}
+
+// logs gauge updates of metrics starting with a prefix
+type logSink struct {
+	prefix string
+}
+
+func newLogSink(raw json.RawMessage) (metrics.MetricSink, error) {
+	var options struct {
+		Prefix string `json:"prefix"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &options); err != nil {
+			return nil, err
+		}
+	}
+	return &logSink{prefix: options.Prefix}, nil
+}
+
+func (sink *logSink) SetGauge(name string, labels map[string]string, value float64) {
+	if strings.HasPrefix(name, sink.prefix) {
+		logger.Info(fmt.Sprintf("example-log: %s %v = %v", name, labels, value))
+	}
+}
+
+// logs queued gauge samples, lets the sink be put behind an on-disk queue:
+//
+//	"sinks": [{"type": "example-log", "options": {...}, "queue": {"dir": "/var/lib/collector/queue/example"}}]
+func (sink *logSink) WriteSamples(ctx context.Context, samples []metrics.Sample) error {
+	for _, sample := range samples {
+		if sample.Kind == "gauge" {
+			sink.SetGauge(sample.Name, sample.Labels, sample.Value)
+		}
+	}
+	return nil
+}
+
+func (sink *logSink) IncCounter(name string, labels map[string]string)                    {}
+func (sink *logSink) AddCounter(name string, labels map[string]string, delta float64)     {}
+func (sink *logSink) Observe(name string, labels map[string]string, value float64)        {}
+func (sink *logSink) ObserveSummary(name string, labels map[string]string, value float64) {}
+
+// required by go build, never called for plugins
+func main() {}
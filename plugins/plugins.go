@@ -0,0 +1,98 @@
+// Package plugins loads processors and sinks from Go plugins, so teams can extend the collector
+// without forking it. A plugin is a main package built with
+//
+//	go build -buildmode=plugin -o myplugin.so ./myplugin
+//
+// against the same collector version and exporting
+//
+//	func Register(registry *plugins.Registry)
+//
+// which registers its processors, sinks and interceptors by name, see plugins/example.
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"plugin"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+)
+
+// symbol every plugin must export
+const registerSymbol = "Register"
+
+// creates a sink from the options of its config entry
+type SinkFactory func(options json.RawMessage) (metrics.MetricSink, error)
+
+var (
+	registryLock sync.RWMutex
+	sinks        = map[string]SinkFactory{}
+)
+
+// Registry is handed to the Register function of a plugin
+type Registry struct {
+	// plugin file, for log messages
+	path string
+}
+
+// makes a processor available to pollers as "processor": name
+func (registry *Registry) Processor(name string, factory poller.ProcessorFactory) {
+	poller.RegisterProcessor(name, factory)
+	logger.Info(fmt.Sprintf("Plugin %s registered processor %s", registry.path, name))
+}
+
+// makes a sink available as "sinks": [{"type": name}]
+func (registry *Registry) Sink(name string, factory SinkFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	sinks[name] = factory
+	logger.Info(fmt.Sprintf("Plugin %s registered sink %s", registry.path, name))
+}
+
+// makes an interceptor available as "interceptors": [{"type": name}]
+func (registry *Registry) Interceptor(name string, factory metrics.InterceptorFactory) {
+	metrics.RegisterInterceptor(name, factory)
+	logger.Info(fmt.Sprintf("Plugin %s registered interceptor %s", registry.path, name))
+}
+
+// opens the plugin at path and calls its Register function
+func Load(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	symbol, err := p.Lookup(registerSymbol)
+	if err != nil {
+		return err
+	}
+	register, ok := symbol.(func(*Registry))
+	if !ok {
+		return fmt.Errorf("plugin %s: %s is %T, expected func(*plugins.Registry)", path, registerSymbol, symbol)
+	}
+	register(&Registry{path: path})
+	return nil
+}
+
+// loads all plugins in order
+func LoadAll(paths []string) error {
+	for _, path := range paths {
+		if err := Load(path); err != nil {
+			return fmt.Errorf("failed to load plugin %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// creates a sink registered by a plugin
+func NewSink(name string, options json.RawMessage) (metrics.MetricSink, error) {
+	registryLock.RLock()
+	factory, ok := sinks[name]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q", name)
+	}
+	return factory(options)
+}
@@ -0,0 +1,76 @@
+package poller
+
+import (
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// Adaptive lengthens the interval of a poller whose values stay the same and shortens it
+// again once they change, so static parts of large environments are polled less often
+type Adaptive struct {
+	cfg      config.AdaptiveConfig
+	interval time.Duration
+	// successful polls in a row without a changed value
+	stable int
+	// gauge values of the previous successful poll, nil before the first one
+	previous map[string]float64
+}
+
+// starts at interval, clamped to the configured bounds
+func NewAdaptive(cfg config.AdaptiveConfig, interval time.Duration) *Adaptive {
+	if cfg.StableCycles == 0 {
+		cfg.StableCycles = DEFAULT_ADAPTIVE_STABLE_CYCLES
+	}
+	if cfg.Factor == 0 {
+		cfg.Factor = DEFAULT_ADAPTIVE_FACTOR
+	}
+	a := &Adaptive{cfg: cfg}
+	a.interval = a.clamp(interval)
+	return a
+}
+
+func (a *Adaptive) Interval() time.Duration {
+	return a.interval
+}
+
+// records the outcome of a successful poll and returns true if the interval changed
+func (a *Adaptive) observe(gauges []gaugeSample, counted bool) bool {
+	current := make(map[string]float64, len(gauges))
+	for _, g := range gauges {
+		current[g.name+"{"+util.JoinMapEntries(g.labels)+"}"] = g.value
+	}
+	first := a.previous == nil
+	changed := counted || !sameValues(a.previous, current)
+	a.previous = current
+	if first {
+		return false
+	}
+
+	before := a.interval
+	if changed {
+		a.stable = 0
+		a.interval = a.clamp(time.Duration(float64(a.interval) / a.cfg.Factor))
+	} else if a.stable++; a.stable >= a.cfg.StableCycles {
+		a.stable = 0
+		a.interval = a.clamp(time.Duration(float64(a.interval) * a.cfg.Factor))
+	}
+	return a.interval != before
+}
+
+func (a *Adaptive) clamp(interval time.Duration) time.Duration {
+	return min(max(interval, a.cfg.MinInterval.Duration), a.cfg.MaxInterval.Duration)
+}
+
+func sameValues(previous, current map[string]float64) bool {
+	if len(previous) != len(current) {
+		return false
+	}
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || old != value {
+			return false
+		}
+	}
+	return true
+}
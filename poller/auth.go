@@ -0,0 +1,10 @@
+package poller
+
+import "net/http"
+
+// Authenticator attaches credentials to poll requests, e.g. a shared vCenter session
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+	// called when the endpoint rejected the credentials, so they are renewed on next request
+	Invalidate()
+}
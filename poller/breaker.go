@@ -0,0 +1,151 @@
+package poller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+var breakerStateValues = map[string]float64{breakerClosed: 0, breakerOpen: 1, breakerHalfOpen: 0.5}
+
+// Breaker stops a poller from hammering a dead endpoint: after the configured number of
+// consecutive failures it skips polls for the cooldown, then lets one trial poll through,
+// which either closes the circuit or opens it for another cooldown; nil never skips
+type Breaker struct {
+	cfg     config.BreakerConfig
+	secrets *secrets.Resolver
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(cfg config.BreakerConfig, resolver *secrets.Resolver) *Breaker {
+	return &Breaker{cfg: cfg, secrets: resolver, state: breakerClosed}
+}
+
+// whether the poll due now should run, moves an open circuit to half-open after the cooldown
+func (b *Breaker) Allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && now.Sub(b.openedAt) >= b.cfg.Cooldown.Duration {
+		b.state = breakerHalfOpen
+	}
+	return b.state != breakerOpen
+}
+
+// records a successful poll, returns true if it closed the circuit
+func (b *Breaker) Success() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	if b.state == breakerClosed {
+		return false
+	}
+	b.state = breakerClosed
+	return true
+}
+
+// records a failed poll, returns true if it opened the circuit; a failed trial poll reopens it
+// without counting as a new opening
+func (b *Breaker) Failure(now time.Time) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	switch {
+	case b.state == breakerHalfOpen:
+		b.state, b.openedAt = breakerOpen, now
+		return false
+	case b.state == breakerClosed && b.failures >= b.cfg.Failures:
+		b.state, b.openedAt = breakerOpen, now
+		return true
+	}
+	return false
+}
+
+// current state as POLLER_BREAKER_METRIC value
+func (b *Breaker) Value() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return breakerStateValues[b.state]
+}
+
+// body of alert webhooks
+type BreakerAlert struct {
+	Poller   string    `json:"poller"`
+	State    string    `json:"state"`
+	Failures int       `json:"failures"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// posts the state change to AlertURL in the background, failures are only logged
+func (b *Breaker) alert(poller, state string, failures int, pollErr error) {
+	if b.cfg.AlertURL == "" {
+		return
+	}
+	alert := BreakerAlert{Poller: poller, State: state, Failures: failures, Time: time.Now()}
+	if pollErr != nil {
+		alert.Error = pollErr.Error()
+	}
+	go func() {
+		if err := b.post(alert); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to send breaker alert for poller %s: %v", poller, err))
+		}
+	}()
+}
+
+func (b *Breaker) post(alert BreakerAlert) error {
+	url := b.cfg.AlertURL
+	if b.secrets != nil {
+		expanded, err := b.secrets.Expand(url)
+		if err != nil {
+			return err
+		}
+		url = expanded
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), BREAKER_ALERT_TIMEOUT_SEC*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package poller
+
+import "github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+
+// a gauge value set by a processor
+type gaugeSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// forwards metric updates to the next sink and remembers gauges set during one poll,
+// so they can be re-emitted while the endpoint is briefly down
+// counters, histograms and summaries are not recorded, re-emitting them would count the same event twice
+type recordingSink struct {
+	next   metrics.MetricSink
+	gauges []gaugeSample
+	// a counter moved or an observation was recorded, for adaptive polling
+	counted bool
+}
+
+func (rec *recordingSink) IncCounter(name string, labels map[string]string) {
+	rec.counted = true
+	rec.next.IncCounter(name, labels)
+}
+
+func (rec *recordingSink) AddCounter(name string, labels map[string]string, delta float64) {
+	rec.counted = rec.counted || delta != 0
+	rec.next.AddCounter(name, labels, delta)
+}
+
+func (rec *recordingSink) Observe(name string, labels map[string]string, value float64) {
+	rec.counted = true
+	rec.next.Observe(name, labels, value)
+}
+
+func (rec *recordingSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	rec.counted = true
+	rec.next.ObserveSummary(name, labels, value)
+}
+
+func (rec *recordingSink) SetGauge(name string, labels map[string]string, value float64) {
+	rec.gauges = append(rec.gauges, gaugeSample{name, labels, value})
+	rec.next.SetGauge(name, labels, value)
+}
+
+// re-emits values from the last successful poll and flags the poller as stale
+// for at most StaleIntervals consecutive failures; without cached values nothing is stale
+func (p *Poller) reemitCached() {
+	if p.failures > p.StaleIntervals || len(p.lastGauges) == 0 {
+		return
+	}
+	for _, g := range p.lastGauges {
+		p.Hub.SetGauge(g.name, g.labels, g.value)
+	}
+	p.Hub.SetGauge(POLLER_STALE_METRIC, map[string]string{"poller": p.Name}, 1)
+}
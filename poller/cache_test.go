@@ -0,0 +1,29 @@
+package poller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+func TestStaleOnlyWithCachedValues(t *testing.T) {
+	sink := &gaugeSink{gauges: make(map[string]float64)}
+	hub := metrics.NewMetricHub()
+	hub.RegisterSink(sink)
+	p := NewPoller("http://vc01.invalid", "cluster_hosts", nil, time.Hour, hub)
+	p.StaleIntervals = 2
+	stale := map[string]string{"poller": "cluster_hosts"}
+
+	p.failures = 1
+	p.reemitCached()
+	if sink.has(POLLER_STALE_METRIC, stale) {
+		t.Fatal("poller without a successful poll flagged stale")
+	}
+
+	p.lastGauges = []gaugeSample{{name: "cluster_hosts", value: 3}}
+	p.reemitCached()
+	if sink.gauges[sink.key(POLLER_STALE_METRIC, stale)] != 1 || !sink.has("cluster_hosts", nil) {
+		t.Fatal("cached value was not re-emitted as stale")
+	}
+}
@@ -0,0 +1,24 @@
+package poller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/chaos"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+func TestInjectedFailuresReachSnmpPolls(t *testing.T) {
+	p, err := NewSnmpPoller(config.SnmpPollerConfig{Name: "switch", Target: "192.0.2.1", Version: "2c"}, metrics.NewMetricHub(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Chaos = chaos.NewInjector(&gaugeSink{})
+	if _, err := p.Chaos.Set(chaos.Settings{PollFailureRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.pollOnce(); !errors.Is(err, chaos.ErrInjected) || ErrorCategory(err) != "network" {
+		t.Fatalf("poll returned %v, expected an injected network error", err)
+	}
+}
@@ -0,0 +1,99 @@
+package poller
+
+import "github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+
+// default limit for polled response bodies, protects against huge exports
+const DEFAULT_MAX_BODY_BYTES = 10 * 1024 * 1024
+
+// with SkipUnchanged, every value is written at least once per this many polls,
+// so series deleted or expired in the sink come back and their age stays bounded;
+// seriesTTL must cover them, see config validation
+const DEFAULT_DIFF_REFRESH_POLLS = config.SKIP_UNCHANGED_REFRESH_POLLS
+
+// set to 1 while a poller re-emits cached values after failed polls
+const POLLER_STALE_METRIC = "collector_poller_stale"
+
+// counts failed polls per poller and error category
+const POLLER_ERRORS_METRIC = "collector_poller_errors_total"
+
+// 1 if the last poll failed, including responses not meeting the success criteria
+const POLLER_FAILED_METRIC = "collector_poller_failed"
+
+// received SNMP traps, labelled by result ("matched", "unmatched" or "rejected")
+const SNMP_TRAPS_METRIC = "collector_snmp_traps_total"
+
+const SNMP_TRAPS_PUBLISH_INTERVAL_SEC = 1
+
+// distinct trap OIDs labelling the unmatched trap counter, later ones are counted as
+// trap_oid="other"
+const MAX_UNMATCHED_TRAP_OIDS = 1000
+const UNMATCHED_TRAP_OID_OTHER = "other"
+
+// circuit breaker state per poller: 0 closed, 1 open (polls skipped), 0.5 half-open (trial poll)
+const POLLER_BREAKER_METRIC = "collector_poller_breaker_state"
+
+// notAfter of the earliest expiring certificate of HTTPS poll targets, as Unix time,
+// labelled by poller and host
+const POLLER_CERT_EXPIRY_METRIC = "collector_poller_cert_expiry_timestamp_seconds"
+
+// poll responses by poller and protocol ("HTTP/1.1", "HTTP/2.0")
+const POLLER_PROTOCOL_METRIC = "collector_poller_http_responses_total"
+
+// connections used by poll requests by poller, reused="false" for newly dialed ones
+const POLLER_CONNECTIONS_METRIC = "collector_poller_http_connections_total"
+
+// current interval of adaptive pollers
+const POLLER_INTERVAL_METRIC = "collector_poller_interval_seconds"
+
+// adaptive polling defaults, see config.AdaptiveConfig
+const DEFAULT_ADAPTIVE_STABLE_CYCLES = 3
+const DEFAULT_ADAPTIVE_FACTOR = 2.0
+
+// detail calls in flight at once per FanOut
+const DEFAULT_FAN_OUT_CONCURRENCY = 8
+
+// seconds poll requests waited for the request budget of their host
+const HOST_RATE_LIMIT_WAIT_METRIC = "collector_host_rate_limit_wait_seconds_total"
+
+// fields of a poller's responses currently missing or of a different type than before
+const POLLER_SCHEMA_DRIFT_METRIC = "collector_poller_schema_drift_fields"
+
+// timeout of breaker alert webhooks
+const BREAKER_ALERT_TIMEOUT_SEC = 5
+
+// longer label values are cut by SanitizeLabelValue
+const MAX_LABEL_VALUE_LENGTH = 256
+
+// exec poller defaults, see config.ExecConfig
+const DEFAULT_EXEC_TIMEOUT_SEC = 30
+const DEFAULT_EXEC_MAX_OUTPUT_BYTES = 1024 * 1024
+
+// stderr kept for the error message of a failed command
+const EXEC_STDERR_LOG_BYTES = 1024
+
+// 1 while a maintenance window covers the poller, alert rules can exclude its failures
+const POLLER_MAINTENANCE_METRIC = "collector_poller_maintenance"
+
+// 1 while a maintenance window is active, labelled by window
+const MAINTENANCE_ACTIVE_METRIC = "collector_maintenance_active"
+
+const MAINTENANCE_CHECK_INTERVAL_SEC = 15
+
+// longest a scrape waits for scrape-triggered polls, see OnDemand
+const ON_DEMAND_WAIT_SEC = 10
+
+// scrapes are served this long after startup even if first polls are still pending, see Warmup
+const DEFAULT_WARMUP_TIMEOUT_SEC = 120
+
+// Retry-After of scrapes rejected during warmup
+const WARMUP_RETRY_AFTER_SEC = 5
+
+// bytes of each response body kept for /debug/pollers, see Recorder
+const DEFAULT_DEBUG_BODY_BYTES = 64 << 10
+
+// lookups of name resolvers, labelled by resolver and result ("resolved", "unknown" or "failed");
+// cached names are not counted
+const NAME_RESOLVER_LOOKUPS_METRIC = "collector_name_resolver_lookups_total"
+
+// timeout of name lookups, see config.NameResolverConfig
+const DEFAULT_NAME_RESOLVER_TIMEOUT_SEC = 5
@@ -0,0 +1,194 @@
+package poller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression: "minute hour day-of-month month day-of-week",
+// optionally preceded by a seconds field, or one of @hourly, @daily, @weekly, @monthly.
+// Fields accept *, lists (0,30), ranges (1-5) and steps (*/15, 0-30/10);
+// months and weekdays also accept names (jan, mon). Times are in the local time zone.
+type Cron struct {
+	expr    string
+	seconds uint64
+	minutes uint64
+	hours   uint64
+	dom     uint64
+	months  uint64
+	dow     uint64
+	// day-of-month and day-of-week were both restricted, a day matching either qualifies
+	domOrDow bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+var monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+var weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// the furthest a schedule is searched for its next time, expressions like "0 0 30 2 *" never match
+const cronSearchYears = 5
+
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("cron expression %q must have 5 or 6 fields", expr)
+	}
+
+	c := &Cron{expr: expr}
+	var err error
+	ranges := []struct {
+		target   *uint64
+		min, max int
+		names    map[string]int
+	}{
+		{&c.seconds, 0, 59, nil},
+		{&c.minutes, 0, 59, nil},
+		{&c.hours, 0, 23, nil},
+		{&c.dom, 1, 31, nil},
+		{&c.months, 1, 12, monthNames},
+		{&c.dow, 0, 7, weekdayNames},
+	}
+	for i, r := range ranges {
+		if *r.target, err = parseCronField(fields[i], r.min, r.max, r.names); err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+	}
+	// 7 is Sunday too
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domOrDow = fields[3] != "*" && fields[5] != "*"
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return c, nil
+}
+
+// bit set of the values allowed by a field
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = cronValue(lowPart, names); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = cronValue(highPart, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// first time after t matching the expression, zero if there is none within cronSearchYears
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if c.seconds&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domOrDow {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// calls poll once right away if immediate, then at every time matching the schedule,
+// until done is closed (a nil done runs forever)
+func runCron(schedule *Cron, immediate bool, done <-chan struct{}, poll func()) {
+	if immediate {
+		poll()
+	}
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			poll()
+		case <-done:
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package poller
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2026-01-01 is a Thursday
+	at := func(month time.Month, day, hour, minute, second int) time.Time {
+		return time.Date(2026, month, day, hour, minute, second, 0, time.UTC)
+	}
+	for _, test := range []struct {
+		expr     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"*/15 * * * *", at(1, 1, 10, 7, 30), at(1, 1, 10, 15, 0)},
+		{"*/15 * * * *", at(1, 1, 10, 45, 0), at(1, 1, 11, 0, 0)},
+		{"0-30/10 * * * *", at(1, 1, 10, 31, 0), at(1, 1, 11, 0, 0)},
+		{"20/20 * * * *", at(1, 1, 10, 41, 0), at(1, 1, 11, 20, 0)},
+		{"0,30 * * * *", at(1, 1, 10, 0, 0), at(1, 1, 10, 30, 0)},
+		{"5 10-12 * * *", at(1, 1, 12, 6, 0), at(1, 2, 10, 5, 0)},
+		{"30 * * * * *", at(1, 1, 10, 0, 0), at(1, 1, 10, 0, 30)},
+		{"0 9 * feb-mar mon", at(1, 1, 0, 0, 0), at(2, 2, 9, 0, 0)},
+		{"0 9 * JAN Mon", at(1, 1, 0, 0, 0), at(1, 5, 9, 0, 0)},
+		// 7 is Sunday like 0
+		{"0 0 * * 7", at(1, 1, 0, 0, 0), at(1, 4, 0, 0, 0)},
+		{"0 0 * * 0", at(1, 1, 0, 0, 0), at(1, 4, 0, 0, 0)},
+		{"0 0 * * 5-7", at(1, 3, 12, 0, 0), at(1, 4, 0, 0, 0)},
+		// both day fields restricted: the 13th or any Friday
+		{"0 0 13 * fri", at(1, 1, 0, 0, 0), at(1, 2, 0, 0, 0)},
+		{"0 0 13 * fri", at(1, 10, 0, 0, 0), at(1, 13, 0, 0, 0)},
+		// only one restricted: the other is ignored
+		{"0 0 13 * *", at(1, 1, 0, 0, 0), at(1, 13, 0, 0, 0)},
+		{"0 0 * * fri", at(1, 2, 0, 0, 0), at(1, 9, 0, 0, 0)},
+		{"@hourly", at(1, 1, 10, 0, 0), at(1, 1, 11, 0, 0)},
+		{"@daily", at(1, 1, 10, 0, 0), at(1, 2, 0, 0, 0)},
+		{"@weekly", at(1, 1, 10, 0, 0), at(1, 4, 0, 0, 0)},
+		{"@monthly", at(1, 1, 10, 0, 0), at(2, 1, 0, 0, 0)},
+		{"0 0 31 * *", at(1, 31, 0, 0, 0), at(3, 31, 0, 0, 0)},
+		{"0 0 29 2 *", at(1, 1, 0, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	} {
+		c, err := ParseCron(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if next := c.Next(test.from); !next.Equal(test.expected) {
+			t.Errorf("%s after %v: got %v, expected %v", test.expr, test.from, next, test.expected)
+		}
+	}
+}
+
+func TestParseCronRejects(t *testing.T) {
+	for expr, message := range map[string]string{
+		"* * * *":          "must have 5 or 6 fields",
+		"* * * * * * *":    "must have 5 or 6 fields",
+		"60 * * * *":       "out of range",
+		"0 24 * * *":       "out of range",
+		"0 0 0 * *":        "out of range",
+		"0 0 * 13 *":       "out of range",
+		"0 0 * * 8":        "out of range",
+		"30-10 * * * *":    "out of range",
+		"*/0 * * * *":      "invalid step",
+		"*/x * * * *":      "invalid step",
+		"0 0 * foo *":      "invalid value",
+		"0 0 * * mon-foo":  "invalid value",
+		"@yearly":          "must have 5 or 6 fields",
+		"0 0 30 2 *":       "never matches",
+		"0 0 31 apr,jun *": "never matches",
+	} {
+		if _, err := ParseCron(expr); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: got error %v, expected %q", expr, err, message)
+		}
+	}
+}
+
+func TestCronNextAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, berlin)
+	}
+
+	// clocks jump from 2:00 to 3:00 on March 29th, 2:30 doesn't exist that day
+	daily, _ := ParseCron("30 2 * * *")
+	if next := daily.Next(at(3, 28, 12, 0)); !next.Equal(at(3, 30, 2, 30)) {
+		t.Errorf("daily 2:30 across spring forward: got %v", next)
+	}
+
+	// hourly runs stay an hour apart while the offset changes
+	hourly, _ := ParseCron("0 * * * *")
+	for _, from := range []time.Time{at(3, 29, 0, 30), at(10, 25, 0, 30)} {
+		previous := hourly.Next(from)
+		for range 4 {
+			next := hourly.Next(previous)
+			if next.Sub(previous) != time.Hour {
+				t.Errorf("hourly after %v: got %v", previous, next)
+			}
+			previous = next
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package poller
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// response headers replaced in recorded responses, they carry session credentials
+var redactedHeaders = []string{"Set-Cookie", "Vmware-Api-Session-Id", "X-Auth-Token"}
+
+// Recorder keeps the last response of each poller, to see what an endpoint returned
+// and what was made of it without capturing packets
+type Recorder struct {
+	maxBodyBytes int
+
+	lock sync.Mutex
+	// poller name -> last response
+	last map[string]*Response
+}
+
+// the last poll of a poller; Status, Headers and Body are empty if the request failed
+type Response struct {
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	// host and path, the query may hold credentials
+	URL     string      `json:"url"`
+	Status  int         `json:"status,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body"`
+	// the body was cut at the configured size
+	Truncated bool `json:"truncated,omitempty"`
+
+	// "ok" or the error category, see ErrorCategory
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// gauges the processor set, counters and observations are not recorded
+	Gauges []metrics.Sample `json:"gauges"`
+
+	// bytes of the body kept
+	limit int
+}
+
+func NewRecorder(cfg config.DebugConfig) *Recorder {
+	maxBodyBytes := cfg.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = DEFAULT_DEBUG_BODY_BYTES
+	}
+	return &Recorder{maxBodyBytes: maxBodyBytes, last: make(map[string]*Response)}
+}
+
+// last response of the poller, false if it did not poll yet or is unknown
+func (recorder *Recorder) Last(name string) (*Response, bool) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	response, ok := recorder.last[name]
+	return response, ok
+}
+
+// starts recording a poll, nil if recorder is nil
+func (recorder *Recorder) start() *Response {
+	if recorder == nil {
+		return nil
+	}
+	return &Response{Time: time.Now(), limit: recorder.maxBodyBytes}
+}
+
+// keeps the response of a finished poll
+func (recorder *Recorder) record(name string, response *Response, err error, gauges []gaugeSample) {
+	if recorder == nil {
+		return
+	}
+	response.DurationSeconds = time.Since(response.Time).Seconds()
+	response.Result = "ok"
+	if err != nil {
+		response.Result = ErrorCategory(err)
+		response.Error = redactURLs(err.Error())
+	}
+	response.Gauges = make([]metrics.Sample, len(gauges))
+	for i, gauge := range gauges {
+		response.Gauges[i] = metrics.Sample{Kind: "gauge", Name: gauge.name, Labels: gauge.labels, Value: gauge.value, Time: response.Time}
+	}
+	if len(response.Body) > response.limit {
+		response.Body, response.Truncated = response.Body[:response.limit], true
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.last[name] = response
+}
+
+// drops the response of a stopped poller, e.g. a discovered entity removed from inventory
+func (recorder *Recorder) forget(name string) {
+	if recorder == nil {
+		return
+	}
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	delete(recorder.last, name)
+}
+
+// takes status and headers of the response, the body is set once read
+func (response *Response) setResponse(resp *http.Response) {
+	if response == nil {
+		return
+	}
+	response.URL = resp.Request.URL.Host + resp.Request.URL.Path
+	response.Status = resp.StatusCode
+	response.Headers = resp.Header.Clone()
+	for _, name := range redactedHeaders {
+		if response.Headers.Get(name) != "" {
+			response.Headers.Set(name, "<redacted>")
+		}
+	}
+}
+
+// takes the body; if it was not read because the status was rejected, reads it from resp
+func (response *Response) setBody(body []byte, resp *http.Response) {
+	if response == nil {
+		return
+	}
+	if body == nil && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		// one byte more to tell whether it was cut
+		body, _ = io.ReadAll(io.LimitReader(resp.Body, int64(response.limit)+1))
+	}
+	response.Body = string(body)
+}
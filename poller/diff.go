@@ -0,0 +1,48 @@
+package poller
+
+import (
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// forwards metric updates to the next sink but drops gauge writes whose value did not change
+// since the previous successful poll, saving sink locking and checkpoint churn for static values
+// counters, histograms and summaries are always forwarded
+type diffSink struct {
+	next metrics.MetricSink
+	// "name{labelKey}" -> value emitted by the previous successful poll
+	previous map[string]float64
+	// values emitted during this poll, become previous if the poll succeeds
+	current map[string]float64
+	// write every value, see DEFAULT_DIFF_REFRESH_POLLS
+	force bool
+}
+
+func newDiffSink(next metrics.MetricSink, previous map[string]float64, force bool) *diffSink {
+	return &diffSink{next: next, previous: previous, current: make(map[string]float64), force: force}
+}
+
+func (diff *diffSink) IncCounter(name string, labels map[string]string) {
+	diff.next.IncCounter(name, labels)
+}
+
+func (diff *diffSink) AddCounter(name string, labels map[string]string, delta float64) {
+	diff.next.AddCounter(name, labels, delta)
+}
+
+func (diff *diffSink) Observe(name string, labels map[string]string, value float64) {
+	diff.next.Observe(name, labels, value)
+}
+
+func (diff *diffSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	diff.next.ObserveSummary(name, labels, value)
+}
+
+func (diff *diffSink) SetGauge(name string, labels map[string]string, value float64) {
+	key := name + "{" + util.JoinMapEntries(labels) + "}"
+	diff.current[key] = value
+	if previous, ok := diff.previous[key]; ok && previous == value && !diff.force {
+		return
+	}
+	diff.next.SetGauge(name, labels, value)
+}
@@ -0,0 +1,88 @@
+package poller
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+)
+
+// error categories returned from pollOnce, wrapped with details via fmt.Errorf("%w: ...")
+var (
+	ErrTimeout = errors.New("timeout")
+	ErrAuth    = errors.New("auth")
+	ErrDecode  = errors.New("decode")
+	ErrStatus  = errors.New("status")
+	ErrNetwork = errors.New("network")
+	// response without a valid signature, see Poller.Signature
+	ErrSignature = errors.New("signature")
+	// response not meeting the success criteria, see Poller.Success
+	ErrCriteria = errors.New("criteria")
+)
+
+// returns the category name of a poll error, used as label value of POLLER_ERRORS_METRIC
+// the outermost category in the chain wins, so an auth error caused by a timeout stays "auth"
+func ErrorCategory(err error) string {
+	if category := errorCategory(err); category != nil {
+		return category.Error()
+	}
+	return "other"
+}
+
+var errorCategories = []error{ErrTimeout, ErrAuth, ErrDecode, ErrStatus, ErrNetwork, ErrSignature, ErrCriteria}
+
+func errorCategory(err error) error {
+	for _, category := range errorCategories {
+		if err == category {
+			return category
+		}
+	}
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() error }:
+		return errorCategory(wrapped.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, inner := range wrapped.Unwrap() {
+			if category := errorCategory(inner); category != nil {
+				return category
+			}
+		}
+	}
+	return nil
+}
+
+// wraps an HTTP client error into ErrTimeout or ErrNetwork; the URL in it is redacted,
+// the error is logged and shown on the debug endpoint
+func requestError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = &url.Error{Op: urlErr.Op, URL: redactURL(urlErr.URL), Err: urlErr.Err}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %w", ErrNetwork, err)
+}
+
+// drops user info, query and fragment of a URL, they may carry credentials or tokens
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// URLs in error messages, e.g. of pipeline steps or processors fetching details
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"']+`)
+
+// redacts every URL in message, see redactURL
+func redactURLs(message string) string {
+	return urlPattern.ReplaceAllStringFunc(message, redactURL)
+}
@@ -0,0 +1,178 @@
+package poller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/chaos"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var errOutputTooLarge = errors.New("output too large")
+
+// ExecPoller runs an external command on a schedule and records the metrics it prints,
+// for sources without a native processor
+type ExecPoller struct {
+	Config    config.ExecConfig
+	Hub       *metrics.MetricHub
+	Secrets   *secrets.Resolver
+	Processor Processor
+	// optional, runs at the times matching the schedule instead of every interval
+	Cron *Cron
+
+	// delay of the first scheduled run, see StaggerOffset
+	Offset time.Duration
+	// optional, waits for the first run before scrapes are served
+	Warmup *Warmup
+	// optional, fails runs on purpose in test deployments
+	Chaos *chaos.Injector
+}
+
+func NewExecPoller(cfg config.ExecConfig, hub *metrics.MetricHub, resolver *secrets.Resolver) (*ExecPoller, error) {
+	if cfg.Timeout.Duration <= 0 {
+		cfg.Timeout.Duration = DEFAULT_EXEC_TIMEOUT_SEC * time.Second
+	}
+	if cfg.MaxOutputBytes <= 0 {
+		cfg.MaxOutputBytes = DEFAULT_EXEC_MAX_OUTPUT_BYTES
+	}
+	p := &ExecPoller{Config: cfg, Hub: hub, Secrets: resolver}
+	switch cfg.Format {
+	case "", "json":
+		p.Processor = &MetricsJSONProcessor{Labels: cfg.Labels}
+	case "prometheus":
+		p.Processor = &PrometheusTextProcessor{Labels: cfg.Labels}
+	default:
+		return nil, fmt.Errorf("unknown exec output format %q", cfg.Format)
+	}
+	if cfg.Schedule != "" {
+		cron, err := ParseCron(cfg.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		p.Cron = cron
+	}
+	return p, nil
+}
+
+func (p *ExecPoller) Start() {
+	p.Warmup.add(p, p.Config.Name)
+	if p.Cron != nil {
+		go runCron(p.Cron, p.Config.ImmediateFirstPoll, nil, p.poll)
+		return
+	}
+	go runSchedule(p.Config.Interval.Duration, p.Offset, p.Config.ImmediateFirstPoll, nil, p.poll)
+}
+
+// runs the command once and counts failures
+func (p *ExecPoller) poll() {
+	defer p.Warmup.done(p)
+	ctx := logger.WithRequestID(context.Background(), "exec-"+logger.NewID())
+	ctx, span := tracing.Start(ctx, "exec", attribute.String("poller", p.Config.Name))
+	defer span.End()
+	if err := p.pollOnce(ctx); err != nil {
+		tracing.Fail(span, err)
+		logger.WarnCtx(ctx, fmt.Sprintf("Exec poller %s failed: %v", p.Config.Name, err))
+		p.Hub.IncCounter(POLLER_ERRORS_METRIC, map[string]string{"poller": p.Config.Name, "category": ErrorCategory(err)})
+	}
+}
+
+func (p *ExecPoller) pollOnce(ctx context.Context) error {
+	// injected failures look like a failing command
+	if err := p.Chaos.PollError(p.Config.Name); err != nil {
+		return fmt.Errorf("%w: %w", ErrStatus, err)
+	}
+	args, env, err := p.expand()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrAuth, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.Config.Timeout.Duration)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	stdout := &limitedBuffer{limit: p.Config.MaxOutputBytes, cancel: cancel}
+	stderr := &limitedBuffer{limit: EXEC_STDERR_LOG_BYTES}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// the command may leave children holding stdout open, do not wait for them after it was killed
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	switch {
+	case stdout.exceeded:
+		return fmt.Errorf("%w: stdout exceeds %d bytes", ErrDecode, p.Config.MaxOutputBytes)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: killed after %v", ErrTimeout, p.Config.Timeout.Duration)
+	case err != nil:
+		if message := strings.TrimSpace(stderr.buf.String()); message != "" {
+			return fmt.Errorf("%w: %w: %s", ErrStatus, err, message)
+		}
+		return fmt.Errorf("%w: %w", ErrStatus, err)
+	}
+
+	if err := p.Processor.Process(stdout.buf.Bytes(), p.Hub.WithContext(ctx)); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return nil
+}
+
+// command line and environment with secret placeholders expanded
+func (p *ExecPoller) expand() ([]string, []string, error) {
+	expand := func(template string) (string, error) {
+		if p.Secrets == nil {
+			return template, nil
+		}
+		return p.Secrets.Expand(template)
+	}
+	args := make([]string, len(p.Config.Command))
+	for i, arg := range p.Config.Command {
+		value, err := expand(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		args[i] = value
+	}
+	env := make([]string, 0, len(p.Config.Env))
+	for name, template := range p.Config.Env {
+		value, err := expand(template)
+		if err != nil {
+			return nil, nil, err
+		}
+		env = append(env, name+"="+value)
+	}
+	return args, env, nil
+}
+
+// keeps at most limit bytes; with cancel set, exceeding the limit kills the command
+// (not embedding bytes.Buffer, its ReadFrom would let io.Copy bypass Write)
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	exceeded bool
+	cancel   context.CancelFunc
+}
+
+func (buf *limitedBuffer) Write(p []byte) (int, error) {
+	if room := buf.limit - int64(buf.buf.Len()); int64(len(p)) > room {
+		buf.buf.Write(p[:max(room, 0)])
+		if buf.cancel == nil {
+			// stderr, keep reading so the command does not block
+			return len(p), nil
+		}
+		buf.exceeded = true
+		buf.cancel()
+		return 0, errOutputTooLarge
+	}
+	return buf.buf.Write(p)
+}
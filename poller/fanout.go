@@ -0,0 +1,128 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// Fetcher GETs a further endpoint during a poll with the poller's client, credentials and headers,
+// relative URLs are resolved against the poller URL
+type Fetcher func(ctx context.Context, url string) ([]byte, error)
+
+// optional interface of processors that call a detail endpoint per listed item,
+// used instead of Process when the processor implements it
+type FetchingProcessor interface {
+	Processor
+	ProcessFetching(ctx context.Context, body []byte, sink metrics.MetricSink, fetch Fetcher) error
+}
+
+// FanOut runs per-item calls of a single poll concurrently, e.g. one detail request per deployment
+// of a list response, so processors do not manage goroutines themselves
+type FanOut struct {
+	// calls in flight at once, 0 means DEFAULT_FAN_OUT_CONCURRENCY
+	Concurrency int
+	// optional, shared by all calls, e.g. to stay within the API budget of the polled host
+	Limiter *RateLimiter
+}
+
+// calls call(ctx, i) for i in [0, n); the first error cancels the context of the remaining
+// calls and is returned once all started calls have finished
+func (f FanOut) Run(ctx context.Context, n int, call func(ctx context.Context, i int) error) error {
+	concurrency := f.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_FAN_OUT_CONCURRENCY
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	slots := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err := f.Limiter.Wait(ctx); err != nil {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := call(ctx, i); err != nil {
+				fail(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr == nil {
+		// cancelled by the caller
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// Fetcher of the poller, responses are subject to the same status and size checks as the poll itself
+func (p *Poller) fetch(ctx context.Context, ref string) ([]byte, error) {
+	resp, err := p.do(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return p.readBody(resp)
+}
+
+func resolveURL(base, ref string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid poller url: %w", err)
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", ref, err)
+	}
+	return baseURL.ResolveReference(refURL).String(), nil
+}
+
+// checks the response status, reads a body of at most MaxBodyBytes and verifies its signature
+func (p *Poller) readBody(resp *http.Response) ([]byte, error) {
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: status %d", ErrAuth, resp.StatusCode)
+	}
+	if !p.Success.acceptsStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("%w: status %d", ErrStatus, resp.StatusCode)
+	}
+
+	// read one byte more than allowed to detect oversized responses
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.MaxBodyBytes+1))
+	if err != nil {
+		return nil, requestError(err)
+	}
+	if int64(len(body)) > p.MaxBodyBytes {
+		return nil, fmt.Errorf("%w: response body exceeds %d bytes", ErrDecode, p.MaxBodyBytes)
+	}
+	if err := p.Signature.Verify(resp.Header, body); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+	return body, nil
+}
@@ -0,0 +1,95 @@
+package poller
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// MetricsJSONProcessor reads a generic list of metrics, e.g. printed by scripts:
+//
+//	{"metrics": [{"name": "backup_age_seconds", "value": 3600, "labels": {"job": "vcsa"}},
+//	             {"name": "backup_runs_total", "type": "counter", "value": 42},
+//	             {"name": "vcsa_info", "type": "info", "identity": ["job"], "labels": {"job": "vcsa", "version": "8.0.2"}}]}
+//
+// type is "gauge" (default), "counter" or "info"; counter values are totals, the increase since
+// the previous response is added; info metrics need no value, see metrics.SetInfo
+type MetricsJSONProcessor struct {
+	Labels map[string]string
+	Strict bool
+	totals metrics.CumulativeConverter
+}
+
+func (proc *MetricsJSONProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	parsed, err := Decode[struct {
+		Metrics []struct {
+			Name     string            `json:"name"`
+			Type     string            `json:"type"`
+			Value    *float64          `json:"value"`
+			Labels   map[string]string `json:"labels"`
+			Identity []string          `json:"identity"`
+		} `json:"metrics"`
+	}](body, proc.Strict)
+	if err != nil {
+		return err
+	}
+	for i, m := range parsed.Metrics {
+		if m.Type == "info" {
+			if !strings.HasSuffix(m.Name, "_info") {
+				return fmt.Errorf("metrics[%d] is an info metric not ending in _info", i)
+			}
+			metrics.SetInfo(sink, m.Name, m.Identity, mergeLabels(proc.Labels, m.Labels))
+			continue
+		}
+		if m.Name == "" || m.Value == nil {
+			return fmt.Errorf("metrics[%d] without name or value", i)
+		}
+		labels := mergeLabels(proc.Labels, m.Labels)
+		switch m.Type {
+		case "", "gauge":
+			sink.SetGauge(m.Name, labels, *m.Value)
+		case "counter":
+			proc.totals.Increase(sink, m.Name, labels, *m.Value, 0)
+		default:
+			return fmt.Errorf("metrics[%d] has unknown type %q", i, m.Type)
+		}
+	}
+	return nil
+}
+
+// PrometheusTextProcessor reads the Prometheus text exposition format, e.g. of node exporters
+// or scripts; gauges and untyped samples are set, counters add their increase since the previous
+// response; histograms and summaries are skipped, sinks only take single observations
+type PrometheusTextProcessor struct {
+	Labels map[string]string
+	totals metrics.CumulativeConverter
+}
+
+func (proc *PrometheusTextProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := mergeLabels(proc.Labels, nil)
+			for _, pair := range m.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				sink.SetGauge(name, labels, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				sink.SetGauge(name, labels, m.GetUntyped().GetValue())
+			case dto.MetricType_COUNTER:
+				proc.totals.Increase(sink, name, labels, m.GetCounter().GetValue(), 0)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// GraphQLProcessor maps fields of GraphQL response data to metrics, see config.GraphQLConfig;
+// responses with errors fail the poll even if they carry partial data
+type GraphQLProcessor struct {
+	Labels  map[string]string
+	Metrics []config.GraphQLMetric
+	totals  metrics.CumulativeConverter
+}
+
+func (proc *GraphQLProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	var response struct {
+		Data   any `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		return fmt.Errorf("query failed with %d error(s), first: %s", len(response.Errors), response.Errors[0].Message)
+	}
+	if response.Data == nil {
+		return fmt.Errorf("response without data")
+	}
+
+	for _, m := range proc.Metrics {
+		items := []any{response.Data}
+		if m.ForEach != "" {
+			value, _ := lookupField(response.Data, m.ForEach)
+			list, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("metric %s: %s is not a list", m.Name, m.ForEach)
+			}
+			items = list
+		}
+		for _, item := range items {
+			value, ok := graphQLNumber(item, m.Value)
+			if !ok {
+				return fmt.Errorf("metric %s: %s is not a number or boolean", m.Name, m.Value)
+			}
+			labels := mergeLabels(proc.Labels, nil)
+			for label, path := range m.Labels {
+				labelValue, _ := lookupField(item, path)
+				labels[SanitizeLabelName(label)] = SanitizeLabelValue(fieldString(labelValue))
+			}
+			if m.Type == "counter" {
+				proc.totals.Increase(sink, m.Name, labels, value, 0)
+				continue
+			}
+			sink.SetGauge(m.Name, labels, value)
+		}
+	}
+	return nil
+}
+
+func graphQLNumber(item any, path string) (float64, bool) {
+	value, _ := lookupField(item, path)
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// request body posting the query of cfg
+func GraphQLBody(cfg config.GraphQLConfig) (string, error) {
+	body, err := json.Marshal(struct {
+		Query         string         `json:"query"`
+		Variables     map[string]any `json:"variables,omitempty"`
+		OperationName string         `json:"operationName,omitempty"`
+	}{cfg.Query, cfg.Variables, cfg.OperationName})
+	return string(body), err
+}
@@ -0,0 +1,19 @@
+package poller_test
+
+import (
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller/processortest"
+)
+
+// regenerate with UPDATE_GOLDEN=1 go test ./poller -run GraphQL
+func TestGraphQLGolden(t *testing.T) {
+	processortest.CheckDir(t, "testdata/graphql", func() poller.Processor {
+		return &poller.GraphQLProcessor{Labels: map[string]string{"site": "lab"}, Metrics: []config.GraphQLMetric{
+			{Name: "platform_cluster_cpu_usage_ratio", ForEach: "clusters", Value: "cpu.usage", Labels: map[string]string{"cluster": "name"}},
+			{Name: "platform_cluster_healthy", ForEach: "clusters", Value: "healthy", Labels: map[string]string{"cluster": "name"}},
+		}}
+	})
+}
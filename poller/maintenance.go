@@ -0,0 +1,146 @@
+package poller
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/annotations"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+type maintenanceWindow struct {
+	cfg      config.MaintenanceWindow
+	schedule *Cron
+}
+
+// active reports whether the window covers now
+func (w *maintenanceWindow) active(now time.Time) bool {
+	if w.schedule == nil {
+		return !now.Before(w.cfg.From) && now.Before(w.cfg.Until)
+	}
+	// the last start within Duration before now, if any
+	start := w.schedule.Next(now.Add(-w.cfg.Duration.Duration))
+	return !start.IsZero() && !start.After(now)
+}
+
+// covers reports whether the window applies to a poller
+func (w *maintenanceWindow) covers(name string, labels map[string]string) bool {
+	if len(w.cfg.Pollers) == 0 && len(w.cfg.Labels) == 0 {
+		return true
+	}
+	for _, pattern := range w.cfg.Pollers {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	if len(w.cfg.Labels) == 0 {
+		return false
+	}
+	for label, value := range w.cfg.Labels {
+		if labels[label] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Maintenance holds planned downtime windows; pollers covered by an active window keep
+// polling, set POLLER_MAINTENANCE_METRIC and, with action "suppress", send no breaker alerts
+type Maintenance struct {
+	windows []*maintenanceWindow
+	sink    metrics.MetricSink
+	// window name -> active at the last check, for logging
+	active map[string]bool
+	// optional, records each active window as an annotation region
+	Annotations *annotations.Store
+}
+
+func NewMaintenance(windows []config.MaintenanceWindow, sink metrics.MetricSink) (*Maintenance, error) {
+	maintenance := &Maintenance{sink: sink, active: make(map[string]bool)}
+	for _, cfg := range windows {
+		window := &maintenanceWindow{cfg: cfg}
+		if cfg.Schedule != "" {
+			schedule, err := ParseCron(cfg.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("maintenance window %s: %w", cfg.Name, err)
+			}
+			window.schedule = schedule
+		}
+		maintenance.windows = append(maintenance.windows, window)
+	}
+	return maintenance, nil
+}
+
+// publishes MAINTENANCE_ACTIVE_METRIC per window and logs windows starting and ending
+func (maintenance *Maintenance) Start() {
+	maintenance.check(time.Now())
+	go func() {
+		ticker := time.NewTicker(MAINTENANCE_CHECK_INTERVAL_SEC * time.Second)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			maintenance.check(now)
+		}
+	}()
+}
+
+func (maintenance *Maintenance) check(now time.Time) {
+	for _, window := range maintenance.windows {
+		active := window.active(now)
+		if active != maintenance.active[window.cfg.Name] {
+			key := "maintenance/" + window.cfg.Name
+			if active {
+				logger.Info(fmt.Sprintf("Maintenance window %s started", window.cfg.Name))
+				maintenance.Annotations.Begin(annotations.SOURCE_MAINTENANCE, key, fmt.Sprintf("Maintenance window %s", window.cfg.Name),
+					[]string{"maintenance", window.cfg.Name})
+			} else {
+				logger.Info(fmt.Sprintf("Maintenance window %s ended", window.cfg.Name))
+				maintenance.Annotations.Finish(key)
+			}
+			maintenance.active[window.cfg.Name] = active
+		}
+		value := 0.0
+		if active {
+			value = 1
+		}
+		maintenance.sink.SetGauge(MAINTENANCE_ACTIVE_METRIC, map[string]string{"window": window.cfg.Name}, value)
+	}
+}
+
+// the windows covering a poller, nil if none does
+func (maintenance *Maintenance) For(name string, labels map[string]string) *Maintenance {
+	if maintenance == nil {
+		return nil
+	}
+	var covering []*maintenanceWindow
+	for _, window := range maintenance.windows {
+		if window.covers(name, labels) {
+			covering = append(covering, window)
+		}
+	}
+	if len(covering) == 0 {
+		return nil
+	}
+	return &Maintenance{windows: covering}
+}
+
+// name of the first active window, empty if none; suppress if any active window suppresses alerts
+func (maintenance *Maintenance) Active(now time.Time) (window string, suppress bool) {
+	if maintenance == nil {
+		return "", false
+	}
+	for _, w := range maintenance.windows {
+		if !w.active(now) {
+			continue
+		}
+		if window == "" {
+			window = w.cfg.Name
+		}
+		if w.cfg.Action == config.MAINTENANCE_SUPPRESS {
+			suppress = true
+		}
+	}
+	return window, suppress
+}
@@ -0,0 +1,168 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// NsxEdgeProcessor reads NSX-T edge transport node status
+// (GET /api/v1/transport-nodes/{edge-id}/status) and exports CPU and memory of the edge:
+//
+//	{"node_display_name": "edge01",
+//	 "node_status": {"system_status": {"cpu_cores": 8, "load_average": [0.5, 0.4, 0.3],
+//	   "mem_total": 32000000, "mem_used": 12000000}}}
+//
+// NSX reports memory in kilobytes, exported values are converted to bytes
+type NsxEdgeProcessor struct {
+	Labels map[string]string
+	Strict bool
+}
+
+func (proc *NsxEdgeProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	var parsed struct {
+		NodeDisplayName string `json:"node_display_name"`
+		NodeStatus      struct {
+			SystemStatus struct {
+				CPUCores    *float64  `json:"cpu_cores"`
+				LoadAverage []float64 `json:"load_average"`
+				MemTotal    *float64  `json:"mem_total"`
+				MemUsed     *float64  `json:"mem_used"`
+			} `json:"system_status"`
+		} `json:"node_status"`
+	}
+	if err := DecodeJSON(body, &parsed, proc.Strict); err != nil {
+		return err
+	}
+	if parsed.NodeDisplayName == "" {
+		return fmt.Errorf("nsx edge status without node_display_name")
+	}
+
+	labels := mergeLabels(proc.Labels, map[string]string{"edge": parsed.NodeDisplayName})
+	status := parsed.NodeStatus.SystemStatus
+	if status.CPUCores != nil {
+		sink.SetGauge("nsx_edge_cpu_cores", labels, *status.CPUCores)
+	}
+	for i, window := range []string{"1m", "5m", "15m"} {
+		if i < len(status.LoadAverage) {
+			sink.SetGauge("nsx_edge_load_average", mergeLabels(labels, map[string]string{"window": window}), status.LoadAverage[i])
+		}
+	}
+	if status.MemTotal != nil {
+		sink.SetGauge("nsx_edge_memory_total_bytes", labels, *status.MemTotal*1024)
+	}
+	if status.MemUsed != nil {
+		sink.SetGauge("nsx_edge_memory_used_bytes", labels, *status.MemUsed*1024)
+	}
+	return nil
+}
+
+// NsxEdgeInterfaceProcessor reads edge interface statistics
+// (GET /api/v1/transport-nodes/{edge-id}/network/interfaces/{interface-id}/stats)
+// for edge throughput; the edge is identified by the static labels of the poller.
+// NSX reports totals since the edge started, exported as counters
+type NsxEdgeInterfaceProcessor struct {
+	Labels map[string]string
+	Strict bool
+
+	totals metrics.CumulativeConverter
+}
+
+func (proc *NsxEdgeInterfaceProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	var parsed struct {
+		InterfaceID string   `json:"interface_id"`
+		RxBytes     *float64 `json:"rx_bytes"`
+		TxBytes     *float64 `json:"tx_bytes"`
+		RxPackets   *float64 `json:"rx_packets"`
+		TxPackets   *float64 `json:"tx_packets"`
+		RxDropped   *float64 `json:"rx_dropped"`
+		TxDropped   *float64 `json:"tx_dropped"`
+	}
+	if err := DecodeJSON(body, &parsed, proc.Strict); err != nil {
+		return err
+	}
+	if parsed.InterfaceID == "" {
+		return fmt.Errorf("nsx interface stats without interface_id")
+	}
+
+	labels := mergeLabels(proc.Labels, map[string]string{"interface": parsed.InterfaceID})
+	for name, value := range map[string]*float64{
+		"nsx_edge_interface_rx_bytes_total":   parsed.RxBytes,
+		"nsx_edge_interface_tx_bytes_total":   parsed.TxBytes,
+		"nsx_edge_interface_rx_packets_total": parsed.RxPackets,
+		"nsx_edge_interface_tx_packets_total": parsed.TxPackets,
+		"nsx_edge_interface_rx_dropped_total": parsed.RxDropped,
+		"nsx_edge_interface_tx_dropped_total": parsed.TxDropped,
+	} {
+		if value != nil {
+			proc.totals.Increase(sink, name, labels, *value, 0)
+		}
+	}
+	return nil
+}
+
+// NsxFirewallProcessor reads distributed firewall rule statistics of a security policy
+// (GET /policy/api/v1/infra/domains/{domain}/security-policies/{policy}/statistics)
+// and exports hit, packet, byte and session counts per rule as counters
+type NsxFirewallProcessor struct {
+	Labels map[string]string
+
+	totals metrics.CumulativeConverter
+}
+
+func (proc *NsxFirewallProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	var parsed struct {
+		Results []struct {
+			Statistics struct {
+				Results []struct {
+					InternalRuleID string  `json:"internal_rule_id"`
+					HitCount       float64 `json:"hit_count"`
+					PacketCount    float64 `json:"packet_count"`
+					ByteCount      float64 `json:"byte_count"`
+					SessionCount   float64 `json:"session_count"`
+				} `json:"results"`
+			} `json:"statistics"`
+		} `json:"results"`
+	}
+	// statistics and port responses contain many more fields than we export,
+	// so these processors don't support strict mode
+	if err := DecodeJSON(body, &parsed, false); err != nil {
+		return err
+	}
+
+	for _, result := range parsed.Results {
+		for _, rule := range result.Statistics.Results {
+			labels := mergeLabels(proc.Labels, map[string]string{"rule": rule.InternalRuleID})
+			proc.totals.Increase(sink, "nsx_firewall_rule_hits_total", labels, rule.HitCount, 0)
+			proc.totals.Increase(sink, "nsx_firewall_rule_packets_total", labels, rule.PacketCount, 0)
+			proc.totals.Increase(sink, "nsx_firewall_rule_bytes_total", labels, rule.ByteCount, 0)
+			proc.totals.Increase(sink, "nsx_firewall_rule_sessions_total", labels, rule.SessionCount, 0)
+		}
+	}
+	return nil
+}
+
+// NsxSegmentPortsProcessor counts ports of a segment
+// (GET /policy/api/v1/infra/segments/{segment-id}/ports), the segment is identified
+// by the static labels of the poller
+type NsxSegmentPortsProcessor struct {
+	Labels map[string]string
+}
+
+func (proc *NsxSegmentPortsProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	var parsed struct {
+		ResultCount *float64          `json:"result_count"`
+		Results     []json.RawMessage `json:"results"`
+	}
+	if err := DecodeJSON(body, &parsed, false); err != nil {
+		return err
+	}
+
+	count := float64(len(parsed.Results))
+	if parsed.ResultCount != nil {
+		count = *parsed.ResultCount
+	}
+	sink.SetGauge("nsx_segment_ports", proc.Labels, count)
+	return nil
+}
@@ -0,0 +1,35 @@
+package poller_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller/processortest"
+)
+
+func TestNsxFirewallCountsIncreases(t *testing.T) {
+	proc := &poller.NsxFirewallProcessor{}
+	stats := func(hits string) []byte {
+		return []byte(`{"results":[{"statistics":{"results":[{"internal_rule_id":"1001","hit_count":` + hits + `}]}}]}`)
+	}
+	polls := []struct {
+		hits     string
+		expected string
+	}{
+		// the first poll is the baseline, a lower total is a restarted edge
+		{"500", "+0"},
+		{"520", "+20"},
+		{"7", "+7"},
+	}
+	for _, poll := range polls {
+		rec := &processortest.Recorder{}
+		if err := proc.Process(stats(poll.hits), rec); err != nil {
+			t.Fatal(err)
+		}
+		line := "counter nsx_firewall_rule_hits_total{rule=1001} " + poll.expected + "\n"
+		if out := rec.String(); !strings.Contains(out, line) {
+			t.Fatalf("hit count %s recorded\n%s\nexpected %s", poll.hits, out, line)
+		}
+	}
+}
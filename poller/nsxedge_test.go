@@ -0,0 +1,15 @@
+package poller_test
+
+import (
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller/processortest"
+)
+
+// regenerate with UPDATE_GOLDEN=1 go test ./poller -run NsxEdge
+func TestNsxEdgeGolden(t *testing.T) {
+	processortest.CheckDir(t, "testdata/nsx-edge", func() poller.Processor {
+		return &poller.NsxEdgeProcessor{Labels: map[string]string{"site": "lab"}}
+	})
+}
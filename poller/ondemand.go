@@ -0,0 +1,87 @@
+package poller
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OnDemand polls scrape-triggered pollers when metrics are scraped instead of on a schedule,
+// like the blackbox and SNMP exporters; a poller is only polled again once its values are
+// older than its MaxStaleness, so nothing is polled while nobody scrapes
+type OnDemand struct {
+	lock    sync.Mutex
+	pollers []*onDemandPoller
+}
+
+type onDemandPoller struct {
+	poller *Poller
+	// serializes polls of concurrent scrapes, the later ones find the values fresh
+	lock sync.Mutex
+	last time.Time
+}
+
+func NewOnDemand() *OnDemand {
+	return &OnDemand{}
+}
+
+func (onDemand *OnDemand) add(p *Poller) {
+	onDemand.lock.Lock()
+	defer onDemand.lock.Unlock()
+	onDemand.pollers = append(onDemand.pollers, &onDemandPoller{poller: p})
+}
+
+func (onDemand *OnDemand) remove(p *Poller) {
+	onDemand.lock.Lock()
+	defer onDemand.lock.Unlock()
+	onDemand.pollers = slices.DeleteFunc(onDemand.pollers, func(odp *onDemandPoller) bool { return odp.poller == p })
+}
+
+// polls all pollers with stale values concurrently, waiting at most ON_DEMAND_WAIT_SEC;
+// slower polls complete in the background and are served by the next scrape
+func (onDemand *OnDemand) Refresh() {
+	onDemand.lock.Lock()
+	pollers := slices.Clone(onDemand.pollers)
+	onDemand.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, odp := range pollers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			odp.refresh()
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(ON_DEMAND_WAIT_SEC * time.Second):
+	}
+}
+
+func (odp *onDemandPoller) refresh() {
+	odp.lock.Lock()
+	defer odp.lock.Unlock()
+	if time.Since(odp.last) < odp.poller.MaxStaleness {
+		return
+	}
+	odp.poller.poll()
+	// also after failures, so an unreachable endpoint is not hit by every scrape
+	odp.last = time.Now()
+}
+
+// refreshes stale pollers before serving a scrape; a nil OnDemand serves right away
+func (onDemand *OnDemand) Wrap(handler http.HandlerFunc) http.HandlerFunc {
+	if onDemand == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		onDemand.Refresh()
+		handler(w, r)
+	}
+}
@@ -0,0 +1,239 @@
+package poller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// Pipeline polls in several dependent requests, see config.PipelineConfig
+type Pipeline struct {
+	cfg config.PipelineConfig
+
+	lock sync.Mutex
+	// step index -> values extracted by steps with ReuseFor
+	reused map[int]reusedValues
+}
+
+type reusedValues struct {
+	vars    map[string]string
+	expires time.Time
+}
+
+func NewPipeline(cfg config.PipelineConfig) *Pipeline {
+	return &Pipeline{cfg: cfg, reused: make(map[int]reusedValues)}
+}
+
+// sends the steps and calls process with each response of the last step and the labels of
+// its variables; a step with ForEach multiplies the requests of all following steps.
+// last records the responses of the last step, earlier ones may carry login tokens
+func (pipeline *Pipeline) run(ctx context.Context, p *Poller, last *Response, process func(body []byte, labels map[string]string) error) error {
+	err := pipeline.runSteps(ctx, p, last, process)
+	if errors.Is(err, ErrAuth) {
+		// reused tokens may have been revoked, the next poll logs in again
+		pipeline.lock.Lock()
+		clear(pipeline.reused)
+		pipeline.lock.Unlock()
+	}
+	return err
+}
+
+func (pipeline *Pipeline) runSteps(ctx context.Context, p *Poller, last *Response, process func(body []byte, labels map[string]string) error) error {
+	steps := pipeline.cfg.Steps
+	scopes := []map[string]string{{}}
+	for i, step := range steps {
+		if vars, ok := pipeline.reusable(i); ok {
+			// steps with ReuseFor run before any ForEach, there is a single scope
+			scopes = []map[string]string{withVars(scopes[0], vars)}
+			continue
+		}
+		var next []map[string]string
+		var record *Response
+		if i == len(steps)-1 {
+			record = last
+		}
+		for _, vars := range scopes {
+			body, err := p.fetchStep(ctx, step, vars, record)
+			if err != nil {
+				return fmt.Errorf("step %s: %w", stepName(i, step), err)
+			}
+			children, err := extractScopes(body, step, vars)
+			if err != nil {
+				return fmt.Errorf("step %s: %w", stepName(i, step), err)
+			}
+			if i == len(steps)-1 {
+				if err := process(body, substituteAll(pipeline.cfg.Labels, children[0])); err != nil {
+					return err
+				}
+				continue
+			}
+			next = append(next, children...)
+		}
+		if step.ReuseFor.Duration > 0 && len(next) == 1 {
+			pipeline.remember(i, next[0], step.ReuseFor.Duration)
+		}
+		scopes = next
+	}
+	return nil
+}
+
+func (pipeline *Pipeline) reusable(step int) (map[string]string, bool) {
+	pipeline.lock.Lock()
+	defer pipeline.lock.Unlock()
+	reused, ok := pipeline.reused[step]
+	if !ok || time.Now().After(reused.expires) {
+		return nil, false
+	}
+	return reused.vars, true
+}
+
+func (pipeline *Pipeline) remember(step int, vars map[string]string, ttl time.Duration) {
+	pipeline.lock.Lock()
+	defer pipeline.lock.Unlock()
+	pipeline.reused[step] = reusedValues{vars: vars, expires: time.Now().Add(ttl)}
+}
+
+func stepName(i int, step config.PipelineStep) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return strconv.Itoa(i + 1)
+}
+
+// variables of the requests following a step: one scope with the extracted values,
+// or one per element of the ForEach array
+func extractScopes(body []byte, step config.PipelineStep, vars map[string]string) ([]map[string]string, error) {
+	if len(step.Extract) == 0 && step.ForEach == "" {
+		return []map[string]string{vars}, nil
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	if step.ForEach == "" {
+		extracted, err := extractVars(doc, step.Extract)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]string{withVars(vars, extracted)}, nil
+	}
+	value, _ := lookupField(doc, step.ForEach)
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not an array", ErrDecode, step.ForEach)
+	}
+	scopes := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		extracted, err := extractVars(item, step.Extract)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, withVars(vars, extracted))
+	}
+	return scopes, nil
+}
+
+func extractVars(doc any, paths map[string]string) (map[string]string, error) {
+	vars := make(map[string]string, len(paths))
+	for name, path := range paths {
+		value, ok := lookupField(doc, path)
+		if !ok || value == nil {
+			return nil, fmt.Errorf("%w: field %s is missing", ErrDecode, path)
+		}
+		vars[name] = fieldString(value)
+	}
+	return vars, nil
+}
+
+func withVars(vars, extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(vars)+len(extra))
+	for name, value := range vars {
+		merged[name] = value
+	}
+	for name, value := range extra {
+		merged[name] = value
+	}
+	return merged
+}
+
+// replaces {{name}} with the variable values, passed through escape if not nil;
+// unknown placeholders are kept
+func substitute(template string, vars map[string]string, escape func(string) string) string {
+	if len(vars) == 0 || !strings.Contains(template, "{{") {
+		return template
+	}
+	pairs := make([]string, 0, 2*len(vars))
+	for name, value := range vars {
+		if escape != nil {
+			value = escape(value)
+		}
+		pairs = append(pairs, "{{"+name+"}}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+func substituteAll(templates map[string]string, vars map[string]string) map[string]string {
+	if len(templates) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(templates))
+	for name, template := range templates {
+		values[name] = SanitizeLabelValue(substitute(template, vars, nil))
+	}
+	return values
+}
+
+// GETs or sends the request of a pipeline step, responses are subject to the same
+// status and size checks as the poll itself; last records the response if not nil
+func (p *Poller) fetchStep(ctx context.Context, step config.PipelineStep, vars map[string]string, last *Response) ([]byte, error) {
+	resp, err := p.send(ctx, step, vars)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	last.setResponse(resp)
+	body, err := p.readBody(resp)
+	last.setBody(body, resp)
+	return body, err
+}
+
+// adds the labels of a pipeline response to all its series
+type labelSink struct {
+	next   metrics.MetricSink
+	labels map[string]string
+}
+
+func withLabels(next metrics.MetricSink, labels map[string]string) metrics.MetricSink {
+	if len(labels) == 0 {
+		return next
+	}
+	return &labelSink{next: next, labels: labels}
+}
+
+func (sink *labelSink) IncCounter(name string, labels map[string]string) {
+	sink.next.IncCounter(name, mergeLabels(labels, sink.labels))
+}
+
+func (sink *labelSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.next.AddCounter(name, mergeLabels(labels, sink.labels), delta)
+}
+
+func (sink *labelSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.next.SetGauge(name, mergeLabels(labels, sink.labels), value)
+}
+
+func (sink *labelSink) Observe(name string, labels map[string]string, value float64) {
+	sink.next.Observe(name, mergeLabels(labels, sink.labels), value)
+}
+
+func (sink *labelSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.next.ObserveSummary(name, mergeLabels(labels, sink.labels), value)
+}
@@ -1,96 +1,510 @@
 package poller
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/annotations"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/chaos"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/quota"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/tracing"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 )
 
-// Simple poller that GETs a URL expecting JSON like {"value": 123.4}
-// and sets a gauge metric in the MetricHub.
+// Simple poller that GETs a URL and hands the response body
+// to a Processor which sets metrics in the MetricHub.
 
 type Poller struct {
-	URL        string
-	MetricName string
-	Labels     map[string]string
-	Interval   time.Duration
-	Hub        *metrics.MetricHub
-	Client     *http.Client
+	Name      string
+	URL       string
+	Interval  time.Duration
+	Hub       *metrics.MetricHub
+	Client    *http.Client
+	Processor Processor
+
+	// extra request headers, URL and header values may contain ${scheme:key}
+	// secret placeholders expanded by Secrets before each request
+	Headers map[string]string
+	Secrets *secrets.Resolver
+	// polls with a JSON body, e.g. GraphQL queries, are sent as POST; may contain secret placeholders
+	Body string
+
+	// optional, limits series this poller may create per minute
+	Quota *quota.SeriesQuota
+
+	// optional, requests rejected with 401 are retried once with fresh credentials
+	Auth Authenticator
+	// optional, responses without a valid HMAC signature are rejected
+	Signature *auth.Verifier
+
+	// responses larger than this are rejected without being processed
+	MaxBodyBytes int64
+
+	// number of consecutive failed polls during which the last successfully
+	// processed gauges are re-emitted and POLLER_STALE_METRIC is set, 0 disables
+	StaleIntervals int
+
+	// delay of the first scheduled poll, see StaggerOffset
+	Offset time.Duration
+	// poll once right at Start instead of waiting for the first tick
+	ImmediateFirstPoll bool
+	// optional, polls at the times matching the schedule, Interval and Offset are then unused
+	Cron *Cron
+
+	// skip gauge writes whose value did not change since the previous poll
+	SkipUnchanged bool
+
+	// optional, skips polls while the endpoint keeps failing
+	Breaker *Breaker
+	// optional, reports fields missing from or changing type in responses
+	Schema *SchemaTracker
+	// optional, request budgets shared with the other pollers of the same host
+	HostLimits *HostLimits
+	// optional, varies the time between polls with how often values change, Interval is then unused
+	Adaptive *Adaptive
+	// optional, maintenance windows covering this poller, see Maintenance.For
+	Maintenance *Maintenance
+	// optional, records the times the breaker is open as annotation regions
+	Annotations *annotations.Store
+	// optional, polls when metrics are scraped and the values of the previous poll are older
+	// than MaxStaleness instead of on a schedule
+	OnDemand     *OnDemand
+	MaxStaleness time.Duration
+	// optional, waits for the first poll before scrapes are served
+	Warmup *Warmup
+	// optional, keeps the last response for debugging
+	Recorder *Recorder
+	// optional, what counts as a successful poll beyond a 2xx status
+	Success *SuccessCriteria
+	// optional, polls in several dependent requests instead of a single GET of URL
+	Pipeline *Pipeline
+	// optional, label -> resolver replacing the IDs in its values by names
+	ResolveLabels map[string]*NameResolver
+	// optional, fails polls on purpose in test deployments
+	Chaos *chaos.Injector
+
+	lastGauges []gaugeSample
+	failures   int
+	// gauge values of the previous successful poll and polls since all values were written, for SkipUnchanged
+	lastValues        map[string]float64
+	pollsSinceRefresh int
+	// active maintenance window at the previous poll, for logging
+	maintenance string
+
+	// closed by Stop, once
+	done     chan struct{}
+	stopOnce sync.Once
+	// set by Retire, the series are deleted once polling stopped
+	retiring atomic.Bool
 }
 
+// creates a poller expecting JSON like {"value": 123.4} and setting a single gauge
 func NewPoller(url, metric string, labels map[string]string, interval time.Duration, hub *metrics.MetricHub) *Poller {
 	return &Poller{
-		URL:        url,
-		MetricName: metric,
-		Labels:     labels,
-		Interval:   interval,
-		Hub:        hub,
+		Name:     metric,
+		URL:      url,
+		Interval: interval,
+		Hub:      hub,
 		Client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		Processor: &ValueProcessor{
+			MetricName: metric,
+			Labels:     labels,
+		},
+		MaxBodyBytes: DEFAULT_MAX_BODY_BYTES,
 	}
 }
 
 func (p *Poller) Start() {
-	go func() {
-		t := time.NewTicker(p.Interval)
-		defer t.Stop()
-		for range t.C {
-			if err := p.pollOnce(); err != nil {
-				fmt.Printf("Poller error (%s): %v\n", p.URL, err)
+	done := make(chan struct{})
+	p.done = done
+	if p.OnDemand != nil {
+		p.OnDemand.add(p)
+		return
+	}
+	p.Warmup.add(p, p.Name)
+	// the loops return on Stop after a running poll finished, nothing writes the series afterwards
+	run := func(loop func()) {
+		go func() {
+			loop()
+			if p.retiring.Load() {
+				p.retire()
 			}
+		}()
+	}
+	if p.Cron != nil {
+		run(func() { runCron(p.Cron, p.ImmediateFirstPoll, done, p.poll) })
+		return
+	}
+	if p.Adaptive != nil {
+		p.Hub.SetGauge(POLLER_INTERVAL_METRIC, map[string]string{"poller": p.Name}, p.Adaptive.Interval().Seconds())
+		run(func() { runAdaptive(p.Adaptive.Interval, p.Offset, p.ImmediateFirstPoll, done, p.poll) })
+		return
+	}
+	run(func() { runSchedule(p.Interval, p.Offset, p.ImmediateFirstPoll, done, p.poll) })
+}
+
+// stops polling, safe to call more than once
+func (p *Poller) Stop() {
+	p.stopOnce.Do(func() {
+		if p.OnDemand != nil {
+			p.OnDemand.remove(p)
+		}
+		p.Warmup.done(p)
+		p.Recorder.forget(p.Name)
+		if p.done != nil {
+			close(p.done)
+		}
+	})
+}
+
+// stops polling and removes the series of the poller once a running poll finished,
+// e.g. when a discovered entity was removed from inventory
+func (p *Poller) Retire() {
+	p.retiring.Store(true)
+	p.Stop()
+	if p.OnDemand != nil {
+		// no polling loop to wait for
+		p.retire()
+	}
+}
+
+// deletes the gauges of the last successful poll and the poller's own series,
+// as recorded by the sinks after units and interceptors
+func (p *Poller) retire() {
+	for _, g := range p.lastGauges {
+		p.Hub.RetireSeries("gauge", g.name, g.labels)
+	}
+	p.lastGauges = nil
+	labels := map[string]string{"poller": p.Name}
+	for _, name := range []string{POLLER_STALE_METRIC, POLLER_FAILED_METRIC, POLLER_INTERVAL_METRIC, POLLER_MAINTENANCE_METRIC, POLLER_BREAKER_METRIC, POLLER_SCHEMA_DRIFT_METRIC} {
+		p.Hub.RetireSeries("gauge", name, labels)
+	}
+}
+
+// runs one poll cycle and handles failures
+func (p *Poller) poll() {
+	defer p.Warmup.done(p)
+	suppress := p.checkMaintenance()
+	if !p.Breaker.Allow(time.Now()) {
+		return
+	}
+	ctx := logger.WithRequestID(context.Background(), "poll-"+logger.NewID())
+	ctx, span := tracing.Start(ctx, "poll", attribute.String("poller", p.Name))
+	defer span.End()
+
+	err := p.pollOnce(ctx)
+	if err == nil {
+		p.failures = 0
+		p.Hub.SetGauge(POLLER_FAILED_METRIC, map[string]string{"poller": p.Name}, 0)
+		if p.StaleIntervals > 0 {
+			p.Hub.SetGauge(POLLER_STALE_METRIC, map[string]string{"poller": p.Name}, 0)
+		}
+		if p.Breaker.Success() {
+			logger.InfoCtx(ctx, fmt.Sprintf("Poller %s recovered, circuit closed", p.Name))
+			p.Annotations.Finish("breaker/" + p.Name)
+			p.alert(ctx, suppress, breakerClosed, nil)
+		}
+		p.publishBreaker()
+		return
+	}
+
+	logger.WarnCtx(ctx, fmt.Sprintf("Poller %s failed: %v", p.Name, err))
+	tracing.Fail(span, err)
+	p.Hub.IncCounter(POLLER_ERRORS_METRIC, map[string]string{"poller": p.Name, "category": ErrorCategory(err)})
+	p.Hub.SetGauge(POLLER_FAILED_METRIC, map[string]string{"poller": p.Name}, 1)
+	p.failures++
+	if p.StaleIntervals > 0 {
+		p.reemitCached()
+	}
+	if p.Breaker.Failure(time.Now()) {
+		logger.ErrorCtx(ctx, fmt.Sprintf("Poller %s failed %d times in a row, skipping polls for %v", p.Name, p.failures, p.Breaker.cfg.Cooldown.Duration))
+		p.Annotations.Begin(annotations.SOURCE_BREAKER, "breaker/"+p.Name, fmt.Sprintf("Poller %s circuit open: %v", p.Name, err),
+			[]string{"breaker", p.Name})
+		p.alert(ctx, suppress, breakerOpen, err)
+	}
+	p.publishBreaker()
+}
+
+// sends a breaker alert unless a maintenance window suppresses it
+func (p *Poller) alert(ctx context.Context, suppress bool, state string, err error) {
+	if suppress && p.Breaker.cfg.AlertURL != "" {
+		logger.InfoCtx(ctx, fmt.Sprintf("Suppressed %s breaker alert of poller %s during maintenance window %s", state, p.Name, p.maintenance))
+		return
+	}
+	if !suppress {
+		p.Breaker.alert(p.Name, state, p.failures, err)
+	}
+}
+
+// flags the poller while a maintenance window covers it, returns whether alerts are suppressed
+func (p *Poller) checkMaintenance() bool {
+	if p.Maintenance == nil {
+		return false
+	}
+	window, suppress := p.Maintenance.Active(time.Now())
+	if window != p.maintenance {
+		if window != "" {
+			logger.Info(fmt.Sprintf("Poller %s is in maintenance window %s", p.Name, window))
+		} else {
+			logger.Info(fmt.Sprintf("Poller %s left maintenance window %s", p.Name, p.maintenance))
+		}
+		p.maintenance = window
+	}
+	value := 0.0
+	if window != "" {
+		value = 1
+	}
+	p.Hub.SetGauge(POLLER_MAINTENANCE_METRIC, map[string]string{"poller": p.Name}, value)
+	return suppress
+}
+
+func (p *Poller) publishBreaker() {
+	if p.Breaker != nil {
+		p.Hub.SetGauge(POLLER_BREAKER_METRIC, map[string]string{"poller": p.Name}, p.Breaker.Value())
+	}
+}
+
+func (p *Poller) pollOnce(ctx context.Context) (err error) {
+	// sink set below, created here for the gauges of the recorded response
+	rec := &recordingSink{}
+	last := p.Recorder.start()
+	if last != nil {
+		defer func() { p.Recorder.record(p.Name, last, err, rec.gauges) }()
+	}
+	// injected failures look like an unreachable endpoint
+	if err := p.Chaos.PollError(p.Name); err != nil {
+		return fmt.Errorf("%w: %w", ErrNetwork, err)
+	}
+
+	sink := p.Hub.WithContext(ctx)
+	if p.Quota != nil {
+		sink = &quota.Sink{Next: sink, Quota: p.Quota, Source: "poller:" + p.Name}
+	}
+	var diff *diffSink
+	if p.SkipUnchanged {
+		diff = newDiffSink(sink, p.lastValues, p.pollsSinceRefresh >= DEFAULT_DIFF_REFRESH_POLLS)
+		sink = diff
+	}
+	rec.next = sink
+	// names replace IDs before anything is recorded, re-emitted stale values keep them
+	out := withResolvedLabels(ctx, rec, p.ResolveLabels)
+
+	if p.Pipeline != nil {
+		err = p.Pipeline.run(ctx, p, last, func(body []byte, labels map[string]string) error {
+			return p.process(ctx, body, withLabels(out, labels))
+		})
+	} else {
+		err = p.pollResponse(ctx, last, out)
+	}
+	if err != nil {
+		return err
+	}
+	p.lastGauges = rec.gauges
+	logger.DebugCtx(ctx, fmt.Sprintf("Poller %s processed the response into %d gauges", p.Name, len(rec.gauges)))
+	if p.Adaptive != nil && p.Adaptive.observe(rec.gauges, rec.counted) {
+		logger.InfoCtx(ctx, fmt.Sprintf("Poller %s now polls every %v", p.Name, p.Adaptive.Interval()))
+		p.Hub.SetGauge(POLLER_INTERVAL_METRIC, map[string]string{"poller": p.Name}, p.Adaptive.Interval().Seconds())
+	}
+	if diff != nil {
+		p.lastValues = diff.current
+		p.pollsSinceRefresh++
+		if diff.force {
+			p.pollsSinceRefresh = 0
 		}
-	}()
+	}
+	return nil
 }
 
-func (p *Poller) pollOnce() error {
-	resp, err := p.Client.Get(p.URL)
+// requests the poller URL and processes the response into sink
+func (p *Poller) pollResponse(ctx context.Context, last *Response, sink metrics.MetricSink) error {
+	resp, err := p.do(ctx, "")
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("status %d", resp.StatusCode)
+	last.setResponse(resp)
+	// before the status check, an expiring certificate matters most when polls fail
+	if expiry, ok := util.EarliestCertExpiry(resp.TLS); ok {
+		p.Hub.SetGauge(POLLER_CERT_EXPIRY_METRIC, map[string]string{"poller": p.Name, "host": resp.Request.URL.Host}, float64(expiry.Unix()))
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := p.readBody(resp)
+	last.setBody(body, resp)
 	if err != nil {
 		return err
 	}
+	logger.DebugCtx(ctx, fmt.Sprintf("Poller %s got %s with %d bytes from %s%s", p.Name, resp.Status, len(body), resp.Request.URL.Host, resp.Request.URL.Path))
+	return p.process(ctx, body, sink)
+}
 
-	// Expect either: {"value": number} or {"value": "123.4"} or a raw number
-	var parsed map[string]interface{}
-	if err := json.Unmarshal(body, &parsed); err != nil {
-		// If not object, try parse as plain number
-		var val float64
-		if err2 := json.Unmarshal(body, &val); err2 == nil {
-			p.Hub.SetGauge(p.MetricName, p.Labels, val)
-			return nil
-		}
+// checks the success criteria and schema of a response and hands it to the processor
+func (p *Poller) process(ctx context.Context, body []byte, sink metrics.MetricSink) error {
+	if err := p.Success.check(body); err != nil {
 		return err
 	}
-	v, ok := parsed["value"]
-	if !ok {
-		return fmt.Errorf("no 'value' in response")
-	}
-	switch t := v.(type) {
-	case float64:
-		p.Hub.SetGauge(p.MetricName, p.Labels, t)
-	case int:
-		p.Hub.SetGauge(p.MetricName, p.Labels, float64(t))
-	case string:
-		// try parse numeric string
-		var x float64
-		if err := json.Unmarshal([]byte("\""+t+"\""), &x); err == nil {
-			p.Hub.SetGauge(p.MetricName, p.Labels, x)
-		} else {
-			return fmt.Errorf("value is string and not numeric: %v", t)
+	// before processing, so drift also shows when it makes the processor fail
+	p.checkSchema(ctx, body)
+	if fetching, ok := p.Processor.(FetchingProcessor); ok {
+		if err := fetching.ProcessFetching(ctx, body, sink, p.fetch); err != nil {
+			// failed detail requests keep their category
+			if ErrorCategory(err) != "other" {
+				return err
+			}
+			return fmt.Errorf("%w: %w", ErrDecode, err)
 		}
-	default:
-		return fmt.Errorf("unsupported value type %T", v)
+	} else if err := p.Processor.Process(body, sink); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return nil
+}
+
+// polls once into sink instead of the hub, for probes returning the metrics of a single scrape;
+// quota, caches and other state of scheduled polls are left alone
+func (p *Poller) Probe(ctx context.Context, sink metrics.MetricSink) error {
+	if err := p.Chaos.PollError(p.Name); err != nil {
+		return fmt.Errorf("%w: %w", ErrNetwork, err)
+	}
+	sink = withResolvedLabels(ctx, sink, p.ResolveLabels)
+	if p.Pipeline != nil {
+		return p.Pipeline.run(ctx, p, nil, func(body []byte, labels map[string]string) error {
+			return p.probeBody(ctx, body, withLabels(sink, labels))
+		})
+	}
+	resp, err := p.do(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := p.readBody(resp)
+	if err != nil {
+		return err
+	}
+	return p.probeBody(ctx, body, sink)
+}
+
+// like process, without schema tracking
+func (p *Poller) probeBody(ctx context.Context, body []byte, sink metrics.MetricSink) error {
+	if err := p.Success.check(body); err != nil {
+		return err
+	}
+	if fetching, ok := p.Processor.(FetchingProcessor); ok {
+		return fetching.ProcessFetching(ctx, body, sink, p.fetch)
+	}
+	if err := p.Processor.Process(body, sink); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecode, err)
 	}
 	return nil
 }
+
+// sends a GET request to ref or the poll request to the poller URL, see newRequest
+func (p *Poller) do(ctx context.Context, ref string) (*http.Response, error) {
+	if ref == "" && p.Body != "" {
+		return p.send(ctx, config.PipelineStep{Method: http.MethodPost, Body: p.Body}, nil)
+	}
+	return p.send(ctx, config.PipelineStep{URL: ref}, nil)
+}
+
+// sends the request of a pipeline step, see newRequest,
+// retrying once with renewed credentials if they were rejected
+func (p *Poller) send(ctx context.Context, step config.PipelineStep, vars map[string]string) (*http.Response, error) {
+	ctx = httptrace.WithClientTrace(ctx, p.connTrace())
+	for attempt := 0; ; attempt++ {
+		req, err := p.newRequest(ctx, step, vars)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.HostLimits.Wait(ctx, req.URL.Hostname()); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+		if p.Auth != nil {
+			if err := p.Auth.Authenticate(req); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrAuth, err)
+			}
+		}
+		resp, err := p.Client.Do(req)
+		if err != nil {
+			return nil, requestError(err)
+		}
+		p.countProtocol(resp)
+		if resp.StatusCode != http.StatusUnauthorized || p.Auth == nil || attempt > 0 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		p.Auth.Invalidate()
+	}
+}
+
+// builds the request, expanding secret placeholders in URL, headers and body
+// a non-empty step URL is requested instead of the poller URL, relative URLs are resolved against it;
+// plain polls are steps with just a URL, pipeline steps may also use {{name}} variables of
+// earlier responses, substituted after the secrets so responses can't inject placeholders
+// the trace context is propagated to the polled endpoint
+func (p *Poller) newRequest(ctx context.Context, step config.PipelineStep, vars map[string]string) (*http.Request, error) {
+	expand := func(template string) (string, error) {
+		if p.Secrets == nil {
+			return template, nil
+		}
+		return p.Secrets.Expand(template)
+	}
+
+	target, err := expand(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand url: %w", err)
+	}
+	if step.URL != "" {
+		ref, err := expand(step.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand url: %w", err)
+		}
+		if target, err = resolveURL(target, substitute(ref, vars, url.PathEscape)); err != nil {
+			return nil, err
+		}
+	}
+	var body io.Reader
+	if step.Body != "" {
+		expanded, err := expand(step.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand body: %w", err)
+		}
+		body = strings.NewReader(substitute(expanded, vars, nil))
+	}
+	method := step.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, headers := range []map[string]string{p.Headers, step.Headers} {
+		for name, template := range headers {
+			value, err := expand(template)
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand header %s: %w", name, err)
+			}
+			req.Header.Set(name, substitute(value, vars, nil))
+		}
+	}
+	return req, nil
+}
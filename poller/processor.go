@@ -0,0 +1,66 @@
+package poller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// Processor turns a polled response body into metric updates on the sink
+type Processor interface {
+	Process(body []byte, sink metrics.MetricSink) error
+}
+
+// decodes JSON body into v, in strict mode unknown fields are rejected
+// so schema changes or unexpected payloads (error envelopes, login pages) surface as errors
+func DecodeJSON(body []byte, v any, strict bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// ValueProcessor expects JSON like {"value": 123.4}, {"value": "123.4"} or a raw number
+// and sets a single gauge
+type ValueProcessor struct {
+	MetricName string
+	Labels     map[string]string
+	Strict     bool
+}
+
+func (proc *ValueProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	// plain number response
+	var val float64
+	if err := json.Unmarshal(body, &val); err == nil {
+		sink.SetGauge(proc.MetricName, proc.Labels, val)
+		return nil
+	}
+
+	var parsed struct {
+		Value any `json:"value"`
+	}
+	if err := DecodeJSON(body, &parsed, proc.Strict); err != nil {
+		return err
+	}
+
+	switch t := parsed.Value.(type) {
+	case nil:
+		return fmt.Errorf("no 'value' in response")
+	case float64:
+		sink.SetGauge(proc.MetricName, proc.Labels, t)
+	case string:
+		// try parse numeric string
+		x, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return fmt.Errorf("value is string and not numeric: %v", t)
+		}
+		sink.SetGauge(proc.MetricName, proc.Labels, x)
+	default:
+		return fmt.Errorf("unsupported value type %T", t)
+	}
+	return nil
+}
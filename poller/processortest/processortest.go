@@ -0,0 +1,174 @@
+// Package processortest checks processors against golden files: a response body in,
+// the metric updates it must produce out, one per line, e.g.
+//
+//	gauge nsx_edge_cpu_cores{edge=edge01|site=lab} 8
+//	counter deployments_total{result=failed} +1
+//
+// It imports testing and is meant for tests only, the collector does not link it.
+package processortest
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// inputs are "<case>.json", expected updates "<case>.golden" next to them
+const inputSuffix = ".json"
+const goldenSuffix = ".golden"
+
+// set to 1 to rewrite golden files with the current output instead of comparing
+const updateEnv = "UPDATE_GOLDEN"
+
+// Recorder is a metrics.MetricSink keeping every update as a line of the golden format
+type Recorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (rec *Recorder) IncCounter(name string, labels map[string]string) {
+	rec.add("counter", name, labels, "+1")
+}
+
+func (rec *Recorder) AddCounter(name string, labels map[string]string, delta float64) {
+	rec.add("counter", name, labels, "+"+formatValue(delta))
+}
+
+func (rec *Recorder) SetGauge(name string, labels map[string]string, value float64) {
+	rec.add("gauge", name, labels, formatValue(value))
+}
+
+func (rec *Recorder) Observe(name string, labels map[string]string, value float64) {
+	rec.add("histogram", name, labels, formatValue(value))
+}
+
+func (rec *Recorder) ObserveSummary(name string, labels map[string]string, value float64) {
+	rec.add("summary", name, labels, formatValue(value))
+}
+
+func (rec *Recorder) add(kind, name string, labels map[string]string, value string) {
+	line := fmt.Sprintf("%s %s{%s} %s", kind, name, util.JoinMapEntries(labels), value)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.lines = append(rec.lines, line)
+}
+
+// recorded updates sorted, so processors iterating maps give stable output
+func (rec *Recorder) String() string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	lines := append([]string(nil), rec.lines...)
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// processes body and returns the updates in golden format, processing errors are returned
+// as a final "error: ..." line so failing inputs can be golden files too
+func Run(proc poller.Processor, body []byte) string {
+	rec := &Recorder{}
+	err := proc.Process(body, rec)
+	out := rec.String()
+	if err != nil {
+		out += "error: " + err.Error() + "\n"
+	}
+	return out
+}
+
+// fails with the first differing line unless body produces the expected updates
+func Check(proc poller.Processor, body []byte, expected string) error {
+	actual := Run(proc, body)
+	if actual == expected {
+		return nil
+	}
+	actualLines := strings.Split(actual, "\n")
+	expectedLines := strings.Split(expected, "\n")
+	for i := 0; i < max(len(actualLines), len(expectedLines)); i++ {
+		var got, want string
+		if i < len(actualLines) {
+			got = actualLines[i]
+		}
+		if i < len(expectedLines) {
+			want = expectedLines[i]
+		}
+		if got != want {
+			return fmt.Errorf("line %d: got %q, want %q", i+1, got, want)
+		}
+	}
+	return nil
+}
+
+// checks every case in the root of fsys, e.g. an embedded testdata directory;
+// newProcessor is called per case so processors keeping state between polls start fresh
+func CheckFS(fsys fs.FS, newProcessor func() poller.Processor) error {
+	inputs, err := fs.Glob(fsys, "*"+inputSuffix)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no %s files", inputSuffix)
+	}
+	for _, input := range inputs {
+		body, err := fs.ReadFile(fsys, input)
+		if err != nil {
+			return err
+		}
+		expected, err := fs.ReadFile(fsys, strings.TrimSuffix(input, inputSuffix)+goldenSuffix)
+		if err != nil {
+			return err
+		}
+		if err := Check(newProcessor(), body, string(expected)); err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+	}
+	return nil
+}
+
+// checks every case in dir, usually testdata/<processor> next to the test;
+// with UPDATE_GOLDEN=1 the golden files are written instead
+//
+//	func TestNsxEdgeGolden(t *testing.T) {
+//		processortest.CheckDir(t, "testdata/nsx-edge", func() poller.Processor { return &poller.NsxEdgeProcessor{} })
+//	}
+func CheckDir(t testing.TB, dir string, newProcessor func() poller.Processor) {
+	t.Helper()
+	if err := checkDir(dir, newProcessor); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkDir(dir string, newProcessor func() poller.Processor) error {
+	if os.Getenv(updateEnv) != "1" {
+		return CheckFS(os.DirFS(dir), newProcessor)
+	}
+	inputs, err := filepath.Glob(filepath.Join(dir, "*"+inputSuffix))
+	if err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		body, err := os.ReadFile(input)
+		if err != nil {
+			return err
+		}
+		golden := strings.TrimSuffix(input, inputSuffix) + goldenSuffix
+		if err := os.WriteFile(golden, []byte(Run(newProcessor(), body)), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
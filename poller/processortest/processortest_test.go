@@ -0,0 +1,105 @@
+package processortest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+)
+
+// a processor writing fixed updates, failing for bodies saying "fail"
+type fakeProcessor struct{}
+
+func (fakeProcessor) Process(body []byte, sink metrics.MetricSink) error {
+	sink.SetGauge("vm_count", map[string]string{"site": "lab", "cluster": "a"}, 12)
+	sink.IncCounter("polls_total", nil)
+	if string(body) == "fail" {
+		return errors.New("no clusters")
+	}
+	return nil
+}
+
+func newFake() poller.Processor {
+	return fakeProcessor{}
+}
+
+func TestRecorderFormat(t *testing.T) {
+	rec := &Recorder{}
+	rec.SetGauge("vm_count", map[string]string{"site": "lab", "cluster": "a"}, 12)
+	rec.AddCounter("bytes_total", nil, 1.5)
+	rec.IncCounter("polls_total", map[string]string{"result": "ok"})
+	rec.Observe("latency_seconds", nil, 0.25)
+	rec.ObserveSummary("size_bytes", nil, 1e21)
+
+	expected := strings.Join([]string{
+		"counter bytes_total{} +1.5",
+		"counter polls_total{result=ok} +1",
+		"gauge vm_count{cluster=a|site=lab} 12",
+		"histogram latency_seconds{} 0.25",
+		"summary size_bytes{} 1e+21",
+	}, "\n") + "\n"
+	if actual := rec.String(); actual != expected {
+		t.Fatalf("recorded\n%s\nexpected\n%s", actual, expected)
+	}
+	if (&Recorder{}).String() != "" {
+		t.Fatal("empty recorder is not empty")
+	}
+}
+
+func TestRunAppendsError(t *testing.T) {
+	out := Run(fakeProcessor{}, []byte("fail"))
+	if !strings.HasSuffix(out, "error: no clusters\n") {
+		t.Fatalf("output does not end with the error line:\n%s", out)
+	}
+}
+
+func TestCheckReportsFirstDifferentLine(t *testing.T) {
+	golden := Run(fakeProcessor{}, nil)
+	if err := Check(fakeProcessor{}, nil, golden); err != nil {
+		t.Fatalf("matching output failed: %v", err)
+	}
+
+	changed := strings.Replace(golden, "12", "13", 1)
+	err := Check(fakeProcessor{}, nil, changed)
+	if err == nil || !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), "vm_count{cluster=a|site=lab} 13") {
+		t.Fatalf("changed value reported as %v, expected a difference in line 2", err)
+	}
+
+	// missing and additional lines are differences too
+	if err := Check(fakeProcessor{}, nil, golden+"gauge extra{} 1\n"); err == nil {
+		t.Fatal("missing line was not reported")
+	}
+	if err := Check(fakeProcessor{}, []byte("fail"), golden); err == nil {
+		t.Fatal("additional error line was not reported")
+	}
+}
+
+func TestCheckFS(t *testing.T) {
+	golden := Run(fakeProcessor{}, []byte("{}"))
+	fsys := fstest.MapFS{
+		"ok.json":     {Data: []byte("{}")},
+		"ok.golden":   {Data: []byte(golden)},
+		"fail.json":   {Data: []byte("fail")},
+		"fail.golden": {Data: []byte(Run(fakeProcessor{}, []byte("fail")))},
+	}
+	if err := CheckFS(fsys, newFake); err != nil {
+		t.Fatal(err)
+	}
+
+	failGolden := fsys["fail.golden"]
+	fsys["fail.golden"] = &fstest.MapFile{Data: []byte(golden)}
+	if err := CheckFS(fsys, newFake); err == nil || !strings.HasPrefix(err.Error(), "fail.json: ") {
+		t.Fatalf("outdated golden file reported as %v", err)
+	}
+	fsys["fail.golden"] = failGolden
+	delete(fsys, "ok.golden")
+	if err := CheckFS(fsys, newFake); err == nil {
+		t.Fatal("missing golden file was not reported")
+	}
+	if err := CheckFS(fstest.MapFS{}, newFake); err == nil {
+		t.Fatal("directory without cases was not reported")
+	}
+}
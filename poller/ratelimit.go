@@ -0,0 +1,122 @@
+package poller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// RateLimiter is a token bucket allowing perSecond calls on average and bursts of up to burst calls;
+// nil never waits
+type RateLimiter struct {
+	perSecond float64
+	burst     float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{perSecond: perSecond, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// blocks until a call may be made or ctx is done
+func (limiter *RateLimiter) Wait(ctx context.Context) error {
+	if limiter == nil {
+		return nil
+	}
+	for {
+		delay := limiter.reserve(time.Now())
+		if delay == 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// takes a token if one is available, otherwise returns the time until the next one
+func (limiter *RateLimiter) reserve(now time.Time) time.Duration {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.tokens = min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.perSecond)
+	limiter.last = now
+	if limiter.tokens >= 1 {
+		limiter.tokens--
+		return 0
+	}
+	return time.Duration((1 - limiter.tokens) / limiter.perSecond * float64(time.Second))
+}
+
+// HostLimits hands out one RateLimiter per target host, so all pollers of a host
+// share its request budget; nil never waits
+type HostLimits struct {
+	cfg config.HostRateLimitConfig
+	// receives HOST_RATE_LIMIT_WAIT_METRIC
+	sink metrics.MetricSink
+
+	mu       sync.Mutex
+	limiters map[string]*RateLimiter
+}
+
+// nil if no budget is configured
+func NewHostLimits(cfg config.HostRateLimitConfig, sink metrics.MetricSink) *HostLimits {
+	if cfg.RequestsPerSecond == 0 && len(cfg.Hosts) == 0 {
+		return nil
+	}
+	hosts := make(map[string]config.RateLimit, len(cfg.Hosts))
+	for host, limit := range cfg.Hosts {
+		hosts[strings.ToLower(host)] = limit
+	}
+	cfg.Hosts = hosts
+	return &HostLimits{cfg: cfg, sink: sink, limiters: make(map[string]*RateLimiter)}
+}
+
+// blocks until a request to host fits its budget or ctx is done
+func (limits *HostLimits) Wait(ctx context.Context, host string) error {
+	if limits == nil {
+		return nil
+	}
+	host = strings.ToLower(host)
+	limiter := limits.limiterFor(host)
+	if limiter == nil {
+		return nil
+	}
+	start := time.Now()
+	err := limiter.Wait(ctx)
+	if waited := time.Since(start); waited >= time.Millisecond {
+		limits.sink.AddCounter(HOST_RATE_LIMIT_WAIT_METRIC, map[string]string{"host": host}, waited.Seconds())
+	}
+	return err
+}
+
+func (limits *HostLimits) limiterFor(host string) *RateLimiter {
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	if limiter, ok := limits.limiters[host]; ok {
+		return limiter
+	}
+	limit, ok := limits.cfg.Hosts[host]
+	if !ok {
+		limit = config.RateLimit{RequestsPerSecond: limits.cfg.RequestsPerSecond, Burst: limits.cfg.Burst}
+	}
+	var limiter *RateLimiter
+	if limit.RequestsPerSecond > 0 {
+		limiter = NewRateLimiter(limit.RequestsPerSecond, limit.Burst)
+	}
+	limits.limiters[host] = limiter
+	return limiter
+}
@@ -0,0 +1,83 @@
+package poller
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// creates a processor from its poller config entry
+type ProcessorFactory func(pc config.PollerConfig) Processor
+
+var (
+	registryLock sync.RWMutex
+	processors   = map[string]ProcessorFactory{
+		"value": func(pc config.PollerConfig) Processor {
+			return &ValueProcessor{MetricName: pc.Metric, Labels: pc.Labels, Strict: pc.Strict}
+		},
+		"nsx-edge": func(pc config.PollerConfig) Processor {
+			return &NsxEdgeProcessor{Labels: pc.Labels, Strict: pc.Strict}
+		},
+		"nsx-edge-interface": func(pc config.PollerConfig) Processor {
+			return &NsxEdgeInterfaceProcessor{Labels: pc.Labels, Strict: pc.Strict}
+		},
+		"nsx-firewall": func(pc config.PollerConfig) Processor {
+			return &NsxFirewallProcessor{Labels: pc.Labels}
+		},
+		"nsx-segment-ports": func(pc config.PollerConfig) Processor {
+			return &NsxSegmentPortsProcessor{Labels: pc.Labels}
+		},
+		"metrics-json": func(pc config.PollerConfig) Processor {
+			return &MetricsJSONProcessor{Labels: pc.Labels, Strict: pc.Strict}
+		},
+		"prometheus-text": func(pc config.PollerConfig) Processor {
+			return &PrometheusTextProcessor{Labels: pc.Labels}
+		},
+		"graphql": func(pc config.PollerConfig) Processor {
+			proc := &GraphQLProcessor{Labels: pc.Labels}
+			if pc.GraphQL != nil {
+				proc.Metrics = pc.GraphQL.Metrics
+			}
+			return proc
+		},
+	}
+)
+
+// makes a processor available to pollers by name (the "processor" config key)
+func RegisterProcessor(name string, factory ProcessorFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	processors[name] = factory
+}
+
+// creates the processor configured for a poller, "graphql" for GraphQL pollers and "value" for others if none is set
+func NewProcessor(pc config.PollerConfig) (Processor, error) {
+	name := pc.Processor
+	if name == "" && pc.GraphQL != nil {
+		name = "graphql"
+	}
+	if name == "" {
+		name = "value"
+	}
+
+	registryLock.RLock()
+	factory, ok := processors[name]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown processor %q", name)
+	}
+	return factory(pc), nil
+}
+
+// copies static labels from config and adds per-series labels
+func mergeLabels(static map[string]string, extra map[string]string) map[string]string {
+	labels := make(map[string]string, len(static)+len(extra))
+	for k, v := range static {
+		labels[k] = v
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
@@ -0,0 +1,341 @@
+package poller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+)
+
+type cachedName struct {
+	name    string
+	expires time.Time
+}
+
+// NameResolver looks up the names of opaque IDs via a secondary API, one request per ID or
+// a list of all objects, and caches them for TTL; shared by all pollers resolving the same
+// kind of ID. IDs that cannot be resolved stay as they are, names that cannot be refreshed
+// are kept until the lookup succeeds again; names of IDs no longer polled are dropped once
+// expired for another TTL
+type NameResolver struct {
+	cfg    config.NameResolverConfig
+	Client *http.Client
+	// optional, attaches credentials to lookups, e.g. a vCenter session
+	Auth    Authenticator
+	Secrets *secrets.Resolver
+	sink    metrics.MetricSink
+
+	lock sync.Mutex
+	// id -> name, the id itself for IDs that could not be resolved
+	names map[string]cachedName
+	// lists: time of the last fetch, unknown IDs fetch again after RetryAfter
+	listFetched time.Time
+	lastSweep   time.Time
+	// id, or "" for the list, -> closed when its running lookup is done; concurrent polls
+	// missing the same ID fetch it once, lookups of other IDs run in parallel
+	inflight map[string]chan struct{}
+}
+
+func NewNameResolver(cfg config.NameResolverConfig, sink metrics.MetricSink) *NameResolver {
+	timeout := cfg.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DEFAULT_NAME_RESOLVER_TIMEOUT_SEC * time.Second
+	}
+	if cfg.RetryAfter.Duration <= 0 {
+		cfg.RetryAfter = cfg.TTL
+	}
+	return &NameResolver{
+		cfg:      cfg,
+		Client:   &http.Client{Timeout: timeout},
+		sink:     sink,
+		names:    make(map[string]cachedName),
+		inflight: make(map[string]chan struct{}),
+	}
+}
+
+// the name of id, id itself if it is unknown or cannot be looked up
+func (resolver *NameResolver) Resolve(ctx context.Context, id string) string {
+	if id == "" {
+		return id
+	}
+	if name, fresh := resolver.cached(id); fresh {
+		return name
+	}
+	key := id
+	if resolver.isList() {
+		key = ""
+	}
+	done, running := resolver.join(key)
+	if running {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		name, _ := resolver.cached(id)
+		return name
+	}
+	defer resolver.leave(key, done)
+	// looked up by another poll meanwhile
+	name, fresh := resolver.cached(id)
+	if fresh {
+		return name
+	}
+
+	var err error
+	if resolver.isList() {
+		err = resolver.fetchList(ctx)
+	} else {
+		var found string
+		if found, err = resolver.fetchOne(ctx, id); err == nil {
+			resolver.store(id, found, resolver.cfg.TTL.Duration)
+		}
+	}
+	if err != nil {
+		resolver.sink.IncCounter(NAME_RESOLVER_LOOKUPS_METRIC, map[string]string{"resolver": resolver.cfg.Name, "result": "failed"})
+		logger.WarnCtx(ctx, fmt.Sprintf("Name resolver %s failed to look up %s: %v", resolver.cfg.Name, id, err))
+		// the previous name, or the ID, until the next attempt
+		resolver.store(id, name, resolver.cfg.RetryAfter.Duration)
+		return name
+	}
+	if resolved, _ := resolver.cached(id); resolved != id {
+		resolver.sink.IncCounter(NAME_RESOLVER_LOOKUPS_METRIC, map[string]string{"resolver": resolver.cfg.Name, "result": "resolved"})
+		return resolved
+	}
+	resolver.sink.IncCounter(NAME_RESOLVER_LOOKUPS_METRIC, map[string]string{"resolver": resolver.cfg.Name, "result": "unknown"})
+	resolver.store(id, id, resolver.cfg.RetryAfter.Duration)
+	return id
+}
+
+// the cached name of id, or id, and whether it is still valid
+func (resolver *NameResolver) cached(id string) (string, bool) {
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+	entry, ok := resolver.names[id]
+	if !ok {
+		return id, false
+	}
+	return entry.name, time.Now().Before(entry.expires)
+}
+
+func (resolver *NameResolver) store(id, name string, ttl time.Duration) {
+	now := time.Now()
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+	resolver.names[id] = cachedName{name: name, expires: now.Add(ttl)}
+	resolver.sweep(now)
+}
+
+// drops names expired for longer than TTL, at most once per TTL; caller must hold the lock
+func (resolver *NameResolver) sweep(now time.Time) {
+	grace := max(resolver.cfg.TTL.Duration, resolver.cfg.RetryAfter.Duration)
+	if now.Sub(resolver.lastSweep) < grace {
+		return
+	}
+	resolver.lastSweep = now
+	for id, entry := range resolver.names {
+		if now.Sub(entry.expires) > grace {
+			delete(resolver.names, id)
+		}
+	}
+}
+
+// the channel of the running lookup of key and true, or a new one and false if the caller
+// runs the lookup and must leave it
+func (resolver *NameResolver) join(key string) (chan struct{}, bool) {
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+	if done, ok := resolver.inflight[key]; ok {
+		return done, true
+	}
+	done := make(chan struct{})
+	resolver.inflight[key] = done
+	return done, false
+}
+
+func (resolver *NameResolver) leave(key string, done chan struct{}) {
+	resolver.lock.Lock()
+	delete(resolver.inflight, key)
+	resolver.lock.Unlock()
+	close(done)
+}
+
+func (resolver *NameResolver) isList() bool {
+	return !strings.Contains(resolver.cfg.URL, "{id}")
+}
+
+func (resolver *NameResolver) fetchOne(ctx context.Context, id string) (string, error) {
+	doc, err := resolver.get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	name, ok := lookupField(doc, resolver.cfg.NamePath)
+	if !ok || fieldString(name) == "" {
+		return id, nil
+	}
+	return SanitizeLabelValue(fieldString(name)), nil
+}
+
+// caches the names of all listed objects; fetched at most once per RetryAfter for unknown IDs
+func (resolver *NameResolver) fetchList(ctx context.Context) error {
+	resolver.lock.Lock()
+	recent := time.Since(resolver.listFetched) < resolver.cfg.RetryAfter.Duration
+	resolver.lock.Unlock()
+	if recent {
+		return nil
+	}
+	doc, err := resolver.get(ctx, "")
+	if err != nil {
+		return err
+	}
+	items, ok := lookupField(doc, resolver.cfg.ItemsPath)
+	list, isList := items.([]any)
+	if !ok || !isList {
+		return fmt.Errorf("%w: %q is not a list", ErrDecode, resolver.cfg.ItemsPath)
+	}
+
+	expires := time.Now().Add(resolver.cfg.TTL.Duration)
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+	resolver.listFetched = time.Now()
+	for _, item := range list {
+		id, hasID := lookupField(item, resolver.cfg.IDPath)
+		name, hasName := lookupField(item, resolver.cfg.NamePath)
+		if !hasID || !hasName || fieldString(id) == "" || fieldString(name) == "" {
+			continue
+		}
+		resolver.names[fieldString(id)] = cachedName{name: SanitizeLabelValue(fieldString(name)), expires: expires}
+	}
+	return nil
+}
+
+// GETs the lookup URL, with id substituted unless empty, and decodes the JSON response
+func (resolver *NameResolver) get(ctx context.Context, id string) (any, error) {
+	expand := func(template string) (string, error) {
+		if resolver.Secrets == nil {
+			return template, nil
+		}
+		return resolver.Secrets.Expand(template)
+	}
+	target, err := expand(resolver.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand url: %w", err)
+	}
+	if id != "" {
+		target = strings.ReplaceAll(target, "{id}", url.PathEscape(id))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, template := range resolver.cfg.Headers {
+		value, err := expand(template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand header %s: %w", name, err)
+		}
+		req.Header.Set(name, value)
+	}
+	if resolver.Auth != nil {
+		if err := resolver.Auth.Authenticate(req); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrAuth, err)
+		}
+	}
+
+	resp, err := resolver.Client.Do(req)
+	if err != nil {
+		return nil, requestError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		if resolver.Auth != nil {
+			resolver.Auth.Invalidate()
+		}
+		return nil, fmt.Errorf("%w: status %d", ErrAuth, resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusNotFound && id != "" {
+		// an ID the API does not know, not an error
+		return nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: status %d", ErrStatus, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, DEFAULT_MAX_BODY_BYTES))
+	if err != nil {
+		return nil, requestError(err)
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return doc, nil
+}
+
+// replaces IDs in label values by their names while a poll is processed
+type resolvingSink struct {
+	next      metrics.MetricSink
+	ctx       context.Context
+	resolvers map[string]*NameResolver
+}
+
+func withResolvedLabels(ctx context.Context, next metrics.MetricSink, resolvers map[string]*NameResolver) metrics.MetricSink {
+	if len(resolvers) == 0 {
+		return next
+	}
+	return &resolvingSink{next: next, ctx: ctx, resolvers: resolvers}
+}
+
+// a copy of labels with resolved values, labels itself if nothing was resolved
+func (sink *resolvingSink) resolve(labels map[string]string) map[string]string {
+	var resolved map[string]string
+	for label, resolver := range sink.resolvers {
+		id, ok := labels[label]
+		if !ok {
+			continue
+		}
+		name := resolver.Resolve(sink.ctx, id)
+		if name == id {
+			continue
+		}
+		if resolved == nil {
+			resolved = make(map[string]string, len(labels))
+			for k, v := range labels {
+				resolved[k] = v
+			}
+		}
+		resolved[label] = name
+	}
+	if resolved == nil {
+		return labels
+	}
+	return resolved
+}
+
+func (sink *resolvingSink) IncCounter(name string, labels map[string]string) {
+	sink.next.IncCounter(name, sink.resolve(labels))
+}
+
+func (sink *resolvingSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.next.AddCounter(name, sink.resolve(labels), delta)
+}
+
+func (sink *resolvingSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.next.SetGauge(name, sink.resolve(labels), value)
+}
+
+func (sink *resolvingSink) Observe(name string, labels map[string]string, value float64) {
+	sink.next.Observe(name, sink.resolve(labels), value)
+}
+
+func (sink *resolvingSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.next.ObserveSummary(name, sink.resolve(labels), value)
+}
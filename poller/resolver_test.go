@@ -0,0 +1,63 @@
+package poller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+func TestNameResolverLooksUpIDsInParallel(t *testing.T) {
+	// the lookup of "slow" blocks until "fast" was looked up
+	fastDone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/vms/slow" {
+			select {
+			case <-fastDone:
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Write([]byte(`{"name": "vm-` + r.URL.Path[len("/vms/"):] + `"}`))
+	}))
+	defer server.Close()
+	resolver := NewNameResolver(config.NameResolverConfig{
+		Name:     "vms",
+		URL:      server.URL + "/vms/{id}",
+		NamePath: "name",
+		TTL:      config.Duration{Duration: time.Hour},
+	}, &gaugeSink{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resolver.Resolve(context.Background(), "slow")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if name := resolver.Resolve(context.Background(), "fast"); name != "vm-fast" {
+		t.Fatalf("resolved %s, expected vm-fast", name)
+	}
+	close(fastDone)
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Fatalf("lookup of fast waited %v for slow", waited)
+	}
+	wg.Wait()
+}
+
+func TestNameResolverDropsLongExpiredNames(t *testing.T) {
+	resolver := NewNameResolver(config.NameResolverConfig{TTL: config.Duration{Duration: time.Minute}}, &gaugeSink{})
+	resolver.names["gone"] = cachedName{name: "vm-gone", expires: time.Now().Add(-time.Hour)}
+	resolver.names["stale"] = cachedName{name: "vm-stale", expires: time.Now().Add(-time.Second)}
+	resolver.store("new", "vm-new", time.Minute)
+	if _, ok := resolver.names["gone"]; ok {
+		t.Fatal("name expired an hour ago is still cached")
+	}
+	if _, ok := resolver.names["stale"]; !ok {
+		t.Fatal("recently expired name was dropped, it is kept until refreshed")
+	}
+}
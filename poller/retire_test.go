@@ -0,0 +1,105 @@
+package poller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// current gauges by name and label key, deletable
+type gaugeSink struct {
+	lock   sync.Mutex
+	gauges map[string]float64
+}
+
+func (sink *gaugeSink) key(name string, labels map[string]string) string {
+	return name + "{" + util.JoinMapEntries(labels) + "}"
+}
+
+func (sink *gaugeSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.gauges[sink.key(name, labels)] = value
+}
+
+func (sink *gaugeSink) DeleteSeries(name string, labels map[string]string) bool {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	_, ok := sink.gauges[sink.key(name, labels)]
+	delete(sink.gauges, sink.key(name, labels))
+	return ok
+}
+
+func (sink *gaugeSink) has(name string, labels map[string]string) bool {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	_, ok := sink.gauges[sink.key(name, labels)]
+	return ok
+}
+
+func (sink *gaugeSink) DeleteMetric(name string) bool                                       { return false }
+func (sink *gaugeSink) IncCounter(name string, labels map[string]string)                    {}
+func (sink *gaugeSink) AddCounter(name string, labels map[string]string, delta float64)     {}
+func (sink *gaugeSink) Observe(name string, labels map[string]string, value float64)        {}
+func (sink *gaugeSink) ObserveSummary(name string, labels map[string]string, value float64) {}
+
+// waits up to a second for condition
+func eventually(t *testing.T, condition func() bool, message string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !condition(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+	}
+}
+
+func TestRetireDeletesSeries(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"value": 3}`))
+	}))
+	defer target.Close()
+
+	sink := &gaugeSink{gauges: make(map[string]float64)}
+	hub := metrics.NewMetricHub()
+	hub.RegisterSink(sink)
+	labels := map[string]string{"cluster": "a"}
+	p := NewPoller(target.URL, "cluster_hosts", labels, time.Hour, hub)
+	p.ImmediateFirstPoll = true
+	p.Start()
+	eventually(t, func() bool { return sink.has("cluster_hosts", labels) }, "first poll did not set the gauge")
+
+	p.Retire()
+	eventually(t, func() bool { return !sink.has("cluster_hosts", labels) }, "retired poller kept its gauge")
+	eventually(t, func() bool { return !sink.has(POLLER_FAILED_METRIC, map[string]string{"poller": "cluster_hosts"}) }, "retired poller kept its own series")
+	// stopping again is a no-op
+	p.Stop()
+}
+
+func TestRetireDeletesRelabeledSeries(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"value": 3}`))
+	}))
+	defer target.Close()
+
+	sink := &gaugeSink{gauges: make(map[string]float64)}
+	hub := metrics.NewMetricHub()
+	hub.RegisterSink(sink)
+	relabel, err := metrics.NewInterceptor(metrics.INTERCEPTOR_RELABEL, []byte(`{"rules": [{"rename": {"cluster": "cluster_name"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.Use(relabel)
+	p := NewPoller(target.URL, "cluster_hosts", map[string]string{"cluster": "a"}, time.Hour, hub)
+	p.ImmediateFirstPoll = true
+	p.Start()
+	relabeled := map[string]string{"cluster_name": "a"}
+	eventually(t, func() bool { return sink.has("cluster_hosts", relabeled) }, "first poll did not set the gauge")
+
+	p.Retire()
+	eventually(t, func() bool { return !sink.has("cluster_hosts", relabeled) }, "retired poller kept its relabeled gauge")
+}
@@ -0,0 +1,75 @@
+package poller
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// deterministic start offset within the interval derived from the poller name,
+// so pollers started together do not all hit vCenter at the same moment and
+// each poller keeps its slot across restarts
+func StaggerOffset(name string, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return time.Duration(hash.Sum64() % uint64(interval))
+}
+
+// calls poll once right away if immediate, then every interval starting after offset,
+// until done is closed (a nil done runs forever)
+func runSchedule(interval, offset time.Duration, immediate bool, done <-chan struct{}, poll func()) {
+	if immediate {
+		poll()
+	}
+	if offset > 0 {
+		select {
+		case <-time.After(offset):
+			if !immediate {
+				poll()
+			}
+		case <-done:
+			return
+		}
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			poll()
+		case <-done:
+			return
+		}
+	}
+}
+
+// like runSchedule, but waits interval() after each poll, for intervals changing between polls
+func runAdaptive(interval func() time.Duration, offset time.Duration, immediate bool, done <-chan struct{}, poll func()) {
+	if immediate {
+		poll()
+	}
+	if offset > 0 {
+		select {
+		case <-time.After(offset):
+			if !immediate {
+				poll()
+			}
+		case <-done:
+			return
+		}
+	}
+
+	for {
+		timer := time.NewTimer(interval())
+		select {
+		case <-timer.C:
+			poll()
+		case <-done:
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package poller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// SchemaTracker remembers the fields of a poller's JSON responses and reports fields that
+// disappear or change type, which processors would otherwise silently read as missing or zero
+type SchemaTracker struct {
+	// field path ("items[].status") -> JSON type of the responses seen so far
+	baseline map[string]string
+	// drifted paths already logged, reported again only after they came back
+	drifted map[string]string
+}
+
+// a change of a field compared to earlier responses
+type SchemaDrift struct {
+	Path string
+	// "removed" or "type_changed"
+	Change string
+	Was    string
+	Now    string
+}
+
+func NewSchemaTracker() *SchemaTracker {
+	return &SchemaTracker{drifted: make(map[string]string)}
+}
+
+// compares the fields of body with earlier responses and returns drift not reported before;
+// the first response becomes the baseline, fields seen for the first time are added to it
+func (tracker *SchemaTracker) Check(body []byte) (newDrift []SchemaDrift, total int, err error) {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, len(tracker.drifted), err
+	}
+	current := make(map[string]string)
+	// arrays without elements say nothing about the fields of their elements
+	var empty []string
+	walkSchema(doc, "", current, &empty)
+
+	if tracker.baseline == nil {
+		tracker.baseline = current
+		return nil, 0, nil
+	}
+	for path, was := range tracker.baseline {
+		now, ok := current[path]
+		change := ""
+		switch {
+		case !ok && !underAny(path, empty):
+			change = "removed"
+		case ok && now != was && now != "null" && was != "null":
+			change = "type_changed"
+		}
+		if change == "" {
+			delete(tracker.drifted, path)
+			continue
+		}
+		if tracker.drifted[path] != change {
+			tracker.drifted[path] = change
+			newDrift = append(newDrift, SchemaDrift{Path: path, Change: change, Was: was, Now: now})
+		}
+	}
+	for path, typ := range current {
+		if was, ok := tracker.baseline[path]; !ok || was == "null" {
+			tracker.baseline[path] = typ
+		}
+	}
+	sort.Slice(newDrift, func(i, j int) bool { return newDrift[i].Path < newDrift[j].Path })
+	return newDrift, len(tracker.drifted), nil
+}
+
+func (drift SchemaDrift) String() string {
+	if drift.Change == "removed" {
+		return fmt.Sprintf("field %s (%s) is missing", drift.Path, drift.Was)
+	}
+	return fmt.Sprintf("field %s changed from %s to %s", drift.Path, drift.Was, drift.Now)
+}
+
+// records the type of every field below value, elements of an array share the path "name[]"
+func walkSchema(value any, path string, schema map[string]string, empty *[]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		if path != "" {
+			schema[path] = "object"
+		}
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			walkSchema(child, childPath, schema, empty)
+		}
+	case []any:
+		schema[path] = "array"
+		if len(v) == 0 {
+			*empty = append(*empty, path+"[]")
+		}
+		for _, element := range v {
+			walkSchema(element, path+"[]", schema, empty)
+		}
+	case string:
+		schema[path] = "string"
+	case float64:
+		schema[path] = "number"
+	case bool:
+		schema[path] = "boolean"
+	case nil:
+		if _, ok := schema[path]; !ok {
+			schema[path] = "null"
+		}
+	}
+}
+
+func underAny(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[]") {
+			return true
+		}
+	}
+	return false
+}
+
+// logs new drift of a response and publishes the drifted field count
+func (p *Poller) checkSchema(ctx context.Context, body []byte) {
+	if p.Schema == nil {
+		return
+	}
+	drift, total, err := p.Schema.Check(body)
+	if err != nil {
+		// not JSON, e.g. a plain number for the value processor
+		return
+	}
+	for _, d := range drift {
+		logger.WarnCtx(ctx, fmt.Sprintf("Poller %s response schema changed: %s", p.Name, d))
+	}
+	p.Hub.SetGauge(POLLER_SCHEMA_DRIFT_METRIC, map[string]string{"poller": p.Name}, float64(total))
+}
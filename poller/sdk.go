@@ -0,0 +1,118 @@
+package poller
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// helpers for writing processors outside this package, see processortest for checking them
+// against golden files
+
+// decodes the JSON body into a new T, in strict mode unknown fields are rejected
+func Decode[T any](body []byte, strict bool) (T, error) {
+	var v T
+	err := DecodeJSON(body, &v, strict)
+	return v, err
+}
+
+// turns any string into a valid label name: invalid characters become "_",
+// a leading digit is prefixed with "_"
+func SanitizeLabelName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// trims whitespace, replaces invalid UTF-8 and cuts values longer than MAX_LABEL_VALUE_LENGTH bytes,
+// so free text from API responses cannot break or bloat series
+func SanitizeLabelValue(value string) string {
+	value = strings.TrimSpace(strings.ToValidUTF8(value, "\ufffd"))
+	if len(value) <= MAX_LABEL_VALUE_LENGTH {
+		return value
+	}
+	cut := MAX_LABEL_VALUE_LENGTH
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut]
+}
+
+// LabelSet builds label maps with sanitized names and values; sets are copied on every change,
+// so a base set can be shared by all series of a response
+type LabelSet map[string]string
+
+// copy of the static labels of a poller
+func NewLabelSet(static map[string]string) LabelSet {
+	return LabelSet(mergeLabels(static, nil))
+}
+
+func (set LabelSet) With(name, value string) LabelSet {
+	labels := mergeLabels(set, nil)
+	labels[SanitizeLabelName(name)] = SanitizeLabelValue(value)
+	return labels
+}
+
+func (set LabelSet) WithAll(extra map[string]string) LabelSet {
+	labels := mergeLabels(set, nil)
+	for name, value := range extra {
+		labels[SanitizeLabelName(name)] = SanitizeLabelValue(value)
+	}
+	return labels
+}
+
+// Emitter writes metrics of one processor run, prefixing names and adding the base labels
+type Emitter struct {
+	Sink metrics.MetricSink
+	// prepended to every metric name, e.g. "nsx_edge_"
+	Prefix string
+	Labels LabelSet
+}
+
+func (e Emitter) Gauge(name string, labels LabelSet, value float64) {
+	e.Sink.SetGauge(e.Prefix+name, e.labels(labels), value)
+}
+
+// sets the gauge only if the response contained the value, decode optional fields into *float64
+func (e Emitter) GaugeIfSet(name string, labels LabelSet, value *float64) {
+	if value != nil {
+		e.Gauge(name, labels, *value)
+	}
+}
+
+// 1 for true, 0 for false
+func (e Emitter) Bool(name string, labels LabelSet, value bool) {
+	var v float64
+	if value {
+		v = 1
+	}
+	e.Gauge(name, labels, v)
+}
+
+func (e Emitter) Counter(name string, labels LabelSet, delta float64) {
+	e.Sink.AddCounter(e.Prefix+name, e.labels(labels), delta)
+}
+
+func (e Emitter) Observe(name string, labels LabelSet, value float64) {
+	e.Sink.Observe(e.Prefix+name, e.labels(labels), value)
+}
+
+func (e Emitter) labels(labels LabelSet) map[string]string {
+	return mergeLabels(e.Labels, labels)
+}
@@ -0,0 +1,69 @@
+package poller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// Shard decides which pollers this collector instance runs, see config.ShardConfig;
+// a nil Shard runs all of them
+type Shard struct {
+	Index int
+	Total int
+}
+
+// nil if sharding is disabled
+func NewShard(cfg config.ShardConfig) (*Shard, error) {
+	if cfg.Total <= 1 {
+		return nil, nil
+	}
+	index := cfg.Index
+	if cfg.IndexFromHostname {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		if index, err = hostnameOrdinal(hostname); err != nil {
+			return nil, err
+		}
+	}
+	if index < 0 || index >= cfg.Total {
+		return nil, fmt.Errorf("shard index %d out of range for %d shards", index, cfg.Total)
+	}
+	return &Shard{Index: index, Total: cfg.Total}, nil
+}
+
+// "collector-2" -> 2
+func hostnameOrdinal(hostname string) (int, error) {
+	digits := hostname[strings.LastIndexFunc(hostname, func(r rune) bool { return r < '0' || r > '9' })+1:]
+	ordinal, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, fmt.Errorf("host name %q does not end in a shard index", hostname)
+	}
+	return ordinal, nil
+}
+
+// whether this instance runs the poller named key; the same key maps to the same shard
+// on every instance, as long as Total is the same
+func (shard *Shard) Owns(key string) bool {
+	if shard == nil {
+		return true
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return hash.Sum64()%uint64(shard.Total) == uint64(shard.Index)
+}
+
+// key of an HTTP poller for Owns: its name, or its URL if unnamed since names default to
+// the metric, which pollers of different endpoints often share
+func ShardKey(pc config.PollerConfig) string {
+	if pc.Name != "" {
+		return pc.Name
+	}
+	return pc.URL
+}
@@ -0,0 +1,284 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/chaos"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/quota"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/tracing"
+	"github.com/gosnmp/gosnmp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"":       gosnmp.NoAuth,
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"":       gosnmp.NoPriv,
+	"DES":    gosnmp.DES,
+	"AES":    gosnmp.AES,
+	"AES192": gosnmp.AES192,
+	"AES256": gosnmp.AES256,
+}
+
+// SnmpPoller periodically reads configured OIDs from a device (switches, storage arrays)
+// and sets a gauge per OID, or per table row for walked OIDs; Counter32 and Counter64
+// values are added to <metric>_total counters instead
+type SnmpPoller struct {
+	Config  config.SnmpPollerConfig
+	Hub     *metrics.MetricHub
+	Secrets *secrets.Resolver
+
+	// delay of the first scheduled poll, see StaggerOffset
+	Offset time.Duration
+	// optional, waits for the first poll before scrapes are served
+	Warmup *Warmup
+	// optional, limits the series a walk may create, e.g. for a table growing without bound
+	Quota *quota.SeriesQuota
+	// optional, fails polls on purpose in test deployments
+	Chaos *chaos.Injector
+
+	totals metrics.CumulativeConverter
+}
+
+func NewSnmpPoller(cfg config.SnmpPollerConfig, hub *metrics.MetricHub, resolver *secrets.Resolver) (*SnmpPoller, error) {
+	if cfg.Version != "2c" && cfg.Version != "3" {
+		return nil, fmt.Errorf("unsupported snmp version %q (use \"2c\" or \"3\")", cfg.Version)
+	}
+	if cfg.Version == "3" {
+		if cfg.V3 == nil {
+			return nil, fmt.Errorf("snmp v3 poller %s requires v3 settings", cfg.Name)
+		}
+		if _, ok := snmpAuthProtocols[cfg.V3.AuthProtocol]; !ok {
+			return nil, fmt.Errorf("unknown snmp auth protocol %q", cfg.V3.AuthProtocol)
+		}
+		if _, ok := snmpPrivProtocols[cfg.V3.PrivProtocol]; !ok {
+			return nil, fmt.Errorf("unknown snmp privacy protocol %q", cfg.V3.PrivProtocol)
+		}
+	}
+	return &SnmpPoller{Config: cfg, Hub: hub, Secrets: resolver}, nil
+}
+
+func (p *SnmpPoller) Start() {
+	p.Warmup.add(p, p.Config.Name)
+	go runSchedule(p.Config.Interval.Duration, p.Offset, p.Config.ImmediateFirstPoll, nil, p.poll)
+}
+
+// runs one poll cycle and counts failures
+func (p *SnmpPoller) poll() {
+	defer p.Warmup.done(p)
+	_, span := tracing.Start(context.Background(), "snmp poll", attribute.String("poller", p.Config.Name))
+	defer span.End()
+	if err := p.pollOnce(); err != nil {
+		tracing.Fail(span, err)
+		logger.Warn(fmt.Sprintf("SNMP poller %s failed polling %s: %v", p.Config.Name, p.Config.Target, err))
+		p.Hub.IncCounter(POLLER_ERRORS_METRIC, map[string]string{"poller": p.Config.Name, "category": ErrorCategory(err)})
+	}
+}
+
+func (p *SnmpPoller) pollOnce() error {
+	// injected failures look like an unreachable device
+	if err := p.Chaos.PollError(p.Config.Name); err != nil {
+		return fmt.Errorf("%w: %w", ErrNetwork, err)
+	}
+	client, err := p.newClient()
+	if err != nil {
+		return err
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("%w: %w", ErrNetwork, err)
+	}
+	defer client.Conn.Close()
+
+	// plain OIDs are fetched in a single GET request
+	var getOIDs []string
+	byOID := make(map[string]config.SnmpOIDConfig)
+	for _, oc := range p.Config.OIDs {
+		if oc.Walk {
+			if err := p.walk(client, oc); err != nil {
+				return err
+			}
+			continue
+		}
+		oid := normalizeOID(oc.OID)
+		getOIDs = append(getOIDs, oid)
+		byOID[oid] = oc
+	}
+	if len(getOIDs) == 0 {
+		return nil
+	}
+
+	packet, err := client.Get(getOIDs)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNetwork, err)
+	}
+	for _, pdu := range packet.Variables {
+		oc, ok := byOID[normalizeOID(pdu.Name)]
+		if !ok {
+			continue
+		}
+		value, ok := snmpValue(pdu)
+		if !ok {
+			continue
+		}
+		p.record(p.sink(), pdu.Type, oc.Metric, mergeLabels(p.Config.Labels, oc.Labels), value)
+	}
+	return nil
+}
+
+// sets the gauge of a value, or adds the increase of a counter value to <metric>_total
+func (p *SnmpPoller) record(sink metrics.MetricSink, kind gosnmp.Asn1BER, metric string, labels map[string]string, value float64) {
+	var wrap float64
+	switch kind {
+	case gosnmp.Counter32:
+		wrap = 1 << 32
+	case gosnmp.Counter64:
+		wrap = 1 << 64
+	default:
+		sink.SetGauge(metric, labels, value)
+		return
+	}
+	if !strings.HasSuffix(metric, "_total") {
+		metric += "_total"
+	}
+	p.totals.Increase(sink, metric, labels, value, wrap)
+}
+
+// the hub, behind the quota if set
+func (p *SnmpPoller) sink() metrics.MetricSink {
+	if p.Quota == nil {
+		return p.Hub
+	}
+	return &quota.Sink{Next: p.Hub, Quota: p.Quota, Source: "poller:" + p.Config.Name}
+}
+
+// walks the subtree of a table column and sets one gauge per row
+func (p *SnmpPoller) walk(client *gosnmp.GoSNMP, oc config.SnmpOIDConfig) error {
+	root := normalizeOID(oc.OID)
+	sink := p.sink()
+	indexLabel := oc.IndexLabel
+	if indexLabel == "" {
+		indexLabel = "index"
+	}
+	err := client.BulkWalk(root, func(pdu gosnmp.SnmpPDU) error {
+		value, ok := snmpValue(pdu)
+		if !ok {
+			return nil
+		}
+		index := strings.TrimPrefix(strings.TrimPrefix(normalizeOID(pdu.Name), root), ".")
+		labels := mergeLabels(mergeLabels(p.Config.Labels, oc.Labels), map[string]string{indexLabel: index})
+		p.record(sink, pdu.Type, oc.Metric, labels, value)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: walk %s: %w", ErrNetwork, root, err)
+	}
+	return nil
+}
+
+// builds SNMP client for the configured target, resolving secret placeholders
+func (p *SnmpPoller) newClient() (*gosnmp.GoSNMP, error) {
+	host, port := p.Config.Target, uint16(161)
+	if h, portStr, err := net.SplitHostPort(p.Config.Target); err == nil {
+		parsed, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snmp port in %s", p.Config.Target)
+		}
+		host, port = h, uint16(parsed)
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:  host,
+		Port:    port,
+		Timeout: 5 * time.Second,
+		Retries: 1,
+		MaxOids: gosnmp.MaxOids,
+	}
+
+	expand := func(template string) (string, error) {
+		if p.Secrets == nil {
+			return template, nil
+		}
+		return p.Secrets.Expand(template)
+	}
+
+	if p.Config.Version == "2c" {
+		community, err := expand(p.Config.Community)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrAuth, err)
+		}
+		client.Version = gosnmp.Version2c
+		client.Community = community
+		return client, nil
+	}
+
+	v3 := p.Config.V3
+	authPass, err := expand(v3.AuthPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAuth, err)
+	}
+	privPass, err := expand(v3.PrivPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAuth, err)
+	}
+
+	client.Version = gosnmp.Version3
+	client.SecurityModel = gosnmp.UserSecurityModel
+	client.MsgFlags = gosnmp.NoAuthNoPriv
+	if v3.AuthProtocol != "" {
+		client.MsgFlags = gosnmp.AuthNoPriv
+		if v3.PrivProtocol != "" {
+			client.MsgFlags = gosnmp.AuthPriv
+		}
+	}
+	client.SecurityParameters = &gosnmp.UsmSecurityParameters{
+		UserName:                 v3.Username,
+		AuthenticationProtocol:   snmpAuthProtocols[v3.AuthProtocol],
+		AuthenticationPassphrase: authPass,
+		PrivacyProtocol:          snmpPrivProtocols[v3.PrivProtocol],
+		PrivacyPassphrase:        privPass,
+	}
+	return client, nil
+}
+
+// converts numeric SNMP values (integers, counters, gauges, timeticks) and numeric strings to float
+func snmpValue(pdu gosnmp.SnmpPDU) (float64, bool) {
+	switch pdu.Type {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Counter64, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		value, _ := gosnmp.ToBigInt(pdu.Value).Float64()
+		return value, true
+	case gosnmp.OctetString:
+		bytes, ok := pdu.Value.([]byte)
+		if !ok {
+			return 0, false
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(string(bytes)), 64)
+		return value, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// OIDs are compared with a leading dot as returned by gosnmp
+func normalizeOID(oid string) string {
+	if strings.HasPrefix(oid, ".") {
+		return oid
+	}
+	return "." + oid
+}
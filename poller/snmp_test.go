@@ -0,0 +1,35 @@
+package poller
+
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// adds up counter increases, gauges are kept by gaugeSink
+type counterSink struct {
+	gaugeSink
+	totals map[string]float64
+}
+
+func (sink *counterSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.totals[sink.key(name, labels)] += delta
+}
+
+func TestSnmpCountersAddIncreasesAcrossWraps(t *testing.T) {
+	p := &SnmpPoller{}
+	sink := &counterSink{gaugeSink: gaugeSink{gauges: make(map[string]float64)}, totals: make(map[string]float64)}
+	labels := map[string]string{"ifIndex": "1"}
+	for _, value := range []float64{100, 4294967200, 50} {
+		p.record(sink, gosnmp.Counter32, "if_in_octets", labels, value)
+	}
+	p.record(sink, gosnmp.Gauge32, "if_speed", labels, 1e9)
+
+	// 100 is the baseline, then 4294967100 up to the wrap at 2^32 and 146 past it
+	if total := sink.totals["if_in_octets_total{ifIndex=1}"]; total != 4294967246 {
+		t.Fatalf("if_in_octets_total is %v, expected 4294967246", total)
+	}
+	if !sink.has("if_speed", labels) {
+		t.Fatal("Gauge32 value was not set as gauge")
+	}
+}
@@ -0,0 +1,217 @@
+package poller
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/quota"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+	"github.com/gosnmp/gosnmp"
+)
+
+// snmpTrapOID.0, the varbind naming the trap in v2c traps
+const snmpTrapOIDVarbind = ".1.3.6.1.6.3.1.1.4.1.0"
+
+// prefix of the standard OIDs of v1 generic traps (coldStart is .1, linkDown .3, ...)
+const genericTrapPrefix = ".1.3.6.1.6.3.1.1.5."
+
+// SnmpTrapReceiver counts hardware alerts sent as SNMP traps by hosts and arrays,
+// one counter increment per trap with labels taken from its varbinds
+type SnmpTrapReceiver struct {
+	cfg       config.SnmpTrapConfig
+	community string
+	sink      metrics.MetricSink
+	// optional, limits the series of rule metrics and of UnmatchedMetric, whose trap OIDs and
+	// sources are chosen by whoever sends traps, counted per metric as source "snmptrap:<metric>"
+	Quota *quota.SeriesQuota
+
+	// matched, unmatched and rejected traps
+	traps *metrics.SampledCounter
+	// distinct OIDs of unmatched traps counted so far, up to MAX_UNMATCHED_TRAP_OIDS
+	unmatchedOIDs sync.Map
+	unmatchedLen  atomic.Int64
+}
+
+func NewSnmpTrapReceiver(cfg config.SnmpTrapConfig, sink metrics.MetricSink, resolver *secrets.Resolver) (*SnmpTrapReceiver, error) {
+	community := cfg.Community
+	if resolver != nil {
+		expanded, err := resolver.Expand(community)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrAuth, err)
+		}
+		community = expanded
+	}
+	for i := range cfg.Traps {
+		cfg.Traps[i].TrapOID = normalizeOID(cfg.Traps[i].TrapOID)
+	}
+	return &SnmpTrapReceiver{
+		cfg:       cfg,
+		community: community,
+		sink:      sink,
+		traps:     metrics.NewSampledCounter(sink, SNMP_TRAPS_METRIC, "result", "matched", "unmatched", "rejected"),
+	}, nil
+}
+
+// binds the trap listener and serves it in the background
+func (receiver *SnmpTrapReceiver) Start() error {
+	listener := gosnmp.NewTrapListener()
+	listener.Params = &gosnmp.GoSNMP{Version: gosnmp.Version2c, Logger: gosnmp.NewLogger(log.New(logWriter{}, "", 0))}
+	listener.OnNewTrap = receiver.handle
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- listener.Listen(receiver.cfg.ListenAddr)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-listener.Listening():
+	}
+	logger.Info(fmt.Sprintf("Listening for SNMP traps on %s", receiver.cfg.ListenAddr))
+	go func() {
+		if err := <-errs; err != nil {
+			logger.Error(fmt.Sprintf("SNMP trap listener on %s stopped: %v", receiver.cfg.ListenAddr, err))
+		}
+	}()
+	// counters are sampled to keep the sink out of the receive loop
+	metrics.PublishEvery(SNMP_TRAPS_PUBLISH_INTERVAL_SEC*time.Second, receiver.traps.Publish)
+	return nil
+}
+
+func (receiver *SnmpTrapReceiver) handle(packet *gosnmp.SnmpPacket, addr *net.UDPAddr) {
+	if receiver.community != "" && packet.Community != receiver.community {
+		receiver.traps.Inc("rejected")
+		return
+	}
+	trapOID := trapOIDOf(packet)
+	if trapOID == "" {
+		receiver.traps.Inc("rejected")
+		return
+	}
+
+	rule := receiver.ruleFor(trapOID)
+	if rule == nil {
+		receiver.traps.Inc("unmatched")
+		if receiver.cfg.UnmatchedMetric != "" {
+			labels := map[string]string{"trap_oid": receiver.unmatchedOID(trapOID)}
+			receiver.addSource(labels, addr)
+			receiver.inc(receiver.cfg.UnmatchedMetric, labels)
+		}
+		return
+	}
+	receiver.traps.Inc("matched")
+
+	labels := make(map[string]string, len(rule.Labels)+len(rule.Varbinds)+1)
+	for name, value := range rule.Labels {
+		labels[name] = value
+	}
+	// every configured varbind label is set, so all increments of the metric share label names
+	for _, label := range rule.Varbinds {
+		labels[label] = ""
+	}
+	for _, pdu := range packet.Variables {
+		name := normalizeOID(pdu.Name)
+		for oid, label := range rule.Varbinds {
+			if oid := normalizeOID(oid); name == oid || strings.HasPrefix(name, oid+".") {
+				labels[label] = snmpString(pdu)
+			}
+		}
+	}
+	receiver.addSource(labels, addr)
+	receiver.inc(rule.Metric, labels)
+}
+
+func (receiver *SnmpTrapReceiver) inc(metric string, labels map[string]string) {
+	if receiver.Quota.Allow("snmptrap:"+metric, metric, labels) {
+		receiver.sink.IncCounter(metric, labels)
+	}
+}
+
+// trapOID as label value of UnmatchedMetric, UNMATCHED_TRAP_OID_OTHER once
+// MAX_UNMATCHED_TRAP_OIDS others were seen, so unknown senders can't grow it without bound
+func (receiver *SnmpTrapReceiver) unmatchedOID(trapOID string) string {
+	if _, seen := receiver.unmatchedOIDs.Load(trapOID); seen {
+		return trapOID
+	}
+	if receiver.unmatchedLen.Add(1) > MAX_UNMATCHED_TRAP_OIDS {
+		receiver.unmatchedLen.Add(-1)
+		return UNMATCHED_TRAP_OID_OTHER
+	}
+	if _, seen := receiver.unmatchedOIDs.LoadOrStore(trapOID, struct{}{}); seen {
+		receiver.unmatchedLen.Add(-1)
+	}
+	return trapOID
+}
+
+func (receiver *SnmpTrapReceiver) addSource(labels map[string]string, addr *net.UDPAddr) {
+	if receiver.cfg.SourceLabel != "" && addr != nil {
+		labels[receiver.cfg.SourceLabel] = addr.IP.String()
+	}
+}
+
+// the rule with the longest TrapOID equal to or above the trap OID
+func (receiver *SnmpTrapReceiver) ruleFor(trapOID string) *config.SnmpTrapRule {
+	var best *config.SnmpTrapRule
+	for i := range receiver.cfg.Traps {
+		rule := &receiver.cfg.Traps[i]
+		if trapOID != rule.TrapOID && !strings.HasPrefix(trapOID, rule.TrapOID+".") {
+			continue
+		}
+		if best == nil || len(rule.TrapOID) > len(best.TrapOID) {
+			best = rule
+		}
+	}
+	return best
+}
+
+// OID identifying the trap, mapping v1 traps to their v2c equivalent (RFC 3584)
+func trapOIDOf(packet *gosnmp.SnmpPacket) string {
+	if packet.Version == gosnmp.Version1 {
+		if packet.GenericTrap == 6 {
+			return normalizeOID(packet.Enterprise) + ".0." + strconv.Itoa(packet.SpecificTrap)
+		}
+		return genericTrapPrefix + strconv.Itoa(packet.GenericTrap+1)
+	}
+	for _, pdu := range packet.Variables {
+		if normalizeOID(pdu.Name) == snmpTrapOIDVarbind {
+			if oid, ok := pdu.Value.(string); ok {
+				return normalizeOID(oid)
+			}
+		}
+	}
+	return ""
+}
+
+// varbind value as label value
+func snmpString(pdu gosnmp.SnmpPDU) string {
+	switch value := pdu.Value.(type) {
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	case nil:
+		return ""
+	}
+	switch pdu.Type {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Counter64, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		return gosnmp.ToBigInt(pdu.Value).String()
+	}
+	return fmt.Sprint(pdu.Value)
+}
+
+// routes gosnmp's diagnostics (undecodable packets) to the collector log
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	logger.Warn("SNMP trap listener: " + strings.TrimSpace(string(p)))
+	return len(p), nil
+}
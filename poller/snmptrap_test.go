@@ -0,0 +1,27 @@
+package poller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+func TestUnmatchedTrapOIDsAreBounded(t *testing.T) {
+	receiver, err := NewSnmpTrapReceiver(config.SnmpTrapConfig{UnmatchedMetric: "snmp_unmatched_traps_total"}, &gaugeSink{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < MAX_UNMATCHED_TRAP_OIDS; i++ {
+		oid := fmt.Sprintf(".1.3.6.1.4.1.%d", i)
+		if label := receiver.unmatchedOID(oid); label != oid {
+			t.Fatalf("OID %d labelled %s", i, label)
+		}
+	}
+	if label := receiver.unmatchedOID(".1.3.6.1.4.1.99999"); label != UNMATCHED_TRAP_OID_OTHER {
+		t.Fatalf("OID beyond the limit labelled %s, expected %s", label, UNMATCHED_TRAP_OID_OTHER)
+	}
+	if label := receiver.unmatchedOID(".1.3.6.1.4.1.0"); label != ".1.3.6.1.4.1.0" {
+		t.Fatalf("OID seen before the limit labelled %s", label)
+	}
+}
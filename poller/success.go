@@ -0,0 +1,106 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// SuccessCriteria decides whether a response counts as a successful poll, see config.SuccessConfig;
+// nil accepts any 2xx response
+type SuccessCriteria struct {
+	cfg config.SuccessConfig
+}
+
+func NewSuccessCriteria(cfg config.SuccessConfig) *SuccessCriteria {
+	return &SuccessCriteria{cfg: cfg}
+}
+
+func (criteria *SuccessCriteria) acceptsStatus(code int) bool {
+	if criteria == nil || len(criteria.cfg.StatusCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	return slices.Contains(criteria.cfg.StatusCodes, code)
+}
+
+// checks required fields and item count of a JSON response, responses of pollers
+// without body criteria are not parsed
+func (criteria *SuccessCriteria) check(body []byte) error {
+	if criteria == nil || (len(criteria.cfg.RequiredFields) == 0 && criteria.cfg.MinItems == 0) {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("%w: response is not JSON: %w", ErrCriteria, err)
+	}
+	for _, path := range criteria.cfg.RequiredFields {
+		if value, ok := lookupField(doc, path); !ok || value == nil {
+			return fmt.Errorf("%w: required field %s is missing", ErrCriteria, path)
+		}
+	}
+	if criteria.cfg.MinItems > 0 {
+		value, _ := lookupField(doc, criteria.cfg.ItemsPath)
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%w: %s is not an array", ErrCriteria, itemsName(criteria.cfg.ItemsPath))
+		}
+		if len(items) < criteria.cfg.MinItems {
+			return fmt.Errorf("%w: %s has %d items, expected at least %d", ErrCriteria, itemsName(criteria.cfg.ItemsPath), len(items), criteria.cfg.MinItems)
+		}
+	}
+	return nil
+}
+
+func itemsName(path string) string {
+	if path == "" {
+		return "response"
+	}
+	return path
+}
+
+// text of a JSON value, objects and arrays as JSON, empty for null
+func fieldString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// value at a dotted path, numeric segments index arrays; the empty path is the document itself
+func lookupField(doc any, path string) (any, bool) {
+	if path == "" {
+		return doc, true
+	}
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]any:
+			child, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			current = child
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			current = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
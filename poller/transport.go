@@ -0,0 +1,56 @@
+package poller
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// settings -> transport, see SharedTransport
+var transports sync.Map
+
+// transport for poll requests with the given settings, shared by all pollers using the same
+// settings so their connections to a host are reused across them
+func SharedTransport(hc config.HTTPConfig) *http.Transport {
+	key := fmt.Sprintf("%+v", hc)
+	if transport, ok := transports.Load(key); ok {
+		return transport.(*http.Transport)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if hc.DisableHTTP2 {
+		// a non-nil empty map keeps the transport from upgrading TLS connections to HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		if transport.TLSClientConfig != nil {
+			transport.TLSClientConfig.NextProtos = nil
+		}
+	}
+	transport.DisableKeepAlives = hc.DisableKeepAlives
+	if hc.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = hc.MaxIdleConnsPerHost
+	}
+	if hc.IdleConnTimeout.Duration > 0 {
+		transport.IdleConnTimeout = hc.IdleConnTimeout.Duration
+	}
+	actual, _ := transports.LoadOrStore(key, transport)
+	return actual.(*http.Transport)
+}
+
+// counts new and reused connections of poll requests
+func (p *Poller) connTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			p.Hub.IncCounter(POLLER_CONNECTIONS_METRIC, map[string]string{"poller": p.Name, "reused": strconv.FormatBool(info.Reused)})
+		},
+	}
+}
+
+// counts responses by protocol, "HTTP/1.1" or "HTTP/2.0"
+func (p *Poller) countProtocol(resp *http.Response) {
+	p.Hub.IncCounter(POLLER_PROTOCOL_METRIC, map[string]string{"poller": p.Name, "protocol": resp.Proto})
+}
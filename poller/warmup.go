@@ -0,0 +1,122 @@
+package poller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// Warmup holds back scrapes until every poller started before Start completed its first poll,
+// or the timeout passed; scrape-triggered pollers are not waited for, they poll on scrapes
+type Warmup struct {
+	timeout time.Duration
+
+	lock    sync.Mutex
+	pending map[any]string
+	started time.Time
+	ready   bool
+}
+
+func NewWarmup(cfg config.WarmupConfig) *Warmup {
+	timeout := cfg.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DEFAULT_WARMUP_TIMEOUT_SEC * time.Second
+	}
+	return &Warmup{timeout: timeout, pending: make(map[any]string)}
+}
+
+// registers a poller whose first poll is waited for, keyed by the poller itself
+func (warmup *Warmup) add(key any, name string) {
+	if warmup == nil {
+		return
+	}
+	warmup.lock.Lock()
+	defer warmup.lock.Unlock()
+	if !warmup.ready {
+		warmup.pending[key] = name
+	}
+}
+
+// marks the first poll of a poller as completed, later calls do nothing
+func (warmup *Warmup) done(key any) {
+	if warmup == nil {
+		return
+	}
+	warmup.lock.Lock()
+	defer warmup.lock.Unlock()
+	if _, pending := warmup.pending[key]; !pending {
+		return
+	}
+	delete(warmup.pending, key)
+	warmup.complete()
+}
+
+// starts the timeout once all pollers were started, no poller can complete the warmup before
+func (warmup *Warmup) Start() {
+	warmup.lock.Lock()
+	defer warmup.lock.Unlock()
+	warmup.started = time.Now()
+	logger.Info(fmt.Sprintf("Warming up, waiting for the first polls of %d pollers", len(warmup.pending)))
+	warmup.complete()
+	if warmup.ready {
+		return
+	}
+	time.AfterFunc(warmup.timeout, func() {
+		warmup.lock.Lock()
+		defer warmup.lock.Unlock()
+		if warmup.ready {
+			return
+		}
+		warmup.ready = true
+		logger.Warn(fmt.Sprintf("Warmup timed out after %v, serving scrapes with %d pollers still pending: %v",
+			warmup.timeout, len(warmup.pending), warmup.pendingNames()))
+	})
+}
+
+// caller must hold the lock
+func (warmup *Warmup) complete() {
+	if warmup.ready || warmup.started.IsZero() || len(warmup.pending) > 0 {
+		return
+	}
+	warmup.ready = true
+	logger.Info(fmt.Sprintf("Warmup complete after %v, serving scrapes", time.Since(warmup.started).Round(time.Millisecond)))
+}
+
+// caller must hold the lock
+func (warmup *Warmup) pendingNames() []string {
+	names := make([]string, 0, len(warmup.pending))
+	for _, name := range warmup.pending {
+		names = append(names, name)
+	}
+	return names
+}
+
+// whether scrapes are served; a nil Warmup is always ready
+func (warmup *Warmup) Ready() bool {
+	if warmup == nil {
+		return true
+	}
+	warmup.lock.Lock()
+	defer warmup.lock.Unlock()
+	return warmup.ready
+}
+
+// answers 503 until the warmup completed; a nil Warmup serves right away
+func (warmup *Warmup) Wrap(handler http.HandlerFunc) http.HandlerFunc {
+	if warmup == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !warmup.Ready() {
+			w.Header().Set("Retry-After", strconv.Itoa(WARMUP_RETRY_AFTER_SEC))
+			http.Error(w, "collector is warming up", http.StatusServiceUnavailable)
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,38 @@
+package prometheus
+
+import (
+	"context"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// sink bound to the context of a push or poll, so sink errors are logged with its request ID
+type boundSink struct {
+	psink *PrometheusSink
+	ctx   context.Context
+}
+
+// implements metrics.ContextSink
+func (psink *PrometheusSink) WithContext(ctx context.Context) metrics.MetricSink {
+	return &boundSink{psink: psink, ctx: ctx}
+}
+
+func (bound *boundSink) IncCounter(name string, labels map[string]string) {
+	bound.psink.addCounter(bound.ctx, name, labels, 1)
+}
+
+func (bound *boundSink) AddCounter(name string, labels map[string]string, delta float64) {
+	bound.psink.addCounter(bound.ctx, name, labels, delta)
+}
+
+func (bound *boundSink) SetGauge(name string, labels map[string]string, value float64) {
+	bound.psink.setGauge(bound.ctx, name, labels, value)
+}
+
+func (bound *boundSink) Observe(name string, labels map[string]string, value float64) {
+	bound.psink.observe(bound.ctx, name, labels, value)
+}
+
+func (bound *boundSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	bound.psink.observeSummary(bound.ctx, name, labels, value)
+}
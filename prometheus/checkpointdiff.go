@@ -0,0 +1,77 @@
+package prometheus
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/checkpoint"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var ErrNoCheckpoint = errors.New("checkpointing is disabled")
+var ErrCheckpointNotSaved = errors.New("no checkpoint saved yet")
+
+// compares the exposed counter and gauge values with the last saved checkpoint, including
+// write-ahead log records, i.e. with what a restart would restore; changes go from the saved
+// to the live value, ephemeral metrics are left out
+func (psink *PrometheusSink) DiffCheckpoint() (savedAt time.Time, changes []checkpoint.Change, err error) {
+	if psink.checkpoint == nil {
+		return time.Time{}, nil, ErrNoCheckpoint
+	}
+	filePath := psink.checkpoint.FilePath
+	if _, err := os.Stat(filePath); err != nil {
+		if _, walErr := os.Stat(filePath + checkpoint.WAL_SUFFIX); walErr != nil {
+			return time.Time{}, nil, ErrCheckpointNotSaved
+		}
+	}
+	saved := checkpoint.NewJSONCheckpoint(filePath)
+	if err := saved.Load(); err != nil {
+		return time.Time{}, nil, err
+	}
+
+	live := checkpoint.NewJSONCheckpoint(filePath)
+	psink.lock.RLock()
+	for name, vec := range psink.counters {
+		if psink.checkpoint.Policy(name) != config.PERSISTENCE_EPHEMERAL {
+			live.CounterValues[name] = collectValues(vec)
+		}
+	}
+	for name, vec := range psink.gauges {
+		if psink.checkpoint.Policy(name) != config.PERSISTENCE_EPHEMERAL {
+			live.GaugeValues[name] = collectValues(vec)
+		}
+	}
+	psink.lock.RUnlock()
+
+	return saved.SavedAt, checkpoint.Diff(saved, live), nil
+}
+
+// labelKey -> value of all series of a counter or gauge vector
+func collectValues(collector prometheus.Collector) map[string]float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	values := make(map[string]float64)
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		labels := make(map[string]string, len(m.GetLabel()))
+		for _, pair := range m.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		if m.Counter != nil {
+			values[util.JoinMapEntries(labels)] = m.GetCounter().GetValue()
+		} else {
+			values[util.JoinMapEntries(labels)] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
@@ -0,0 +1,175 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// remap updates conflicting with an existing metric to a suffixed name instead of rejecting them
+func (psink *PrometheusSink) SetRemapConflicts(remap bool) {
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	psink.remapConflicts = remap
+}
+
+// kind of the existing metric, empty if there is none; caller must hold the read or write lock
+func (psink *PrometheusSink) kindOf(name string) string {
+	if _, ok := psink.counters[name]; ok {
+		return KIND_COUNTER
+	}
+	if _, ok := psink.gauges[name]; ok {
+		return KIND_GAUGE
+	}
+	if _, ok := psink.histograms[name]; ok {
+		return KIND_HISTOGRAM
+	}
+	if _, ok := psink.summaries[name]; ok {
+		return KIND_SUMMARY
+	}
+	return ""
+}
+
+// error describing why an update of kind with labels can't be recorded under name,
+// nil if it matches the existing metric or there is none; caller must hold the read or write lock
+func (psink *PrometheusSink) conflictWith(kind, name string, labels map[string]string) *ConflictError {
+	existing := psink.kindOf(name)
+	if existing == "" {
+		return nil
+	}
+	if existing != kind {
+		return &ConflictError{Metric: name, Reason: "type", Detail: fmt.Sprintf("exists as %s, not %s", existing, kind)}
+	}
+	labelNames := psink.labelNames[name]
+	if len(labelNames) != len(labels) {
+		return labelConflict(name, labelNames, labels)
+	}
+	for _, label := range labelNames {
+		if _, ok := labels[label]; !ok {
+			return labelConflict(name, labelNames, labels)
+		}
+	}
+	return nil
+}
+
+// ConflictError is returned for updates that don't match the type or label names of an existing metric
+type ConflictError struct {
+	Metric string
+	// "type", "labels" or "registration"
+	Reason string
+	Detail string
+}
+
+func (err *ConflictError) Error() string {
+	return fmt.Sprintf("metric %s conflicts with existing metric: %s", err.Metric, err.Detail)
+}
+
+func labelConflict(name string, labelNames []string, labels map[string]string) *ConflictError {
+	pushed := util.SortedKeysFromMap(labels)
+	return &ConflictError{Metric: name, Reason: "labels", Detail: fmt.Sprintf("has labels [%s], got [%s]",
+		strings.Join(labelNames, ","), strings.Join(pushed, ","))}
+}
+
+// implements metrics.SeriesChecker; registers the metric if it doesn't exist yet,
+// so names clashing with other collectors are reported too
+func (psink *PrometheusSink) CheckSeries(ctx context.Context, name, kind string, labels map[string]string) error {
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+
+	var err error
+	switch kind {
+	case KIND_COUNTER:
+		_, _, err = lookup(ctx, psink, kind, psink.counters, name, labels, psink.getOrCreateCounter)
+	case KIND_GAUGE:
+		_, _, err = lookup(ctx, psink, kind, psink.gauges, name, labels, psink.getOrCreateGauge)
+	case KIND_HISTOGRAM:
+		_, _, err = lookup(ctx, psink, kind, psink.histograms, name, labels, psink.getOrCreateHistogram)
+	case KIND_SUMMARY:
+		_, _, err = lookup(ctx, psink, kind, psink.summaries, name, labels, psink.getOrCreateSummary)
+	}
+	return err
+}
+
+// returns the name and vector an update is recorded in, remapping or rejecting conflicting updates;
+// caller must hold the read lock, which is held again on return
+func lookup[V any](ctx context.Context, psink *PrometheusSink, kind string, vectors map[string]V, name string, labels map[string]string,
+	create func(name string, labelNames []string) (V, error)) (string, V, error) {
+
+	var vec V
+	// the series key of such labels couldn't be split into them again, see util.JoinMapEntries
+	if label, invalid := util.InvalidLabelValue(labels); invalid {
+		conflict := &ConflictError{Metric: name, Reason: "labels",
+			Detail: fmt.Sprintf("value of label %s contains %q", label, util.MAP_ENTRY_SEPARATOR)}
+		psink.countConflict(ctx, conflict)
+		return name, vec, conflict
+	}
+	if conflict := psink.conflictWith(kind, name, labels); conflict != nil {
+		if !psink.remapConflicts {
+			psink.countConflict(ctx, conflict)
+			return name, vec, conflict
+		}
+		remapped, err := psink.remap(ctx, kind, name, labels)
+		if err != nil {
+			psink.countConflict(ctx, err)
+			return name, vec, err
+		}
+		name = remapped
+	}
+
+	if existing, ok := vectors[name]; ok {
+		return name, existing, nil
+	}
+	psink.lock.RUnlock()
+	psink.lock.Lock()
+	// getOrCreate* returns the vector if another goroutine created it in between
+	vec, err := create(name, util.SortedKeysFromMap(labels))
+	psink.lock.Unlock()
+	psink.lock.RLock()
+	if err != nil {
+		conflict := &ConflictError{Metric: name, Reason: "registration", Detail: err.Error()}
+		psink.countConflict(ctx, conflict)
+		return name, vec, conflict
+	}
+	return name, vec, nil
+}
+
+// name of the variant recording updates of kind with these label names, created on first use;
+// caller must hold the read lock, which is held again on return
+func (psink *PrometheusSink) remap(ctx context.Context, kind, name string, labels map[string]string) (string, *ConflictError) {
+	key := kind + "|" + name + "|" + strings.Join(util.SortedKeysFromMap(labels), ",")
+	if remapped, ok := psink.remapped[key]; ok {
+		return remapped, nil
+	}
+
+	psink.lock.RUnlock()
+	psink.lock.Lock()
+	defer func() {
+		psink.lock.Unlock()
+		psink.lock.RLock()
+	}()
+	if remapped, ok := psink.remapped[key]; ok {
+		return remapped, nil
+	}
+	for i := 2; i < 2+MAX_CONFLICT_VARIANTS; i++ {
+		variant := fmt.Sprintf("%s_v%d", name, i)
+		if psink.conflictWith(kind, variant, labels) == nil {
+			psink.remapped[key] = variant
+			logger.WarnCtx(ctx, fmt.Sprintf("Metric %s %s conflicts with the existing metric, recording it as %s",
+				kind, name, variant))
+			return variant, nil
+		}
+	}
+	return "", &ConflictError{Metric: name, Reason: "variants",
+		Detail: fmt.Sprintf("no free variant within %d attempts", MAX_CONFLICT_VARIANTS)}
+}
+
+// counts a dropped update and logs the first one per metric and reason
+func (psink *PrometheusSink) countConflict(ctx context.Context, conflict *ConflictError) {
+	psink.conflicts.WithLabelValues(conflict.Metric, conflict.Reason).Inc()
+	if _, logged := psink.loggedConflicts.LoadOrStore(conflict.Metric+"|"+conflict.Reason, true); !logged {
+		logger.WarnCtx(ctx, fmt.Sprintf("Dropping updates: %v", conflict))
+	}
+}
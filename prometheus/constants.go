@@ -0,0 +1,39 @@
+package prometheus
+
+// self-metrics describing the checkpoint restore at startup, see restoreCollector
+const RESTORE_INFO_METRIC = "collector_restore_info"
+const RESTORE_TIMESTAMP_METRIC = "collector_restore_timestamp_seconds"
+const RESTORE_SERIES_METRIC = "collector_restore_series"
+const RESTORE_FILE_AGE_METRIC = "collector_restore_file_age_seconds"
+
+// progress of a lazy restore, 0 pending and a ratio of 1 once all series are restored
+const RESTORE_PENDING_METRIC = "collector_restore_pending_series"
+const RESTORE_PROGRESS_METRIC = "collector_restore_progress_ratio"
+
+// suffix of markers exposing the restored baseline of counters, see EnableRestoreMarkers
+const RESTORED_SUFFIX = "_restored"
+
+// suffix of the age of series, see EnableFreshness
+const FRESHNESS_SUFFIX = "_age_seconds"
+
+// number of lock shards for series update tracking in PrometheusSink
+const SINK_SHARDS = 64
+
+// metric kinds, as used by pushes
+const KIND_COUNTER = "counter"
+const KIND_GAUGE = "gauge"
+const KIND_HISTOGRAM = "histogram"
+const KIND_SUMMARY = "summary"
+
+// updates dropped because the metric conflicts with an existing one, by metric and reason
+const CONFLICT_METRIC = "collector_metric_conflicts_total"
+
+// conflicting updates are remapped to "<name>_v2", "<name>_v3", ... with this many attempts
+const MAX_CONFLICT_VARIANTS = 10
+
+// counter updates rounded because the value exceeds float64 precision, by metric
+const PRECISION_LOSS_METRIC = "collector_counter_precision_loss_total"
+
+// gauges exposing the exact value of split counters as high * 2^32 + low, see SetCounterPrecision
+const SPLIT_HIGH_SUFFIX = "_high"
+const SPLIT_LOW_SUFFIX = "_low"
@@ -0,0 +1,37 @@
+package prometheus
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestEvictOldestKeepsNewest(t *testing.T) {
+	sink := NewSinkWithRegistry(prometheus.NewRegistry(), "", 0)
+	for i := 0; i < 10; i++ {
+		sink.SetGauge("evict_gauge", map[string]string{"series": fmt.Sprint(i)}, 1)
+	}
+	// series i was updated i minutes ago, so 9, 8 and 7 are the oldest
+	base := time.Now()
+	for i := 0; i < 10; i++ {
+		sink.shard("evict_gauge").lastUpdate["evict_gauge"][fmt.Sprintf("series=%d", i)] = base.Add(-time.Duration(i) * time.Minute)
+	}
+
+	evicted := sink.EvictOldest(3)
+	slices.Sort(evicted)
+	expected := []string{"evict_gauge{series=7}", "evict_gauge{series=8}", "evict_gauge{series=9}"}
+	if !slices.Equal(evicted, expected) {
+		t.Fatalf("evicted %v, expected %v", evicted, expected)
+	}
+	for i := 0; i < 10; i++ {
+		if tracked := sink.tracked("evict_gauge", fmt.Sprintf("series=%d", i)); tracked != (i < 7) {
+			t.Errorf("series %d tracked: %v", i, tracked)
+		}
+	}
+	if evicted := sink.EvictOldest(0); len(evicted) != 0 {
+		t.Fatalf("evicting no series evicted %v", evicted)
+	}
+}
@@ -0,0 +1,73 @@
+package prometheus
+
+import (
+	"path"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// FilteredGatherer gathers the metric families of a filtered scrape endpoint:
+// families whose name is included and not excluded, with the series matching the labels
+type FilteredGatherer struct {
+	Gatherer prometheus.Gatherer
+	Filter   config.ScrapeEndpointConfig
+}
+
+func (fg *FilteredGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := fg.Gatherer.Gather()
+	filtered := families[:0]
+	for _, family := range families {
+		if !fg.includes(family.GetName()) {
+			continue
+		}
+		if len(fg.Filter.Labels) > 0 {
+			series := family.Metric[:0]
+			for _, metric := range family.Metric {
+				if matchesLabels(metric, fg.Filter.Labels) {
+					series = append(series, metric)
+				}
+			}
+			if len(series) == 0 {
+				continue
+			}
+			family.Metric = series
+		}
+		filtered = append(filtered, family)
+	}
+	// families gathered despite an error are served, like promhttp does for the unfiltered registry
+	return filtered, err
+}
+
+func (fg *FilteredGatherer) includes(name string) bool {
+	included := len(fg.Filter.Include) == 0
+	for _, pattern := range fg.Filter.Include {
+		if matched, _ := path.Match(pattern, name); matched {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range fg.Filter.Exclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesLabels(metric *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range metric.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok {
+			if value != pair.GetValue() {
+				return false
+			}
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
@@ -0,0 +1,84 @@
+package prometheus
+
+import (
+	"path"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// freshnessCollector exposes "<name>_age_seconds" with the labels of each series of matching metrics,
+// computed at scrape time from the last update, so alert rules can ignore stale values:
+//
+//	my_metric unless on(source) my_metric_age_seconds > 300
+//
+// metrics whose "<name>_age_seconds" is an updated metric itself get no age, exposing both
+// would fail the scrape
+type freshnessCollector struct {
+	psink    *PrometheusSink
+	patterns []string
+}
+
+// starts exposing age of series for metrics matching the glob patterns ("*" for all)
+func (psink *PrometheusSink) EnableFreshness(patterns []string) {
+	psink.registerer.MustRegister(&freshnessCollector{psink: psink, patterns: patterns})
+}
+
+// series set is dynamic, so no descriptors are announced (unchecked collector)
+func (collector *freshnessCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+// metrics are built under the read lock and sent after releasing it, a slow scrape must
+// not hold up updates waiting for the write lock
+func (collector *freshnessCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range collector.collect() {
+		ch <- metric
+	}
+}
+
+func (collector *freshnessCollector) collect() []prometheus.Metric {
+	psink := collector.psink
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+
+	now := time.Now()
+	var metrics []prometheus.Metric
+	descs := make(map[string]*prometheus.Desc)
+	psink.forEachSeries(func(name, labelsKey string, updated time.Time) {
+		if !collector.matches(name) {
+			return
+		}
+		if _, collides := psink.labelNames[name+FRESHNESS_SUFFIX]; collides {
+			return
+		}
+		labelNames := psink.labelNames[name]
+		desc, ok := descs[name]
+		if !ok {
+			desc = prometheus.NewDesc(name+FRESHNESS_SUFFIX, "seconds since "+name+" was last updated", labelNames, nil)
+			descs[name] = desc
+		}
+		labels, err := util.MapFromString(labelsKey)
+		if err != nil {
+			return
+		}
+		labelValues := make([]string, 0, len(labelNames))
+		for _, labelName := range labelNames {
+			labelValues = append(labelValues, labels[labelName])
+		}
+		metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, now.Sub(updated).Seconds(), labelValues...)
+		if err != nil {
+			return
+		}
+		metrics = append(metrics, metric)
+	})
+	return metrics
+}
+
+func (collector *freshnessCollector) matches(name string) bool {
+	for _, pattern := range collector.patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFreshnessSkipsAgeNamedLikeAMetric(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	sink := NewSinkWithRegistry(registry, "", 0)
+	sink.EnableFreshness([]string{"*"})
+	sink.SetGauge("backup", nil, 1)
+	sink.SetGauge("backup_age_seconds", nil, 3600)
+	sink.SetGauge("vm_count", nil, 5)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	found := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			found[family.GetName()] = metric.GetGauge().GetValue()
+		}
+	}
+	if found["backup_age_seconds"] != 3600 {
+		t.Fatalf("backup_age_seconds is %v, expected the pushed 3600", found["backup_age_seconds"])
+	}
+	if _, ok := found["vm_count_age_seconds"]; !ok {
+		t.Fatal("vm_count has no age")
+	}
+}
+
+func TestSeparatorInLabelValueIsRejected(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	sink := NewSinkWithRegistry(registry, "", 0)
+	sink.EnableFreshness([]string{"*"})
+	sink.SetGauge("vm_count", map[string]string{"cluster": "a|b=c"}, 5)
+	sink.SetGauge("vm_count", map[string]string{"cluster": "a=b"}, 6)
+
+	// a scrape parses the series keys of the age metrics
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	found := make(map[string]int)
+	for _, family := range families {
+		found[family.GetName()] += len(family.GetMetric())
+	}
+	if found["vm_count"] != 1 || found["vm_count_age_seconds"] != 1 {
+		t.Fatalf("got %v, expected only the series without '|'", found)
+	}
+}
@@ -0,0 +1,89 @@
+package prometheus
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// validates and installs per-metric histogram bucket schemas and restores checkpointed
+// histograms with them, must be called before the first observation
+func (psink *PrometheusSink) SetHistogramSchemas(schemas []config.HistogramSchema) error {
+	if err := ValidateHistogramSchemas(schemas); err != nil {
+		return err
+	}
+
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	psink.histogramSchemas = schemas
+	psink.restoreHistograms()
+	return nil
+}
+
+// checks patterns and bucket parameters the Prometheus client would panic on
+func ValidateHistogramSchemas(schemas []config.HistogramSchema) error {
+	for _, schema := range schemas {
+		if _, err := path.Match(schema.Match, ""); err != nil {
+			return fmt.Errorf("invalid histogram match pattern %q: %w", schema.Match, err)
+		}
+		if schema.Buckets != nil {
+			if _, err := bucketsFromConfig(*schema.Buckets); err != nil {
+				return fmt.Errorf("histogram schema %q: %w", schema.Match, err)
+			}
+		}
+		if schema.Native != nil && schema.Native.BucketFactor <= 1 {
+			return fmt.Errorf("histogram schema %q: native bucketFactor must be > 1", schema.Match)
+		}
+	}
+	return nil
+}
+
+// histogram options for a metric name from the first matching schema
+func (psink *PrometheusSink) histogramOpts(name string) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{
+		Name: name,
+		Help: name + " histogram",
+	}
+	for _, schema := range psink.histogramSchemas {
+		if matched, _ := path.Match(schema.Match, name); !matched {
+			continue
+		}
+		if schema.Buckets != nil {
+			// validated in SetHistogramSchemas
+			opts.Buckets, _ = bucketsFromConfig(*schema.Buckets)
+		}
+		if schema.Native != nil {
+			opts.NativeHistogramBucketFactor = schema.Native.BucketFactor
+			opts.NativeHistogramMaxBucketNumber = schema.Native.MaxBuckets
+			opts.NativeHistogramMinResetDuration = schema.Native.MinResetDuration.Duration
+		}
+		break
+	}
+	return opts
+}
+
+// computes bucket upper bounds, checking parameters the Prometheus helpers would panic on
+func bucketsFromConfig(bc config.BucketsConfig) ([]float64, error) {
+	switch bc.Type {
+	case "linear":
+		if bc.Count < 1 || bc.Width <= 0 {
+			return nil, fmt.Errorf("linear buckets need count >= 1 and width > 0")
+		}
+		return prometheus.LinearBuckets(bc.Start, bc.Width, bc.Count), nil
+	case "exponential":
+		if bc.Count < 1 || bc.Start <= 0 || bc.Factor <= 1 {
+			return nil, fmt.Errorf("exponential buckets need count >= 1, start > 0 and factor > 1")
+		}
+		return prometheus.ExponentialBuckets(bc.Start, bc.Factor, bc.Count), nil
+	case "explicit":
+		if len(bc.Values) == 0 || !slices.IsSorted(bc.Values) {
+			return nil, fmt.Errorf("explicit buckets need increasing values")
+		}
+		return bc.Values, nil
+	default:
+		return nil, fmt.Errorf("unknown bucket type %q (use linear, exponential or explicit)", bc.Type)
+	}
+}
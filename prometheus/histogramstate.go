@@ -0,0 +1,351 @@
+package prometheus
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/checkpoint"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// histogramCollector exposes a histogram vector with the state restored from checkpoint
+// added to each series; Prometheus histograms cannot be set, so restored buckets, sum and
+// count are kept as a baseline merged into every scrape instead
+type histogramCollector struct {
+	vec *prometheus.HistogramVec
+
+	lock sync.Mutex
+	// labelKey -> restored state
+	baselines map[string]checkpoint.HistogramState
+}
+
+func newHistogramCollector(vec *prometheus.HistogramVec) *histogramCollector {
+	return &histogramCollector{vec: vec, baselines: make(map[string]checkpoint.HistogramState)}
+}
+
+func (collector *histogramCollector) Describe(ch chan<- *prometheus.Desc) {
+	collector.vec.Describe(ch)
+}
+
+func (collector *histogramCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.lock.Lock()
+	empty := len(collector.baselines) == 0
+	collector.lock.Unlock()
+	if empty {
+		collector.vec.Collect(ch)
+		return
+	}
+
+	live := make(chan prometheus.Metric)
+	go func() {
+		collector.vec.Collect(live)
+		close(live)
+	}()
+	for metric := range live {
+		var out dto.Metric
+		if err := metric.Write(&out); err != nil {
+			ch <- metric
+			continue
+		}
+		collector.lock.Lock()
+		baseline, restored := collector.baselines[labelsKeyOf(&out)]
+		collector.lock.Unlock()
+		if !restored {
+			ch <- metric
+			continue
+		}
+		ch <- &restoredHistogram{Metric: metric, baseline: baseline}
+	}
+}
+
+// a live series the baseline is added to when written
+type restoredHistogram struct {
+	prometheus.Metric
+	baseline checkpoint.HistogramState
+}
+
+func (metric *restoredHistogram) Write(out *dto.Metric) error {
+	if err := metric.Metric.Write(out); err != nil {
+		return err
+	}
+	addHistogramState(out.Histogram, metric.baseline)
+	return nil
+}
+
+// restores the state of a series, false if the bucket layout of the histogram changed since
+// it was saved; the series is created so it is exposed before its next observation
+func (collector *histogramCollector) restore(labels map[string]string, state checkpoint.HistogramState) (bool, error) {
+	histogram, err := collector.vec.GetMetricWith(labels)
+	if err != nil {
+		return false, err
+	}
+	metric, ok := histogram.(prometheus.Metric)
+	if !ok {
+		return false, fmt.Errorf("unexpected histogram type %T", histogram)
+	}
+	var out dto.Metric
+	if err := metric.Write(&out); err != nil {
+		return false, err
+	}
+	if !compatibleHistogram(out.Histogram, state) {
+		collector.vec.Delete(labels)
+		return false, nil
+	}
+	collector.lock.Lock()
+	collector.baselines[util.JoinMapEntries(labels)] = state
+	collector.lock.Unlock()
+	return true, nil
+}
+
+// drops the baseline of a deleted series, so it starts empty when it comes back
+func (collector *histogramCollector) forget(labelsKey string) {
+	collector.lock.Lock()
+	delete(collector.baselines, labelsKey)
+	collector.lock.Unlock()
+}
+
+// current states of all series including restored baselines
+func (collector *histogramCollector) states() map[string]checkpoint.HistogramState {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	states := make(map[string]checkpoint.HistogramState)
+	for metric := range ch {
+		var out dto.Metric
+		if err := metric.Write(&out); err != nil || out.Histogram == nil {
+			continue
+		}
+		// JSON cannot encode them, such a sum is of no use after restart either
+		if sum := out.Histogram.GetSampleSum(); math.IsNaN(sum) || math.IsInf(sum, 0) {
+			continue
+		}
+		states[labelsKeyOf(&out)] = histogramState(out.Histogram)
+	}
+	return states
+}
+
+// states of all histogram series for the checkpoint, see checkpoint.HistogramSource
+func (psink *PrometheusSink) histogramStates() map[string]map[string]checkpoint.HistogramState {
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+
+	histograms := make(map[string]map[string]checkpoint.HistogramState, len(psink.histogramCollectors))
+	// not restored yet, kept as they were
+	for name, states := range psink.pendingHistograms {
+		histograms[name] = states
+	}
+	for name, collector := range psink.histogramCollectors {
+		if states := collector.states(); len(states) > 0 {
+			histograms[name] = states
+		}
+	}
+	return histograms
+}
+
+// creates the histograms restored from checkpoint, once their bucket schemas are known;
+// caller must hold the lock
+func (psink *PrometheusSink) restoreHistograms() {
+	for name, series := range psink.pendingHistograms {
+		if kind := psink.kindOf(name); kind != "" && kind != KIND_HISTOGRAM {
+			logger.Warn(fmt.Sprintf("Skipping restore of histogram %s: exists as %s", name, kind))
+			delete(psink.pendingHistograms, name)
+			continue
+		}
+		for labelsKey := range series {
+			labels, err := util.MapFromString(labelsKey)
+			if err == nil {
+				// label names are not known before the first series is restored, restores the others too
+				_, err = psink.getOrCreateHistogram(name, util.SortedKeysFromMap(labels))
+			}
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Skipping restore of histogram %s: %v", name, err))
+				delete(psink.pendingHistograms, name)
+			}
+			break
+		}
+	}
+}
+
+// restores the checkpointed series of a histogram just created; caller must hold the lock
+func (psink *PrometheusSink) restorePendingHistogram(name string) {
+	series, pending := psink.pendingHistograms[name]
+	if !pending {
+		return
+	}
+	delete(psink.pendingHistograms, name)
+	for labelsKey, state := range series {
+		labels, err := util.MapFromString(labelsKey)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", name, labelsKey, err))
+			continue
+		}
+		if conflict := psink.conflictWith(KIND_HISTOGRAM, name, labels); conflict != nil {
+			logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", name, labelsKey, conflict))
+			continue
+		}
+		ok, err := psink.histogramCollectors[name].restore(labels, state)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", name, labelsKey, err))
+			continue
+		}
+		if !ok {
+			logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: bucket layout changed since the checkpoint", name, labelsKey))
+			continue
+		}
+		psink.touch(name, labelsKey)
+		if psink.restoreCollector != nil {
+			psink.restoreCollector.info.histograms++
+		}
+	}
+}
+
+func labelsKeyOf(metric *dto.Metric) string {
+	labels := make(map[string]string, len(metric.GetLabel()))
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return util.JoinMapEntries(labels)
+}
+
+func histogramState(histogram *dto.Histogram) checkpoint.HistogramState {
+	state := checkpoint.HistogramState{Count: histogram.GetSampleCount(), Sum: histogram.GetSampleSum()}
+	for _, bucket := range histogram.GetBucket() {
+		if !math.IsInf(bucket.GetUpperBound(), 1) {
+			state.Buckets = append(state.Buckets, checkpoint.HistogramBucket{UpperBound: bucket.GetUpperBound(), Count: bucket.GetCumulativeCount()})
+		}
+	}
+	if histogram.Schema != nil {
+		schema := histogram.GetSchema()
+		state.Schema = &schema
+		state.ZeroThreshold = histogram.GetZeroThreshold()
+		state.ZeroCount = histogram.GetZeroCount()
+		state.Positive = decodeBuckets(histogram.GetPositiveSpan(), histogram.GetPositiveDelta())
+		state.Negative = decodeBuckets(histogram.GetNegativeSpan(), histogram.GetNegativeDelta())
+	}
+	return state
+}
+
+// classic bucket bounds must be the same, native buckets present on both sides or on none;
+// native schemas may differ, the finer one is reduced when merging
+func compatibleHistogram(histogram *dto.Histogram, state checkpoint.HistogramState) bool {
+	var bounds []float64
+	for _, bucket := range histogram.GetBucket() {
+		if !math.IsInf(bucket.GetUpperBound(), 1) {
+			bounds = append(bounds, bucket.GetUpperBound())
+		}
+	}
+	savedBounds := make([]float64, 0, len(state.Buckets))
+	for _, bucket := range state.Buckets {
+		savedBounds = append(savedBounds, bucket.UpperBound)
+	}
+	return slices.Equal(bounds, savedBounds) && (histogram.Schema == nil) == (state.Schema == nil)
+}
+
+// adds a restored state to a live histogram written by the Prometheus client
+func addHistogramState(histogram *dto.Histogram, state checkpoint.HistogramState) {
+	count := histogram.GetSampleCount() + state.Count
+	sum := histogram.GetSampleSum() + state.Sum
+	histogram.SampleCount, histogram.SampleSum = &count, &sum
+
+	for _, bucket := range histogram.GetBucket() {
+		for _, saved := range state.Buckets {
+			if saved.UpperBound == bucket.GetUpperBound() {
+				cumulative := bucket.GetCumulativeCount() + saved.Count
+				bucket.CumulativeCount = &cumulative
+				break
+			}
+		}
+	}
+
+	if histogram.Schema == nil || state.Schema == nil {
+		return
+	}
+	zeroCount := histogram.GetZeroCount() + state.ZeroCount
+	histogram.ZeroCount = &zeroCount
+	schema := min(histogram.GetSchema(), *state.Schema)
+	positive := mergeBuckets(
+		downscaleBuckets(decodeBuckets(histogram.GetPositiveSpan(), histogram.GetPositiveDelta()), histogram.GetSchema()-schema),
+		downscaleBuckets(state.Positive, *state.Schema-schema))
+	negative := mergeBuckets(
+		downscaleBuckets(decodeBuckets(histogram.GetNegativeSpan(), histogram.GetNegativeDelta()), histogram.GetSchema()-schema),
+		downscaleBuckets(state.Negative, *state.Schema-schema))
+	histogram.Schema = &schema
+	histogram.PositiveSpan, histogram.PositiveDelta = encodeBuckets(positive)
+	histogram.NegativeSpan, histogram.NegativeDelta = encodeBuckets(negative)
+}
+
+// native buckets as index -> count from spans and count deltas
+func decodeBuckets(spans []*dto.BucketSpan, deltas []int64) map[int]uint64 {
+	buckets := make(map[int]uint64)
+	index, next, count := 0, 0, int64(0)
+	for _, span := range spans {
+		// the first offset is the index of the first bucket, the others the gap to the previous span
+		index += int(span.GetOffset())
+		for i := 0; i < int(span.GetLength()) && next < len(deltas); i++ {
+			count += deltas[next]
+			next++
+			if count > 0 {
+				buckets[index] = uint64(count)
+			}
+			index++
+		}
+	}
+	return buckets
+}
+
+// spans and count deltas of native buckets
+func encodeBuckets(buckets map[int]uint64) ([]*dto.BucketSpan, []int64) {
+	indexes := make([]int, 0, len(buckets))
+	for index, count := range buckets {
+		if count > 0 {
+			indexes = append(indexes, index)
+		}
+	}
+	slices.Sort(indexes)
+
+	var spans []*dto.BucketSpan
+	var deltas []int64
+	next, previous := 0, int64(0)
+	for i, index := range indexes {
+		if i == 0 || index != next {
+			offset := int32(index - next)
+			spans = append(spans, &dto.BucketSpan{Offset: &offset, Length: new(uint32)})
+		}
+		*spans[len(spans)-1].Length++
+		count := int64(buckets[index])
+		deltas = append(deltas, count-previous)
+		previous, next = count, index+1
+	}
+	return spans, deltas
+}
+
+// buckets of a schema reduced by delta, each covering 2^delta buckets of the original one
+func downscaleBuckets(buckets map[int]uint64, delta int32) map[int]uint64 {
+	if delta <= 0 {
+		return buckets
+	}
+	scaled := make(map[int]uint64, len(buckets))
+	for index, count := range buckets {
+		// bucket i covers (base^(i-1), base^i], the shift rounds towards negative infinity
+		scaled[((index-1)>>delta)+1] += count
+	}
+	return scaled
+}
+
+func mergeBuckets(a, b map[int]uint64) map[int]uint64 {
+	merged := make(map[int]uint64, len(a)+len(b))
+	for index, count := range a {
+		merged[index] += count
+	}
+	for index, count := range b {
+		merged[index] += count
+	}
+	return merged
+}
@@ -0,0 +1,93 @@
+package prometheus
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/checkpoint"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func span(offset int32, length uint32) *dto.BucketSpan {
+	return &dto.BucketSpan{Offset: &offset, Length: &length}
+}
+
+func TestDecodeBuckets(t *testing.T) {
+	// buckets -2 and -1, a gap of three, bucket 3
+	buckets := decodeBuckets([]*dto.BucketSpan{span(-2, 2), span(3, 1)}, []int64{1, 1, -1})
+	expected := map[int]uint64{-2: 1, -1: 2, 3: 1}
+	if !maps.Equal(buckets, expected) {
+		t.Fatalf("decoded %v, expected %v", buckets, expected)
+	}
+}
+
+func TestEncodeBucketsRoundTrips(t *testing.T) {
+	for _, buckets := range []map[int]uint64{
+		{},
+		{0: 4},
+		{-3: 1, -2: 5, 1: 2, 2: 2, 7: 9},
+		// empty buckets are left out
+		{1: 3, 2: 0, 3: 1},
+	} {
+		spans, deltas := encodeBuckets(buckets)
+		decoded := decodeBuckets(spans, deltas)
+		expected := maps.Clone(buckets)
+		maps.DeleteFunc(expected, func(index int, count uint64) bool { return count == 0 })
+		if !maps.Equal(decoded, expected) {
+			t.Fatalf("%v encoded as %v %v, decoded as %v", buckets, spans, deltas, decoded)
+		}
+	}
+}
+
+func TestDownscaleBuckets(t *testing.T) {
+	buckets := map[int]uint64{-2: 1, -1: 1, 0: 1, 1: 1, 2: 2, 3: 4}
+	cases := []struct {
+		delta    int32
+		expected map[int]uint64
+	}{
+		{0, buckets},
+		// bucket i of the coarser schema covers buckets 2i-1 and 2i, or 4i-3 to 4i
+		{1, map[int]uint64{-1: 1, 0: 2, 1: 3, 2: 4}},
+		{2, map[int]uint64{0: 3, 1: 7}},
+	}
+	for _, c := range cases {
+		if scaled := downscaleBuckets(buckets, c.delta); !maps.Equal(scaled, c.expected) {
+			t.Errorf("delta %d: got %v, expected %v", c.delta, scaled, c.expected)
+		}
+	}
+}
+
+func TestAddHistogramState(t *testing.T) {
+	count, sum := uint64(3), 4.0
+	le1, le5, cumulative1, cumulative5 := 1.0, 5.0, uint64(2), uint64(3)
+	schema, zeroCount := int32(1), uint64(1)
+	positiveSpans, positiveDeltas := encodeBuckets(map[int]uint64{1: 1, 2: 1})
+	live := &dto.Histogram{
+		SampleCount: &count, SampleSum: &sum,
+		Bucket: []*dto.Bucket{{UpperBound: &le1, CumulativeCount: &cumulative1}, {UpperBound: &le5, CumulativeCount: &cumulative5}},
+		Schema: &schema, ZeroCount: &zeroCount, PositiveSpan: positiveSpans, PositiveDelta: positiveDeltas,
+	}
+	savedSchema := int32(0)
+	addHistogramState(live, checkpoint.HistogramState{
+		Count: 4, Sum: 10,
+		Buckets: []checkpoint.HistogramBucket{{UpperBound: 1, Count: 1}, {UpperBound: 5, Count: 4}},
+		Schema:  &savedSchema, ZeroCount: 2, Positive: map[int]uint64{1: 3}, Negative: map[int]uint64{-1: 1},
+	})
+
+	if live.GetSampleCount() != 7 || live.GetSampleSum() != 14 {
+		t.Fatalf("count %d and sum %v, expected 7 and 14", live.GetSampleCount(), live.GetSampleSum())
+	}
+	if live.Bucket[0].GetCumulativeCount() != 3 || live.Bucket[1].GetCumulativeCount() != 7 {
+		t.Fatalf("buckets %d and %d, expected 3 and 7", live.Bucket[0].GetCumulativeCount(), live.Bucket[1].GetCumulativeCount())
+	}
+	// the finer live schema is reduced to the saved one
+	if live.GetSchema() != 0 || live.GetZeroCount() != 3 {
+		t.Fatalf("schema %d and zero count %d, expected 0 and 3", live.GetSchema(), live.GetZeroCount())
+	}
+	if positive := decodeBuckets(live.GetPositiveSpan(), live.GetPositiveDelta()); !maps.Equal(positive, map[int]uint64{1: 5}) {
+		t.Fatalf("positive buckets %v, expected {1: 5}", positive)
+	}
+	if negative := decodeBuckets(live.GetNegativeSpan(), live.GetNegativeDelta()); !maps.Equal(negative, map[int]uint64{-1: 1}) {
+		t.Fatalf("negative buckets %v, expected {-1: 1}", negative)
+	}
+}
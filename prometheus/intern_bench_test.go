@@ -0,0 +1,59 @@
+package prometheus
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// metrics per VM in the heap benchmarks, series of the same VM share their labels
+const HEAP_BENCH_METRICS = 10
+
+// heap retained per series of vSphere-like labels, with and without interning
+//
+//	go test ./prometheus -run '^$' -bench SeriesHeap -benchtime 3x
+func BenchmarkSeriesHeap(b *testing.B) {
+	b.Run("30000-series", seriesHeap(30000, false))
+	b.Run("30000-series/interned", seriesHeap(30000, true))
+}
+
+// fills a sink with n series, HEAP_BENCH_METRICS metrics per VM, and reports the heap they
+// retain; labels are created per update, as decoded from pushes or poll responses
+func seriesHeap(n int, interned bool) func(b *testing.B) {
+	return func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			b.StartTimer()
+
+			sink := newBenchSink(b, false)
+			if interned {
+				sink.SetInterner(util.NewInterner(config.DEFAULT_INTERN_MAX_STRINGS))
+			}
+			for s := 0; s < n; s++ {
+				vm := s / HEAP_BENCH_METRICS
+				labels := map[string]string{
+					"vcenter":    strings.Clone("vc01.example.com"),
+					"datacenter": strings.Clone("dc-frankfurt"),
+					"cluster":    fmt.Sprintf("cluster-prod-%02d", vm%8),
+					"host":       fmt.Sprintf("esx%03d.example.com", vm%200),
+					"vm":         fmt.Sprintf("vm-%06d", vm),
+				}
+				sink.SetGauge(fmt.Sprintf("bench_vm_metric_%d", s%HEAP_BENCH_METRICS), labels, float64(s))
+			}
+
+			b.StopTimer()
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(n), "heap-B/series")
+			runtime.KeepAlive(sink)
+			b.StartTimer()
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package prometheus
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// a checkpointed series waiting for the lazy restore
+type pendingSeries struct {
+	kind      string
+	name      string
+	labelsKey string
+}
+
+// series of the checkpoint not restored yet, see config.RESTORE_LAZY; updates claim their
+// series before applying themselves, so the background restore never overwrites newer values
+type lazyRestore struct {
+	lock sync.Mutex
+	info *restoreInfo
+	// kind -> name -> (labelsKey -> checkpointed value), restored or claimed series are removed
+	values map[string]map[string]map[string]float64
+	// restore order, priority metrics first
+	order []pendingSeries
+	total int
+	done  int
+}
+
+// registers the checkpointed metrics and restores their series in the background;
+// the checkpoint holds the restored values already, so saves in between lose nothing
+func (psink *PrometheusSink) startLazyRestore(savedAt time.Time, cfg config.RestoreConfig) {
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+
+	checkpoint := psink.checkpoint
+	info := &restoreInfo{
+		file:             checkpoint.FilePath,
+		restoredAt:       time.Now(),
+		savedAt:          savedAt,
+		counterBaselines: make(map[string]map[string]float64),
+	}
+	lazy := &lazyRestore{
+		info:   info,
+		values: map[string]map[string]map[string]float64{KIND_COUNTER: {}, KIND_GAUGE: {}},
+	}
+	// one bucket per priority glob and one for all other metrics
+	buckets := make([][]pendingSeries, len(cfg.Priority)+1)
+	queue := func(kind string, values map[string]map[string]float64, create func(name string, labelNames []string) error) {
+		for _, name := range slices.Sorted(maps.Keys(values)) {
+			series := values[name]
+			if len(series) == 0 {
+				continue
+			}
+			// label names of the vector are taken from any series, the others are checked when restored
+			var labels map[string]string
+			var err error
+			for labelsKey := range series {
+				labels, err = util.MapFromString(labelsKey)
+				break
+			}
+			if err == nil {
+				if conflict := psink.conflictWith(kind, name, labels); conflict != nil {
+					err = conflict
+				} else {
+					err = create(name, util.SortedKeysFromMap(labels))
+				}
+			}
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Skipping restore of %s: %v", name, err))
+				continue
+			}
+			// copied, the checkpoint keeps updating its map
+			copied := maps.Clone(series)
+			lazy.values[kind][name] = copied
+			if kind == KIND_COUNTER {
+				info.counterBaselines[name] = maps.Clone(series)
+			}
+			bucket := priorityOf(cfg.Priority, name)
+			for labelsKey := range copied {
+				buckets[bucket] = append(buckets[bucket], pendingSeries{kind: kind, name: name, labelsKey: labelsKey})
+			}
+		}
+	}
+	queue(KIND_COUNTER, checkpoint.GetCounterValues(), func(name string, labelNames []string) error {
+		_, err := psink.getOrCreateCounter(name, labelNames)
+		return err
+	})
+	queue(KIND_GAUGE, checkpoint.GetGaugeValues(), func(name string, labelNames []string) error {
+		_, err := psink.getOrCreateGauge(name, labelNames)
+		return err
+	})
+	for _, bucket := range buckets {
+		lazy.order = append(lazy.order, bucket...)
+	}
+	lazy.total = len(lazy.order)
+
+	// histograms are restored when created in both modes, see restoreFromCheckpoint
+	psink.pendingHistograms = checkpoint.GetHistogramValues()
+	psink.registerRestoreInfo(info)
+
+	if lazy.total == 0 {
+		return
+	}
+	psink.lazy.Store(lazy)
+	logger.Info(fmt.Sprintf("Restoring %d series from checkpoint in the background", lazy.total))
+	go psink.runLazyRestore(lazy, cfg)
+}
+
+// index of the first priority glob matching name, len(priority) for none
+func priorityOf(priority []string, name string) int {
+	for i, pattern := range priority {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return i
+		}
+	}
+	return len(priority)
+}
+
+func (psink *PrometheusSink) runLazyRestore(lazy *lazyRestore, cfg config.RestoreConfig) {
+	started := time.Now()
+	batchSize := cfg.BatchSize
+	if batchSize < 1 {
+		batchSize = config.DEFAULT_RESTORE_BATCH_SIZE
+	}
+	for start := 0; start < len(lazy.order); start += batchSize {
+		psink.restoreBatch(lazy, lazy.order[start:min(start+batchSize, len(lazy.order))])
+		if cfg.BatchPause.Duration > 0 {
+			time.Sleep(cfg.BatchPause.Duration)
+		}
+	}
+	psink.lazy.Store(nil)
+	logger.Info(fmt.Sprintf("Restored %d counter and %d gauge series from checkpoint in %v",
+		lazy.info.counters, lazy.info.gauges, time.Since(started).Round(time.Millisecond)))
+}
+
+// restores the batch of series not claimed by updates in between
+func (psink *PrometheusSink) restoreBatch(lazy *lazyRestore, batch []pendingSeries) {
+	// vectors are only created, deleted or iterated under the write lock
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+	lazy.lock.Lock()
+	defer lazy.lock.Unlock()
+
+	for _, series := range batch {
+		value, ok := lazy.take(series.kind, series.name, series.labelsKey)
+		if !ok {
+			continue
+		}
+		labels, err := util.MapFromString(series.labelsKey)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", series.name, series.labelsKey, err))
+			continue
+		}
+		if conflict := psink.conflictWith(series.kind, series.name, labels); conflict != nil {
+			logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", series.name, series.labelsKey, conflict))
+			continue
+		}
+		switch series.kind {
+		case KIND_COUNTER:
+			vec, exists := psink.counters[series.name]
+			if !exists {
+				continue
+			}
+			vec.With(labels).Add(value)
+			lazy.info.counters++
+		case KIND_GAUGE:
+			vec, exists := psink.gauges[series.name]
+			if !exists {
+				continue
+			}
+			vec.With(labels).Set(value)
+			lazy.info.gauges++
+		}
+		psink.touch(series.name, series.labelsKey)
+	}
+}
+
+// removes a pending series, returning its checkpointed value; caller must hold lazy.lock
+func (lazy *lazyRestore) take(kind, name, labelsKey string) (float64, bool) {
+	series := lazy.values[kind][name]
+	value, ok := series[labelsKey]
+	if !ok {
+		return 0, false
+	}
+	delete(series, labelsKey)
+	if len(series) == 0 {
+		delete(lazy.values[kind], name)
+	}
+	lazy.done++
+	return value, true
+}
+
+// removes a series of an update from the lazy restore before the update is applied, returning
+// the checkpointed value if it was still pending; caller must hold the read or write lock
+func (psink *PrometheusSink) claimPending(kind, name, labelsKey string) (float64, bool) {
+	lazy := psink.lazy.Load()
+	if lazy == nil {
+		return 0, false
+	}
+	lazy.lock.Lock()
+	defer lazy.lock.Unlock()
+	value, ok := lazy.take(kind, name, labelsKey)
+	// counters continue from the checkpointed value, gauges are superseded by the update
+	if ok && kind == KIND_COUNTER {
+		lazy.info.counters++
+	}
+	return value, ok
+}
+
+// drops a deleted series from the lazy restore, reports whether it was pending;
+// caller must hold the write lock
+func (psink *PrometheusSink) dropPending(name, labelsKey string) bool {
+	lazy := psink.lazy.Load()
+	if lazy == nil {
+		return false
+	}
+	lazy.lock.Lock()
+	defer lazy.lock.Unlock()
+	_, counter := lazy.take(KIND_COUNTER, name, labelsKey)
+	_, gauge := lazy.take(KIND_GAUGE, name, labelsKey)
+	return counter || gauge
+}
+
+// drops all series of a deleted metric from the lazy restore, caller must hold the write lock
+func (psink *PrometheusSink) dropPendingMetric(name string) {
+	lazy := psink.lazy.Load()
+	if lazy == nil {
+		return
+	}
+	lazy.lock.Lock()
+	defer lazy.lock.Unlock()
+	for kind := range lazy.values {
+		for labelsKey := range lazy.values[kind][name] {
+			lazy.take(kind, name, labelsKey)
+		}
+	}
+}
+
+// series restored so far and still pending, they change while a lazy restore runs
+func (psink *PrometheusSink) restoreProgress(info *restoreInfo) (counters, gauges, pending, total int) {
+	lazy := psink.lazy.Load()
+	if lazy == nil {
+		return info.counters, info.gauges, 0, 0
+	}
+	lazy.lock.Lock()
+	defer lazy.lock.Unlock()
+	return info.counters, info.gauges, lazy.total - lazy.done, lazy.total
+}
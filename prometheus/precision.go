@@ -0,0 +1,163 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// float64 represents every integer only up to 2^53, counters beyond it drop increments
+// that are small relative to their value; billing counters in bytes get there in a few
+// months. Rules keep them exact in split mode or small enough in scale mode.
+
+// exact value of a split counter: integer part and the fraction below 1
+type exactCounter struct {
+	// held while the split gauges are set, so concurrent updates can't expose them out of order
+	lock  sync.Mutex
+	whole uint64
+	frac  float64
+	// restored from the split gauges on the first update
+	loaded bool
+}
+
+func (counter *exactCounter) add(delta float64) {
+	whole := math.Floor(delta)
+	counter.whole += uint64(whole)
+	counter.frac += delta - whole
+	if counter.frac >= 1 {
+		carry := math.Floor(counter.frac)
+		counter.whole += uint64(carry)
+		counter.frac -= carry
+	}
+}
+
+// both parts are below 2^32 plus the fraction, so float64 holds them exactly
+func (counter *exactCounter) split() (high, low float64) {
+	return float64(counter.whole >> 32), float64(counter.whole&math.MaxUint32) + counter.frac
+}
+
+func exactFromSplit(high, low float64) *exactCounter {
+	whole := math.Floor(low)
+	return &exactCounter{whole: uint64(high)<<32 + uint64(whole), frac: low - whole}
+}
+
+// validates and installs the precision rules of counters, must be called before the first update
+func (psink *PrometheusSink) SetCounterPrecision(rules []config.CounterPrecisionRule) error {
+	if err := ValidateCounterPrecision(rules); err != nil {
+		return err
+	}
+
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	psink.precisionRules = rules
+	psink.precisionCache.Clear()
+	return nil
+}
+
+func ValidateCounterPrecision(rules []config.CounterPrecisionRule) error {
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return fmt.Errorf("invalid counter precision match pattern %q: %w", rule.Match, err)
+		}
+		switch rule.Mode {
+		case config.PRECISION_SPLIT:
+		case config.PRECISION_SCALE:
+			if rule.Scale <= 0 {
+				return fmt.Errorf("counter precision rule %q: scale must be > 0", rule.Match)
+			}
+		default:
+			return fmt.Errorf("counter precision rule %q: unknown mode %q", rule.Match, rule.Mode)
+		}
+	}
+	return nil
+}
+
+// first rule matching the counter name, nil if there is none
+func (psink *PrometheusSink) precisionRule(name string) *config.CounterPrecisionRule {
+	if cached, ok := psink.precisionCache.Load(name); ok {
+		return cached.(*config.CounterPrecisionRule)
+	}
+	psink.lock.RLock()
+	var rule *config.CounterPrecisionRule
+	for i := range psink.precisionRules {
+		if matched, _ := path.Match(psink.precisionRules[i].Match, name); matched {
+			rule = &psink.precisionRules[i]
+			break
+		}
+	}
+	psink.lock.RUnlock()
+	psink.precisionCache.Store(name, rule)
+	return rule
+}
+
+// adds delta to the exact value of a split counter and exposes it as "<name>_high" and "<name>_low";
+// the value is restored from these gauges on the first update after restart
+func (psink *PrometheusSink) addExact(ctx context.Context, name string, labels map[string]string, delta float64) {
+	labelsKey := util.JoinMapEntries(labels)
+
+	// the map lock is not held while setting the gauges, deleting series takes it under the write lock
+	psink.exactLock.Lock()
+	series, ok := psink.exact[name]
+	if !ok {
+		series = make(map[string]*exactCounter)
+		psink.exact[name] = series
+	}
+	counter, ok := series[labelsKey]
+	if !ok {
+		counter = &exactCounter{}
+		series[labelsKey] = counter
+	}
+	psink.exactLock.Unlock()
+
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	if !counter.loaded {
+		high, hasHigh := psink.Series(name + SPLIT_HIGH_SUFFIX)[labelsKey]
+		low, hasLow := psink.Series(name + SPLIT_LOW_SUFFIX)[labelsKey]
+		if hasHigh && hasLow {
+			restored := exactFromSplit(high, low)
+			counter.whole, counter.frac = restored.whole, restored.frac
+		}
+		counter.loaded = true
+	}
+	counter.add(delta)
+
+	high, low := counter.split()
+	psink.setGauge(ctx, name+SPLIT_HIGH_SUFFIX, labels, high)
+	psink.setGauge(ctx, name+SPLIT_LOW_SUFFIX, labels, low)
+}
+
+// drops the exact value of a deleted or expired counter series
+func (psink *PrometheusSink) forgetExact(name, labelsKey string) {
+	psink.exactLock.Lock()
+	defer psink.exactLock.Unlock()
+	delete(psink.exact[name], labelsKey)
+	if len(psink.exact[name]) == 0 {
+		delete(psink.exact, name)
+	}
+}
+
+func (psink *PrometheusSink) forgetExactMetric(name string) {
+	psink.exactLock.Lock()
+	defer psink.exactLock.Unlock()
+	delete(psink.exact, name)
+}
+
+// counts updates whose checkpointed value was rounded and logs the first one per metric
+func (psink *PrometheusSink) countPrecisionLoss(ctx context.Context, name string, split bool) {
+	psink.precisionLoss.WithLabelValues(name).Inc()
+	if split {
+		// the exact value is exposed next to it
+		return
+	}
+	if _, logged := psink.loggedPrecisionLoss.LoadOrStore(name, true); !logged {
+		logger.WarnCtx(ctx, fmt.Sprintf("Counter %s exceeds float64 precision, increments are rounded; "+
+			"configure counterPrecision to split or scale it", name))
+	}
+}
@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExactCounterAdd(t *testing.T) {
+	cases := []struct {
+		name   string
+		deltas []float64
+		whole  uint64
+		frac   float64
+	}{
+		{"integers", []float64{1, 2, 3}, 6, 0},
+		{"fraction", []float64{0.25}, 0, 0.25},
+		{"fractions carry into whole", []float64{0.75, 0.5}, 1, 0.25},
+		{"mixed", []float64{2.5, 1.75}, 4, 0.25},
+		{"beyond 2^53", []float64{1 << 53, 1, 1}, 1<<53 + 2, 0},
+		{"far beyond 2^53", []float64{1 << 62, 1 << 62, 1}, 1<<63 + 1, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			counter := &exactCounter{}
+			for _, delta := range c.deltas {
+				counter.add(delta)
+			}
+			if counter.whole != c.whole || counter.frac != c.frac {
+				t.Fatalf("got %d + %v, expected %d + %v", counter.whole, counter.frac, c.whole, c.frac)
+			}
+		})
+	}
+}
+
+func TestExactCounterSplit(t *testing.T) {
+	cases := []struct {
+		name      string
+		whole     uint64
+		frac      float64
+		high, low float64
+	}{
+		{"zero", 0, 0, 0, 0},
+		{"below 2^32", 42, 0.5, 0, 42.5},
+		{"2^32", 1 << 32, 0, 1, 0},
+		{"2^53 + 1", 1<<53 + 1, 0, 1 << 21, 1},
+		{"max", math.MaxUint64, 0.5, math.MaxUint32, math.MaxUint32 + 0.5},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			counter := &exactCounter{whole: c.whole, frac: c.frac}
+			high, low := counter.split()
+			if high != c.high || low != c.low {
+				t.Fatalf("split into %v and %v, expected %v and %v", high, low, c.high, c.low)
+			}
+			// the split gauges restore the exact value
+			restored := exactFromSplit(high, low)
+			if restored.whole != c.whole || restored.frac != c.frac {
+				t.Fatalf("restored %d + %v, expected %d + %v", restored.whole, restored.frac, c.whole, c.frac)
+			}
+		})
+	}
+}
+
+func TestExactCounterPrunedWithSeries(t *testing.T) {
+	sink := NewSinkWithRegistry(prometheus.NewRegistry(), "", 0)
+	if err := sink.SetCounterPrecision([]config.CounterPrecisionRule{{Match: "billing_*", Mode: config.PRECISION_SPLIT}}); err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"tenant": "a"}
+	sink.AddCounter("billing_bytes_total", labels, 10)
+	sink.AddCounter("billing_bytes_total", map[string]string{"tenant": "b"}, 10)
+	if len(sink.exact["billing_bytes_total"]) != 2 {
+		t.Fatalf("tracks %d exact series, expected 2", len(sink.exact["billing_bytes_total"]))
+	}
+
+	sink.DeleteSeries("billing_bytes_total", labels)
+	if _, kept := sink.exact["billing_bytes_total"]["tenant=a"]; kept {
+		t.Fatal("exact value of a deleted series was kept")
+	}
+	sink.DeleteMetric("billing_bytes_total")
+	if len(sink.exact) != 0 {
+		t.Fatalf("exact values of a deleted metric were kept: %v", sink.exact)
+	}
+}
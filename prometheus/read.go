@@ -0,0 +1,57 @@
+package prometheus
+
+import (
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// implements metrics.SeriesReader, reads values back from the Prometheus vectors
+// so it also works without checkpoint
+func (psink *PrometheusSink) Series(name string) map[string]float64 {
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+
+	var collector prometheus.Collector
+	if vec, ok := psink.counters[name]; ok {
+		collector = vec
+	} else if vec, ok := psink.gauges[name]; ok {
+		collector = vec
+	} else if histograms, ok := psink.histogramCollectors[name]; ok {
+		// including state restored from checkpoint
+		collector = histograms
+	} else if vec, ok := psink.summaries[name]; ok {
+		collector = vec
+	} else {
+		return nil
+	}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+
+	series := make(map[string]float64)
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		labels := make(map[string]string, len(m.GetLabel()))
+		for _, pair := range m.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		switch {
+		case m.Counter != nil:
+			series[util.JoinMapEntries(labels)] = m.GetCounter().GetValue()
+		case m.Gauge != nil:
+			series[util.JoinMapEntries(labels)] = m.GetGauge().GetValue()
+		case m.Histogram != nil:
+			series[util.JoinMapEntries(labels)] = float64(m.GetHistogram().GetSampleCount())
+		case m.Summary != nil:
+			series[util.JoinMapEntries(labels)] = float64(m.GetSummary().GetSampleCount())
+		}
+	}
+	return series
+}
@@ -0,0 +1,127 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// what was restored from the checkpoint at startup
+type restoreInfo struct {
+	file       string
+	restoredAt time.Time
+	// modification time of the checkpoint file, i.e. roughly when the previous process last saved
+	savedAt time.Time
+	// counters and gauges grow while a lazy restore runs, read them via restoreProgress
+	counters   int
+	gauges     int
+	histograms int
+
+	// counter name -> (labelKey -> value restored from checkpoint)
+	counterBaselines map[string]map[string]float64
+}
+
+// restoreCollector exposes RESTORE_* metrics so dashboards and alert rules can account
+// for restarts, and optionally "<counter>_restored" markers with the restored baseline
+// of each counter series still present:
+//
+//	increase(deploy_total[1h]) unless on(result) deploy_total_restored
+type restoreCollector struct {
+	psink   *PrometheusSink
+	info    *restoreInfo
+	markers bool
+}
+
+// starts exposing "<counter>_restored" for counter series restored from the checkpoint
+func (psink *PrometheusSink) EnableRestoreMarkers() {
+	// markers is read by scrapes under the read lock
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	if psink.restoreCollector != nil {
+		psink.restoreCollector.markers = true
+	}
+}
+
+// registers restore metrics, caller must hold the lock
+func (psink *PrometheusSink) registerRestoreInfo(info *restoreInfo) {
+	psink.restoreCollector = &restoreCollector{psink: psink, info: info}
+	psink.registerer.MustRegister(psink.restoreCollector)
+}
+
+// markers are dynamic, so no descriptors are announced (unchecked collector)
+func (collector *restoreCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (collector *restoreCollector) Collect(ch chan<- prometheus.Metric) {
+	info := collector.info
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(RESTORE_INFO_METRIC, "checkpoint restored at startup", []string{"file"}, nil),
+		prometheus.GaugeValue, 1, info.file)
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(RESTORE_TIMESTAMP_METRIC, "unix time of the checkpoint restore", nil, nil),
+		prometheus.GaugeValue, float64(info.restoredAt.Unix()))
+	counters, gauges, pending, total := collector.psink.restoreProgress(info)
+	seriesDesc := prometheus.NewDesc(RESTORE_SERIES_METRIC, "series restored from checkpoint", []string{"type"}, nil)
+	ch <- prometheus.MustNewConstMetric(seriesDesc, prometheus.GaugeValue, float64(counters), "counter")
+	ch <- prometheus.MustNewConstMetric(seriesDesc, prometheus.GaugeValue, float64(gauges), "gauge")
+	progress := 1.0
+	if total > 0 {
+		progress = float64(total-pending) / float64(total)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(RESTORE_PENDING_METRIC, "series of the checkpoint not restored yet", nil, nil),
+		prometheus.GaugeValue, float64(pending))
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(RESTORE_PROGRESS_METRIC, "share of the checkpoint restored, below 1 while a lazy restore runs", nil, nil),
+		prometheus.GaugeValue, progress)
+	if !info.savedAt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(RESTORE_FILE_AGE_METRIC, "age of the checkpoint file when it was restored", nil, nil),
+			prometheus.GaugeValue, info.restoredAt.Sub(info.savedAt).Seconds())
+	}
+
+	// histograms are restored when created, see restorePendingHistogram
+	ch <- prometheus.MustNewConstMetric(seriesDesc, prometheus.GaugeValue, float64(info.histograms), "histogram")
+	for _, marker := range collector.collectMarkers() {
+		ch <- marker
+	}
+}
+
+// markers are built under the read lock and sent after releasing it, like freshness ages
+func (collector *restoreCollector) collectMarkers() []prometheus.Metric {
+	psink := collector.psink
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+	if !collector.markers {
+		return nil
+	}
+	var markers []prometheus.Metric
+	for name, baselines := range collector.info.counterBaselines {
+		// a metric named like the marker is exposed instead of it
+		if _, collides := psink.labelNames[name+RESTORED_SUFFIX]; collides {
+			continue
+		}
+		labelNames := psink.labelNames[name]
+		desc := prometheus.NewDesc(name+RESTORED_SUFFIX, "value of "+name+" restored from checkpoint", labelNames, nil)
+		for labelsKey, value := range baselines {
+			// deleted or evicted series lose their marker
+			if !psink.tracked(name, labelsKey) {
+				continue
+			}
+			labels, err := util.MapFromString(labelsKey)
+			if err != nil {
+				continue
+			}
+			labelValues := make([]string, 0, len(labelNames))
+			for _, labelName := range labelNames {
+				labelValues = append(labelValues, labels[labelName])
+			}
+			metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, value, labelValues...)
+			if err != nil {
+				continue
+			}
+			markers = append(markers, metric)
+		}
+	}
+	return markers
+}
@@ -0,0 +1,65 @@
+package prometheus
+
+import (
+	"sync"
+	"time"
+)
+
+// update times of the series of metrics hashed to this shard, so concurrent updates
+// of different metrics don't contend on a single lock
+type sinkShard struct {
+	lock sync.Mutex
+	// metric name -> (labelKey -> time of last update)
+	lastUpdate map[string]map[string]time.Time
+}
+
+// the shard of a metric, hashed once per update by the update methods; FNV-1a over the
+// string itself, since hash/fnv allocates its hash and a copy of the name on every call
+func (psink *PrometheusSink) shard(name string) *sinkShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		hash ^= uint32(name[i])
+		hash *= 16777619
+	}
+	return psink.shards[hash%SINK_SHARDS]
+}
+
+// calls fn for every tracked series, caller must hold the write lock
+// or the read lock, in which case each shard is locked while it is visited
+func (psink *PrometheusSink) forEachSeries(fn func(name, labelsKey string, updated time.Time)) {
+	for _, shard := range psink.shards {
+		shard.lock.Lock()
+		for name, byLabels := range shard.lastUpdate {
+			for labelsKey, updated := range byLabels {
+				fn(name, labelsKey, updated)
+			}
+		}
+		shard.lock.Unlock()
+	}
+}
+
+// reports whether the series exists, caller must hold the read or write lock
+func (psink *PrometheusSink) tracked(name, labelsKey string) bool {
+	return psink.shard(name).tracked(name, labelsKey)
+}
+
+func (shard *sinkShard) tracked(name, labelsKey string) bool {
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	_, exists := shard.lastUpdate[name][labelsKey]
+	return exists
+}
+
+// records the update time of a series, caller must hold the read or write lock
+func (psink *PrometheusSink) touch(name string, labelsKey string) {
+	psink.shard(name).touch(name, labelsKey)
+}
+
+func (shard *sinkShard) touch(name string, labelsKey string) {
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if _, exists := shard.lastUpdate[name]; !exists {
+		shard.lastUpdate[name] = make(map[string]time.Time)
+	}
+	shard.lastUpdate[name][labelsKey] = time.Now()
+}
@@ -1,11 +1,17 @@
 package prometheus
 
 import (
+	"container/heap"
+	"context"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/checkpoint"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
 	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,16 +24,29 @@ import (
 // This sink registers CounterVec/GaugeVec and also keeps simple maps
 // of numeric values so snapshotting / checkpointing is straightforward.
 type PrometheusSink struct {
-	// protected by lock; prevents race conditions due to concurrent metric updates
-	// from multiple goroutines (push events via POST, pull events via polling, Prometheus scrapes)
-	lock sync.Mutex
+	// protects the sink structure against concurrent metric updates from multiple goroutines
+	// (push events via POST, pull events via polling, Prometheus scrapes)
+	// updates of existing metrics only take the read lock, vectors are safe for concurrent use and
+	// update times are guarded per shard; creating, deleting or iterating metrics takes the write lock
+	lock sync.RWMutex
 
 	// metric name -> Prometheus defined metric vectors CounterVec/GaugeVec
 	// counters["deploy_total"] = CounterVec(name="deploy_total", labels=["result"] // value: success | fail)
 	// when we call sink.IncCounter("deploy_total", map[string]string{"result": "success"})
 	// CounterVec is invoked: counters["deploy_total"].WithLabelValues("success").Inc()
-	counters map[string]*prometheus.CounterVec
-	gauges   map[string]*prometheus.GaugeVec
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]*prometheus.GaugeVec
+	histograms map[string]*prometheus.HistogramVec
+	summaries  map[string]*prometheus.SummaryVec
+	// registered in place of the histogram vectors, adding state restored from checkpoint
+	histogramCollectors map[string]*histogramCollector
+	// histogram name -> (labelKey -> state) restored from checkpoint, applied once the histogram is created
+	pendingHistograms map[string]map[string]checkpoint.HistogramState
+
+	// per-metric bucket layouts for histograms, see SetHistogramSchemas
+	histogramSchemas []config.HistogramSchema
+	// per-metric quantile objectives for summaries, see SetSummarySchemas
+	summarySchemas []config.SummarySchema
 
 	// Prometheus requires label names to be known at metric registration time.
 	// If we register metric deploy_total{errType="unathenticated", status="success"}
@@ -36,15 +55,83 @@ type PrometheusSink struct {
 	// Prometheus intentionally hides the list of label names from CounterVec/GaugeVec
 	labelNames map[string][]string
 
+	// update times of series sharded by metric name, used to pick
+	// least-recently-updated series for eviction under memory pressure
+	shards [SINK_SHARDS]*sinkShard
+
 	// regularly backs up metric values to disk
 	checkpoint *checkpoint.JSONCheckpoint
+
+	// registry exposing the metrics, the default one served by promhttp.Handler unless
+	// the sink was created with NewSinkWithRegistry
+	registerer prometheus.Registerer
+
+	// exposes what was restored from checkpoint, nil if nothing was restored
+	restoreCollector *restoreCollector
+	// optional per-tenant registries also receiving each new metric, see SetTenants
+	tenants *TenantRegistries
+	// optional, shares the label strings of new series, see SetInterner
+	interner *util.Interner
+	// optional, told about deleted series, see SetForgetter
+	forgetter SeriesForgetter
+	// series still restored in the background, nil once all are restored, see startLazyRestore
+	lazy atomic.Pointer[lazyRestore]
+
+	// updates conflicting with an existing metric are recorded under a suffixed name if set, dropped otherwise
+	remapConflicts bool
+	// "kind|name|labelNames" -> variant name of conflicting updates
+	remapped map[string]string
+	// dropped conflicting updates, see CONFLICT_METRIC
+	conflicts       *prometheus.CounterVec
+	loggedConflicts sync.Map
+
+	// per-metric representation of large counters, see SetCounterPrecision;
+	// metric name -> matching rule, nil for none
+	precisionRules []config.CounterPrecisionRule
+	precisionCache sync.Map
+	// name -> (labelKey -> exact value) of split counters, pruned with their series;
+	// exactLock only guards the map, see addExact
+	exact     map[string]map[string]*exactCounter
+	exactLock sync.Mutex
+	// rounded counter updates, see PRECISION_LOSS_METRIC
+	precisionLoss       *prometheus.CounterVec
+	loggedPrecisionLoss sync.Map
+}
+
+func NewSink(checkpointFile string, saveInterval time.Duration, restore config.RestoreConfig) *PrometheusSink {
+	return newSink(prometheus.DefaultRegisterer, checkpointFile, saveInterval, restore)
+}
+
+// creates a sink registering its metrics in registerer, so several sinks can live in one process;
+// its checkpoint is restored before it is returned
+func NewSinkWithRegistry(registerer prometheus.Registerer, checkpointFile string, saveInterval time.Duration) *PrometheusSink {
+	return newSink(registerer, checkpointFile, saveInterval, config.RestoreConfig{})
 }
 
-func NewSink(checkpointFile string, saveInterval time.Duration) *PrometheusSink {
+func newSink(registerer prometheus.Registerer, checkpointFile string, saveInterval time.Duration, restore config.RestoreConfig) *PrometheusSink {
 	psink := &PrometheusSink{
+		registerer: registerer,
 		counters:   make(map[string]*prometheus.CounterVec),
 		gauges:     make(map[string]*prometheus.GaugeVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+		summaries:  make(map[string]*prometheus.SummaryVec),
 		labelNames: make(map[string][]string),
+		remapped:   make(map[string]string),
+		exact:      make(map[string]map[string]*exactCounter),
+
+		histogramCollectors: make(map[string]*histogramCollector),
+		conflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: CONFLICT_METRIC,
+			Help: "metric updates dropped because they conflict with an existing metric",
+		}, []string{"metric", "reason"}),
+		precisionLoss: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: PRECISION_LOSS_METRIC,
+			Help: "counter updates rounded because the checkpointed value exceeds float64 precision",
+		}, []string{"metric"}),
+	}
+	psink.registerer.MustRegister(psink.conflicts, psink.precisionLoss)
+	for i := range psink.shards {
+		psink.shards[i] = &sinkShard{lastUpdate: make(map[string]map[string]time.Time)}
 	}
 
 	// Initialize checkpoint manager for regular backups
@@ -57,12 +144,21 @@ func NewSink(checkpointFile string, saveInterval time.Duration) *PrometheusSink
 		psink.checkpoint.GaugeValues = make(map[string]map[string]float64)
 
 		// load previous metrics from  backup if exists into checkpoint maps
+		var savedAt time.Time
+		if stat, err := os.Stat(checkpointFile); err == nil {
+			savedAt = stat.ModTime()
+		}
 		if err := psink.checkpoint.Load(); err != nil {
 			logger.Error(fmt.Sprint("Failed to load checkpoint:", err))
+		} else if restore.Mode == config.RESTORE_LAZY {
+			psink.startLazyRestore(savedAt, restore)
 		} else {
-			psink.restoreFromCheckpoint()
+			psink.restoreFromCheckpoint(savedAt)
 		}
 
+		// histograms keep their buckets themselves, they are read on every save
+		psink.checkpoint.SetHistogramSource(psink.histogramStates)
+
 		// start periodic backups
 		psink.checkpoint.StartPeriodic(saveInterval)
 	}
@@ -70,40 +166,140 @@ func NewSink(checkpointFile string, saveInterval time.Duration) *PrometheusSink
 	return psink
 }
 
+// installs per-metric persistence policies of the checkpoint, a no-op without checkpoint;
+// series of ephemeral metrics restored at startup stay exposed until the next restart
+func (psink *PrometheusSink) SetPersistence(rules []config.PersistenceRule) {
+	if psink.checkpoint != nil {
+		psink.checkpoint.SetPolicies(rules)
+	}
+}
+
+// shares the label names, values and joined label keys of series created from now on
+// through interner, so equal strings of many series are held once
+func (psink *PrometheusSink) SetInterner(interner *util.Interner) {
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	psink.interner = interner
+}
+
+// SeriesForgetter keeps state per series elsewhere, e.g. quota.SeriesQuota, and drops it when
+// the sink deletes the series; called with the sink's lock held, so it must not call back
+type SeriesForgetter interface {
+	Forget(name, labelsKey string)
+	ForgetMetric(name string)
+}
+
+// tells forgetter about every deleted, evicted or expired series
+func (psink *PrometheusSink) SetForgetter(forgetter SeriesForgetter) {
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	psink.forgetter = forgetter
+}
+
+// shared copies of the labels and joined label key of a series not tracked yet; existing
+// series keep the strings they were created with. Caller must hold the read or write lock
+func (psink *PrometheusSink) internSeries(shard *sinkShard, name string, labels map[string]string, labelsKey string) (map[string]string, string) {
+	if psink.interner == nil || shard.tracked(name, labelsKey) {
+		return labels, labelsKey
+	}
+	return psink.interner.Labels(labels), psink.interner.Intern(labelsKey)
+}
+
+// installs a check failing checkpoint saves on purpose, a no-op without checkpoint
+func (psink *PrometheusSink) SetCheckpointFault(fault func() error) {
+	if psink.checkpoint != nil {
+		psink.checkpoint.SetFault(fault)
+	}
+}
+
+// stops periodic checkpoints after a final save
+func (psink *PrometheusSink) Close() error {
+	if psink.checkpoint == nil {
+		return nil
+	}
+	psink.checkpoint.Stop()
+	return psink.checkpoint.Save()
+}
+
 // restores metric values from checkpoint into the sink
-func (psink *PrometheusSink) restoreFromCheckpoint() {
+func (psink *PrometheusSink) restoreFromCheckpoint(savedAt time.Time) {
 	psink.lock.Lock()
 	defer psink.lock.Unlock()
 
 	checkpoint := psink.checkpoint
+	info := &restoreInfo{
+		file:             checkpoint.FilePath,
+		restoredAt:       time.Now(),
+		savedAt:          savedAt,
+		counterBaselines: make(map[string]map[string]float64),
+	}
 
 	// 1. Restore counters
 	for metricName, series := range checkpoint.GetCounterValues() {
-		vec := psink.getOrCreateCounter(metricName, psink.labelNames[metricName])
+		// copied, the checkpoint keeps updating its map
+		baselines := make(map[string]float64, len(series))
 		for labelsKey, value := range series {
 			//we stored labels joined by separator in a single string key,
 			// need to deserialize back to map
-			labels := util.MapFromString(labelsKey)
+			labels, err := util.MapFromString(labelsKey)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", metricName, labelsKey, err))
+				continue
+			}
+			if conflict := psink.conflictWith(KIND_COUNTER, metricName, labels); conflict != nil {
+				logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", metricName, labelsKey, conflict))
+				continue
+			}
+			// label names are not known before the first series is restored
+			vec, err := psink.getOrCreateCounter(metricName, util.SortedKeysFromMap(labels))
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", metricName, labelsKey, err))
+				continue
+			}
 			vec.With(labels).Add(value)
+			psink.touch(metricName, labelsKey)
+			info.counters++
+			baselines[labelsKey] = value
 		}
+		info.counterBaselines[metricName] = baselines
 	}
 
 	// 2. Restore gauges
 	for name, series := range checkpoint.GetGaugeValues() {
-		vec := psink.getOrCreateGauge(name, psink.labelNames[name])
 		for labelsKey, value := range series {
-			labels := util.MapFromString(labelsKey)
+			labels, err := util.MapFromString(labelsKey)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", name, labelsKey, err))
+				continue
+			}
+			if conflict := psink.conflictWith(KIND_GAUGE, name, labels); conflict != nil {
+				logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", name, labelsKey, conflict))
+				continue
+			}
+			vec, err := psink.getOrCreateGauge(name, util.SortedKeysFromMap(labels))
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Skipping restore of %s{%s}: %v", name, labelsKey, err))
+				continue
+			}
 			vec.With(labels).Set(value)
+			psink.touch(name, labelsKey)
+			info.gauges++
 		}
 	}
+
+	// 3. Histograms are restored when created, their bucket schemas are not known yet,
+	// see SetHistogramSchemas
+	psink.pendingHistograms = checkpoint.GetHistogramValues()
+
+	psink.registerRestoreInfo(info)
 }
 
 // retrieves existing CounterVec or creates a new one if it doesn't exist
-func (psink *PrometheusSink) getOrCreateCounter(name string, labelNames []string) *prometheus.CounterVec {
+func (psink *PrometheusSink) getOrCreateCounter(name string, labelNames []string) (*prometheus.CounterVec, error) {
 
 	// check if metric already exists
 	if counterVec, ok := psink.counters[name]; ok {
-		return counterVec
+		return counterVec, nil
 	}
 
 	// create new CounterVec with specified label names
@@ -112,67 +308,390 @@ func (psink *PrometheusSink) getOrCreateCounter(name string, labelNames []string
 		Help: name + " counter",
 	}, labelNames)
 
+	//tells Prometheus to track this metric and expose it on /metrics
+	// fails for names already used by other collectors, e.g. Go runtime metrics
+	if err := psink.register(name, counterVec); err != nil {
+		return nil, err
+	}
 	psink.counters[name] = counterVec
 	psink.labelNames[name] = labelNames
 
-	//tells Prometheus to track this metric and expose it on /metrics
-	prometheus.MustRegister(counterVec)
-
-	return counterVec
+	return counterVec, nil
 }
 
 // retrieves existing GaugeVec or creates a new one if it doesn't exist
-func (psink *PrometheusSink) getOrCreateGauge(name string, labelNames []string) *prometheus.GaugeVec {
+func (psink *PrometheusSink) getOrCreateGauge(name string, labelNames []string) (*prometheus.GaugeVec, error) {
 
 	// check if metric already exists
 	if gaugeVec, ok := psink.gauges[name]; ok {
-		return gaugeVec
+		return gaugeVec, nil
 	}
 	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: name,
 		Help: name + " gauge",
 	}, labelNames)
+
+	//tells Prometheus to track this metric and expose it on /metrics
+	// fails for names already used by other collectors, e.g. Go runtime metrics
+	if err := psink.register(name, gaugeVec); err != nil {
+		return nil, err
+	}
 	psink.gauges[name] = gaugeVec
 	psink.labelNames[name] = labelNames
 
+	return gaugeVec, nil
+}
+
+// retrieves existing HistogramVec or creates a new one with buckets from the matching schema
+func (psink *PrometheusSink) getOrCreateHistogram(name string, labelNames []string) (*prometheus.HistogramVec, error) {
+
+	// check if metric already exists
+	if histogramVec, ok := psink.histograms[name]; ok {
+		return histogramVec, nil
+	}
+	histogramVec := prometheus.NewHistogramVec(psink.histogramOpts(name), labelNames)
+	collector := newHistogramCollector(histogramVec)
+
 	//tells Prometheus to track this metric and expose it on /metrics
-	prometheus.MustRegister(gaugeVec)
+	// fails for names already used by other collectors, e.g. Go runtime metrics
+	if err := psink.register(name, collector); err != nil {
+		return nil, err
+	}
+	psink.histograms[name] = histogramVec
+	psink.histogramCollectors[name] = collector
+	psink.labelNames[name] = labelNames
+	psink.restorePendingHistogram(name)
 
-	return gaugeVec
+	return histogramVec, nil
 }
 
 // increases counter metrics, implements MetricSink
 func (psink *PrometheusSink) IncCounter(name string, labels map[string]string) {
+	psink.addCounter(context.Background(), name, labels, 1)
+}
+
+// increases counter metrics by delta, implements MetricSink
+func (psink *PrometheusSink) AddCounter(name string, labels map[string]string, delta float64) {
+	psink.addCounter(context.Background(), name, labels, delta)
+}
+
+// SetGauge implements MetricSink
+func (psink *PrometheusSink) SetGauge(name string, labels map[string]string, value float64) {
+	psink.setGauge(context.Background(), name, labels, value)
+}
+
+// Observe implements MetricSink
+// buckets, sum and count of histograms are checkpointed, see histogramCollector
+func (psink *PrometheusSink) Observe(name string, labels map[string]string, value float64) {
+	psink.observe(context.Background(), name, labels, value)
+}
+
+// ObserveSummary implements MetricSink
+// summaries are not checkpointed, they start empty after restart
+func (psink *PrometheusSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	psink.observeSummary(context.Background(), name, labels, value)
+}
+
+// ctx identifies the push or poll causing the update in logs, see WithContext
+func (psink *PrometheusSink) addCounter(ctx context.Context, name string, labels map[string]string, delta float64) {
+	rule := psink.precisionRule(name)
+	if rule != nil && rule.Mode == config.PRECISION_SCALE {
+		delta /= rule.Scale
+	}
+	split := rule != nil && rule.Mode == config.PRECISION_SPLIT
+
+	name, exact, ok := psink.recordCounter(ctx, name, labels, delta)
+	if !ok {
+		return
+	}
+	if !exact {
+		psink.countPrecisionLoss(ctx, name, split)
+	}
+	// the split gauges take the read lock again, so they are set after recordCounter released it
+	if split {
+		psink.addExact(ctx, name, labels, delta)
+	}
+}
+
+// records the update under the returned name, which differs for remapped conflicts;
+// exact is false if the checkpointed value was rounded
+func (psink *PrometheusSink) recordCounter(ctx context.Context, name string, labels map[string]string, delta float64) (recorded string, exact, ok bool) {
 	//prevent race conditions on concurrent access via multiple metric updates
-	psink.lock.Lock()
-	defer psink.lock.Unlock()
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
 
-	labelNames := util.SortedKeysFromMap(labels)
-	counter := psink.getOrCreateCounter(name, labelNames)
+	name, vec, err := lookup(ctx, psink, KIND_COUNTER, psink.counters, name, labels, psink.getOrCreateCounter)
+	if err != nil {
+		return name, false, false
+	}
+	// the shard and joined labels are computed once per update
+	shard := psink.shard(name)
+	labels, labelsKey := psink.internSeries(shard, name, labels, util.JoinMapEntries(labels))
+	counter, err := vec.GetMetricWith(labels)
+	if err != nil {
+		psink.countConflict(ctx, &ConflictError{Metric: name, Reason: "labels", Detail: err.Error()})
+		return name, false, false
+	}
+
+	// a series not restored yet continues from its checkpointed value
+	if baseline, pending := psink.claimPending(KIND_COUNTER, name, labelsKey); pending {
+		counter.Add(baseline)
+	}
 
 	// update Prometheus metric value
-	counter.With(labels).Add(1)
+	counter.Add(delta)
 
 	// update our internal map for backuping
+	exact = true
 	if psink.checkpoint != nil {
-		psink.checkpoint.IncCounter(name, labels)
+		exact = psink.checkpoint.AddCounter(name, labelsKey, delta, logger.RequestID(ctx))
+	}
+	shard.touch(name, labelsKey)
+	return name, exact, true
+}
+
+func (psink *PrometheusSink) setGauge(ctx context.Context, name string, labels map[string]string, value float64) {
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+
+	name, vec, err := lookup(ctx, psink, KIND_GAUGE, psink.gauges, name, labels, psink.getOrCreateGauge)
+	if err != nil {
+		return
 	}
+	shard := psink.shard(name)
+	labels, labelsKey := psink.internSeries(shard, name, labels, util.JoinMapEntries(labels))
+	gauge, err := vec.GetMetricWith(labels)
+	if err != nil {
+		psink.countConflict(ctx, &ConflictError{Metric: name, Reason: "labels", Detail: err.Error()})
+		return
+	}
+
+	// a series not restored yet is superseded by the update
+	psink.claimPending(KIND_GAUGE, name, labelsKey)
 
+	// update prometheus metric value
+	gauge.Set(value)
+
+	/// update our internal map for backuping
+	if psink.checkpoint != nil {
+		psink.checkpoint.SetGauge(name, labelsKey, value, logger.RequestID(ctx))
+	}
+	shard.touch(name, labelsKey)
 }
 
-// SetGauge implements MetricSink
-func (psink *PrometheusSink) SetGauge(name string, labels map[string]string, value float64) {
+func (psink *PrometheusSink) observe(ctx context.Context, name string, labels map[string]string, value float64) {
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+
+	name, vec, err := lookup(ctx, psink, KIND_HISTOGRAM, psink.histograms, name, labels, psink.getOrCreateHistogram)
+	if err != nil {
+		return
+	}
+	shard := psink.shard(name)
+	labels, labelsKey := psink.internSeries(shard, name, labels, util.JoinMapEntries(labels))
+	histogram, err := vec.GetMetricWith(labels)
+	if err != nil {
+		psink.countConflict(ctx, &ConflictError{Metric: name, Reason: "labels", Detail: err.Error()})
+		return
+	}
+	histogram.Observe(value)
+
+	shard.touch(name, labelsKey)
+}
+
+func (psink *PrometheusSink) observeSummary(ctx context.Context, name string, labels map[string]string, value float64) {
+	psink.lock.RLock()
+	defer psink.lock.RUnlock()
+
+	name, vec, err := lookup(ctx, psink, KIND_SUMMARY, psink.summaries, name, labels, psink.getOrCreateSummary)
+	if err != nil {
+		return
+	}
+	shard := psink.shard(name)
+	labels, labelsKey := psink.internSeries(shard, name, labels, util.JoinMapEntries(labels))
+	summary, err := vec.GetMetricWith(labels)
+	if err != nil {
+		psink.countConflict(ctx, &ConflictError{Metric: name, Reason: "labels", Detail: err.Error()})
+		return
+	}
+	summary.Observe(value)
+
+	shard.touch(name, labelsKey)
+}
+
+// removes up to n least-recently-updated series from Prometheus vectors and checkpoint,
+// returns evicted series as "name{labelKey}" for logging. The oldest are selected under the
+// read lock, so updates continue while all series are scanned; series updated since are kept
+func (psink *PrometheusSink) EvictOldest(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	oldest := make(newestFirst, 0, n)
+	psink.lock.RLock()
+	psink.forEachSeries(func(name, labelsKey string, updated time.Time) {
+		if len(oldest) < n {
+			heap.Push(&oldest, seriesUpdate{name, labelsKey, updated})
+		} else if updated.Before(oldest[0].updated) {
+			oldest[0] = seriesUpdate{name, labelsKey, updated}
+			heap.Fix(&oldest, 0)
+		}
+	})
+	psink.lock.RUnlock()
+
 	psink.lock.Lock()
 	defer psink.lock.Unlock()
+	evicted := make([]string, 0, len(oldest))
+	for _, s := range oldest {
+		updated, exists := psink.shard(s.name).lastUpdate[s.name][s.labelsKey]
+		if !exists || !updated.Equal(s.updated) {
+			continue
+		}
+		psink.deleteSeries(s.name, s.labelsKey)
+		evicted = append(evicted, s.name+"{"+s.labelsKey+"}")
+	}
+	return evicted
+}
 
-	labelNames := util.SortedKeysFromMap(labels)
-	gauge := psink.getOrCreateGauge(name, labelNames)
+type seriesUpdate struct {
+	name      string
+	labelsKey string
+	updated   time.Time
+}
 
-	// update prometheus metric value
-	gauge.With(labels).Set(value)
+// heap of series with the most recently updated on top, keeps the n oldest of all series
+// by replacing the top in O(log n)
+type newestFirst []seriesUpdate
+
+func (h newestFirst) Len() int           { return len(h) }
+func (h newestFirst) Less(i, j int) bool { return h[i].updated.After(h[j].updated) }
+func (h newestFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *newestFirst) Push(x any)        { *h = append(*h, x.(seriesUpdate)) }
+func (h *newestFirst) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
 
-	/// update our internal map for backuping
+// removes a series from Prometheus vectors, checkpoint and update tracking,
+// so it disappears from /metrics and Prometheus marks it stale; caller must hold the lock
+func (psink *PrometheusSink) deleteSeries(name string, labelsKey string) bool {
+	lastUpdate := psink.shard(name).lastUpdate
+	pending := psink.dropPending(name, labelsKey)
+	if _, exists := lastUpdate[name][labelsKey]; !exists && !pending {
+		return false
+	}
+
+	// keys that don't parse were never recorded in a vector, only their bookkeeping is dropped
+	if labels, err := util.MapFromString(labelsKey); err == nil {
+		if counterVec, ok := psink.counters[name]; ok {
+			counterVec.Delete(labels)
+			psink.forgetExact(name, labelsKey)
+		}
+		if gaugeVec, ok := psink.gauges[name]; ok {
+			gaugeVec.Delete(labels)
+		}
+		if histogramVec, ok := psink.histograms[name]; ok {
+			histogramVec.Delete(labels)
+			psink.histogramCollectors[name].forget(labelsKey)
+		}
+		if summaryVec, ok := psink.summaries[name]; ok {
+			summaryVec.Delete(labels)
+		}
+	}
 	if psink.checkpoint != nil {
-		psink.checkpoint.SetGauge(name, labels, value)
+		psink.checkpoint.DeleteSeries(name, labelsKey)
+	}
+	delete(lastUpdate[name], labelsKey)
+	if len(lastUpdate[name]) == 0 {
+		delete(lastUpdate, name)
+	}
+	if psink.forgetter != nil {
+		psink.forgetter.Forget(name, labelsKey)
+	}
+	return true
+}
+
+// implements metrics.SeriesDeleter
+func (psink *PrometheusSink) DeleteSeries(name string, labels map[string]string) bool {
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	return psink.deleteSeries(name, util.JoinMapEntries(labels))
+}
+
+// unregisters the metric vector from Prometheus and drops it from the checkpoint,
+// implements metrics.SeriesDeleter
+func (psink *PrometheusSink) DeleteMetric(name string) bool {
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+
+	deleted := false
+	if counterVec, ok := psink.counters[name]; ok {
+		psink.unregister(counterVec)
+		delete(psink.counters, name)
+		psink.forgetExactMetric(name)
+		deleted = true
 	}
+	if gaugeVec, ok := psink.gauges[name]; ok {
+		psink.unregister(gaugeVec)
+		delete(psink.gauges, name)
+		deleted = true
+	}
+	if _, ok := psink.histograms[name]; ok {
+		psink.unregister(psink.histogramCollectors[name])
+		delete(psink.histograms, name)
+		delete(psink.histogramCollectors, name)
+		deleted = true
+	}
+	if summaryVec, ok := psink.summaries[name]; ok {
+		psink.unregister(summaryVec)
+		delete(psink.summaries, name)
+		deleted = true
+	}
+	delete(psink.labelNames, name)
+	delete(psink.shard(name).lastUpdate, name)
+	psink.dropPendingMetric(name)
+	if psink.checkpoint != nil {
+		psink.checkpoint.DeleteMetric(name)
+	}
+	if psink.forgetter != nil {
+		psink.forgetter.ForgetMetric(name)
+	}
+	return deleted
+}
+
+// removes series not updated within ttl, returns them as "name{labelKey}"
+func (psink *PrometheusSink) ExpireOlderThan(ttl time.Duration) []string {
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+
+	cutoff := time.Now().Add(-ttl)
+	type series struct{ name, labelsKey string }
+	var old []series
+	psink.forEachSeries(func(name, labelsKey string, updated time.Time) {
+		if updated.Before(cutoff) {
+			old = append(old, series{name, labelsKey})
+		}
+	})
+
+	expired := make([]string, 0, len(old))
+	for _, s := range old {
+		psink.deleteSeries(s.name, s.labelsKey)
+		expired = append(expired, s.name+"{"+s.labelsKey+"}")
+	}
+	return expired
+}
+
+// periodically expires series not updated within ttl
+func (psink *PrometheusSink) StartExpiry(ttl time.Duration) {
+	go func() {
+		// check often enough that series don't outlive ttl by much
+		ticker := time.NewTicker(ttl / 4)
+		defer ticker.Stop()
+		for range ticker.C {
+			if expired := psink.ExpireOlderThan(ttl); len(expired) > 0 {
+				logger.Info(fmt.Sprintf("Expired %d series not updated within %v: %s", len(expired), ttl, strings.Join(expired, ", ")))
+			}
+		}
+	}()
 }
@@ -0,0 +1,117 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// a sink on a private registry, with a checkpoint in a temp dir if checkpointed
+func newBenchSink(b *testing.B, checkpointed bool) *PrometheusSink {
+	b.Helper()
+	file := ""
+	if checkpointed {
+		// an empty checkpoint, a missing one is logged as an error
+		file = filepath.Join(b.TempDir(), "checkpoint.json")
+		if err := os.WriteFile(file, []byte("{}"), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	// long interval, the benchmark measures updates rather than saves
+	sink := NewSinkWithRegistry(prometheus.NewRegistry(), file, time.Hour)
+	b.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+// concurrent gauge updates, each goroutine writing its own metric as pollers do.
+// "global-lock" serializes every update like the sink did before its locking was sharded;
+// the checkpoint cases show that its lock, taken once per update with or without
+// a request ID, serializes updates again and caps the gain of sharding
+//
+//	go test ./prometheus -run '^$' -bench SinkUpdateParallel -cpu 1,4,8
+func BenchmarkSinkUpdateParallel(b *testing.B) {
+	cases := []struct {
+		name         string
+		globalLock   bool
+		checkpointed bool
+		requestID    bool
+	}{
+		{name: "global-lock", globalLock: true},
+		{name: "sharded"},
+		{name: "sharded/checkpoint", checkpointed: true},
+		{name: "sharded/checkpoint/request-id", checkpointed: true, requestID: true},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			sink := newBenchSink(b, c.checkpointed)
+			var global sync.Mutex
+			var goroutines atomic.Int64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				n := goroutines.Add(1)
+				name := fmt.Sprintf("bench_gauge_%d", n)
+				labels := map[string]string{"series": "s0"}
+				ctx := context.Background()
+				if c.requestID {
+					ctx = logger.WithRequestID(ctx, fmt.Sprintf("req-%d", n))
+				}
+				update := sink.WithContext(ctx)
+				value := 0.0
+				for pb.Next() {
+					value++
+					if c.globalLock {
+						global.Lock()
+					}
+					update.SetGauge(name, labels, value)
+					if c.globalLock {
+						global.Unlock()
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkSinkIncCounter(b *testing.B) {
+	sink := newBenchSink(b, false)
+	labels := map[string]string{"series": "s0"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sink.IncCounter("bench_total", labels)
+	}
+}
+
+func BenchmarkSinkSetGauge(b *testing.B) {
+	sink := newBenchSink(b, false)
+	series := benchSeries(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sink.SetGauge("bench_gauge", series[i%len(series)], float64(i))
+	}
+}
+
+func BenchmarkSinkObserve(b *testing.B) {
+	sink := newBenchSink(b, false)
+	labels := map[string]string{"series": "s0"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sink.Observe("bench_seconds", labels, float64(i%100)/100)
+	}
+}
+
+// labels of n distinct series
+func benchSeries(n int) []map[string]string {
+	series := make([]map[string]string, n)
+	for i := range series {
+		series[i] = map[string]string{"series": fmt.Sprintf("s%d", i)}
+	}
+	return series
+}
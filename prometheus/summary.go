@@ -0,0 +1,90 @@
+package prometheus
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// validates and installs per-metric summary objectives,
+// must be called before the first observation
+func (psink *PrometheusSink) SetSummarySchemas(schemas []config.SummarySchema) error {
+	if err := ValidateSummarySchemas(schemas); err != nil {
+		return err
+	}
+
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	psink.summarySchemas = schemas
+	return nil
+}
+
+// checks patterns and quantile objectives
+func ValidateSummarySchemas(schemas []config.SummarySchema) error {
+	for _, schema := range schemas {
+		if _, err := path.Match(schema.Match, ""); err != nil {
+			return fmt.Errorf("invalid summary match pattern %q: %w", schema.Match, err)
+		}
+		if _, err := parseObjectives(schema.Objectives); err != nil {
+			return fmt.Errorf("summary schema %q: %w", schema.Match, err)
+		}
+	}
+	return nil
+}
+
+// summary options for a metric name from the first matching schema
+func (psink *PrometheusSink) summaryOpts(name string) prometheus.SummaryOpts {
+	opts := prometheus.SummaryOpts{
+		Name: name,
+		Help: name + " summary",
+	}
+	for _, schema := range psink.summarySchemas {
+		if matched, _ := path.Match(schema.Match, name); !matched {
+			continue
+		}
+		// validated in SetSummarySchemas
+		opts.Objectives, _ = parseObjectives(schema.Objectives)
+		opts.MaxAge = schema.MaxAge.Duration
+		opts.AgeBuckets = schema.AgeBuckets
+		break
+	}
+	return opts
+}
+
+// converts quantile keys from config ("0.99") into the map Prometheus expects
+func parseObjectives(objectives map[string]float64) (map[float64]float64, error) {
+	parsed := make(map[float64]float64, len(objectives))
+	for key, allowedErr := range objectives {
+		quantile, err := strconv.ParseFloat(key, 64)
+		if err != nil || quantile < 0 || quantile > 1 {
+			return nil, fmt.Errorf("invalid quantile %q, must be between 0 and 1", key)
+		}
+		if allowedErr < 0 || allowedErr > 1 {
+			return nil, fmt.Errorf("invalid error %v for quantile %s", allowedErr, key)
+		}
+		parsed[quantile] = allowedErr
+	}
+	return parsed, nil
+}
+
+// retrieves existing SummaryVec or creates a new one with objectives from the matching schema
+func (psink *PrometheusSink) getOrCreateSummary(name string, labelNames []string) (*prometheus.SummaryVec, error) {
+
+	// check if metric already exists
+	if summaryVec, ok := psink.summaries[name]; ok {
+		return summaryVec, nil
+	}
+	summaryVec := prometheus.NewSummaryVec(psink.summaryOpts(name), labelNames)
+
+	//tells Prometheus to track this metric and expose it on /metrics
+	if err := psink.register(name, summaryVec); err != nil {
+		return nil, err
+	}
+	psink.summaries[name] = summaryVec
+	psink.labelNames[name] = labelNames
+
+	return summaryVec, nil
+}
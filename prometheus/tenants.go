@@ -0,0 +1,119 @@
+package prometheus
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// TenantRegistries keeps one registry per tenant holding only the metrics of that tenant,
+// those whose name starts with one of its prefixes, as it may push them (see
+// config.OIDCConfig.Tenants); a tenant without prefixes owns none. The sink registers
+// each metric it creates in the registries of its tenants as well, so a tenant's scrape is
+// isolated by what its registry contains rather than filtered from all series
+type TenantRegistries struct {
+	lock sync.Mutex
+	// tenant -> metric name prefixes
+	prefixes   map[string][]string
+	registries map[string]*prometheus.Registry
+	handlers   map[string]http.Handler
+}
+
+func NewTenantRegistries(tenants map[string][]string) *TenantRegistries {
+	t := &TenantRegistries{
+		prefixes:   tenants,
+		registries: make(map[string]*prometheus.Registry, len(tenants)),
+		handlers:   make(map[string]http.Handler, len(tenants)),
+	}
+	for tenant := range tenants {
+		registry := prometheus.NewRegistry()
+		t.registries[tenant] = registry
+		t.handlers[tenant] = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	}
+	return t
+}
+
+// serves the scrape of tenant, nil for unknown tenants; nil-safe
+func (t *TenantRegistries) Handler(tenant string) http.Handler {
+	if t == nil {
+		return nil
+	}
+	return t.handlers[tenant]
+}
+
+// registers the collector of metric name in the registries of the tenants owning it
+func (t *TenantRegistries) register(name string, collector prometheus.Collector) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for tenant, registry := range t.registries {
+		if !t.owns(tenant, name) {
+			continue
+		}
+		if err := registry.Register(collector); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to register %s for tenant %s: %v", name, tenant, err))
+		}
+	}
+}
+
+func (t *TenantRegistries) unregister(collector prometheus.Collector) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, registry := range t.registries {
+		registry.Unregister(collector)
+	}
+}
+
+func (t *TenantRegistries) owns(tenant, name string) bool {
+	for _, prefix := range t.prefixes[tenant] {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// registers the metrics of the sink in the registries of their tenants, existing ones right away
+func (psink *PrometheusSink) SetTenants(tenants *TenantRegistries) {
+	psink.lock.Lock()
+	defer psink.lock.Unlock()
+	psink.tenants = tenants
+	for name, vec := range psink.counters {
+		tenants.register(name, vec)
+	}
+	for name, vec := range psink.gauges {
+		tenants.register(name, vec)
+	}
+	for name, collector := range psink.histogramCollectors {
+		tenants.register(name, collector)
+	}
+	for name, vec := range psink.summaries {
+		tenants.register(name, vec)
+	}
+}
+
+// registers the collector of a new metric in the sink's registry and its tenants' registries;
+// caller must hold the write lock
+func (psink *PrometheusSink) register(name string, collector prometheus.Collector) error {
+	if err := psink.registerer.Register(collector); err != nil {
+		return err
+	}
+	psink.tenants.register(name, collector)
+	return nil
+}
+
+// caller must hold the write lock
+func (psink *PrometheusSink) unregister(collector prometheus.Collector) {
+	psink.registerer.Unregister(collector)
+	psink.tenants.unregister(collector)
+}
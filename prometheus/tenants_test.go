@@ -0,0 +1,21 @@
+package prometheus
+
+import "testing"
+
+func TestTenantOwnsOnlyItsPrefixes(t *testing.T) {
+	tenants := NewTenantRegistries(map[string][]string{"a": {"team_a_"}, "empty": nil})
+	cases := []struct {
+		tenant, name string
+		owns         bool
+	}{
+		{"a", "team_a_requests_total", true},
+		{"a", "team_b_requests_total", false},
+		{"empty", "team_a_requests_total", false},
+		{"unknown", "team_a_requests_total", false},
+	}
+	for _, c := range cases {
+		if owns := tenants.owns(c.tenant, c.name); owns != c.owns {
+			t.Errorf("tenant %s owns %s: %v, expected %v", c.tenant, c.name, owns, c.owns)
+		}
+	}
+}
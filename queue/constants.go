@@ -0,0 +1,25 @@
+package queue
+
+// defaults of config.QueueConfig
+const DEFAULT_MAX_BYTES = 512 << 20
+const DEFAULT_SEGMENT_BYTES = 8 << 20
+const DEFAULT_BATCH_SIZE = 500
+const DEFAULT_RETRY_INTERVAL_SEC = 1
+const DEFAULT_MAX_RETRY_INTERVAL_SEC = 60
+
+// buffered samples are written to disk and self-metrics published this often
+const FLUSH_INTERVAL_SEC = 1
+
+// timeout of a single WriteSamples call
+const WRITE_TIMEOUT_SEC = 30
+
+const SEGMENT_SUFFIX = ".jsonl"
+const CURSOR_FILE = "cursor.json"
+
+// self-metrics labelled by sink
+const QUEUE_PENDING_METRIC = "collector_queue_pending_samples"
+const QUEUE_BYTES_METRIC = "collector_queue_bytes"
+const QUEUE_SENT_METRIC = "collector_queue_sent_samples_total"
+const QUEUE_DROPPED_METRIC = "collector_queue_dropped_samples_total"
+const QUEUE_FAILURES_METRIC = "collector_queue_send_failures_total"
+const QUEUE_REJECTED_METRIC = "collector_queue_rejected_samples_total"
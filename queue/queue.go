@@ -0,0 +1,463 @@
+// Package queue puts an on-disk queue in front of sinks delivering to remote systems, so
+// updates made while the remote is unreachable are delivered once it is back
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// a file of queued samples, one JSON line each
+type segment struct {
+	seq     uint64
+	bytes   int64
+	samples int
+}
+
+// position of the sender in the queue, saved after each delivered batch
+type cursor struct {
+	Seq       uint64 `json:"seq"`
+	Delivered int    `json:"delivered"`
+}
+
+// Queue is a MetricSink appending updates to segment files, delivered in order by a background
+// sender through the SampleWriter; samples still buffered in memory (up to FLUSH_INTERVAL_SEC)
+// are lost if the process dies, the oldest segments are dropped beyond MaxBytes
+type Queue struct {
+	name   string
+	cfg    config.QueueConfig
+	writer metrics.SampleWriter
+	// receives the queue's self-metrics
+	hub metrics.MetricSink
+
+	lock sync.Mutex
+	// segment being appended to
+	current *segment
+	file    *os.File
+	buf     *bufio.Writer
+	// closed segments, oldest first
+	segments []*segment
+	nextSeq  uint64
+	cursor   cursor
+	// sequence number of the segment being delivered, 0 if none
+	sending uint64
+	// wakes the idle sender once there is something to deliver
+	wake chan struct{}
+
+	// since the last publish of the self-metrics
+	sent, dropped, failures, rejected int
+}
+
+// opens or creates the queue in cfg.Dir, resuming delivery of the samples left by the last run
+func New(name string, cfg config.QueueConfig, writer metrics.SampleWriter, hub metrics.MetricSink) (*Queue, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DEFAULT_MAX_BYTES
+	}
+	if cfg.SegmentBytes <= 0 {
+		cfg.SegmentBytes = DEFAULT_SEGMENT_BYTES
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DEFAULT_BATCH_SIZE
+	}
+	if cfg.RetryInterval.Duration <= 0 {
+		cfg.RetryInterval.Duration = DEFAULT_RETRY_INTERVAL_SEC * time.Second
+	}
+	if cfg.MaxRetryInterval.Duration < cfg.RetryInterval.Duration {
+		cfg.MaxRetryInterval.Duration = max(DEFAULT_MAX_RETRY_INTERVAL_SEC*time.Second, cfg.RetryInterval.Duration)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	queue := &Queue{name: name, cfg: cfg, writer: writer, hub: hub, nextSeq: 1, wake: make(chan struct{}, 1)}
+	if err := queue.load(); err != nil {
+		return nil, err
+	}
+	if pending := queue.pending(); pending > 0 {
+		logger.Info(fmt.Sprintf("Queue of sink %s resumes with %d undelivered samples", name, pending))
+	}
+	return queue, nil
+}
+
+// starts the sender and the periodic flush
+func (queue *Queue) Start() {
+	go queue.send()
+	go func() {
+		ticker := time.NewTicker(FLUSH_INTERVAL_SEC * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			queue.flush()
+			queue.publish()
+		}
+	}()
+}
+
+func (queue *Queue) IncCounter(name string, labels map[string]string) {
+	queue.append("counter", name, labels, 1)
+}
+
+func (queue *Queue) AddCounter(name string, labels map[string]string, delta float64) {
+	queue.append("counter", name, labels, delta)
+}
+
+func (queue *Queue) SetGauge(name string, labels map[string]string, value float64) {
+	queue.append("gauge", name, labels, value)
+}
+
+func (queue *Queue) Observe(name string, labels map[string]string, value float64) {
+	queue.append("histogram", name, labels, value)
+}
+
+func (queue *Queue) ObserveSummary(name string, labels map[string]string, value float64) {
+	queue.append("summary", name, labels, value)
+}
+
+func (queue *Queue) append(kind, name string, labels map[string]string, value float64) {
+	line, err := json.Marshal(metrics.Sample{Kind: kind, Name: name, Labels: labels, Value: value, Time: time.Now()})
+	if err != nil {
+		// NaN and Inf values, which JSON cannot encode
+		logger.Warn(fmt.Sprintf("Queue of sink %s skips %s: %v", queue.name, name, err))
+		return
+	}
+
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.current == nil {
+		if err := queue.open(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to create queue segment of sink %s: %v", queue.name, err))
+			queue.dropped++
+			return
+		}
+	}
+	queue.buf.Write(append(line, '\n'))
+	queue.current.bytes += int64(len(line) + 1)
+	queue.current.samples++
+	if queue.current.bytes >= queue.cfg.SegmentBytes {
+		queue.roll()
+	}
+}
+
+// creates the next segment, caller must hold the lock
+func (queue *Queue) open() error {
+	seq := queue.nextSeq
+	file, err := os.OpenFile(queue.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	queue.nextSeq++
+	queue.current, queue.file, queue.buf = &segment{seq: seq}, file, bufio.NewWriter(file)
+	return nil
+}
+
+// closes the current segment and hands it to the sender, caller must hold the lock
+func (queue *Queue) roll() {
+	if queue.current == nil {
+		return
+	}
+	if err := queue.buf.Flush(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write queue segment of sink %s: %v", queue.name, err))
+	}
+	if err := queue.file.Sync(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to sync queue segment of sink %s: %v", queue.name, err))
+	}
+	queue.file.Close()
+	queue.segments = append(queue.segments, queue.current)
+	queue.current, queue.file, queue.buf = nil, nil, nil
+	queue.trim()
+	queue.notify()
+}
+
+// wakes the sender if it is waiting, never blocks
+func (queue *Queue) notify() {
+	select {
+	case queue.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writes buffered samples to disk and enforces the size limit; wakes the sender for samples
+// of the current segment, so it delivers them at most FLUSH_INTERVAL_SEC late
+func (queue *Queue) flush() {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.buf != nil {
+		if err := queue.buf.Flush(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to write queue segment of sink %s: %v", queue.name, err))
+		}
+	}
+	queue.trim()
+	if queue.current != nil && queue.current.samples > 0 {
+		queue.notify()
+	}
+}
+
+// drops the oldest closed segments while the queue is over its size, except the one being
+// delivered; caller must hold the lock
+func (queue *Queue) trim() {
+	total := queue.bytes()
+	dropped := 0
+	for i := 0; total > queue.cfg.MaxBytes && i < len(queue.segments); {
+		seg := queue.segments[i]
+		if seg.seq == queue.sending {
+			i++
+			continue
+		}
+		if err := os.Remove(queue.segmentPath(seg.seq)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logger.Error(fmt.Sprintf("Failed to remove queue segment of sink %s: %v", queue.name, err))
+			break
+		}
+		total -= seg.bytes
+		dropped += seg.samples
+		if seg.seq == queue.cursor.Seq {
+			dropped -= queue.cursor.Delivered
+		}
+		queue.segments = slices.Delete(queue.segments, i, i+1)
+	}
+	if dropped > 0 {
+		queue.dropped += dropped
+		logger.Warn(fmt.Sprintf("Queue of sink %s is full, dropped the %d oldest samples", queue.name, dropped))
+	}
+}
+
+// delivers closed segments oldest first, retrying failed batches with backoff; batches
+// rejected with a metrics.PermanentError are dropped, retrying would block the queue for good
+func (queue *Queue) send() {
+	backoff := queue.cfg.RetryInterval.Duration
+	outage := false
+	for {
+		seg, skip := queue.next()
+		if seg == nil {
+			<-queue.wake
+			continue
+		}
+		samples, err := queue.read(seg.seq)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to read queue segment of sink %s, skipping it: %v", queue.name, err))
+			queue.done(seg)
+			continue
+		}
+
+		for delivered := min(skip, len(samples)); delivered < len(samples); {
+			batch := samples[delivered:min(delivered+queue.cfg.BatchSize, len(samples))]
+			ctx, cancel := context.WithTimeout(context.Background(), WRITE_TIMEOUT_SEC*time.Second)
+			err := queue.writer.WriteSamples(ctx, batch)
+			cancel()
+			var permanent *metrics.PermanentError
+			if errors.As(err, &permanent) {
+				logger.Warn(fmt.Sprintf("Sink %s rejected %d queued samples, dropping them: %v", queue.name, len(batch), err))
+				delivered += len(batch)
+				queue.reject(seg.seq, delivered, len(batch))
+				continue
+			}
+			if err != nil {
+				queue.lock.Lock()
+				queue.failures++
+				queue.lock.Unlock()
+				if !outage {
+					logger.Warn(fmt.Sprintf("Sink %s is unreachable, queueing samples on disk: %v", queue.name, err))
+					outage = true
+				}
+				time.Sleep(backoff)
+				backoff = min(2*backoff, queue.cfg.MaxRetryInterval.Duration)
+				continue
+			}
+			if outage {
+				logger.Info(fmt.Sprintf("Sink %s is reachable again, delivering %d queued samples", queue.name, queue.pending()))
+				outage = false
+			}
+			backoff = queue.cfg.RetryInterval.Duration
+			delivered += len(batch)
+			queue.advance(seg.seq, delivered, len(batch))
+		}
+		queue.done(seg)
+	}
+}
+
+// oldest closed segment and the number of its samples already delivered; the current
+// segment is closed when there is nothing else to deliver
+func (queue *Queue) next() (*segment, int) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if len(queue.segments) == 0 && queue.current != nil && queue.current.samples > 0 {
+		queue.roll()
+	}
+	if len(queue.segments) == 0 {
+		return nil, 0
+	}
+	seg := queue.segments[0]
+	queue.sending = seg.seq
+	if queue.cursor.Seq == seg.seq {
+		return seg, queue.cursor.Delivered
+	}
+	return seg, 0
+}
+
+func (queue *Queue) advance(seq uint64, delivered, sent int) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.cursor = cursor{Seq: seq, Delivered: delivered}
+	queue.sent += sent
+	queue.saveCursor()
+}
+
+// moves past a batch the writer rejected for good
+func (queue *Queue) reject(seq uint64, delivered, rejected int) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.cursor = cursor{Seq: seq, Delivered: delivered}
+	queue.rejected += rejected
+	queue.saveCursor()
+}
+
+// removes a delivered segment
+func (queue *Queue) done(seg *segment) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.sending = 0
+	queue.segments = slices.DeleteFunc(queue.segments, func(s *segment) bool { return s == seg })
+	if err := os.Remove(queue.segmentPath(seg.seq)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Error(fmt.Sprintf("Failed to remove queue segment of sink %s: %v", queue.name, err))
+	}
+	queue.cursor = cursor{Seq: seg.seq + 1}
+	queue.saveCursor()
+}
+
+// samples of a segment, unreadable lines of a crash are skipped
+func (queue *Queue) read(seq uint64) ([]metrics.Sample, error) {
+	data, err := os.ReadFile(queue.segmentPath(seq))
+	if err != nil {
+		return nil, err
+	}
+	var samples []metrics.Sample
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var sample metrics.Sample
+		if err := json.Unmarshal(line, &sample); err != nil {
+			logger.Warn(fmt.Sprintf("Skipping unreadable queued sample of sink %s: %v", queue.name, err))
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// picks up the segments and cursor left by the last run
+func (queue *Queue) load() error {
+	entries, err := os.ReadDir(queue.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), SEGMENT_SUFFIX), 10, 64)
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), SEGMENT_SUFFIX) || err != nil {
+			continue
+		}
+		data, err := os.ReadFile(queue.segmentPath(seq))
+		if err != nil {
+			return err
+		}
+		queue.segments = append(queue.segments, &segment{seq: seq, bytes: int64(len(data)), samples: bytes.Count(data, []byte("\n"))})
+		queue.nextSeq = max(queue.nextSeq, seq+1)
+	}
+	slices.SortFunc(queue.segments, func(a, b *segment) int { return cmp.Compare(a.seq, b.seq) })
+
+	data, err := os.ReadFile(filepath.Join(queue.cfg.Dir, CURSOR_FILE))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &queue.cursor); err != nil {
+		logger.Warn(fmt.Sprintf("Ignoring unreadable queue cursor of sink %s, resending its oldest segment: %v", queue.name, err))
+		queue.cursor = cursor{}
+	}
+	return nil
+}
+
+// caller must hold the lock; a lost cursor only means samples are delivered twice
+func (queue *Queue) saveCursor() {
+	data, err := json.Marshal(queue.cursor)
+	if err == nil {
+		tmp := filepath.Join(queue.cfg.Dir, CURSOR_FILE+".tmp")
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, filepath.Join(queue.cfg.Dir, CURSOR_FILE))
+		}
+	}
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to save queue cursor of sink %s: %v", queue.name, err))
+	}
+}
+
+// publishes the self-metrics through the hub, outside the lock as the hub calls back into the queue
+func (queue *Queue) publish() {
+	queue.lock.Lock()
+	labels := map[string]string{"sink": queue.name}
+	pending, size := queue.pendingLocked(), queue.bytes()
+	sent, dropped, failures, rejected := queue.sent, queue.dropped, queue.failures, queue.rejected
+	queue.sent, queue.dropped, queue.failures, queue.rejected = 0, 0, 0, 0
+	queue.lock.Unlock()
+
+	queue.hub.SetGauge(QUEUE_PENDING_METRIC, labels, float64(pending))
+	queue.hub.SetGauge(QUEUE_BYTES_METRIC, labels, float64(size))
+	queue.hub.AddCounter(QUEUE_SENT_METRIC, labels, float64(sent))
+	queue.hub.AddCounter(QUEUE_DROPPED_METRIC, labels, float64(dropped))
+	queue.hub.AddCounter(QUEUE_FAILURES_METRIC, labels, float64(failures))
+	queue.hub.AddCounter(QUEUE_REJECTED_METRIC, labels, float64(rejected))
+}
+
+func (queue *Queue) pending() int {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	return queue.pendingLocked()
+}
+
+// caller must hold the lock
+func (queue *Queue) pendingLocked() int {
+	pending := 0
+	for _, seg := range queue.segments {
+		pending += seg.samples
+		if seg.seq == queue.cursor.Seq {
+			pending -= queue.cursor.Delivered
+		}
+	}
+	if queue.current != nil {
+		pending += queue.current.samples
+	}
+	return pending
+}
+
+// caller must hold the lock
+func (queue *Queue) bytes() int64 {
+	var total int64
+	for _, seg := range queue.segments {
+		total += seg.bytes
+	}
+	if queue.current != nil {
+		total += queue.current.bytes
+	}
+	return total
+}
+
+func (queue *Queue) segmentPath(seq uint64) string {
+	return filepath.Join(queue.cfg.Dir, fmt.Sprintf("%020d%s", seq, SEGMENT_SUFFIX))
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// records delivered samples, rejecting those of metric reject for good
+type recordingWriter struct {
+	lock      sync.Mutex
+	reject    string
+	delivered []string
+}
+
+func (writer *recordingWriter) WriteSamples(ctx context.Context, samples []metrics.Sample) error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	for _, sample := range samples {
+		if sample.Name == writer.reject {
+			return &metrics.PermanentError{Err: errors.New("400 bad request")}
+		}
+	}
+	for _, sample := range samples {
+		writer.delivered = append(writer.delivered, sample.Name)
+	}
+	return nil
+}
+
+func (writer *recordingWriter) names() []string {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	return append([]string(nil), writer.delivered...)
+}
+
+type nopSink struct{}
+
+func (nopSink) IncCounter(name string, labels map[string]string)                    {}
+func (nopSink) AddCounter(name string, labels map[string]string, delta float64)     {}
+func (nopSink) SetGauge(name string, labels map[string]string, value float64)       {}
+func (nopSink) Observe(name string, labels map[string]string, value float64)        {}
+func (nopSink) ObserveSummary(name string, labels map[string]string, value float64) {}
+
+func TestSendDropsPermanentlyRejectedBatches(t *testing.T) {
+	writer := &recordingWriter{reject: "bad_total"}
+	queue, err := New("test", config.QueueConfig{Dir: t.TempDir(), BatchSize: 1}, writer, nopSink{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.IncCounter("good_total", nil)
+	queue.IncCounter("bad_total", nil)
+	queue.IncCounter("after_total", nil)
+	queue.lock.Lock()
+	queue.roll()
+	queue.lock.Unlock()
+	go queue.send()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(writer.names()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if names := writer.names(); len(names) != 2 || names[0] != "good_total" || names[1] != "after_total" {
+		t.Fatalf("delivered %v, expected good_total and after_total", names)
+	}
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.rejected != 1 {
+		t.Fatalf("counted %d rejected samples, expected 1", queue.rejected)
+	}
+}
+
+func TestRollWakesIdleSender(t *testing.T) {
+	writer := &recordingWriter{}
+	queue, err := New("test", config.QueueConfig{Dir: t.TempDir()}, writer, nopSink{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go queue.send()
+	// let the sender find the queue empty and wait
+	time.Sleep(50 * time.Millisecond)
+	queue.IncCounter("deploy_total", nil)
+	queue.flush()
+
+	deadline := time.Now().Add(time.Second)
+	for len(writer.names()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if names := writer.names(); len(names) != 1 {
+		t.Fatalf("delivered %v, expected the flushed sample within a second", names)
+	}
+}
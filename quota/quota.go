@@ -0,0 +1,209 @@
+package quota
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// counts updates rejected because their source exceeded its series creation quota
+const QUOTA_EXCEEDED_METRIC = "collector_series_quota_exceeded_total"
+
+// fixed one-minute window of series created by a source
+type window struct {
+	start   time.Time
+	created int
+}
+
+// a series checked by AllowAll
+type Series struct {
+	Name   string
+	Labels map[string]string
+}
+
+// SeriesQuota limits how many new series each source (client IP, token, poller)
+// may create per minute, so a cardinality incident stays contained to the offending source
+// updates of already known series are always allowed
+type SeriesQuota struct {
+	lock sync.Mutex
+
+	perMinute int
+	overrides map[string]int
+
+	// "name{labelKey}" of the series seen so far -> last update; series deleted from the sink
+	// are forgotten, see Forget and StartExpiry
+	known   map[string]time.Time
+	windows map[string]*window
+
+	// receives QUOTA_EXCEEDED_METRIC
+	sink metrics.MetricSink
+}
+
+func NewSeriesQuota(cfg config.SeriesQuotaConfig, sink metrics.MetricSink) *SeriesQuota {
+	return &SeriesQuota{
+		perMinute: cfg.PerMinute,
+		overrides: cfg.Sources,
+		known:     make(map[string]time.Time),
+		windows:   make(map[string]*window),
+		sink:      sink,
+	}
+}
+
+// reports whether source may update the series, counting it against the quota if it is new
+func (quota *SeriesQuota) Allow(source, name string, labels map[string]string) bool {
+	return quota.AllowAll(source, Series{name, labels})
+}
+
+// like Allow for the series of one update, all of them or none count against the quota,
+// so a rejected update leaves no series behind
+func (quota *SeriesQuota) AllowAll(source string, series ...Series) bool {
+	if quota == nil {
+		return true
+	}
+	keys := make([]string, len(series))
+	for i, s := range series {
+		keys[i] = seriesKey(s.Name, util.JoinMapEntries(s.Labels))
+	}
+
+	quota.lock.Lock()
+	allowed := quota.allow(source, keys)
+	quota.lock.Unlock()
+
+	if !allowed {
+		logger.Warn(fmt.Sprintf("Series quota exceeded for source %s, rejected new series of %s", source, series[0].Name))
+		quota.sink.IncCounter(QUOTA_EXCEEDED_METRIC, map[string]string{"source": source})
+	}
+	return allowed
+}
+
+// caller must hold the lock
+func (quota *SeriesQuota) allow(source string, keys []string) bool {
+	now := time.Now()
+	created := 0
+	for i, key := range keys {
+		if _, exists := quota.known[key]; !exists && !slices.Contains(keys[:i], key) {
+			created++
+		}
+	}
+
+	limit, ok := quota.overrides[source]
+	if !ok {
+		limit = quota.perMinute
+	}
+	if created > 0 && limit > 0 {
+		w, ok := quota.windows[source]
+		if !ok || now.Sub(w.start) >= time.Minute {
+			w = &window{start: now}
+			quota.windows[source] = w
+		}
+		if w.created+created > limit {
+			return false
+		}
+		w.created += created
+	}
+	for _, key := range keys {
+		quota.known[key] = now
+	}
+	return true
+}
+
+// forgets a series deleted from the sink, creating it again counts against the quota;
+// nil-safe, labelsKey as joined by util.JoinMapEntries
+func (quota *SeriesQuota) Forget(name, labelsKey string) {
+	if quota == nil {
+		return
+	}
+	quota.lock.Lock()
+	defer quota.lock.Unlock()
+	delete(quota.known, seriesKey(name, labelsKey))
+}
+
+// forgets all series of a deleted metric, nil-safe
+func (quota *SeriesQuota) ForgetMetric(name string) {
+	if quota == nil {
+		return
+	}
+	quota.lock.Lock()
+	defer quota.lock.Unlock()
+	for key := range quota.known {
+		if strings.HasPrefix(key, name+"{") {
+			delete(quota.known, key)
+		}
+	}
+}
+
+// forgets series not updated within ttl, like the sink expires them, and windows of
+// sources gone quiet; series renamed on their way to the sink are only forgotten this way
+func (quota *SeriesQuota) StartExpiry(ttl time.Duration) {
+	go func() {
+		ticker := time.NewTicker(ttl / 4)
+		defer ticker.Stop()
+		for range ticker.C {
+			quota.expire(ttl)
+		}
+	}()
+}
+
+func (quota *SeriesQuota) expire(ttl time.Duration) {
+	quota.lock.Lock()
+	defer quota.lock.Unlock()
+	now := time.Now()
+	for key, updated := range quota.known {
+		if now.Sub(updated) > ttl {
+			delete(quota.known, key)
+		}
+	}
+	for source, w := range quota.windows {
+		if now.Sub(w.start) >= time.Minute {
+			delete(quota.windows, source)
+		}
+	}
+}
+
+func seriesKey(name, labelsKey string) string {
+	return name + "{" + labelsKey + "}"
+}
+
+// MetricSink wrapper dropping updates of sources over their quota, used for pollers
+type Sink struct {
+	Next   metrics.MetricSink
+	Quota  *SeriesQuota
+	Source string
+}
+
+func (qs *Sink) IncCounter(name string, labels map[string]string) {
+	if qs.Quota.Allow(qs.Source, name, labels) {
+		qs.Next.IncCounter(name, labels)
+	}
+}
+
+func (qs *Sink) AddCounter(name string, labels map[string]string, delta float64) {
+	if qs.Quota.Allow(qs.Source, name, labels) {
+		qs.Next.AddCounter(name, labels, delta)
+	}
+}
+
+func (qs *Sink) SetGauge(name string, labels map[string]string, value float64) {
+	if qs.Quota.Allow(qs.Source, name, labels) {
+		qs.Next.SetGauge(name, labels, value)
+	}
+}
+
+func (qs *Sink) Observe(name string, labels map[string]string, value float64) {
+	if qs.Quota.Allow(qs.Source, name, labels) {
+		qs.Next.Observe(name, labels, value)
+	}
+}
+
+func (qs *Sink) ObserveSummary(name string, labels map[string]string, value float64) {
+	if qs.Quota.Allow(qs.Source, name, labels) {
+		qs.Next.ObserveSummary(name, labels, value)
+	}
+}
@@ -0,0 +1,66 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+func newQuota(perMinute int) *SeriesQuota {
+	return NewSeriesQuota(config.SeriesQuotaConfig{PerMinute: perMinute}, metrics.NewMetricHub())
+}
+
+func TestAllowAllCountsAllOrNone(t *testing.T) {
+	quota := newQuota(2)
+	if !quota.Allow("a", "known_total", nil) {
+		t.Fatal("first series rejected")
+	}
+	two := []Series{
+		{Name: "events_total", Labels: map[string]string{"status": "failure"}},
+		{Name: "event_errors_total", Labels: map[string]string{"type": "timeout"}},
+	}
+	if quota.AllowAll("a", two...) {
+		t.Fatal("two new series allowed with one left in the window")
+	}
+	// the rejected update left neither series behind, so one of them still fits
+	if !quota.AllowAll("a", two[0]) {
+		t.Fatal("one new series rejected with one left in the window")
+	}
+	if !quota.AllowAll("a", two[0], Series{Name: "known_total"}) {
+		t.Fatal("known series rejected")
+	}
+}
+
+func TestForgottenSeriesCountAgain(t *testing.T) {
+	quota := newQuota(100)
+	labels := map[string]string{"host": "x"}
+	quota.Allow("a", "vm_count", labels)
+	quota.Allow("a", "vm_cpu", labels)
+	quota.Forget("vm_count", util.JoinMapEntries(labels))
+	quota.ForgetMetric("vm_cpu")
+	if len(quota.known) != 0 {
+		t.Fatalf("%d series known after forgetting all, expected none", len(quota.known))
+	}
+}
+
+func TestExpireDropsIdleSeriesAndWindows(t *testing.T) {
+	quota := newQuota(100)
+	quota.Allow("a", "old_total", nil)
+	quota.known[seriesKey("old_total", "")] = time.Now().Add(-2 * time.Hour)
+	quota.windows["a"].start = time.Now().Add(-2 * time.Minute)
+	quota.Allow("b", "new_total", nil)
+
+	quota.expire(time.Hour)
+	if _, ok := quota.known[seriesKey("old_total", "")]; ok {
+		t.Fatal("series idle beyond the ttl is still known")
+	}
+	if _, ok := quota.known[seriesKey("new_total", "")]; !ok {
+		t.Fatal("recent series was forgotten")
+	}
+	if _, ok := quota.windows["a"]; ok {
+		t.Fatal("expired window is still held")
+	}
+}
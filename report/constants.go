@@ -0,0 +1,11 @@
+package report
+
+import "time"
+
+const DEFAULT_SAMPLE_INTERVAL = 15 * time.Minute
+const DEFAULT_AT = "07:00"
+const DEFAULT_SUBJECT = "vSphere metrics %s report"
+const DEFAULT_LIMIT = 10
+
+// sent reports, labelled by result ("success" or "failure")
+const REPORTS_METRIC = "collector_reports_total"
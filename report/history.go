@@ -0,0 +1,61 @@
+package report
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+// values of all series of the sampled metrics at one point in time, metric -> labels key -> value
+type sample struct {
+	at     time.Time
+	values map[string]map[string]float64
+}
+
+// History keeps periodic snapshots of a few metrics in memory, long enough to compute
+// changes over a report period; it starts empty on every collector start
+type History struct {
+	reader    metrics.SeriesReader
+	metrics   []string
+	retention time.Duration
+
+	mu      sync.Mutex
+	samples []sample
+}
+
+func NewHistory(reader metrics.SeriesReader, metricNames []string, retention time.Duration) *History {
+	return &History{reader: reader, metrics: metricNames, retention: retention}
+}
+
+// records the current values and drops samples older than the retention
+func (h *History) Sample(now time.Time) {
+	s := sample{at: now, values: make(map[string]map[string]float64, len(h.metrics))}
+	for _, name := range h.metrics {
+		if series := h.reader.Series(name); series != nil {
+			s.values[name] = series
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples = append(h.samples, s)
+	cutoff := now.Add(-h.retention)
+	drop := 0
+	for drop < len(h.samples)-1 && h.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	h.samples = h.samples[drop:]
+}
+
+// samples taken at or after from, oldest first
+func (h *History) since(from time.Time) []sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, s := range h.samples {
+		if !s.at.Before(from) {
+			return h.samples[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package report
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+)
+
+// sends a plain text mail, the password is resolved on every send so rotated secrets are picked up
+func sendMail(cfg config.SMTPConfig, resolver *secrets.Resolver, subject, body string, now time.Time) error {
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		password := cfg.Password
+		if resolver != nil {
+			expanded, err := resolver.Expand(password)
+			if err != nil {
+				return err
+			}
+			password = expanded
+		}
+		host, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %s: %w", cfg.Addr, err)
+		}
+		auth = smtp.PlainAuth("", cfg.Username, password, host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(cfg.Addr, auth, cfg.From, cfg.To, []byte(msg.String()))
+}
@@ -0,0 +1,277 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/util"
+)
+
+// Reporter samples the metrics of its sections and emails a summary daily or weekly
+type Reporter struct {
+	cfg     config.ReportConfig
+	period  time.Duration
+	at      time.Time
+	History *History
+
+	// receives REPORTS_METRIC
+	sink    metrics.MetricSink
+	secrets *secrets.Resolver
+}
+
+// hub is both the source of the sampled values and the sink of the report metrics
+func New(cfg config.ReportConfig, hub *metrics.MetricHub, resolver *secrets.Resolver) (*Reporter, error) {
+	if cfg.At == "" {
+		cfg.At = DEFAULT_AT
+	}
+	at, err := time.Parse("15:04", cfg.At)
+	if err != nil {
+		return nil, fmt.Errorf("invalid report time %q", cfg.At)
+	}
+	if cfg.SampleInterval.Duration <= 0 {
+		cfg.SampleInterval.Duration = DEFAULT_SAMPLE_INTERVAL
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = fmt.Sprintf(DEFAULT_SUBJECT, cfg.Schedule)
+	}
+	period := 24 * time.Hour
+	if cfg.Schedule == "weekly" {
+		period = 7 * 24 * time.Hour
+	}
+
+	var names []string
+	for _, section := range cfg.Sections {
+		names = append(names, section.Metric)
+	}
+	return &Reporter{
+		cfg:     cfg,
+		period:  period,
+		at:      at,
+		History: NewHistory(hub, names, period+cfg.SampleInterval.Duration),
+		sink:    hub,
+		secrets: resolver,
+	}, nil
+}
+
+// starts sampling and sends a report at every scheduled time
+func (reporter *Reporter) Start() {
+	go func() {
+		reporter.History.Sample(time.Now())
+		ticker := time.NewTicker(reporter.cfg.SampleInterval.Duration)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			reporter.History.Sample(now)
+		}
+	}()
+	go func() {
+		for {
+			next := reporter.nextRun(time.Now())
+			time.Sleep(time.Until(next))
+			reporter.send(time.Now())
+		}
+	}()
+}
+
+// the next configured time of day, on a Monday for weekly reports
+func (reporter *Reporter) nextRun(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), reporter.at.Hour(), reporter.at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	for reporter.cfg.Schedule == "weekly" && next.Weekday() != time.Monday {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (reporter *Reporter) send(now time.Time) {
+	body := reporter.Render(now)
+	result := "success"
+	if err := sendMail(reporter.cfg.SMTP, reporter.secrets, reporter.cfg.Subject, body, now); err != nil {
+		result = "failure"
+		logger.Error(fmt.Sprintf("Failed to send %s report: %v", reporter.cfg.Schedule, err))
+	} else {
+		logger.Info(fmt.Sprintf("Sent %s report to %s", reporter.cfg.Schedule, strings.Join(reporter.cfg.SMTP.To, ", ")))
+	}
+	reporter.sink.IncCounter(REPORTS_METRIC, map[string]string{"result": result})
+}
+
+// plain text report over the period ending now
+func (reporter *Reporter) Render(now time.Time) string {
+	from := now.Add(-reporter.period)
+	samples := reporter.History.since(from)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s\n%s to %s\n", reporter.cfg.Subject, from.Format("2006-01-02 15:04"), now.Format("2006-01-02 15:04"))
+	if len(samples) > 0 && samples[0].at.Sub(from) > reporter.cfg.SampleInterval.Duration {
+		fmt.Fprintf(&out, "(history only covers the time since %s)\n", samples[0].at.Format("2006-01-02 15:04"))
+	}
+	for _, section := range reporter.cfg.Sections {
+		fmt.Fprintf(&out, "\n%s\n%s\n", section.Title, strings.Repeat("=", len(section.Title)))
+		if len(samples) == 0 {
+			out.WriteString("no data\n")
+			continue
+		}
+		table := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+		switch section.Kind {
+		case "growth":
+			renderGrowth(table, section, samples)
+		case "ratio":
+			renderRatio(table, section, samples)
+		case "top":
+			renderTop(table, section, samples)
+		}
+		table.Flush()
+	}
+	return out.String()
+}
+
+type row struct {
+	name   string
+	values []float64
+	// sort key, descending
+	key float64
+}
+
+// change between the first and last value of each row in the period
+func renderGrowth(table *tabwriter.Writer, section config.ReportSection, samples []sample) {
+	first := groupBy(section, firstValues(samples, section.Metric))
+	last := groupBy(section, samples[len(samples)-1].values[section.Metric])
+	var rows []row
+	for name, value := range last {
+		start := first[name]
+		rows = append(rows, row{name: name, values: []float64{start, value, value - start}, key: value - start})
+	}
+	fmt.Fprintln(table, "\tstart\tnow\tchange")
+	writeRows(table, rows, section.Limit, "%.4g\t%.4g\t%+.4g")
+}
+
+// share of the increase of series matching section.Match per group, e.g. failed deployments
+func renderRatio(table *tabwriter.Writer, section config.ReportSection, samples []sample) {
+	matched := map[string]float64{}
+	total := map[string]float64{}
+	for labelsKey, increase := range increases(samples, section.Metric) {
+		labels, err := util.MapFromString(labelsKey)
+		if err != nil {
+			continue
+		}
+		group := labels[section.GroupBy]
+		total[group] += increase
+		if matches(labels, section.Match) {
+			matched[group] += increase
+		}
+	}
+	var rows []row
+	for group, count := range total {
+		if count == 0 {
+			continue
+		}
+		rate := matched[group] / count
+		rows = append(rows, row{name: group, values: []float64{matched[group], count, rate * 100}, key: rate})
+	}
+	fmt.Fprintln(table, "\tmatched\ttotal\trate")
+	writeRows(table, rows, section.Limit, "%.0f\t%.0f\t%.1f%%")
+}
+
+// highest current values
+func renderTop(table *tabwriter.Writer, section config.ReportSection, samples []sample) {
+	var rows []row
+	for name, value := range groupBy(section, samples[len(samples)-1].values[section.Metric]) {
+		rows = append(rows, row{name: name, values: []float64{value}, key: value})
+	}
+	fmt.Fprintln(table, "\tvalue")
+	writeRows(table, rows, section.Limit, "%.4g")
+}
+
+func writeRows(table *tabwriter.Writer, rows []row, limit int, format string) {
+	if limit <= 0 {
+		limit = DEFAULT_LIMIT
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].key != rows[j].key {
+			return rows[i].key > rows[j].key
+		}
+		return rows[i].name < rows[j].name
+	})
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	for _, r := range rows {
+		values := make([]any, len(r.values))
+		for i, value := range r.values {
+			values[i] = value
+		}
+		fmt.Fprintf(table, "%s\t"+format+"\n", append([]any{r.name}, values...)...)
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(table, "no data")
+	}
+}
+
+// earliest value of every series seen in the period
+func firstValues(samples []sample, metric string) map[string]float64 {
+	first := map[string]float64{}
+	for _, s := range samples {
+		for labelsKey, value := range s.values[metric] {
+			if _, ok := first[labelsKey]; !ok {
+				first[labelsKey] = value
+			}
+		}
+	}
+	return first
+}
+
+// counter increase of every series in the period, counting through resets
+func increases(samples []sample, metric string) map[string]float64 {
+	increase := map[string]float64{}
+	previous := map[string]float64{}
+	for _, s := range samples {
+		for labelsKey, value := range s.values[metric] {
+			prev, seen := previous[labelsKey]
+			previous[labelsKey] = value
+			switch {
+			case !seen:
+				increase[labelsKey] = 0
+			case value >= prev:
+				increase[labelsKey] += value - prev
+			default:
+				// reset, the counter started again from 0
+				increase[labelsKey] += value
+			}
+		}
+	}
+	return increase
+}
+
+// sums series per value of section.GroupBy, or keeps them apart named by their labels
+func groupBy(section config.ReportSection, series map[string]float64) map[string]float64 {
+	grouped := make(map[string]float64, len(series))
+	for labelsKey, value := range series {
+		name := labelsKey
+		if section.GroupBy != "" {
+			labels, _ := util.MapFromString(labelsKey)
+			name = labels[section.GroupBy]
+		}
+		if name == "" {
+			name = "-"
+		}
+		grouped[name] += value
+	}
+	return grouped
+}
+
+func matches(labels, match map[string]string) bool {
+	for name, value := range match {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Provider resolves a secret by key, e.g. an environment variable name or file path
+type Provider interface {
+	Get(key string) (string, error)
+}
+
+// matches placeholders like ${env:VCENTER_TOKEN} or ${file:/run/secrets/aria-token}
+var placeholder = regexp.MustCompile(`\$\{([a-z0-9]+):([^}]+)\}`)
+
+// Resolver expands ${scheme:key} placeholders in templates using registered providers,
+// so credentials never appear in the config file itself
+type Resolver struct {
+	lock      sync.RWMutex
+	providers map[string]Provider
+}
+
+// creates a resolver with built-in "env" and "file" providers
+func NewResolver() *Resolver {
+	resolver := &Resolver{providers: make(map[string]Provider)}
+	resolver.Register("env", EnvProvider{})
+	resolver.Register("file", FileProvider{})
+	return resolver
+}
+
+// adds or replaces the provider used for placeholders with the given scheme
+func (resolver *Resolver) Register(scheme string, provider Provider) {
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+	resolver.providers[scheme] = provider
+}
+
+// replaces all placeholders in template with resolved secret values
+// templates are expanded on every use, so rotated secrets are picked up without restart
+func (resolver *Resolver) Expand(template string) (string, error) {
+	resolver.lock.RLock()
+	defer resolver.lock.RUnlock()
+
+	var firstErr error
+	expanded := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		parts := placeholder.FindStringSubmatch(match)
+		scheme, key := parts[1], parts[2]
+
+		provider, ok := resolver.providers[scheme]
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("unknown secret provider %q", scheme)
+			}
+			return ""
+		}
+		value, err := provider.Get(key)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to resolve %s secret %q: %w", scheme, key, err)
+		}
+		return value
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return expanded, nil
+}
+
+// reads secrets from environment variables
+type EnvProvider struct{}
+
+func (EnvProvider) Get(key string) (string, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("environment variable not set")
+	}
+	return value, nil
+}
+
+// reads secrets from files, e.g. Kubernetes secrets mounted into the pod
+type FileProvider struct{}
+
+func (FileProvider) Get(key string) (string, error) {
+	data, err := os.ReadFile(key)
+	if err != nil {
+		return "", err
+	}
+	// mounted secrets and files created with echo usually end with a newline
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// a secret read from Vault, cached until its lease expires
+type vaultSecret struct {
+	data    map[string]any
+	expires time.Time
+}
+
+// VaultProvider reads secrets from HashiCorp Vault over its HTTP API
+// keys have the form "<path>#<field>", e.g. ${vault:secret/data/vcenter#password}
+// both KV v1/dynamic secrets and KV v2 (nested "data") responses are supported
+type VaultProvider struct {
+	address string
+	token   string
+	client  *http.Client
+
+	// TTL for secrets without lease duration (e.g. KV v2)
+	defaultTTL time.Duration
+
+	lock  sync.Mutex
+	cache map[string]vaultSecret
+	// closed when the read of a path completes, so each path is read once at a time
+	inflight map[string]chan struct{}
+}
+
+func NewVaultProvider(address, token string, defaultTTL time.Duration) *VaultProvider {
+	return &VaultProvider{
+		address:    strings.TrimRight(address, "/"),
+		token:      token,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		defaultTTL: defaultTTL,
+		cache:      make(map[string]vaultSecret),
+		inflight:   make(map[string]chan struct{}),
+	}
+}
+
+// implements Provider
+func (vault *VaultProvider) Get(key string) (string, error) {
+	path, field, found := strings.Cut(key, "#")
+	if !found {
+		return "", fmt.Errorf("vault key must have the form <path>#<field>")
+	}
+
+	cached, err := vault.secret(path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := cached.data[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found in vault secret %s", field, path)
+	}
+	return fmt.Sprint(value), nil
+}
+
+// the secret at path, read from Vault once its lease expired; the lock is not held during
+// the request, callers needing the same path meanwhile wait for its result
+func (vault *VaultProvider) secret(path string) (vaultSecret, error) {
+	vault.lock.Lock()
+	cached, ok := vault.cache[path]
+	if ok && time.Now().Before(cached.expires) {
+		vault.lock.Unlock()
+		return cached, nil
+	}
+	done, running := vault.inflight[path]
+	if !running {
+		done = make(chan struct{})
+		vault.inflight[path] = done
+	}
+	vault.lock.Unlock()
+
+	if running {
+		<-done
+		vault.lock.Lock()
+		cached, ok = vault.cache[path]
+		vault.lock.Unlock()
+		if !ok {
+			return vaultSecret{}, fmt.Errorf("failed to read vault secret %s", path)
+		}
+		return cached, nil
+	}
+
+	data, lease, err := vault.read(path)
+	vault.lock.Lock()
+	defer close(done)
+	defer vault.lock.Unlock()
+	delete(vault.inflight, path)
+	if err != nil {
+		if !ok {
+			return vaultSecret{}, err
+		}
+		// keep serving the expired value rather than failing every poll while Vault is down
+		logger.Warn(fmt.Sprintf("Failed to refresh vault secret %s, using cached value: %v", path, err))
+		return cached, nil
+	}
+	if lease <= 0 {
+		lease = vault.defaultTTL
+	}
+	cached = vaultSecret{data: data, expires: time.Now().Add(lease)}
+	vault.cache[path] = cached
+	return cached, nil
+}
+
+// reads secret data and lease duration from Vault
+func (vault *VaultProvider) read(path string) (map[string]any, time.Duration, error) {
+	var resp struct {
+		LeaseDuration int            `json:"lease_duration"`
+		Data          map[string]any `json:"data"`
+	}
+	if err := vault.call(http.MethodGet, "/v1/"+strings.TrimLeft(path, "/"), &resp); err != nil {
+		return nil, 0, err
+	}
+
+	data := resp.Data
+	// KV v2 wraps the secret into data.data next to data.metadata
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = inner
+		}
+	}
+	return data, time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// renews the Vault token in the background at half of its TTL, if it is renewable
+func (vault *VaultProvider) StartTokenRenewal() {
+	go func() {
+		for {
+			var lookup struct {
+				Data struct {
+					TTL       int  `json:"ttl"`
+					Renewable bool `json:"renewable"`
+				} `json:"data"`
+			}
+			if err := vault.call(http.MethodGet, "/v1/auth/token/lookup-self", &lookup); err != nil {
+				logger.Error(fmt.Sprintf("Failed to look up vault token: %v", err))
+				time.Sleep(time.Minute)
+				continue
+			}
+			if !lookup.Data.Renewable || lookup.Data.TTL <= 0 {
+				// root tokens and non-renewable tokens need no renewal
+				return
+			}
+
+			time.Sleep(time.Duration(lookup.Data.TTL) * time.Second / 2)
+			if err := vault.call(http.MethodPost, "/v1/auth/token/renew-self", nil); err != nil {
+				logger.Error(fmt.Sprintf("Failed to renew vault token: %v", err))
+			}
+		}
+	}()
+}
+
+// performs a Vault API request and decodes the JSON response into out (if not nil)
+func (vault *VaultProvider) call(method, apiPath string, out any) error {
+	req, err := http.NewRequest(method, vault.address+apiPath, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", vault.token)
+
+	resp, err := vault.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("vault %s returned status %d", apiPath, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
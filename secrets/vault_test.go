@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVaultReadsPathOnceWithoutBlockingOthers(t *testing.T) {
+	var reads atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/secret/slow" {
+			reads.Add(1)
+			<-release
+		}
+		w.Write([]byte(`{"lease_duration":60,"data":{"password":"p"}}`))
+	}))
+	defer server.Close()
+	vault := NewVaultProvider(server.URL, "token", time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := vault.Get("secret/slow#password"); err != nil || value != "p" {
+				t.Errorf("slow secret returned %q, %v", value, err)
+			}
+		}()
+	}
+	// other paths are read while the slow one is outstanding
+	if value, err := vault.Get("secret/fast#password"); err != nil || value != "p" {
+		t.Fatalf("fast secret returned %q, %v", value, err)
+	}
+	close(release)
+	wg.Wait()
+	if n := reads.Load(); n != 1 {
+		t.Fatalf("slow secret read %d times, expected once", n)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/auth"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/backpressure"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/handlers"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/poller"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/prometheus"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/tracing"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// groups endpoints by the address they are bound to,
+// so ingest, scrape and admin endpoints can live on different interfaces/ports
+type servers struct {
+	muxes map[string]*http.ServeMux
+	// nil serves plain HTTP
+	tls *tls.Config
+}
+
+func newServers(tlsConfig *tls.Config) *servers {
+	return &servers{muxes: make(map[string]*http.ServeMux), tls: tlsConfig}
+}
+
+// returns the mux listening on addr, creating it on first use
+func (srv *servers) mux(addr string) *http.ServeMux {
+	if mux, ok := srv.muxes[addr]; ok {
+		return mux
+	}
+	mux := http.NewServeMux()
+	srv.muxes[addr] = mux
+	return mux
+}
+
+// starts all listeners and blocks until one of them fails
+func (srv *servers) listenAndServe() error {
+	errs := make(chan error, len(srv.muxes))
+	for addr, mux := range srv.muxes {
+		fmt.Println("Starting exporter on", addr)
+		logger.Info(fmt.Sprintf("Listening on %s", addr))
+		go func(addr string, mux *http.ServeMux) {
+			server := &http.Server{Addr: addr, Handler: mux, TLSConfig: srv.tls}
+			if srv.tls != nil {
+				// certificates are already loaded into TLSConfig
+				errs <- server.ListenAndServeTLS("", "")
+				return
+			}
+			errs <- server.ListenAndServe()
+		}(addr, mux)
+	}
+	return <-errs
+}
+
+// registers HTTP routes on the listeners configured for each endpoint group
+// pushes are rejected early by limiter while the collector is saturated,
+// authz restricts endpoints to token roles, certs attributes requests to mTLS clients,
+// scrapes first refresh scrape-triggered pollers through onDemand and are rejected until warmup
+// completed; all may be nil
+func registerRoutes(cfg *config.Config, srv *servers, limiter *backpressure.Limiter, authz *auth.Authorizer, certs *auth.ClientCerts, onDemand *poller.OnDemand, warmup *poller.Warmup) {
+	// body size and read time limits wrap everything else, nothing may read an unbounded body
+	limit := func(path string, handler http.HandlerFunc) http.HandlerFunc {
+		return backpressure.LimitRequest(cfg.LimitsFor(path), handler)
+	}
+
+	// HTTP routes for receiving pushed events
+	ingest := srv.mux(cfg.IngestAddr())
+	// request IDs come first, so rejections by the limiter can be correlated too
+	ingest.HandleFunc("/event", limit("/event", logger.Middleware(limiter.Wrap(tracing.Middleware("POST /event", certs.Wrap(authz.Require(auth.ROLE_PUSHER, handlers.EventHandler))))))) // legacy format
+	ingest.HandleFunc("/push", limit("/push", logger.Middleware(limiter.Wrap(tracing.Middleware("POST /push", certs.Wrap(authz.Require(auth.ROLE_PUSHER, handlers.PushHandler)))))))     // generic push
+	ingest.HandleFunc("/push/batch", limit("/push/batch", logger.Middleware(limiter.Wrap(tracing.Middleware("POST /push/batch", certs.Wrap(authz.Require(auth.ROLE_PUSHER, handlers.BatchHandler)))))))
+	ingest.HandleFunc("/register", limit("/register", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_PUSHER, handlers.RegisterHandler)))))
+	ingest.HandleFunc("/agent/config", limit("/agent/config", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_PUSHER, handlers.AgentConfigHandler)))))
+	ingest.HandleFunc("/annotations", limit("/annotations", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_PUSHER, handlers.AnnotationPushHandler)))))
+	ingest.HandleFunc("/annotations/{id}", limit("/annotations", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_PUSHER, handlers.AnnotationUpdateHandler)))))
+
+	// for Prometheus scraping
+	scrape := srv.mux(cfg.ScrapeAddr())
+	// callers of a tenant only see their tenant's metrics, see handlers.TenantScope
+	scrape.HandleFunc("/metrics", warmup.Wrap(authz.Require(auth.ROLE_READER, onDemand.Wrap(handlers.TenantScope(promhttp.Handler().ServeHTTP, true)))))
+	scrape.HandleFunc("/metrics/tenants/{tenant}", warmup.Wrap(authz.Require(auth.ROLE_READER, onDemand.Wrap(handlers.TenantMetricsHandler))))
+	for _, se := range cfg.ScrapeEndpoints {
+		gatherer := &prometheus.FilteredGatherer{Gatherer: promclient.DefaultGatherer, Filter: se}
+		scrape.HandleFunc(se.Path, warmup.Wrap(authz.Require(auth.ROLE_READER, onDemand.Wrap(handlers.TenantScope(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP, false)))))
+	}
+	if len(cfg.ProbeModules) > 0 {
+		scrape.HandleFunc("/probe", logger.Middleware(authz.Require(auth.ROLE_READER, handlers.TenantScope(handlers.ProbeHandler, false))))
+	}
+	scrape.HandleFunc("/api/v1/export", logger.Middleware(authz.Require(auth.ROLE_READER, handlers.TenantScope(handlers.ExportHandler, false))))
+	scrape.HandleFunc("/api/v1/dashboard", logger.Middleware(authz.Require(auth.ROLE_READER, handlers.TenantScope(handlers.DashboardHandler, false))))
+	scrape.HandleFunc("/api/annotations", logger.Middleware(authz.Require(auth.ROLE_READER, handlers.TenantScope(handlers.AnnotationsHandler, false))))
+
+	// every admin API call is audited, inside authz so entries name the authenticated caller
+	audited := handlers.Audit.Middleware
+	// health check endpoint stays open for load balancers
+	admin := srv.mux(cfg.AdminAddr())
+	admin.HandleFunc("/health", handlers.HealthHandler)
+	// readiness, unlike /health it fails until warmup completed
+	admin.HandleFunc("/ready", warmup.Wrap(handlers.HealthHandler))
+	admin.HandleFunc("/admin/series", limit("/admin/series", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_ADMIN, audited(handlers.SeriesDeleteHandler))))))
+	admin.HandleFunc("/admin/loglevel", limit("/admin/loglevel", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_ADMIN, audited(handlers.LogLevelHandler))))))
+	admin.HandleFunc("/admin/lint", limit("/admin/lint", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_ADMIN, audited(handlers.LintHandler))))))
+	admin.HandleFunc("/admin/agents", limit("/admin/agents", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_ADMIN, audited(handlers.AgentsHandler))))))
+	admin.HandleFunc("/admin/chaos", limit("/admin/chaos", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_ADMIN, audited(handlers.ChaosHandler))))))
+	admin.HandleFunc("/debug/pollers/{name}/last-response", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_ADMIN, audited(handlers.PollerResponseHandler)))))
+	admin.HandleFunc("/admin/checkpoint/diff", limit("/admin/checkpoint/diff", logger.Middleware(certs.Wrap(authz.Require(auth.ROLE_ADMIN, audited(handlers.CheckpointDiffHandler))))))
+}
@@ -0,0 +1,32 @@
+package simulator
+
+import "time"
+
+// inventory and update rate used for zero values of SimulatorConfig
+const DEFAULT_CLUSTERS = 2
+const DEFAULT_HOSTS_PER_CLUSTER = 4
+const DEFAULT_VMS_PER_HOST = 10
+const DEFAULT_DATASTORES = 4
+const DEFAULT_PROJECTS = 3
+const DEFAULT_INTERVAL = 15 * time.Second
+const DEFAULT_CHURN = 0.02
+
+const HOST_MEMORY_BYTES = 512 << 30
+const VM_MEMORY_BYTES = 16 << 30
+const DATASTORE_CAPACITY_BYTES = 8 << 40
+
+// Aria Orchestrator workflows run for deployments, with their typical duration in seconds
+// and share of failed runs
+var WORKFLOWS = []struct {
+	Name        string
+	Duration    float64
+	FailureRate float64
+}{
+	{"Provision VM", 240, 0.05},
+	{"Decommission VM", 60, 0.02},
+	{"Resize VM", 90, 0.03},
+	{"Snapshot cleanup", 600, 0.1},
+}
+
+// criticality levels of Aria Operations alerts
+var ALERT_SEVERITIES = []string{"critical", "immediate", "warning", "info"}
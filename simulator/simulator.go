@@ -0,0 +1,246 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+type vm struct {
+	name    string
+	host    *host
+	cpu     float64 // ratio of the allocated vCPUs
+	memory  float64 // ratio of the allocated memory
+	powered bool
+}
+
+type host struct {
+	name    string
+	cluster string
+}
+
+type datastore struct {
+	name string
+	used float64 // ratio of the capacity
+}
+
+// Simulator writes random-walk metrics of a made-up vSphere inventory to the sink,
+// replacing a fraction of the VMs every interval so series appear and disappear like in production,
+// next to Aria Automation, Orchestrator and Operations streams of made-up projects
+type Simulator struct {
+	cfg        config.SimulatorConfig
+	churnRate  float64
+	sink       metrics.MetricSink
+	random     *rand.Rand
+	hosts      []*host
+	vms        []*vm
+	datastores []*datastore
+	projects   []string
+	// active Aria Operations alerts per ALERT_SEVERITIES entry
+	alerts []float64
+	// numbering of new VMs, so replaced VMs get new names
+	nextVM int
+}
+
+func New(cfg config.SimulatorConfig, sink metrics.MetricSink) *Simulator {
+	cfg.Clusters = orDefault(cfg.Clusters, DEFAULT_CLUSTERS)
+	cfg.HostsPerCluster = orDefault(cfg.HostsPerCluster, DEFAULT_HOSTS_PER_CLUSTER)
+	cfg.VMsPerHost = orDefault(cfg.VMsPerHost, DEFAULT_VMS_PER_HOST)
+	cfg.Datastores = orDefault(cfg.Datastores, DEFAULT_DATASTORES)
+	cfg.Projects = orDefault(cfg.Projects, DEFAULT_PROJECTS)
+	if cfg.Interval.Duration <= 0 {
+		cfg.Interval.Duration = DEFAULT_INTERVAL
+	}
+	churn := DEFAULT_CHURN
+	if cfg.Churn != nil {
+		churn = *cfg.Churn
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	sim := &Simulator{cfg: cfg, churnRate: churn, sink: sink, random: rand.New(rand.NewSource(seed))}
+	for c := 1; c <= cfg.Clusters; c++ {
+		for h := 1; h <= cfg.HostsPerCluster; h++ {
+			sim.hosts = append(sim.hosts, &host{
+				name:    fmt.Sprintf("esx-%02d-%02d.sim.local", c, h),
+				cluster: fmt.Sprintf("cluster-%02d", c),
+			})
+		}
+	}
+	for _, h := range sim.hosts {
+		for i := 0; i < cfg.VMsPerHost; i++ {
+			sim.vms = append(sim.vms, sim.newVM(h))
+		}
+	}
+	for d := 1; d <= cfg.Datastores; d++ {
+		sim.datastores = append(sim.datastores, &datastore{
+			name: fmt.Sprintf("datastore-%02d", d),
+			used: 0.3 + 0.4*sim.random.Float64(),
+		})
+	}
+	for p := 1; p <= cfg.Projects; p++ {
+		sim.projects = append(sim.projects, fmt.Sprintf("project-%02d", p))
+	}
+	sim.alerts = make([]float64, len(ALERT_SEVERITIES))
+	return sim
+}
+
+func orDefault(value, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func (sim *Simulator) newVM(h *host) *vm {
+	sim.nextVM++
+	return &vm{
+		name:    fmt.Sprintf("vm-%05d", sim.nextVM),
+		host:    h,
+		cpu:     sim.random.Float64() * 0.6,
+		memory:  0.2 + sim.random.Float64()*0.6,
+		powered: sim.random.Float64() > 0.05,
+	}
+}
+
+func (sim *Simulator) Start() {
+	logger.Info(fmt.Sprintf("Simulating %d hosts, %d VMs, %d datastores and %d Aria projects every %v",
+		len(sim.hosts), len(sim.vms), len(sim.datastores), len(sim.projects), sim.cfg.Interval.Duration))
+	go func() {
+		sim.tick()
+		ticker := time.NewTicker(sim.cfg.Interval.Duration)
+		defer ticker.Stop()
+		for range ticker.C {
+			sim.tick()
+		}
+	}()
+}
+
+// advances all random walks, replaces churned VMs and writes every series
+func (sim *Simulator) tick() {
+	sim.churn()
+
+	hostCPU := make(map[*host]float64)
+	hostMemory := make(map[*host]float64)
+	hostVMs := make(map[*host]int)
+	for _, v := range sim.vms {
+		v.cpu = sim.walk(v.cpu, 0.05)
+		v.memory = sim.walk(v.memory, 0.02)
+		// rare power state flips
+		if sim.random.Float64() < 0.001 {
+			v.powered = !v.powered
+		}
+
+		labels := v.labels()
+		power := 0.0
+		if v.powered {
+			power = 1
+			hostCPU[v.host] += v.cpu
+			hostMemory[v.host] += v.memory * VM_MEMORY_BYTES
+			hostVMs[v.host]++
+		}
+		sim.sink.SetGauge("vsphere_vm_power_state", labels, power)
+		if !v.powered {
+			continue
+		}
+		sim.sink.SetGauge("vsphere_vm_cpu_usage_ratio", labels, v.cpu)
+		sim.sink.SetGauge("vsphere_vm_memory_usage_bytes", labels, math.Round(v.memory*VM_MEMORY_BYTES))
+		sim.sink.AddCounter("vsphere_vm_network_received_bytes_total", labels, math.Round(v.cpu*5e7*sim.random.Float64()))
+		sim.sink.AddCounter("vsphere_vm_network_transmitted_bytes_total", labels, math.Round(v.cpu*2e7*sim.random.Float64()))
+		// latency grows with load, with an occasional spike
+		latency := 0.001 + v.cpu*0.01*sim.random.ExpFloat64()
+		if sim.random.Float64() < 0.01 {
+			latency *= 20
+		}
+		sim.sink.Observe("vsphere_vm_disk_latency_seconds", labels, latency)
+	}
+
+	for _, h := range sim.hosts {
+		labels := map[string]string{"host": h.name, "cluster": h.cluster}
+		sim.sink.SetGauge("vsphere_host_cpu_usage_ratio", labels, math.Min(1, hostCPU[h]/float64(sim.cfg.VMsPerHost)))
+		sim.sink.SetGauge("vsphere_host_memory_usage_bytes", labels, math.Min(HOST_MEMORY_BYTES, hostMemory[h]))
+		sim.sink.SetGauge("vsphere_host_vms", labels, float64(hostVMs[h]))
+	}
+
+	for _, d := range sim.datastores {
+		// datastores slowly fill up and are occasionally cleaned up
+		d.used = math.Min(0.99, d.used+0.0005*sim.random.Float64())
+		if sim.random.Float64() < 0.002 {
+			d.used *= 0.7
+		}
+		labels := map[string]string{"datastore": d.name}
+		sim.sink.SetGauge("vsphere_datastore_capacity_bytes", labels, DATASTORE_CAPACITY_BYTES)
+		sim.sink.SetGauge("vsphere_datastore_free_bytes", labels, math.Round((1-d.used)*DATASTORE_CAPACITY_BYTES))
+	}
+
+	sim.aria()
+}
+
+// deployment requests of Aria Automation projects, the Orchestrator workflow runs they
+// trigger and the active Aria Operations alerts; all named aria_*, so simulated activity
+// never mixes with the events_total series of real pushes
+func (sim *Simulator) aria() {
+	for _, project := range sim.projects {
+		for i := sim.random.Intn(3); i > 0; i-- {
+			status := "successful"
+			if sim.random.Float64() < 0.08 {
+				status = "failed"
+			}
+			sim.sink.IncCounter("aria_automation_deployment_requests_total", map[string]string{"project": project, "status": status})
+		}
+	}
+
+	for _, workflow := range WORKFLOWS {
+		for i := sim.random.Intn(4); i > 0; i-- {
+			state := "completed"
+			if sim.random.Float64() < workflow.FailureRate {
+				state = "failed"
+			}
+			sim.sink.IncCounter("aria_orchestrator_workflow_runs_total", map[string]string{"workflow": workflow.Name, "state": state})
+			// mostly close to the typical duration, with a long tail
+			duration := workflow.Duration * (0.5 + 0.5*sim.random.ExpFloat64())
+			sim.sink.Observe("aria_orchestrator_workflow_duration_seconds", map[string]string{"workflow": workflow.Name}, duration)
+		}
+	}
+
+	// alerts are raised and cancelled one at a time
+	for i, severity := range ALERT_SEVERITIES {
+		sim.alerts[i] = math.Max(0, sim.alerts[i]+float64(sim.random.Intn(3)-1))
+		sim.sink.SetGauge("aria_operations_alerts", map[string]string{"severity": severity}, sim.alerts[i])
+	}
+}
+
+// replaces VMs with new ones on random hosts, deleting the series of removed VMs if the sink supports it
+func (sim *Simulator) churn() {
+	deleter, _ := sim.sink.(metrics.SeriesDeleter)
+	for i, v := range sim.vms {
+		if sim.random.Float64() >= sim.churnRate {
+			continue
+		}
+		if deleter != nil {
+			labels := v.labels()
+			for _, name := range []string{"vsphere_vm_power_state", "vsphere_vm_cpu_usage_ratio", "vsphere_vm_memory_usage_bytes",
+				"vsphere_vm_network_received_bytes_total", "vsphere_vm_network_transmitted_bytes_total", "vsphere_vm_disk_latency_seconds"} {
+				deleter.DeleteSeries(name, labels)
+			}
+		}
+		sim.vms[i] = sim.newVM(sim.hosts[sim.random.Intn(len(sim.hosts))])
+	}
+}
+
+// random walk step of a ratio kept within [0, 1]
+func (sim *Simulator) walk(value, step float64) float64 {
+	value += (sim.random.Float64()*2 - 1) * step
+	return math.Max(0, math.Min(1, value))
+}
+
+func (v *vm) labels() map[string]string {
+	return map[string]string{"vm": v.name, "host": v.host.name, "cluster": v.host.cluster}
+}
@@ -0,0 +1,60 @@
+package simulator
+
+import (
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+)
+
+// counts the updates per metric
+type countingSink struct {
+	updates map[string]int
+}
+
+func (sink *countingSink) IncCounter(name string, labels map[string]string) { sink.updates[name]++ }
+func (sink *countingSink) AddCounter(name string, labels map[string]string, delta float64) {
+	sink.updates[name]++
+}
+func (sink *countingSink) SetGauge(name string, labels map[string]string, value float64) {
+	sink.updates[name]++
+}
+func (sink *countingSink) Observe(name string, labels map[string]string, value float64) {
+	sink.updates[name]++
+}
+func (sink *countingSink) ObserveSummary(name string, labels map[string]string, value float64) {
+	sink.updates[name]++
+}
+
+func TestZeroChurnKeepsInventory(t *testing.T) {
+	churn := 0.0
+	sink := &countingSink{updates: make(map[string]int)}
+	sim := New(config.SimulatorConfig{Churn: &churn, Seed: 1}, sink)
+	before := make([]string, len(sim.vms))
+	for i, v := range sim.vms {
+		before[i] = v.name
+	}
+	for i := 0; i < 100; i++ {
+		sim.tick()
+	}
+	for i, v := range sim.vms {
+		if v.name != before[i] {
+			t.Fatalf("vm %s replaced by %s without churn", before[i], v.name)
+		}
+	}
+}
+
+func TestSimulatesAriaStreamsOnly(t *testing.T) {
+	sink := &countingSink{updates: make(map[string]int)}
+	sim := New(config.SimulatorConfig{Seed: 1}, sink)
+	for i := 0; i < 10; i++ {
+		sim.tick()
+	}
+	if sink.updates["events_total"] != 0 {
+		t.Fatal("simulator wrote the events_total of real pushes")
+	}
+	for _, name := range []string{"aria_automation_deployment_requests_total", "aria_orchestrator_workflow_runs_total", "aria_operations_alerts"} {
+		if sink.updates[name] == 0 {
+			t.Errorf("no %s simulated", name)
+		}
+	}
+}
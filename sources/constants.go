@@ -0,0 +1,7 @@
+package sources
+
+// 1 while an expected source has not pushed within StaleAfter, labelled by source
+const SOURCE_STALE_METRIC = "collector_push_source_stale"
+
+// counts pushes rejected because their source is not in the inventory
+const SOURCE_REJECTED_METRIC = "collector_push_source_rejected_total"
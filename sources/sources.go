@@ -0,0 +1,242 @@
+package sources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// one entry of an inventory file, same shape as Prometheus file_sd:
+// [{"targets": ["10.0.0.5", "10.0.0.6"], "labels": {"team": "storage"}}]
+// targets are sources as used for quotas, plain IP addresses become "ip:<addr>";
+// like file_sd target labels, the labels are added to the pushes of the targets lacking them
+type Group struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// Inventory holds the expected push sources read from a directory, so the
+// list of clients can be kept in git; it rejects unexpected sources if configured
+// and flags expected sources that stopped pushing
+type Inventory struct {
+	lock sync.Mutex
+
+	cfg  config.PushSourcesConfig
+	sink metrics.MetricSink
+
+	// source -> metadata labels from the inventory file
+	expected map[string]map[string]string
+	// last push of each expected source, sources added by a reload count from then
+	lastSeen map[string]time.Time
+	started  time.Time
+
+	// names, sizes and modification times of the last loaded files
+	fingerprint string
+}
+
+func NewInventory(cfg config.PushSourcesConfig, sink metrics.MetricSink) *Inventory {
+	return &Inventory{
+		cfg:      cfg,
+		sink:     sink,
+		expected: make(map[string]map[string]string),
+		lastSeen: make(map[string]time.Time),
+		started:  time.Now(),
+	}
+}
+
+// loads the inventory and then reloads changed files and updates staleness every RefreshInterval
+func (inv *Inventory) Start() error {
+	if err := inv.reload(); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(inv.cfg.RefreshInterval.Duration)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := inv.reload(); err != nil {
+				// keep the previous inventory until the files are fixed
+				logger.Error(fmt.Sprintf("Failed to reload push sources from %s: %v", inv.cfg.Dir, err))
+			}
+			inv.updateStale()
+		}
+	}()
+	return nil
+}
+
+// reports whether the source may push and records it as seen, nil-safe
+func (inv *Inventory) Accept(source string) bool {
+	if inv == nil {
+		return true
+	}
+
+	inv.lock.Lock()
+	_, known := inv.expected[source]
+	// only expected sources can become stale, unknown ones are not tracked
+	if known {
+		inv.lastSeen[source] = time.Now()
+	}
+	inv.lock.Unlock()
+
+	if !known && inv.cfg.RejectUnknown {
+		logger.Warn(fmt.Sprintf("Rejected push from unknown source %s", source))
+		inv.sink.IncCounter(SOURCE_REJECTED_METRIC, map[string]string{})
+		return false
+	}
+	return true
+}
+
+// the inventory labels of a source, nil for unknown sources; nil-safe, must not be modified
+func (inv *Inventory) Labels(source string) map[string]string {
+	if inv == nil {
+		return nil
+	}
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+	return inv.expected[source]
+}
+
+// re-reads the directory if any file was added, removed or modified
+func (inv *Inventory) reload() error {
+	files, fingerprint, err := ListFiles(inv.cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	inv.lock.Lock()
+	unchanged := fingerprint == inv.fingerprint
+	inv.lock.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	expected := make(map[string]map[string]string)
+	for _, file := range files {
+		groups, err := ReadList[Group](file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, group := range groups {
+			for _, target := range group.Targets {
+				expected[normalizeSource(target)] = group.Labels
+			}
+		}
+	}
+
+	inv.lock.Lock()
+	var removed []string
+	for source := range inv.expected {
+		if _, ok := expected[source]; !ok {
+			removed = append(removed, source)
+			delete(inv.lastSeen, source)
+		}
+	}
+	now := time.Now()
+	for source := range expected {
+		if _, ok := inv.expected[source]; !ok {
+			inv.lastSeen[source] = now
+		}
+	}
+	inv.expected = expected
+	inv.fingerprint = fingerprint
+	inv.lock.Unlock()
+
+	// sources no longer expected must not stay flagged
+	if deleter, ok := inv.sink.(metrics.SeriesDeleter); ok {
+		for _, source := range removed {
+			deleter.DeleteSeries(SOURCE_STALE_METRIC, map[string]string{"source": source})
+		}
+	}
+	logger.Info(fmt.Sprintf("Loaded %d push sources from %d files in %s", len(expected), len(files), inv.cfg.Dir))
+	return nil
+}
+
+// sets SOURCE_STALE_METRIC for every expected source, sources never seen
+// count from collector start
+func (inv *Inventory) updateStale() {
+	if inv.cfg.StaleAfter.Duration <= 0 {
+		return
+	}
+
+	inv.lock.Lock()
+	stale := make(map[string]bool, len(inv.expected))
+	metadata := make(map[string]map[string]string, len(inv.expected))
+	for source, labels := range inv.expected {
+		seen, ok := inv.lastSeen[source]
+		if !ok {
+			seen = inv.started
+		}
+		stale[source] = time.Since(seen) > inv.cfg.StaleAfter.Duration
+		metadata[source] = labels
+	}
+	inv.lock.Unlock()
+
+	for source, isStale := range stale {
+		value := 0.0
+		if isStale {
+			value = 1
+			logger.Warn(fmt.Sprintf("Push source %s %v has not pushed for %s", source, metadata[source], inv.cfg.StaleAfter.Duration))
+		}
+		inv.sink.SetGauge(SOURCE_STALE_METRIC, map[string]string{"source": source}, value)
+	}
+}
+
+// lists the JSON and YAML files of a directory sorted by name and builds a fingerprint
+// from their names, sizes and modification times, so callers can skip unchanged directories
+func ListFiles(dir string) ([]string, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var files []string
+	var fingerprint strings.Builder
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+		fmt.Fprintf(&fingerprint, "%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	sort.Strings(files)
+	return files, fingerprint.String(), nil
+}
+
+// reads a JSON or YAML file holding a list, by its extension
+func ReadList[T any](file string) ([]T, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var list []T
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		err = json.Unmarshal(data, &list)
+	} else {
+		err = yaml.Unmarshal(data, &list)
+	}
+	return list, err
+}
+
+// "10.0.0.5" -> "ip:10.0.0.5", other sources are kept as they are
+func normalizeSource(target string) string {
+	if net.ParseIP(target) != nil {
+		return "ip:" + target
+	}
+	return target
+}
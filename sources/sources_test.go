@@ -0,0 +1,39 @@
+package sources
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+func TestInventoryTracksOnlyExpectedSources(t *testing.T) {
+	dir := t.TempDir()
+	inventory := `[{"targets": ["10.0.0.5"], "labels": {"team": "storage"}}]`
+	if err := os.WriteFile(filepath.Join(dir, "storage.json"), []byte(inventory), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inv := NewInventory(config.PushSourcesConfig{Dir: dir}, metrics.NewMetricHub())
+	if err := inv.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if !inv.Accept(fmt.Sprintf("ip:192.0.2.%d", i)) {
+			t.Fatal("unknown source rejected without rejectUnknown")
+		}
+	}
+	inv.Accept("ip:10.0.0.5")
+	if len(inv.lastSeen) != 1 {
+		t.Fatalf("%d sources tracked, expected only the expected one", len(inv.lastSeen))
+	}
+	if labels := inv.Labels("ip:10.0.0.5"); labels["team"] != "storage" {
+		t.Fatalf("labels of 10.0.0.5 %v, expected team=storage", labels)
+	}
+	if labels := inv.Labels("ip:192.0.2.1"); labels != nil {
+		t.Fatalf("unknown source has labels %v", labels)
+	}
+}
@@ -0,0 +1,12 @@
+package syslog
+
+// messages received, labelled by result ("matched", "unmatched" or "malformed")
+const MESSAGES_METRIC = "collector_syslog_messages_total"
+
+const PUBLISH_INTERVAL_SEC = 1
+
+// longer messages and TCP frames are dropped as malformed
+const MAX_MESSAGE_BYTES = 64 * 1024
+
+// TCP connections idle for longer are closed
+const TCP_IDLE_TIMEOUT_SEC = 300
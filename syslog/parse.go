@@ -0,0 +1,116 @@
+package syslog
+
+import (
+	"errors"
+	"strings"
+)
+
+// the parts of a syslog message rules are matched against
+type Message struct {
+	Hostname string
+	AppName  string
+	Text     string
+}
+
+var errMalformed = errors.New("malformed syslog message")
+
+// parses an RFC 5424 message, falling back to the BSD format of RFC 3164
+// ("<PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG") still sent by older appliances
+func Parse(line string) (Message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "<") {
+		return Message{}, errMalformed
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return Message{}, errMalformed
+	}
+	rest := line[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		return parse5424(rest[2:])
+	}
+	return parse3164(rest), nil
+}
+
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parse5424(rest string) (Message, error) {
+	fields := make([]string, 5)
+	for i := range fields {
+		field, tail, ok := strings.Cut(rest, " ")
+		if !ok {
+			return Message{}, errMalformed
+		}
+		fields[i], rest = field, tail
+	}
+	rest, ok := skipStructuredData(rest)
+	if !ok {
+		return Message{}, errMalformed
+	}
+	msg := Message{Hostname: nilValue(fields[1]), AppName: nilValue(fields[2])}
+	msg.Text = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	return msg, nil
+}
+
+// returns what follows the structured data, which is "-" or a sequence of [id param="value" ...]
+func skipStructuredData(rest string) (string, bool) {
+	if strings.HasPrefix(rest, "-") {
+		return rest[1:], true
+	}
+	i := 0
+	for i < len(rest) && rest[i] == '[' {
+		quoted := false
+		for i++; i < len(rest); i++ {
+			c := rest[i]
+			if quoted && c == '\\' {
+				i++
+				continue
+			}
+			if c == '"' {
+				quoted = !quoted
+			}
+			if c == ']' && !quoted {
+				break
+			}
+		}
+		if i == len(rest) {
+			return "", false
+		}
+		i++
+	}
+	if i == 0 {
+		return "", false
+	}
+	return rest[i:], true
+}
+
+func parse3164(rest string) Message {
+	// the timestamp has a fixed width of 15 characters, e.g. "Oct  5 13:04:01"
+	if len(rest) > 16 && rest[3] == ' ' && rest[6] == ' ' && rest[15] == ' ' {
+		rest = rest[16:]
+	}
+	var msg Message
+	host, tail, ok := strings.Cut(rest, " ")
+	if !ok {
+		msg.Text = rest
+		return msg
+	}
+	tag, text, ok := strings.Cut(tail, ": ")
+	if !ok || strings.ContainsRune(tag, ' ') {
+		// no TAG, the first word is part of the message
+		msg.Hostname, msg.Text = host, tail
+		return msg
+	}
+	if pid := strings.IndexByte(tag, '['); pid > 0 {
+		tag = tag[:pid]
+	}
+	msg.Hostname, msg.AppName, msg.Text = host, tag, text
+	return msg
+}
+
+// "-" is the RFC 5424 NILVALUE
+func nilValue(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
@@ -0,0 +1,37 @@
+package syslog
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/grok"
+)
+
+type rule struct {
+	metric    string
+	pattern   *regexp.Regexp
+	appName   string
+	labels    map[string]string
+	hostLabel string
+}
+
+func compileRule(rc config.SyslogRule) (*rule, error) {
+	pattern, err := grok.Compile(rc.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", rc.Metric, err)
+	}
+	return &rule{metric: rc.Metric, pattern: pattern, appName: rc.AppName, labels: rc.Labels, hostLabel: rc.HostLabel}, nil
+}
+
+// labels of the counter to increment, nil if the message does not match
+func (r *rule) match(msg Message) map[string]string {
+	if r.appName != "" && r.appName != msg.AppName {
+		return nil
+	}
+	labels := grok.Match(r.pattern, msg.Text, r.labels)
+	if labels != nil && r.hostLabel != "" {
+		labels[r.hostLabel] = msg.Hostname
+	}
+	return labels
+}
@@ -0,0 +1,182 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/quota"
+)
+
+// Receiver listens for syslog messages and increments the counters of matching rules,
+// bridging appliances that only log (e.g. vpxd login failures) into the metric pipeline
+type Receiver struct {
+	cfg   config.SyslogConfig
+	rules []*rule
+	sink  metrics.MetricSink
+	// optional, limits the series created from label values captured by rules,
+	// counted per rule metric as source "syslog:<metric>"
+	Quota *quota.SeriesQuota
+
+	// matched, unmatched and malformed messages
+	messages *metrics.SampledCounter
+}
+
+func New(cfg config.SyslogConfig, sink metrics.MetricSink) (*Receiver, error) {
+	receiver := &Receiver{
+		cfg:      cfg,
+		sink:     sink,
+		messages: metrics.NewSampledCounter(sink, MESSAGES_METRIC, "result", "matched", "unmatched", "malformed"),
+	}
+	for _, rc := range cfg.Rules {
+		r, err := compileRule(rc)
+		if err != nil {
+			return nil, err
+		}
+		receiver.rules = append(receiver.rules, r)
+	}
+	return receiver, nil
+}
+
+// binds the configured listeners and serves them in the background
+func (receiver *Receiver) Start() error {
+	if receiver.cfg.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", receiver.cfg.UDPAddr)
+		if err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("Listening for syslog on udp %s", receiver.cfg.UDPAddr))
+		go receiver.serveUDP(conn)
+	}
+	if receiver.cfg.TCPAddr != "" {
+		listener, err := net.Listen("tcp", receiver.cfg.TCPAddr)
+		if err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("Listening for syslog on tcp %s", receiver.cfg.TCPAddr))
+		go receiver.serveTCP(listener)
+	}
+	// counters are sampled to keep the sink out of the receive loop
+	metrics.PublishEvery(PUBLISH_INTERVAL_SEC*time.Second, receiver.messages.Publish)
+	return nil
+}
+
+func (receiver *Receiver) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, MAX_MESSAGE_BYTES)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Syslog listener on udp %s stopped: %v", receiver.cfg.UDPAddr, err))
+			return
+		}
+		receiver.Handle(string(buf[:n]))
+	}
+}
+
+func (receiver *Receiver) serveTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Syslog listener on tcp %s stopped: %v", receiver.cfg.TCPAddr, err))
+			return
+		}
+		go receiver.serveConn(conn)
+	}
+}
+
+func (receiver *Receiver) serveConn(conn net.Conn) {
+	defer conn.Close()
+	// bounds the memory a connection can hold, see readFrame
+	reader := bufio.NewReaderSize(conn, MAX_MESSAGE_BYTES)
+	for {
+		conn.SetReadDeadline(time.Now().Add(TCP_IDLE_TIMEOUT_SEC * time.Second))
+		frame, err := readFrame(reader)
+		if errors.Is(err, errTooLong) {
+			// skipped up to the next newline, the connection stays usable
+			receiver.messages.Inc("malformed")
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				receiver.messages.Inc("malformed")
+				logger.Warn(fmt.Sprintf("Closing syslog connection from %s: %v", conn.RemoteAddr(), err))
+			}
+			return
+		}
+		receiver.Handle(frame)
+	}
+}
+
+// returned by readFrame for newline-terminated messages longer than the reader's buffer
+var errTooLong = fmt.Errorf("message longer than %d bytes", MAX_MESSAGE_BYTES)
+
+// reads an octet-counted frame ("<length> <message>") or a newline-terminated message;
+// reads are bounded by the buffer of reader, longer messages are discarded up to the
+// next newline and reported as errTooLong
+func readFrame(reader *bufio.Reader) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if first[0] < '0' || first[0] > '9' {
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = reader.ReadSlice('\n')
+			}
+			if err != nil {
+				return "", err
+			}
+			return "", errTooLong
+		}
+		if err != nil && len(line) == 0 {
+			return "", err
+		}
+		return string(line), nil
+	}
+	prefixBytes, err := reader.ReadSlice(' ')
+	if err != nil {
+		return "", fmt.Errorf("invalid frame length: %w", err)
+	}
+	prefix := string(prefixBytes)
+	length, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+	if err != nil || length <= 0 || length > MAX_MESSAGE_BYTES {
+		return "", fmt.Errorf("invalid frame length %q", prefix)
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(reader, frame); err != nil {
+		return "", err
+	}
+	return string(frame), nil
+}
+
+// matches a single syslog message against all rules
+func (receiver *Receiver) Handle(line string) {
+	msg, err := Parse(line)
+	if err != nil {
+		receiver.messages.Inc("malformed")
+		return
+	}
+	matched := false
+	for _, r := range receiver.rules {
+		if labels := r.match(msg); labels != nil {
+			if receiver.Quota.Allow("syslog:"+r.metric, r.metric, labels) {
+				receiver.sink.IncCounter(r.metric, labels)
+			}
+			matched = true
+		}
+	}
+	if matched {
+		receiver.messages.Inc("matched")
+	} else {
+		receiver.messages.Inc("unmatched")
+	}
+}
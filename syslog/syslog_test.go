@@ -0,0 +1,41 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadFrameSkipsOverlongMessages(t *testing.T) {
+	long := strings.Repeat("x", MAX_MESSAGE_BYTES*2)
+	input := "<14>first\n" + long + "\n<14>second\n10 <14>framed"
+	reader := bufio.NewReaderSize(strings.NewReader(input), MAX_MESSAGE_BYTES)
+
+	expected := []struct {
+		frame string
+		err   error
+	}{
+		{"<14>first\n", nil},
+		{"", errTooLong},
+		{"<14>second\n", nil},
+		{"<14>framed", nil},
+		{"", io.EOF},
+	}
+	for i, want := range expected {
+		frame, err := readFrame(reader)
+		if frame != want.frame || !errors.Is(err, want.err) {
+			t.Fatalf("frame %d: got %q, %v, expected %q, %v", i, frame, err, want.frame, want.err)
+		}
+	}
+}
+
+func TestReadFrameRejectsInvalidLength(t *testing.T) {
+	for _, input := range []string{"0 <14>x", "999999999 <14>x", strings.Repeat("1", MAX_MESSAGE_BYTES+1)} {
+		reader := bufio.NewReaderSize(strings.NewReader(input), MAX_MESSAGE_BYTES)
+		if _, err := readFrame(reader); err == nil {
+			t.Fatalf("frame %.20q was accepted", input)
+		}
+	}
+}
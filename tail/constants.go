@@ -0,0 +1,11 @@
+package tail
+
+const DEFAULT_POLL_INTERVAL_MS = 1000
+
+// lines read per file, labelled by path and result ("matched", "unmatched" or "oversized")
+const LINES_METRIC = "collector_tail_lines_total"
+
+const READ_CHUNK_BYTES = 64 * 1024
+
+// longer lines are dropped and counted as oversized
+const MAX_LINE_BYTES = 64 * 1024
@@ -0,0 +1,215 @@
+// Package tail follows local log files and turns matching lines into counter increments,
+// for collectors running on appliances where logs are the only data source
+package tail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/grok"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/metrics"
+)
+
+type rule struct {
+	metric  string
+	pattern *regexp.Regexp
+	labels  map[string]string
+}
+
+// Tailer polls a file for appended lines; a file replaced at the path (rotation) is read to
+// its end before the new one is opened, a file shrinking below the read offset (copytruncate)
+// is read again from the start
+type Tailer struct {
+	cfg   config.TailConfig
+	rules []rule
+	sink  metrics.MetricSink
+
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+	// incomplete last line, completed by the next read
+	partial []byte
+	// the rest of an oversized line is discarded up to its newline
+	skipping bool
+	// the file was missing at the last check, logged once
+	missing bool
+}
+
+func New(cfg config.TailConfig, sink metrics.MetricSink) (*Tailer, error) {
+	if cfg.PollInterval.Duration <= 0 {
+		cfg.PollInterval.Duration = DEFAULT_POLL_INTERVAL_MS * time.Millisecond
+	}
+	tailer := &Tailer{cfg: cfg, sink: sink}
+	for _, rc := range cfg.Rules {
+		pattern, err := grok.Compile(rc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rc.Metric, err)
+		}
+		tailer.rules = append(tailer.rules, rule{metric: rc.Metric, pattern: pattern, labels: mergeLabels(cfg.Labels, rc.Labels)})
+	}
+	return tailer, nil
+}
+
+// opens the file, positioned at its end unless FromStart, and follows it in the background
+func (tailer *Tailer) Start() {
+	if err := tailer.open(!tailer.cfg.FromStart); err != nil {
+		tailer.logMissing(err)
+	}
+	logger.Info(fmt.Sprintf("Tailing %s", tailer.cfg.Path))
+	go func() {
+		ticker := time.NewTicker(tailer.cfg.PollInterval.Duration)
+		defer ticker.Stop()
+		for range ticker.C {
+			tailer.check()
+		}
+	}()
+}
+
+func (tailer *Tailer) open(atEnd bool) error {
+	file, err := os.Open(tailer.cfg.Path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	tailer.file, tailer.info, tailer.offset, tailer.partial, tailer.skipping = file, info, 0, nil, false
+	if atEnd {
+		tailer.offset = info.Size()
+	}
+	if tailer.missing {
+		logger.Info(fmt.Sprintf("Tailed file %s is back", tailer.cfg.Path))
+		tailer.missing = false
+	}
+	return nil
+}
+
+// reads new lines, following rotation and truncation
+func (tailer *Tailer) check() {
+	if tailer.file == nil {
+		// files created after startup are read from their start
+		if err := tailer.open(false); err != nil {
+			tailer.logMissing(err)
+			return
+		}
+	}
+	tailer.read()
+
+	info, err := os.Stat(tailer.cfg.Path)
+	switch {
+	case err != nil:
+		// rotated away and not recreated yet, the old file was read to its end above
+		tailer.flush()
+		tailer.close()
+		tailer.logMissing(err)
+	case !os.SameFile(info, tailer.info):
+		tailer.flush()
+		tailer.close()
+		if err := tailer.open(false); err == nil {
+			tailer.read()
+		}
+	case info.Size() < tailer.offset:
+		tailer.offset, tailer.partial, tailer.skipping = 0, nil, false
+		tailer.read()
+	}
+}
+
+func (tailer *Tailer) read() {
+	lines := map[string]int64{}
+	for {
+		buf := make([]byte, READ_CHUNK_BYTES)
+		n, err := tailer.file.ReadAt(buf, tailer.offset)
+		tailer.offset += int64(n)
+		data := append(tailer.partial, buf[:n]...)
+		for {
+			end := bytes.IndexByte(data, '\n')
+			if end < 0 {
+				break
+			}
+			if tailer.skipping {
+				tailer.skipping = false
+			} else {
+				lines[tailer.handle(string(bytes.TrimSuffix(data[:end], []byte("\r"))))]++
+			}
+			data = data[end+1:]
+		}
+		if len(data) > MAX_LINE_BYTES {
+			// no newline in sight, drop what was read so far instead of buffering without bound
+			if !tailer.skipping {
+				lines["oversized"]++
+			}
+			data, tailer.skipping = nil, true
+		}
+		tailer.partial = append([]byte(nil), data...)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Warn(fmt.Sprintf("Failed to read %s: %v", tailer.cfg.Path, err))
+			}
+			break
+		}
+	}
+	for result, count := range lines {
+		tailer.sink.AddCounter(LINES_METRIC, map[string]string{"path": tailer.cfg.Path, "result": result}, float64(count))
+	}
+}
+
+// matches a line against all rules, returns "matched" or "unmatched"
+func (tailer *Tailer) handle(line string) string {
+	result := "unmatched"
+	for _, r := range tailer.rules {
+		if labels := grok.Match(r.pattern, line, r.labels); labels != nil {
+			tailer.sink.IncCounter(r.metric, labels)
+			result = "matched"
+		}
+	}
+	return result
+}
+
+// a rotated file may end without a newline, its last line is complete nonetheless
+func (tailer *Tailer) flush() {
+	if len(tailer.partial) > 0 && !tailer.skipping {
+		result := tailer.handle(string(tailer.partial))
+		tailer.sink.AddCounter(LINES_METRIC, map[string]string{"path": tailer.cfg.Path, "result": result}, 1)
+		tailer.partial = nil
+	}
+}
+
+func (tailer *Tailer) close() {
+	if tailer.file != nil {
+		tailer.file.Close()
+		tailer.file = nil
+	}
+}
+
+func (tailer *Tailer) logMissing(err error) {
+	if tailer.missing {
+		return
+	}
+	tailer.missing = true
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Warn(fmt.Sprintf("Tailed file %s does not exist, waiting for it", tailer.cfg.Path))
+		return
+	}
+	logger.Warn(fmt.Sprintf("Failed to open tailed file %s: %v", tailer.cfg.Path, err))
+}
+
+func mergeLabels(static, extra map[string]string) map[string]string {
+	labels := make(map[string]string, len(static)+len(extra))
+	for name, value := range static {
+		labels[name] = value
+	}
+	for name, value := range extra {
+		labels[name] = value
+	}
+	return labels
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"strings"
+	"sync"
+)
+
+// Interner returns one shared copy of equal strings, so the label values and joined label
+// keys of many series don't each hold their own copy. Bounded to max strings in two
+// generations: once the current one holds half of them it replaces the previous one,
+// which drops the strings not used since. Nil-safe, a nil Interner returns strings as they are
+type Interner struct {
+	lock     sync.Mutex
+	max      int
+	current  map[string]string
+	previous map[string]string
+}
+
+// max below 2 is raised to 2, a generation holds at least one string
+func NewInterner(max int) *Interner {
+	if max < 2 {
+		max = 2
+	}
+	return &Interner{max: max, current: make(map[string]string)}
+}
+
+// the shared copy of s
+func (interner *Interner) Intern(s string) string {
+	if interner == nil || s == "" {
+		return s
+	}
+	interner.lock.Lock()
+	defer interner.lock.Unlock()
+	return interner.intern(s)
+}
+
+// a copy of labels with shared label names and values, labels itself for a nil Interner
+func (interner *Interner) Labels(labels map[string]string) map[string]string {
+	if interner == nil {
+		return labels
+	}
+	interner.lock.Lock()
+	defer interner.lock.Unlock()
+	interned := make(map[string]string, len(labels))
+	for name, value := range labels {
+		interned[interner.intern(name)] = interner.intern(value)
+	}
+	return interned
+}
+
+// number of strings held
+func (interner *Interner) Len() int {
+	if interner == nil {
+		return 0
+	}
+	interner.lock.Lock()
+	defer interner.lock.Unlock()
+	return len(interner.current) + len(interner.previous)
+}
+
+// caller must hold the lock
+func (interner *Interner) intern(s string) string {
+	if shared, ok := interner.current[s]; ok {
+		return shared
+	}
+	shared, ok := interner.previous[s]
+	if !ok {
+		// cloned, s may be part of a larger string, e.g. a joined label key or a request body
+		shared = strings.Clone(s)
+	}
+	if len(interner.current) >= interner.max/2 {
+		interner.previous = interner.current
+		interner.current = make(map[string]string, len(interner.previous))
+	}
+	interner.current[shared] = shared
+	return shared
+}
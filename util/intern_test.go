@@ -0,0 +1,94 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// whether a and b share their bytes rather than being equal copies
+func sameString(a, b string) bool {
+	return len(a) == len(b) && unsafe.StringData(a) == unsafe.StringData(b)
+}
+
+func TestInternerSharesEqualStrings(t *testing.T) {
+	interner := NewInterner(100)
+	first := interner.Intern(strings.Clone("vc01"))
+	second := interner.Intern(strings.Clone("vc01"))
+	if !sameString(first, second) {
+		t.Fatal("equal strings were not shared")
+	}
+	if interner.Len() != 1 {
+		t.Fatalf("holds %d strings, expected 1", interner.Len())
+	}
+}
+
+func TestInternerClonesSubstrings(t *testing.T) {
+	interner := NewInterner(100)
+	body := "cluster=a|host=b"
+	interned := interner.Intern(body[:9])
+	if interned != "cluster=a" || sameString(interned, body[:9]) {
+		t.Fatal("substring was held instead of a copy")
+	}
+}
+
+func TestInternerGenerationRollover(t *testing.T) {
+	interner := NewInterner(4)
+	a := interner.Intern(strings.Clone("a"))
+	interner.Intern("b")
+	// the current generation holds max/2 strings, c starts a new one with a and b as previous
+	interner.Intern("c")
+	if interner.Len() != 3 {
+		t.Fatalf("holds %d strings after rollover, expected 3", interner.Len())
+	}
+	// a is promoted from the previous generation and stays shared
+	if promoted := interner.Intern(strings.Clone("a")); !sameString(promoted, a) {
+		t.Fatal("string of the previous generation was not reused")
+	}
+	// d rolls over again, dropping b which was not used since
+	interner.Intern("d")
+	if _, held := interner.previous["b"]; held {
+		t.Fatal("b was kept although not used in the current generation")
+	}
+	if _, held := interner.previous["a"]; !held {
+		t.Fatal("a was dropped although used in the current generation")
+	}
+	if interner.Len() > 4 {
+		t.Fatalf("holds %d strings, more than max", interner.Len())
+	}
+}
+
+func TestInternerMaxBelowTwo(t *testing.T) {
+	for _, max := range []int{-1, 0, 1} {
+		interner := NewInterner(max)
+		for _, s := range []string{"a", "b", "a", "c"} {
+			if interned := interner.Intern(s); interned != s {
+				t.Fatalf("max %d: interned %q as %q", max, s, interned)
+			}
+		}
+		if interner.Len() > 2 {
+			t.Fatalf("max %d: holds %d strings, expected at most 2", max, interner.Len())
+		}
+	}
+}
+
+func TestInternerLabels(t *testing.T) {
+	interner := NewInterner(100)
+	labels := map[string]string{"host": "esx01"}
+	interned := interner.Labels(labels)
+	interned["host"] = "changed"
+	if labels["host"] != "esx01" {
+		t.Fatal("Labels modified the map of the caller")
+	}
+}
+
+func TestNilInterner(t *testing.T) {
+	var interner *Interner
+	labels := map[string]string{"host": "esx01"}
+	if interner.Intern("a") != "a" || interner.Len() != 0 {
+		t.Fatal("nil interner changed strings or holds some")
+	}
+	if interned := interner.Labels(labels); interned["host"] != "esx01" {
+		t.Fatal("nil interner changed labels")
+	}
+}
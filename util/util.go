@@ -2,10 +2,12 @@ package util
 
 import (
 	"cmp"
+	"crypto/tls"
+	"fmt"
+	"regexp"
 	"slices"
 	"strings"
-
-	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"time"
 )
 
 // sorted keys from a map
@@ -24,34 +26,91 @@ func SortedKeysFromMap[T cmp.Ordered](amap map[T]T) []T {
 
 // merges key-value pairs from map into a single string
 // map to "errType=unathenticated|status=failure"
+// runs for every metric update, so the result string is its only allocation for typical label counts
 func JoinMapEntries(labels map[string]string) string {
-
-	keys := SortedKeysFromMap(labels)
-	if len(keys) == 0 {
+	if len(labels) == 0 {
 		return ""
 	}
-	parts := make([]string, 0, len(keys))
-	for _, k := range keys {
-		parts = append(parts, k+KEY_VAL_SEPARATOR+labels[k])
+
+	// keys are sorted in a stack buffer unless there are unusually many labels
+	var buffer [16]string
+	keys := buffer[:0]
+	size := 0
+	for k, v := range labels {
+		keys = append(keys, k)
+		size += len(k) + len(v) + len(KEY_VAL_SEPARATOR) + len(MAP_ENTRY_SEPARATOR)
+	}
+	slices.Sort(keys)
+
+	var joined strings.Builder
+	joined.Grow(size)
+	for i, k := range keys {
+		if i > 0 {
+			joined.WriteString(MAP_ENTRY_SEPARATOR)
+		}
+		joined.WriteString(k)
+		joined.WriteString(KEY_VAL_SEPARATOR)
+		joined.WriteString(labels[k])
 	}
-	return strings.Join(parts, MAP_ENTRY_SEPARATOR)
+	return joined.String()
 }
 
 // merges key-value pairs from map into a single string
-// "errType=unathenticated|status=failure" to map
-func MapFromString(mapAsString string) map[string]string {
+// "errType=unathenticated|status=failure" to map, values may contain KEY_VAL_SEPARATOR
+func MapFromString(mapAsString string) (map[string]string, error) {
 	labels := make(map[string]string)
+	// series without labels
 	if mapAsString == "" {
-		logger.Error("Joined labels string is empty")
-		return labels
+		return labels, nil
 	}
 
 	pairs := strings.Split(mapAsString, MAP_ENTRY_SEPARATOR)
 
 	for _, keyVal := range pairs {
-		key := strings.Split(keyVal, KEY_VAL_SEPARATOR)[0]
-		value := strings.Split(keyVal, KEY_VAL_SEPARATOR)[1]
+		key, value, found := strings.Cut(keyVal, KEY_VAL_SEPARATOR)
+		if !found || key == "" {
+			return nil, fmt.Errorf("malformed label pair %q", keyVal)
+		}
 		labels[key] = value
 	}
-	return labels
+	return labels, nil
+}
+
+// first label whose value contains MAP_ENTRY_SEPARATOR, JoinMapEntries can't join such labels reversibly
+func InvalidLabelValue(labels map[string]string) (string, bool) {
+	for label, value := range labels {
+		if strings.Contains(value, MAP_ENTRY_SEPARATOR) {
+			return label, true
+		}
+	}
+	return "", false
+}
+
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// reports whether name is a valid metric name
+func ValidMetricName(name string) bool {
+	return metricNamePattern.MatchString(name)
+}
+
+// reports whether name is a valid label name, metric names may also contain ':'
+func ValidLabelName(name string) bool {
+	return labelNamePattern.MatchString(name)
+}
+
+// earliest notAfter of the certificates a TLS server presented, false for plain connections
+func EarliestCertExpiry(state *tls.ConnectionState) (time.Time, bool) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return time.Time{}, false
+	}
+	earliest := state.PeerCertificates[0].NotAfter
+	for _, cert := range state.PeerCertificates[1:] {
+		if cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	return earliest, true
 }
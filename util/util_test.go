@@ -0,0 +1,53 @@
+package util
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestMapFromStringRoundTrips(t *testing.T) {
+	for _, labels := range []map[string]string{
+		{},
+		{"cluster": "a"},
+		{"cluster": "a", "host": "b"},
+		{"query": "x=1", "empty": ""},
+	} {
+		parsed, err := MapFromString(JoinMapEntries(labels))
+		if err != nil {
+			t.Fatalf("%v: %v", labels, err)
+		}
+		if !maps.Equal(parsed, labels) {
+			t.Fatalf("%v parsed back as %v", labels, parsed)
+		}
+	}
+}
+
+func TestMapFromStringRejectsMalformedPairs(t *testing.T) {
+	for _, key := range []string{"cluster", "cluster=a|b", "=a", "cluster=a|"} {
+		if labels, err := MapFromString(key); err == nil {
+			t.Errorf("%q parsed as %v", key, labels)
+		}
+	}
+}
+
+func TestInvalidLabelValue(t *testing.T) {
+	if label, invalid := InvalidLabelValue(map[string]string{"query": "a=b", "host": "b"}); invalid {
+		t.Fatalf("label %s reported invalid", label)
+	}
+	if label, invalid := InvalidLabelValue(map[string]string{"path": "a|b", "host": "b"}); !invalid || label != "path" {
+		t.Fatalf("got %q, %v, expected path", label, invalid)
+	}
+}
+
+func TestValidNames(t *testing.T) {
+	for name, valid := range map[string]bool{"cluster": true, "_host": true, "disk_0": true, "0disk": false, "": false, "a-b": false, "node:cpu": false} {
+		if ValidLabelName(name) != valid {
+			t.Errorf("label name %q: expected valid=%v", name, valid)
+		}
+	}
+	for name, valid := range map[string]bool{"node:cpu_total": true, ":x": true, "cpu total": false, "1cpu": false} {
+		if ValidMetricName(name) != valid {
+			t.Errorf("metric name %q: expected valid=%v", name, valid)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package vcenter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/secrets"
+)
+
+// header carrying the session id for vSphere Automation REST API requests
+const SESSION_HEADER = "vmware-api-session-id"
+
+// Session is an authenticated vSphere REST API session shared by all pollers
+// polling the same vCenter with the same user
+type Session struct {
+	baseURL  string
+	username string
+	// may contain secret placeholders, resolved on every login so rotation is picked up
+	password string
+	secrets  *secrets.Resolver
+	client   *http.Client
+
+	lock sync.Mutex
+	id   string
+}
+
+// logs in if there is no valid session yet and returns the session id
+func (session *Session) ID() (string, error) {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+
+	if session.id != "" {
+		return session.id, nil
+	}
+	id, err := session.login()
+	if err != nil {
+		return "", err
+	}
+	session.id = id
+	return id, nil
+}
+
+// implements poller.Authenticator
+func (session *Session) Authenticate(req *http.Request) error {
+	id, err := session.ID()
+	if err != nil {
+		return err
+	}
+	req.Header.Set(SESSION_HEADER, id)
+	return nil
+}
+
+// drops the current session, next request logs in again
+func (session *Session) Invalidate() {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	session.id = ""
+}
+
+// creates a new session via POST /api/session with basic auth
+func (session *Session) login() (string, error) {
+	password := session.password
+	if session.secrets != nil {
+		var err error
+		if password, err = session.secrets.Expand(password); err != nil {
+			return "", err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, session.baseURL+"/api/session", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(session.username, password)
+
+	resp, err := session.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("vcenter login to %s failed with status %d", session.baseURL, resp.StatusCode)
+	}
+
+	// response body is the session id as JSON string
+	var id string
+	if err := json.NewDecoder(resp.Body).Decode(&id); err != nil {
+		return "", err
+	}
+	logger.Info(fmt.Sprintf("Created vcenter session for %s@%s", session.username, session.baseURL))
+	return id, nil
+}
+
+// checks the session is still alive, which also resets its idle timeout on vCenter
+func (session *Session) keepalive() {
+	session.lock.Lock()
+	id := session.id
+	session.lock.Unlock()
+	if id == "" {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, session.baseURL+"/api/session", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set(SESSION_HEADER, id)
+	resp, err := session.client.Do(req)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Vcenter session keepalive for %s failed: %v", session.baseURL, err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		logger.Info(fmt.Sprintf("Vcenter session for %s expired, will log in again", session.baseURL))
+		session.Invalidate()
+	}
+}
+
+// SessionPool shares one session per vCenter and user across pollers,
+// so many pollers against the same vCenter don't trip its session limits
+type SessionPool struct {
+	lock     sync.Mutex
+	sessions map[string]*Session
+	secrets  *secrets.Resolver
+	client   *http.Client
+}
+
+func NewSessionPool(resolver *secrets.Resolver) *SessionPool {
+	return &SessionPool{
+		sessions: make(map[string]*Session),
+		secrets:  resolver,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// returns the shared session for vCenter baseURL and username, creating it on first use
+// sessions log in lazily on first request
+func (pool *SessionPool) Get(baseURL, username, password string) *Session {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	baseURL = strings.TrimRight(baseURL, "/")
+	key := username + "@" + baseURL
+	if session, ok := pool.sessions[key]; ok {
+		return session
+	}
+	session := &Session{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		secrets:  pool.secrets,
+		client:   pool.client,
+	}
+	pool.sessions[key] = session
+	return session
+}
+
+// periodically pings all sessions to keep them from idling out, disabled unless interval is positive
+func (pool *SessionPool) StartKeepalive(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			pool.lock.Lock()
+			sessions := make([]*Session, 0, len(pool.sessions))
+			for _, session := range pool.sessions {
+				sessions = append(sessions, session)
+			}
+			pool.lock.Unlock()
+
+			for _, session := range sessions {
+				session.keepalive()
+			}
+		}
+	}()
+}
@@ -0,0 +1,124 @@
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/config"
+	"github.com/Tata-Matata/aria-vsphere-metrics-collector/logger"
+)
+
+// implemented by sinks able to drop series to free memory
+type Evictor interface {
+	EvictOldest(n int) []string
+}
+
+// MemoryGuard periodically checks process heap/RSS and evicts
+// least-recently-updated series while the process is over the configured limits,
+// so the collector survives cardinality spikes on small VMs
+type MemoryGuard struct {
+	maxHeapBytes uint64
+	maxRSSBytes  uint64
+	interval     time.Duration
+	evictBatch   int
+	evictor      Evictor
+
+	// result of the last check, read by push backpressure
+	overLimit atomic.Bool
+}
+
+// a check interval or evict batch that is not positive falls back to its default
+func NewMemoryGuard(cfg config.MemoryGuardConfig, evictor Evictor) *MemoryGuard {
+	interval := cfg.CheckInterval.Duration
+	if interval <= 0 {
+		interval = config.DEFAULT_MEMORY_CHECK_INTERVAL_SEC * time.Second
+	}
+	evictBatch := cfg.EvictBatch
+	if evictBatch <= 0 {
+		evictBatch = config.DEFAULT_MEMORY_EVICT_BATCH
+	}
+	return &MemoryGuard{
+		maxHeapBytes: cfg.MaxHeapBytes,
+		maxRSSBytes:  cfg.MaxRSSBytes,
+		interval:     interval,
+		evictBatch:   evictBatch,
+		evictor:      evictor,
+	}
+}
+
+func (guard *MemoryGuard) Start() {
+	go func() {
+		ticker := time.NewTicker(guard.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			guard.check()
+		}
+	}()
+}
+
+// evicts one batch of series if heap or RSS exceeds the limits
+func (guard *MemoryGuard) check() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	overHeap := guard.maxHeapBytes > 0 && stats.HeapAlloc > guard.maxHeapBytes
+
+	overRSS := false
+	var rss uint64
+	if guard.maxRSSBytes > 0 {
+		var err error
+		rss, err = readRSS()
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Unable to read process RSS: %v", err))
+		} else {
+			overRSS = rss > guard.maxRSSBytes
+		}
+	}
+
+	guard.overLimit.Store(overHeap || overRSS)
+	if !overHeap && !overRSS {
+		return
+	}
+
+	var exceeded []string
+	if overHeap {
+		exceeded = append(exceeded, fmt.Sprintf("heap %d > %d bytes", stats.HeapAlloc, guard.maxHeapBytes))
+	}
+	if overRSS {
+		exceeded = append(exceeded, fmt.Sprintf("RSS %d > %d bytes", rss, guard.maxRSSBytes))
+	}
+	evicted := guard.evictor.EvictOldest(guard.evictBatch)
+	logger.Warn(fmt.Sprintf("Memory limit exceeded (%s), evicted %d series: %s",
+		strings.Join(exceeded, ", "), len(evicted), strings.Join(evicted, ", ")))
+
+	// return freed memory to the OS so the next check sees the effect on RSS
+	debug.FreeOSMemory()
+}
+
+// reports whether the last check found the process over its limits
+func (guard *MemoryGuard) OverLimit() bool {
+	return guard.overLimit.Load()
+}
+
+// resident set size of the current process, Linux only
+func readRSS() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected /proc/self/statm format")
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}